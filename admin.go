@@ -0,0 +1,260 @@
+package sumdb
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pseudomuto/sumdb/internal/tree"
+)
+
+// Roles supported by the admin API, in increasing order of privilege.
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleOperator
+	RoleAdmin
+)
+
+// ErrUnauthenticated is returned by IdentityExtractors when a request carries no (or invalid) credentials.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+type (
+	// Role is the level of access granted to an admin API caller. Each role includes the privileges of the roles
+	// below it: viewers can read state, operators can perform routine operations (running maintenance jobs, releasing
+	// quarantined versions and annotating records) and admins can change what the organization trusts (adding records
+	// in bulk, or importing the hashes of go.sum files). Roles only protect the admin API's endpoints: operations such
+	// as key rotation (see the sumdb keys rotate command) and exclusions (see WithDenyAfter) aren't served by it.
+	Role int
+
+	// Identity is an authenticated admin API caller.
+	Identity struct {
+		Subject string
+		Role    Role
+	}
+
+	// IdentityExtractor authenticates admin API requests.
+	// Implementations return ErrUnauthenticated when the request doesn't carry valid credentials.
+	IdentityExtractor interface {
+		Identify(r *http.Request) (Identity, error)
+	}
+
+	// IdentityFunc is an adapter to allow the use of ordinary functions as an IdentityExtractor.
+	IdentityFunc func(r *http.Request) (Identity, error)
+
+	// adminRoute is an admin API endpoint along with the minimum role required to call it.
+	// Routes with an audit operation are recorded in the audit log when they succeed.
+	adminRoute struct {
+		method  string
+		path    string
+		role    Role
+		audit   string
+		handler http.HandlerFunc
+	}
+
+	// identityKey is the context key for the authenticated Identity.
+	identityKey struct{}
+)
+
+// String returns the name of the role.
+func (r Role) String() string {
+	switch r {
+	case RoleNone:
+		return "none"
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+}
+
+// Identify calls f(r).
+func (f IdentityFunc) Identify(r *http.Request) (Identity, error) { return f(r) }
+
+// BearerIdentity authenticates requests with an `Authorization: Bearer <token>` header, using verify to validate the
+// token and map it to an Identity. This is the integration point for OIDC: verify should validate the JWT signature,
+// issuer, audience and expiry and map its claims to a Role.
+func BearerIdentity(verify func(ctx context.Context, token string) (Identity, error)) IdentityExtractor {
+	return IdentityFunc(func(r *http.Request) (Identity, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			return Identity{}, ErrUnauthenticated
+		}
+		return verify(r.Context(), token)
+	})
+}
+
+// MTLSIdentity authenticates requests using the subject alternative names (DNS names, URIs and email addresses) of
+// the verified client certificate. Each SAN is looked up in roles and the caller is granted the highest matching
+// role.
+//
+// The server's tls.Config must require and verify client certificates; this extractor only inspects the verified
+// chain.
+func MTLSIdentity(roles map[string]Role) IdentityExtractor {
+	return IdentityFunc(func(r *http.Request) (Identity, error) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return Identity{}, ErrUnauthenticated
+		}
+
+		var id Identity
+		for _, san := range subjectAltNames(r.TLS.VerifiedChains[0][0]) {
+			if role, ok := roles[san]; ok && role > id.Role {
+				id = Identity{Subject: san, Role: role}
+			}
+		}
+
+		if id.Role == RoleNone {
+			return Identity{}, ErrUnauthenticated
+		}
+		return id, nil
+	})
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.URIs)+len(cert.EmailAddresses))
+	sans = append(sans, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return append(sans, cert.EmailAddresses...)
+}
+
+// IdentityFromContext returns the authenticated admin API caller, if any.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// AdminHandler returns an HTTP handler for the admin API.
+//
+// Every request is authenticated with the IdentityExtractor configured via WithAdminIdentity and must carry the
+// role required by the endpoint. Without an extractor all requests are rejected.
+//
+// The admin API should be served separately from Handler (e.g. on an internal listener) since it exposes operations
+// that alter what the organization trusts.
+func (s *SumDB) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range s.adminRoutes() {
+		var h http.Handler = route.handler
+		if route.audit != "" {
+			h = s.auditedHandler(route.audit, h)
+		}
+		mux.Handle(route.method+" "+route.path, s.requireRole(route.role, h))
+	}
+	return s.signResponses(mux)
+}
+
+func (s *SumDB) adminRoutes() []adminRoute {
+	return []adminRoute{
+		{method: http.MethodGet, path: "/status", role: RoleViewer, handler: s.serveAdminStatus},
+		{method: http.MethodGet, path: "/audit", role: RoleViewer, handler: s.serveAuditLog},
+		{method: http.MethodGet, path: "/maintenance", role: RoleViewer, handler: s.serveMaintenance},
+		{method: http.MethodGet, path: "/quarantine", role: RoleViewer, handler: s.serveQuarantine},
+		{method: http.MethodGet, path: "/records", role: RoleViewer, handler: s.serveRecentRecords},
+		{method: http.MethodGet, path: "/records/published", role: RoleViewer, handler: s.servePublishedRecords},
+		{method: http.MethodGet, path: "/records/search", role: RoleViewer, handler: s.serveSearchRecords},
+		{method: http.MethodGet, path: "/records/{id}/proof", role: RoleViewer, handler: s.serveRecordProof},
+		{method: http.MethodGet, path: "/records/{id}/path", role: RoleViewer, handler: s.serveRecordPath},
+		{method: http.MethodGet, path: "/ui/", role: RoleViewer, handler: uiHandler().ServeHTTP},
+		{
+			method:  http.MethodPost,
+			path:    "/maintenance/{job}",
+			role:    RoleOperator,
+			audit:   "maintenance",
+			handler: s.serveRunMaintenanceJob,
+		},
+		{
+			method:  http.MethodDelete,
+			path:    "/quarantine",
+			role:    RoleOperator,
+			audit:   "release",
+			handler: s.serveReleaseQuarantine,
+		},
+		{
+			method:  http.MethodPut,
+			path:    "/records/{id}/annotations/{key}",
+			role:    RoleOperator,
+			audit:   "annotate",
+			handler: s.serveSetAnnotation,
+		},
+		{
+			method:  http.MethodDelete,
+			path:    "/records/{id}/annotations/{key}",
+			role:    RoleOperator,
+			audit:   "annotate",
+			handler: s.serveDeleteAnnotation,
+		},
+		{
+			method:  http.MethodPost,
+			path:    "/records",
+			role:    RoleAdmin,
+			audit:   "add-records",
+			handler: s.serveAddRecords,
+		},
+		{
+			method:  http.MethodPost,
+			path:    "/records/gosum",
+			role:    RoleAdmin,
+			audit:   "import-gosum",
+			handler: s.serveImportGoSum,
+		},
+	}
+}
+
+// requireRole authenticates the request and ensures the caller has at least the given role.
+func (s *SumDB) requireRole(role Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.adminIdentity == nil {
+			http.Error(w, "admin API is not configured", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := s.adminIdentity.Identify(r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		if id.Role < role {
+			http.Error(w, fmt.Sprintf("requires %s role", role), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+func (s *SumDB) serveAdminStatus(w http.ResponseWriter, r *http.Request) {
+	size, err := s.store.TreeSize(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hash, err := tree.TreeHashAt(r.Context(), s.store, size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"tree_size": size,
+		"root_hash": hash.String(),
+		"upstreams": s.failback.health(),
+	})
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
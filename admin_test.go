@@ -0,0 +1,148 @@
+package sumdb_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAdminHandler(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	t.Run("rejects requests without an identity extractor", func(t *testing.T) {
+		db, err := New("test.example.com", skey)
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		db.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("authorizes by role", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := NewMockStore(ctrl)
+		store.EXPECT().TreeSize(gomock.Any()).Return(int64(0), nil)
+
+		tokens := map[string]Identity{
+			"viewer": {Subject: "alice", Role: RoleViewer},
+			"nobody": {Subject: "mallory", Role: RoleNone},
+		}
+		db, err := New("test.example.com", skey,
+			WithStore(store),
+			WithAdminIdentity(BearerIdentity(func(_ context.Context, token string) (Identity, error) {
+				if id, ok := tokens[token]; ok {
+					return id, nil
+				}
+				return Identity{}, ErrUnauthenticated
+			})),
+		)
+		require.NoError(t, err)
+
+		tests := map[string]int{
+			"":       http.StatusUnauthorized,
+			"bogus":  http.StatusUnauthorized,
+			"nobody": http.StatusForbidden,
+			"viewer": http.StatusOK,
+		}
+
+		for token, status := range tests {
+			req := httptest.NewRequest(http.MethodGet, "/status", nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			rec := httptest.NewRecorder()
+			db.AdminHandler().ServeHTTP(rec, req)
+			require.Equal(t, status, rec.Code, "token: %q", token)
+		}
+	})
+
+	t.Run("requires the admin role to change what's trusted", func(t *testing.T) {
+		tokens := map[string]Identity{
+			"operator": {Subject: "bob", Role: RoleOperator},
+			"admin":    {Subject: "carol", Role: RoleAdmin},
+		}
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithAdminIdentity(BearerIdentity(func(_ context.Context, token string) (Identity, error) {
+				if id, ok := tokens[token]; ok {
+					return id, nil
+				}
+				return Identity{}, ErrUnauthenticated
+			})),
+		)
+		require.NoError(t, err)
+
+		serve := func(token, path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			db.AdminHandler().ServeHTTP(rec, req)
+			return rec
+		}
+
+		add := `{"modules": ["example.com/a@v1.0.0", "example.com/b@v1.0.0"]}`
+		rec := serve("operator", "/records", add)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Contains(t, rec.Body.String(), "requires admin role")
+
+		rec = serve("admin", "/records", add)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.JSONEq(t, `{"ids": [0, 1]}`, rec.Body.String())
+
+		// go.sum files are imported as they are, so only admins may import them.
+		records, err := db.ReadRecords(t.Context(), 0, 2)
+		require.NoError(t, err)
+		goSum := string(records[0]) + string(records[1])
+
+		rec = serve("operator", "/records/gosum", goSum)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+
+		rec = serve("admin", "/records/gosum", goSum)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.JSONEq(t, `{"added": 0}`, rec.Body.String())
+
+		rec = serve("admin", "/records/gosum", "not a go.sum file\n")
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestMTLSIdentity(t *testing.T) {
+	extractor := MTLSIdentity(map[string]Role{
+		"ops.example.com":   RoleOperator,
+		"admin@example.com": RoleAdmin,
+	})
+
+	request := func(cert *x509.Certificate) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		return req
+	}
+
+	_, err := extractor.Identify(request(nil))
+	require.ErrorIs(t, err, ErrUnauthenticated)
+
+	_, err = extractor.Identify(request(&x509.Certificate{DNSNames: []string{"unknown.example.com"}}))
+	require.ErrorIs(t, err, ErrUnauthenticated)
+
+	id, err := extractor.Identify(request(&x509.Certificate{
+		DNSNames:       []string{"ops.example.com"},
+		EmailAddresses: []string{"admin@example.com"},
+	}))
+	require.NoError(t, err)
+	require.Equal(t, Identity{Subject: "admin@example.com", Role: RoleAdmin}, id)
+}
@@ -0,0 +1,196 @@
+// Package alert delivers integrity alerts raised by the sumdb server and its tooling (forks detected by the monitor,
+// upstreams that disagree, records failing verification) to the places operators watch.
+//
+// An Alerter receives each Alert. Built-in sinks log alerts, post them as JSON to a webhook, to a Slack-compatible
+// incoming webhook or to PagerDuty, and Multi fans alerts out to several sinks:
+//
+//	alerter := alert.Multi(
+//		alert.Log(nil),
+//		alert.Slack("https://hooks.slack.com/services/...", nil),
+//		alert.PagerDuty(alert.PagerDutyEventsURL, routingKey, nil),
+//	)
+//
+//	db, err := sumdb.New(name, skey, sumdb.WithAlerter(alerter))
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PagerDutyEventsURL is the endpoint of PagerDuty's Events API v2.
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Alert severities.
+const (
+	// Critical alerts mean the integrity of a log can't be trusted, e.g. a checksum database has forked its log or the
+	// upstreams disagree about a module's hashes.
+	Critical Severity = "critical"
+
+	// Warning alerts need attention but don't compromise integrity on their own.
+	Warning Severity = "warning"
+)
+
+type (
+	// Severity is the severity of an Alert.
+	Severity string
+
+	// Alert describes an integrity failure.
+	Alert struct {
+		// Source is the subsystem raising the alert (e.g. "monitor" or "cross-check").
+		Source string `json:"source"`
+
+		Severity Severity `json:"severity"`
+
+		// Summary is a one-line description of the failure.
+		Summary string `json:"summary"`
+
+		// Details holds the evidence of the failure, such as the module version or signed tree heads involved.
+		Details map[string]string `json:"details,omitempty"`
+
+		Time time.Time `json:"time"`
+	}
+
+	// Alerter delivers alerts.
+	Alerter interface {
+		Alert(ctx context.Context, a *Alert) error
+	}
+
+	// Func adapts a function to an Alerter.
+	Func func(ctx context.Context, a *Alert) error
+
+	// HTTPClient defines an HTTP client for executing requests.
+	HTTPClient interface {
+		Do(*http.Request) (*http.Response, error)
+	}
+
+	// multi delivers alerts to several alerters.
+	multi []Alerter
+
+	// poster posts alerts, encoded by encode, to url.
+	poster struct {
+		url    string
+		client HTTPClient
+		encode func(*Alert) any
+	}
+)
+
+// Alert implements Alerter.
+func (f Func) Alert(ctx context.Context, a *Alert) error {
+	return f(ctx, a)
+}
+
+// Multi returns an Alerter delivering alerts to each of alerters. Every alerter receives every alert, even when
+// others fail, and the errors of those that failed are joined.
+func Multi(alerters ...Alerter) Alerter {
+	return multi(alerters)
+}
+
+// Log returns an Alerter writing alerts to l, or to the standard logger if l is nil.
+func Log(l *log.Logger) Alerter {
+	if l == nil {
+		l = log.Default()
+	}
+
+	return Func(func(_ context.Context, a *Alert) error {
+		l.Print(a.String())
+		return nil
+	})
+}
+
+// Webhook returns an Alerter posting alerts to url as JSON objects with the fields of Alert. Requests are sent with
+// client, or http.DefaultClient if it's nil.
+func Webhook(url string, client HTTPClient) Alerter {
+	return newPoster(url, client, func(a *Alert) any { return a })
+}
+
+// Slack returns an Alerter posting alerts to a Slack incoming webhook at url. The payload is a JSON object with a
+// single "text" field, which Mattermost, Rocket.Chat and Google Chat webhooks also accept.
+func Slack(url string, client HTTPClient) Alerter {
+	return newPoster(url, client, func(a *Alert) any {
+		return map[string]string{"text": a.String()}
+	})
+}
+
+// PagerDuty returns an Alerter triggering PagerDuty incidents through the Events API v2 at url (normally
+// PagerDutyEventsURL), for the service integration with the given routing key. Alerts with the same source and
+// summary are deduplicated into a single incident.
+func PagerDuty(url, routingKey string, client HTTPClient) Alerter {
+	return newPoster(url, client, func(a *Alert) any {
+		dedup := a.Source + ": " + a.Summary
+		return map[string]any{
+			"routing_key":  routingKey,
+			"event_action": "trigger",
+			"dedup_key":    dedup[:min(len(dedup), 255)],
+			"payload": map[string]any{
+				"summary":        a.Summary,
+				"source":         a.Source,
+				"severity":       a.Severity,
+				"timestamp":      a.Time.Format(time.RFC3339),
+				"custom_details": a.Details,
+			},
+		}
+	})
+}
+
+// String formats a as a single line of text, with its details sorted by key.
+func (a *Alert) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s: %s", a.Severity, a.Source, a.Summary)
+	for _, k := range slices.Sorted(maps.Keys(a.Details)) {
+		fmt.Fprintf(&b, " %s=%q", k, a.Details[k])
+	}
+	return b.String()
+}
+
+func (m multi) Alert(ctx context.Context, a *Alert) error {
+	var errs []error
+	for _, alerter := range m {
+		if err := alerter.Alert(ctx, a); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func newPoster(url string, client HTTPClient, encode func(*Alert) any) *poster {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &poster{url: url, client: client, encode: encode}
+}
+
+func (p *poster) Alert(ctx context.Context, a *Alert) error {
+	body, err := json.Marshal(p.encode(a))
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed creating request: %s, %w", p.url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send alert: %s, %w", p.url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to send alert: %s, received: %d", p.url, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package alert_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb/alert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlerters(t *testing.T) {
+	a := &Alert{
+		Source:   "monitor",
+		Severity: Critical,
+		Summary:  "log has forked",
+		Details:  map[string]string{"url": "https://sum.example.com", "old": "tree 1"},
+		Time:     time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	t.Run("log", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, Log(log.New(&buf, "", 0)).Alert(t.Context(), a))
+		require.Equal(t, `[critical] monitor: log has forked old="tree 1" url="https://sum.example.com"`+"\n", buf.String())
+	})
+
+	t.Run("webhook", func(t *testing.T) {
+		body := receive(t, Webhook, a)
+
+		var got Alert
+		require.NoError(t, json.Unmarshal(body, &got))
+		require.Equal(t, *a, got)
+	})
+
+	t.Run("slack", func(t *testing.T) {
+		body := receive(t, Slack, a)
+		require.JSONEq(t, `{"text": "[critical] monitor: log has forked old=\"tree 1\" url=\"https://sum.example.com\""}`,
+			string(body))
+	})
+
+	t.Run("pagerduty", func(t *testing.T) {
+		body := receive(t, func(url string, c HTTPClient) Alerter { return PagerDuty(url, "routing-key", c) }, a)
+		require.JSONEq(t, `{
+			"routing_key": "routing-key",
+			"event_action": "trigger",
+			"dedup_key": "monitor: log has forked",
+			"payload": {
+				"summary": "log has forked",
+				"source": "monitor",
+				"severity": "critical",
+				"timestamp": "2026-01-02T03:04:05Z",
+				"custom_details": {"url": "https://sum.example.com", "old": "tree 1"}
+			}
+		}`, string(body))
+	})
+
+	t.Run("failed deliveries", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "nope", http.StatusInternalServerError)
+		}))
+		t.Cleanup(srv.Close)
+
+		err := Webhook(srv.URL, srv.Client()).Alert(t.Context(), a)
+		require.ErrorContains(t, err, "received: 500")
+	})
+
+	t.Run("multi", func(t *testing.T) {
+		var delivered int
+		ok := Func(func(context.Context, *Alert) error {
+			delivered++
+			return nil
+		})
+		failed := Func(func(context.Context, *Alert) error { return errors.New("failed") })
+
+		// Every alerter receives the alert, even after one fails.
+		err := Multi(ok, failed, ok).Alert(t.Context(), a)
+		require.EqualError(t, err, "failed")
+		require.Equal(t, 2, delivered)
+
+		require.NoError(t, Multi().Alert(t.Context(), a))
+	})
+}
+
+// receive delivers a with the alerter returned by newAlerter for a test server, and returns the body it received.
+func receive(t *testing.T, newAlerter func(string, HTTPClient) Alerter, a *Alert) []byte {
+	t.Helper()
+
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies <- body
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+
+	require.NoError(t, newAlerter(srv.URL, srv.Client()).Alert(t.Context(), a))
+	return <-bodies
+}
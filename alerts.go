@@ -0,0 +1,43 @@
+package sumdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/pseudomuto/sumdb/alert"
+)
+
+// Sources of the alerts raised by a SumDB. See WithAlerter.
+const (
+	alertSourceCrossCheck           = "cross-check"
+	alertSourceRecheck              = "recheck"
+	alertSourceUpstreamSumDB        = "upstream-sumdb"
+	alertSourceUpstreamVerification = "upstream-verification"
+	alertSourceVerify               = "verify"
+)
+
+// alertTimeout bounds the delivery of an alert to each alerter.
+const alertTimeout = 30 * time.Second
+
+// raise delivers a to the alerters configured with WithAlerter. Alerts are delivered in the background, so that slow
+// sinks don't hold up the request raising them, and each delivery is counted in sumdb_alerts_total.
+func (s *SumDB) raise(ctx context.Context, a *alert.Alert) {
+	if len(s.alerters) == 0 {
+		return
+	}
+
+	a.Time = s.clock.Now()
+	ctx = context.WithoutCancel(ctx)
+	for _, alerter := range s.alerters {
+		go func() {
+			ctx, cancel := context.WithTimeout(ctx, alertTimeout)
+			defer cancel()
+
+			result := "sent"
+			if err := alerter.Alert(ctx, a); err != nil {
+				result = "failed"
+			}
+			s.metrics.alerts.With(a.Source, result).Inc()
+		}()
+	}
+}
@@ -0,0 +1,147 @@
+package sumdb_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/alert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestAlerts(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	// collect returns an alerter sending alerts to a channel.
+	collect := func() (alert.Alerter, chan *alert.Alert) {
+		alerts := make(chan *alert.Alert, 10)
+		return alert.Func(func(_ context.Context, a *alert.Alert) error {
+			alerts <- a
+			return nil
+		}), alerts
+	}
+
+	receive := func(t *testing.T, alerts chan *alert.Alert) *alert.Alert {
+		t.Helper()
+		select {
+		case a := <-alerts:
+			return a
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no alert raised")
+			return nil
+		}
+	}
+
+	t.Run("upstream mismatches", func(t *testing.T) {
+		primary, secondary := newFakeProxy(t), newFakeProxy(t)
+		alerter, alerts := collect()
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(primary.upstream(t)),
+			WithSecondaryUpstream(secondary.upstream(t)),
+			WithAlerter(alerter),
+		)
+		require.NoError(t, err)
+
+		mod := module.Version{Path: "example.com/bad", Version: "v1.0.0"}
+		secondary.setTampered(mod, true)
+		_, err = db.Lookup(t.Context(), mod)
+		require.ErrorIs(t, err, ErrUpstreamMismatch)
+
+		a := receive(t, alerts)
+		require.Equal(t, "cross-check", a.Source)
+		require.Equal(t, alert.Critical, a.Severity)
+		require.Equal(t, "example.com/bad@v1.0.0", a.Details["module"])
+		require.NotEqual(t, a.Details["primary"], a.Details["secondary"])
+		require.False(t, a.Time.IsZero())
+	})
+
+	t.Run("upstream verification failures", func(t *testing.T) {
+		upstream := newTrustedSumDB(t)
+		_, otherVkey, err := GenerateKeys("sum.example.com")
+		require.NoError(t, err)
+
+		alerter, alerts := collect()
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithTrustedSumDB(otherVkey, upstream.url),
+			WithAlerter(alerter),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/foo", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrUpstreamVerification)
+
+		a := receive(t, alerts)
+		require.Equal(t, "upstream-verification", a.Source)
+		require.Equal(t, alert.Critical, a.Severity)
+		require.Equal(t, "example.com/foo@v1.0.0", a.Details["module"])
+	})
+
+	t.Run("go.sum mismatches", func(t *testing.T) {
+		alerter, alerts := collect()
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithAlerter(alerter),
+		)
+		require.NoError(t, err)
+
+		report, err := db.VerifyBatch(t.Context(), []GoSumEntry{
+			{Path: "example.com/a", Version: "v1.0.0", Hash: "h1:tampered="},
+		})
+		require.NoError(t, err)
+		require.False(t, report.OK)
+
+		a := receive(t, alerts)
+		require.Equal(t, "verify", a.Source)
+		require.Equal(t, "1 go.sum entries don't match the log", a.Summary)
+		require.Contains(t, a.Details["example.com/a v1.0.0"], "go.sum h1:tampered=, log h1:")
+
+		// Entries that match don't raise alerts.
+		_, err = db.VerifyBatch(t.Context(), []GoSumEntry{
+			{Path: "example.com/a", Version: "v1.0.0", Hash: report.Entries[0].Actual},
+		})
+		require.NoError(t, err)
+		select {
+		case a := <-alerts:
+			require.FailNow(t, "unexpected alert", a.Summary)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("delivery metrics", func(t *testing.T) {
+		primary, secondary := newFakeProxy(t), newFakeProxy(t)
+		failed := make(chan struct{})
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(primary.upstream(t)),
+			WithSecondaryUpstream(secondary.upstream(t)),
+			WithAlerter(alert.Func(func(context.Context, *alert.Alert) error {
+				defer close(failed)
+				return errors.New("unreachable")
+			})),
+		)
+		require.NoError(t, err)
+
+		mod := module.Version{Path: "example.com/bad", Version: "v1.0.0"}
+		secondary.setTampered(mod, true)
+		_, err = db.Lookup(t.Context(), mod)
+		require.ErrorIs(t, err, ErrUpstreamMismatch)
+		<-failed
+
+		require.Eventually(t, func() bool {
+			rec := httptest.NewRecorder()
+			db.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			return strings.Contains(rec.Body.String(), `sumdb_alerts_total{source="cross-check",result="failed"} 1`)
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,125 @@
+package sumdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// ErrAnnotationsUnsupported is returned when annotating records and the Store doesn't implement AnnotationStore.
+var ErrAnnotationsUnsupported = errors.New("store does not support annotations")
+
+// Annotate sets the annotation key to value on the record with the given ID. An empty value removes the annotation.
+//
+// Annotations are metadata stored alongside the log rather than in it: they're never part of a record's data, aren't
+// covered by signed tree heads and can change at any time. It returns ErrAnnotationsUnsupported if the Store doesn't
+// implement AnnotationStore and ErrNotFound if the record doesn't exist.
+func (s *SumDB) Annotate(ctx context.Context, id int64, key, value string) error {
+	as, ok := s.store.(AnnotationStore)
+	if !ok {
+		return ErrAnnotationsUnsupported
+	}
+
+	if key == "" {
+		return errors.New("annotation key must not be empty")
+	}
+
+	if err := s.checkRecordID(ctx, id); err != nil {
+		return err
+	}
+
+	if err := as.SetAnnotation(ctx, id, key, value); err != nil {
+		return fmt.Errorf("failed to set annotation: %d, %s, %w", id, key, err)
+	}
+
+	return nil
+}
+
+// Annotations returns the annotations for the record with the given ID.
+//
+// It returns ErrAnnotationsUnsupported if the Store doesn't implement AnnotationStore and ErrNotFound if the record
+// doesn't exist.
+func (s *SumDB) Annotations(ctx context.Context, id int64) (map[string]string, error) {
+	as, ok := s.store.(AnnotationStore)
+	if !ok {
+		return nil, ErrAnnotationsUnsupported
+	}
+
+	if err := s.checkRecordID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	annotations, err := as.Annotations(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get annotations: %d, %w", id, err)
+	}
+
+	return annotations, nil
+}
+
+// checkRecordID returns ErrNotFound if id isn't in the tree.
+func (s *SumDB) checkRecordID(ctx context.Context, id int64) error {
+	size, err := s.store.TreeSize(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get tree size: %w", err)
+	}
+
+	if id < 0 || id >= size {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// serveSetAnnotation serves PUT /records/{id}/annotations/{key} requests. The body is a JSON object with the
+// annotation value, e.g. {"value": "approved"}.
+func (s *SumDB) serveSetAnnotation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid record id", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !s.auditRequest(w, r, "value="+strconv.Quote(body.Value)) {
+		return
+	}
+	s.annotate(w, r, id, body.Value)
+}
+
+// serveDeleteAnnotation serves DELETE /records/{id}/annotations/{key} requests.
+func (s *SumDB) serveDeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid record id", http.StatusBadRequest)
+		return
+	}
+
+	if !s.auditRequest(w, r, "") {
+		return
+	}
+	s.annotate(w, r, id, "")
+}
+
+func (s *SumDB) annotate(w http.ResponseWriter, r *http.Request, id int64, value string) {
+	switch err := s.Annotate(r.Context(), id, r.PathValue("key"), value); {
+	case errors.Is(err, ErrAnnotationsUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
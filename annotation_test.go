@@ -0,0 +1,158 @@
+package sumdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotate(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := newAnnotatedStore(t, 2)
+	db, err := New("test.example.com", skey, WithStore(store))
+	require.NoError(t, err)
+
+	require.NoError(t, db.Annotate(t.Context(), 1, "status", "approved"))
+	require.NoError(t, db.Annotate(t.Context(), 1, "owner", "platform"))
+
+	annotations, err := db.Annotations(t.Context(), 1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"status": "approved", "owner": "platform"}, annotations)
+
+	require.NoError(t, db.Annotate(t.Context(), 1, "owner", ""))
+	annotations, err = db.Annotations(t.Context(), 1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"status": "approved"}, annotations)
+
+	require.ErrorIs(t, db.Annotate(t.Context(), 2, "status", "approved"), ErrNotFound)
+	require.ErrorContains(t, db.Annotate(t.Context(), 0, "", "approved"), "must not be empty")
+
+	t.Run("unsupported", func(t *testing.T) {
+		db, err := New("test.example.com", skey, WithStore(newMemStore()))
+		require.NoError(t, err)
+
+		require.ErrorIs(t, db.Annotate(t.Context(), 0, "status", "approved"), ErrAnnotationsUnsupported)
+		_, err = db.Annotations(t.Context(), 0)
+		require.ErrorIs(t, err, ErrAnnotationsUnsupported)
+	})
+}
+
+func TestAnnotationsAPI(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := newAnnotatedStore(t, 1)
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithAdminIdentity(IdentityFunc(func(*http.Request) (Identity, error) {
+			return Identity{Subject: "alice", Role: RoleOperator}, nil
+		})),
+	)
+	require.NoError(t, err)
+
+	admin := db.AdminHandler()
+	api := db.APIHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/records/0/annotations/status",
+		strings.NewReader(`{"value": "deprecated"}`)))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records/0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{
+		"id": 0,
+		"path": "example.com/mod0",
+		"version": "v1.0.0",
+		"data": "data\n",
+		"annotations": {"status": "deprecated"}
+	}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/records/0/annotations/status", nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records/0/annotations", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var annotations map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &annotations))
+	require.Empty(t, annotations)
+
+	t.Run("errors", func(t *testing.T) {
+		tests := map[string]int{
+			"/records/1":             http.StatusNotFound,
+			"/records/1/annotations": http.StatusNotFound,
+			"/records/x":             http.StatusBadRequest,
+		}
+
+		for path, status := range tests {
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			require.Equal(t, status, rec.Code, path)
+			require.Contains(t, rec.Body.String(), `"error"`)
+		}
+
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/records/0/annotations/status",
+			strings.NewReader(`not json`)))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+// annotatedStore is a memStore that also implements AnnotationStore.
+type annotatedStore struct {
+	*memStore
+	annotations map[int64]map[string]string
+}
+
+// newAnnotatedStore returns an annotatedStore with n records.
+func newAnnotatedStore(t *testing.T, n int64) *annotatedStore {
+	t.Helper()
+
+	s := &annotatedStore{memStore: newMemStore(), annotations: make(map[int64]map[string]string)}
+	for i := range n {
+		rec := &Record{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0", Data: []byte("data\n")}
+		_, err := s.AddRecord(t.Context(), rec)
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.SetTreeSize(t.Context(), n))
+	return s
+}
+
+func (s *annotatedStore) SetAnnotation(_ context.Context, id int64, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if value == "" {
+		delete(s.annotations[id], key)
+		return nil
+	}
+
+	if s.annotations[id] == nil {
+		s.annotations[id] = make(map[string]string)
+	}
+	s.annotations[id][key] = value
+	return nil
+}
+
+func (s *annotatedStore) Annotations(_ context.Context, id int64) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]string, len(s.annotations[id]))
+	maps.Copy(out, s.annotations[id])
+	return out, nil
+}
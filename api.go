@@ -0,0 +1,220 @@
+package sumdb
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+type (
+	// apiRecord is the JSON representation of a record.
+	apiRecord struct {
+		ID          int64             `json:"id"`
+		Path        string            `json:"path"`
+		Version     string            `json:"version"`
+		Data        string            `json:"data"`
+		Published   *time.Time        `json:"published,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+
+	// apiRecordPath is the JSON representation of a record's path to the root of the tree.
+	apiRecordPath struct {
+		ID         int64         `json:"id"`
+		TreeSize   int64         `json:"tree_size"`
+		RecordHash string        `json:"record_hash"`
+		RootHash   string        `json:"root_hash"`
+		Path       []apiPathStep `json:"path"`
+		SignedHead string        `json:"signed_head"`
+	}
+
+	// apiPathStep is the JSON representation of a step of a record's path, from its leaf up to the root.
+	apiPathStep struct {
+		Level        int    `json:"level"`
+		Direction    string `json:"direction"` // the sibling's side, "left" or "right"
+		Sibling      string `json:"sibling"`
+		SiblingStart int64  `json:"sibling_start"`
+		SiblingEnd   int64  `json:"sibling_end"`
+		Hash         string `json:"hash"`
+	}
+
+	// apiError is the JSON representation of an error response.
+	apiError struct {
+		Error string `json:"error"`
+	}
+)
+
+// APIHandler returns an HTTP handler for the JSON API.
+//
+// The JSON API serves metadata that isn't part of the sumdb protocol, such as record annotations. None of it is
+// covered by the tree's signatures, so it's served separately from Handler and clients must not treat it as
+// authenticated unless responses are signed (see WithSignedResponses). CORS headers are added for the origins
+// configured with WithCORS.
+//
+//	GET /records/{id}              the record's module path, version, data and annotations
+//	GET /records/{id}/annotations  the record's annotations
+//	GET /records/{id}/path         the record's Merkle path to the root of the current tree, or of the tree with
+//	                               the given size with ?size={size}
+//	GET /records/stream?from={id}  server-sent events for each record from id onwards, including new records
+//	GET /tree?at={time}            the tree as it was at the given RFC 3339 time (see TreeAt)
+//	GET /tree/proof?old={size}     the proof that the current tree, or the tree with the given size with
+//	                               &size={size}, contains the tree of the old size (see ProveConsistency)
+//	POST /verify                   verifies the go.sum in the request body, returning a Report (see VerifyBatch)
+func (s *SumDB) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /records/stream", s.serveAPIStream)
+	mux.HandleFunc("GET /records/{id}", s.serveAPIRecord)
+	mux.HandleFunc("GET /records/{id}/annotations", s.serveAPIAnnotations)
+	mux.HandleFunc("GET /records/{id}/path", s.serveRecordPath)
+	mux.HandleFunc("GET /tree", s.serveTreeAt)
+	mux.HandleFunc("GET /tree/proof", s.serveTreeProof)
+	mux.HandleFunc("POST /verify", s.serveVerify)
+	return s.cors("GET, HEAD, POST", s.signResponses(mux))
+}
+
+func (s *SumDB) serveAPIRecord(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiRecordID(w, r)
+	if !ok {
+		return
+	}
+
+	recs, err := s.store.Records(r.Context(), id, 1)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(recs) == 0 {
+		writeAPIError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+
+	annotations, err := s.Annotations(r.Context(), id)
+	if err != nil && !errors.Is(err, ErrAnnotationsUnsupported) {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rec := newAPIRecord(id, recs[0])
+	rec.Annotations = annotations
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// newAPIRecord returns the JSON representation of rec, whose ID is id.
+func newAPIRecord(id int64, rec *Record) apiRecord {
+	out := apiRecord{ID: id, Path: rec.Path, Version: rec.Version, Data: string(rec.Data)}
+	if !rec.Published.IsZero() {
+		out.Published = &rec.Published
+	}
+	return out
+}
+
+func (s *SumDB) serveAPIAnnotations(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiRecordID(w, r)
+	if !ok {
+		return
+	}
+
+	annotations, err := s.Annotations(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrAnnotationsUnsupported):
+		writeAPIError(w, http.StatusNotImplemented, err)
+	case errors.Is(err, ErrNotFound):
+		writeAPIError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, annotations)
+	}
+}
+
+// serveRecordPath serves GET /records/{id}/path requests, returning each step from the record's leaf to the root of the
+// current tree: the level of the node produced, the sibling it's combined with and which side the sibling is on. The
+// siblings are the record's inclusion proof, so the path can be checked against the signed tree head returned with it.
+// With a size parameter, the path is to the root of the tree as it was at that size, e.g. one returned by TreeAt.
+func (s *SumDB) serveRecordPath(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiRecordID(w, r)
+	if !ok {
+		return
+	}
+
+	size, err := s.store.TreeSize(r.Context())
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if size, err = queryInt(r, "size", size); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	t, err := s.TreeOfSize(r.Context(), size)
+	if err != nil {
+		writeAPIError(w, proofStatus(err), err)
+		return
+	}
+	if id >= size {
+		writeAPIError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+
+	recs, err := s.store.Records(r.Context(), id, 1)
+	if err != nil || len(recs) == 0 {
+		writeAPIError(w, http.StatusInternalServerError, errors.New("failed to read record"))
+		return
+	}
+
+	// As with proofs, the path and signed tree head must be for the same tree.
+	steps, err := tree.RecordPath(r.Context(), s.store, size, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	signed, err := s.signTree(r.Context(), t)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	out := apiRecordPath{
+		ID:         id,
+		TreeSize:   size,
+		RecordHash: tlog.RecordHash(recs[0].Data).String(),
+		RootHash:   t.Hash.String(),
+		Path:       make([]apiPathStep, len(steps)),
+		SignedHead: string(signed),
+	}
+	for i, step := range steps {
+		direction := "right"
+		if step.Left {
+			direction = "left"
+		}
+		out.Path[i] = apiPathStep{
+			Level:        step.Level,
+			Direction:    direction,
+			Sibling:      step.Sibling.String(),
+			SiblingStart: step.Start,
+			SiblingEnd:   step.End,
+			Hash:         step.Hash.String(),
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// apiRecordID parses the {id} path value, writing an error response if it's invalid.
+func apiRecordID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 0 {
+		writeAPIError(w, http.StatusBadRequest, errors.New("invalid record id"))
+		return 0, false
+	}
+	return id, true
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
@@ -0,0 +1,287 @@
+package sumdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+const auditHeader = "sumdb audit entry"
+
+var (
+	// ErrAuditUnsupported is returned when recording an audit entry, or when an audit key is configured, and the Store
+	// doesn't implement AuditStore.
+	ErrAuditUnsupported = errors.New("store does not support audit logging")
+
+	// ErrAuditChainBroken is returned by VerifyAuditLog when entries are missing, reordered or modified.
+	ErrAuditChainBroken = errors.New("audit log chain is broken")
+)
+
+// auditOperationKey is the context key for the operation of the admin request being audited by auditedHandler.
+type auditOperationKey struct{}
+
+// AuditEntry is a record of an admin operation.
+//
+// Entries are signed notes chained together by including the hash of the previous signed entry, so that tampering
+// with the admin history (modifying, removing or reordering entries) is detectable.
+type AuditEntry struct {
+	ID        int64
+	Time      time.Time
+	Subject   string
+	Role      Role
+	Operation string
+	Detail    string
+
+	// Prev is the SHA-256 hash of the previous signed entry (zero for the first entry).
+	Prev [sha256.Size]byte
+}
+
+// Audit records an admin operation performed by id in the audit log.
+//
+// Admin API operations that change state are recorded automatically. Audit can be used to record operations performed
+// by other means (e.g. CLI tools) in the same log. It returns ErrAuditUnsupported if the Store doesn't implement
+// AuditStore.
+//
+// The audit log has a single writer: appends are only serialized within this server, so servers sharing a Store would
+// chain concurrent entries to the same previous one. Serve the admin API (and call Audit) from one server per Store.
+func (s *SumDB) Audit(ctx context.Context, id Identity, operation, detail string) error {
+	as, ok := s.store.(AuditStore)
+	if !ok {
+		return ErrAuditUnsupported
+	}
+
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+
+	size, err := as.AuditSize(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get audit log size: %w", err)
+	}
+
+	entry := &AuditEntry{
+		ID:        size,
+		Time:      s.clock.Now().UTC(),
+		Subject:   id.Subject,
+		Role:      id.Role,
+		Operation: operation,
+		Detail:    detail,
+	}
+
+	if size > 0 {
+		prev, err := as.AuditEntries(ctx, size-1, 1)
+		if err != nil {
+			return fmt.Errorf("failed to read previous audit entry: %w", err)
+		}
+		if len(prev) != 1 {
+			return fmt.Errorf("%w: missing entry %d", ErrAuditChainBroken, size-1)
+		}
+		entry.Prev = sha256.Sum256(prev[0])
+	}
+
+	signed, err := note.Sign(&note.Note{Text: entry.text()}, s.auditSigner)
+	if err != nil {
+		return fmt.Errorf("failed to sign audit entry: %w", err)
+	}
+
+	if err := as.AddAuditEntry(ctx, size, signed); err != nil {
+		return fmt.Errorf("failed to add audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyAuditLog verifies a sequence of signed audit entries (starting at the first entry of the log) against the
+// verifier key vkey, returning the parsed entries.
+//
+// It returns an error wrapping ErrAuditChainBroken if entries are missing, reordered or modified.
+func VerifyAuditLog(vkey string, entries [][]byte) ([]*AuditEntry, error) {
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verifier key: %w", err)
+	}
+
+	var prev [sha256.Size]byte
+	parsed := make([]*AuditEntry, len(entries))
+	for i, signed := range entries {
+		n, err := note.Open(signed, note.VerifierList(verifier))
+		if err != nil {
+			return nil, fmt.Errorf("%w: entry %d: %w", ErrAuditChainBroken, i, err)
+		}
+
+		entry, err := parseAuditEntry(n.Text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: entry %d: %w", ErrAuditChainBroken, i, err)
+		}
+
+		if entry.ID != int64(i) || entry.Prev != prev {
+			return nil, fmt.Errorf("%w: entry %d is out of sequence", ErrAuditChainBroken, i)
+		}
+
+		parsed[i] = entry
+		prev = sha256.Sum256(signed)
+	}
+
+	return parsed, nil
+}
+
+// text returns the note text for the entry.
+func (e *AuditEntry) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", auditHeader)
+	fmt.Fprintf(&b, "id %d\n", e.ID)
+	fmt.Fprintf(&b, "time %s\n", e.Time.Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "subject %s\n", strconv.Quote(e.Subject))
+	fmt.Fprintf(&b, "role %s\n", e.Role)
+	fmt.Fprintf(&b, "operation %s\n", strconv.Quote(e.Operation))
+	fmt.Fprintf(&b, "detail %s\n", strconv.Quote(e.Detail))
+	fmt.Fprintf(&b, "prev %s\n", base64.StdEncoding.EncodeToString(e.Prev[:]))
+	return b.String()
+}
+
+func parseAuditEntry(text string) (*AuditEntry, error) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if len(lines) != 8 || lines[0] != auditHeader {
+		return nil, errors.New("malformed audit entry")
+	}
+
+	fields := make(map[string]string, len(lines)-1)
+	for _, line := range lines[1:] {
+		k, v, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("malformed audit entry line: %q", line)
+		}
+		fields[k] = v
+	}
+
+	var (
+		e   AuditEntry
+		err error
+	)
+
+	if e.ID, err = strconv.ParseInt(fields["id"], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid id: %w", err)
+	}
+	if e.Time, err = time.Parse(time.RFC3339Nano, fields["time"]); err != nil {
+		return nil, fmt.Errorf("invalid time: %w", err)
+	}
+	if e.Subject, err = strconv.Unquote(fields["subject"]); err != nil {
+		return nil, fmt.Errorf("invalid subject: %w", err)
+	}
+	if e.Role, err = parseRole(fields["role"]); err != nil {
+		return nil, err
+	}
+	if e.Operation, err = strconv.Unquote(fields["operation"]); err != nil {
+		return nil, fmt.Errorf("invalid operation: %w", err)
+	}
+	if e.Detail, err = strconv.Unquote(fields["detail"]); err != nil {
+		return nil, fmt.Errorf("invalid detail: %w", err)
+	}
+
+	prev, err := base64.StdEncoding.DecodeString(fields["prev"])
+	if err != nil || len(prev) != sha256.Size {
+		return nil, errors.New("invalid prev hash")
+	}
+	copy(e.Prev[:], prev)
+
+	return &e, nil
+}
+
+func parseRole(s string) (Role, error) {
+	for r := RoleNone; r <= RoleAdmin; r++ {
+		if r.String() == s {
+			return r, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("invalid role: %q", s)
+}
+
+// auditedHandler marks the requests handled by next as audited admin operations: next must call auditRequest before
+// applying the operation, which records its audit entry. Recording the entry first means an operation is never applied
+// without one, although it may record operations that then fail. Requests are only audited when the Store implements
+// AuditStore, which New enforces when an audit key is configured and warns about when the admin API is enabled.
+func (s *SumDB) auditedHandler(operation string, next http.Handler) http.Handler {
+	if _, ok := s.store.(AuditStore); !ok {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), auditOperationKey{}, operation)))
+	})
+}
+
+// auditRequest records the audit entry of the admin request r, if it's audited, before the operation it requests is
+// applied. The entry's detail is the request URI, followed by detail if it isn't empty. It reports whether the
+// operation may be applied: when the entry can't be recorded, r is answered with 500 Internal Server Error instead.
+func (s *SumDB) auditRequest(w http.ResponseWriter, r *http.Request, detail string) bool {
+	operation, ok := r.Context().Value(auditOperationKey{}).(string)
+	if !ok {
+		return true
+	}
+
+	entry := r.URL.RequestURI()
+	if detail != "" {
+		entry += " " + detail
+	}
+
+	id, _ := IdentityFromContext(r.Context())
+	if err := s.Audit(r.Context(), id, operation, entry); err != nil {
+		http.Error(w, fmt.Sprintf("operation could not be audited, so it wasn't applied: %v", err),
+			http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// serveAuditLog serves the signed audit log entries in [from, from+n) as a text/plain stream of notes, separated by
+// blank lines.
+func (s *SumDB) serveAuditLog(w http.ResponseWriter, r *http.Request) {
+	as, ok := s.store.(AuditStore)
+	if !ok {
+		http.Error(w, ErrAuditUnsupported.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	from, err := queryInt(r, "from", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n, err := queryInt(r, "n", 100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := as.AuditEntries(r.Context(), from, min(n, 1000))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	_, _ = w.Write(bytes.Join(entries, []byte("\n")))
+}
+
+// queryInt parses a non-negative integer query parameter, returning def if it's not set.
+func queryInt(r *http.Request, name string, def int64) (int64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return n, nil
+}
@@ -0,0 +1,209 @@
+package sumdb_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAudit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var log [][]byte
+	store := NewMockAuditStore(ctrl)
+	store.EXPECT().AuditSize(gomock.Any()).DoAndReturn(func(context.Context) (int64, error) {
+		return int64(len(log)), nil
+	}).AnyTimes()
+	store.EXPECT().AddAuditEntry(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, id int64, entry []byte) error {
+			require.Equal(t, int64(len(log)), id)
+			log = append(log, entry)
+			return nil
+		},
+	).AnyTimes()
+	store.EXPECT().AuditEntries(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, id, n int64) ([][]byte, error) {
+			return log[id:min(id+n, int64(len(log)))], nil
+		},
+	).AnyTimes()
+
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithAdminIdentity(IdentityFunc(func(*http.Request) (Identity, error) {
+			return Identity{Subject: "alice", Role: RoleViewer}, nil
+		})),
+	)
+	require.NoError(t, err)
+
+	admin := Identity{Subject: "alice@example.com", Role: RoleAdmin}
+	require.NoError(t, db.Audit(t.Context(), admin, "rotate-key", "new key: test+1234"))
+	require.NoError(t, db.Audit(t.Context(), admin, "exclude", "example.com/bad@v1.0.0\nreason: \"malware\""))
+
+	t.Run("verifies the chain", func(t *testing.T) {
+		entries, err := VerifyAuditLog(vkey, log)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.Equal(t, "rotate-key", entries[0].Operation)
+		require.Equal(t, now, entries[0].Time)
+		require.Equal(t, RoleAdmin, entries[1].Role)
+		require.Equal(t, "example.com/bad@v1.0.0\nreason: \"malware\"", entries[1].Detail)
+	})
+
+	t.Run("detects removed entries", func(t *testing.T) {
+		_, err := VerifyAuditLog(vkey, log[1:])
+		require.ErrorIs(t, err, ErrAuditChainBroken)
+	})
+
+	t.Run("detects reordered entries", func(t *testing.T) {
+		_, err := VerifyAuditLog(vkey, [][]byte{log[1], log[0]})
+		require.ErrorIs(t, err, ErrAuditChainBroken)
+	})
+
+	t.Run("detects forged entries", func(t *testing.T) {
+		forged := append([]byte(nil), log[0]...)
+		forged[len("sumdb audit entry\nid 0\n")] ^= 1
+
+		_, err := VerifyAuditLog(vkey, [][]byte{forged, log[1]})
+		require.ErrorIs(t, err, ErrAuditChainBroken)
+	})
+
+	t.Run("serves the log", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		db.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/audit?from=1", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, string(log[1]), rec.Body.String())
+	})
+}
+
+func TestAudit_Unsupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	db, err := New("test.example.com", skey, WithStore(NewMockStore(ctrl)))
+	require.NoError(t, err)
+
+	err = db.Audit(t.Context(), Identity{Subject: "alice"}, "noop", "")
+	require.ErrorIs(t, err, ErrAuditUnsupported)
+}
+
+func TestAuditedHandler(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	admin := WithAdminIdentity(IdentityFunc(func(*http.Request) (Identity, error) {
+		return Identity{Subject: "carol", Role: RoleAdmin}, nil
+	}))
+
+	addRecords := func(db *SumDB) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		body := strings.NewReader(`{"modules": ["example.com/a@v1.0.0"]}`)
+		db.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/records", body))
+		return rec
+	}
+
+	t.Run("records entries before applying operations", func(t *testing.T) {
+		store := &auditedStore{memStore: newMemStore()}
+		db, err := New("test.example.com", skey, WithStore(store), WithUpstream(newFakeProxy(t).upstream(t)), admin)
+		require.NoError(t, err)
+
+		rec := addRecords(db)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		entries, err := VerifyAuditLog(vkey, store.entries)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "carol", entries[0].Subject)
+		require.Equal(t, "add-records", entries[0].Operation)
+		require.Equal(t, `/records modules="example.com/a@v1.0.0"`, entries[0].Detail)
+	})
+
+	t.Run("doesn't apply operations that can't be audited", func(t *testing.T) {
+		store := &auditedStore{memStore: newMemStore(), fail: errors.New("disk full")}
+		db, err := New("test.example.com", skey, WithStore(store), WithUpstream(newFakeProxy(t).upstream(t)), admin)
+		require.NoError(t, err)
+
+		rec := addRecords(db)
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+		require.Contains(t, rec.Body.String(), "wasn't applied")
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Zero(t, size)
+	})
+
+	t.Run("warns about unaudited admin APIs", func(t *testing.T) {
+		var logs bytes.Buffer
+		_, err := New("test.example.com", skey, WithStore(newMemStore()), admin,
+			WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+		require.NoError(t, err)
+		require.Contains(t, logs.String(), "admin operations won't be audited")
+	})
+}
+
+// auditedStore adds an audit log to memStore, failing to add entries with fail if it's set.
+type auditedStore struct {
+	*memStore
+
+	fail    error
+	entries [][]byte
+}
+
+func (s *auditedStore) AuditSize(context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.entries)), nil
+}
+
+func (s *auditedStore) AddAuditEntry(_ context.Context, _ int64, entry []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *auditedStore) AuditEntries(_ context.Context, id, n int64) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[id:min(id+n, int64(len(s.entries)))], nil
+}
+
+func TestWithAuditKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	_, err = New("test.example.com", skey, WithStore(NewMockAuditStore(ctrl)), WithAuditKey("invalid"))
+	require.ErrorContains(t, err, "invalid audit signer key")
+
+	// Configuring an audit key requires admin operations to be audited.
+	audit, _, err := GenerateKeys("audit.example.com")
+	require.NoError(t, err)
+
+	_, err = New("test.example.com", skey, WithStore(NewMockStore(ctrl)), WithAuditKey(audit))
+	require.ErrorIs(t, err, ErrAuditUnsupported)
+}
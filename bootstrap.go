@@ -0,0 +1,46 @@
+package sumdb
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// bootstrapInfo is the JSON representation of the settings served by BootstrapHandler.
+type bootstrapInfo struct {
+	URL         string `json:"url"`
+	VerifierKey string `json:"verifier_key"`
+	Env         *GoEnv `json:"env"`
+}
+
+// BootstrapHandler returns an HTTP handler serving the go command settings that trust the SumDB served at u (see
+// GoEnv), so that onboarding a developer to the database is a one-liner:
+//
+//	curl -fsSL https://sum.example.com/bootstrap/setup.sh | sh
+//
+//	GET /setup.sh  a script persisting the settings with go env -w
+//	GET /env       the settings as shell exports, e.g. for eval in CI
+//	GET /env.json  the settings and verifier key as JSON
+//
+// Clients trust whatever verifier key the handler serves, so it must only be served over HTTPS, from a host developers
+// already trust.
+func (s *SumDB) BootstrapHandler(u *url.URL, noSumDB ...string) http.Handler {
+	env := s.GoEnv(u, noSumDB...)
+	info := &bootstrapInfo{URL: u.String(), VerifierKey: s.vkey, Env: env}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /setup.sh", serveText(env.Script()))
+	mux.HandleFunc("GET /env", serveText(env.Exports()))
+	mux.HandleFunc("GET /env.json", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, info)
+	})
+	return mux
+}
+
+// serveText returns a handler serving text as plain text.
+func serveText(text string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, text)
+	}
+}
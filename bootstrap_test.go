@@ -0,0 +1,99 @@
+package sumdb_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootstrapHandler(t *testing.T) {
+	skey, vkey, err := GenerateKeys("sum.example.com")
+	require.NoError(t, err)
+
+	db, err := New("sum.example.com", skey, WithStore(newMemStore()))
+	require.NoError(t, err)
+
+	u, err := url.Parse("https://sum.example.com")
+	require.NoError(t, err)
+	srv := httptest.NewServer(db.BootstrapHandler(u, "github.com/acme/*"))
+	t.Cleanup(srv.Close)
+
+	get := func(t *testing.T, path string) (string, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.Header.Get("Content-Type"), string(body)
+	}
+
+	t.Run("json", func(t *testing.T) {
+		ct, body := get(t, "/env.json")
+		require.Equal(t, "application/json", ct)
+
+		var info struct {
+			URL         string `json:"url"`
+			VerifierKey string `json:"verifier_key"`
+			Env         GoEnv  `json:"env"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &info))
+		require.Equal(t, "https://sum.example.com", info.URL)
+		require.Equal(t, vkey, info.VerifierKey)
+		require.Equal(t, *db.GoEnv(u, "github.com/acme/*"), info.Env)
+	})
+
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	// goEnv runs script with sh, in an environment without any go command configuration, then returns the go
+	// command's GOSUMDB, GONOSUMDB and GOFLAGS.
+	goEnv := func(t *testing.T, script string) string {
+		t.Helper()
+		cmd := exec.Command("sh", "-c", script+"\ngo env GOSUMDB GONOSUMDB GOFLAGS")
+		unset := []string{"GOSUMDB", "GONOSUMDB", "GOPRIVATE", "GOFLAGS", "GOENV", "PATH"}
+		for _, kv := range os.Environ() {
+			if name, _, _ := strings.Cut(kv, "="); !slices.Contains(unset, name) {
+				cmd.Env = append(cmd.Env, kv)
+			}
+		}
+		cmd.Env = append(cmd.Env, "GOENV="+filepath.Join(t.TempDir(), "env"),
+			"PATH="+filepath.Dir(goBin)+string(os.PathListSeparator)+os.Getenv("PATH"))
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+
+	want := vkey + " https://sum.example.com\ngithub.com/acme/*\n-mod=readonly\n"
+
+	t.Run("exports", func(t *testing.T) {
+		ct, body := get(t, "/env")
+		require.Equal(t, "text/plain; charset=utf-8", ct)
+		require.Equal(t, want, goEnv(t, body))
+	})
+
+	t.Run("setup script", func(t *testing.T) {
+		_, body := get(t, "/setup.sh")
+		out := goEnv(t, body)
+		require.True(t, strings.HasSuffix(out, want), out)
+
+		// Developers' own GOFLAGS are kept.
+		out = goEnv(t, "go env -w GOFLAGS=-modcacherw\n"+body)
+		require.True(t, strings.HasSuffix(out, "github.com/acme/*\n-modcacherw\n"), out)
+	})
+}
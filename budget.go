@@ -0,0 +1,62 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/mod/module"
+)
+
+// errLookupPending is returned by lookupWithinBudget when a record is still being created after the lookup budget.
+var errLookupPending = errors.New("lookup pending, retry later")
+
+// lookupWithinBudget returns the formatted record for mod like lookupRecord, but gives up waiting after the budget
+// configured with WithLookupBudget and returns errLookupPending. The lookup carries on in the background, so the
+// record can be served once the client retries.
+func (s *SumDB) lookupWithinBudget(ctx context.Context, mod module.Version) (lookupEntry, error) {
+	if s.lookupBudget <= 0 {
+		return s.lookupRecord(ctx, mod)
+	}
+
+	type result struct {
+		entry lookupEntry
+		err   error
+	}
+
+	// Lookups are deduplicated, so retries join the background lookup rather than starting another one.
+	done := make(chan result, 1)
+	go func() {
+		entry, err := s.lookupRecord(context.WithoutCancel(ctx), mod)
+		done <- result{entry: entry, err: err}
+	}()
+
+	// The budget is waited for with the clock, and the wait is abandoned once the lookup is done.
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	expired := make(chan struct{})
+	go func() {
+		if sleep(waitCtx, s.clock, s.lookupBudget) {
+			close(expired)
+		}
+	}()
+
+	select {
+	case r := <-done:
+		return r.entry, r.err
+	case <-expired:
+		return lookupEntry{}, errLookupPending
+	case <-ctx.Done():
+		return lookupEntry{}, ctx.Err()
+	}
+}
+
+// reportPending tells the client to retry a pending lookup with 202 Accepted. Only clients that honor Retry-After
+// retry: the go command treats any status other than 200 OK as a failed lookup.
+func (s *SumDB) reportPending(w http.ResponseWriter) {
+	retry := max(int(math.Ceil(s.lookupBudget.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	http.Error(w, errLookupPending.Error(), http.StatusAccepted)
+}
@@ -0,0 +1,88 @@
+package sumdb_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestLookupBudget(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(upstream.upstream(t)),
+		WithLookupBudget(50*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	lookup := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/"+path, nil))
+		return rec
+	}
+
+	t.Run("fast lookups", func(t *testing.T) {
+		rec := lookup("example.com/fast@v1.0.0")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), "example.com/fast v1.0.0 h1:")
+	})
+
+	t.Run("slow lookups", func(t *testing.T) {
+		upstream.setDelay(200 * time.Millisecond)
+
+		rec := lookup("example.com/slow@v1.0.0")
+		require.Equal(t, http.StatusAccepted, rec.Code)
+		require.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+		// The record is created in the background and served on retry.
+		require.Eventually(t, func() bool {
+			return lookup("example.com/slow@v1.0.0").Code == http.StatusOK
+		}, 5*time.Second, 100*time.Millisecond)
+
+		// The upstream was only asked for the zip once.
+		zips := 0
+		for _, r := range upstream.requested() {
+			if r == "/example.com/slow/@v/v1.0.0.zip" {
+				zips++
+			}
+		}
+		require.Equal(t, 1, zips)
+	})
+
+	t.Run("waits with the clock", func(t *testing.T) {
+		upstream := newFakeProxy(t)
+		upstream.setDelay(200 * time.Millisecond)
+
+		// The budget is an hour, so the lookup is only reported pending in time if the budget is waited for with the
+		// clock.
+		clock := &sleepingClock{now: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(upstream.upstream(t)),
+			WithClock(clock),
+			WithLookupBudget(time.Hour),
+		)
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/slow@v1.0.0", nil))
+		require.Equal(t, http.StatusAccepted, rec.Code)
+		require.Equal(t, "3600", rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		upstream.setDelay(0)
+		upstream.setMissing(module.Version{Path: "example.com/missing", Version: "v1.0.0"}, true)
+
+		rec := lookup("example.com/missing@v1.0.0")
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
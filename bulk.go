@@ -0,0 +1,129 @@
+package sumdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultFetchWorkers is the number of modules fetched concurrently by AddRecords unless WithFetchWorkers is set.
+const defaultFetchWorkers = 8
+
+// AddRecords creates the records of the module versions in mods that don't exist yet, as Lookup would for each of
+// them, and returns the IDs of the records of mods, in order. It's intended for bootstrapping a server with many
+// modules: the missing records are fetched by a pool of workers (see WithFetchWorkers), then appended in the order of
+// mods in a single transaction, with the tree hashes computed once for the whole batch.
+//
+// The batch is all or nothing: if any module can't be fetched, the others are abandoned and nothing is appended. The
+// error names the module, so it can be removed from the batch and the rest retried. With WithAppendLimit, records are
+// appended in batches of at most the limit, each in its own transaction. Cold fetches made by AddRecords aren't
+// recorded for replays. AddRecords is batch work unless ctx says otherwise, so its fetches and appends give way to
+// interactive lookups (see WithPriority).
+func (s *SumDB) AddRecords(ctx context.Context, mods []module.Version) ([]int64, error) {
+	for _, mod := range mods {
+		if err := checkModule(mod); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the first occurrence of each missing module is fetched.
+	var missing []module.Version
+	seen := make(map[module.Version]bool)
+	for _, mod := range mods {
+		if seen[mod] {
+			continue
+		}
+		seen[mod] = true
+
+		_, err := s.store.RecordID(ctx, mod.Path, mod.Version)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("failed to find record id: %w", err)
+		}
+		missing = append(missing, mod)
+	}
+
+	priority := priorityFrom(ctx, PriorityBatch)
+	ctx = WithPriority(ctx, priority)
+
+	recs := make([]*Record, len(missing))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(1, s.fetchWorkers))
+	for i, mod := range missing {
+		g.Go(func() error {
+			if err := s.fetchLanes.acquire(gctx, priority); err != nil {
+				return err
+			}
+			defer s.fetchLanes.release()
+
+			route := s.routeFor(mod)
+			rec, err := s.fetchRecord(gctx, route, s.upstreamsFor(route), mod)
+			if err != nil {
+				return fmt.Errorf("failed to fetch record: %s, %w", mod, err)
+			}
+			recs[i] = rec
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.limitedImport(ctx, recs, true); err != nil {
+		return nil, err
+	}
+
+	// The IDs are read back, since records may also have been appended by concurrent lookups.
+	ids := make([]int64, len(mods))
+	for i, mod := range mods {
+		id, err := s.store.RecordID(ctx, mod.Path, mod.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find record id: %s, %w", mod, err)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// serveAddRecords serves POST /records requests, creating the records of the module versions listed in the body
+// (e.g. {"modules": ["example.com/mod@v1.0.0"]}) with AddRecords and returning their IDs, in order.
+func (s *SumDB) serveAddRecords(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Modules []string `json:"modules"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mods := make([]module.Version, len(body.Modules))
+	for i, m := range body.Modules {
+		path, version, ok := strings.Cut(m, "@")
+		if !ok || path == "" || version == "" {
+			http.Error(w, "modules must be given as path@version", http.StatusBadRequest)
+			return
+		}
+		mods[i] = module.Version{Path: path, Version: version}
+	}
+
+	if !s.auditRequest(w, r, "modules="+strconv.Quote(strings.Join(body.Modules, ","))) {
+		return
+	}
+
+	ids, err := s.AddRecords(r.Context(), mods)
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"ids": ids})
+}
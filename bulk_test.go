@@ -0,0 +1,91 @@
+package sumdb_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestAddRecords(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	newDB := func(t *testing.T, opts ...Option) *SumDB {
+		t.Helper()
+
+		opts = append([]Option{WithStore(memstore.New()), WithUpstream(upstream.upstream(t))}, opts...)
+		db, err := New("test.example.com", skey, opts...)
+		require.NoError(t, err)
+		return db
+	}
+
+	mods := make([]module.Version, 300)
+	for i := range mods {
+		mods[i] = module.Version{Path: fmt.Sprintf("example.com/m%d", i), Version: "v1.0.0"}
+	}
+
+	t.Run("appends like lookups", func(t *testing.T) {
+		// The records appended one at a time by lookups, for reference.
+		want := newDB(t)
+		for _, mod := range mods {
+			_, err := want.Lookup(t.Context(), mod)
+			require.NoError(t, err)
+		}
+
+		db := newDB(t, WithFetchWorkers(4))
+		_, err := db.Lookup(t.Context(), mods[0])
+		require.NoError(t, err)
+
+		// Records that already exist, or appear more than once, aren't appended again.
+		ids, err := db.AddRecords(t.Context(), append(mods, mods[1], mods[0]))
+		require.NoError(t, err)
+		require.Len(t, ids, len(mods)+2)
+		for i := range mods {
+			require.Equal(t, int64(i), ids[i])
+		}
+		require.Equal(t, []int64{1, 0}, ids[len(mods):])
+
+		wantSigned, err := want.Signed(t.Context())
+		require.NoError(t, err)
+		signed, err := db.Signed(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, string(wantSigned), string(signed))
+
+		ids, err = db.AddRecords(t.Context(), mods[:10])
+		require.NoError(t, err)
+		require.Len(t, ids, 10)
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		missing := module.Version{Path: "example.com/missing", Version: "v1.0.0"}
+		upstream.setMissing(missing, true)
+
+		store := memstore.New()
+		db := newDB(t, WithStore(store))
+		_, err := db.AddRecords(t.Context(), append(mods[:10:10], missing))
+		require.ErrorIs(t, err, ErrNotFound)
+		require.ErrorContains(t, err, missing.String())
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Zero(t, size)
+	})
+
+	t.Run("invalid modules", func(t *testing.T) {
+		db := newDB(t)
+		_, err := db.AddRecords(t.Context(), []module.Version{mods[0], {Path: "example.com/m", Version: "latest"}})
+		require.ErrorIs(t, err, ErrInvalidModule)
+	})
+
+	t.Run("append limits", func(t *testing.T) {
+		db := newDB(t, WithAppendLimit(100, 0))
+		ids, err := db.AddRecords(t.Context(), mods)
+		require.NoError(t, err)
+		require.Equal(t, int64(299), ids[299])
+	})
+}
@@ -0,0 +1,46 @@
+package sumdb
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/mod/module"
+)
+
+// ErrInvalidModule is returned by Lookup for module paths and versions that aren't in canonical form, e.g. escaped
+// paths ("github.com/!azure/sdk") or non-canonical versions ("v1.0", "v1.0.0+build").
+var ErrInvalidModule = errors.New("invalid module version")
+
+// checkModule checks that mod is a canonical module path and version. Every way of spelling a module version that
+// would otherwise be accepted is rejected except one, so that equivalent spellings can never create two records.
+func checkModule(mod module.Version) error {
+	if err := module.CheckPath(mod.Path); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidModule, err)
+	}
+
+	if mod.Version == "" || module.CanonicalVersion(mod.Version) != mod.Version {
+		return fmt.Errorf("%w: %s: version %q isn't canonical", ErrInvalidModule, mod.Path, mod.Version)
+	}
+	return nil
+}
+
+// EscapeModule returns the escaped forms of a canonical module path and version, as used in sumdb and proxy URLs
+// (e.g. "github.com/!azure/sdk"). Upper-case letters are escaped, so unlike the paths themselves, escaped paths are
+// unique even when compared case-insensitively.
+//
+// Stores backed by databases that compare text case-insensitively (e.g. MySQL's default collations) must key records
+// on the escaped path and version, with a unique index, rather than on Record.Path and Record.Version. Otherwise
+// github.com/Azure/sdk and github.com/azure/sdk, which are different modules, would share a record.
+func EscapeModule(path, version string) (string, string, error) {
+	escPath, err := module.EscapePath(path)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidModule, err)
+	}
+
+	escVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidModule, err)
+	}
+
+	return escPath, escVersion, nil
+}
@@ -0,0 +1,67 @@
+package sumdb_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestLookup_CanonicalModules(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	db, err := New("test.example.com", skey, WithStore(newMemStore()), WithUpstream(upstream.upstream(t)))
+	require.NoError(t, err)
+
+	t.Run("non-canonical spellings are rejected", func(t *testing.T) {
+		for _, mod := range []module.Version{
+			{Path: "github.com/!azure/sdk", Version: "v1.0.0"},
+			{Path: "github.com/Azure/sdk/", Version: "v1.0.0"},
+			{Path: "github.com/Azure/sdk", Version: "v1.0"},
+			{Path: "github.com/Azure/sdk", Version: "v1.0.0+build"},
+			{Path: "github.com/Azure/sdk", Version: ""},
+		} {
+			_, err := db.Lookup(t.Context(), mod)
+			require.ErrorIs(t, err, ErrInvalidModule, mod.String())
+		}
+		require.Empty(t, upstream.requested())
+
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/github.com/!!azure/sdk@v1.0.0", nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("escaped and unescaped paths share a record", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/github.com/!azure/sdk@v1.0.0", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		id, err := db.Lookup(t.Context(), module.Version{Path: "github.com/Azure/sdk", Version: "v1.0.0"})
+		require.NoError(t, err)
+		require.Contains(t, rec.Body.String(), "github.com/Azure/sdk v1.0.0 h1:")
+
+		// Paths differing only in case are different modules.
+		other, err := db.Lookup(t.Context(), module.Version{Path: "github.com/azure/sdk", Version: "v1.0.0"})
+		require.NoError(t, err)
+		require.NotEqual(t, id, other)
+
+		again, err := db.Lookup(t.Context(), module.Version{Path: "github.com/Azure/sdk", Version: "v1.0.0"})
+		require.NoError(t, err)
+		require.Equal(t, id, again)
+	})
+}
+
+func TestEscapeModule(t *testing.T) {
+	path, version, err := EscapeModule("github.com/Azure/sdk", "v1.0.0-RC1")
+	require.NoError(t, err)
+	require.Equal(t, "github.com/!azure/sdk", path)
+	require.Equal(t, "v1.0.0-!r!c1", version)
+
+	_, _, err = EscapeModule("github.com/!azure/sdk", "v1.0.0")
+	require.ErrorIs(t, err, ErrInvalidModule)
+}
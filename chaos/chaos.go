@@ -0,0 +1,136 @@
+// Package chaos provides fault-injecting wrappers for sumdb stores and upstream proxy connections.
+//
+// The wrappers inject configurable latency, transient errors and partial failures so that deployments can be
+// exercised under storage and network failure before reaching production. They are not intended for production use.
+// The store wrapper only keeps the TxStore extension of the store it wraps; see NewStore.
+//
+//	store := chaos.NewStore(realStore,
+//		chaos.WithFault("WriteHashes", chaos.Fault{ErrorRate: 0.1, PartialRate: 0.5}),
+//	)
+//
+//	client := &http.Client{
+//		Transport: chaos.NewTransport(http.DefaultTransport,
+//			chaos.WithFault("zip", chaos.Fault{Latency: 2 * time.Second, Status: http.StatusBadGateway, ErrorRate: 0.2}),
+//		),
+//	}
+//
+//	db, err := sumdb.New(name, skey, sumdb.WithStore(store), sumdb.WithHTTPClient(client))
+package chaos
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ErrInjected is the default error returned by injected failures.
+var ErrInjected = errors.New("chaos: injected failure")
+
+type (
+	// Fault describes the failures injected into a single operation.
+	//
+	// Latency (plus up to Jitter) is added before every call. ErrorRate is the probability that a call fails with
+	// Err. PartialRate is the probability that a failing call is partially applied first (e.g. some hashes are written
+	// or part of a response body is returned before the failure).
+	Fault struct {
+		Latency     time.Duration
+		Jitter      time.Duration
+		ErrorRate   float64
+		PartialRate float64
+
+		// Err is returned by injected failures. Defaults to ErrInjected.
+		Err error
+
+		// Status, when non-zero, makes failed transport calls return a response with this status code rather than
+		// an error. It is ignored by stores.
+		Status int
+	}
+
+	// Option configures the faults injected by a wrapper.
+	Option func(*injector)
+
+	// injector decides which faults to inject for each call.
+	injector struct {
+		mu       sync.Mutex
+		rng      *rand.Rand
+		fallback Fault
+		faults   map[string]Fault
+	}
+)
+
+// WithFault sets the fault for a single operation.
+//
+// For stores, op is the Store method name (e.g. "WriteHashes"). For transports, op is the extension of the requested
+// proxy file ("info", "mod" or "zip").
+func WithFault(op string, f Fault) Option {
+	return func(in *injector) { in.faults[op] = f }
+}
+
+// WithDefaultFault sets the fault for all operations without a specific fault configured via WithFault.
+func WithDefaultFault(f Fault) Option {
+	return func(in *injector) { in.fallback = f }
+}
+
+// WithSeed seeds the random source used to decide which calls fail, making a run reproducible.
+func WithSeed(seed uint64) Option {
+	return func(in *injector) { in.rng = rand.New(rand.NewPCG(seed, seed)) } // #nosec G404 -- not security sensitive
+}
+
+func newInjector(opts ...Option) *injector {
+	in := &injector{
+		rng:    rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), // #nosec G404 -- not security sensitive
+		faults: make(map[string]Fault),
+	}
+	for _, opt := range opts {
+		opt(in)
+	}
+	return in
+}
+
+// outcome is the decision made for a single call.
+type outcome struct {
+	fault   Fault
+	fail    bool
+	partial bool
+}
+
+// err returns the error to surface for a failed call.
+func (o outcome) err() error {
+	if o.fault.Err != nil {
+		return o.fault.Err
+	}
+	return ErrInjected
+}
+
+// inject applies latency for op and decides whether the call should fail.
+// It returns ctx.Err() if the context is canceled while waiting.
+func (in *injector) inject(ctx context.Context, op string) (outcome, error) {
+	f, ok := in.faults[op]
+	if !ok {
+		f = in.fallback
+	}
+
+	in.mu.Lock()
+	delay := f.Latency
+	if f.Jitter > 0 {
+		delay += time.Duration(in.rng.Int64N(int64(f.Jitter)))
+	}
+	fail := f.ErrorRate > 0 && in.rng.Float64() < f.ErrorRate
+	partial := fail && f.PartialRate > 0 && in.rng.Float64() < f.PartialRate
+	in.mu.Unlock()
+
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+
+		select {
+		case <-ctx.Done():
+			return outcome{}, ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	return outcome{fault: f, fail: fail, partial: partial}, nil
+}
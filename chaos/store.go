@@ -0,0 +1,128 @@
+package chaos
+
+import (
+	"context"
+
+	"github.com/pseudomuto/sumdb"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+type (
+	// store wraps a sumdb.Store, injecting faults into every method.
+	store struct {
+		next sumdb.Store
+		in   *injector
+	}
+
+	// txStore is a store whose underlying Store supports transactions.
+	txStore struct {
+		*store
+		tx sumdb.TxStore
+	}
+)
+
+// NewStore wraps s with a Store that injects the configured faults.
+//
+// Partial failures apply to WriteHashes, where the first half of the hashes are written before the error is returned.
+// If s implements sumdb.TxStore, so does the returned Store, and the transactional view passed to WithTx callbacks
+// is wrapped with the same faults.
+//
+// Every other optional extension of s is hidden: sumdb.AuditStore, sumdb.AnnotationStore, sumdb.AppendHookStore,
+// sumdb.CheckpointStore, sumdb.FormatStore, sumdb.MaintenanceStore, sumdb.OutboxStore, sumdb.PathStore,
+// sumdb.PublishedStore and sumdb.TileStore. A SumDB using the returned Store behaves as it does with a store that
+// doesn't implement them, so chaos runs exercise the core append and read paths only. Options that require one of them
+// are rejected by sumdb.New (e.g. sumdb.WithPublisher with sumdb.ErrOutboxUnsupported, and sumdb.WithAuditKey with
+// sumdb.ErrAuditUnsupported), and the features depending on the others (e.g. checkpoints, saved tiles, annotations and
+// the store's own OnAppend hook and format version) are off.
+func NewStore(s sumdb.Store, opts ...Option) sumdb.Store {
+	return wrapStore(s, newInjector(opts...))
+}
+
+func wrapStore(s sumdb.Store, in *injector) sumdb.Store {
+	base := &store{next: s, in: in}
+	if tx, ok := s.(sumdb.TxStore); ok {
+		return &txStore{store: base, tx: tx}
+	}
+	return base
+}
+
+func (s *store) RecordID(ctx context.Context, path, version string) (int64, error) {
+	if o, err := s.in.inject(ctx, "RecordID"); err != nil || o.fail {
+		return 0, failure(o, err)
+	}
+	return s.next.RecordID(ctx, path, version)
+}
+
+func (s *store) Records(ctx context.Context, id, n int64) ([]*sumdb.Record, error) {
+	if o, err := s.in.inject(ctx, "Records"); err != nil || o.fail {
+		return nil, failure(o, err)
+	}
+	return s.next.Records(ctx, id, n)
+}
+
+func (s *store) AddRecord(ctx context.Context, r *sumdb.Record) (int64, error) {
+	if o, err := s.in.inject(ctx, "AddRecord"); err != nil || o.fail {
+		return 0, failure(o, err)
+	}
+	return s.next.AddRecord(ctx, r)
+}
+
+func (s *store) ReadHashes(ctx context.Context, indexes []int64) ([]tlog.Hash, error) {
+	if o, err := s.in.inject(ctx, "ReadHashes"); err != nil || o.fail {
+		return nil, failure(o, err)
+	}
+	return s.next.ReadHashes(ctx, indexes)
+}
+
+func (s *store) WriteHashes(ctx context.Context, indexes []int64, hashes []tlog.Hash) error {
+	o, err := s.in.inject(ctx, "WriteHashes")
+	if err != nil {
+		return err
+	}
+
+	if !o.fail {
+		return s.next.WriteHashes(ctx, indexes, hashes)
+	}
+
+	if o.partial && len(indexes) > 1 {
+		half := len(indexes) / 2
+		if err := s.next.WriteHashes(ctx, indexes[:half], hashes[:half]); err != nil {
+			return err
+		}
+	}
+
+	return o.err()
+}
+
+func (s *store) TreeSize(ctx context.Context) (int64, error) {
+	if o, err := s.in.inject(ctx, "TreeSize"); err != nil || o.fail {
+		return 0, failure(o, err)
+	}
+	return s.next.TreeSize(ctx)
+}
+
+func (s *store) SetTreeSize(ctx context.Context, size int64) error {
+	if o, err := s.in.inject(ctx, "SetTreeSize"); err != nil || o.fail {
+		return failure(o, err)
+	}
+	return s.next.SetTreeSize(ctx, size)
+}
+
+// WithTx implements sumdb.TxStore.
+func (s *txStore) WithTx(ctx context.Context, fn func(sumdb.Store) error) error {
+	if o, err := s.in.inject(ctx, "WithTx"); err != nil || o.fail {
+		return failure(o, err)
+	}
+
+	return s.tx.WithTx(ctx, func(tx sumdb.Store) error {
+		return fn(&store{next: tx, in: s.in})
+	})
+}
+
+// failure returns err if set, otherwise the injected error for o.
+func failure(o outcome, err error) error {
+	if err != nil {
+		return err
+	}
+	return o.err()
+}
@@ -0,0 +1,167 @@
+package chaos_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+	. "github.com/pseudomuto/sumdb/chaos"
+	"github.com/pseudomuto/sumdb/store/sqlite"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// fakeStore is a minimal in-memory sumdb.Store for testing.
+type fakeStore struct {
+	hashes map[int64]tlog.Hash
+	size   int64
+}
+
+// fakeTxStore adds transaction support to fakeStore.
+type fakeTxStore struct {
+	*fakeStore
+	txs int
+}
+
+func TestNewStore(t *testing.T) {
+	t.Run("passes through without faults", func(t *testing.T) {
+		store := NewStore(newFakeStore())
+
+		require.NoError(t, store.SetTreeSize(t.Context(), 3))
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(3), size)
+	})
+
+	t.Run("injects errors per method", func(t *testing.T) {
+		custom := errors.New("boom")
+		store := NewStore(newFakeStore(), WithFault("TreeSize", Fault{ErrorRate: 1, Err: custom}))
+
+		_, err := store.TreeSize(t.Context())
+		require.ErrorIs(t, err, custom)
+
+		require.NoError(t, store.SetTreeSize(t.Context(), 1))
+	})
+
+	t.Run("default fault", func(t *testing.T) {
+		store := NewStore(newFakeStore(), WithDefaultFault(Fault{ErrorRate: 1}))
+
+		_, err := store.RecordID(t.Context(), "example.com/foo", "v1.0.0")
+		require.ErrorIs(t, err, ErrInjected)
+	})
+
+	t.Run("partial writes", func(t *testing.T) {
+		fake := newFakeStore()
+		store := NewStore(fake, WithFault("WriteHashes", Fault{ErrorRate: 1, PartialRate: 1}))
+
+		err := store.WriteHashes(t.Context(), []int64{0, 1, 2, 3}, []tlog.Hash{{1}, {2}, {3}, {4}})
+		require.ErrorIs(t, err, ErrInjected)
+		require.Len(t, fake.hashes, 2)
+	})
+
+	t.Run("latency respects context", func(t *testing.T) {
+		store := NewStore(newFakeStore(), WithDefaultFault(Fault{Latency: time.Hour}))
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		_, err := store.TreeSize(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("seeded runs are reproducible", func(t *testing.T) {
+		outcomes := func() []bool {
+			store := NewStore(newFakeStore(), WithSeed(42), WithDefaultFault(Fault{ErrorRate: 0.5}))
+			res := make([]bool, 20)
+			for i := range res {
+				_, err := store.TreeSize(t.Context())
+				res[i] = err != nil
+			}
+			return res
+		}
+
+		require.Equal(t, outcomes(), outcomes())
+	})
+
+	t.Run("preserves transactions", func(t *testing.T) {
+		fake := &fakeTxStore{fakeStore: newFakeStore()}
+		store := NewStore(fake, WithFault("SetTreeSize", Fault{ErrorRate: 1}))
+
+		txs, ok := store.(sumdb.TxStore)
+		require.True(t, ok)
+
+		err := txs.WithTx(t.Context(), func(s sumdb.Store) error {
+			return s.SetTreeSize(t.Context(), 1)
+		})
+		require.ErrorIs(t, err, ErrInjected)
+		require.Equal(t, 1, fake.txs)
+	})
+
+	t.Run("hides other extensions", func(t *testing.T) {
+		inner, err := sqlite.Open(t.Context(), filepath.Join(t.TempDir(), "sumdb.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, inner.Close()) })
+
+		store := NewStore(inner)
+		_, ok := store.(sumdb.CheckpointStore)
+		require.False(t, ok)
+
+		// Options requiring a hidden extension are rejected rather than quietly disabled.
+		skey, _, err := sumdb.GenerateKeys("test.example.com")
+		require.NoError(t, err)
+		publisher := sumdb.PublisherFunc(func(context.Context, []*sumdb.AppendEvent) error { return nil })
+		_, err = sumdb.New("test.example.com", skey, sumdb.WithStore(store), sumdb.WithPublisher(publisher))
+		require.ErrorIs(t, err, sumdb.ErrOutboxUnsupported)
+
+		_, err = sumdb.New("test.example.com", skey, sumdb.WithStore(store), sumdb.WithAuditKey(skey))
+		require.ErrorIs(t, err, sumdb.ErrAuditUnsupported)
+	})
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{hashes: make(map[int64]tlog.Hash)}
+}
+
+func (s *fakeStore) RecordID(context.Context, string, string) (int64, error) {
+	return 0, sumdb.ErrNotFound
+}
+
+func (s *fakeStore) Records(context.Context, int64, int64) ([]*sumdb.Record, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) AddRecord(context.Context, *sumdb.Record) (int64, error) {
+	return s.size, nil
+}
+
+func (s *fakeStore) ReadHashes(_ context.Context, indexes []int64) ([]tlog.Hash, error) {
+	res := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		res[i] = s.hashes[idx]
+	}
+	return res, nil
+}
+
+func (s *fakeStore) WriteHashes(_ context.Context, indexes []int64, hashes []tlog.Hash) error {
+	for i, idx := range indexes {
+		s.hashes[idx] = hashes[i]
+	}
+	return nil
+}
+
+func (s *fakeStore) TreeSize(context.Context) (int64, error) {
+	return s.size, nil
+}
+
+func (s *fakeStore) SetTreeSize(_ context.Context, size int64) error {
+	s.size = size
+	return nil
+}
+
+func (s *fakeTxStore) WithTx(_ context.Context, fn func(sumdb.Store) error) error {
+	s.txs++
+	return fn(s.fakeStore)
+}
@@ -0,0 +1,71 @@
+package chaos
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// transport wraps an http.RoundTripper, injecting faults into proxy requests.
+type transport struct {
+	next http.RoundTripper
+	in   *injector
+}
+
+// NewTransport wraps rt with an http.RoundTripper that injects the configured faults into upstream proxy requests.
+// If rt is nil, http.DefaultTransport is used.
+//
+// Faults are selected by the extension of the requested file ("info", "mod" or "zip"). Failed requests return Err,
+// or a response with the configured Status. Partial failures return a successful response whose body fails with Err
+// after half of it has been read.
+func NewTransport(rt http.RoundTripper, opts ...Option) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &transport{next: rt, in: newInjector(opts...)}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op := strings.TrimPrefix(path.Ext(req.URL.Path), ".")
+	o, err := t.in.inject(req.Context(), op)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.fail && !o.partial {
+		if o.fault.Status == 0 {
+			return nil, o.err()
+		}
+
+		return &http.Response{
+			StatusCode: o.fault.Status,
+			Status:     http.StatusText(o.fault.Status),
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || !o.fail {
+		return resp, err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body[:len(body)/2]), errReader{o.err()}))
+	resp.ContentLength = -1
+	return resp, nil
+}
+
+// errReader is an io.Reader that always fails with err.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
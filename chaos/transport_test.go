@@ -0,0 +1,69 @@
+package chaos_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb/chaos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("module example.com/foo\n"))
+	}))
+	defer srv.Close()
+
+	get := func(t *testing.T, rt http.RoundTripper, path string) (*http.Response, error) {
+		t.Helper()
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+		return (&http.Client{Transport: rt}).Do(req)
+	}
+
+	t.Run("passes through without faults", func(t *testing.T) {
+		resp, err := get(t, NewTransport(nil), "/example.com/foo/@v/v1.0.0.mod")
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "module example.com/foo\n", string(body))
+	})
+
+	t.Run("injects errors by extension", func(t *testing.T) {
+		rt := NewTransport(nil, WithFault("zip", Fault{ErrorRate: 1}))
+
+		_, err := get(t, rt, "/example.com/foo/@v/v1.0.0.zip") //nolint:bodyclose
+		require.ErrorIs(t, err, ErrInjected)
+
+		resp, err := get(t, rt, "/example.com/foo/@v/v1.0.0.mod")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("injects status codes", func(t *testing.T) {
+		rt := NewTransport(nil, WithDefaultFault(Fault{ErrorRate: 1, Status: http.StatusBadGateway}))
+
+		resp, err := get(t, rt, "/example.com/foo/@v/v1.0.0.mod")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	})
+
+	t.Run("truncates bodies on partial failure", func(t *testing.T) {
+		rt := NewTransport(nil, WithDefaultFault(Fault{ErrorRate: 1, PartialRate: 1}))
+
+		resp, err := get(t, rt, "/example.com/foo/@v/v1.0.0.mod")
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		body, err := io.ReadAll(resp.Body)
+		require.ErrorIs(t, err, ErrInjected)
+		require.True(t, strings.HasPrefix("module example.com/foo\n", string(body)))
+		require.Less(t, len(body), len("module example.com/foo\n"))
+	})
+}
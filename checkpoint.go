@@ -0,0 +1,103 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/tree"
+)
+
+// ErrCheckpointsUnsupported is returned by TreeAt when the Store doesn't implement CheckpointStore.
+var ErrCheckpointsUnsupported = errors.New("store does not support checkpoints")
+
+// apiTree is the JSON representation of a checkpoint, along with a signed tree head for it.
+type apiTree struct {
+	TreeSize   int64     `json:"tree_size"`
+	RootHash   string    `json:"root_hash"`
+	Time       time.Time `json:"time"`
+	SignedHead string    `json:"signed_head"`
+}
+
+// TreeAt returns the checkpoint of the tree as it was at time t: the last one recorded at or before t. Proofs against
+// it can be requested for its size, e.g. with GET /records/{id}/path?size={size} (see APIHandler), to show what the log
+// contained at the time of an incident.
+//
+// Checkpoints are recorded by every append when the Store implements CheckpointStore, so trees from before the store
+// supported them aren't known. It returns ErrNotFound if no checkpoint was recorded at or before t, and
+// ErrCheckpointsUnsupported if the Store doesn't implement CheckpointStore.
+func (s *SumDB) TreeAt(ctx context.Context, t time.Time) (*Checkpoint, error) {
+	cs, ok := s.store.(CheckpointStore)
+	if !ok {
+		return nil, ErrCheckpointsUnsupported
+	}
+
+	c, err := cs.CheckpointAt(ctx, t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find checkpoint: %s, %w", t.Format(time.RFC3339), err)
+	}
+	return c, nil
+}
+
+// addCheckpoint records the tree of the given size, just appended to tx at the given time, if tx implements
+// CheckpointStore.
+func addCheckpoint(ctx context.Context, tx Store, size int64, at time.Time) error {
+	cs, ok := tx.(CheckpointStore)
+	if !ok {
+		return nil
+	}
+
+	root, err := tree.TreeHashAt(ctx, tx, size)
+	if err != nil {
+		return fmt.Errorf("failed to compute tree hash: %w", err)
+	}
+
+	if err := cs.AddCheckpoint(ctx, &Checkpoint{Size: size, Root: root, Time: at.UTC()}); err != nil {
+		return fmt.Errorf("failed to add checkpoint: %d, %w", size, err)
+	}
+	return nil
+}
+
+// serveTreeAt serves GET /tree?at={time} requests, returning the checkpoint of the tree at the given RFC 3339 time (now
+// by default) along with a signed tree head for it.
+func (s *SumDB) serveTreeAt(w http.ResponseWriter, r *http.Request) {
+	at, err := queryTime(r, "at", s.clock.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	c, err := s.TreeAt(r.Context(), at)
+	switch {
+	case errors.Is(err, ErrCheckpointsUnsupported):
+		writeAPIError(w, http.StatusNotImplemented, err)
+		return
+	case errors.Is(err, ErrNotFound):
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Signing the tree head recomputes the root hash, which must still be the one recorded: hashes are never changed.
+	root, signed, err := s.signedAt(r.Context(), c.Size)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if root != c.Root {
+		writeAPIError(w, http.StatusInternalServerError,
+			fmt.Errorf("tree of size %d has root %s, but %s was recorded", c.Size, root, c.Root))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiTree{
+		TreeSize:   c.Size,
+		RootHash:   c.Root.String(),
+		Time:       c.Time,
+		SignedHead: string(signed),
+	})
+}
@@ -0,0 +1,131 @@
+package sumdb_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestTreeAt(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	now := start
+	db, err := New("test.example.com", skey,
+		WithStore(memstore.New()),
+		WithUpstream(newFakeProxy(t).upstream(t)),
+		WithClock(ClockFunc(func() time.Time { return now })),
+	)
+	require.NoError(t, err)
+
+	// A record is looked up every hour, and the last two are added in bulk.
+	for i := range 3 {
+		_, err := db.Lookup(t.Context(), module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"})
+		require.NoError(t, err)
+		now = now.Add(time.Hour)
+	}
+	_, err = db.AddRecords(t.Context(), []module.Version{
+		{Path: "example.com/mod3", Version: "v1.0.0"},
+		{Path: "example.com/mod4", Version: "v1.0.0"},
+	})
+	require.NoError(t, err)
+
+	// get serves a JSON API request, decoding the response into v.
+	get := func(t *testing.T, path string, v any) int {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		db.APIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if v != nil && rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+		}
+		return rec.Code
+	}
+
+	t.Run("checkpoints", func(t *testing.T) {
+		for _, tt := range []struct {
+			at   time.Time
+			size int64
+		}{
+			{start, 1},
+			{start.Add(90 * time.Minute), 2},
+			{start.Add(2 * time.Hour), 3},
+			{start.Add(3 * time.Hour), 5},
+			{start.Add(24 * time.Hour), 5},
+		} {
+			c, err := db.TreeAt(t.Context(), tt.at)
+			require.NoError(t, err)
+			require.Equal(t, tt.size, c.Size)
+			require.False(t, c.Time.After(tt.at))
+		}
+
+		_, err := db.TreeAt(t.Context(), start.Add(-time.Second))
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("api", func(t *testing.T) {
+		var tree struct {
+			TreeSize   int64     `json:"tree_size"`
+			RootHash   string    `json:"root_hash"`
+			Time       time.Time `json:"time"`
+			SignedHead string    `json:"signed_head"`
+		}
+		at := start.Add(90 * time.Minute).Format(time.RFC3339)
+		require.Equal(t, http.StatusOK, get(t, "/tree?at="+at, &tree))
+		require.Equal(t, int64(2), tree.TreeSize)
+		require.Equal(t, start.Add(time.Hour), tree.Time)
+
+		verifier, err := note.NewVerifier(vkey)
+		require.NoError(t, err)
+		n, err := note.Open([]byte(tree.SignedHead), note.VerifierList(verifier))
+		require.NoError(t, err)
+		signed, err := tlog.ParseTree([]byte(n.Text))
+		require.NoError(t, err)
+		require.Equal(t, tlog.Tree{N: 2, Hash: mustParseHash(t, tree.RootHash)}, signed)
+
+		// Records in the old tree are proven against its root.
+		var path struct {
+			TreeSize int64  `json:"tree_size"`
+			RootHash string `json:"root_hash"`
+		}
+		require.Equal(t, http.StatusOK, get(t, "/records/1/path?size=2", &path))
+		require.Equal(t, int64(2), path.TreeSize)
+		require.Equal(t, tree.RootHash, path.RootHash)
+
+		require.Equal(t, http.StatusNotFound, get(t, "/records/2/path?size=2", nil))
+		require.Equal(t, http.StatusBadRequest, get(t, "/records/1/path?size=6", nil))
+		require.Equal(t, http.StatusNotFound, get(t, "/tree?at=2026-03-10T11:00:00Z", nil))
+		require.Equal(t, http.StatusBadRequest, get(t, "/tree?at=yesterday", nil))
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		db, err := New("test.example.com", skey, WithStore(newMemStore()))
+		require.NoError(t, err)
+
+		_, err = db.TreeAt(t.Context(), start)
+		require.ErrorIs(t, err, ErrCheckpointsUnsupported)
+
+		rec := httptest.NewRecorder()
+		db.APIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tree", nil))
+		require.Equal(t, http.StatusNotImplemented, rec.Code)
+	})
+}
+
+func mustParseHash(t *testing.T, s string) tlog.Hash {
+	t.Helper()
+
+	h, err := tlog.ParseHash(s)
+	require.NoError(t, err)
+	return h
+}
@@ -0,0 +1,55 @@
+package sumdb
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	// Clock provides the current time to a SumDB.
+	//
+	// Everything time-dependent in the SumDB (timestamps, intervals, expirations) reads the time from its Clock. This
+	// allows tests to be deterministic and deployments with unreliable system clocks to supply an alternative time
+	// source (e.g. an NTP-checked clock).
+	Clock interface {
+		Now() time.Time
+	}
+
+	// Sleeper is implemented by Clocks that also control how long waits take (e.g. fake clocks in tests, which can
+	// advance instantly). Retry backoffs, rate limits and sync intervals wait with Sleep when the Clock implements it,
+	// and with a system timer otherwise.
+	Sleeper interface {
+		// Sleep waits for d, returning false if ctx is done first.
+		Sleep(ctx context.Context, d time.Duration) bool
+	}
+
+	// ClockFunc is an adapter to allow the use of ordinary functions as a Clock.
+	ClockFunc func() time.Time
+
+	// systemClock is the default Clock, backed by time.Now.
+	systemClock struct{}
+)
+
+// Now returns f().
+func (f ClockFunc) Now() time.Time { return f() }
+
+// Now returns the current system time.
+func (systemClock) Now() time.Time { return time.Now() }
+
+// sleep waits for d with clock, returning false if ctx is done first. Clocks that don't implement Sleeper (including
+// a nil clock) wait with a system timer.
+func sleep(ctx context.Context, clock Clock, d time.Duration) bool {
+	if s, ok := clock.(Sleeper); ok {
+		return s.Sleep(ctx, d)
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,66 @@
+package sumdb_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+// sleepingClock is a Clock whose waits return immediately, advancing it, and are recorded. onSleep, if set, is called
+// with the number of waits so far after each one.
+type sleepingClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	slept   []time.Duration
+	onSleep func(n int)
+}
+
+func (c *sleepingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *sleepingClock) Sleep(ctx context.Context, d time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.slept = append(c.slept, d)
+	if c.onSleep != nil {
+		c.onSleep(len(c.slept))
+	}
+	return ctx.Err() == nil
+}
+
+func TestClockFunc(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var clock Clock = ClockFunc(func() time.Time { return now })
+	require.Equal(t, now, clock.Now())
+}
+
+func TestSleeper(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	// Retries wait for an hour, so the lookup only completes in time if they wait with the clock.
+	clock := &sleepingClock{now: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+	upstream := newFakeProxy(t)
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(upstream.upstream(t)),
+		WithClock(clock),
+		WithProxyRetry(3, time.Hour, time.Hour),
+	)
+	require.NoError(t, err)
+
+	upstream.setFailures(2)
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+	require.NoError(t, err)
+	require.Len(t, clock.slept, 2)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pseudomuto/sumdb/store/storetest"
+)
+
+func benchStoreCommand() *command {
+	cmd := &command{
+		name:  "bench-store",
+		short: "Run the standardized store benchmarks against a store backend",
+		usage: "bench-store -dsn <scheme>:<location> [-sizes 1000,10000,100000] [-read-only] [-output table|json]",
+	}
+
+	cmd.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		dsn := fs.String("dsn", "", "store to benchmark (e.g. sqlite:/var/lib/sumdb.db or snapshot:/var/lib/sumdb.snap)")
+		sizesFlag := fs.String("sizes", "1000,10000,100000", "comma-separated tree sizes to grow the store to")
+		readOnly := fs.Bool("read-only", false, "only measure reads, at the store's current size")
+		output := outputFlag(fs)
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if *dsn == "" || fs.NArg() != 0 {
+			fs.Usage()
+			return errUsage
+		}
+
+		sizes, err := parseSizes(*sizesFlag)
+		if err != nil {
+			return err
+		}
+
+		store, err := openStore(ctx, *dsn)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = store.Close() }()
+
+		opts := storetest.BenchOptions{Sizes: sizes, ReadOnly: *readOnly || store.readOnly}
+		progress := stdout
+		if *output == outputJSON {
+			progress = io.Discard
+		}
+
+		if opts.ReadOnly {
+			fmt.Fprintf(progress, "Benchmarking reads from %s\n\n", *dsn)
+		} else {
+			// Appends continue from the tree size read before them, so other writers must wait until we're done.
+			release, err := store.lease(ctx)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = release() }()
+
+			fmt.Fprintf(progress, "Benchmarking %s (generated records will be appended to it)\n\n", *dsn)
+		}
+
+		results, err := storetest.RunBenchmarks(ctx, store, opts)
+		if *output == outputJSON {
+			return errors.Join(err, writeJSON(stdout, benchReports(results)))
+		}
+
+		printBenchResults(stdout, results)
+		return err
+	}
+
+	return cmd
+}
+
+func parseSizes(s string) ([]int64, error) {
+	var sizes []int64
+	for f := range strings.SplitSeq(s, ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(f), 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid tree size: %q", f)
+		}
+		if len(sizes) > 0 && n <= sizes[len(sizes)-1] {
+			return nil, fmt.Errorf("tree sizes must be increasing: %s", s)
+		}
+		sizes = append(sizes, n)
+	}
+	return sizes, nil
+}
+
+// benchReport is the JSON output of bench-store for a benchmark.
+type benchReport struct {
+	Name          string   `json:"name"`
+	N             int      `json:"n"`
+	NsPerOp       int64    `json:"ns_per_op"`
+	RecordsPerSec *float64 `json:"records_per_sec,omitempty"`
+}
+
+func benchReports(results []storetest.Result) []benchReport {
+	reports := make([]benchReport, 0, len(results))
+	for _, r := range results {
+		report := benchReport{Name: r.Name, N: r.N, NsPerOp: r.NsPerOp()}
+		if rate, ok := r.Extra["records/s"]; ok {
+			report.RecordsPerSec = &rate
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+func printBenchResults(w io.Writer, results []storetest.Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%s/op", r.Name, r.N, time.Duration(r.NsPerOp()))
+		if rate, ok := r.Extra["records/s"]; ok {
+			fmt.Fprintf(tw, "\t%.0f records/s", rate)
+		}
+		fmt.Fprintln(tw)
+	}
+	_ = tw.Flush()
+}
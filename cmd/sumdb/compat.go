@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// compatMaxResponseSize bounds the size of the responses read by compat-check.
+const compatMaxResponseSize = 1 << 20
+
+// compatSample is the sample of modules looked up by compat-check without -modules: public modules that servers
+// hashing modules from a public proxy can create records for.
+var compatSample = []module.Version{
+	{Path: "rsc.io/quote", Version: "v1.5.2"},
+	{Path: "golang.org/x/text", Version: "v0.3.0"},
+	{Path: "github.com/google/uuid", Version: "v1.6.0"},
+}
+
+type (
+	// compatRequest is a request compat-check makes to both servers. normalize replaces the parts of successful
+	// responses that legitimately differ between servers (keys, tree sizes and hashes, record IDs) with placeholders,
+	// checking that they're well formed. The bodies of unsuccessful responses aren't compared.
+	compatRequest struct {
+		path      string
+		normalize func([]byte) ([]byte, error)
+	}
+
+	// compatReport is the outcome of compat-check, and its JSON output.
+	compatReport struct {
+		Reference  string        `json:"reference"`
+		Target     string        `json:"target"`
+		Checks     []compatCheck `json:"checks"`
+		Deviations int           `json:"deviations"`
+	}
+
+	// compatCheck is the outcome of comparing the responses to a compatRequest (or of checking the target's tile
+	// hashes). Diffs describes how the target's response deviates, and is empty if it's compatible.
+	compatCheck struct {
+		Name  string   `json:"name"`
+		OK    bool     `json:"ok"`
+		Diffs []string `json:"diffs,omitempty"`
+	}
+
+	// compatResponse is a server's response to a compatRequest. err is the error normalizing its body.
+	compatResponse struct {
+		status      int
+		contentType string
+		body        []byte
+		err         error
+	}
+)
+
+func compatCheckCommand() *command {
+	cmd := &command{
+		name:  "compat-check",
+		short: "Compare a server's lookup and tile responses with those of sum.golang.org",
+		usage: "compat-check [-key <vkey>] [-reference <url>] [-reference-key <vkey>] [-modules <file>] " +
+			"[-output table|json] <url>",
+	}
+
+	cmd.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		key := fs.String("key", "", "verifier key of the server, to verify its signed tree heads")
+		reference := fs.String("reference", "https://sum.golang.org", "checksum database to compare responses with")
+		referenceKey := fs.String("reference-key", "",
+			"verifier key of the reference (defaults to sum.golang.org's key for that host)")
+		modules := fs.String("modules", "",
+			"file containing the module versions to look up, one module@version per line (defaults to a public sample)")
+		output := outputFlag(fs)
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return errUsage
+		}
+
+		target, ref := strings.TrimSuffix(fs.Arg(0), "/"), strings.TrimSuffix(*reference, "/")
+		refKey := *referenceKey
+		if u, err := url.Parse(ref); refKey == "" && err == nil && u.Host == "sum.golang.org" {
+			refKey = goSumDBKey
+		}
+
+		mods := compatSample
+		if *modules != "" {
+			var err error
+			if mods, err = readModules(*modules); err != nil {
+				return err
+			}
+		}
+
+		client := &http.Client{Timeout: 30 * time.Second}
+		refSize, err := compatTreeSize(ctx, client, ref, refKey)
+		if err != nil {
+			return err
+		}
+		targetSize, err := compatTreeSize(ctx, client, target, *key)
+		if err != nil {
+			return err
+		}
+
+		requests, err := compatRequests(mods, int(min(refSize, targetSize, 1<<diffTileHeight)))
+		if err != nil {
+			return err
+		}
+
+		report := compatReport{Reference: ref, Target: target}
+		for _, req := range requests {
+			want, err := compatFetch(ctx, client, ref+req.path, req.normalize)
+			if err != nil {
+				return err
+			}
+
+			got, err := compatFetch(ctx, client, target+req.path, req.normalize)
+			if err != nil {
+				return err
+			}
+
+			report.add(req.path, compareCompatResponses(want, got))
+		}
+
+		if targetSize > 0 {
+			width := int(min(targetSize, 1<<diffTileHeight))
+			var diffs []string
+			if err := checkTileHashes(ctx, client, target, width); err != nil {
+				diffs = append(diffs, err.Error())
+			}
+			report.add("tile hashes", diffs)
+		}
+
+		if *output == outputJSON {
+			if err := writeJSON(stdout, report); err != nil {
+				return err
+			}
+		} else {
+			printCompatReport(stdout, report)
+		}
+
+		if report.Deviations > 0 {
+			return fmt.Errorf("%d responses deviate from %s", report.Deviations, ref)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+// add records the outcome of the named check, which deviates if diffs isn't empty.
+func (r *compatReport) add(name string, diffs []string) {
+	r.Checks = append(r.Checks, compatCheck{Name: name, OK: len(diffs) == 0, Diffs: diffs})
+	if len(diffs) > 0 {
+		r.Deviations++
+	}
+}
+
+func printCompatReport(w io.Writer, r compatReport) {
+	for _, c := range r.Checks {
+		if c.OK {
+			fmt.Fprintf(w, "ok    %s\n", c.Name)
+			continue
+		}
+
+		fmt.Fprintf(w, "FAIL  %s\n", c.Name)
+		for _, d := range c.Diffs {
+			fmt.Fprintf(w, "      %s\n", d)
+		}
+	}
+
+	if r.Deviations == 0 {
+		fmt.Fprintf(w, "Responses are compatible with %s\n", r.Reference)
+	}
+}
+
+// compatRequests returns the requests made to both servers: the signed tree head, lookups for mods, the first tiles
+// of width w (if w isn't 0), and requests both servers must refuse.
+func compatRequests(mods []module.Version, w int) ([]compatRequest, error) {
+	requests := []compatRequest{{path: "/latest", normalize: normalizeNote}}
+	for _, mod := range mods {
+		path, err := module.EscapePath(mod.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid module path: %s, %w", mod.Path, err)
+		}
+
+		version, err := module.EscapeVersion(mod.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid module version: %s, %w", mod.Version, err)
+		}
+
+		requests = append(requests, compatRequest{path: "/lookup/" + path + "@" + version, normalize: normalizeLookup})
+	}
+
+	if w > 0 {
+		hashTile := tlog.Tile{H: diffTileHeight, L: 0, N: 0, W: w}
+		dataTile := tlog.Tile{H: diffTileHeight, L: -1, N: 0, W: w}
+		requests = append(requests,
+			compatRequest{path: "/" + hashTile.Path(), normalize: normalizeHashTile(w)},
+			compatRequest{path: "/" + dataTile.Path(), normalize: normalizeDataTile(w)},
+		)
+	}
+
+	return append(requests,
+		compatRequest{path: "/lookup/rsc.io/quote@latest"},
+		compatRequest{path: "/tile/8/0/x999/999"},
+	), nil
+}
+
+// compatTreeSize returns the size of the tree served by the server at base, verifying its signed tree head with vkey
+// when it's given.
+func compatTreeSize(ctx context.Context, client *http.Client, base, vkey string) (int64, error) {
+	latest, err := fetch(ctx, client, base+"/latest")
+	if err != nil {
+		return 0, err
+	}
+
+	text := latest
+	if vkey != "" {
+		verifier, err := note.NewVerifier(vkey)
+		if err != nil {
+			return 0, fmt.Errorf("invalid verifier key: %w", err)
+		}
+
+		n, err := note.Open(latest, note.VerifierList(verifier))
+		if err != nil {
+			return 0, fmt.Errorf("failed to verify signed tree head: %s, %w", base, err)
+		}
+		text = []byte(n.Text)
+	} else if i := bytes.LastIndex(latest, []byte("\n\n")); i >= 0 {
+		text = latest[:i+1]
+	}
+
+	t, err := tlog.ParseTree(text)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse signed tree head: %s, %w", base, err)
+	}
+	return t.N, nil
+}
+
+// compatFetch fetches url, normalizing the body of successful responses with normalize.
+func compatFetch(
+	ctx context.Context,
+	client *http.Client,
+	url string,
+	normalize func([]byte) ([]byte, error),
+) (*compatResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, compatMaxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", url, err)
+	}
+
+	r := &compatResponse{status: resp.StatusCode, contentType: resp.Header.Get("Content-Type")}
+	if resp.StatusCode == http.StatusOK && normalize != nil {
+		r.body, r.err = normalize(body)
+	}
+	return r, nil
+}
+
+// compareCompatResponses describes how the target's response got deviates from the reference's response want.
+func compareCompatResponses(want, got *compatResponse) []string {
+	if got.status != want.status {
+		return []string{fmt.Sprintf("status: got %d, want %d", got.status, want.status)}
+	}
+	if got.status != http.StatusOK {
+		return nil
+	}
+
+	var diffs []string
+	if !sameMediaType(got.contentType, want.contentType) {
+		diffs = append(diffs, fmt.Sprintf("Content-Type: got %q, want %q", got.contentType, want.contentType))
+	}
+
+	switch {
+	case want.err != nil:
+		diffs = append(diffs, fmt.Sprintf("reference response is malformed: %v", want.err))
+	case got.err != nil:
+		diffs = append(diffs, fmt.Sprintf("malformed response: %v", got.err))
+	case !bytes.Equal(got.body, want.body):
+		diffs = append(diffs, fmt.Sprintf("body: got %q, want %q", got.body, want.body))
+	}
+	return diffs
+}
+
+// sameMediaType reports whether the Content-Type headers a and b have the same media type and parameters, ignoring
+// case where it's insignificant.
+func sameMediaType(a, b string) bool {
+	ta, pa, errA := mime.ParseMediaType(a)
+	tb, pb, errB := mime.ParseMediaType(b)
+	if errA != nil || errB != nil || ta != tb || len(pa) != len(pb) {
+		return a == b
+	}
+
+	for k, v := range pa {
+		if !strings.EqualFold(v, pb[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeNote replaces the tree size and hash of a signed tree head, and the names and signatures of its signature
+// lines, with placeholders. The size of each signature is kept, since it depends on the signing algorithm.
+func normalizeNote(msg []byte) ([]byte, error) {
+	i := bytes.LastIndex(msg, []byte("\n\n"))
+	if i < 0 {
+		return nil, errors.New("signed tree head has no signatures")
+	}
+	text, sigs := msg[:i+1], msg[i+2:]
+
+	t, err := tlog.ParseTree(text)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(text, tlog.FormatTree(t)) {
+		return nil, fmt.Errorf("tree isn't formatted canonically: %q", text)
+	}
+
+	if len(sigs) == 0 || sigs[len(sigs)-1] != '\n' {
+		return nil, errors.New("signatures must end in a newline")
+	}
+
+	out := []byte("go.sum database tree\n<size>\n<hash>\n\n")
+	for _, line := range strings.Split(string(sigs[:len(sigs)-1]), "\n") {
+		name, sig, ok := strings.Cut(strings.TrimPrefix(line, "— "), " ")
+		if !strings.HasPrefix(line, "— ") || !ok || name == "" {
+			return nil, fmt.Errorf("malformed signature line: %q", line)
+		}
+
+		data, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil || len(data) < 4 {
+			return nil, fmt.Errorf("malformed signature: %q", line)
+		}
+		out = fmt.Appendf(out, "— <name> <%d-byte signature>\n", len(data))
+	}
+	return out, nil
+}
+
+// normalizeLookup replaces the record ID and signed tree head of a lookup response with placeholders. The record
+// data is kept, since it must be the same in every checksum database.
+func normalizeLookup(msg []byte) ([]byte, error) {
+	_, data, rest, err := tlog.ParseRecord(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := normalizeNote(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte("<id>\n"), data...)
+	return append(append(out, '\n'), signed...), nil
+}
+
+// normalizeHashTile returns a function checking that hash tiles hold w hashes, and replacing them with a placeholder.
+func normalizeHashTile(w int) func([]byte) ([]byte, error) {
+	return func(tile []byte) ([]byte, error) {
+		if len(tile) != w*tlog.HashSize {
+			return nil, fmt.Errorf("hash tile has %d bytes, want %d", len(tile), w*tlog.HashSize)
+		}
+		return fmt.Appendf(nil, "<%d hashes>", w), nil
+	}
+}
+
+// normalizeDataTile returns a function checking that data tiles hold w records, each made of a module version's
+// go.sum lines and followed by a blank line, and replacing them with a placeholder.
+func normalizeDataTile(w int) func([]byte) ([]byte, error) {
+	return func(tile []byte) ([]byte, error) {
+		recs, err := splitTile(tile, w)
+		if err != nil {
+			return nil, err
+		}
+
+		size := 0
+		for i, rec := range recs {
+			if err := checkGoSumRecord(rec); err != nil {
+				return nil, fmt.Errorf("record %d: %w", i, err)
+			}
+			size += len(rec) + 1
+		}
+		if size != len(tile) {
+			return nil, fmt.Errorf("data tile has %d bytes after its %d records", len(tile)-size, w)
+		}
+
+		return fmt.Appendf(nil, "<%d records>", w), nil
+	}
+}
+
+// checkGoSumRecord checks that rec holds the go.sum lines of a module version: one for its zip and one for its go.mod.
+func checkGoSumRecord(rec []byte) error {
+	lines := strings.Split(strings.TrimSuffix(string(rec), "\n"), "\n")
+	if len(lines) != 2 {
+		return fmt.Errorf("record has %d lines, want 2", len(lines))
+	}
+
+	zip, mod := strings.Fields(lines[0]), strings.Fields(lines[1])
+	if len(zip) != 3 || len(mod) != 3 || zip[0] != mod[0] || zip[1]+"/go.mod" != mod[1] ||
+		!strings.HasPrefix(zip[2], "h1:") || !strings.HasPrefix(mod[2], "h1:") {
+		return fmt.Errorf("record isn't a module version's go.sum lines: %q", rec)
+	}
+	return nil
+}
+
+// checkTileHashes checks that the records in the first data tile of width w served by the server at base match the
+// record hashes in the corresponding hash tile.
+func checkTileHashes(ctx context.Context, client *http.Client, base string, w int) error {
+	hashTile := tlog.Tile{H: diffTileHeight, L: 0, N: 0, W: w}
+	hashes, err := fetch(ctx, client, base+"/"+hashTile.Path())
+	if err != nil {
+		return err
+	}
+	if len(hashes) != w*tlog.HashSize {
+		return fmt.Errorf("hash tile has %d bytes, want %d", len(hashes), w*tlog.HashSize)
+	}
+
+	dataTile := tlog.Tile{H: diffTileHeight, L: -1, N: 0, W: w}
+	data, err := fetch(ctx, client, base+"/"+dataTile.Path())
+	if err != nil {
+		return err
+	}
+
+	recs, err := splitTile(data, w)
+	if err != nil {
+		return err
+	}
+
+	for i, rec := range recs {
+		if h := tlog.RecordHash(rec); !bytes.Equal(h[:], hashes[i*tlog.HashSize:(i+1)*tlog.HashSize]) {
+			return fmt.Errorf("record %d doesn't match its hash in %s", i, hashTile.Path())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type (
+	// commandSpec describes a command (or keys subcommand) for the completion scripts.
+	commandSpec struct {
+		name  string // e.g. "diff" or "keys generate"
+		short string
+		flags []flagSpec
+		subs  []commandSpec
+	}
+
+	// flagSpec describes a flag for the completion scripts. choices are the values it accepts, if limited.
+	flagSpec struct {
+		name    string
+		usage   string
+		isBool  bool
+		choices []string
+	}
+)
+
+func completionCommand() *command {
+	cmd := &command{
+		name:  "completion",
+		short: "Print a shell completion script for sumdb",
+		usage: "completion <bash|zsh|fish>",
+	}
+
+	cmd.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return errUsage
+		}
+
+		var cmds []commandSpec
+		for _, c := range commands() {
+			cmds = append(cmds, describeCommand(ctx, c))
+		}
+
+		switch fs.Arg(0) {
+		case "bash":
+			writeBashCompletion(stdout, cmds)
+		case "zsh":
+			// zsh runs bash completion functions once bashcompinit is loaded.
+			fmt.Fprintln(stdout, "#compdef sumdb")
+			fmt.Fprintln(stdout, "autoload -U +X bashcompinit && bashcompinit")
+			writeBashCompletion(stdout, cmds)
+		case "fish":
+			writeFishCompletion(stdout, cmds)
+		default:
+			return fmt.Errorf("unsupported shell: %s", fs.Arg(0))
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+// describeCommand returns the description of cmd for the completion scripts. Commands define their flags when run, so
+// cmd is run with -h, which returns once its flags are parsed.
+func describeCommand(ctx context.Context, cmd *command) commandSpec {
+	c := commandSpec{name: cmd.name, short: cmd.short}
+	for _, sub := range cmd.subcommands {
+		c.subs = append(c.subs, describeCommand(ctx, sub))
+	}
+	if len(cmd.subcommands) > 0 {
+		return c
+	}
+
+	cmd.quiet = true
+	_ = cmd.run(ctx, io.Discard, []string{"-h"})
+	if cmd.flags == nil {
+		return c
+	}
+
+	cmd.flags.VisitAll(func(f *flag.Flag) {
+		cf := flagSpec{name: f.Name, usage: f.Usage}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok {
+			cf.isBool = b.IsBoolFlag()
+		}
+		if c, ok := f.Value.(interface{ choices() []string }); ok {
+			cf.choices = c.choices()
+		}
+		c.flags = append(c.flags, cf)
+	})
+	return c
+}
+
+func writeBashCompletion(w io.Writer, cmds []commandSpec) {
+	names := []string{"help"}
+	for _, c := range cmds {
+		names = append(names, c.name)
+	}
+
+	fmt.Fprintln(w, "# bash completion for sumdb. Load it with: source <(sumdb completion bash)")
+	fmt.Fprintln(w, "_sumdb() {")
+	fmt.Fprintln(w, `	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]} cmd=${COMP_WORDS[1]}`)
+	fmt.Fprintln(w, "	local flags values")
+	fmt.Fprintln(w, "	COMPREPLY=()")
+	fmt.Fprintln(w, "	if [[ $COMP_CWORD -eq 1 ]]; then")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintln(w, "		return")
+	fmt.Fprintln(w, "	fi")
+
+	for _, c := range cmds {
+		if len(c.subs) == 0 {
+			continue
+		}
+		subs := make([]string, len(c.subs))
+		for i, sub := range c.subs {
+			subs[i] = strings.TrimPrefix(sub.name, c.name+" ")
+		}
+		fmt.Fprintf(w, "\tif [[ $cmd == %s ]]; then\n", c.name)
+		fmt.Fprintln(w, "		if [[ $COMP_CWORD -eq 2 ]]; then")
+		fmt.Fprintf(w, "\t\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(subs, " "))
+		fmt.Fprintln(w, "			return")
+		fmt.Fprintln(w, "		fi")
+		fmt.Fprintln(w, `		cmd="$cmd ${COMP_WORDS[2]}"`)
+		fmt.Fprintln(w, "	fi")
+	}
+
+	fmt.Fprintln(w, `	case "$cmd" in`)
+	for _, c := range flatten(cmds) {
+		if len(c.flags) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\t%q)\n", c.name)
+		flags := make([]string, len(c.flags))
+		for i, f := range c.flags {
+			flags[i] = "-" + f.name
+		}
+		fmt.Fprintf(w, "\t\tflags=%q\n", strings.Join(flags, " "))
+		for _, f := range c.flags {
+			if len(f.choices) > 0 {
+				fmt.Fprintf(w, "\t\t[[ $prev == -%[1]s || $prev == --%[1]s ]] && values=%[2]q\n",
+					f.name, strings.Join(f.choices, " "))
+			}
+		}
+		fmt.Fprintln(w, "\t\t;;")
+	}
+	fmt.Fprintln(w, "	esac")
+
+	fmt.Fprintln(w, `	if [[ -n $values ]]; then`)
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -W "$values" -- "$cur"))`)
+	fmt.Fprintln(w, `	elif [[ $cur == -* ]]; then`)
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -W "$flags" -- "$cur"))`)
+	fmt.Fprintln(w, "	fi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o default -F _sumdb sumdb")
+}
+
+func writeFishCompletion(w io.Writer, cmds []commandSpec) {
+	fmt.Fprintln(w, "# fish completion for sumdb. Load it with: sumdb completion fish | source")
+	fmt.Fprintln(w, "complete -c sumdb -n __fish_use_subcommand -f -a help -d 'Print the available commands'")
+
+	for _, c := range cmds {
+		fmt.Fprintf(w, "complete -c sumdb -n __fish_use_subcommand -f -a %s -d %s\n", c.name, fishQuote(c.short))
+
+		cond := "__fish_seen_subcommand_from " + c.name
+		if len(c.subs) > 0 {
+			subs := make([]string, len(c.subs))
+			for i, sub := range c.subs {
+				subs[i] = strings.TrimPrefix(sub.name, c.name+" ")
+			}
+			for i, sub := range c.subs {
+				fmt.Fprintf(w, "complete -c sumdb -n %s -f -a %s -d %s\n",
+					fishQuote(cond+"; and not __fish_seen_subcommand_from "+strings.Join(subs, " ")),
+					subs[i], fishQuote(sub.short))
+			}
+			for i, sub := range c.subs {
+				writeFishFlags(w, cond+"; and __fish_seen_subcommand_from "+subs[i], sub.flags)
+			}
+			continue
+		}
+
+		writeFishFlags(w, cond, c.flags)
+	}
+}
+
+// writeFishFlags writes the completions of flags, offered when cond is true.
+func writeFishFlags(w io.Writer, cond string, flags []flagSpec) {
+	for _, f := range flags {
+		fmt.Fprintf(w, "complete -c sumdb -n %s -o %s", fishQuote(cond), f.name)
+		switch {
+		case len(f.choices) > 0:
+			fmt.Fprintf(w, " -x -a %s", fishQuote(strings.Join(f.choices, " ")))
+		case !f.isBool:
+			fmt.Fprint(w, " -r")
+		}
+		fmt.Fprintf(w, " -d %s\n", fishQuote(f.usage))
+	}
+}
+
+// flatten returns cmds followed by their subcommands.
+func flatten(cmds []commandSpec) []commandSpec {
+	var all []commandSpec
+	for _, c := range cmds {
+		all = append(all, c)
+		all = append(all, c.subs...)
+	}
+	return all
+}
+
+// fishQuote quotes s as a single-quoted fish string.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/intern"
+	"github.com/pseudomuto/sumdb/store/snapshot"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// diffTileHeight is the tile height used by sumdb servers.
+const diffTileHeight = 8
+
+// diffBatchSize is the number of records read from a snapshot at a time.
+const diffBatchSize = 1024
+
+type (
+	// logContents is the hash of every record in a log along with the log's root hash. Record data isn't kept, so
+	// reading a log takes about 200 bytes per record (mostly its stored hashes and index entry), plus the length of
+	// its version, with module paths interned: around 2 GiB for 10 million records.
+	logContents struct {
+		name    string
+		size    int64
+		root    tlog.Hash
+		records map[recordKey]tlog.Hash // record hashes
+		hashes  hashSlice
+		paths   intern.Pool
+	}
+
+	// recordKey identifies a record by module path and version.
+	recordKey struct {
+		path    string
+		version string
+	}
+
+	// diffReport is the outcome of diff, and its JSON output. Records are identified by module@version.
+	diffReport struct {
+		A         diffLog  `json:"a"`
+		B         diffLog  `json:"b"`
+		OnlyA     []string `json:"only_in_a"`
+		OnlyB     []string `json:"only_in_b"`
+		Conflicts []string `json:"conflicts"`
+	}
+
+	// diffLog describes one of the logs compared by diff.
+	diffLog struct {
+		Name string `json:"name"`
+		Size int64  `json:"size"`
+		Root string `json:"root"`
+	}
+
+	// hashSlice is an in-memory tlog.HashReader holding the stored hashes of a tree by storage index.
+	hashSlice []tlog.Hash
+)
+
+func diffCommand() *command {
+	cmd := &command{
+		name:  "diff",
+		short: "Compare the records and root hashes of two checksum databases",
+		usage: "diff -a <url|snapshot> -b <url|snapshot> [-a-key <vkey>] [-b-key <vkey>] [-output table|json]",
+	}
+
+	cmd.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		a := fs.String("a", "", "first log: a sumdb URL (e.g. https://sum.golang.org) or snapshot file")
+		b := fs.String("b", "", "second log: a sumdb URL or snapshot file")
+		aKey := fs.String("a-key", "", "verifier key for the signed tree head served by -a")
+		bKey := fs.String("b-key", "", "verifier key for the signed tree head served by -b")
+		output := outputFlag(fs)
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if *a == "" || *b == "" || fs.NArg() != 0 {
+			fs.Usage()
+			return errUsage
+		}
+
+		la, err := readLog(ctx, *a, *aKey)
+		if err != nil {
+			return err
+		}
+
+		lb, err := readLog(ctx, *b, *bKey)
+		if err != nil {
+			return err
+		}
+
+		report := diffLogs(la, lb)
+		if *output == outputJSON {
+			if err := writeJSON(stdout, report); err != nil {
+				return err
+			}
+		} else {
+			printDiff(stdout, report)
+		}
+
+		if len(report.OnlyA)+len(report.OnlyB)+len(report.Conflicts) > 0 {
+			return fmt.Errorf("logs differ: %d only in a, %d only in b, %d conflicting",
+				len(report.OnlyA), len(report.OnlyB), len(report.Conflicts))
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+// readLog reads every record in the log at src, which is either a sumdb URL or the path to a snapshot file.
+func readLog(ctx context.Context, src, vkey string) (*logContents, error) {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		return readRemoteLog(ctx, strings.TrimSuffix(src, "/"), vkey)
+	}
+
+	store, err := snapshot.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = store.Close() }()
+
+	size, err := store.TreeSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l := newLogContents(src, size)
+	for id := int64(0); id < size; id += diffBatchSize {
+		recs, err := store.Records(ctx, id, min(diffBatchSize, size-id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read records: %s, %w", src, err)
+		}
+
+		for _, r := range recs {
+			if err := l.add(r.Data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := l.finish(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// readRemoteLog reads every record served by the sumdb at base, ensuring the records match its signed tree head.
+func readRemoteLog(ctx context.Context, base, vkey string) (*logContents, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	latest, err := fetch(ctx, client, base+"/latest")
+	if err != nil {
+		return nil, err
+	}
+
+	if vkey != "" {
+		verifier, err := note.NewVerifier(vkey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid verifier key: %w", err)
+		}
+
+		n, err := note.Open(latest, note.VerifierList(verifier))
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify signed tree head: %s, %w", base, err)
+		}
+		latest = []byte(n.Text)
+	}
+
+	head, err := tlog.ParseTree(latest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signed tree head: %s, %w", base, err)
+	}
+
+	l := newLogContents(base, head.N)
+	for n := int64(0); n*(1<<diffTileHeight) < head.N; n++ {
+		t := tlog.Tile{H: diffTileHeight, L: -1, N: n, W: int(min(head.N-n*(1<<diffTileHeight), 1<<diffTileHeight))}
+		tile, err := fetch(ctx, client, base+"/"+t.Path())
+		if err != nil {
+			return nil, err
+		}
+
+		recs, err := splitTile(tile, t.W)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Path(), err)
+		}
+		for _, data := range recs {
+			if err := l.add(data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := l.finish(); err != nil {
+		return nil, err
+	}
+	if l.root != head.Hash {
+		return nil, fmt.Errorf("records served by %s don't match its tree head: got %s, want %s", base, l.root, head.Hash)
+	}
+
+	return l, nil
+}
+
+// newLogContents returns empty contents for the log name, with room for size records.
+func newLogContents(name string, size int64) *logContents {
+	return &logContents{
+		name:    name,
+		records: make(map[recordKey]tlog.Hash, size),
+		hashes:  make(hashSlice, 0, tlog.StoredHashCount(size)),
+	}
+}
+
+// add adds the record with the given data, which isn't retained, as the next record in the log.
+func (l *logContents) add(data []byte) error {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	f := bytes.Fields(line)
+	if len(f) != 3 {
+		return fmt.Errorf("malformed record %d in %s: %q", l.size, l.name, line)
+	}
+
+	stored, err := tlog.StoredHashes(l.size, data, l.hashes)
+	if err != nil {
+		return fmt.Errorf("failed to hash record %d: %w", l.size, err)
+	}
+
+	// The first stored hash of a record is its record hash.
+	l.records[recordKey{path: l.paths.Bytes(f[0]), version: string(f[1])}] = stored[0]
+	l.hashes = append(l.hashes, stored...)
+	l.size++
+	return nil
+}
+
+// finish computes the root hash once every record has been added.
+func (l *logContents) finish() error {
+	if l.size == 0 {
+		return nil
+	}
+
+	root, err := tlog.TreeHash(l.size, l.hashes)
+	if err != nil {
+		return fmt.Errorf("failed to compute root hash: %s, %w", l.name, err)
+	}
+	l.root = root
+	return nil
+}
+
+// diffLogs returns the records that are only in one of the logs or differ between them.
+func diffLogs(a, b *logContents) diffReport {
+	var onlyA, onlyB, conflicts []recordKey
+	for key, h := range a.records {
+		other, ok := b.records[key]
+		switch {
+		case !ok:
+			onlyA = append(onlyA, key)
+		case h != other:
+			conflicts = append(conflicts, key)
+		}
+	}
+	for key := range b.records {
+		if _, ok := a.records[key]; !ok {
+			onlyB = append(onlyB, key)
+		}
+	}
+
+	strs := func(keys []recordKey) []string {
+		slices.SortFunc(keys, recordKey.compare)
+		s := make([]string, len(keys))
+		for i, key := range keys {
+			s[i] = key.String()
+		}
+		return s
+	}
+
+	return diffReport{
+		A:         diffLog{Name: a.name, Size: a.size, Root: a.root.String()},
+		B:         diffLog{Name: b.name, Size: b.size, Root: b.root.String()},
+		OnlyA:     strs(onlyA),
+		OnlyB:     strs(onlyB),
+		Conflicts: strs(conflicts),
+	}
+}
+
+// printDiff reports the records that are only in one of the logs or differ between them.
+func printDiff(w io.Writer, r diffReport) {
+	fmt.Fprintf(w, "a: %s (size %d, root %s)\n", r.A.Name, r.A.Size, r.A.Root)
+	fmt.Fprintf(w, "b: %s (size %d, root %s)\n", r.B.Name, r.B.Size, r.B.Root)
+
+	for _, key := range r.OnlyA {
+		fmt.Fprintf(w, "only in a: %s\n", key)
+	}
+	for _, key := range r.OnlyB {
+		fmt.Fprintf(w, "only in b: %s\n", key)
+	}
+	for _, key := range r.Conflicts {
+		fmt.Fprintf(w, "conflict:  %s\n", key)
+	}
+
+	if len(r.OnlyA)+len(r.OnlyB)+len(r.Conflicts) > 0 {
+		return
+	}
+
+	if r.A.Root == r.B.Root {
+		fmt.Fprintln(w, "Logs are identical")
+	} else {
+		fmt.Fprintln(w, "Logs contain the same records in a different order")
+	}
+}
+
+// splitTile splits a data tile into its first w records. Each record is followed by a blank line.
+func splitTile(tile []byte, w int) ([][]byte, error) {
+	recs := make([][]byte, 0, w)
+	for len(recs) < w {
+		end := bytes.Index(tile, []byte("\n\n"))
+		if end < 0 {
+			return nil, fmt.Errorf("tile has %d records, want %d", len(recs), w)
+		}
+		recs = append(recs, tile[:end+1])
+		tile = tile[end+2:]
+	}
+	return recs, nil
+}
+
+// ReadHashes implements tlog.HashReader.
+func (h hashSlice) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	out := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		if idx < 0 || idx >= int64(len(h)) {
+			return nil, fmt.Errorf("%w: %d", sumdb.ErrMissingHash, idx)
+		}
+		out[i] = h[idx]
+	}
+	return out, nil
+}
+
+func (k recordKey) String() string {
+	return k.path + "@" + k.version
+}
+
+func (k recordKey) compare(other recordKey) int {
+	return cmp.Or(cmp.Compare(k.path, other.path), cmp.Compare(k.version, other.version))
+}
+
+func fetch(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pseudomuto/sumdb"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func envCommand() *command {
+	cmd := &command{
+		name:  "env",
+		short: "Print the go command settings that trust a sumdb server",
+		usage: "env -key-file <file> [-nosumdb <patterns>] [-netrc] [-output table|json] <url>",
+	}
+
+	cmd.run = func(_ context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		keyFile := fs.String("key-file", "", "file containing the signer key the server runs with")
+		noSumDB := fs.String("nosumdb", "", "comma-separated glob patterns of modules not to check against the server")
+		netrc := fs.Bool("netrc", false, "also print a .netrc entry for authenticating to the server")
+		output := outputFlag(fs)
+		asJSON := fs.Bool("json", false, "print the settings as JSON (shorthand for -output json)")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if fs.NArg() != 1 || *keyFile == "" {
+			fs.Usage()
+			return errUsage
+		}
+
+		u, err := url.Parse(fs.Arg(0))
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid server URL: %s", fs.Arg(0))
+		}
+
+		data, err := os.ReadFile(*keyFile) // #nosec G304 -- path is provided by the operator
+		if err != nil {
+			return fmt.Errorf("failed to read key: %w", err)
+		}
+
+		skey := strings.TrimSpace(string(data))
+		s, err := note.NewSigner(skey)
+		if err != nil {
+			return fmt.Errorf("invalid signer key: %s, %w", *keyFile, err)
+		}
+
+		db, err := sumdb.New(s.Name(), skey)
+		if err != nil {
+			return err
+		}
+
+		var patterns []string
+		if *noSumDB != "" {
+			patterns = strings.Split(*noSumDB, ",")
+		}
+		env := db.GoEnv(u, patterns...)
+
+		if *asJSON || *output == outputJSON {
+			return writeJSON(stdout, env)
+		}
+
+		fmt.Fprint(stdout, env.Exports())
+
+		if *netrc {
+			fmt.Fprintf(stdout, "\n# ~/.netrc (or $NETRC)\n# machine %s login <user> password <token>\n", u.Hostname())
+		}
+		return nil
+	}
+
+	return cmd
+}
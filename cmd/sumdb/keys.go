@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pseudomuto/sumdb"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func keysCommand() *command {
+	cmd := &command{
+		name:        "keys",
+		short:       "Generate, inspect and rotate signer keys",
+		usage:       "keys <generate|show|rotate> [flags]",
+		subcommands: []*command{keysGenerateCommand(), keysShowCommand(), keysRotateCommand()},
+	}
+
+	cmd.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		if len(args) > 0 {
+			for _, sub := range cmd.subcommands {
+				if sub.name == "keys "+args[0] {
+					return sub.run(ctx, stdout, args[1:])
+				}
+			}
+		}
+
+		var w io.Writer = os.Stderr
+		if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+			w = stdout
+		}
+		fmt.Fprintf(w, "Usage: sumdb %s\n\n%s\n\nCommands:\n", cmd.usage, cmd.short)
+		for _, sub := range cmd.subcommands {
+			fmt.Fprintf(w, "  %-10s %s\n", strings.TrimPrefix(sub.name, "keys "), sub.short)
+		}
+		if w == stdout {
+			return nil
+		}
+		return errUsage
+	}
+
+	return cmd
+}
+
+func keysGenerateCommand() *command {
+	cmd := &command{
+		name:  "keys generate",
+		short: "Create a signer key and print its verifier key",
+		usage: "keys generate -out <file> [-output table|json] <name>",
+	}
+
+	cmd.run = func(_ context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		out := fs.String("out", "", "file to write the signer key to (must not exist)")
+		output := outputFlag(fs)
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if fs.NArg() != 1 || *out == "" {
+			fs.Usage()
+			return errUsage
+		}
+
+		skey, vkey, err := sumdb.GenerateKeys(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		if err := writeSignerKey(*out, skey); err != nil {
+			return err
+		}
+
+		if *output == outputJSON {
+			return writeJSON(stdout, keyReport{Name: fs.Arg(0), SignerKeyFile: *out, VerifierKey: vkey})
+		}
+
+		fmt.Fprintf(stdout, "Signer key written to %s\n", *out)
+		fmt.Fprintf(stdout, "Verifier key: %s\n", vkey)
+		return nil
+	}
+
+	return cmd
+}
+
+func keysShowCommand() *command {
+	cmd := &command{
+		name:  "keys show",
+		short: "Print the verifier key of a signer key, and the go env setting trusting it",
+		usage: "keys show -key-file <file> [-output table|json] [<url>]",
+	}
+
+	cmd.run = func(_ context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		keyFile := fs.String("key-file", "", "file containing the signer key (or the key itself in $SUMDB_KEY)")
+		output := outputFlag(fs)
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if fs.NArg() > 1 {
+			fs.Usage()
+			return errUsage
+		}
+
+		skey, name, err := loadSignerKey(*keyFile)
+		if err != nil {
+			return err
+		}
+
+		vkey, err := verifierKey(name, skey)
+		if err != nil {
+			return err
+		}
+
+		gosumdb := vkey
+		if fs.NArg() == 1 {
+			u, err := url.Parse(fs.Arg(0))
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("invalid server URL: %s", fs.Arg(0))
+			}
+			gosumdb += " " + strings.TrimSuffix(u.String(), "/")
+		}
+
+		if *output == outputJSON {
+			return writeJSON(stdout, keyReport{Name: name, VerifierKey: vkey, GoSumDB: gosumdb})
+		}
+
+		fmt.Fprintf(stdout, "Name:         %s\n", name)
+		fmt.Fprintf(stdout, "Verifier key: %s\n", vkey)
+		fmt.Fprintf(stdout, "\ngo env -w GOSUMDB=%q\n", gosumdb)
+		return nil
+	}
+
+	return cmd
+}
+
+func keysRotateCommand() *command {
+	cmd := &command{
+		name:  "keys rotate",
+		short: "Rotate to a new signer key, co-signing the current tree head with the old and new keys",
+		usage: "keys rotate -key-file <file> -new-key-file <file> -store <scheme>:<location> [-out <file>] " +
+			"[-output table|json]",
+	}
+
+	cmd.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		keyFile := fs.String("key-file", "", "file containing the current signer key (or the key itself in $SUMDB_KEY)")
+		newKeyFile := fs.String("new-key-file", "",
+			"file containing the new signer key, which is generated if the file doesn't exist")
+		dsn := fs.String("store", "", "store holding the log (e.g. sqlite:/var/lib/sumdb.db)")
+		out := fs.String("out", "", "file to write the co-signed tree head to (defaults to stdout)")
+		output := outputFlag(fs)
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if *newKeyFile == "" || *dsn == "" || fs.NArg() != 0 {
+			fs.Usage()
+			return errUsage
+		}
+
+		oldKey, name, err := loadSignerKey(*keyFile)
+		if err != nil {
+			return err
+		}
+
+		newKey, generated, err := loadOrGenerateKey(*newKeyFile, name)
+		if err != nil {
+			return err
+		}
+
+		oldVKey, err := verifierKey(name, oldKey)
+		if err != nil {
+			return err
+		}
+		newVKey, err := verifierKey(name, newKey)
+		if err != nil {
+			return err
+		}
+		if oldVKey == newVKey {
+			return errors.New("the new key is the current key")
+		}
+
+		store, err := openStore(ctx, *dsn)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = store.Close() }()
+
+		signed, err := coSignTreeHead(ctx, store, name, oldKey, oldVKey, newKey)
+		if err != nil {
+			return err
+		}
+
+		if *out != "" {
+			if err := os.WriteFile(*out, signed, 0o644); err != nil { // #nosec G306 -- tree heads are public
+				return fmt.Errorf("failed to write tree head: %w", err)
+			}
+		}
+
+		if *output == outputJSON {
+			report := rotateReport{OldVerifierKey: oldVKey, NewVerifierKey: newVKey, TreeHeadFile: *out}
+			if generated {
+				report.NewSignerKeyFile = *newKeyFile
+			}
+			if *out == "" {
+				report.TreeHead = string(signed)
+			}
+			return writeJSON(stdout, report)
+		}
+
+		if *out == "" {
+			_, _ = stdout.Write(signed)
+		}
+
+		// The tree head goes to stdout unless -out is set, so it can be piped.
+		var w io.Writer = stdout
+		if *out == "" {
+			w = os.Stderr
+		}
+		if generated {
+			fmt.Fprintf(w, "New signer key written to %s\n", *newKeyFile)
+		}
+		fmt.Fprintf(w, "Old verifier key: %s\n", oldVKey)
+		fmt.Fprintf(w, "New verifier key: %s\n", newVKey)
+		fmt.Fprintln(w, "\nRestart the server with the new key, keeping the old one as an additional signer "+
+			"(serve -additional-key-file) until every client trusts the new verifier key. The co-signed tree head "+
+			"proves that both keys vouch for the same log.")
+		return nil
+	}
+
+	return cmd
+}
+
+// keyReport is the JSON output of keys generate and keys show.
+type keyReport struct {
+	Name          string `json:"name,omitempty"`
+	SignerKeyFile string `json:"signer_key_file,omitempty"`
+	VerifierKey   string `json:"verifier_key"`
+	GoSumDB       string `json:"gosumdb,omitempty"`
+}
+
+// rotateReport is the JSON output of keys rotate. TreeHead is the co-signed tree head, unless it was written to
+// TreeHeadFile.
+type rotateReport struct {
+	OldVerifierKey   string `json:"old_verifier_key"`
+	NewVerifierKey   string `json:"new_verifier_key"`
+	NewSignerKeyFile string `json:"new_signer_key_file,omitempty"`
+	TreeHead         string `json:"tree_head,omitempty"`
+	TreeHeadFile     string `json:"tree_head_file,omitempty"`
+}
+
+// coSignTreeHead returns the current tree head of the log in store, signed by both oldKey and newKey. The tree head is
+// first signed by the server as it would be with oldKey, and verified against oldVKey.
+func coSignTreeHead(ctx context.Context, store sumdb.Store, name, oldKey, oldVKey, newKey string) ([]byte, error) {
+	db, err := sumdb.New(name, oldKey, sumdb.WithStore(store))
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := db.Signed(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign tree head: %w", err)
+	}
+
+	verifier, err := note.NewVerifier(oldVKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verifier key: %w", err)
+	}
+	n, err := note.Open(current, note.VerifierList(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify tree head: %w", err)
+	}
+	if _, err := tlog.ParseTree([]byte(n.Text)); err != nil {
+		return nil, fmt.Errorf("failed to parse tree head: %w", err)
+	}
+
+	oldSigner, err := note.NewSigner(oldKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer key: %w", err)
+	}
+	newSigner, err := note.NewSigner(newKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer key: %w", err)
+	}
+
+	signed, err := note.Sign(&note.Note{Text: n.Text}, oldSigner, newSigner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to co-sign tree head: %w", err)
+	}
+	return signed, nil
+}
+
+// loadOrGenerateKey returns the signer key in the file at path, which must be for the server name. If the file doesn't
+// exist, a key is generated and written to it, and generated is true.
+func loadOrGenerateKey(path, name string) (skey string, generated bool, err error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is provided by the operator
+	if errors.Is(err, os.ErrNotExist) {
+		if skey, _, err = sumdb.GenerateKeys(name); err != nil {
+			return "", false, err
+		}
+		return skey, true, writeSignerKey(path, skey)
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	skey = strings.TrimSpace(string(data))
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid signer key: %s, %w", path, err)
+	}
+	if s.Name() != name {
+		return "", false, fmt.Errorf("new key is for %s, not %s", s.Name(), name)
+	}
+	return skey, false, nil
+}
+
+// writeSignerKey writes skey to a new file at path, readable only by its owner.
+func writeSignerKey(path, skey string) error {
+	// #nosec G304 -- path is provided by the operator
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %w", err)
+	}
+
+	if _, err := fmt.Fprintln(f, skey); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	return f.Close()
+}
+
+// verifierKey returns the verifier key of skey, the signer key of the server name.
+func verifierKey(name, skey string) (string, error) {
+	db, err := sumdb.New(name, skey)
+	if err != nil {
+		return "", err
+	}
+	return db.VerifierKey(), nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+type (
+	// loadResult is the outcome of a single synthetic lookup. Lookups interrupted by the end of the run are neither
+	// successes nor errors.
+	loadResult struct {
+		cold        bool
+		dropped     bool
+		interrupted bool
+		status      int
+		err         error
+		latency     time.Duration
+	}
+
+	// loadReport summarizes the outcome of loadgen, and is its JSON output. Latencies are in nanoseconds, and are only
+	// reported for successful lookups.
+	loadReport struct {
+		Requests       int            `json:"requests"`
+		RequestsPerSec float64        `json:"requests_per_sec"`
+		Dropped        int            `json:"dropped"`
+		Errors         int            `json:"errors"`
+		Statuses       map[int]int    `json:"statuses"`
+		Warm           *latencyReport `json:"warm,omitempty"`
+		Cold           *latencyReport `json:"cold,omitempty"`
+	}
+
+	// latencyReport is the distribution of the latencies of a set of lookups.
+	latencyReport struct {
+		N   int           `json:"n"`
+		P50 time.Duration `json:"p50"`
+		P90 time.Duration `json:"p90"`
+		P99 time.Duration `json:"p99"`
+		Max time.Duration `json:"max"`
+	}
+)
+
+func loadgenCommand() *command {
+	cmd := &command{
+		name:  "loadgen",
+		short: "Generate synthetic lookup load against a sumdb server",
+		usage: "loadgen -target <url> -modules <file> [flags]",
+	}
+
+	cmd.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		target := fs.String("target", "", "base URL of the sumdb server (e.g. https://sum.example.com)")
+		modules := fs.String("modules", "", "file containing one module@version per line")
+		qps := fs.Float64("qps", 10, "lookups per second")
+		duration := fs.Duration("duration", time.Minute, "how long to generate load")
+		hot := fs.Float64("hot", 0.9, "fraction of lookups for already-requested (warm) modules")
+		hotSet := fs.Int("hot-set", 100, "number of modules that make up the hot set")
+		concurrency := fs.Int("concurrency", 64, "maximum number of in-flight lookups")
+		timeout := fs.Duration("timeout", 30*time.Second, "per-lookup timeout")
+		output := outputFlag(fs)
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if *target == "" || *modules == "" || *qps <= 0 || *concurrency <= 0 || *hotSet <= 0 || *hot < 0 || *hot > 1 {
+			fs.Usage()
+			return errUsage
+		}
+
+		mods, err := readModules(*modules)
+		if err != nil {
+			return err
+		}
+
+		gen := &loadGenerator{
+			client:  &http.Client{Timeout: *timeout},
+			target:  strings.TrimSuffix(*target, "/"),
+			modules: mods,
+			hot:     *hot,
+			hotSet:  min(*hotSet, len(mods)),
+		}
+
+		if *output == outputTable {
+			fmt.Fprintf(stdout, "Generating %.1f lookups/s against %s for %s\n", *qps, gen.target, *duration)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, *duration)
+		defer cancel()
+
+		report := newLoadReport(gen.run(ctx, *qps, *concurrency), *duration)
+		if *output == outputJSON {
+			return writeJSON(stdout, report)
+		}
+
+		printLoadReport(stdout, report)
+		return nil
+	}
+
+	return cmd
+}
+
+// loadGenerator issues lookups for a mix of hot (repeated) and cold (never requested) modules.
+type loadGenerator struct {
+	client  *http.Client
+	target  string
+	modules []module.Version
+	hot     float64
+	hotSet  int
+
+	mu   sync.Mutex
+	next int // index of the next cold module
+}
+
+func (g *loadGenerator) run(ctx context.Context, qps float64, concurrency int) []loadResult {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []loadResult
+		sem     = make(chan struct{}, concurrency)
+	)
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / qps))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return results
+		case <-ticker.C:
+		}
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			// Saturated: record a dropped lookup rather than queueing, so the offered load stays constant.
+			mu.Lock()
+			results = append(results, loadResult{dropped: true})
+			mu.Unlock()
+			continue
+		}
+
+		wg.Go(func() {
+			defer func() { <-sem }()
+			res := g.lookup(ctx)
+
+			mu.Lock()
+			results = append(results, res)
+			mu.Unlock()
+		})
+	}
+}
+
+// pick returns the next module to look up and whether it's a cold lookup.
+func (g *loadGenerator) pick() (module.Version, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// The hot set is only warm once it has been requested, so start by walking through it. After that, cold lookups
+	// walk through the remaining modules until they run out.
+	warmingUp := g.next < g.hotSet
+	if warmingUp || (g.next < len(g.modules) && rand.Float64() >= g.hot) { // #nosec G404 -- not security sensitive
+		m := g.modules[g.next]
+		g.next++
+		return m, true
+	}
+
+	return g.modules[rand.IntN(g.hotSet)], false // #nosec G404 -- not security sensitive
+}
+
+func (g *loadGenerator) lookup(ctx context.Context) loadResult {
+	mod, cold := g.pick()
+	res := loadResult{cold: cold}
+
+	path, err := module.EscapePath(mod.Path)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	version, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.target+"/lookup/"+path+"@"+version, nil)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	start := time.Now()
+	resp, err := g.client.Do(req)
+	if err != nil {
+		// Lookups interrupted by the end of the run aren't errors, unlike those that time out on their own.
+		res.interrupted = ctx.Err() != nil
+		res.err = err
+		return res
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	res.latency = time.Since(start)
+	res.status = resp.StatusCode
+	return res
+}
+
+// newLoadReport summarizes the results of a load test that ran for d.
+func newLoadReport(results []loadResult, d time.Duration) loadReport {
+	var warm, cold []time.Duration
+	r := loadReport{Statuses: make(map[int]int)}
+
+	for _, res := range results {
+		switch {
+		case res.interrupted:
+			continue
+		case res.dropped:
+			r.Dropped++
+			continue
+		case res.err != nil:
+			r.Errors++
+			continue
+		}
+
+		r.Statuses[res.status]++
+		if res.status != http.StatusOK {
+			r.Errors++
+			continue
+		}
+
+		if res.cold {
+			cold = append(cold, res.latency)
+		} else {
+			warm = append(warm, res.latency)
+		}
+	}
+
+	r.Requests = len(results) - r.Dropped
+	r.RequestsPerSec = float64(r.Requests) / d.Seconds()
+	r.Warm = newLatencyReport(warm)
+	r.Cold = newLatencyReport(cold)
+	return r
+}
+
+// newLatencyReport returns the distribution of latencies, or nil if there are none.
+func newLatencyReport(latencies []time.Duration) *latencyReport {
+	if len(latencies) == 0 {
+		return nil
+	}
+
+	slices.Sort(latencies)
+	return &latencyReport{
+		N:   len(latencies),
+		P50: percentile(latencies, 0.50),
+		P90: percentile(latencies, 0.90),
+		P99: percentile(latencies, 0.99),
+		Max: latencies[len(latencies)-1],
+	}
+}
+
+func printLoadReport(w io.Writer, r loadReport) {
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Requests:   %d (%.1f/s), dropped: %d\n", r.Requests, r.RequestsPerSec, r.Dropped)
+	if r.Requests > 0 {
+		fmt.Fprintf(w, "Errors:     %d (%.2f%%)\n", r.Errors, 100*float64(r.Errors)/float64(r.Requests))
+	}
+
+	for _, code := range slices.Sorted(maps.Keys(r.Statuses)) {
+		fmt.Fprintf(w, "  HTTP %d: %d\n", code, r.Statuses[code])
+	}
+
+	printLatencies(w, "Warm", r.Warm)
+	printLatencies(w, "Cold", r.Cold)
+}
+
+func printLatencies(w io.Writer, name string, l *latencyReport) {
+	if l == nil {
+		return
+	}
+
+	fmt.Fprintf(w, "%-11s n=%d p50=%s p90=%s p99=%s max=%s\n", name+":", l.N, l.P50, l.P90, l.P99, l.Max)
+}
+
+// percentile returns the p-th percentile of sorted, using the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	return sorted[max(0, min(idx, len(sorted)-1))]
+}
+
+// readModules reads module@version lines from path, ignoring blank lines and # comments.
+func readModules(path string) ([]module.Version, error) {
+	f, err := os.Open(path) // #nosec G304 -- path is provided by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to open modules file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var mods []module.Version
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		mod, err := parseModuleVersion(line)
+		if err != nil {
+			return nil, err
+		}
+		mods = append(mods, mod)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read modules file: %w", err)
+	}
+
+	if len(mods) == 0 {
+		return nil, fmt.Errorf("no modules found in %s", path)
+	}
+
+	return mods, nil
+}
+
+// parseModuleVersion parses a module@version string.
+func parseModuleVersion(s string) (module.Version, error) {
+	path, version, ok := strings.Cut(s, "@")
+	if !ok || path == "" || version == "" {
+		return module.Version{}, fmt.Errorf("invalid module format: %q (expected path@version)", s)
+	}
+	return module.Version{Path: path, Version: version}, nil
+}
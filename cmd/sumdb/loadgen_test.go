@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadgenFlags(t *testing.T) {
+	modules := filepath.Join(t.TempDir(), "modules.txt")
+	require.NoError(t, os.WriteFile(modules, []byte("example.com/a@v1.0.0\n"), 0o600))
+
+	tests := map[string][]string{
+		"missing target": {"-modules", modules},
+		"zero hot set":   {"-target", "http://localhost", "-modules", modules, "-hot-set", "0"},
+		"negative hot":   {"-target", "http://localhost", "-modules", modules, "-hot", "-0.1"},
+		"hot above one":  {"-target", "http://localhost", "-modules", modules, "-hot", "1.5"},
+	}
+
+	for name, args := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := loadgenCommand().run(t.Context(), io.Discard, args)
+			require.ErrorIs(t, err, errUsage)
+		})
+	}
+}
+
+func TestNewLoadReport(t *testing.T) {
+	timeout := &timeoutError{}
+	report := newLoadReport([]loadResult{
+		{status: http.StatusOK, latency: time.Millisecond},
+		{status: http.StatusOK, latency: 2 * time.Millisecond, cold: true},
+		{status: http.StatusNotFound},
+		{dropped: true},
+		{err: errors.New("connection refused")},
+		{err: timeout},
+		{err: context.DeadlineExceeded, interrupted: true},
+	}, time.Second)
+
+	require.Equal(t, 6, report.Requests)
+	require.Equal(t, 1, report.Dropped)
+	require.Equal(t, 3, report.Errors, "per-lookup timeouts are errors, lookups interrupted by the end of the run aren't")
+	require.Equal(t, map[int]int{http.StatusOK: 2, http.StatusNotFound: 1}, report.Statuses)
+	require.Equal(t, 1, report.Warm.N)
+	require.Equal(t, 1, report.Cold.N)
+}
+
+// timeoutError is the kind of error returned by an http.Client whose timeout elapsed.
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "Client.Timeout exceeded while awaiting headers" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
+func (*timeoutError) Unwrap() error   { return context.DeadlineExceeded }
@@ -0,0 +1,125 @@
+// Command sumdb provides tooling for operating and debugging a sumdb server.
+//
+// Usage:
+//
+//	sumdb <command> [flags] [args]
+//
+// Run `sumdb help` for the list of available commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// command is a sumdb subcommand.
+type command struct {
+	name        string
+	short       string
+	usage       string
+	run         func(ctx context.Context, stdout io.Writer, args []string) error
+	subcommands []*command // dispatched to by run, if any
+
+	// flags is the FlagSet created by newFlagSet when the command last ran, which doesn't print usage if quiet is set.
+	flags *flag.FlagSet
+	quiet bool
+}
+
+// errUsage is returned by commands when they are invoked incorrectly.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Stdout, os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "sumdb: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func commands() []*command {
+	return []*command{
+		benchStoreCommand(),
+		compatCheckCommand(),
+		completionCommand(),
+		diffCommand(),
+		envCommand(),
+		keysCommand(),
+		loadgenCommand(),
+		monitorCommand(),
+		replayCommand(),
+		serveCommand(),
+	}
+}
+
+func run(ctx context.Context, stdout io.Writer, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stdout)
+		return nil
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name == args[0] {
+			return cmd.run(ctx, stdout, args[1:])
+		}
+	}
+
+	printUsage(os.Stderr)
+	return fmt.Errorf("unknown command: %s", args[0])
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: sumdb <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.short)
+	}
+}
+
+// newFlagSet creates a FlagSet for cmd which prints the command's usage on error.
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: sumdb %s\n\n%s\n", cmd.usage, cmd.short)
+		if hasFlags(fs) {
+			fmt.Fprintln(fs.Output())
+			fmt.Fprintln(fs.Output(), "Flags:")
+			fs.PrintDefaults()
+		}
+	}
+	if cmd.quiet {
+		fs.SetOutput(io.Discard)
+	}
+	cmd.flags = fs
+	return fs
+}
+
+// parseFlags parses args with fs, mapping flag errors (other than flag.ErrHelp) to errUsage.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pseudomuto/sumdb/alert"
+	"github.com/pseudomuto/sumdb/monitor"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// goSumDBKey is the verifier key of sum.golang.org, used when monitoring it without -key.
+const goSumDBKey = "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8"
+
+// monitorEvent is a line of the JSON output of monitor: an observed tree head, an error checking the database, or a
+// fork (with the inconsistent signed tree heads).
+type monitorEvent struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	TreeSize int64     `json:"tree_size,omitempty"`
+	Root     string    `json:"root,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Old      string    `json:"old,omitempty"`
+	New      string    `json:"new,omitempty"`
+}
+
+func monitorCommand() *command {
+	cmd := &command{
+		name:  "monitor",
+		short: "Continuously check a checksum database for forks",
+		usage: "monitor [-key <vkey>] [-state <file> | -gostate] [-interval <duration>] " +
+			"[-webhook <url>] [-slack <url>] [-once] [-output table|json] <url>",
+	}
+
+	cmd.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		key := fs.String("key", "", "verifier key of the database (defaults to sum.golang.org's key for that host)")
+		state := fs.String("state", "", "file persisting the latest observed signed tree head across restarts")
+		goState := fs.Bool("gostate", false, "share the latest signed tree head with the go command ($GOPATH/pkg/sumdb)")
+		interval := fs.Duration("interval", time.Minute, "how often to check the database")
+		webhook := fs.String("webhook", "", "URL receiving alerts as JSON when the database forks or can't be verified")
+		slack := fs.String("slack", "", "Slack incoming webhook URL receiving alerts")
+		once := fs.Bool("once", false, "check the database once and exit")
+		output := outputFlag(fs)
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return errUsage
+		}
+
+		base := fs.Arg(0)
+		vkey := *key
+		if u, err := url.Parse(base); vkey == "" && err == nil && u.Host == "sum.golang.org" {
+			vkey = goSumDBKey
+		}
+		if vkey == "" {
+			fs.Usage()
+			return errUsage
+		}
+
+		opts := []monitor.Option{
+			monitor.WithInterval(*interval),
+			monitor.WithErrorHandler(func(err error) {
+				if *output == outputJSON {
+					_ = writeJSONLine(stdout, monitorEvent{Time: time.Now(), Event: "error", Error: err.Error()})
+					return
+				}
+				fmt.Fprintf(stdout, "%s error: %v\n", time.Now().Format(time.RFC3339), err)
+			}),
+			monitor.WithHeadHandler(func(t tlog.Tree) {
+				if *output == outputJSON {
+					event := monitorEvent{Time: time.Now(), Event: "head", TreeSize: t.N, Root: t.Hash.String()}
+					_ = writeJSONLine(stdout, event)
+					return
+				}
+				fmt.Fprintf(stdout, "%s tree size %d, root %s\n", time.Now().Format(time.RFC3339), t.N, t.Hash)
+			}),
+		}
+		switch {
+		case *state != "" && *goState:
+			fs.Usage()
+			return errUsage
+		case *state != "":
+			opts = append(opts, monitor.WithHeadStore(monitor.NewFileStore(*state)))
+		case *goState:
+			name, _, _ := strings.Cut(vkey, "+")
+			opts = append(opts, monitor.WithHeadStore(monitor.NewGoStore(monitor.GoSumDBDir(), name)))
+		}
+
+		var alerters []alert.Alerter
+		if *webhook != "" {
+			alerters = append(alerters, alert.Webhook(*webhook, nil))
+		}
+		if *slack != "" {
+			alerters = append(alerters, alert.Slack(*slack, nil))
+		}
+		if len(alerters) > 0 {
+			opts = append(opts, monitor.WithAlerter(alert.Multi(alerters...)))
+		}
+
+		m, err := monitor.New(base, vkey, opts...)
+		if err != nil {
+			return err
+		}
+
+		if *once {
+			_, err = m.Check(ctx)
+		} else {
+			err = m.Run(ctx)
+		}
+
+		var fork *monitor.ForkError
+		if errors.As(err, &fork) {
+			if *output == outputJSON {
+				event := monitorEvent{Time: time.Now(), Event: "fork", Old: string(fork.Old), New: string(fork.New)}
+				return errors.Join(err, writeJSONLine(stdout, event))
+			}
+			fmt.Fprintf(stdout, "Fork detected. Previously observed signed tree head:\n\n%s\n", fork.Old)
+			fmt.Fprintf(stdout, "Inconsistent signed tree head:\n\n%s\n", fork.New)
+			return err
+		}
+
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	}
+
+	return cmd
+}
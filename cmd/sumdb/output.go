@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// outputFormat is the format a command prints its results in, set with -output.
+type outputFormat string
+
+const (
+	// outputTable prints results for people to read.
+	outputTable outputFormat = "table"
+
+	// outputJSON prints results as a single JSON value (or, for commands reporting as they run, one per line), for
+	// scripts to parse. Progress messages are left out.
+	outputJSON outputFormat = "json"
+)
+
+// outputFlag defines the -output flag on fs, defaulting to outputTable.
+func outputFlag(fs *flag.FlagSet) *outputFormat {
+	f := outputTable
+	fs.Var(&f, "output", "`format` to print results in: table or json")
+	return &f
+}
+
+// String implements flag.Value.
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+// Set implements flag.Value.
+func (f *outputFormat) Set(s string) error {
+	switch v := outputFormat(s); v {
+	case outputTable, outputJSON:
+		*f = v
+		return nil
+	default:
+		return fmt.Errorf("must be %s or %s", outputTable, outputJSON)
+	}
+}
+
+// choices returns the values of the flag, for shell completion.
+func (f *outputFormat) choices() []string {
+	return []string{string(outputTable), string(outputJSON)}
+}
+
+// writeJSON writes v to w as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeJSONLine writes v to w as JSON on a single line, for commands reporting results as they run.
+func writeJSONLine(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
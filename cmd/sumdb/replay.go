@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+)
+
+// replayReport is the JSON output of replay, for a replay matching its recording. Err is the reproduced lookup error,
+// if any, and Methods the store operations performed (with -v).
+type replayReport struct {
+	Module     string    `json:"module"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Ops        int       `json:"operations"`
+	Methods    []string  `json:"methods,omitempty"`
+	Err        string    `json:"error,omitempty"`
+}
+
+func replayCommand() *command {
+	cmd := &command{
+		name:  "replay",
+		short: "Re-execute a recorded lookup bundle against an in-memory store",
+		usage: "replay [-v] [-output table|json] <bundle.json>",
+	}
+
+	cmd.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		verbose := fs.Bool("v", false, "print every store operation performed during the replay")
+		output := outputFlag(fs)
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return errUsage
+		}
+
+		bundle, err := readBundle(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		if *output == outputTable {
+			fmt.Fprintf(stdout, "Replaying %s (recorded %s)\n", bundle.Module, bundle.RecordedAt.Format(time.RFC3339))
+		}
+
+		got, err := sumdb.Replay(ctx, bundle)
+		if got != nil && *verbose && *output == outputTable {
+			for i, op := range got.Ops {
+				fmt.Fprintf(stdout, "  %3d %s\n", i, op.Method)
+			}
+		}
+
+		if errors.Is(err, sumdb.ErrReplayDiverged) {
+			return err
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to replay bundle: %w", err)
+		}
+
+		if *output == outputJSON {
+			report := replayReport{
+				Module:     bundle.Module.String(),
+				RecordedAt: bundle.RecordedAt,
+				Ops:        len(got.Ops),
+				Err:        got.Err,
+			}
+			if *verbose {
+				for _, op := range got.Ops {
+					report.Methods = append(report.Methods, op.Method)
+				}
+			}
+			return writeJSON(stdout, report)
+		}
+
+		if got.Err != "" {
+			fmt.Fprintf(stdout, "Reproduced lookup error: %s\n", got.Err)
+			return nil
+		}
+
+		fmt.Fprintf(stdout, "Replay matches recording (%d store operations)\n", len(got.Ops))
+		return nil
+	}
+
+	return cmd
+}
+
+func readBundle(path string) (*sumdb.ReplayBundle, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is provided by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	var b sumdb.ReplayBundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle: %s, %w", path, err)
+	}
+
+	return &b, nil
+}
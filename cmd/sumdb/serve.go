@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func serveCommand() *command {
+	cmd := &command{
+		name:  "serve",
+		short: "Run a sumdb server",
+		usage: "serve [-addr <addr>] [-key-file <file>] [-additional-key-file <file>] [-store <scheme>:<location>] " +
+			"[-upstream <url>] [-metrics-addr <addr>] [-maintenance-window HH:MM-HH:MM] [-shutdown-timeout <duration>]",
+	}
+
+	cmd.run = func(ctx context.Context, stdout io.Writer, args []string) error {
+		fs := newFlagSet(cmd)
+		addr := fs.String("addr", envOr("SUMDB_ADDR", ":8080"), "address to serve the checksum database on ($SUMDB_ADDR)")
+		keyFile := fs.String("key-file", os.Getenv("SUMDB_KEY_FILE"),
+			"file containing the signer key ($SUMDB_KEY_FILE, or the key itself in $SUMDB_KEY)")
+		additionalKeyFile := fs.String("additional-key-file", os.Getenv("SUMDB_ADDITIONAL_KEY_FILE"),
+			"file containing a second signer key tree heads are also signed with, e.g. during key rotations "+
+				"($SUMDB_ADDITIONAL_KEY_FILE)")
+		dsn := fs.String("store", envOr("SUMDB_STORE", "memory:"),
+			"store holding the log, e.g. sqlite:/var/lib/sumdb.db or postgres://db.example.com/sumdb ($SUMDB_STORE)")
+		upstream := fs.String("upstream", os.Getenv("SUMDB_UPSTREAM"),
+			"module proxy to fetch modules from (defaults to https://proxy.golang.org) ($SUMDB_UPSTREAM)")
+		metricsAddr := fs.String("metrics-addr", os.Getenv("SUMDB_METRICS_ADDR"),
+			"address to serve Prometheus metrics on at /metrics, if any ($SUMDB_METRICS_ADDR)")
+		window := fs.String("maintenance-window", os.Getenv("SUMDB_MAINTENANCE_WINDOW"),
+			"daily UTC window to run maintenance jobs in, e.g. 02:00-04:00 ($SUMDB_MAINTENANCE_WINDOW)")
+		recordFilter := fs.Int64("record-filter", 0,
+			"number of records to size a filter of existing records for, so lookups of new versions skip a query")
+		tileCache := fs.Int("tile-cache", 0, "bytes of memory to cache served tiles in, if any")
+		forwardHeaders := fs.String("forward-headers", os.Getenv("SUMDB_FORWARD_HEADERS"),
+			"comma-separated headers of lookup requests to forward to the upstream when fetching modules, e.g. "+
+				"Authorization ($SUMDB_FORWARD_HEADERS)")
+		logLevel := fs.String("log-level", envOr("SUMDB_LOG_LEVEL", "info"),
+			"minimum level of the events logged to stderr: debug, info, warn or error ($SUMDB_LOG_LEVEL)")
+		failback := fs.Int("upstream-failback", 0,
+			"number of consecutive failed upstream fetches after which cold lookups fail fast, if any")
+		failbackRetry := fs.Duration("upstream-failback-retry", 30*time.Second,
+			"how often to probe an upstream marked down by -upstream-failback")
+		proxyRetries := fs.Int("proxy-retries", 0,
+			"number of times to retry upstream proxy requests failing with network errors, 429 or 5xx responses")
+		proxyRetryMax := fs.Duration("proxy-retry-max", 10*time.Second,
+			"maximum backoff between -proxy-retries, and longest Retry-After honored")
+		upstreamRPS := fs.Float64("upstream-rps", 0,
+			"maximum number of modules fetched from the upstreams per second, if any")
+		upstreamBurst := fs.Int("upstream-burst", 10, "number of fetches allowed in a burst over -upstream-rps")
+		sthRefresh := fs.Duration("sth-refresh-interval", 0,
+			"how often to sign the current tree head ahead of requests, if at all")
+		shutdownTimeout := fs.Duration("shutdown-timeout", 30*time.Second, "how long to wait for requests on shutdown")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+
+		if fs.NArg() != 0 {
+			fs.Usage()
+			return errUsage
+		}
+
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+			return fmt.Errorf("invalid log level: %s", *logLevel)
+		}
+
+		skey, name, err := loadSignerKey(*keyFile)
+		if err != nil {
+			return err
+		}
+
+		store, err := openStore(ctx, *dsn)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = store.Close() }()
+
+		opts := []sumdb.Option{
+			sumdb.WithStore(store),
+			sumdb.WithLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))),
+		}
+		if *additionalKeyFile != "" {
+			additionalKey, additionalName, err := loadSignerKey(*additionalKeyFile)
+			if err != nil {
+				return err
+			}
+			if additionalName != name {
+				return fmt.Errorf("additional key is for %s, not %s", additionalName, name)
+			}
+			opts = append(opts, sumdb.WithAdditionalSigner(additionalKey))
+		}
+		if *upstream != "" {
+			u, err := url.Parse(*upstream)
+			if err != nil || u.Host == "" {
+				return fmt.Errorf("invalid upstream URL: %s", *upstream)
+			}
+			opts = append(opts, sumdb.WithUpstream(u))
+		}
+		if *window != "" {
+			opts = append(opts, sumdb.WithMaintenanceWindow(*window))
+		}
+		if *sthRefresh > 0 {
+			opts = append(opts, sumdb.WithSTHRefreshInterval(*sthRefresh))
+		}
+		if *recordFilter > 0 {
+			opts = append(opts, sumdb.WithRecordFilter(*recordFilter, 0.01))
+		}
+		if *tileCache > 0 {
+			opts = append(opts, sumdb.WithTileCache(*tileCache))
+		}
+		if *failback > 0 {
+			opts = append(opts, sumdb.WithUpstreamFailback(*failback, *failbackRetry))
+		}
+		if *proxyRetries > 0 {
+			opts = append(opts, sumdb.WithProxyRetry(*proxyRetries+1, 100*time.Millisecond, *proxyRetryMax))
+		}
+		if *upstreamRPS > 0 {
+			opts = append(opts, sumdb.WithUpstreamRateLimit(*upstreamRPS, *upstreamBurst))
+		}
+		if *forwardHeaders != "" {
+			names := strings.FieldsFunc(*forwardHeaders, func(r rune) bool { return r == ',' || r == ' ' })
+			opts = append(opts, sumdb.WithUpstreamIdentity(sumdb.ForwardHeaders(names...)))
+		}
+
+		db, err := sumdb.New(name, skey, opts...)
+		if err != nil {
+			return err
+		}
+		if *recordFilter > 0 {
+			if err := db.LoadRecordFilter(ctx); err != nil {
+				return err
+			}
+		}
+
+		handler := http.NewServeMux()
+		handler.Handle("/healthz", db.HealthHandler())
+		handler.Handle("/", db.Handler(sumdb.WithAccessLog(nil), sumdb.WithPanicRecovery(), sumdb.WithRequestMetrics()))
+		servers := []*http.Server{{Addr: *addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}}
+		if *metricsAddr != "" {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", db.MetricsHandler())
+			servers = append(servers, &http.Server{Addr: *metricsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second})
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() { _ = db.RunMaintenance(ctx) }()
+		if *sthRefresh > 0 {
+			go func() { _ = db.RunSTHRefresher(ctx) }()
+		}
+
+		fmt.Fprintf(stdout, "Serving %s (verifier key %s) on %s\n", name, db.VerifierKey(), *addr)
+		return serveHTTP(ctx, servers, *shutdownTimeout)
+	}
+
+	return cmd
+}
+
+// serveHTTP runs servers until ctx is done, then shuts them down gracefully, waiting up to timeout for in-flight
+// requests. If a server fails, the others are shut down and its error is returned.
+func serveHTTP(ctx context.Context, servers []*http.Server, timeout time.Duration) error {
+	listeners := make([]net.Listener, 0, len(servers))
+	defer func() {
+		for _, ln := range listeners {
+			_ = ln.Close()
+		}
+	}()
+
+	// Listening before serving reports unusable addresses before anything is served.
+	for _, srv := range servers {
+		ln, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %s, %w", srv.Addr, err)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	errc := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func() {
+			if err := srv.Serve(listeners[i]); !errors.Is(err, http.ErrServerClosed) {
+				errc <- fmt.Errorf("failed to serve: %s, %w", srv.Addr, err)
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errc:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	errs := []error{err}
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shut down: %s, %w", srv.Addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// loadSignerKey returns the signer key in the file at path, or in $SUMDB_KEY if path is empty, along with the name of
+// the server it signs for.
+func loadSignerKey(path string) (skey, name string, err error) {
+	skey = os.Getenv("SUMDB_KEY")
+	if path != "" {
+		data, err := os.ReadFile(path) // #nosec G304 -- path is provided by the operator
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read key: %w", err)
+		}
+		skey = string(data)
+	}
+
+	skey = strings.TrimSpace(skey)
+	if skey == "" {
+		return "", "", errors.New("no signer key: set -key-file or $SUMDB_KEY")
+	}
+
+	s, err := note.NewSigner(skey)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid signer key: %w", err)
+	}
+	return skey, s.Name(), nil
+}
+
+// envOr returns the value of the environment variable key, or def if it's empty.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
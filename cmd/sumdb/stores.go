@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/fsstore"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/pseudomuto/sumdb/store/postgres"
+	"github.com/pseudomuto/sumdb/store/snapshot"
+	"github.com/pseudomuto/sumdb/store/sqlite"
+)
+
+type (
+	// storeDriver opens stores for DSNs with a particular scheme.
+	storeDriver struct {
+		// open opens the store for the part of the DSN after the scheme (e.g. "/path/to/file" for "snapshot:/path/to/file").
+		open func(ctx context.Context, dsn string) (sumdb.Store, func() error, error)
+
+		// readOnly is set for stores that can't be written to.
+		readOnly bool
+	}
+
+	// leaser is implemented by stores that can hold their writer lock across transactions, such as sqlite.Store.
+	leaser interface {
+		Lease(ctx context.Context) (func() error, error)
+	}
+
+	// openedStore is a store opened from a DSN.
+	openedStore struct {
+		sumdb.Store
+		close    func() error
+		readOnly bool
+	}
+)
+
+// storeDrivers are the store backends that commands can open, by DSN scheme.
+var storeDrivers = map[string]storeDriver{
+	"fs":       {open: openFS},
+	"memory":   {open: openMemory},
+	"postgres": {open: openPostgres},
+	"snapshot": {readOnly: true, open: openSnapshot},
+	"sqlite":   {open: openSQLite},
+}
+
+// openStore opens the store for dsn, which has the form <scheme>:<location> (e.g. snapshot:/var/lib/sumdb.snap).
+func openStore(ctx context.Context, dsn string) (*openedStore, error) {
+	scheme, location, ok := strings.Cut(dsn, ":")
+	driver, known := storeDrivers[scheme]
+	if !ok || !known {
+		return nil, fmt.Errorf("unsupported store DSN %q: want one of %s followed by :<location>", dsn,
+			strings.Join(slices.Sorted(maps.Keys(storeDrivers)), ", "))
+	}
+
+	store, closeFn, err := driver.open(ctx, strings.TrimPrefix(location, "//"))
+	if err != nil {
+		return nil, err
+	}
+	return &openedStore{Store: store, close: closeFn, readOnly: driver.readOnly}, nil
+}
+
+// Close closes the store.
+func (s *openedStore) Close() error {
+	return s.close()
+}
+
+// lease keeps other processes from writing to the store until the returned function is called, if the store supports
+// it. Commands appending to a store should hold a lease, since the database may belong to a live server.
+func (s *openedStore) lease(ctx context.Context) (func() error, error) {
+	if l, ok := s.Store.(leaser); ok {
+		return l.Lease(ctx)
+	}
+	return func() error { return nil }, nil
+}
+
+// openFS opens a filesystem store in the directory dir.
+func openFS(_ context.Context, dir string) (sumdb.Store, func() error, error) {
+	store, err := fsstore.Open(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, store.Close, nil
+}
+
+// openMemory opens an in-memory store, which is saved to the file at path (if any) when it's closed.
+func openMemory(_ context.Context, path string) (sumdb.Store, func() error, error) {
+	if path == "" {
+		return memstore.New(), func() error { return nil }, nil
+	}
+
+	store, err := memstore.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, store.Close, nil
+}
+
+// openPostgres opens a PostgreSQL store. The location is the rest of a postgres:// connection URL.
+func openPostgres(ctx context.Context, location string) (sumdb.Store, func() error, error) {
+	store, err := postgres.Open(ctx, "postgres://"+location)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, store.Close, nil
+}
+
+func openSnapshot(_ context.Context, path string) (sumdb.Store, func() error, error) {
+	store, err := snapshot.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, store.Close, nil
+}
+
+// openSQLite opens a SQLite store with a writer lock, so that it's safe to use while a server writes to it.
+func openSQLite(ctx context.Context, path string) (sumdb.Store, func() error, error) {
+	store, err := sqlite.Open(ctx, path, sqlite.WithWriterLock())
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, store.Close, nil
+}
@@ -0,0 +1,127 @@
+package contentlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/tree"
+)
+
+type (
+	// namespaceStatus is the state of a namespace returned by the admin API.
+	namespaceStatus struct {
+		Name        string `json:"name"`
+		VerifierKey string `json:"verifier_key"`
+		TreeSize    int64  `json:"tree_size"`
+		RootHash    string `json:"root_hash"`
+	}
+
+	// appendRequest is the body of admin API appends. Content is the entry's text, lines ending in newlines.
+	appendRequest struct {
+		Key     string `json:"key"`
+		Content string `json:"content"`
+	}
+)
+
+// AdminHandler returns an HTTP handler for the admin API of the Set, authenticating requests with ids like the admin
+// API of a sumdb.SumDB (see sumdb.WithAdminIdentity), so that the same credentials and roles can be used for both:
+//
+//	GET  /namespaces                  the name, verifier key and tree of each namespace (viewer)
+//	POST /namespaces/{name}/entries   appends {"key": ..., "content": ...}, returning its {"id": ...} (operator)
+//
+// Appends that are refused by the namespace's policies are rejected with 403 Forbidden, and keys already logged with
+// different content with 409 Conflict. Without an extractor all requests are rejected.
+func (s *Set) AdminHandler(ids sumdb.IdentityExtractor) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /namespaces", requireRole(ids, sumdb.RoleViewer, http.HandlerFunc(s.serveNamespaces)))
+	mux.Handle("POST /namespaces/{name}/entries", requireRole(ids, sumdb.RoleOperator, http.HandlerFunc(s.serveAppend)))
+	return mux
+}
+
+func (s *Set) serveNamespaces(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]namespaceStatus, 0, len(s.names))
+	for _, name := range s.names {
+		l := s.logs[name]
+		size, err := l.store.TreeSize(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		hash, err := tree.TreeHashAt(r.Context(), l.store, size)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		statuses = append(statuses, namespaceStatus{
+			Name:        name,
+			VerifierKey: l.VerifierKey(),
+			TreeSize:    size,
+			RootHash:    hash.String(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Set) serveAppend(w http.ResponseWriter, r *http.Request) {
+	l := s.logs[r.PathValue("name")]
+	if l == nil {
+		http.Error(w, "unknown namespace", http.StatusNotFound)
+		return
+	}
+
+	var req appendRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*MaxContentSize)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	id, err := l.Append(r.Context(), req.Key, []byte(req.Content))
+	switch {
+	case errors.Is(err, ErrInvalidEntry):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrPolicyDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, map[string]int64{"id": id})
+	}
+}
+
+// requireRole authenticates the request with ids and ensures the caller has at least the given role.
+func requireRole(ids sumdb.IdentityExtractor, role sumdb.Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ids == nil {
+			http.Error(w, "admin API is not configured", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := ids.Identify(r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		if id.Role < role {
+			http.Error(w, fmt.Sprintf("requires %s role", role), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
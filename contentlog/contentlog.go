@@ -0,0 +1,324 @@
+// Package contentlog logs arbitrary content, such as container image digests or the hashes of internal build
+// artifacts, in a transparency log built from the same parts as the checksum database: the same Merkle tree, signed
+// tree heads, stores and tile protocol. Tools built for checksum databases, such as the monitor package or tile
+// snapshots, work with it unchanged. Module checksums are logged through sumdb.SumDB, which adds the module proxy
+// ingestion on top of the same parts.
+//
+// Each entry maps a key (e.g. "registry.example.com/app:v1.2.3") to content, lines of text such as a digest. Entries
+// are immutable: appending a key again returns its entry if the content is the same, and fails otherwise.
+//
+//	store, err := sqlite.Open(ctx, "/var/lib/artifacts/log.db")
+//	if err != nil { ... }
+//
+//	l, err := contentlog.New(skey, store)
+//	if err != nil { ... }
+//
+//	id, err := l.Append(ctx, "registry.example.com/app:v1.2.3", []byte("sha256:4a5e...\n"))
+//
+// Logs are kept in their own Store (e.g. their own SQLite database or PostgreSQL schema), which must not be shared with
+// a SumDB or another Log: each Store holds a single tree.
+//
+// A Set hosts the logs of several namespaces (e.g. "images" and "artifacts") in one process, each with its own key,
+// policies and store, behind shared HTTP handlers, metrics and admin API.
+package contentlog
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/signer"
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+const (
+	// MaxContentSize is the largest content that can be appended.
+	MaxContentSize = 64 << 10
+
+	// MaxKeySize is the length of the longest key that can be appended.
+	MaxKeySize = 1 << 10
+
+	// maxReadRecords is the largest number of records read at once, which is the width of a full data tile.
+	maxReadRecords = 1 << tree.TileHeight
+
+	// keyPath and keyVersion form the module path and version under which entries are stored, so that they can be
+	// kept in any sumdb.Store: stores key records on valid module paths and versions (see sumdb.EscapeModule). The
+	// key is encoded as the last element of the path.
+	keyPath    = "content.invalid/"
+	keyVersion = "v0.0.0"
+)
+
+var (
+	// ErrInvalidEntry is returned when appending an entry whose key or content can't be logged.
+	ErrInvalidEntry = errors.New("invalid entry")
+
+	// ErrConflict is returned when appending a key that was logged with different content.
+	ErrConflict = errors.New("key already logged with different content")
+
+	// keyEncoding encodes keys into valid module path elements.
+	keyEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+)
+
+type (
+	// Log is a transparency log of content entries. It's safe for concurrent use.
+	Log struct {
+		name     string
+		vkey     string
+		signer   note.Signer
+		store    sumdb.Store
+		locker   sumdb.Locker
+		policies []Policy
+
+		// metrics, when set, records appends under the namespace of a Set.
+		metrics   *setMetrics
+		namespace string
+
+		// mu serializes appends, since each entry's position in the tree depends on the tree size.
+		mu sync.Mutex
+	}
+
+	// Option customizes a Log.
+	Option func(*Log)
+)
+
+// New returns a Log kept in store whose tree heads are signed with the signer key skey. The log is named after the
+// key (e.g. "artifacts.example.com"), and verified with its verifier key.
+func New(skey string, store sumdb.Store, opts ...Option) (*Log, error) {
+	s, err := signer.NewSigner(skey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signer: %w", err)
+	}
+
+	vkey, err := signer.VerifierKey(skey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signer: %w", err)
+	}
+
+	l := &Log{name: s.Name(), vkey: vkey, signer: s, store: store}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l, nil
+}
+
+// WithLocker takes lk before appending entries, so that Logs sharing a Store (e.g. replicas behind a load balancer)
+// append one at a time. See sumdb.WithLocker.
+func WithLocker(lk sumdb.Locker) Option {
+	return func(l *Log) { l.locker = lk }
+}
+
+// Name returns the name of the log, which is the name of its key.
+func (l *Log) Name() string {
+	return l.name
+}
+
+// VerifierKey returns the verifier key of the log, which clients use to verify its signed tree heads.
+func (l *Log) VerifierKey() string {
+	return l.vkey
+}
+
+// Append logs content for key and returns the ID of its entry. key must be a single line of at most MaxKeySize bytes
+// of printable UTF-8, and content must be at most MaxContentSize bytes of lines of printable UTF-8, each ending in a
+// newline, without blank lines.
+//
+// Appending a key that's already logged returns its entry's ID if the content is the same, and an error wrapping
+// ErrConflict otherwise. New entries must be allowed by the log's policies (see WithPolicy).
+func (l *Log) Append(ctx context.Context, key string, content []byte) (_ int64, err error) {
+	start := time.Now()
+	existing := false
+	defer func() { l.observeAppend(existing, start, err) }()
+
+	if err := checkEntry(key, content); err != nil {
+		return 0, err
+	}
+	data := formatEntry(key, content)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.locker != nil {
+		unlock, err := l.locker.Lock(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to take append lock: %w", err)
+		}
+		defer func() { _ = unlock() }()
+	}
+
+	var id int64
+	err = withTx(ctx, l.store, func(store sumdb.Store) error {
+		var err error
+		if id, err = l.existing(ctx, store, key, data); err == nil || !errors.Is(err, sumdb.ErrNotFound) {
+			existing = err == nil
+			return err
+		}
+
+		if err := l.checkPolicies(ctx, key, content); err != nil {
+			return err
+		}
+
+		id, err = store.AddRecord(ctx, &sumdb.Record{Path: storedPath(key), Version: keyVersion, Data: data})
+		if err != nil {
+			return fmt.Errorf("failed to add entry: %s, %w", key, err)
+		}
+
+		if err := tree.AddRecord(ctx, store, id, data); err != nil {
+			return fmt.Errorf("failed to update tree hashes: %s, %w", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// existing returns the ID of the entry for key, checking that its data is data. It returns an error wrapping
+// sumdb.ErrNotFound if key isn't logged.
+func (l *Log) existing(ctx context.Context, store sumdb.Store, key string, data []byte) (int64, error) {
+	id, err := store.RecordID(ctx, storedPath(key), keyVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	recs, err := store.Records(ctx, id, 1)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read entry: %d, %w", id, err)
+	}
+	if len(recs) != 1 || string(recs[0].Data) != string(data) {
+		return 0, fmt.Errorf("%w: %s", ErrConflict, key)
+	}
+	return id, nil
+}
+
+// Lookup returns the ID and content of the entry for key. It returns an error wrapping sumdb.ErrNotFound if key isn't
+// logged.
+func (l *Log) Lookup(ctx context.Context, key string) (int64, []byte, error) {
+	id, err := l.store.RecordID(ctx, storedPath(key), keyVersion)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to find entry: %s, %w", key, err)
+	}
+
+	data, err := l.readEntry(ctx, id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	_, content, _ := ParseEntry(data)
+	return id, content, nil
+}
+
+// Signed returns the signed tree head of the log's current tree.
+func (l *Log) Signed(ctx context.Context) ([]byte, error) {
+	size, err := l.store.TreeSize(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree size: %w", err)
+	}
+
+	// The hash is computed at the size read above, since entries may be appended in the meantime.
+	hash, err := tree.TreeHashAt(ctx, l.store, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute tree hash: %w", err)
+	}
+
+	signed, err := signer.SignTreeHead(l.signer, tlog.Tree{N: size, Hash: hash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign tree head: %w", err)
+	}
+	return signed, nil
+}
+
+// ReadRecords returns the data of the entries with IDs in [id, id+n), at most a full data tile's worth. See
+// ParseEntry.
+func (l *Log) ReadRecords(ctx context.Context, id, n int64) ([][]byte, error) {
+	if n > maxReadRecords {
+		return nil, fmt.Errorf("%w: %d records, max %d", sumdb.ErrReadLimitExceeded, n, maxReadRecords)
+	}
+
+	recs, err := l.store.Records(ctx, id, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get records: [%d, %d), %w", id, n, err)
+	}
+
+	data := make([][]byte, len(recs))
+	for i := range recs {
+		data[i] = recs[i].Data
+	}
+	return data, nil
+}
+
+// readEntry returns the data of the entry id.
+func (l *Log) readEntry(ctx context.Context, id int64) ([]byte, error) {
+	data, err := l.ReadRecords(ctx, id, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 1 {
+		return nil, fmt.Errorf("%w: entry %d", sumdb.ErrNotFound, id)
+	}
+	return data[0], nil
+}
+
+// ParseEntry returns the key and content of an entry's data, as read by ReadRecords or served in data tiles and
+// lookups: the key on the first line, followed by the content.
+func ParseEntry(data []byte) (string, []byte, bool) {
+	key, content, ok := strings.Cut(string(data), "\n")
+	if !ok || content == "" {
+		return "", nil, false
+	}
+	return key, []byte(content), true
+}
+
+// formatEntry returns the data of the entry for key and content, which is what's hashed into the tree: binding the
+// key to the content, so that proving an entry's inclusion proves what was logged for the key.
+func formatEntry(key string, content []byte) []byte {
+	data := make([]byte, 0, len(key)+1+len(content))
+	data = append(append(data, key...), '\n')
+	return append(data, content...)
+}
+
+// checkEntry checks that key and content can be logged.
+func checkEntry(key string, content []byte) error {
+	switch {
+	case key == "" || len(key) > MaxKeySize || !isPrintable(key):
+		return fmt.Errorf("%w: key must be a single line of 1 to %d printable bytes", ErrInvalidEntry, MaxKeySize)
+	case len(content) == 0 || len(content) > MaxContentSize:
+		return fmt.Errorf("%w: content must have 1 to %d bytes", ErrInvalidEntry, MaxContentSize)
+	}
+
+	for line := range strings.Lines(string(content)) {
+		text, ok := strings.CutSuffix(line, "\n")
+		if !ok || text == "" || !isPrintable(text) {
+			return fmt.Errorf("%w: content must be lines of printable text, each ending in a newline", ErrInvalidEntry)
+		}
+	}
+	return nil
+}
+
+// isPrintable reports whether s is valid UTF-8 without control characters.
+func isPrintable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	return !strings.ContainsFunc(s, func(r rune) bool { return r < 0x20 || r == 0x7f })
+}
+
+// storedPath returns the module path under which the entry for key is stored.
+func storedPath(key string) string {
+	return keyPath + strings.ToLower(keyEncoding.EncodeToString([]byte(key)))
+}
+
+// withTx executes fn within a transaction if store supports transactions.
+func withTx(ctx context.Context, store sumdb.Store, fn func(sumdb.Store) error) error {
+	if txs, ok := store.(sumdb.TxStore); ok {
+		return txs.WithTx(ctx, fn)
+	}
+	return fn(store)
+}
@@ -0,0 +1,191 @@
+package contentlog_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pseudomuto/sumdb"
+	. "github.com/pseudomuto/sumdb/contentlog"
+	"github.com/pseudomuto/sumdb/monitor"
+	"github.com/pseudomuto/sumdb/store/sqlite"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestLog_Append(t *testing.T) {
+	l, _ := newTestLog(t)
+
+	id, err := l.Append(t.Context(), "registry.example.com/app:v1.2.3", []byte("sha256:4a5e\n"))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), id)
+
+	id, err = l.Append(t.Context(), "registry.example.com/app:v1.2.4", []byte("sha256:5b6f\nsigned-by: ci\n"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), id)
+
+	t.Run("lookup", func(t *testing.T) {
+		id, content, err := l.Lookup(t.Context(), "registry.example.com/app:v1.2.4")
+		require.NoError(t, err)
+		require.Equal(t, int64(1), id)
+		require.Equal(t, "sha256:5b6f\nsigned-by: ci\n", string(content))
+
+		_, _, err = l.Lookup(t.Context(), "registry.example.com/app:v9")
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+	})
+
+	t.Run("entries are immutable", func(t *testing.T) {
+		id, err := l.Append(t.Context(), "registry.example.com/app:v1.2.3", []byte("sha256:4a5e\n"))
+		require.NoError(t, err)
+		require.Equal(t, int64(0), id)
+
+		_, err = l.Append(t.Context(), "registry.example.com/app:v1.2.3", []byte("sha256:ffff\n"))
+		require.ErrorIs(t, err, ErrConflict)
+	})
+
+	t.Run("invalid entries", func(t *testing.T) {
+		tests := map[string]struct {
+			key     string
+			content string
+		}{
+			"empty key":          {key: "", content: "a\n"},
+			"multi-line key":     {key: "a\nb", content: "a\n"},
+			"long key":           {key: strings.Repeat("k", MaxKeySize+1), content: "a\n"},
+			"empty content":      {key: "k", content: ""},
+			"no final newline":   {key: "k", content: "a"},
+			"blank line":         {key: "k", content: "a\n\nb\n"},
+			"control characters": {key: "k", content: "a\tb\n"},
+			"long content":       {key: "k", content: strings.Repeat("a", MaxContentSize) + "\n"},
+		}
+
+		for name, tt := range tests {
+			_, err := l.Append(t.Context(), tt.key, []byte(tt.content))
+			require.ErrorIs(t, err, ErrInvalidEntry, name)
+		}
+
+		// The longest keys can be stored.
+		_, err := l.Append(t.Context(), strings.Repeat("K", MaxKeySize), []byte("a\n"))
+		require.NoError(t, err)
+	})
+}
+
+func TestLog_Handler(t *testing.T) {
+	l, vkey := newTestLog(t)
+	for i := range 300 {
+		_, err := l.Append(t.Context(), fmt.Sprintf("artifact/%d", i), fmt.Appendf(nil, "sha256:%064x\n", i))
+		require.NoError(t, err)
+	}
+
+	srv := httptest.NewServer(l.Handler())
+	t.Cleanup(srv.Close)
+
+	verifier, err := note.NewVerifier(vkey)
+	require.NoError(t, err)
+
+	t.Run("lookup", func(t *testing.T) {
+		msg := get(t, srv.URL+"/lookup/"+url.PathEscape("artifact/260"), http.StatusOK)
+
+		id, data, signed, err := tlog.ParseRecord(msg)
+		require.NoError(t, err)
+		require.Equal(t, int64(260), id)
+
+		key, content, ok := ParseEntry(data)
+		require.True(t, ok)
+		require.Equal(t, "artifact/260", key)
+		require.Equal(t, fmt.Sprintf("sha256:%064x\n", 260), string(content))
+
+		// The entry is proven to be in the signed tree from the tiles, as checksum database clients do.
+		n, err := note.Open(signed, note.VerifierList(verifier))
+		require.NoError(t, err)
+		tree, err := tlog.ParseTree([]byte(n.Text))
+		require.NoError(t, err)
+
+		hashes, err := tlog.TileHashReader(tree, &tileReader{t: t, url: srv.URL}).ReadHashes(
+			[]int64{tlog.StoredHashIndex(0, id)})
+		require.NoError(t, err)
+		require.Equal(t, tlog.RecordHash(data), hashes[0])
+
+		get(t, srv.URL+"/lookup/missing", http.StatusNotFound)
+	})
+
+	t.Run("tiles", func(t *testing.T) {
+		data := get(t, srv.URL+"/tile/8/data/001.p/44", http.StatusOK)
+		entries := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n\n")
+		require.Len(t, entries, 44)
+		require.True(t, strings.HasPrefix(entries[0], "artifact/256\n"))
+
+		// Tiles beyond the tree aren't served.
+		get(t, srv.URL+"/tile/8/data/001.p/45", http.StatusNotFound)
+		get(t, srv.URL+"/tile/8/1/000.p/2", http.StatusNotFound)
+		get(t, srv.URL+"/tile/8/1/000.p/1", http.StatusOK)
+	})
+
+	t.Run("monitors", func(t *testing.T) {
+		m, err := monitor.New(srv.URL, vkey)
+		require.NoError(t, err)
+
+		tree, err := m.Check(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(300), tree.N)
+
+		_, err = l.Append(t.Context(), "artifact/300", []byte("sha256:0\n"))
+		require.NoError(t, err)
+
+		tree, err = m.Check(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(301), tree.N)
+	})
+}
+
+func newTestLog(t *testing.T) (*Log, string) {
+	t.Helper()
+
+	store, err := sqlite.Open(t.Context(), filepath.Join(t.TempDir(), "log.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	skey, vkey, err := sumdb.GenerateKeys("artifacts.example.com")
+	require.NoError(t, err)
+
+	l, err := New(skey, store)
+	require.NoError(t, err)
+	require.Equal(t, "artifacts.example.com", l.Name())
+	return l, vkey
+}
+
+func get(t *testing.T, url string, status int) []byte {
+	t.Helper()
+
+	resp, err := http.Get(url) // #nosec G107 -- test server
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, status, resp.StatusCode, string(body))
+	return body
+}
+
+// tileReader is a tlog.TileReader reading tiles from a Log's handler.
+type tileReader struct {
+	t   *testing.T
+	url string
+}
+
+func (r *tileReader) Height() int { return 8 }
+
+func (r *tileReader) ReadTiles(tiles []tlog.Tile) ([][]byte, error) {
+	data := make([][]byte, len(tiles))
+	for i, tile := range tiles {
+		data[i] = get(r.t, r.url+"/"+tile.Path(), http.StatusOK)
+	}
+	return data, nil
+}
+
+func (r *tileReader) SaveTiles([]tlog.Tile, [][]byte) {}
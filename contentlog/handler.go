@@ -0,0 +1,164 @@
+package contentlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// Handler returns an HTTP handler serving the log with the checksum database protocol, so that it can be verified by
+// the same clients and monitors:
+//
+//	GET /latest        the signed tree head
+//	GET /lookup/{key}  the entry for the (URL path escaped) key, followed by a signed tree head including it
+//	GET /tile/...      hash and data tiles
+//
+// Lookup responses are formatted like the checksum database's (see tlog.ParseRecord): the entry's ID, its data (see
+// ParseEntry) and a blank line, followed by the signed tree head. Entries are appended with Append, not over HTTP.
+func (l *Log) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch path := r.URL.EscapedPath(); {
+		case path == "/latest":
+			l.serveLatest(w, r)
+		case strings.HasPrefix(path, "/lookup/"):
+			l.serveLookup(w, r, strings.TrimPrefix(path, "/lookup/"))
+		case strings.HasPrefix(path, "/tile/"):
+			l.serveTile(w, r, strings.TrimPrefix(path, "/"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func (l *Log) serveLatest(w http.ResponseWriter, r *http.Request) {
+	signed, err := l.Signed(r.Context())
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	_, _ = w.Write(signed)
+}
+
+func (l *Log) serveLookup(w http.ResponseWriter, r *http.Request, escaped string) {
+	key, err := url.PathUnescape(escaped)
+	if err != nil {
+		http.Error(w, "invalid key escaping", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := l.lookupMessage(r.Context(), key)
+	l.observeLookup(err)
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	_, _ = w.Write(msg)
+}
+
+// lookupMessage returns the lookup response for key: the ID and data of its entry, followed by a signed tree head.
+func (l *Log) lookupMessage(ctx context.Context, key string) ([]byte, error) {
+	id, err := l.store.RecordID(ctx, storedPath(key), keyVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := l.readEntry(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The tree head includes the entry, since it was read after it.
+	signed, err := l.Signed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := strconv.AppendInt(nil, id, 10)
+	msg = append(append(msg, '\n'), data...)
+	return append(append(msg, '\n'), signed...), nil
+}
+
+// serveTile serves the hash and data tiles of the current tree.
+func (l *Log) serveTile(w http.ResponseWriter, r *http.Request, path string) {
+	t, err := tlog.ParseTilePath(path)
+	if err != nil || t.H != tree.TileHeight {
+		http.Error(w, "invalid tile path", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	size, err := l.store.TreeSize(ctx)
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	// Tiles must be within the tree: at level L, there's a hash for every 2^(L*H) records.
+	width := size
+	if t.L > 0 {
+		width = size >> (t.L * t.H)
+	}
+	if t.N<<t.H+int64(t.W) > width {
+		http.NotFound(w, r)
+		return
+	}
+
+	var data []byte
+	if t.L == -1 {
+		data, err = l.readDataTile(r, t)
+	} else {
+		data, err = tree.ReadTile(ctx, l.store, t)
+	}
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(data)
+}
+
+// readDataTile returns the data tile t: the data of its entries, each followed by a blank line.
+func (l *Log) readDataTile(r *http.Request, t tlog.Tile) ([]byte, error) {
+	records, err := l.ReadRecords(r.Context(), t.N<<t.H, int64(t.W))
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != t.W {
+		return nil, fmt.Errorf("invalid record count returned by ReadRecords: %d, want %d", len(records), t.W)
+	}
+
+	var data []byte
+	for _, rec := range records {
+		data = append(append(data, rec...), '\n')
+	}
+	return data, nil
+}
+
+func reportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sumdb.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, sumdb.ErrReadLimitExceeded):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,84 @@
+package contentlog
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/metrics"
+)
+
+// Append and lookup outcomes, used as the outcome labels of contentlog_appends_total and contentlog_lookups_total.
+const (
+	outcomeFound    = "found"
+	outcomeNotFound = "not_found"
+
+	outcomeAppended = "appended"
+	outcomeExisting = "existing"
+	outcomeInvalid  = "invalid"
+	outcomeDenied   = "denied"
+	outcomeConflict = "conflict"
+	outcomeError    = "error"
+)
+
+// setMetrics are the metrics collected by the logs of a Set, labeled by namespace.
+type setMetrics struct {
+	registry *metrics.Registry
+
+	appends        *metrics.CounterVec
+	appendDuration *metrics.HistogramVec
+	lookups        *metrics.CounterVec
+}
+
+func newSetMetrics() *setMetrics {
+	r := metrics.NewRegistry()
+	return &setMetrics{
+		registry: r,
+		appends: r.Counter("contentlog_appends_total",
+			"Appends by namespace and outcome.", "namespace", "outcome"),
+		appendDuration: r.Histogram("contentlog_append_duration_seconds",
+			"Latency of appends by namespace.", metrics.DefBuckets, "namespace"),
+		lookups: r.Counter("contentlog_lookups_total",
+			"Lookups served by namespace and outcome.", "namespace", "outcome"),
+	}
+}
+
+// observeAppend records an append that started at start. existing reports whether the entry was already logged.
+func (l *Log) observeAppend(existing bool, start time.Time, err error) {
+	if l.metrics == nil {
+		return
+	}
+
+	outcome := outcomeAppended
+	switch {
+	case existing:
+		outcome = outcomeExisting
+	case errors.Is(err, ErrInvalidEntry):
+		outcome = outcomeInvalid
+	case errors.Is(err, ErrPolicyDenied):
+		outcome = outcomeDenied
+	case errors.Is(err, ErrConflict):
+		outcome = outcomeConflict
+	case err != nil:
+		outcome = outcomeError
+	}
+
+	l.metrics.appends.With(l.namespace, outcome).Inc()
+	l.metrics.appendDuration.With(l.namespace).Observe(time.Since(start).Seconds())
+}
+
+// observeLookup records a lookup served by the log's Handler.
+func (l *Log) observeLookup(err error) {
+	if l.metrics == nil {
+		return
+	}
+
+	outcome := outcomeFound
+	switch {
+	case errors.Is(err, sumdb.ErrNotFound):
+		outcome = outcomeNotFound
+	case err != nil:
+		outcome = outcomeError
+	}
+	l.metrics.lookups.With(l.namespace, outcome).Inc()
+}
@@ -0,0 +1,42 @@
+package contentlog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pseudomuto/sumdb"
+	"golang.org/x/mod/module"
+)
+
+// ErrPolicyDenied is returned by Append when a policy refuses an entry.
+var ErrPolicyDenied = sumdb.ErrPolicyDenied
+
+// Policy decides whether an entry may be appended to a log, returning an error wrapping ErrPolicyDenied if it must
+// not. Policies only apply to new entries: appending an existing entry again always succeeds. See WithPolicy.
+type Policy func(ctx context.Context, key string, content []byte) error
+
+// WithPolicy checks every new entry against p before it's appended. Policies are checked in the order they're given.
+func WithPolicy(p Policy) Option {
+	return func(l *Log) { l.policies = append(l.policies, p) }
+}
+
+// AllowKeys is a Policy only allowing keys matching pattern, a comma-separated list of glob patterns matched against
+// slash-separated key prefixes, using the same syntax as GOPRIVATE (e.g. "registry.example.com/*,ci.example.com").
+func AllowKeys(pattern string) Policy {
+	return func(_ context.Context, key string, _ []byte) error {
+		if !module.MatchPrefixPatterns(pattern, key) {
+			return fmt.Errorf("%w: %s doesn't match %s", ErrPolicyDenied, key, pattern)
+		}
+		return nil
+	}
+}
+
+// checkPolicies returns an error wrapping ErrPolicyDenied if a policy refuses the entry for key and content.
+func (l *Log) checkPolicies(ctx context.Context, key string, content []byte) error {
+	for _, p := range l.policies {
+		if err := p(ctx, key, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
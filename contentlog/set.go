@@ -0,0 +1,157 @@
+package contentlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+
+	"github.com/pseudomuto/sumdb"
+)
+
+// ErrInvalidNamespace is returned by NewSet when a namespace has an invalid or duplicate name or store prefix.
+var ErrInvalidNamespace = errors.New("invalid namespace")
+
+// namespaceName matches valid namespace names and store prefixes, which are used in URL paths, metric labels and file
+// or schema names.
+var namespaceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+type (
+	// Namespace configures one of the logs of a Set.
+	Namespace struct {
+		// Name identifies the namespace in URLs and metrics (e.g. "images"). It must be lower-case letters, digits,
+		// hyphens and underscores.
+		Name string
+
+		// SignerKey is the note signer key the log's tree heads are signed with. Each namespace should have its own, so
+		// that clients trusting one log don't implicitly trust another.
+		SignerKey string
+
+		// StorePrefix is passed to the Set's StoreFunc to open the namespace's store. Defaults to Name.
+		StorePrefix string
+
+		// Policies are checked before new entries are appended. See WithPolicy.
+		Policies []Policy
+
+		// Locker, when set, serializes appends across processes sharing the namespace's store. See WithLocker.
+		Locker sumdb.Locker
+	}
+
+	// StoreFunc opens the store of a namespace, given its store prefix: e.g. a SQLite database named after it, or a
+	// PostgreSQL connection whose search_path is a schema named after it. Each prefix must map to a separate store,
+	// since a store holds a single tree.
+	StoreFunc func(ctx context.Context, prefix string) (sumdb.Store, error)
+
+	// Set hosts the logs of several namespaces in a single process, each with its own key, policies and store, behind
+	// shared HTTP handlers and metrics. It's safe for concurrent use.
+	Set struct {
+		names   []string
+		logs    map[string]*Log
+		stores  []sumdb.Store
+		metrics *setMetrics
+	}
+)
+
+// NewSet opens the store of each namespace with open and returns a Set of their logs. It returns an error wrapping
+// ErrInvalidNamespace if a namespace's name or store prefix is invalid or used by another namespace. Stores that
+// implement io.Closer are closed by Close.
+func NewSet(ctx context.Context, open StoreFunc, namespaces ...Namespace) (*Set, error) {
+	s := &Set{logs: make(map[string]*Log), metrics: newSetMetrics()}
+	if err := s.open(ctx, open, namespaces); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Set) open(ctx context.Context, open StoreFunc, namespaces []Namespace) error {
+	prefixes := make(map[string]bool)
+	for _, ns := range namespaces {
+		prefix := ns.StorePrefix
+		if prefix == "" {
+			prefix = ns.Name
+		}
+
+		switch {
+		case !namespaceName.MatchString(ns.Name):
+			return fmt.Errorf("%w: name %q", ErrInvalidNamespace, ns.Name)
+		case !namespaceName.MatchString(prefix):
+			return fmt.Errorf("%w: %s: store prefix %q", ErrInvalidNamespace, ns.Name, prefix)
+		case s.logs[ns.Name] != nil:
+			return fmt.Errorf("%w: %s: duplicate name", ErrInvalidNamespace, ns.Name)
+		case prefixes[prefix]:
+			return fmt.Errorf("%w: %s: duplicate store prefix %q", ErrInvalidNamespace, ns.Name, prefix)
+		}
+		prefixes[prefix] = true
+
+		store, err := open(ctx, prefix)
+		if err != nil {
+			return fmt.Errorf("failed to open store: %s, %w", ns.Name, err)
+		}
+		s.stores = append(s.stores, store)
+
+		opts := []Option{WithLocker(ns.Locker)}
+		for _, p := range ns.Policies {
+			opts = append(opts, WithPolicy(p))
+		}
+
+		l, err := New(ns.SignerKey, store, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to create log: %s, %w", ns.Name, err)
+		}
+		l.metrics, l.namespace = s.metrics, ns.Name
+
+		s.names = append(s.names, ns.Name)
+		s.logs[ns.Name] = l
+	}
+
+	slices.Sort(s.names)
+	return nil
+}
+
+// Names returns the names of the Set's namespaces, in lexical order.
+func (s *Set) Names() []string {
+	return slices.Clone(s.names)
+}
+
+// Log returns the log of the named namespace, or nil if there's no such namespace.
+func (s *Set) Log(name string) *Log {
+	return s.logs[name]
+}
+
+// Handler returns an HTTP handler serving each namespace's log (see Log.Handler) under its name, e.g.
+// /images/latest and /images/lookup/{key}.
+func (s *Set) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for name, l := range s.logs {
+		mux.Handle("/"+name+"/", http.StripPrefix("/"+name, l.Handler()))
+	}
+	return mux
+}
+
+// MetricsHandler returns an HTTP handler serving the metrics of every namespace in the Prometheus text format, for
+// mounting at e.g. /metrics:
+//
+//	contentlog_appends_total{namespace, outcome}       appends by outcome
+//	contentlog_append_duration_seconds{namespace}      latency of appends
+//	contentlog_lookups_total{namespace, outcome}       lookups served by Handler, by outcome
+//
+// Append outcomes are "appended", "existing" (the entry was already logged), "invalid", "denied" (by policy),
+// "conflict" and "error". Lookup outcomes are "found", "not_found" and "error".
+func (s *Set) MetricsHandler() http.Handler {
+	return s.metrics.registry
+}
+
+// Close closes the namespaces' stores that implement io.Closer. The Set must not be used afterwards.
+func (s *Set) Close() error {
+	var errs []error
+	for _, store := range s.stores {
+		if c, ok := store.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
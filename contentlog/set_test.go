@@ -0,0 +1,224 @@
+package contentlog_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pseudomuto/sumdb"
+	. "github.com/pseudomuto/sumdb/contentlog"
+	"github.com/pseudomuto/sumdb/monitor"
+	"github.com/pseudomuto/sumdb/store/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet(t *testing.T) {
+	imagesKey, imagesVkey, err := sumdb.GenerateKeys("images.example.com")
+	require.NoError(t, err)
+	artifactsKey, artifactsVkey, err := sumdb.GenerateKeys("artifacts.example.com")
+	require.NoError(t, err)
+
+	set := newTestSet(t,
+		Namespace{
+			Name:      "images",
+			SignerKey: imagesKey,
+			Policies:  []Policy{AllowKeys("registry.example.com")},
+		},
+		Namespace{Name: "artifacts", SignerKey: artifactsKey, StorePrefix: "build_artifacts"},
+	)
+	require.Equal(t, []string{"artifacts", "images"}, set.Names())
+	require.Nil(t, set.Log("missing"))
+
+	images := set.Log("images")
+	_, err = images.Append(t.Context(), "registry.example.com/app:v1", []byte("sha256:1\n"))
+	require.NoError(t, err)
+	_, err = images.Append(t.Context(), "registry.example.com/app:v1", []byte("sha256:1\n"))
+	require.NoError(t, err)
+	_, err = images.Append(t.Context(), "docker.io/app:v1", []byte("sha256:2\n"))
+	require.ErrorIs(t, err, ErrPolicyDenied)
+
+	// Each namespace has its own tree and key.
+	artifacts := set.Log("artifacts")
+	for _, key := range []string{"a", "b"} {
+		_, err = artifacts.Append(t.Context(), key, []byte("sha256:"+key+"\n"))
+		require.NoError(t, err)
+	}
+
+	srv := httptest.NewServer(set.Handler())
+	t.Cleanup(srv.Close)
+
+	for ns, want := range map[string]struct {
+		vkey string
+		size int64
+	}{
+		"images":    {vkey: imagesVkey, size: 1},
+		"artifacts": {vkey: artifactsVkey, size: 2},
+	} {
+		m, err := monitor.New(srv.URL+"/"+ns, want.vkey)
+		require.NoError(t, err)
+
+		tree, err := m.Check(t.Context())
+		require.NoError(t, err, ns)
+		require.Equal(t, want.size, tree.N, ns)
+	}
+
+	get(t, srv.URL+"/artifacts/lookup/b", http.StatusOK)
+	get(t, srv.URL+"/images/lookup/b", http.StatusNotFound)
+	get(t, srv.URL+"/other/latest", http.StatusNotFound)
+
+	t.Run("metrics", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		set.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		body := rec.Body.String()
+		for _, line := range []string{
+			`contentlog_appends_total{namespace="images",outcome="appended"} 1`,
+			`contentlog_appends_total{namespace="images",outcome="existing"} 1`,
+			`contentlog_appends_total{namespace="images",outcome="denied"} 1`,
+			`contentlog_appends_total{namespace="artifacts",outcome="appended"} 2`,
+			`contentlog_lookups_total{namespace="artifacts",outcome="found"} 1`,
+			`contentlog_lookups_total{namespace="images",outcome="not_found"} 1`,
+		} {
+			require.Contains(t, body, line)
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		admin := set.AdminHandler(sumdb.BearerIdentity(func(_ context.Context, token string) (sumdb.Identity, error) {
+			switch token {
+			case "viewer":
+				return sumdb.Identity{Subject: "alice", Role: sumdb.RoleViewer}, nil
+			case "operator":
+				return sumdb.Identity{Subject: "bob", Role: sumdb.RoleOperator}, nil
+			}
+			return sumdb.Identity{}, sumdb.ErrUnauthenticated
+		}))
+
+		do := func(method, path, token, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			admin.ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := do(http.MethodGet, "/namespaces", "viewer", "")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var statuses []struct {
+			Name        string `json:"name"`
+			VerifierKey string `json:"verifier_key"`
+			TreeSize    int64  `json:"tree_size"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+		require.Len(t, statuses, 2)
+		require.Equal(t, "artifacts", statuses[0].Name)
+		require.Equal(t, artifactsVkey, statuses[0].VerifierKey)
+		require.Equal(t, int64(2), statuses[0].TreeSize)
+
+		tests := map[string]struct {
+			token  string
+			path   string
+			body   string
+			status int
+		}{
+			"appends": {
+				token:  "operator",
+				path:   "/namespaces/artifacts/entries",
+				body:   `{"key": "c", "content": "sha256:c\n"}`,
+				status: http.StatusOK,
+			},
+			"requires operators": {
+				token:  "viewer",
+				path:   "/namespaces/artifacts/entries",
+				body:   `{"key": "d", "content": "sha256:d\n"}`,
+				status: http.StatusForbidden,
+			},
+			"unauthenticated": {
+				token:  "bogus",
+				path:   "/namespaces/artifacts/entries",
+				body:   `{"key": "d", "content": "sha256:d\n"}`,
+				status: http.StatusUnauthorized,
+			},
+			"unknown namespace": {
+				token:  "operator",
+				path:   "/namespaces/other/entries",
+				body:   `{"key": "d", "content": "sha256:d\n"}`,
+				status: http.StatusNotFound,
+			},
+			"invalid entry": {
+				token:  "operator",
+				path:   "/namespaces/artifacts/entries",
+				body:   `{"key": "d", "content": "sha256:d"}`,
+				status: http.StatusBadRequest,
+			},
+			"denied": {
+				token:  "operator",
+				path:   "/namespaces/images/entries",
+				body:   `{"key": "docker.io/app:v1", "content": "sha256:d\n"}`,
+				status: http.StatusForbidden,
+			},
+			"conflict": {
+				token:  "operator",
+				path:   "/namespaces/artifacts/entries",
+				body:   `{"key": "a", "content": "sha256:d\n"}`,
+				status: http.StatusConflict,
+			},
+		}
+
+		for name, tt := range tests {
+			t.Run(name, func(t *testing.T) {
+				rec := do(http.MethodPost, tt.path, tt.token, tt.body)
+				require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			})
+		}
+
+		_, content, err := artifacts.Lookup(t.Context(), "c")
+		require.NoError(t, err)
+		require.Equal(t, "sha256:c\n", string(content))
+	})
+}
+
+func TestNewSet_InvalidNamespaces(t *testing.T) {
+	skey, _, err := sumdb.GenerateKeys("log.example.com")
+	require.NoError(t, err)
+
+	tests := map[string][]Namespace{
+		"empty name":       {{SignerKey: skey}},
+		"invalid name":     {{Name: "Images/v1", SignerKey: skey}},
+		"invalid prefix":   {{Name: "images", StorePrefix: "../images", SignerKey: skey}},
+		"duplicate name":   {{Name: "images", SignerKey: skey}, {Name: "images", StorePrefix: "x", SignerKey: skey}},
+		"duplicate prefix": {{Name: "images", SignerKey: skey}, {Name: "artifacts", StorePrefix: "images", SignerKey: skey}},
+	}
+
+	for name, namespaces := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewSet(t.Context(), openStore(t), namespaces...)
+			require.ErrorIs(t, err, ErrInvalidNamespace)
+		})
+	}
+
+	_, err = NewSet(t.Context(), openStore(t), Namespace{Name: "images", SignerKey: "bogus"})
+	require.ErrorContains(t, err, "failed to create log: images")
+}
+
+func newTestSet(t *testing.T, namespaces ...Namespace) *Set {
+	t.Helper()
+
+	set, err := NewSet(t.Context(), openStore(t), namespaces...)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, set.Close()) })
+	return set
+}
+
+// openStore returns a StoreFunc opening a SQLite database per store prefix in a temporary directory.
+func openStore(t *testing.T) StoreFunc {
+	dir := t.TempDir()
+	return func(ctx context.Context, prefix string) (sumdb.Store, error) {
+		return sqlite.Open(ctx, filepath.Join(dir, prefix+".db"))
+	}
+}
@@ -0,0 +1,50 @@
+package sumdb
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// corsMaxAge is how long browsers may cache the result of a preflight request.
+const corsMaxAge = 10 * time.Minute
+
+// cors adds CORS headers to responses for the origins configured with WithCORS, allowing the given methods.
+// Preflight requests from allowed origins are answered directly.
+func (s *SumDB) cors(methods string, next http.Handler) http.Handler {
+	if len(s.corsOrigins) == 0 {
+		return next
+	}
+
+	wildcard := slices.Contains(s.corsOrigins, "*")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" || (!wildcard && !slices.Contains(s.corsOrigins, origin)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if wildcard {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if s.signedResponses {
+			h.Set("Access-Control-Expose-Headers", SignatureHeader)
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", methods)
+			h.Set("Access-Control-Allow-Headers", "Content-Type")
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
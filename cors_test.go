@@ -0,0 +1,78 @@
+package sumdb_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORS(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	request := func(h http.Handler, method, path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		db, err := New("test.example.com", skey, WithStore(newAnnotatedStore(t, 1)))
+		require.NoError(t, err)
+
+		rec := request(db.APIHandler(), http.MethodGet, "/records/0", "https://dash.example.com")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("allowed origins", func(t *testing.T) {
+		db, err := New("test.example.com", skey,
+			WithStore(newAnnotatedStore(t, 1)),
+			WithCORS("https://dash.example.com"),
+		)
+		require.NoError(t, err)
+
+		for _, tt := range []struct {
+			handler http.Handler
+			methods string
+		}{
+			{handler: db.Handler(), methods: "GET, HEAD"},
+			{handler: db.APIHandler(), methods: "GET, HEAD, POST"},
+		} {
+			rec := request(tt.handler, http.MethodOptions, "/lookup/example.com/mod0@v1.0.0", "https://dash.example.com")
+			require.Equal(t, http.StatusNoContent, rec.Code)
+			require.Equal(t, "https://dash.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+			require.Equal(t, tt.methods, rec.Header().Get("Access-Control-Allow-Methods"))
+			require.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+		}
+
+		rec := request(db.APIHandler(), http.MethodGet, "/records/0", "https://dash.example.com")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "https://dash.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "Origin", rec.Header().Get("Vary"))
+
+		rec = request(db.APIHandler(), http.MethodGet, "/records/0", "https://evil.example.com")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("wildcard", func(t *testing.T) {
+		db, err := New("test.example.com", skey, WithStore(newAnnotatedStore(t, 1)), WithCORS("*"))
+		require.NoError(t, err)
+
+		rec := request(db.APIHandler(), http.MethodGet, "/records/0", "https://anywhere.example.com")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
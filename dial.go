@@ -0,0 +1,76 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+type (
+	// DialFunc dials a network connection, with the signature of net.Dialer.DialContext.
+	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// upstreamDialer dials connections to the upstream proxies, substituting the addresses pinned with
+	// WithUpstreamAddrs for their hosts and otherwise resolving hosts with the configured resolver.
+	upstreamDialer struct {
+		dial   DialFunc
+		pinned map[string][]string
+	}
+)
+
+// ErrInvalidPinnedAddr is returned by New when an address given to WithUpstreamAddrs isn't an IP address.
+var ErrInvalidPinnedAddr = errors.New("invalid pinned upstream address")
+
+// dialContext returns the function used to dial the upstream proxies, applying WithDialer, WithResolver and
+// WithUpstreamAddrs, or nil when none of them are used.
+func (s *SumDB) dialContext() (DialFunc, error) {
+	if s.dialer == nil && s.resolver == nil && len(s.pinnedAddrs) == 0 {
+		return nil, nil
+	}
+
+	for host, addrs := range s.pinnedAddrs {
+		for _, addr := range addrs {
+			if net.ParseIP(addr) == nil {
+				return nil, fmt.Errorf("%w: %s, %q", ErrInvalidPinnedAddr, host, addr)
+			}
+		}
+	}
+
+	dial := s.dialer
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 2 * time.Second, Resolver: s.resolver}).DialContext
+	}
+
+	d := &upstreamDialer{dial: dial, pinned: s.pinnedAddrs}
+	return d.DialContext, nil
+}
+
+// DialContext dials addr, trying each of the addresses pinned for its host in turn. Hosts without pinned addresses are
+// dialed as is.
+func (d *upstreamDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := d.pinned[host]
+	if len(pinned) == 0 {
+		return d.dial(ctx, network, addr)
+	}
+
+	var errs []error
+	for _, ip := range pinned {
+		conn, err := d.dial(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, fmt.Errorf("failed to dial pinned addresses: %s, %w", host, errors.Join(errs...))
+}
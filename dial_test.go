@@ -0,0 +1,126 @@
+package sumdb_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestUpstreamDialing(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	// The proxy's certificate is valid for example.com, which is pinned to the loopback address it listens on.
+	p := newFakeProxy(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(p.serve))
+	t.Cleanup(srv.Close)
+
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	upstream := &url.URL{Scheme: "https", Host: net.JoinHostPort("example.com", port)}
+
+	mod := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+
+	t.Run("pinned addresses", func(t *testing.T) {
+		// Nothing listens on 127.0.0.2, so the second address is used.
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithHTTPClient(srv.Client()),
+			WithUpstream(upstream),
+			WithUpstreamAddrs("example.com", "127.0.0.2", "127.0.0.1"),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+	})
+
+	t.Run("custom dialer", func(t *testing.T) {
+		var (
+			mu    sync.Mutex
+			addrs []string
+		)
+		dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+			mu.Lock()
+			addrs = append(addrs, addr)
+			mu.Unlock()
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithHTTPClient(srv.Client()),
+			WithUpstream(upstream),
+			WithUpstreamAddrs("example.com", "127.0.0.1"),
+			WithDialer(dial),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.NotEmpty(t, addrs)
+		for _, addr := range addrs {
+			require.Equal(t, net.JoinHostPort("127.0.0.1", port), addr)
+		}
+	})
+
+	t.Run("custom resolver", func(t *testing.T) {
+		resolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(context.Context, string, string) (net.Conn, error) {
+				return nil, errors.New("resolver unavailable")
+			},
+		}
+
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithHTTPClient(srv.Client()),
+			WithUpstream(upstream),
+			WithResolver(resolver),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), mod)
+		require.ErrorContains(t, err, "resolver unavailable")
+	})
+
+	t.Run("unreachable pinned addresses", func(t *testing.T) {
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithHTTPClient(srv.Client()),
+			WithUpstream(upstream),
+			WithUpstreamAddrs("example.com", "127.0.0.2"),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), mod)
+		require.ErrorContains(t, err, "failed to dial pinned addresses")
+	})
+
+	t.Run("invalid pinned addresses", func(t *testing.T) {
+		_, err := New("test.example.com", skey, WithUpstreamAddrs("example.com", "proxy.internal"))
+		require.ErrorIs(t, err, ErrInvalidPinnedAddr)
+	})
+
+	t.Run("requires an http.Transport", func(t *testing.T) {
+		client := &http.Client{Transport: roundTripperFunc(http.DefaultTransport.RoundTrip)}
+		_, err := New("test.example.com", skey, WithHTTPClient(client), WithResolver(net.DefaultResolver))
+		require.Error(t, err)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
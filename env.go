@@ -0,0 +1,84 @@
+package sumdb
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// goEnvFlags are the GOFLAGS recommended to clients. With -mod=readonly, builds fail on missing go.sum entries instead
+// of adding them, so entries are only added by go get and go mod tidy, which check them against the database.
+const goEnvFlags = "-mod=readonly"
+
+// GoEnv is the configuration of the go command needed to trust a SumDB. See (*SumDB).GoEnv.
+//
+// The go command has no other settings for checksum databases: GOSUMDB chooses the database, and GONOSUMDB (which
+// defaults to GOPRIVATE) excludes modules from it.
+type GoEnv struct {
+	// GOSUMDB is the database's verifier key, followed by the URL it's served at. The go command connects to the URL
+	// directly, rather than through GOPROXY.
+	GOSUMDB string `json:"GOSUMDB"`
+
+	// GONOSUMDB is a comma-separated list of glob patterns of the module paths that aren't checked against the
+	// database.
+	GONOSUMDB string `json:"GONOSUMDB,omitempty"`
+
+	// GOFLAGS keeps builds from adding go.sum entries.
+	GOFLAGS string `json:"GOFLAGS"`
+}
+
+// GoEnv returns the configuration of the go command for a SumDB served at u, excluding the modules matching the glob
+// patterns noSumDB (e.g. "github.com/acme/*").
+//
+// Modules must not be listed in GOPRIVATE to be checked against the database, since it's the default for GONOSUMDB.
+// Use GONOPROXY to fetch them directly from their repositories instead.
+func (s *SumDB) GoEnv(u *url.URL, noSumDB ...string) *GoEnv {
+	return &GoEnv{
+		GOSUMDB:   s.vkey + " " + strings.TrimSuffix(u.String(), "/"),
+		GONOSUMDB: strings.Join(noSumDB, ","),
+		GOFLAGS:   goEnvFlags,
+	}
+}
+
+// Environ returns the variables set by e as "NAME=value" pairs, in the format of os.Environ.
+func (e *GoEnv) Environ() []string {
+	env := []string{"GOSUMDB=" + e.GOSUMDB}
+	if e.GONOSUMDB != "" {
+		env = append(env, "GONOSUMDB="+e.GONOSUMDB)
+	}
+	if e.GOFLAGS != "" {
+		env = append(env, "GOFLAGS="+e.GOFLAGS)
+	}
+	return env
+}
+
+// Exports returns POSIX shell commands exporting the variables set by e, e.g. for eval.
+func (e *GoEnv) Exports() string {
+	var b strings.Builder
+	for _, kv := range e.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		fmt.Fprintf(&b, "export %s=%s\n", name, shellQuote(value))
+	}
+	return b.String()
+}
+
+// Script returns a POSIX shell script persisting the variables set by e in the go command's configuration, with go
+// env -w. GOFLAGS is only set if it's empty, so that developers' own flags are kept.
+func (e *GoEnv) Script() string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset -e\n\n")
+	for _, kv := range e.Environ() {
+		if strings.HasPrefix(kv, "GOFLAGS=") {
+			fmt.Fprintf(&b, "[ -n \"$(go env GOFLAGS)\" ] || go env -w %s\n", shellQuote(kv))
+			continue
+		}
+		fmt.Fprintf(&b, "go env -w %s\n", shellQuote(kv))
+	}
+	b.WriteString("\necho \"go is configured to use the checksum database $(go env GOSUMDB)\"\n")
+	return b.String()
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
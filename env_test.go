@@ -0,0 +1,37 @@
+package sumdb_test
+
+import (
+	"net/url"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoEnv(t *testing.T) {
+	skey, vkey, err := GenerateKeys("sum.example.com")
+	require.NoError(t, err)
+
+	db, err := New("sum.example.com", skey, WithStore(newMemStore()))
+	require.NoError(t, err)
+	require.Equal(t, vkey, db.VerifierKey())
+
+	u, err := url.Parse("https://sumdb.example.com/")
+	require.NoError(t, err)
+
+	env := db.GoEnv(u, "github.com/acme/*", "go.acme.dev")
+	require.Equal(t, &GoEnv{
+		GOSUMDB:   vkey + " https://sumdb.example.com",
+		GONOSUMDB: "github.com/acme/*,go.acme.dev",
+		GOFLAGS:   "-mod=readonly",
+	}, env)
+	require.Equal(t, []string{
+		"GOSUMDB=" + vkey + " https://sumdb.example.com",
+		"GONOSUMDB=github.com/acme/*,go.acme.dev",
+		"GOFLAGS=-mod=readonly",
+	}, env.Environ())
+
+	// Unset variables are omitted.
+	require.Equal(t, []string{"GOSUMDB=" + vkey + " https://sumdb.example.com", "GOFLAGS=-mod=readonly"},
+		db.GoEnv(u).Environ())
+}
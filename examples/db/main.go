@@ -1,44 +1,48 @@
-// Command db demonstrates using sumdb with SQLite storage.
+// Command db demonstrates using sumdb with the SQLite store in store/sqlite, or
+// the PostgreSQL store in store/postgres when DATABASE_URL is set, e.g.
 //
-// This example creates an in-memory database, generates signing keys,
+//	DATABASE_URL=postgres://postgres@localhost/sumdb go run ./examples/db
+//
+// This example creates a temporary database, generates signing keys,
 // looks up some modules from the Go module proxy, and displays the
 // resulting tree state.
 package main
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/postgres"
+	"github.com/pseudomuto/sumdb/store/sqlite"
 	"golang.org/x/mod/module"
-
-	_ "modernc.org/sqlite"
 )
 
 func main() {
 	ctx := context.Background()
 
 	fmt.Println("=== Creating database ===")
-	db, err := sql.Open("sqlite", ":memory:")
+	store, closeStore, err := openStore(ctx)
 	if err != nil {
-		log.Fatalf("open database: %v", err)
+		log.Fatalf("%v", err)
 	}
-	defer db.Close()
+	defer closeStore()
+	fmt.Println("Created database")
 
-	store, err := newDBStore(ctx, db)
+	skey, vkey, err := sumdb.GenerateKeys("example")
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
-	fmt.Println("Created database")
 	fmt.Println()
-	fmt.Println("Verification key: " + store.vkey)
+	fmt.Println("Verification key: " + vkey)
 	fmt.Println()
 
 	// Create sumdb instance
-	sdb, err := sumdb.New("example", store.skey,
+	sdb, err := sumdb.New("example", skey,
 		sumdb.WithStore(store),
 	)
 	if err != nil {
@@ -107,3 +111,30 @@ func parseModule(s string) (module.Version, error) {
 		Version: parts[1],
 	}, nil
 }
+
+// openStore opens the PostgreSQL database in DATABASE_URL, or a temporary
+// SQLite database if it isn't set.
+func openStore(ctx context.Context) (sumdb.Store, func(), error) {
+	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+		store, err := postgres.Open(ctx, dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() { _ = store.Close() }, nil
+	}
+
+	dir, err := os.MkdirTemp("", "sumdb-example")
+	if err != nil {
+		return nil, nil, fmt.Errorf("create temp dir: %w", err)
+	}
+
+	store, err := sqlite.Open(ctx, filepath.Join(dir, "sumdb.db"))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	return store, func() {
+		_ = store.Close()
+		_ = os.RemoveAll(dir)
+	}, nil
+}
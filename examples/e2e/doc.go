@@ -0,0 +1,13 @@
+// Package e2e checks, end to end, that the go command verifies modules against a sumdb server. Its main test boots a
+// server with an in-memory store in front of a fake module proxy, configures a workspace with the settings returned
+// by (*sumdb.SumDB).GoEnv, and runs go mod download and go mod verify in it, as a developer's machine or CI would.
+// Another shows that the go command fails, rather than retries, lookups answered with 202 Accepted by a server with a
+// lookup budget.
+//
+// The test runs the go command found in PATH, so it's behind the e2e build tag:
+//
+//	go test -tags e2e ./examples/e2e
+//
+// It doubles as a reference for integrating a server with the go command: the environment it runs the go command
+// with is all a client needs.
+package e2e
@@ -0,0 +1,303 @@
+//go:build e2e
+
+package e2e_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+// moduleProxy is a Go module proxy serving a single-file module for any module version. Tampered versions are
+// served with different content, as a compromised proxy would.
+type moduleProxy struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	tampered map[string]bool
+}
+
+func newModuleProxy(t *testing.T) *moduleProxy {
+	t.Helper()
+
+	p := &moduleProxy{tampered: make(map[string]bool)}
+	p.Server = httptest.NewServer(http.HandlerFunc(p.serve))
+	t.Cleanup(p.Close)
+	return p
+}
+
+// setTampered sets whether mod is served with different content.
+func (p *moduleProxy) setTampered(mod module.Version, tampered bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tampered[mod.String()] = tampered
+}
+
+func (p *moduleProxy) serve(w http.ResponseWriter, r *http.Request) {
+	// Requests for anything else, such as the go command checking for a checksum database proxy at /sumdb/, are
+	// answered with 404 Not Found.
+	escPath, file, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/@v/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	dot := strings.LastIndex(file, ".")
+	path, err1 := module.UnescapePath(escPath)
+	version, err2 := module.UnescapeVersion(file[:max(dot, 0)])
+	if dot < 0 || err1 != nil || err2 != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	mod := module.Version{Path: path, Version: version}
+	p.mu.Lock()
+	tampered := p.tampered[mod.String()]
+	p.mu.Unlock()
+
+	switch file[dot+1:] {
+	case "info":
+		_, _ = fmt.Fprintf(w, `{"Version":%q,"Time":"2026-01-01T00:00:00Z"}`, version)
+	case "mod":
+		_, _ = fmt.Fprintf(w, "module %s\n", path)
+	case "zip":
+		http.ServeContent(w, r, file, time.Time{}, bytes.NewReader(moduleZip(mod, tampered)))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// moduleZip returns a module zip containing a go.mod file and a Go source file, which differs if tampered is true.
+func moduleZip(mod module.Version, tampered bool) []byte {
+	name := mod.Path[strings.LastIndex(mod.Path, "/")+1:]
+	greeting := "hello"
+	if tampered {
+		greeting = "pwned"
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create(mod.String() + "/go.mod")
+	_, _ = fmt.Fprintf(w, "module %s\n", mod.Path)
+	w, _ = zw.Create(mod.String() + "/" + name + ".go")
+	_, _ = fmt.Fprintf(w, "package %s\n\nconst Greeting = %q\n", name, greeting)
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+// workspace is a main module configured to trust a sumdb server.
+type workspace struct {
+	dir string
+	env []string
+}
+
+// newWorkspace returns a workspace requiring mods, with its own module cache and checksum database cache, which
+// fetches modules from proxy and checks them against the server described by env.
+func newWorkspace(t *testing.T, proxy string, env *sumdb.GoEnv, mods ...module.Version) *workspace {
+	t.Helper()
+
+	dir, gopath := t.TempDir(), t.TempDir()
+	var goMod strings.Builder
+	goMod.WriteString("module example.com/app\n\ngo 1.21\n")
+	for _, mod := range mods {
+		fmt.Fprintf(&goMod, "\nrequire %s %s\n", mod.Path, mod.Version)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod.String()), 0o600))
+
+	// Start from a clean environment, so the developer's settings (e.g. GOPRIVATE, which GONOSUMDB defaults to)
+	// don't leak into the test.
+	var environ []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "GO") {
+			environ = append(environ, kv)
+		}
+	}
+	environ = append(environ,
+		"GOENV=off",
+		"GOPATH="+gopath,
+		"GOPROXY="+proxy,
+		"GOPRIVATE=",
+		"GONOPROXY=",
+		"GONOSUMDB=",
+		"GOTOOLCHAIN=local",
+		"GOWORK=off",
+	)
+	environ = append(environ, env.Environ()...)
+
+	// The module cache is read-only by default, which keeps t.TempDir from removing it.
+	for i, kv := range environ {
+		if strings.HasPrefix(kv, "GOFLAGS=") {
+			environ[i] += " -modcacherw"
+		}
+	}
+	return &workspace{dir: dir, env: environ}
+}
+
+// goCmd runs the go command in the workspace, returning its combined output.
+func (ws *workspace) goCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	cmd := exec.CommandContext(t.Context(), "go", args...)
+	cmd.Dir = ws.dir
+	cmd.Env = ws.env
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// goSum returns the workspace's go.sum.
+func (ws *workspace) goSum(t *testing.T) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(ws.dir, "go.sum"))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestGoModDownload(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found in PATH")
+	}
+
+	skey, _, err := sumdb.GenerateKeys("sum.example.test")
+	require.NoError(t, err)
+
+	proxy := newModuleProxy(t)
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	db, err := sumdb.New("sum.example.test", skey,
+		sumdb.WithStore(memstore.New()),
+		sumdb.WithUpstream(proxyURL),
+	)
+	require.NoError(t, err)
+
+	lookups := &requestLog{}
+	server := httptest.NewServer(lookups.wrap(db.Handler()))
+	t.Cleanup(server.Close)
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	t.Run("verifies modules", func(t *testing.T) {
+		mod := module.Version{Path: "example.com/hello", Version: "v1.0.0"}
+		ws := newWorkspace(t, proxy.URL, db.GoEnv(serverURL), mod)
+
+		out, err := ws.goCmd(t, "mod", "download", mod.Path)
+		require.NoError(t, err, out)
+		require.Contains(t, lookups.requested(), "/lookup/"+mod.String())
+
+		// The go.sum entries are the server's record of the module.
+		id, err := db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+		records, err := db.ReadRecords(t.Context(), id, 1)
+		require.NoError(t, err)
+		require.Equal(t, string(records[0]), ws.goSum(t))
+
+		out, err = ws.goCmd(t, "mod", "verify")
+		require.NoError(t, err, out)
+		require.Contains(t, out, "all modules verified")
+	})
+
+	t.Run("rejects tampered modules", func(t *testing.T) {
+		mod := module.Version{Path: "example.com/hello", Version: "v1.1.0"}
+		_, err := db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+
+		proxy.setTampered(mod, true)
+		t.Cleanup(func() { proxy.setTampered(mod, false) })
+
+		ws := newWorkspace(t, proxy.URL, db.GoEnv(serverURL), mod)
+		out, err := ws.goCmd(t, "mod", "download", mod.Path)
+		require.Error(t, err)
+		require.Contains(t, out, "SECURITY ERROR")
+		require.Contains(t, out, "sum.example.test")
+	})
+
+	t.Run("skips modules in GONOSUMDB", func(t *testing.T) {
+		mod := module.Version{Path: "example.com/private/lib", Version: "v1.0.0"}
+		ws := newWorkspace(t, proxy.URL, db.GoEnv(serverURL, "example.com/private/*"), mod)
+		out, err := ws.goCmd(t, "mod", "download", mod.Path)
+		require.NoError(t, err, out)
+		require.Contains(t, ws.goSum(t), mod.Path+" "+mod.Version+" h1:")
+
+		// The server was never asked about the module.
+		for _, path := range lookups.requested() {
+			require.NotContains(t, path, "example.com/private")
+		}
+	})
+}
+
+// TestGoModDownloadLookupBudget shows that the go command doesn't retry lookups answered with 202 Accepted by a
+// server with a lookup budget (see sumdb.WithLookupBudget): the download fails instead.
+func TestGoModDownloadLookupBudget(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found in PATH")
+	}
+
+	skey, _, err := sumdb.GenerateKeys("sum.example.test")
+	require.NoError(t, err)
+
+	// The server's upstream is too slow for its budget, so cold lookups are answered with 202 Accepted.
+	proxy := newModuleProxy(t)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+		proxy.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(slow.Close)
+	slowURL, err := url.Parse(slow.URL)
+	require.NoError(t, err)
+
+	db, err := sumdb.New("sum.example.test", skey,
+		sumdb.WithStore(memstore.New()),
+		sumdb.WithUpstream(slowURL),
+		sumdb.WithLookupBudget(50*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(db.Handler())
+	t.Cleanup(server.Close)
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	mod := module.Version{Path: "example.com/hello", Version: "v1.0.0"}
+	ws := newWorkspace(t, proxy.URL, db.GoEnv(serverURL), mod)
+	out, err := ws.goCmd(t, "mod", "download", mod.Path)
+	require.Error(t, err)
+	require.Contains(t, out, "202 Accepted")
+}
+
+// requestLog records the paths of the requests served by a handler.
+type requestLog struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (l *requestLog) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		l.paths = append(l.paths, r.URL.Path)
+		l.mu.Unlock()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// requested returns the paths requested so far.
+func (l *requestLog) requested() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.paths...)
+}
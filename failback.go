@@ -0,0 +1,300 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/lru"
+	"github.com/pseudomuto/sumdb/internal/proxy"
+	"github.com/pseudomuto/sumdb/internal/sumdbclient"
+	"golang.org/x/mod/module"
+)
+
+// failbackCacheSize is the number of hash computations kept for rechecks made while their upstream is down. See
+// WithUpstreamFailback.
+const failbackCacheSize = 10_000
+
+// Health statuses.
+const (
+	// HealthOK means the store and every upstream are reachable.
+	HealthOK HealthStatus = "ok"
+
+	// HealthDegraded means existing records are served, but some upstreams are down (see WithUpstreamFailback), so
+	// cold lookups of the modules fetched from them fail with ErrUpstreamUnavailable.
+	HealthDegraded HealthStatus = "degraded"
+
+	// HealthUnavailable means the store can't be reached, so nothing can be served.
+	HealthUnavailable HealthStatus = "unavailable"
+)
+
+// ErrUpstreamUnavailable is returned when a module can't be fetched because its upstream is down. See
+// WithUpstreamFailback.
+var ErrUpstreamUnavailable = errors.New("upstream unavailable")
+
+type (
+	// HealthStatus is the overall health of a SumDB.
+	HealthStatus string
+
+	// Health is the health of a SumDB, as served by HealthHandler.
+	Health struct {
+		Status HealthStatus `json:"status"`
+
+		// Error is why the store can't be reached, when Status is HealthUnavailable.
+		Error string `json:"error,omitempty"`
+
+		// Upstreams are the upstreams modules are fetched from: the default upstream (or trusted checksum database),
+		// followed by those of the routes given to WithIngestRoutes.
+		Upstreams []UpstreamHealth `json:"upstreams"`
+	}
+
+	// UpstreamHealth is the health of an upstream.
+	UpstreamHealth struct {
+		URL string `json:"url"`
+		Up  bool   `json:"up"`
+
+		// ConsecutiveFailures is the number of fetches that failed since the last one that succeeded.
+		ConsecutiveFailures int `json:"consecutive_failures"`
+
+		// DownSince is when the upstream was marked down, if it is.
+		DownSince *time.Time `json:"down_since,omitempty"`
+
+		// LastError is the error of the last failed fetch, if the last fetch failed.
+		LastError string `json:"last_error,omitempty"`
+	}
+
+	// upstreamFailback tracks the health of the upstreams, so that fetches from upstreams that are down fail fast, and
+	// keeps the hashes computed from their modules for rechecks made while they're down. See WithUpstreamFailback.
+	upstreamFailback struct {
+		failures   int // consecutive failures marking an upstream down, or 0 to never mark them down
+		retryAfter time.Duration
+		computed   *lru.Cache[string, computedRecord]
+
+		mu        sync.Mutex
+		upstreams map[string]*upstreamState
+		order     []string
+	}
+
+	// upstreamState is the health of an upstream.
+	upstreamState struct {
+		failures  int
+		lastErr   error
+		lastTry   time.Time // of the last failed fetch, or of the last probe while down
+		downSince time.Time
+	}
+
+	// computedRecord is the record data computed from what an upstream served, and when.
+	computedRecord struct {
+		data []byte
+		at   time.Time
+	}
+)
+
+func newUpstreamFailback(failures int, retryAfter time.Duration) *upstreamFailback {
+	size := 0
+	if failures > 0 {
+		size = failbackCacheSize
+	}
+
+	return &upstreamFailback{
+		failures:   failures,
+		retryAfter: retryAfter,
+		computed:   lru.New[string, computedRecord](size),
+		upstreams:  make(map[string]*upstreamState),
+	}
+}
+
+// track adds upstream to the upstreams reported by health.
+func (f *upstreamFailback) track(upstream string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state(upstream)
+}
+
+// state returns the state of upstream, adding it if it isn't tracked yet. Callers must hold f.mu.
+func (f *upstreamFailback) state(upstream string) *upstreamState {
+	st, ok := f.upstreams[upstream]
+	if !ok {
+		st = &upstreamState{}
+		f.upstreams[upstream] = st
+		f.order = append(f.order, upstream)
+	}
+	return st
+}
+
+// isDown reports whether st is marked down.
+func (f *upstreamFailback) isDown(st *upstreamState) bool {
+	return f.failures > 0 && st.failures >= f.failures
+}
+
+// available reports whether modules may be fetched from upstream at now. Upstreams that are down are probed once per
+// retryAfter: the first fetch after it has elapsed is let through, and the others wait for another retryAfter. When
+// upstream isn't available, it returns how long until it's probed again.
+func (f *upstreamFailback) available(now time.Time, upstream string) (time.Duration, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st := f.state(upstream)
+	if !f.isDown(st) {
+		return 0, true
+	}
+	if wait := st.lastTry.Add(f.retryAfter).Sub(now); wait > 0 {
+		return wait, false
+	}
+
+	st.lastTry = now
+	return 0, true
+}
+
+// wait returns how long until upstream is probed again, if it's down.
+func (f *upstreamFailback) wait(now time.Time, upstream string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st := f.state(upstream)
+	if !f.isDown(st) {
+		return 0
+	}
+	return max(st.lastTry.Add(f.retryAfter).Sub(now), 0)
+}
+
+// succeeded records a fetch from upstream that succeeded, returning how long upstream had been down, if it was.
+func (f *upstreamFailback) succeeded(now time.Time, upstream string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st := f.state(upstream)
+	var downFor time.Duration
+	if f.isDown(st) {
+		downFor = now.Sub(st.downSince)
+	}
+	*st = upstreamState{}
+	return downFor
+}
+
+// failed records a fetch from upstream that failed with err, returning the number of consecutive failures and whether
+// upstream is down.
+func (f *upstreamFailback) failed(now time.Time, upstream string, err error) (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	st := f.state(upstream)
+	st.failures++
+	st.lastErr = err
+	st.lastTry = now
+	if st.failures == f.failures {
+		st.downSince = now
+	}
+	return st.failures, f.isDown(st)
+}
+
+// remember keeps the record data computed for mod at now, for rechecks made while its upstream is down.
+func (f *upstreamFailback) remember(now time.Time, mod module.Version, data []byte) {
+	f.computed.Add(mod.String(), computedRecord{data: data, at: now})
+}
+
+// recall returns the record data last computed for mod, if it's still kept.
+func (f *upstreamFailback) recall(mod module.Version) (computedRecord, bool) {
+	return f.computed.Get(mod.String())
+}
+
+// health returns the health of the tracked upstreams.
+func (f *upstreamFailback) health() []UpstreamHealth {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := make([]UpstreamHealth, len(f.order))
+	for i, upstream := range f.order {
+		st := f.upstreams[upstream]
+		out[i] = UpstreamHealth{URL: upstream, Up: !f.isDown(st), ConsecutiveFailures: st.failures}
+		if !out[i].Up {
+			out[i].DownSince = &st.downSince
+		}
+		if st.lastErr != nil {
+			out[i].LastError = st.lastErr.Error()
+		}
+	}
+	return out
+}
+
+// observeUpstream records the outcome of a fetch from upstream, which failed with err if it isn't nil, and returns err.
+// Once upstream is down, the returned error also wraps ErrUpstreamUnavailable. Upstreams that answered, even if it
+// was to say they don't have the module, are up, and fetches the caller gave up on say nothing about the upstream.
+func (s *SumDB) observeUpstream(ctx context.Context, upstream string, err error) error {
+	now := s.clock.Now()
+	switch {
+	case err == nil, errors.Is(err, proxy.ErrNotFound), errors.Is(err, sumdbclient.ErrNotFound),
+		errors.Is(err, ErrUpstreamVerification):
+		if downFor := s.failback.succeeded(now, upstream); downFor > 0 {
+			s.logger.LogAttrs(ctx, slog.LevelInfo, "upstream recovered",
+				slog.String("upstream", upstream), slog.Duration("down_for", downFor))
+		}
+		return err
+	case ctx.Err() != nil:
+		return err
+	}
+
+	failures, down := s.failback.failed(now, upstream, err)
+	if !down {
+		return err
+	}
+	if failures == s.failback.failures {
+		s.logger.LogAttrs(ctx, slog.LevelWarn, "upstream down",
+			slog.String("upstream", upstream), slog.Int("failures", failures), slog.Any("error", err))
+	}
+	return fmt.Errorf("%w: %s, %w", ErrUpstreamUnavailable, upstream, err)
+}
+
+// checkUpstream returns an error wrapping ErrUpstreamUnavailable if modules can't be fetched from upstream, because
+// it's down and not due to be probed yet.
+func (s *SumDB) checkUpstream(upstream string) error {
+	if wait, ok := s.failback.available(s.clock.Now(), upstream); !ok {
+		return fmt.Errorf("%w: %s (retry in %s)", ErrUpstreamUnavailable, upstream, wait.Round(time.Second))
+	}
+	return nil
+}
+
+// Health returns the health of the server: whether its store can be reached, and which of its upstreams are down.
+func (s *SumDB) Health(ctx context.Context) *Health {
+	h := &Health{Status: HealthOK, Upstreams: s.failback.health()}
+	for _, u := range h.Upstreams {
+		if !u.Up {
+			h.Status = HealthDegraded
+		}
+	}
+
+	if _, err := s.store.TreeSize(ctx); err != nil {
+		h.Status, h.Error = HealthUnavailable, err.Error()
+	}
+	return h
+}
+
+// HealthHandler returns an HTTP handler serving the server's Health as JSON at GET /healthz, for load balancers and
+// orchestrators. Degraded servers still serve existing records, so they're answered with 200 OK like healthy ones, and
+// only servers whose store can't be reached are answered with 503 Service Unavailable.
+func (s *SumDB) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		h := s.Health(r.Context())
+		status := http.StatusOK
+		if h.Status == HealthUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, h)
+	})
+	return mux
+}
+
+// reportUnavailable answers a lookup of mod that failed with err, because its upstream is down, with 503 Service
+// Unavailable and a Retry-After header set to when the upstream is probed again.
+func (s *SumDB) reportUnavailable(w http.ResponseWriter, mod module.Version, err error) {
+	wait := s.failback.wait(s.clock.Now(), s.routeFor(mod).source)
+	w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(wait.Seconds())), 1)))
+	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+}
@@ -0,0 +1,144 @@
+package sumdb_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestUpstreamFailback(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	start := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	now := start
+	upstream := newFakeProxy(t)
+	db, err := New("test.example.com", skey,
+		WithStore(newAnnotatedStore(t, 0)),
+		WithUpstream(upstream.upstream(t)),
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithUpstreamFailback(2, time.Minute),
+	)
+	require.NoError(t, err)
+
+	// health returns the server's health, as served by HealthHandler.
+	health := func(t *testing.T) *Health {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		db.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var h Health
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &h))
+		return &h
+	}
+
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+	require.NoError(t, err)
+	require.Equal(t, &Health{
+		Status:    HealthOK,
+		Upstreams: []UpstreamHealth{{URL: upstream.URL, Up: true}},
+	}, health(t))
+
+	upstream.setDown(true)
+	now = now.Add(time.Hour)
+
+	t.Run("marks upstreams down", func(t *testing.T) {
+		mod := module.Version{Path: "example.com/b", Version: "v1.0.0"}
+		_, err := db.Lookup(t.Context(), mod)
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrUpstreamUnavailable)
+
+		_, err = db.Lookup(t.Context(), mod)
+		require.ErrorIs(t, err, ErrUpstreamUnavailable)
+
+		h := health(t)
+		require.Equal(t, HealthDegraded, h.Status)
+		require.Len(t, h.Upstreams, 1)
+		require.False(t, h.Upstreams[0].Up)
+		require.Equal(t, 2, h.Upstreams[0].ConsecutiveFailures)
+		require.Equal(t, now, *h.Upstreams[0].DownSince)
+		require.Contains(t, h.Upstreams[0].LastError, "502")
+	})
+
+	t.Run("fails cold lookups fast", func(t *testing.T) {
+		requests := len(upstream.requested())
+		now = now.Add(15 * time.Second)
+
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/c@v1.0.0", nil))
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		require.Equal(t, "45", rec.Header().Get("Retry-After"))
+		require.Contains(t, rec.Body.String(), ErrUpstreamUnavailable.Error())
+		require.Len(t, upstream.requested(), requests)
+
+		// Existing records are still served.
+		rec = httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/a@v1.0.0", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("rechecks against computed hashes", func(t *testing.T) {
+		receipt, err := db.Recheck(t.Context(), 0)
+		require.NoError(t, err)
+		require.Equal(t, RecheckMatch, receipt.Result)
+		require.Equal(t, start, receipt.Computed)
+
+		annotations, err := db.Annotations(t.Context(), 0)
+		require.NoError(t, err)
+		verified, err := VerifyRecheckReceipt(vkey, []byte(annotations["recheck"]))
+		require.NoError(t, err)
+		require.Equal(t, receipt, verified)
+	})
+
+	t.Run("probes upstreams", func(t *testing.T) {
+		// The first lookup after retryAfter probes the upstream, which is still down.
+		now = now.Add(time.Minute)
+		requests := len(upstream.requested())
+		_, err := db.Lookup(t.Context(), module.Version{Path: "example.com/c", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrUpstreamUnavailable)
+		require.Greater(t, len(upstream.requested()), requests)
+
+		upstream.setDown(false)
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/c", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrUpstreamUnavailable)
+
+		now = now.Add(time.Minute)
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/c", Version: "v1.0.0"})
+		require.NoError(t, err)
+		require.Equal(t, HealthOK, health(t).Status)
+	})
+}
+
+func TestProxyRetry(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(upstream.upstream(t)),
+		WithUpstreamFailback(1, time.Minute),
+		WithProxyRetry(3, time.Millisecond, 10*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	// Transient failures are retried, and don't count against the upstream.
+	upstream.setFailures(2)
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+	require.NoError(t, err)
+	require.Equal(t, HealthOK, db.Health(t.Context()).Status)
+
+	// Failures outlasting the retries fail the lookup.
+	upstream.setFailures(3)
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/b", Version: "v1.0.0"})
+	require.ErrorContains(t, err, "503")
+	require.Equal(t, HealthDegraded, db.Health(t.Context()).Status)
+}
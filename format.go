@@ -0,0 +1,140 @@
+package sumdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/mod/module"
+)
+
+const (
+	// maxPooledBuffer is the capacity above which buffers aren't returned to bufferPool, so that an occasional large
+	// response doesn't pin its buffer for the life of the process.
+	maxPooledBuffer = 64 << 10
+
+	// lookupRecordOverhead is the most appendLookupRecord adds to a record's data: its ID and two newlines.
+	lookupRecordOverhead = len("9223372036854775807") + 2
+)
+
+// ErrMalformedRecord is returned when a record's data isn't in the form go clients expect and can't be normalized to
+// it. See NormalizeRecordData.
+var ErrMalformedRecord = errors.New("malformed record data")
+
+// bufferPool holds the buffers responses are assembled in before being written.
+var bufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 1024)
+		return &buf
+	},
+}
+
+// getBuffer returns an empty buffer from bufferPool. It must be returned with putBuffer once it's no longer used.
+func getBuffer() *[]byte {
+	buf := bufferPool.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// putBuffer returns buf to bufferPool.
+func putBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// appendRecordData appends the data of the record for mod, with the given h1 hashes of its zip and go.mod, to dst.
+func appendRecordData(dst []byte, mod module.Version, h1, h1mod string) []byte {
+	dst = append(dst, mod.Path...)
+	dst = append(dst, ' ')
+	dst = append(dst, mod.Version...)
+	dst = append(dst, ' ')
+	dst = append(dst, h1...)
+	dst = append(dst, '\n')
+	dst = append(dst, mod.Path...)
+	dst = append(dst, ' ')
+	dst = append(dst, mod.Version...)
+	dst = append(dst, "/go.mod "...)
+	dst = append(dst, h1mod...)
+	return append(dst, '\n')
+}
+
+// NormalizeRecordData returns data, the go.sum lines of mod, in the form go clients expect of records and that the
+// tree's hashes are computed over: the line for mod's zip followed by the line for its go.mod, each of the form
+// "<path> <version>[/go.mod] h1:<hash>" and ending in a single newline, with nothing else. Records created by Lookup
+// already have this form, but data from elsewhere may have its lines in the other order, CRLF line endings, extra
+// whitespace or blank lines, all of which are fixed. Data that's already normalized is returned as is.
+//
+// It returns ErrMalformedRecord if data doesn't have exactly one line for each of mod's zip and go.mod.
+func NormalizeRecordData(mod module.Version, data []byte) ([]byte, error) {
+	var h1, h1mod string
+	for line := range bytes.SplitSeq(data, []byte("\n")) {
+		f := strings.Fields(string(line))
+		if len(f) == 0 {
+			continue
+		}
+
+		if len(f) != 3 || f[0] != mod.Path || !strings.HasPrefix(f[2], "h1:") {
+			return nil, fmt.Errorf("%w: %s, %q", ErrMalformedRecord, mod, line)
+		}
+
+		hash := &h1
+		if f[1] == mod.Version+"/go.mod" {
+			hash = &h1mod
+		} else if f[1] != mod.Version {
+			return nil, fmt.Errorf("%w: %s, %q", ErrMalformedRecord, mod, line)
+		}
+
+		if *hash != "" {
+			return nil, fmt.Errorf("%w: %s, duplicate line %q", ErrMalformedRecord, mod, line)
+		}
+		*hash = f[2]
+	}
+
+	if h1 == "" || h1mod == "" {
+		return nil, fmt.Errorf("%w: %s, missing zip or go.mod line", ErrMalformedRecord, mod)
+	}
+
+	norm := appendRecordData(make([]byte, 0, recordDataLen(mod, h1, h1mod)), mod, h1, h1mod)
+	if bytes.Equal(norm, data) {
+		return data, nil
+	}
+	return norm, nil
+}
+
+// recordDataLen returns the length of the data appended by appendRecordData.
+func recordDataLen(mod module.Version, h1, h1mod string) int {
+	return 2*(len(mod.Path)+len(mod.Version)) + len(h1) + len(h1mod) + len("  \n /go.mod \n")
+}
+
+// appendLookupRecord appends the record with the given id and data, formatted as served by /lookup, to dst. It's
+// equivalent to tlog.FormatRecord without the intermediate allocations.
+func appendLookupRecord(dst []byte, id int64, data []byte) ([]byte, error) {
+	if !isValidRecordData(data) {
+		return dst, ErrMalformedRecord
+	}
+
+	dst = strconv.AppendInt(dst, id, 10)
+	dst = append(dst, '\n')
+	dst = append(dst, data...)
+	return append(dst, '\n'), nil
+}
+
+// isValidRecordData reports whether data can be served as a record: valid UTF-8 without control characters (other
+// than newlines) or blank lines, ending in a newline. This is the check made by tlog.FormatRecord.
+func isValidRecordData(data []byte) bool {
+	var last rune
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r < 0x20 && r != '\n' || r == utf8.RuneError && size == 1 || last == '\n' && r == '\n' {
+			return false
+		}
+		i += size
+		last = r
+	}
+	return last == '\n'
+}
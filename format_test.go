@@ -0,0 +1,100 @@
+package sumdb_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+func TestNormalizeRecordData(t *testing.T) {
+	mod := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	const want = "example.com/foo v1.0.0 h1:zip=\nexample.com/foo v1.0.0/go.mod h1:mod=\n"
+
+	t.Run("normalized", func(t *testing.T) {
+		data := []byte(want)
+		got, err := NormalizeRecordData(mod, data)
+		require.NoError(t, err)
+		require.Equal(t, want, string(got))
+
+		// Normalized data is returned as is.
+		require.Same(t, &data[0], &got[0])
+	})
+
+	tests := map[string]string{
+		"no trailing newline": "example.com/foo v1.0.0 h1:zip=\nexample.com/foo v1.0.0/go.mod h1:mod=",
+		"reordered":           "example.com/foo v1.0.0/go.mod h1:mod=\nexample.com/foo v1.0.0 h1:zip=\n",
+		"crlf":                "example.com/foo v1.0.0 h1:zip=\r\nexample.com/foo v1.0.0/go.mod h1:mod=\r\n",
+		"whitespace":          "  example.com/foo\tv1.0.0  h1:zip= \nexample.com/foo v1.0.0/go.mod h1:mod=   \n",
+		"blank lines":         "\nexample.com/foo v1.0.0 h1:zip=\n\n\nexample.com/foo v1.0.0/go.mod h1:mod=\n\n",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NormalizeRecordData(mod, []byte(data))
+			require.NoError(t, err)
+			require.Equal(t, want, string(got))
+		})
+	}
+
+	malformed := map[string]string{
+		"empty":           "",
+		"missing go.mod":  "example.com/foo v1.0.0 h1:zip=\n",
+		"missing zip":     "example.com/foo v1.0.0/go.mod h1:mod=\n",
+		"duplicate line":  want + "example.com/foo v1.0.0 h1:other=\n",
+		"other module":    strings.ReplaceAll(want, "foo", "bar"),
+		"other version":   strings.ReplaceAll(want, "v1.0.0", "v1.0.1"),
+		"extra fields":    "example.com/foo v1.0.0 h1:zip= extra\nexample.com/foo v1.0.0/go.mod h1:mod=\n",
+		"unknown hash":    "example.com/foo v1.0.0 h2:zip=\nexample.com/foo v1.0.0/go.mod h1:mod=\n",
+		"unrelated lines": want + "hello world\n",
+	}
+	for name, data := range malformed {
+		t.Run(name, func(t *testing.T) {
+			_, err := NormalizeRecordData(mod, []byte(data))
+			require.ErrorIs(t, err, ErrMalformedRecord)
+		})
+	}
+}
+
+func TestRecordData(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	db, err := New("test.example.com", skey, WithStore(newMemStore()), WithUpstream(upstream.upstream(t)))
+	require.NoError(t, err)
+
+	mod := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	id, err := db.Lookup(t.Context(), mod)
+	require.NoError(t, err)
+
+	// Records hold exactly the go.sum lines of the module, zip first, each ending in a newline.
+	h1, err := dirhash.Hash1([]string{mod.String() + "/go.mod"}, goModOpener(mod))
+	require.NoError(t, err)
+	h1mod, err := dirhash.Hash1([]string{"go.mod"}, goModOpener(mod))
+	require.NoError(t, err)
+	want := fmt.Sprintf("%s %s %s\n%s %s/go.mod %s\n", mod.Path, mod.Version, h1, mod.Path, mod.Version, h1mod)
+
+	recs, err := db.ReadRecords(t.Context(), id, 1)
+	require.NoError(t, err)
+	require.Equal(t, want, string(recs[0]))
+
+	// Data tiles hold each record followed by a blank line.
+	rec := httptest.NewRecorder()
+	db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tile/8/data/000.p/1", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, want+"\n", rec.Body.String())
+}
+
+// goModOpener opens the go.mod served for mod by fakeProxy, whatever the file name.
+func goModOpener(mod module.Version) func(string) (io.ReadCloser, error) {
+	return func(string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(fmt.Sprintf("module %s\n", mod.Path))), nil
+	}
+}
@@ -0,0 +1,149 @@
+package sumdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// ErrGoSumMismatch is returned by ImportGoSum when a go.sum file's hashes for a module version don't match the
+// version's existing record.
+var ErrGoSumMismatch = errors.New("go.sum doesn't match the log")
+
+// goSumEntry holds the hashes of a module version read from a go.sum file.
+type goSumEntry struct {
+	mod       module.Version
+	h1, h1mod string
+}
+
+// ImportGoSum appends records for the module versions listed in the go.sum file read from r (e.g. the concatenated
+// go.sum files of an organization's repositories), without contacting the upstream proxy. This is intended for
+// bootstrapping servers from existing module caches: the hashes are trusted as they are, so go.sum files must come
+// from a trusted source, such as repositories whose go.sum files were verified against a checksum database.
+//
+// Records are appended in the order their versions first appear in r. Versions that already have records are skipped,
+// but their hashes must match the records': otherwise nothing is appended and an error wrapping ErrGoSumMismatch is
+// returned. Versions listed with only their go.mod hash, as go.sum files do for modules whose code isn't needed, are
+// skipped, since records need both hashes. It returns the number of records added, and an error wrapping
+// ErrMalformedRecord if r isn't a valid go.sum file.
+func (s *SumDB) ImportGoSum(ctx context.Context, r io.Reader) (int64, error) {
+	entries, err := parseGoSum(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var recs []*Record
+	for _, e := range entries {
+		if e.h1 == "" || e.h1mod == "" {
+			continue
+		}
+
+		data := appendRecordData(make([]byte, 0, recordDataLen(e.mod, e.h1, e.h1mod)), e.mod, e.h1, e.h1mod)
+		existing, err := s.recordData(ctx, e.mod)
+		if err == nil {
+			if !bytes.Equal(existing, data) {
+				return 0, fmt.Errorf("%w: %s", ErrGoSumMismatch, e.mod)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+
+		recs = append(recs, &Record{Path: e.mod.Path, Version: e.mod.Version, Data: data})
+	}
+
+	return s.limitedImport(ctx, recs, false)
+}
+
+// recordData returns the data of mod's record. It returns an error wrapping ErrNotFound if mod has no record.
+func (s *SumDB) recordData(ctx context.Context, mod module.Version) ([]byte, error) {
+	id, err := s.store.RecordID(ctx, mod.Path, mod.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find record id: %s, %w", mod, err)
+	}
+
+	recs, err := s.store.Records(ctx, id, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record: %d, %w", id, err)
+	}
+	if len(recs) != 1 {
+		return nil, fmt.Errorf("failed to read record: %d, %w", id, ErrNotFound)
+	}
+	return recs[0].Data, nil
+}
+
+// parseGoSum returns the entries of the go.sum file read from r, in the order their versions first appear. Identical
+// lines may be repeated, but lines giving a different hash for the same version are refused.
+func parseGoSum(r io.Reader) ([]*goSumEntry, error) {
+	var entries []*goSumEntry
+	byVersion := make(map[module.Version]*goSumEntry)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		f := strings.Fields(scanner.Text())
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 3 || !strings.HasPrefix(f[2], "h1:") {
+			return nil, fmt.Errorf("%w: go.sum line %d: %q", ErrMalformedRecord, n, scanner.Text())
+		}
+
+		version, isMod := strings.CutSuffix(f[1], "/go.mod")
+		mod := module.Version{Path: f[0], Version: version}
+		if err := checkModule(mod); err != nil {
+			return nil, fmt.Errorf("%w: go.sum line %d: %w", ErrMalformedRecord, n, err)
+		}
+
+		e := byVersion[mod]
+		if e == nil {
+			e = &goSumEntry{mod: mod}
+			byVersion[mod] = e
+			entries = append(entries, e)
+		}
+
+		hash := &e.h1
+		if isMod {
+			hash = &e.h1mod
+		}
+		if *hash != "" && *hash != f[2] {
+			return nil, fmt.Errorf("%w: go.sum line %d: conflicting hash for %s %s", ErrMalformedRecord, n, f[0], f[1])
+		}
+		*hash = f[2]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read go.sum: %w", err)
+	}
+	return entries, nil
+}
+
+// serveImportGoSum serves POST /records/gosum requests, appending records for the module versions in the go.sum file
+// in the body with ImportGoSum and returning how many were added.
+func (s *SumDB) serveImportGoSum(w http.ResponseWriter, r *http.Request) {
+	if !s.auditRequest(w, r, "") {
+		return
+	}
+
+	n, err := s.ImportGoSum(r.Context(), http.MaxBytesReader(w, r.Body, 64<<20))
+	switch {
+	case errors.Is(err, ErrMalformedRecord):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrGoSumMismatch):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		reportError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"added": n})
+}
@@ -0,0 +1,79 @@
+package sumdb_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+const testGoSum = `github.com/google/uuid v1.6.0 h1:NIvaJDMOsjHA8n1jAhLSgzrAzy1Hgr+hNrb57e+94F0=
+github.com/google/uuid v1.6.0/go.mod h1:TIyPZe4MgqvfeYDBFedMoGGpEw/LqOeaOT+nhxU+yHo=
+golang.org/x/mod v0.31.0/go.mod h1:43JraMp9cGx1Rx3AqioxrbrhNsLl2l/iNAvuBkrezpg=
+golang.org/x/sync v0.19.0 h1:vV+1eWNmZ5geRlYjzm2adRgW2/mcpevXNg50YZtPCE4=
+
+golang.org/x/sync v0.19.0/go.mod h1:9KTHXmSnoGruLpwFjVSX0lunaQGGDHqu1bmgaHa87ko=
+github.com/google/uuid v1.6.0 h1:NIvaJDMOsjHA8n1jAhLSgzrAzy1Hgr+hNrb57e+94F0=
+`
+
+func TestImportGoSum(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := memstore.New()
+	db, err := New("test.example.com", skey, WithStore(store))
+	require.NoError(t, err)
+
+	added, err := db.ImportGoSum(t.Context(), strings.NewReader(testGoSum))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), added)
+
+	// Records are appended in the order their versions first appear, and versions without a zip hash are skipped.
+	data, err := readRecords(t.Context(), db, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{
+		[]byte("github.com/google/uuid v1.6.0 h1:NIvaJDMOsjHA8n1jAhLSgzrAzy1Hgr+hNrb57e+94F0=\n" +
+			"github.com/google/uuid v1.6.0/go.mod h1:TIyPZe4MgqvfeYDBFedMoGGpEw/LqOeaOT+nhxU+yHo=\n"),
+		[]byte("golang.org/x/sync v0.19.0 h1:vV+1eWNmZ5geRlYjzm2adRgW2/mcpevXNg50YZtPCE4=\n" +
+			"golang.org/x/sync v0.19.0/go.mod h1:9KTHXmSnoGruLpwFjVSX0lunaQGGDHqu1bmgaHa87ko=\n"),
+	}, data)
+
+	id, err := db.Lookup(t.Context(), module.Version{Path: "golang.org/x/sync", Version: "v0.19.0"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), id)
+
+	t.Run("existing records are skipped", func(t *testing.T) {
+		added, err := db.ImportGoSum(t.Context(), strings.NewReader(testGoSum))
+		require.NoError(t, err)
+		require.Zero(t, added)
+	})
+
+	t.Run("existing records must match", func(t *testing.T) {
+		gosum := "example.com/new v1.0.0 h1:a=\nexample.com/new v1.0.0/go.mod h1:b=\n" +
+			strings.ReplaceAll(testGoSum, "h1:NIvaJDMO", "h1:XXXXJDMO")
+		_, err := db.ImportGoSum(t.Context(), strings.NewReader(gosum))
+		require.ErrorIs(t, err, ErrGoSumMismatch)
+		require.ErrorContains(t, err, "github.com/google/uuid@v1.6.0")
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(2), size)
+	})
+
+	t.Run("malformed files", func(t *testing.T) {
+		tests := map[string]string{
+			"missing hash":      "example.com/a v1.0.0\n",
+			"unknown algorithm": "example.com/a v1.0.0 h2:a=\n",
+			"invalid version":   "example.com/a latest h1:a=\n",
+			"conflicting hash":  "example.com/a v1.0.0 h1:a=\nexample.com/a v1.0.0 h1:b=\n",
+		}
+
+		for name, gosum := range tests {
+			_, err := db.ImportGoSum(t.Context(), strings.NewReader(gosum))
+			require.ErrorIs(t, err, ErrMalformedRecord, name)
+		}
+	})
+}
@@ -0,0 +1,458 @@
+package sumdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/tree"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+	"golang.org/x/sync/singleflight"
+)
+
+type (
+	// collapsingHandler collapses identical concurrent requests so that only one is processed by the wrapped
+	// handler. The others wait for it and receive a copy of its response. Requests are identical when they have the
+	// same path and, if set, the same key.
+	//
+	// The shared request runs with the context of the request that started it, unless detach is set, in which case
+	// it runs on a context detached from it and bounded by detach (see WithDetachedLookups).
+	collapsingHandler struct {
+		next   http.Handler
+		match  func(*http.Request) bool
+		key    func(*http.Request) string
+		detach time.Duration
+		group  singleflight.Group
+	}
+
+	// lookupEntry is a formatted record served by /lookup.
+	lookupEntry struct {
+		id  int64
+		msg []byte
+	}
+
+	// bufferedResponse is an http.ResponseWriter that captures a response so it can be replayed to many clients.
+	bufferedResponse struct {
+		header http.Header
+		status int
+		body   bytes.Buffer
+	}
+)
+
+// tilePool holds the buffers hash tiles are serialized into, so that serving tiles doesn't allocate a new buffer per
+// request.
+var tilePool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, tlog.HashSize<<tree.TileHeight)
+		return &buf
+	},
+}
+
+// modVerRE matches the module@version portion of lookup paths. It is the same expression used by sumdb.Server.
+var modVerRE = regexp.MustCompile(`^[^@]+@v[0-9]+\.[0-9]+\.[0-9]+(-[^@]*)?(\+incompatible)?$`)
+
+// Handler returns an HTTP handler for serving the sumdb over HTTP.
+//
+// Identical concurrent lookup requests are collapsed, so that during a thundering herd on a popular module only one
+// request walks the store and signs the tree head. The others share its response, and its fate if its client goes
+// away, unless WithDetachedLookups is set.
+//
+// Tiles are serialized into pooled buffers rather than through sumdb.Server, which allocates the tile and its
+// hashes or records for every request. Tiles must be within the limits of the protocol and those configured with
+// WithReadLimits, and are otherwise answered with 400 Bad Request.
+//
+// CORS headers are added for the origins configured with WithCORS, and the server is wrapped in the middleware enabled
+// by opts: an access log (WithAccessLog), panic recovery (WithPanicRecovery) and per-endpoint latency histograms
+// (WithRequestMetrics).
+func (s *SumDB) Handler(opts ...HandlerOption) http.Handler {
+	lookup := s.lookupHandler()
+	return s.middleware(s.cors("GET, HEAD", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/lookup/"):
+			lookup.ServeHTTP(w, r)
+		case r.URL.Path == "/latest":
+			s.serveLatest(w, r)
+		default:
+			s.serveTilePath(w, r)
+		}
+	})), opts)
+}
+
+// LookupHandler returns an HTTP handler serving /lookup/<module>@<version> requests as Handler does, for mounting on a
+// ServeMux with its own middleware (e.g. authentication), as in
+//
+//	mux.Handle("GET /lookup/", auth(db.LookupHandler()))
+//
+// Like LatestHandler and TileHandler, it expects request paths as they are in the checksum database protocol, so
+// servers hosting it under a prefix must strip the prefix first. Other paths are answered with 404 Not Found.
+func (s *SumDB) LookupHandler() http.Handler {
+	lookup := s.lookupHandler()
+	return s.cors("GET, HEAD", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/lookup/") {
+			http.NotFound(w, r)
+			return
+		}
+		lookup.ServeHTTP(w, r)
+	}))
+}
+
+// LatestHandler returns an HTTP handler serving /latest requests (the signed tree head) as Handler does. See
+// LookupHandler.
+func (s *SumDB) LatestHandler() http.Handler {
+	return s.cors("GET, HEAD", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/latest" {
+			http.NotFound(w, r)
+			return
+		}
+		s.serveLatest(w, r)
+	}))
+}
+
+// TileHandler returns an HTTP handler serving /tile/H/L/N[.p/W] requests as Handler does. Tiles are immutable, apart
+// from partial tiles being superseded, so this is the handler to put behind a CDN. See LookupHandler.
+func (s *SumDB) TileHandler() http.Handler {
+	return s.cors("GET, HEAD", http.HandlerFunc(s.serveTilePath))
+}
+
+// lookupHandler returns the handler for /lookup requests, collapsing identical concurrent lookups. With
+// WithUpstreamIdentity, only lookups that would fetch with the same upstream credentials are identical.
+func (s *SumDB) lookupHandler() http.Handler {
+	h := &collapsingHandler{
+		next:   http.HandlerFunc(s.serveLookup),
+		match:  isLookupRequest,
+		detach: s.detachedLookupTimeout,
+	}
+	if s.upstreamIdentity != nil {
+		h.key = func(r *http.Request) string { return s.requesterIdentityKey(r.Context(), r) }
+	}
+	return h
+}
+
+// serveLatest serves /latest requests.
+func (s *SumDB) serveLatest(w http.ResponseWriter, r *http.Request) {
+	signed, err := s.Signed(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	_, _ = w.Write(signed)
+}
+
+// serveTilePath serves requests for tile paths, answering other paths with 404 Not Found.
+func (s *SumDB) serveTilePath(w http.ResponseWriter, r *http.Request) {
+	t, err := tlog.ParseTilePath(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.serveTile(w, r, t)
+}
+
+// serveLookup serves /lookup/<module>@<version> requests.
+//
+// It behaves like the lookup endpoint of sumdb.Server, except that the formatted record is served from the lookup
+// cache (see WithLookupCache) when possible. Records are immutable, so only the signed tree head needs to be
+// produced for each request. Lookups that exceed the budget configured with WithLookupBudget are answered with 202
+// Accepted while the record is created in the background.
+func (s *SumDB) serveLookup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.upstreamIdentity != nil {
+		ctx = WithRequester(ctx, r)
+	}
+
+	mod, ok := parseLookupPath(w, r)
+	if !ok {
+		return
+	}
+
+	entry, err := s.lookupWithinBudget(ctx, mod)
+	if errors.Is(err, errLookupPending) {
+		s.reportPending(w)
+		return
+	}
+	if errors.Is(err, ErrUpstreamUnavailable) {
+		s.reportUnavailable(w, mod, err)
+		return
+	}
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	// The tree head must include the record for clients to be able to verify it.
+	signed, err := s.signed(ctx, entry.id+1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The response is assembled in a pooled buffer so it's written in one go, letting net/http set its length.
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = append(append(*buf, entry.msg...), signed...)
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	_, _ = w.Write(*buf)
+}
+
+// parseLookupPath returns the module version requested by a /lookup/<module>@<version> request. Invalid requests are
+// answered with 400 Bad Request, and ok is false.
+func parseLookupPath(w http.ResponseWriter, r *http.Request) (mod module.Version, ok bool) {
+	escaped := strings.TrimPrefix(r.URL.Path, "/lookup/")
+	if !modVerRE.MatchString(escaped) {
+		http.Error(w, "invalid module@version syntax", http.StatusBadRequest)
+		return module.Version{}, false
+	}
+
+	escPath, escVers, _ := strings.Cut(escaped, "@")
+	path, err := module.UnescapePath(escPath)
+	if err != nil {
+		reportError(w, fmt.Errorf("%w: %w", ErrInvalidModule, err))
+		return module.Version{}, false
+	}
+
+	vers, err := module.UnescapeVersion(escVers)
+	if err != nil {
+		reportError(w, fmt.Errorf("%w: %w", ErrInvalidModule, err))
+		return module.Version{}, false
+	}
+
+	return module.Version{Path: path, Version: vers}, true
+}
+
+// serveTile serves /tile/H/L/N[.p/W] requests. Tiles are served from the tile cache (see WithTileCache) or, for full
+// tiles, the data saved by a Store implementing TileStore when possible, and are rebuilt otherwise.
+func (s *SumDB) serveTile(w http.ResponseWriter, r *http.Request, t tlog.Tile) {
+	if err := s.checkTile(t); err != nil {
+		reportError(w, err)
+		return
+	}
+
+	if data, ok := s.tileCache.get(t); ok {
+		s.observeTileCache(cacheHit)
+		writeTile(w, t, data)
+		return
+	}
+	s.observeTileCache(cacheMiss)
+
+	start := s.clock.Now()
+	if data, ok := s.readSavedTile(r.Context(), t); ok {
+		s.observeTileRead(t, start)
+		s.tileCache.add(t, data)
+		writeTile(w, t, data)
+		return
+	}
+
+	if t.L == -1 {
+		s.serveDataTile(w, r, t)
+		return
+	}
+	s.serveHashTile(w, r, t)
+}
+
+// writeTile writes the data of the tile t.
+func writeTile(w http.ResponseWriter, t tlog.Tile, data []byte) {
+	if t.L == -1 {
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	_, _ = w.Write(data)
+}
+
+// serveHashTile serves hash tiles (L >= 0).
+func (s *SumDB) serveHashTile(w http.ResponseWriter, r *http.Request, t tlog.Tile) {
+	buf := tilePool.Get().(*[]byte)
+	defer tilePool.Put(buf)
+
+	start := s.clock.Now()
+	data, err := tree.AppendTile(r.Context(), s.store, t, (*buf)[:0])
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+	*buf = data
+	s.observeTileRead(t, start)
+
+	s.saveTile(r.Context(), t, data)
+	s.tileCache.add(t, data)
+	writeTile(w, t, data)
+}
+
+// serveDataTile serves data tiles (L = -1), which hold the data of the tile's records, each followed by a blank line.
+// Tiles larger than the limit set with WithReadLimits aren't served.
+func (s *SumDB) serveDataTile(w http.ResponseWriter, r *http.Request, t tlog.Tile) {
+	start := t.N << uint(t.H)
+	began := s.clock.Now()
+	records, err := s.ReadRecords(r.Context(), start, int64(t.W))
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+	s.observeTileRead(t, began)
+
+	if len(records) != t.W {
+		http.Error(w, "invalid record count returned by ReadRecords", http.StatusInternalServerError)
+		return
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	for i, data := range records {
+		if !isValidRecordData(data) {
+			http.Error(w, fmt.Sprintf("%s: %d", ErrMalformedRecord, start+int64(i)), http.StatusInternalServerError)
+			return
+		}
+
+		if len(*buf)+len(data)+1 > s.maxDataTileSize {
+			reportError(w, fmt.Errorf("%w: data tile %s exceeds %d bytes", ErrReadLimitExceeded, t.Path(),
+				s.maxDataTileSize))
+			return
+		}
+		*buf = append(append(*buf, data...), '\n')
+	}
+
+	s.saveTile(r.Context(), t, *buf)
+	s.tileCache.add(t, *buf)
+	writeTile(w, t, *buf)
+}
+
+// lookupRecord returns the formatted record (as served by /lookup) for mod, creating it if necessary.
+func (s *SumDB) lookupRecord(ctx context.Context, mod module.Version) (lookupEntry, error) {
+	key := mod.String()
+	start := s.clock.Now()
+	if entry, ok := s.lookupCache.Get(key); ok {
+		s.observeLookupCache(cacheHit)
+		s.observeLookup(false, start, nil)
+		return entry, nil
+	}
+	s.observeLookupCache(cacheMiss)
+
+	id, err := s.Lookup(ctx, mod)
+	if err != nil {
+		return lookupEntry{}, err
+	}
+
+	records, err := s.ReadRecords(ctx, id, 1)
+	if err != nil {
+		return lookupEntry{}, err
+	}
+
+	if len(records) != 1 {
+		return lookupEntry{}, errors.New("invalid record count returned by ReadRecords")
+	}
+
+	msg, err := appendLookupRecord(make([]byte, 0, len(records[0])+lookupRecordOverhead), id, records[0])
+	if err != nil {
+		return lookupEntry{}, err
+	}
+
+	entry := lookupEntry{id: id, msg: msg}
+	s.lookupCache.Add(key, entry)
+	return entry, nil
+}
+
+// reportError reports err to w, using 404 for not-found errors, 400 for invalid modules and exceeded read limits, 403
+// for policy violations, 502 for upstream mismatches and verification failures, 503 when the spool is full or the
+// upstream is down and 500 for everything else.
+func reportError(w http.ResponseWriter, err error) {
+	switch {
+	case os.IsNotExist(err) || errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidModule), errors.Is(err, ErrReadLimitExceeded):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrPolicyDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrUpstreamMismatch), errors.Is(err, ErrUpstreamVerification):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	case errors.Is(err, ErrSpoolFull), errors.Is(err, ErrUpstreamUnavailable):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func isLookupRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/lookup/")
+}
+
+func (h *collapsingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.match(r) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	key := r.URL.Path
+	if h.key != nil {
+		key += "\x00" + h.key(r)
+	}
+
+	if h.detach <= 0 {
+		v, _, _ := h.group.Do(key, func() (any, error) {
+			br := newBufferedResponse()
+			h.next.ServeHTTP(br, r)
+			return br, nil
+		})
+		v.(*bufferedResponse).writeTo(w)
+		return
+	}
+
+	results := h.group.DoChan(key, func() (any, error) {
+		// The shared request isn't canceled because the client that happened to start it went away.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), h.detach)
+		defer cancel()
+
+		br := newBufferedResponse()
+		h.next.ServeHTTP(br, r.WithContext(ctx))
+		return br, nil
+	})
+
+	select {
+	case res := <-results:
+		res.Val.(*bufferedResponse).writeTo(w)
+	case <-r.Context().Done():
+	}
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header)}
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// writeTo copies the captured response to w.
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = slices.Clone(v)
+	}
+	if b.status != 0 {
+		w.WriteHeader(b.status)
+	}
+	_, _ = w.Write(b.body.Bytes())
+}
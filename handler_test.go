@@ -0,0 +1,357 @@
+package sumdb_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestHandler_CollapsesLookups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := NewMockStore(ctrl)
+	db, err := New("test.example.com", skey, WithStore(store))
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	store.EXPECT().
+		RecordID(gomock.Any(), "example.com/foo", "v1.0.0").
+		DoAndReturn(func(context.Context, string, string) (int64, error) {
+			<-release
+			return 0, nil
+		}).
+		Times(1)
+	store.EXPECT().
+		Records(gomock.Any(), int64(0), int64(1)).
+		Return([]*Record{{ID: 0, Data: []byte("example.com/foo v1.0.0 h1:abc=\n")}}, nil).
+		Times(1)
+	store.EXPECT().TreeSize(gomock.Any()).Return(int64(1), nil).Times(1)
+	store.EXPECT().ReadHashes(gomock.Any(), gomock.Any()).Return([]tlog.Hash{{1}}, nil).Times(1)
+
+	srv := httptest.NewServer(db.Handler())
+	defer srv.Close()
+
+	const clients = 10
+	bodies := make([]string, clients)
+
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Go(func() {
+			resp, err := http.Get(srv.URL + "/lookup/example.com/foo@v1.0.0") //nolint:noctx
+			require.NoError(t, err)
+			defer func() { _ = resp.Body.Close() }()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, "text/plain; charset=UTF-8", resp.Header.Get("Content-Type"))
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			bodies[i] = string(body)
+		})
+	}
+
+	// Give all clients a chance to join the in-flight lookup.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, body := range bodies {
+		require.Equal(t, bodies[0], body)
+	}
+	require.Contains(t, bodies[0], "example.com/foo v1.0.0 h1:abc=")
+}
+
+func TestHandler_DetachedLookups(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	// lookups starts a lookup request that's canceled once the fetch is under way, and another that joins it. It
+	// returns the second's response.
+	lookups := func(t *testing.T, opts ...Option) *httptest.ResponseRecorder {
+		t.Helper()
+
+		upstream := newFakeProxy(t)
+		upstream.setDelay(100 * time.Millisecond)
+		db, err := New("test.example.com", skey, append(opts, WithStore(newMemStore()),
+			WithUpstream(upstream.upstream(t)))...)
+		require.NoError(t, err)
+		h := db.Handler()
+
+		serve := func(ctx context.Context) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodGet, "/lookup/example.com/slow@v1.0.0", nil))
+			return rec
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		first := make(chan struct{})
+		go func() {
+			defer close(first)
+			serve(ctx)
+		}()
+		require.Eventually(t, func() bool { return len(upstream.requested()) > 0 }, time.Second, time.Millisecond)
+
+		second := make(chan *httptest.ResponseRecorder, 1)
+		go func() { second <- serve(t.Context()) }()
+
+		// Give the second lookup time to join the first.
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		<-first
+		return <-second
+	}
+
+	t.Run("attached", func(t *testing.T) {
+		second := lookups(t)
+		require.NotEqual(t, http.StatusOK, second.Code)
+	})
+
+	t.Run("detached", func(t *testing.T) {
+		second := lookups(t, WithDetachedLookups(time.Second))
+		require.Equal(t, http.StatusOK, second.Code, second.Body.String())
+	})
+
+	t.Run("detached lookups time out", func(t *testing.T) {
+		second := lookups(t, WithDetachedLookups(50*time.Millisecond))
+		require.NotEqual(t, http.StatusOK, second.Code)
+	})
+}
+
+func TestHandler_LookupCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := NewMockStore(ctrl)
+	db, err := New("test.example.com", skey, WithStore(store), WithLookupCache(10))
+	require.NoError(t, err)
+
+	// The record is only read once, and so is the tree hash: the tree size is checked for every request, but the
+	// tree head is only signed again once records are appended.
+	store.EXPECT().RecordID(gomock.Any(), "example.com/foo", "v1.0.0").Return(int64(0), nil).Times(1)
+	store.EXPECT().
+		Records(gomock.Any(), int64(0), int64(1)).
+		Return([]*Record{{ID: 0, Data: []byte("example.com/foo v1.0.0 h1:abc=\n")}}, nil).
+		Times(1)
+	store.EXPECT().TreeSize(gomock.Any()).Return(int64(1), nil).Times(2)
+	store.EXPECT().ReadHashes(gomock.Any(), gomock.Any()).Return([]tlog.Hash{{1}}, nil).Times(1)
+
+	handler := db.Handler()
+	for range 2 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/foo@v1.0.0", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), "example.com/foo v1.0.0 h1:abc=")
+	}
+}
+
+func TestHandler_InvalidLookup(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	db, err := New("test.example.com", skey)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/foo@latest", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_Tiles(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := newMemStore()
+	upstream := newFakeProxy(t)
+	db, err := New("test.example.com", skey, WithStore(store), WithUpstream(upstream.upstream(t)))
+	require.NoError(t, err)
+
+	for i := range 300 {
+		_, err := db.Lookup(t.Context(), module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"})
+		require.NoError(t, err)
+	}
+
+	handler := db.Handler()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	hr := hashReaderFunc(func(indexes []int64) ([]tlog.Hash, error) { return store.ReadHashes(t.Context(), indexes) })
+	for _, path := range []string{"tile/8/0/000", "tile/8/0/001.p/44", "tile/8/1/000.p/1"} {
+		tile, err := tlog.ParseTilePath(path)
+		require.NoError(t, err)
+		want, err := tlog.ReadTileData(tile, hr)
+		require.NoError(t, err)
+
+		// Served twice, so the second response reuses a pooled buffer.
+		for range 2 {
+			rec := get("/" + path)
+			require.Equal(t, http.StatusOK, rec.Code, path)
+			require.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+			require.Equal(t, want, rec.Body.Bytes(), path)
+		}
+	}
+
+	// Data tiles hold the records themselves.
+	rec := get("/tile/8/data/001.p/44")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "example.com/mod256 v1.0.0")
+
+	rec = get("/tile/8/0/002")
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+// hashReaderFunc adapts a function to tlog.HashReader.
+type hashReaderFunc func([]int64) ([]tlog.Hash, error)
+
+func (f hashReaderFunc) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	return f(indexes)
+}
+
+func TestHandler_LookupFormat(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := newMemStore()
+	upstream := newFakeProxy(t)
+	db, err := New("test.example.com", skey, WithStore(store), WithUpstream(upstream.upstream(t)))
+	require.NoError(t, err)
+
+	mod := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	id, err := db.Lookup(t.Context(), mod)
+	require.NoError(t, err)
+	recs, err := db.ReadRecords(t.Context(), id, 1)
+	require.NoError(t, err)
+	want, err := tlog.FormatRecord(id, recs[0])
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/foo@v1.0.0", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, bytes.HasPrefix(rec.Body.Bytes(), want))
+
+	// Records that tlog.FormatRecord would reject aren't served.
+	_, err = store.AddRecord(t.Context(), &Record{Path: "example.com/bad", Version: "v1.0.0", Data: []byte("bad\n\n")})
+	require.NoError(t, err)
+	require.NoError(t, store.SetTreeSize(t.Context(), 2))
+
+	rec = httptest.NewRecorder()
+	db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/bad@v1.0.0", nil))
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func BenchmarkHandler_Lookup(b *testing.B) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(b, err)
+
+	upstream := newFakeProxy(b)
+	for name, opts := range map[string][]Option{
+		"uncached": nil,
+		"cached":   {WithLookupCache(10), WithSTHMaxStaleness(time.Minute)},
+	} {
+		b.Run(name, func(b *testing.B) {
+			opts = append(opts, WithStore(newMemStore()), WithUpstream(upstream.upstream(b)))
+			db, err := New("test.example.com", skey, opts...)
+			require.NoError(b, err)
+
+			_, err = db.Lookup(b.Context(), module.Version{Path: "example.com/foo", Version: "v1.0.0"})
+			require.NoError(b, err)
+
+			handler := db.Handler()
+			req := httptest.NewRequest(http.MethodGet, "/lookup/example.com/foo@v1.0.0", nil)
+			b.ReportAllocs()
+			for b.Loop() {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK {
+					b.Fatal(rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_Endpoints(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(newFakeProxy(t).upstream(t)),
+		WithCORS("*"),
+	)
+	require.NoError(t, err)
+
+	for i := range 3 {
+		_, err := db.Lookup(t.Context(), module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"})
+		require.NoError(t, err)
+	}
+
+	// The handlers can be mounted separately, each with its own middleware.
+	var authorized []string
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorized = append(authorized, r.URL.Path)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /lookup/", auth(db.LookupHandler()))
+	mux.Handle("GET /latest", db.LatestHandler())
+	mux.Handle("GET /tile/", db.TileHandler())
+
+	serve := func(h http.Handler, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Origin", "https://dash.example.com")
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, path := range []string{
+		"/latest",
+		"/lookup/example.com/mod1@v1.0.0",
+		"/lookup/example.com/mod1@latest",
+		"/tile/8/0/000.p/3",
+		"/tile/8/data/000.p/3",
+		"/tile/8/0/001",
+	} {
+		want, got := serve(db.Handler(), path), serve(mux, path)
+		require.Equal(t, want.Code, got.Code, path)
+		require.Equal(t, want.Header(), got.Header(), path)
+		require.Equal(t, want.Body.String(), got.Body.String(), path)
+		require.Equal(t, "*", got.Header().Get("Access-Control-Allow-Origin"), path)
+	}
+	require.Equal(t, []string{
+		"/lookup/example.com/mod1@v1.0.0",
+		"/lookup/example.com/mod1@latest",
+	}, authorized)
+
+	// Each handler only serves its own endpoint.
+	require.Equal(t, http.StatusNotFound, serve(db.LookupHandler(), "/latest").Code)
+	require.Equal(t, http.StatusNotFound, serve(db.LatestHandler(), "/tile/8/0/000.p/3").Code)
+	require.Equal(t, http.StatusNotFound, serve(db.TileHandler(), "/lookup/example.com/mod1@v1.0.0").Code)
+	require.Equal(t, http.StatusNotFound, serve(db.Handler(), "/other").Code)
+}
@@ -0,0 +1,41 @@
+package sumdb
+
+import (
+	"context"
+	"fmt"
+)
+
+// AppendHook is called within the transaction appending each record, once the record with the given ID has been added
+// to tx and the tree updated, so that derived indexes kept in the same database are updated atomically with the log.
+// Returning an error aborts the append, which is rolled back when the Store implements TxStore. See WithAppendHook.
+//
+// Hooks are called while appends are serialized, so they should be quick, and must only use tx to access the store.
+type AppendHook func(ctx context.Context, tx Store, id int64, rec *Record) error
+
+// runAppendHooks calls the store's OnAppend, if it implements AppendHookStore, followed by the hooks configured with
+// WithAppendHook, for the record with the given ID that was just appended to tx.
+func (s *SumDB) runAppendHooks(ctx context.Context, tx Store, id int64, rec *Record) error {
+	if err := onAppend(ctx, tx, id, rec); err != nil {
+		return err
+	}
+
+	for _, hook := range s.appendHooks {
+		if err := hook(ctx, tx, id, rec); err != nil {
+			return fmt.Errorf("append hook failed: %s@%s, %w", rec.Path, rec.Version, err)
+		}
+	}
+	return nil
+}
+
+// onAppend calls the OnAppend method of tx, if it implements AppendHookStore.
+func onAppend(ctx context.Context, tx Store, id int64, rec *Record) error {
+	hs, ok := tx.(AppendHookStore)
+	if !ok {
+		return nil
+	}
+
+	if err := hs.OnAppend(ctx, id, rec); err != nil {
+		return fmt.Errorf("store append hook failed: %s@%s, %w", rec.Path, rec.Version, err)
+	}
+	return nil
+}
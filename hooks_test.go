@@ -0,0 +1,142 @@
+package sumdb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestAppendHooks(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	store := newIndexedStore()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(upstream.upstream(t)),
+		WithAppendHook(func(ctx context.Context, tx Store, id int64, rec *Record) error {
+			// The record has been appended to the transaction the hook is given.
+			got, err := tx.RecordID(ctx, rec.Path, rec.Version)
+			if err != nil {
+				return err
+			}
+			if got != id {
+				return fmt.Errorf("record %s has ID %d, want %d", rec.Path, got, id)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, fmt.Sprintf("%d %s@%s", id, rec.Path, rec.Version))
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+	require.NoError(t, err)
+	_, err = db.AddRecords(t.Context(), []module.Version{
+		{Path: "example.com/a", Version: "v1.1.0"},
+		{Path: "example.com/b", Version: "v1.0.0"},
+	})
+	require.NoError(t, err)
+	_, err = db.ImportGoSum(t.Context(), strings.NewReader(testGoSum))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"0 example.com/a@v1.0.0",
+		"1 example.com/a@v1.1.0",
+		"2 example.com/b@v1.0.0",
+		"3 github.com/google/uuid@v1.6.0",
+		"4 golang.org/x/sync@v0.19.0",
+	}, calls)
+
+	// The store's own hook is called too.
+	require.Equal(t, map[string][]string{
+		"example.com/a":          {"v1.0.0", "v1.1.0"},
+		"example.com/b":          {"v1.0.0"},
+		"github.com/google/uuid": {"v1.6.0"},
+		"golang.org/x/sync":      {"v0.19.0"},
+	}, store.versions)
+
+	t.Run("replicas", func(t *testing.T) {
+		srv := httptest.NewServer(db.ReplicationHandler())
+		t.Cleanup(srv.Close)
+
+		replicaStore := newIndexedStore()
+		replica, err := NewReplica(srv.URL, vkey, replicaStore, nil)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan error, 1)
+		go func() { done <- replica.Run(ctx) }()
+
+		signed, err := db.Signed(t.Context())
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return string(replica.Signed()) == string(signed) },
+			5*time.Second, 10*time.Millisecond)
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+
+		require.Equal(t, store.versions, replicaStore.versions)
+	})
+}
+
+func TestAppendHooks_Errors(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	errHook := errors.New("index unavailable")
+	store := memstore.New()
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(newFakeProxy(t).upstream(t)),
+		WithAppendHook(func(context.Context, Store, int64, *Record) error { return errHook }),
+	)
+	require.NoError(t, err)
+
+	mod := module.Version{Path: "example.com/a", Version: "v1.0.0"}
+	_, err = db.Lookup(t.Context(), mod)
+	require.ErrorIs(t, err, errHook)
+
+	_, err = db.AddRecords(t.Context(), []module.Version{mod})
+	require.ErrorIs(t, err, errHook)
+
+	// The appends were rolled back.
+	size, err := store.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Zero(t, size)
+
+	_, err = store.RecordID(t.Context(), mod.Path, mod.Version)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+// indexedStore is a memStore maintaining an index of the versions of each module path.
+type indexedStore struct {
+	*memStore
+	versions map[string][]string
+}
+
+func newIndexedStore() *indexedStore {
+	return &indexedStore{memStore: newMemStore(), versions: make(map[string][]string)}
+}
+
+func (s *indexedStore) OnAppend(_ context.Context, _ int64, rec *Record) error {
+	s.versions[rec.Path] = append(s.versions[rec.Path], rec.Version)
+	return nil
+}
@@ -0,0 +1,392 @@
+package sumdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// ErrSnapshotMismatch is returned by ImportTiles when the snapshot's records or tiles don't match its signed tree
+// head.
+var ErrSnapshotMismatch = errors.New("snapshot does not match signed tree head")
+
+type (
+	// tileDir is a tlog.TileReader backed by a directory laid out like the sumdb HTTP API (i.e. latest and tile/...).
+	tileDir struct {
+		dir string
+	}
+
+	// tileSource reads the tiles of a tree whose records are being copied, such as a snapshot directory or an upstream
+	// checksum database.
+	tileSource interface {
+		tlog.TileReader
+
+		// records reads and parses the records in the data tile t.
+		records(t tlog.Tile) ([]*Record, error)
+	}
+
+	// verifiedTile holds the records of a data tile, starting at ID start, that have been authenticated against the
+	// signed tree head.
+	verifiedTile struct {
+		start int64
+		recs  []*Record
+		err   error
+	}
+)
+
+// ImportTiles appends the records of a locally stored sumdb snapshot (e.g. one produced by crawling sum.golang.org)
+// to the tree, without contacting the upstream proxy. This is intended for the initial bulk seeding of servers that
+// can't reach a public sumdb directly.
+//
+// dir must be laid out like the sumdb HTTP API: a signed tree head in dir/latest and the tiles under dir/tile. Partial
+// tiles may be omitted when the corresponding full tile is present. The tree head is verified with vkey and every
+// record is authenticated against it before being added.
+//
+// Records are authenticated by a pool of workers (see WithVerifyWorkers) and appended in snapshot order. Records that
+// already exist in the store are skipped, so an interrupted import can simply be restarted. It returns the number of
+// records added.
+func (s *SumDB) ImportTiles(ctx context.Context, dir, vkey string) (int64, error) {
+	td := &tileDir{dir: dir}
+	t, err := td.latest(vkey)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var added int64
+	for res := range verifyTiles(ctx, td, t, 0, s.verifyWorkers, ErrSnapshotMismatch) {
+		tile := <-res
+		if tile.err != nil {
+			return added, tile.err
+		}
+
+		n, err := s.limitedImport(ctx, tile.recs, false)
+		added += n
+		if err != nil {
+			return added, err
+		}
+	}
+
+	return added, ctx.Err()
+}
+
+// verifyTiles reads and authenticates the records of t from the given ID onwards, a data tile at a time, across a pool
+// of workers. Records that don't match t are reported with errors wrapping mismatch. The returned channel
+// yields a channel per tile, in tile order, which receives the tile once it has been verified. This keeps appends
+// ordered while verification (which is CPU bound) runs ahead of them.
+func verifyTiles(
+	ctx context.Context,
+	src tileSource,
+	t tlog.Tree,
+	from int64,
+	workers int,
+	mismatch error,
+) <-chan chan verifiedTile {
+	workers = max(1, workers)
+	hr := tlog.TileHashReader(t, src)
+	sem := make(chan struct{}, workers)
+	tiles := make(chan chan verifiedTile, workers)
+
+	go func() {
+		defer close(tiles)
+
+		for n := from >> tree.TileHeight; n<<tree.TileHeight < t.N; n++ {
+			res := make(chan verifiedTile, 1)
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case tiles <- res:
+			case <-ctx.Done():
+				return
+			}
+
+			go func() {
+				defer func() { <-sem }()
+
+				start := n << tree.TileHeight
+				recs, err := src.records(tlog.Tile{
+					H: tree.TileHeight,
+					L: -1,
+					N: n,
+					W: int(min(1<<tree.TileHeight, t.N-start)),
+				})
+				if err == nil && start < from {
+					recs, start = recs[from-start:], from
+				}
+				if err == nil {
+					err = verifyRecords(hr, start, recs, mismatch)
+				}
+				res <- verifiedTile{start: start, recs: recs, err: err}
+			}()
+		}
+	}()
+
+	return tiles
+}
+
+// importRecords adds the records of recs that don't already exist to the tree in a single transaction, computing
+// the tree hashes once for all of them, and returns the number of records added. When the records were fetched from
+// the upstreams (rather than imported from another log), new records go through the record pipeline's append stages
+// and are checked for typosquatting, as they are by Lookup. Imports are batch work unless ctx says otherwise (see
+// WithPriority).
+func (s *SumDB) importRecords(ctx context.Context, recs []*Record, fetched bool) (int64, error) {
+	if err := s.appendQueue.acquire(ctx, priorityFrom(ctx, PriorityBatch)); err != nil {
+		return 0, err
+	}
+	defer s.appendQueue.release()
+
+	unlock, err := s.lockAppends(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	var (
+		size     int64
+		added    []*Record
+		warnings []*TyposquatWarning
+	)
+	err = s.withTx(ctx, func(store Store) error {
+		added, warnings = nil, nil
+
+		var err error
+		if size, err = store.TreeSize(ctx); err != nil {
+			return fmt.Errorf("failed to get tree size: %w", err)
+		}
+
+		for _, rec := range recs {
+			_, err := store.RecordID(ctx, rec.Path, rec.Version)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("failed to find record id: %w", err)
+			}
+
+			if err := s.checkRecordData(rec); err != nil {
+				return err
+			}
+
+			if fetched {
+				if err := s.preAppend(ctx, store, rec); err != nil {
+					return err
+				}
+			}
+
+			if _, err := store.AddRecord(ctx, rec); err != nil {
+				return fmt.Errorf("failed to add new record: %s@%s, %w", rec.Path, rec.Version, err)
+			}
+			added = append(added, rec)
+		}
+
+		data := make([][]byte, len(added))
+		for i, rec := range added {
+			data[i] = rec.Data
+		}
+		if err := tree.AddRecords(ctx, store, size, data); err != nil {
+			return fmt.Errorf("failed to update tree hashes: %w", err)
+		}
+
+		for i, rec := range added {
+			id := size + int64(i)
+			if fetched {
+				if err := storeAnnotations(ctx, store, id, rec); err != nil {
+					return err
+				}
+
+				warning, err := s.typosquat.check(ctx, store, id, rec)
+				if err != nil {
+					return fmt.Errorf("failed to check for typosquatting: %s@%s, %w", rec.Path, rec.Version, err)
+				}
+				if warning != nil {
+					warnings = append(warnings, warning)
+				}
+			}
+
+			if err := s.runAppendHooks(ctx, store, id, rec); err != nil {
+				return err
+			}
+
+			if err := s.addOutboxEvent(ctx, store, id, rec); err != nil {
+				return err
+			}
+		}
+
+		if len(added) == 0 {
+			return nil
+		}
+		return addCheckpoint(ctx, store, size+int64(len(added)), s.clock.Now())
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, rec := range added {
+		s.recordAdded(rec.Path, rec.Version)
+	}
+	if len(added) > 0 {
+		s.appended.notify()
+		s.observeAppend(int64(len(added)), size+int64(len(added)))
+		s.logRecordsImported(ctx, int64(len(added)), size+int64(len(added)))
+		s.logTreeSize(ctx, size+int64(len(added)))
+	}
+	for _, w := range warnings {
+		s.typosquat.warn(w)
+	}
+	if fetched {
+		for i, rec := range added {
+			s.postAppend(ctx, size+int64(i), rec)
+		}
+	}
+	return int64(len(added)), nil
+}
+
+// verifyRecords authenticates recs, the records starting at id start, against the tree read by hr. Records that don't
+// match the tree are reported with errors wrapping mismatch.
+func verifyRecords(hr tlog.HashReader, start int64, recs []*Record, mismatch error) error {
+	indexes := make([]int64, len(recs))
+	for i := range recs {
+		indexes[i] = tlog.StoredHashIndex(0, start+int64(i))
+	}
+
+	hashes, err := hr.ReadHashes(indexes)
+	if err != nil {
+		return fmt.Errorf("%w: %w", mismatch, err)
+	}
+
+	for i, rec := range recs {
+		if hashes[i] != tlog.RecordHash(rec.Data) {
+			return fmt.Errorf("%w: record %d", mismatch, start+int64(i))
+		}
+
+		// The data is authenticated by its hash, so it can't be normalized without changing the tree. Records that
+		// aren't normalized are refused rather than stored in a form go clients may not accept.
+		mod := module.Version{Path: rec.Path, Version: rec.Version}
+		if norm, err := NormalizeRecordData(mod, rec.Data); err != nil || !bytes.Equal(norm, rec.Data) {
+			return fmt.Errorf("%w: record %d isn't normalized: %w", mismatch, start+int64(i), ErrMalformedRecord)
+		}
+	}
+
+	return nil
+}
+
+// latest reads the snapshot's signed tree head and verifies it with vkey.
+func (d *tileDir) latest(vkey string) (tlog.Tree, error) {
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("invalid verifier key: %w", err)
+	}
+
+	msg, err := os.ReadFile(filepath.Join(d.dir, "latest"))
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("failed to read signed tree head: %w", err)
+	}
+
+	n, err := note.Open(msg, note.VerifierList(verifier))
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("failed to verify signed tree head: %w", err)
+	}
+
+	t, err := tlog.ParseTree([]byte(n.Text))
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("failed to parse signed tree head: %w", err)
+	}
+
+	return t, nil
+}
+
+// Height implements tlog.TileReader.
+func (d *tileDir) Height() int { return tree.TileHeight }
+
+// ReadTiles implements tlog.TileReader.
+func (d *tileDir) ReadTiles(tiles []tlog.Tile) ([][]byte, error) {
+	data := make([][]byte, len(tiles))
+	for i, t := range tiles {
+		b, err := d.read(t)
+		if err != nil {
+			return nil, err
+		}
+
+		size := t.W * tlog.HashSize
+		if len(b) < size {
+			return nil, fmt.Errorf("%w: short tile %s", ErrSnapshotMismatch, t.Path())
+		}
+		data[i] = b[:size]
+	}
+	return data, nil
+}
+
+// SaveTiles implements tlog.TileReader. Tiles are already on disk, so there's nothing to do.
+func (d *tileDir) SaveTiles([]tlog.Tile, [][]byte) {}
+
+// records reads and parses the records in the data tile t.
+func (d *tileDir) records(t tlog.Tile) ([]*Record, error) {
+	b, err := d.read(t)
+	if err != nil {
+		return nil, err
+	}
+	return parseDataTile(t, b, ErrSnapshotMismatch)
+}
+
+// read returns the contents of tile t, falling back to the full tile when a partial tile isn't present.
+func (d *tileDir) read(t tlog.Tile) ([]byte, error) {
+	b, err := os.ReadFile(filepath.Join(d.dir, filepath.FromSlash(t.Path())))
+	if errors.Is(err, fs.ErrNotExist) && t.W < 1<<t.H {
+		t.W = 1 << t.H
+		b, err = os.ReadFile(filepath.Join(d.dir, filepath.FromSlash(t.Path())))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tile %s: %w", t.Path(), err)
+	}
+	return b, nil
+}
+
+// parseDataTile parses the records of the data tile t from its contents b, reporting tiles that don't hold t.W records
+// with errors wrapping mismatch.
+func parseDataTile(t tlog.Tile, b []byte, mismatch error) ([]*Record, error) {
+	// Data tiles contain each record followed by a blank line. Full tiles may hold more records than needed when
+	// they're read in place of a missing partial tile.
+	recs := make([]*Record, 0, t.W)
+	for len(recs) < t.W {
+		end := bytes.Index(b, []byte("\n\n"))
+		if end < 0 {
+			return nil, fmt.Errorf("%w: tile %s has %d records, want %d", mismatch, t.Path(), len(recs), t.W)
+		}
+
+		rec, err := parseRecord(b[:end+1])
+		b = b[end+2:]
+		if err != nil {
+			return nil, fmt.Errorf("%w: tile %s: %w", mismatch, t.Path(), err)
+		}
+		recs = append(recs, rec)
+	}
+
+	return recs, nil
+}
+
+// parseRecord extracts the module path and version from the first line of the record data.
+func parseRecord(data []byte) (*Record, error) {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	f := strings.Fields(string(line))
+	if len(f) != 3 || f[0] == "" || strings.HasSuffix(f[1], "/go.mod") {
+		return nil, fmt.Errorf("%w: %q", ErrMalformedRecord, line)
+	}
+
+	return &Record{Path: f[0], Version: f[1], Data: data}, nil
+}
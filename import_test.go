@@ -0,0 +1,279 @@
+package sumdb_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/signer"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestImportTiles(t *testing.T) {
+	skey, vkey, err := GenerateKeys("sum.example.com")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	recs := writeTileSnapshot(t, dir, skey, 300)
+
+	store := newMemStore()
+	db, err := New("test.example.com", skey, WithStore(store))
+	require.NoError(t, err)
+
+	// A directory without a signed tree head is rejected.
+	_, err = db.ImportTiles(t.Context(), t.TempDir(), vkey)
+	require.ErrorContains(t, err, "failed to read signed tree head")
+
+	added, err := db.ImportTiles(t.Context(), dir, vkey)
+	require.NoError(t, err)
+	require.Equal(t, int64(300), added)
+
+	data, err := readRecords(t.Context(), db, 0, 300)
+	require.NoError(t, err)
+	require.Equal(t, recs, data)
+
+	t.Run("skips existing records", func(t *testing.T) {
+		added, err := db.ImportTiles(t.Context(), dir, vkey)
+		require.NoError(t, err)
+		require.Zero(t, added)
+	})
+
+	t.Run("wrong verifier key", func(t *testing.T) {
+		_, otherKey, err := GenerateKeys("sum.example.com")
+		require.NoError(t, err)
+
+		_, err = db.ImportTiles(t.Context(), dir, otherKey)
+		require.ErrorContains(t, err, "failed to verify signed tree head")
+	})
+
+	t.Run("tampered record", func(t *testing.T) {
+		path := filepath.Join(dir, "tile", "8", "data", "001.p", "44")
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		data[len(data)-3] ^= 1
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+
+		db, err := New("test.example.com", skey, WithStore(newMemStore()))
+		require.NoError(t, err)
+
+		added, err := db.ImportTiles(t.Context(), dir, vkey)
+		require.ErrorIs(t, err, ErrSnapshotMismatch)
+		require.Equal(t, int64(256), added)
+	})
+	t.Run("records that aren't normalized", func(t *testing.T) {
+		// The second record has trailing whitespace, which can't be removed without changing its hash.
+		dir := t.TempDir()
+		writeSnapshotRecords(t, dir, skey, [][]byte{
+			[]byte("example.com/foo v1.0.0 h1:zip=\nexample.com/foo v1.0.0/go.mod h1:mod=\n"),
+			[]byte("example.com/bar v1.0.0 h1:zip= \nexample.com/bar v1.0.0/go.mod h1:mod=\n"),
+		})
+
+		db, err := New("test.example.com", skey, WithStore(newMemStore()))
+		require.NoError(t, err)
+
+		_, err = db.ImportTiles(t.Context(), dir, vkey)
+		require.ErrorIs(t, err, ErrSnapshotMismatch)
+		require.ErrorIs(t, err, ErrMalformedRecord)
+	})
+}
+
+func TestImportTiles_VerifyWorkers(t *testing.T) {
+	skey, vkey, err := GenerateKeys("sum.example.com")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	recs := writeTileSnapshot(t, dir, skey, 1000)
+
+	for _, workers := range []int{1, 3, 16} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			db, err := New("test.example.com", skey, WithStore(newMemStore()), WithVerifyWorkers(workers))
+			require.NoError(t, err)
+
+			added, err := db.ImportTiles(t.Context(), dir, vkey)
+			require.NoError(t, err)
+			require.Equal(t, int64(len(recs)), added)
+
+			data, err := readRecords(t.Context(), db, 0, added)
+			require.NoError(t, err)
+			require.Equal(t, recs, data)
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		db, err := New("test.example.com", skey, WithStore(newMemStore()), WithVerifyWorkers(4))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		_, err = db.ImportTiles(ctx, dir, vkey)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// writeTileSnapshot writes a snapshot of a tree with n records to dir, laid out like the sumdb HTTP API.
+func writeTileSnapshot(t *testing.T, dir, skey string, n int64) [][]byte {
+	t.Helper()
+
+	recs := make([][]byte, n)
+	for i := range n {
+		recs[i] = fmt.Appendf(nil,
+			"example.com/mod%d v1.0.0 h1:mod%d=\nexample.com/mod%d v1.0.0/go.mod h1:gomod%d=\n",
+			i, i, i, i,
+		)
+	}
+
+	writeSnapshotRecords(t, dir, skey, recs)
+	return recs
+}
+
+// writeSnapshotRecords writes a snapshot of the log holding recs to dir.
+func writeSnapshotRecords(t *testing.T, dir, skey string, recs [][]byte) {
+	t.Helper()
+
+	n := int64(len(recs))
+	hashes := make(hashMap)
+	for i := range n {
+		stored, err := tlog.StoredHashes(i, recs[i], hashes)
+		require.NoError(t, err)
+		for j, h := range stored {
+			hashes[tlog.StoredHashIndex(0, i)+int64(j)] = h
+		}
+	}
+
+	for _, tile := range tlog.NewTiles(8, 0, n) {
+		data, err := tlog.ReadTileData(tile, hashes)
+		require.NoError(t, err)
+		writeFile(t, filepath.Join(dir, filepath.FromSlash(tile.Path())), data)
+
+		if tile.L == 0 {
+			tile.L = -1
+			var data []byte
+			for _, rec := range recs[tile.N<<8 : tile.N<<8+int64(tile.W)] {
+				data = append(append(data, rec...), '\n')
+			}
+			writeFile(t, filepath.Join(dir, filepath.FromSlash(tile.Path())), data)
+		}
+	}
+
+	th, err := tlog.TreeHash(n, hashes)
+	require.NoError(t, err)
+
+	s, err := signer.NewSigner(skey)
+	require.NoError(t, err)
+
+	signed, err := note.Sign(&note.Note{Text: string(tlog.FormatTree(tlog.Tree{N: n, Hash: th}))}, s)
+	require.NoError(t, err)
+	writeFile(t, filepath.Join(dir, "latest"), signed)
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+// hashMap is a tlog.HashReader backed by a map.
+type hashMap map[int64]tlog.Hash
+
+func (m hashMap) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	out := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		h, ok := m[idx]
+		if !ok {
+			return nil, fmt.Errorf("missing hash %d", idx)
+		}
+		out[i] = h
+	}
+	return out, nil
+}
+
+// memStore is a minimal in-memory Store.
+type memStore struct {
+	mu      sync.Mutex
+	records []*Record
+	ids     map[string]int64
+	hashes  map[int64]tlog.Hash
+	size    int64
+}
+
+func newMemStore() *memStore {
+	return &memStore{ids: make(map[string]int64), hashes: make(map[int64]tlog.Hash)}
+}
+
+func (s *memStore) RecordID(_ context.Context, path, version string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.ids[path+"@"+version]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return id, nil
+}
+
+func (s *memStore) Records(_ context.Context, id, n int64) ([]*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := min(id+n, int64(len(s.records)))
+	if id >= end {
+		return nil, nil
+	}
+	return s.records[id:end], nil
+}
+
+func (s *memStore) AddRecord(_ context.Context, r *Record) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := int64(len(s.records))
+	s.records = append(s.records, &Record{ID: id, Path: r.Path, Version: r.Version, Data: r.Data, Published: r.Published})
+	s.ids[r.Path+"@"+r.Version] = id
+	return id, nil
+}
+
+func (s *memStore) ReadHashes(_ context.Context, indexes []int64) ([]tlog.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		h, ok := s.hashes[idx]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrMissingHash, idx)
+		}
+		out[i] = h
+	}
+	return out, nil
+}
+
+func (s *memStore) WriteHashes(_ context.Context, indexes []int64, hashes []tlog.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, idx := range indexes {
+		s.hashes[idx] = hashes[i]
+	}
+	return nil
+}
+
+func (s *memStore) TreeSize(context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size, nil
+}
+
+func (s *memStore) SetTreeSize(_ context.Context, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.size = size
+	return nil
+}
@@ -0,0 +1,148 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pseudomuto/sumdb/internal/proxy"
+	"github.com/pseudomuto/sumdb/internal/sumdbclient"
+	"golang.org/x/mod/module"
+)
+
+var (
+	// ErrUpstreamVerification is returned by Lookup when a record fetched from a trusted checksum database (see
+	// WithTrustedSumDB and WithIngestRoutes) can't be verified against its signed tree, or the tree is inconsistent
+	// with one seen before.
+	ErrUpstreamVerification = sumdbclient.ErrVerification
+
+	// ErrInvalidIngestRoute is returned by New when a route given to WithIngestRoutes has no pattern, or doesn't have
+	// exactly one of a proxy or a checksum database.
+	ErrInvalidIngestRoute = errors.New("invalid ingest route")
+)
+
+type (
+	// IngestRoute routes the creation of records for the modules matching Pattern either to a module proxy, whose
+	// modules are downloaded and hashed, or to a checksum database, whose records are trusted once verified. See
+	// WithIngestRoutes.
+	IngestRoute struct {
+		// Pattern is a comma-separated list of glob patterns matched against module path prefixes, using the same
+		// syntax as GOPRIVATE (e.g. "github.com/acme/*,go.acme.dev").
+		Pattern string
+
+		// Proxy is the module proxy to hash modules from.
+		Proxy *url.URL
+
+		// SumDB is the checksum database to trust records from, and SumDBKey its verifier key.
+		SumDB    *url.URL
+		SumDBKey string
+	}
+
+	// ingestRoute is a resolved IngestRoute. Records are taken from sumdb when it's set, and hashed from proxy
+	// otherwise. proxy (and its base URL, upstream) is also used for policy checks. source is the base URL records are
+	// taken from: the checksum database's, or upstream.
+	ingestRoute struct {
+		pattern  string
+		upstream string
+		source   string
+		proxy    *proxy.Proxy
+		sumdb    *sumdbclient.Client
+	}
+
+	// fetchUpstreams are the clients a record is fetched and checked with: the route's proxy, and the secondary
+	// upstream and upstream checksum database, when they're configured (see WithSecondaryUpstream and
+	// WithUpstreamSumDB). They're the SumDB's own, or ones recording their responses for replays.
+	fetchUpstreams struct {
+		proxy     *proxy.Proxy
+		secondary *proxy.Proxy
+		sumdb     *sumdbclient.Client
+	}
+)
+
+// configureRoutes resolves the routes given to WithIngestRoutes, and the default route taken by modules that don't
+// match any of them: the trusted checksum database if one was given to WithTrustedSumDB, or the upstream proxy. It
+// also creates the client of the checksum database given to WithUpstreamSumDB.
+func (s *SumDB) configureRoutes(proxyOpts []proxy.Option) error {
+	s.defaultRoute = &ingestRoute{upstream: s.upstream, source: s.upstream, proxy: s.proxy}
+	if s.trustedSumDB != "" {
+		c, err := sumdbclient.New(s.http, s.trustedSumDB, s.trustedVKey)
+		if err != nil {
+			return fmt.Errorf("invalid trusted sumdb: %w", err)
+		}
+		s.defaultRoute.sumdb = c
+		s.defaultRoute.source = s.trustedSumDB
+	}
+
+	if s.upstreamSumDBURL != "" {
+		c, err := sumdbclient.New(s.http, s.upstreamSumDBURL, s.upstreamSumDBKey)
+		if err != nil {
+			return fmt.Errorf("invalid upstream sumdb: %w", err)
+		}
+		s.upstreamSumDB = c
+	}
+
+	for _, r := range s.ingestRoutes {
+		if r.Pattern == "" || (r.Proxy == nil) == (r.SumDB == nil) {
+			return fmt.Errorf("%w: %q", ErrInvalidIngestRoute, r.Pattern)
+		}
+
+		route := &ingestRoute{pattern: r.Pattern, upstream: s.upstream, proxy: s.proxy}
+		if r.Proxy != nil {
+			route.upstream = baseURL(r.Proxy)
+			route.source = route.upstream
+			route.proxy = proxy.New(s.http, route.upstream, proxyOpts...)
+		} else {
+			route.source = baseURL(r.SumDB)
+			c, err := sumdbclient.New(s.http, baseURL(r.SumDB), r.SumDBKey)
+			if err != nil {
+				return fmt.Errorf("%w: %q, %w", ErrInvalidIngestRoute, r.Pattern, err)
+			}
+			route.sumdb = c
+		}
+		s.routes = append(s.routes, route)
+	}
+
+	s.failback.track(s.defaultRoute.source)
+	for _, r := range s.routes {
+		s.failback.track(r.source)
+	}
+	return nil
+}
+
+// routeFor returns the route for mod: the first of the routes given to WithIngestRoutes whose pattern it matches, or
+// the default route.
+func (s *SumDB) routeFor(mod module.Version) *ingestRoute {
+	for _, r := range s.routes {
+		if module.MatchPrefixPatterns(r.pattern, mod.Path) {
+			return r
+		}
+	}
+	return s.defaultRoute
+}
+
+// upstreamsFor returns the SumDB's own clients for fetching records through the route r.
+func (s *SumDB) upstreamsFor(r *ingestRoute) fetchUpstreams {
+	return fetchUpstreams{proxy: r.proxy, secondary: s.secondary, sumdb: s.upstreamSumDB}
+}
+
+// record returns the record for mod. For checksum database routes, it's the database's record, once verified.
+// Otherwise it's built from the hashes of the module served by p (the route's proxy, or one recording its requests).
+func (r *ingestRoute) record(ctx context.Context, p *proxy.Proxy, mod module.Version) (*Record, error) {
+	if r.sumdb == nil {
+		return hashRecord(ctx, p, mod)
+	}
+
+	data, err := r.sumdb.Lookup(ctx, mod)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Record{Path: mod.Path, Version: mod.Version, Data: data}, nil
+}
+
+// baseURL returns u without a trailing slash, query or fragment.
+func baseURL(u *url.URL) string {
+	return fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, strings.TrimSuffix(u.Path, "/"))
+}
@@ -0,0 +1,237 @@
+package sumdb_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+// trustedSumDB is a checksum database served over HTTP, which hashes modules from its own proxy.
+type trustedSumDB struct {
+	*SumDB
+	store *memStore
+	proxy *fakeProxy
+	vkey  string
+	url   *url.URL
+}
+
+func newTrustedSumDB(t *testing.T) *trustedSumDB {
+	t.Helper()
+
+	skey, vkey, err := GenerateKeys("sum.example.com")
+	require.NoError(t, err)
+
+	p := newFakeProxy(t)
+	store := newMemStore()
+	db, err := New("sum.example.com", skey, WithStore(store), WithUpstream(p.upstream(t)))
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(db.Handler())
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	return &trustedSumDB{SumDB: db, store: store, proxy: p, vkey: vkey, url: u}
+}
+
+func TestTrustedSumDB(t *testing.T) {
+	upstream := newTrustedSumDB(t)
+	upstreamVkey, upstreamURL, upstreamProxy := upstream.vkey, upstream.url, upstream.proxy
+
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	mod := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+
+	t.Run("records come from the trusted sumdb", func(t *testing.T) {
+		proxy := newFakeProxy(t)
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(proxy.upstream(t)),
+			WithTrustedSumDB(upstreamVkey, upstreamURL),
+		)
+		require.NoError(t, err)
+
+		id, err := db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+		require.Zero(t, id)
+		require.Empty(t, proxy.requested())
+
+		want, err := upstream.ReadRecords(t.Context(), 0, 1)
+		require.NoError(t, err)
+		got, err := db.ReadRecords(t.Context(), 0, 1)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+
+		upstreamProxy.setMissing(module.Version{Path: "example.com/missing", Version: "v1.0.0"}, true)
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/missing", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("verification failures", func(t *testing.T) {
+		_, otherVkey, err := GenerateKeys("sum.example.com")
+		require.NoError(t, err)
+
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithTrustedSumDB(otherVkey, upstreamURL),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), mod)
+		require.ErrorIs(t, err, ErrUpstreamVerification)
+
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/foo@v1.0.0", nil))
+		require.Equal(t, http.StatusBadGateway, rec.Code)
+	})
+
+	t.Run("invalid verifier key", func(t *testing.T) {
+		_, err := New("test.example.com", skey, WithTrustedSumDB("not a key", upstreamURL))
+		require.Error(t, err)
+	})
+}
+
+func TestIngestRoutes(t *testing.T) {
+	upstream := newTrustedSumDB(t)
+	private := newFakeProxy(t)
+
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	public := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	internal := module.Version{Path: "corp.example.com/lib", Version: "v1.0.0"}
+
+	t.Run("trusted by default", func(t *testing.T) {
+		defaultProxy := newFakeProxy(t)
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(defaultProxy.upstream(t)),
+			WithTrustedSumDB(upstream.vkey, upstream.url),
+			WithIngestRoutes(IngestRoute{Pattern: "corp.example.com,*.corp.internal", Proxy: private.upstream(t)}),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), internal)
+		require.NoError(t, err)
+		require.Contains(t, private.requested(), "/corp.example.com/lib/@v/v1.0.0.zip")
+
+		_, err = db.Lookup(t.Context(), public)
+		require.NoError(t, err)
+		require.NotContains(t, private.requested(), "/example.com/foo/@v/v1.0.0.zip")
+		require.Empty(t, defaultProxy.requested())
+
+		// Only the public module went through the trusted checksum database.
+		_, err = upstream.store.RecordID(t.Context(), public.Path, public.Version)
+		require.NoError(t, err)
+		_, err = upstream.store.RecordID(t.Context(), internal.Path, internal.Version)
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("hashed by default", func(t *testing.T) {
+		defaultProxy := newFakeProxy(t)
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(defaultProxy.upstream(t)),
+			WithIngestRoutes(IngestRoute{Pattern: "example.com", SumDB: upstream.url, SumDBKey: upstream.vkey}),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), public)
+		require.NoError(t, err)
+		require.Empty(t, defaultProxy.requested())
+
+		_, err = db.Lookup(t.Context(), internal)
+		require.NoError(t, err)
+		require.Contains(t, defaultProxy.requested(), "/corp.example.com/lib/@v/v1.0.0.zip")
+	})
+
+	t.Run("invalid routes", func(t *testing.T) {
+		for name, route := range map[string]IngestRoute{
+			"no pattern":   {Proxy: private.upstream(t)},
+			"no source":    {Pattern: "example.com"},
+			"two sources":  {Pattern: "example.com", Proxy: private.upstream(t), SumDB: upstream.url, SumDBKey: upstream.vkey},
+			"invalid vkey": {Pattern: "example.com", SumDB: upstream.url, SumDBKey: "not a key"},
+		} {
+			_, err := New("test.example.com", skey, WithIngestRoutes(route))
+			require.ErrorIs(t, err, ErrInvalidIngestRoute, name)
+		}
+	})
+}
+
+func TestUpstreamSumDB(t *testing.T) {
+	sumdb := newTrustedSumDB(t)
+
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := newMemStore()
+	proxy := newFakeProxy(t)
+	private := newFakeProxy(t)
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(proxy.upstream(t)),
+		WithUpstreamSumDB(sumdb.vkey, sumdb.url),
+		WithIngestRoutes(IngestRoute{Pattern: "corp.example.com", Proxy: private.upstream(t)}),
+	)
+	require.NoError(t, err)
+
+	t.Run("matching records are signed", func(t *testing.T) {
+		_, err := db.Lookup(t.Context(), module.Version{Path: "example.com/foo", Version: "v1.0.0"})
+		require.NoError(t, err)
+	})
+
+	t.Run("versions unknown to the sumdb are signed", func(t *testing.T) {
+		mod := module.Version{Path: "example.com/new", Version: "v1.0.0"}
+		sumdb.proxy.setMissing(mod, true)
+
+		_, err := db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+	})
+
+	t.Run("mismatches are quarantined", func(t *testing.T) {
+		mod := module.Version{Path: "example.com/bar", Version: "v1.0.0"}
+		proxy.setTampered(mod, true)
+
+		_, err := db.Lookup(t.Context(), mod)
+		require.ErrorIs(t, err, ErrUpstreamMismatch)
+
+		quarantined := db.Quarantined()
+		require.Len(t, quarantined, 1)
+		require.Equal(t, mod.Path, quarantined[0].Path)
+		require.NotEqual(t, quarantined[0].Primary, quarantined[0].Secondary)
+
+		_, err = store.RecordID(t.Context(), mod.Path, mod.Version)
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("other routes aren't checked", func(t *testing.T) {
+		mod := module.Version{Path: "corp.example.com/lib", Version: "v1.0.0"}
+		private.setTampered(mod, true)
+
+		_, err := db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+		require.NotContains(t, sumdb.proxy.requested(), "/corp.example.com/lib/@v/v1.0.0.mod")
+	})
+
+	t.Run("verification failures", func(t *testing.T) {
+		_, otherVkey, err := GenerateKeys("sum.example.com")
+		require.NoError(t, err)
+
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(proxy.upstream(t)),
+			WithUpstreamSumDB(otherVkey, sumdb.url),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/foo", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrUpstreamVerification)
+	})
+}
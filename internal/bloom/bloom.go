@@ -0,0 +1,77 @@
+// Package bloom provides a concurrency-safe Bloom filter over strings.
+package bloom
+
+import (
+	"hash/maphash"
+	"math"
+	"sync/atomic"
+)
+
+// Filter is a Bloom filter: a set of strings that may report strings that were never added as present (false
+// positives), but never reports added strings as absent. It is safe for concurrent use.
+type Filter struct {
+	bits  []atomic.Uint64
+	m     uint64 // the number of bits
+	k     uint64 // the number of hash functions
+	n     atomic.Int64
+	seed1 maphash.Seed
+	seed2 maphash.Seed
+}
+
+// New returns a Filter sized to hold n strings with a false positive rate of about p. Adding more strings than n
+// raises the rate (see FalsePositiveRate).
+func New(n int64, p float64) *Filter {
+	n = max(n, 1)
+	p = min(max(p, 1e-9), 0.5)
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = max((m+63)/64*64, 64)
+	k := uint64(max(math.Round(float64(m)/float64(n)*math.Ln2), 1))
+
+	return &Filter{
+		bits:  make([]atomic.Uint64, m/64),
+		m:     m,
+		k:     k,
+		seed1: maphash.MakeSeed(),
+		seed2: maphash.MakeSeed(),
+	}
+}
+
+// Add adds s to the filter.
+func (f *Filter) Add(s string) {
+	h1, h2 := f.hash(s)
+	for i := range f.k {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64].Or(1 << (bit % 64))
+	}
+	f.n.Add(1)
+}
+
+// MayContain reports whether s may have been added to the filter. It's always true if s was added, and false with
+// the filter's false positive rate if it wasn't.
+func (f *Filter) MayContain(s string) bool {
+	h1, h2 := f.hash(s)
+	for i := range f.k {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64].Load()&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Len returns the number of strings added to the filter, counting strings added more than once each time.
+func (f *Filter) Len() int64 {
+	return f.n.Load()
+}
+
+// FalsePositiveRate returns the estimated probability that MayContain reports a string that wasn't added as present,
+// given the number of strings added so far.
+func (f *Filter) FalsePositiveRate() float64 {
+	return math.Pow(1-math.Exp(-float64(f.k)*float64(f.Len())/float64(f.m)), float64(f.k))
+}
+
+// hash returns the two independent hashes of s the filter's k hashes are derived from (by double hashing).
+func (f *Filter) hash(s string) (uint64, uint64) {
+	return maphash.String(f.seed1, s), maphash.String(f.seed2, s)
+}
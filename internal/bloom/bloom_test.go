@@ -0,0 +1,42 @@
+package bloom_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb/internal/bloom"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	f := New(1000, 0.01)
+	require.Zero(t, f.FalsePositiveRate())
+	require.False(t, f.MayContain("example.com/a@v1.0.0"))
+
+	for i := range 1000 {
+		f.Add(fmt.Sprintf("example.com/mod%d@v1.0.0", i))
+	}
+	require.Equal(t, int64(1000), f.Len())
+
+	for i := range 1000 {
+		require.True(t, f.MayContain(fmt.Sprintf("example.com/mod%d@v1.0.0", i)))
+	}
+
+	// Strings that weren't added are reported present at about the configured rate.
+	fp := 0
+	for i := range 10000 {
+		if f.MayContain(fmt.Sprintf("example.com/other%d@v1.0.0", i)) {
+			fp++
+		}
+	}
+	require.Less(t, fp, 300)
+	require.InDelta(t, 0.01, f.FalsePositiveRate(), 0.005)
+
+	t.Run("overfilled", func(t *testing.T) {
+		f := New(10, 0.01)
+		for i := range 1000 {
+			f.Add(fmt.Sprintf("example.com/mod%d@v1.0.0", i))
+		}
+		require.Greater(t, f.FalsePositiveRate(), 0.5)
+	})
+}
@@ -0,0 +1,155 @@
+// Package connect implements the framing of server-streaming RPCs in the Connect protocol with the JSON codec
+// (https://connectrpc.com/docs/protocol#streaming-rpcs), so that streams can be served and consumed without
+// generated code. Messages are encoded with encoding/json, and must follow the protobuf JSON mapping of the service's
+// messages to interoperate with other Connect implementations.
+package connect
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ContentType is the content type of streaming requests and responses using the JSON codec.
+const ContentType = "application/connect+json"
+
+const (
+	// flagEndStream marks the last envelope of a response stream, which carries the stream's error (if any).
+	flagEndStream = 0x02
+
+	// flagCompressed marks an envelope whose message is compressed. Compression is never negotiated, so it's
+	// rejected.
+	flagCompressed = 0x01
+
+	// MaxMessageSize is the largest message accepted by a Reader.
+	MaxMessageSize = 16 << 20
+)
+
+// Error codes used by this package's callers. See https://connectrpc.com/docs/protocol#error-codes.
+const (
+	CodeInvalidArgument    = "invalid_argument"
+	CodeFailedPrecondition = "failed_precondition"
+	CodeInternal           = "internal"
+	CodeUnavailable        = "unavailable"
+)
+
+type (
+	// Error is an RPC error, sent in the end of stream message.
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+
+	// Reader reads the messages of a stream.
+	Reader struct {
+		r   io.Reader
+		end bool
+	}
+
+	// endStream is the JSON payload of the end of stream message.
+	endStream struct {
+		Error *Error `json:"error,omitempty"`
+	}
+)
+
+// Errorf returns an Error with the given code and formatted message.
+func Errorf(code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Message
+}
+
+// WriteMessage writes v to w as a single message.
+func WriteMessage(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	return writeEnvelope(w, 0, data)
+}
+
+// WriteEnd ends a response stream, reporting err to the client. Errors other than *Error are reported as internal
+// errors. A nil err ends the stream successfully.
+func WriteEnd(w io.Writer, err error) error {
+	var end endStream
+	if err != nil {
+		if !errors.As(err, &end.Error) {
+			end.Error = &Error{Code: CodeInternal, Message: err.Error()}
+		}
+	}
+
+	data, err := json.Marshal(end)
+	if err != nil {
+		return fmt.Errorf("failed to encode end of stream: %w", err)
+	}
+	return writeEnvelope(w, flagEndStream, data)
+}
+
+// NewReader returns a Reader for the stream of messages in r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Next decodes the next message of the stream into v. It returns io.EOF when a response stream ends successfully, or
+// the *Error it ended with. Request streams, which have no end of stream message, return io.EOF at the end of r.
+func (r *Reader) Next(v any) error {
+	if r.end {
+		return io.EOF
+	}
+
+	var prefix [5]byte
+	if _, err := io.ReadFull(r.r, prefix[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("truncated message: %w", err)
+		}
+		return err
+	}
+
+	flags, size := prefix[0], binary.BigEndian.Uint32(prefix[1:])
+	if flags&flagCompressed != 0 {
+		return errors.New("compressed messages aren't supported")
+	}
+	if size > MaxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds the maximum of %d", size, MaxMessageSize)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return fmt.Errorf("truncated message: %w", err)
+	}
+
+	if flags&flagEndStream != 0 {
+		r.end = true
+
+		var end endStream
+		if err := json.Unmarshal(data, &end); err != nil {
+			return fmt.Errorf("failed to decode end of stream: %w", err)
+		}
+		if end.Error != nil {
+			return end.Error
+		}
+		return io.EOF
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode message: %w", err)
+	}
+	return nil
+}
+
+func writeEnvelope(w io.Writer, flags byte, data []byte) error {
+	prefix := [5]byte{flags}
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(data)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
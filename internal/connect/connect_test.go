@@ -0,0 +1,78 @@
+package connect_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb/internal/connect"
+	"github.com/stretchr/testify/require"
+)
+
+type message struct {
+	Size int64 `json:"size,string"`
+}
+
+func TestStream(t *testing.T) {
+	t.Run("messages and successful end", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteMessage(&buf, message{Size: 1}))
+		require.NoError(t, WriteMessage(&buf, message{Size: 2}))
+		require.NoError(t, WriteEnd(&buf, nil))
+
+		// The prefix is a flags byte and the big-endian message length.
+		require.Equal(t, []byte{0, 0, 0, 0, 12}, buf.Bytes()[:5])
+		require.Equal(t, `{"size":"1"}`, string(buf.Bytes()[5:17]))
+
+		r := NewReader(&buf)
+		var m message
+		require.NoError(t, r.Next(&m))
+		require.Equal(t, int64(1), m.Size)
+		require.NoError(t, r.Next(&m))
+		require.Equal(t, int64(2), m.Size)
+		require.ErrorIs(t, r.Next(&m), io.EOF)
+		require.ErrorIs(t, r.Next(&m), io.EOF)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteEnd(&buf, Errorf(CodeFailedPrecondition, "tree size %d", 5)))
+		require.NoError(t, WriteEnd(&buf, errors.New("boom")))
+
+		var m message
+		var rpcErr *Error
+		require.ErrorAs(t, NewReader(&buf).Next(&m), &rpcErr)
+		require.Equal(t, CodeFailedPrecondition, rpcErr.Code)
+		require.Equal(t, "failed_precondition: tree size 5", rpcErr.Error())
+
+		// Other errors are internal.
+		require.ErrorAs(t, NewReader(&buf).Next(&m), &rpcErr)
+		require.Equal(t, &Error{Code: CodeInternal, Message: "boom"}, rpcErr)
+	})
+
+	t.Run("request streams end at EOF", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteMessage(&buf, message{Size: 1}))
+
+		r := NewReader(&buf)
+		var m message
+		require.NoError(t, r.Next(&m))
+		require.ErrorIs(t, r.Next(&m), io.EOF)
+	})
+
+	t.Run("invalid envelopes", func(t *testing.T) {
+		var m message
+		for name, data := range map[string][]byte{
+			"truncated prefix":  {0, 0, 0},
+			"truncated message": {0, 0, 0, 0, 10, '{'},
+			"compressed":        {1, 0, 0, 0, 2, '{', '}'},
+			"too large":         {0, 0xff, 0xff, 0xff, 0xff},
+			"invalid JSON":      {0, 0, 0, 0, 1, '{'},
+		} {
+			err := NewReader(bytes.NewReader(data)).Next(&m)
+			require.Error(t, err, name)
+			require.NotErrorIs(t, err, io.EOF, name)
+		}
+	})
+}
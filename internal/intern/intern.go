@@ -0,0 +1,37 @@
+// Package intern provides string interning, so that the many records of a module share a single copy of its path.
+package intern
+
+// Pool interns strings: equal strings passed to String return the same string, backed by the same memory. A Pool
+// holds every distinct string it's given until it's garbage collected, so it should only live as long as the work
+// that needs it, e.g. a single export. The zero value is ready to use. It is not safe for concurrent use.
+type Pool struct {
+	strings map[string]string
+}
+
+// String returns the interned copy of s. The first string equal to s is kept, so callers passing strings that
+// reference larger buffers (e.g. a slice of a read buffer) should clone them first.
+func (p *Pool) String(s string) string {
+	if v, ok := p.strings[s]; ok {
+		return v
+	}
+
+	if p.strings == nil {
+		p.strings = make(map[string]string)
+	}
+	p.strings[s] = s
+	return s
+}
+
+// Bytes returns the interned string equal to b, only copying b when no equal string has been interned yet.
+func (p *Pool) Bytes(b []byte) string {
+	// The conversion in the map index expression doesn't allocate.
+	if v, ok := p.strings[string(b)]; ok {
+		return v
+	}
+	return p.String(string(b))
+}
+
+// Len returns the number of distinct strings in the pool.
+func (p *Pool) Len() int {
+	return len(p.strings)
+}
@@ -0,0 +1,29 @@
+package intern_test
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+
+	. "github.com/pseudomuto/sumdb/internal/intern"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	var p Pool
+	require.Zero(t, p.Len())
+
+	a := p.String(strings.Clone("example.com/mod"))
+	b := p.String(strings.Clone("example.com/mod"))
+	require.Equal(t, "example.com/mod", b)
+	require.Equal(t, unsafe.StringData(a), unsafe.StringData(b))
+
+	c := p.Bytes([]byte("example.com/mod"))
+	require.Equal(t, unsafe.StringData(a), unsafe.StringData(c))
+
+	buf := []byte("example.com/other")
+	d := p.Bytes(buf)
+	buf[0] = 'x'
+	require.Equal(t, "example.com/other", d)
+	require.Equal(t, 2, p.Len())
+}
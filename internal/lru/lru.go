@@ -0,0 +1,135 @@
+// Package lru provides a size-bounded, concurrency-safe least recently used cache.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+type (
+	// Cache is a least recently used cache holding at most a fixed number of entries, or entries of at most a fixed
+	// total weight. It is safe for concurrent use.
+	Cache[K comparable, V any] struct {
+		mu     sync.Mutex
+		size   int
+		weight func(V) int
+		total  int
+		ll     *list.List
+		items  map[K]*list.Element
+	}
+
+	entry[K comparable, V any] struct {
+		key    K
+		value  V
+		weight int
+	}
+)
+
+// New creates a Cache holding at most size entries. A size <= 0 creates a cache that never stores anything.
+func New[K comparable, V any](size int) *Cache[K, V] {
+	return NewWeighted[K, V](size, func(V) int { return 1 })
+}
+
+// NewWeighted creates a Cache holding entries whose weights, as returned by weight (e.g. their size in bytes), add up
+// to at most size. Values heavier than size are never stored.
+func NewWeighted[K comparable, V any](size int, weight func(V) int) *Cache[K, V] {
+	return &Cache[K, V]{
+		size:   size,
+		weight: weight,
+		ll:     list.New(),
+		items:  make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value for key, marking it as recently used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		return el.Value.(*entry[K, V]).value, true
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Add sets the value for key, evicting the least recently used entries if the cache is full.
+func (c *Cache[K, V]) Add(key K, value V) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := c.weight(value)
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if w > c.size {
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, weight: w})
+	c.total += w
+	for c.total > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+// Remove deletes the entry for key, if any.
+func (c *Cache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Len returns the number of entries in the cache.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Weight returns the total weight of the entries in the cache, which is their number unless it was created with
+// NewWeighted.
+func (c *Cache[K, V]) Weight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// Size returns the maximum number of entries (or, for caches created with NewWeighted, total weight) of the cache.
+func (c *Cache[K, V]) Size() int {
+	return c.size
+}
+
+// RemoveFunc deletes the entries for which fn returns true, returning the number of entries deleted.
+func (c *Cache[K, V]) RemoveFunc(fn func(key K, value V) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for el := c.ll.Front(); el != nil; {
+		next := el.Next()
+		if e := el.Value.(*entry[K, V]); fn(e.key, e.value) {
+			c.remove(el)
+			n++
+		}
+		el = next
+	}
+	return n
+}
+
+// remove deletes the entry el. c.mu must be held.
+func (c *Cache[K, V]) remove(el *list.Element) {
+	e := el.Value.(*entry[K, V])
+	c.ll.Remove(el)
+	delete(c.items, e.key)
+	c.total -= e.weight
+}
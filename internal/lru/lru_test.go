@@ -0,0 +1,98 @@
+package lru_test
+
+import (
+	"testing"
+
+	. "github.com/pseudomuto/sumdb/internal/lru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("get and add", func(t *testing.T) {
+		c := New[string, int](2)
+		c.Add("a", 1)
+
+		v, ok := c.Get("a")
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+
+		_, ok = c.Get("b")
+		require.False(t, ok)
+	})
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		c := New[string, int](2)
+		c.Add("a", 1)
+		c.Add("b", 2)
+		c.Get("a")
+		c.Add("c", 3)
+
+		require.Equal(t, 2, c.Len())
+		_, ok := c.Get("b")
+		require.False(t, ok)
+		_, ok = c.Get("a")
+		require.True(t, ok)
+	})
+
+	t.Run("updates existing entries", func(t *testing.T) {
+		c := New[string, int](2)
+		c.Add("a", 1)
+		c.Add("a", 2)
+
+		v, _ := c.Get("a")
+		require.Equal(t, 2, v)
+		require.Equal(t, 1, c.Len())
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		c := New[string, int](2)
+		c.Add("a", 1)
+		c.Remove("a")
+
+		_, ok := c.Get("a")
+		require.False(t, ok)
+	})
+
+	t.Run("remove func", func(t *testing.T) {
+		c := New[string, int](3)
+		c.Add("a", 1)
+		c.Add("b", 2)
+		c.Add("c", 3)
+
+		require.Equal(t, 2, c.RemoveFunc(func(_ string, v int) bool { return v%2 == 1 }))
+		require.Equal(t, 1, c.Len())
+		_, ok := c.Get("b")
+		require.True(t, ok)
+	})
+
+	t.Run("weighted", func(t *testing.T) {
+		c := NewWeighted[string, string](10, func(v string) int { return len(v) })
+		require.Equal(t, 10, c.Size())
+		c.Add("a", "aaaa")
+		c.Add("b", "bbbb")
+		require.Equal(t, 8, c.Weight())
+
+		// Adding c evicts a, the least recently used entry, to make room.
+		c.Add("c", "cccc")
+		require.Equal(t, 8, c.Weight())
+		_, ok := c.Get("a")
+		require.False(t, ok)
+
+		// Replacing an entry replaces its weight, and values heavier than the cache are never stored.
+		c.Add("b", "b")
+		require.Equal(t, 5, c.Weight())
+		c.Add("d", "ddddddddddd")
+		_, ok = c.Get("d")
+		require.False(t, ok)
+		require.Equal(t, 5, c.Weight())
+
+		require.Equal(t, 1, c.RemoveFunc(func(k, _ string) bool { return k == "c" }))
+		require.Equal(t, 1, c.Weight())
+	})
+
+	t.Run("zero size", func(t *testing.T) {
+		c := New[string, int](0)
+		c.Add("a", 1)
+		require.Zero(t, c.Len())
+	})
+}
@@ -0,0 +1,285 @@
+// Package metrics provides counters, gauges and histograms exposed in the Prometheus text format, without depending on
+// the Prometheus client libraries.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are the default histogram buckets (in seconds), matching the Prometheus client libraries.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type (
+	// Registry holds a set of metrics and serves them in the Prometheus text format. It is safe for concurrent use.
+	Registry struct {
+		mu      sync.Mutex
+		metrics map[string]metric
+	}
+
+	// CounterVec is a set of counters partitioned by label values.
+	CounterVec struct {
+		*vec[*Counter]
+	}
+
+	// Counter is a monotonically increasing count.
+	Counter struct {
+		n atomic.Uint64
+	}
+
+	// GaugeVec is a set of gauges partitioned by label values.
+	GaugeVec struct {
+		*vec[*Gauge]
+	}
+
+	// Gauge is a value that can go up and down.
+	Gauge struct {
+		bits atomic.Uint64
+	}
+
+	// HistogramVec is a set of histograms partitioned by label values.
+	HistogramVec struct {
+		*vec[*Histogram]
+	}
+
+	// Histogram counts observations in configurable buckets.
+	Histogram struct {
+		mu      sync.Mutex
+		buckets []float64
+		counts  []uint64 // per bucket, not cumulative
+		count   uint64
+		sum     float64
+	}
+
+	metric interface {
+		write(w *bufio.Writer)
+	}
+
+	// vec holds the series of a metric, keyed by their label values.
+	vec[T any] struct {
+		name, help, typ string
+		labels          []string
+		newSeries       func() T
+		writeSeries     func(w *bufio.Writer, name, labels string, series T)
+
+		mu     sync.Mutex
+		series map[string]T
+		values map[string][]string
+	}
+)
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// Counter registers a counter with the given name, help text and label names. It panics if the name is already
+// registered.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{newVec(name, help, "counter", labels, func() *Counter { return &Counter{} }, writeCounter)}
+	r.register(name, v)
+	return v
+}
+
+// Gauge registers a gauge with the given name, help text and label names. It panics if the name is already registered.
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{newVec(name, help, "gauge", labels, func() *Gauge { return &Gauge{} }, writeGauge)}
+	r.register(name, v)
+	return v
+}
+
+// Histogram registers a histogram with the given name, help text, bucket upper bounds (in increasing order) and label
+// names. It panics if the name is already registered.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	newHistogram := func() *Histogram {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	}
+	v := &HistogramVec{newVec(name, help, "histogram", labels, newHistogram, writeHistogram)}
+	r.register(name, v)
+	return v
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.metrics[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.metrics[name] = m
+}
+
+// Write writes every metric to w in the Prometheus text format, ordered by name.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := maps.Clone(r.metrics)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, name := range slices.Sorted(maps.Keys(metrics)) {
+		metrics[name].write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.Write(w)
+}
+
+// Inc increments the counter.
+func (c *Counter) Inc() {
+	c.n.Add(1)
+}
+
+// Add increments the counter by n.
+func (c *Counter) Add(n uint64) {
+	c.n.Add(n)
+}
+
+// Value returns the counter's current value.
+func (c *Counter) Value() uint64 {
+	return c.n.Load()
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Value returns the gauge's current value.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Observe records v in the histogram.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func newVec[T any](
+	name, help, typ string,
+	labels []string,
+	newSeries func() T,
+	writeSeries func(*bufio.Writer, string, string, T),
+) *vec[T] {
+	return &vec[T]{
+		name:        name,
+		help:        help,
+		typ:         typ,
+		labels:      labels,
+		newSeries:   newSeries,
+		writeSeries: writeSeries,
+		series:      make(map[string]T),
+		values:      make(map[string][]string),
+	}
+}
+
+// With returns the series for the given label values, creating it if necessary. It panics if the number of values
+// doesn't match the metric's labels.
+func (v *vec[T]) With(values ...string) T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = v.newSeries()
+		v.series[key] = s
+		v.values[key] = slices.Clone(values)
+	}
+	return s
+}
+
+func (v *vec[T]) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, key := range slices.Sorted(maps.Keys(v.series)) {
+		v.writeSeries(w, v.name, formatLabels(v.labels, v.values[key]), v.series[key])
+	}
+}
+
+func writeCounter(w *bufio.Writer, name, labels string, c *Counter) {
+	fmt.Fprintf(w, "%s%s %d\n", name, braces(labels), c.Value())
+}
+
+func writeGauge(w *bufio.Writer, name, labels string, g *Gauge) {
+	fmt.Fprintf(w, "%s%s %s\n", name, braces(labels), formatFloat(g.Value()))
+}
+
+func writeHistogram(w *bufio.Writer, name, labels string, h *Histogram) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+
+	var cumulative uint64
+	for i, le := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, formatFloat(le), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, braces(labels), formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, braces(labels), h.count)
+}
+
+// formatLabels formats label pairs, without braces, escaping their values.
+func formatLabels(names, values []string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", name, escape.Replace(values[i]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
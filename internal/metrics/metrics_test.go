@@ -0,0 +1,108 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb/internal/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Run("text format", func(t *testing.T) {
+		r := NewRegistry()
+		requests := r.Counter("requests_total", "Requests by code.", "code")
+		latency := r.Histogram("latency_seconds", "Request latency.", []float64{0.1, 1})
+		plain := r.Counter("plain_total", "A counter without labels.")
+		ratio := r.Gauge("ratio", "A gauge.", "kind")
+
+		requests.With("200").Inc()
+		requests.With("200").Inc()
+		requests.With(`5"0\0`).Inc()
+		latency.With().Observe(0.05)
+		latency.With().Observe(0.1)
+		latency.With().Observe(0.5)
+		latency.With().Observe(5)
+		plain.With().Inc()
+		plain.With().Add(2)
+		ratio.With("a").Set(0.25)
+		ratio.With("b").Set(2)
+		ratio.With("b").Set(1.5)
+
+		var b strings.Builder
+		require.NoError(t, r.Write(&b))
+		require.Equal(t, strings.Join([]string{
+			"# HELP latency_seconds Request latency.",
+			"# TYPE latency_seconds histogram",
+			`latency_seconds_bucket{le="0.1"} 2`,
+			`latency_seconds_bucket{le="1"} 3`,
+			`latency_seconds_bucket{le="+Inf"} 4`,
+			"latency_seconds_sum 5.65",
+			"latency_seconds_count 4",
+			"# HELP plain_total A counter without labels.",
+			"# TYPE plain_total counter",
+			"plain_total 3",
+			"# HELP ratio A gauge.",
+			"# TYPE ratio gauge",
+			`ratio{kind="a"} 0.25`,
+			`ratio{kind="b"} 1.5`,
+			"# HELP requests_total Requests by code.",
+			"# TYPE requests_total counter",
+			`requests_total{code="200"} 2`,
+			`requests_total{code="5\"0\\0"} 1`,
+			"",
+		}, "\n"), b.String())
+	})
+
+	t.Run("labeled histograms", func(t *testing.T) {
+		r := NewRegistry()
+		r.Histogram("latency_seconds", "Request latency.", []float64{1}, "outcome").With("ok").Observe(2)
+
+		var b strings.Builder
+		require.NoError(t, r.Write(&b))
+		require.Contains(t, b.String(), `latency_seconds_bucket{outcome="ok",le="1"} 0`)
+		require.Contains(t, b.String(), `latency_seconds_bucket{outcome="ok",le="+Inf"} 1`)
+		require.Contains(t, b.String(), `latency_seconds_count{outcome="ok"} 1`)
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		r := NewRegistry()
+		c := r.Counter("total", "Total.", "worker")
+		h := r.Histogram("seconds", "Seconds.", DefBuckets)
+
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Go(func() {
+				for range 100 {
+					c.With("a").Inc()
+					h.With().Observe(0.2)
+				}
+			})
+		}
+		wg.Wait()
+
+		require.Equal(t, uint64(800), c.With("a").Value())
+		require.Equal(t, uint64(800), h.With().Count())
+	})
+
+	t.Run("HTTP handler", func(t *testing.T) {
+		r := NewRegistry()
+		r.Counter("total", "Total.").With().Inc()
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+		require.Contains(t, rec.Body.String(), "total 1\n")
+	})
+
+	t.Run("misuse", func(t *testing.T) {
+		r := NewRegistry()
+		c := r.Counter("total", "Total.", "code")
+
+		require.Panics(t, func() { r.Counter("total", "Again.") })
+		require.Panics(t, func() { c.With() })
+	})
+}
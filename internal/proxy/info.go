@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+// Info is the metadata returned by the proxy's .info endpoint.
+type Info struct {
+	Version string    // The canonical version.
+	Time    time.Time // The commit time of the version.
+}
+
+// Info executes a .info request and returns the version's metadata.
+func (p *Proxy) Info(ctx context.Context, mod module.Version) (*Info, error) {
+	path, version, err := escapeModule(mod)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf(
+		"%s/%s/@v/%s.info",
+		p.upstream,
+		path,
+		version,
+	)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating info request: %s, %w", url, err)
+	}
+
+	resp, err := p.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading info response: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if err := checkStatus(resp, "info"); err != nil {
+		return nil, err
+	}
+
+	var info Info
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode info response: %w", err)
+	}
+
+	return &info, nil
+}
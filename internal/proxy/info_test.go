@@ -0,0 +1,46 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb/internal/proxy"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestProxy_Info(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/github.com/!pseudo!muto/mod/@v/v1.0.0.info":
+			_, _ = w.Write([]byte(`{"Version":"v1.0.0","Time":"2025-03-01T12:00:00Z"}`))
+		case "/github.com/pseudomuto/bad/@v/v1.0.0.info":
+			_, _ = w.Write([]byte(`not json`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	proxy := New(srv.Client(), srv.URL)
+
+	t.Run("valid request", func(t *testing.T) {
+		info, err := proxy.Info(t.Context(), module.Version{Path: "github.com/PseudoMuto/mod", Version: "v1.0.0"})
+		require.NoError(t, err)
+		require.Equal(t, "v1.0.0", info.Version)
+		require.Equal(t, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), info.Time)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := proxy.Info(t.Context(), module.Version{Path: "github.com/pseudomuto/mod", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrNotFound)
+		require.ErrorContains(t, err, "404")
+	})
+
+	t.Run("invalid response", func(t *testing.T) {
+		_, err := proxy.Info(t.Context(), module.Version{Path: "github.com/pseudomuto/bad", Version: "v1.0.0"})
+		require.ErrorContains(t, err, "failed to decode info response")
+	})
+}
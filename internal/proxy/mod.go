@@ -7,12 +7,16 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/pseudomuto/sumdb/internal/tracing"
 	"golang.org/x/mod/module"
 	"golang.org/x/mod/sumdb/dirhash"
 )
 
 // GoMod executes a go.mod request and returns the h1 directory hash of the file.
-func (p *Proxy) GoMod(ctx context.Context, mod module.Version) (string, error) {
+func (p *Proxy) GoMod(ctx context.Context, mod module.Version) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "proxy.GoMod", moduleAttrs(mod)...)
+	defer func() { tracing.End(span, err) }()
+
 	path, version, err := escapeModule(mod)
 	if err != nil {
 		return "", err
@@ -30,14 +34,14 @@ func (p *Proxy) GoMod(ctx context.Context, mod module.Version) (string, error) {
 		return "", fmt.Errorf("failed creating go.mod request: %s, %w", url, err)
 	}
 
-	resp, err := p.client.Do(req)
+	resp, err := p.do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed reading go.mod response: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("get go.mod, expected: %d, received: %d", http.StatusOK, resp.StatusCode)
+	if err := checkStatus(resp, "go.mod"); err != nil {
+		return "", err
 	}
 
 	var buf bytes.Buffer
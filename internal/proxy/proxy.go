@@ -1,12 +1,21 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/pseudomuto/sumdb/internal/spool"
+	"github.com/pseudomuto/sumdb/internal/tracing"
 	"golang.org/x/mod/module"
 )
 
+// ErrNotFound is returned when the upstream proxy doesn't have the requested module version (i.e. it responds with
+// 404 Not Found or 410 Gone).
+var ErrNotFound = errors.New("module version not found")
+
 type (
 	// HTTPClient defines an HTTP client for executing requests.
 	HTTPClient interface {
@@ -18,17 +27,71 @@ type (
 	Proxy struct {
 		client   HTTPClient // The HTTPClient to use for executing requests.
 		upstream string     // The upstream proxy server (e.g. https://proxy.golang.org)
+
+		// rangeChunkSize and rangeWorkers configure range requests for zips. See WithRangeRequests.
+		rangeChunkSize int64
+		rangeWorkers   int
+
+		// spool creates the temporary files zips are spooled to. See WithSpool.
+		spool *spool.Manager
+
+		// retry configures the retries of failed requests. See WithRetry.
+		retry retryPolicy
+
+		// now and sleep are the clock retries are timed with. See WithClock.
+		now   func() time.Time
+		sleep func(ctx context.Context, d time.Duration) bool
 	}
+
+	// Option configures a Proxy.
+	Option func(*Proxy)
 )
 
 // New creates a new Proxy for querying the supplied upstream.
-func New(client HTTPClient, upstream string) *Proxy {
-	return &Proxy{
+func New(client HTTPClient, upstream string, opts ...Option) *Proxy {
+	p := &Proxy{
 		client:   client,
 		upstream: upstream,
+		now:      time.Now,
+		sleep:    sleep,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// WithClock times retries with now, which Retry-After dates are relative to, and sleep, which waits for d and returns
+// false if ctx is done first. Retries use the system clock by default.
+func WithClock(now func() time.Time, sleep func(ctx context.Context, d time.Duration) bool) Option {
+	return func(p *Proxy) {
+		p.now = now
+		p.sleep = sleep
+	}
+}
+
+// WithRangeRequests downloads zips in chunks of chunkSize bytes, using up to workers concurrent range requests, when
+// the upstream supports them. Upstreams that don't are sent a single request for the whole zip.
+func WithRangeRequests(chunkSize int64, workers int) Option {
+	return func(p *Proxy) {
+		p.rangeChunkSize = chunkSize
+		p.rangeWorkers = max(workers, 1)
 	}
 }
 
+// WithRetry retries requests that fail with a network error, 429 Too Many Requests or a 5xx response, making up to
+// attempts attempts in all. Retries wait for an exponential backoff starting at base and capped at max, with jitter,
+// or for as long as the upstream's Retry-After header asks. Responses asking to wait longer than max aren't retried.
+// Requests are only made once by default.
+func WithRetry(attempts int, base, max time.Duration) Option {
+	return func(p *Proxy) { p.retry = retryPolicy{attempts: attempts, base: base, max: max} }
+}
+
+// WithSpool spools zips to files created by m, subject to its quota, rather than to the system's temporary directory.
+func WithSpool(m *spool.Manager) Option {
+	return func(p *Proxy) { p.spool = m }
+}
+
 func escapeModule(mod module.Version) (string, string, error) {
 	path, err := module.EscapePath(mod.Path)
 	if err != nil {
@@ -42,3 +105,20 @@ func escapeModule(mod module.Version) (string, string, error) {
 
 	return path, version, nil
 }
+
+// moduleAttrs returns the attributes of spans for requests for mod.
+func moduleAttrs(mod module.Version) []tracing.Attribute {
+	return []tracing.Attribute{tracing.String("module.path", mod.Path), tracing.String("module.version", mod.Version)}
+}
+
+// checkStatus returns an error if the status of resp (a response for the named file) isn't 200 OK.
+func checkStatus(resp *http.Response, name string) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("get %s, %w, received: %d", name, ErrNotFound, resp.StatusCode)
+	default:
+		return fmt.Errorf("get %s, expected: %d, received: %d", name, http.StatusOK, resp.StatusCode)
+	}
+}
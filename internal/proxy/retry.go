@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryDrainLimit is the number of bytes of a failed response's body read before it's closed, so that its connection
+// can be reused for the retry.
+const retryDrainLimit = 4 << 10
+
+// retryPolicy configures the retries of failed requests. See WithRetry.
+type retryPolicy struct {
+	attempts int
+	base     time.Duration
+	max      time.Duration
+}
+
+// do sends req, retrying it as configured with WithRetry. Only requests without a body can be retried.
+func (p *Proxy) do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := p.client.Do(req.Clone(ctx))
+		if attempt >= p.retry.attempts || !retryable(ctx, resp, err) {
+			return resp, err
+		}
+
+		wait, ok := p.retry.delay(attempt, resp, p.now())
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.CopyN(io.Discard, resp.Body, retryDrainLimit)
+			_ = resp.Body.Close()
+		}
+
+		if !p.sleep(ctx, wait) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// retryable reports whether a request made with ctx that returned resp or err is worth retrying. Certificates that
+// failed verification (including pinning, which reports a tls.CertificateVerificationError) won't pass on a retry.
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil && !certificateError(err)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// certificateError reports whether err is the failure to verify a certificate.
+func certificateError(err error) bool {
+	var (
+		verification *tls.CertificateVerificationError
+		authority    x509.UnknownAuthorityError
+		invalid      x509.CertificateInvalidError
+		hostname     x509.HostnameError
+	)
+	return errors.As(err, &verification) || errors.As(err, &authority) || errors.As(err, &invalid) ||
+		errors.As(err, &hostname)
+}
+
+// delay returns how long to wait before retrying the given attempt, which failed with resp if it isn't nil, at now. The
+// upstream's Retry-After header is honored, unless it asks to wait longer than the policy's max, in which case it
+// returns false.
+func (r retryPolicy) delay(attempt int, resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp != nil {
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After"), now); ok {
+			return wait, wait <= r.max
+		}
+	}
+
+	// Backoff doubles with every attempt, and a random half of it is waited for, so that concurrent retries spread
+	// out.
+	backoff := r.max
+	if shift := attempt - 1; shift < 32 && r.base<<shift > 0 {
+		backoff = min(r.base<<shift, r.max)
+	}
+	if backoff <= 0 {
+		return 0, true
+	}
+	return backoff/2 + rand.N(backoff/2+1), true
+}
+
+// retryAfter parses a Retry-After header value, given in seconds or as an HTTP date, which is relative to now.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// sleep waits for d with a system timer, returning false if ctx is done first. See WithClock.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
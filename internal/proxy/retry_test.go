@@ -0,0 +1,177 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb/internal/proxy"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestProxy_Retry(t *testing.T) {
+	mod := module.Version{Path: "example.com/mod", Version: "v1.0.0"}
+
+	// serve returns a proxy failing the first requests with the responses written by fail, and serving a go.mod for
+	// the others.
+	serve := func(t *testing.T, fail ...func(http.ResponseWriter)) (*httptest.Server, *atomic.Int32) {
+		t.Helper()
+
+		var requests atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if n := int(requests.Add(1)); n <= len(fail) {
+				fail[n-1](w)
+				return
+			}
+			_, _ = w.Write([]byte("module example.com/mod\n"))
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &requests
+	}
+
+	status := func(code int, headers ...string) func(http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			for i := 0; i+1 < len(headers); i += 2 {
+				w.Header().Set(headers[i], headers[i+1])
+			}
+			w.WriteHeader(code)
+		}
+	}
+
+	// hangUp closes the connection without a response, as a network error would.
+	hangUp := func(w http.ResponseWriter) {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}
+
+	srv, _ := serve(t)
+	want, err := New(srv.Client(), srv.URL).GoMod(t.Context(), mod)
+	require.NoError(t, err)
+
+	t.Run("retries transient failures", func(t *testing.T) {
+		srv, requests := serve(t, status(http.StatusBadGateway), hangUp, status(http.StatusTooManyRequests))
+		p := New(srv.Client(), srv.URL, WithRetry(4, time.Millisecond, 10*time.Millisecond))
+
+		h1, err := p.GoMod(t.Context(), mod)
+		require.NoError(t, err)
+		require.Equal(t, want, h1)
+		require.Equal(t, int32(4), requests.Load())
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		unavailable := status(http.StatusServiceUnavailable)
+		srv, requests := serve(t, unavailable, unavailable, unavailable)
+		p := New(srv.Client(), srv.URL, WithRetry(3, time.Millisecond, 10*time.Millisecond))
+
+		_, err := p.GoMod(t.Context(), mod)
+		require.ErrorContains(t, err, "received: 503")
+		require.Equal(t, int32(3), requests.Load())
+	})
+
+	t.Run("doesn't retry by default", func(t *testing.T) {
+		srv, requests := serve(t, status(http.StatusBadGateway))
+
+		_, err := New(srv.Client(), srv.URL).GoMod(t.Context(), mod)
+		require.ErrorContains(t, err, "received: 502")
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("doesn't retry missing modules", func(t *testing.T) {
+		srv, requests := serve(t, status(http.StatusNotFound))
+		p := New(srv.Client(), srv.URL, WithRetry(3, time.Millisecond, 10*time.Millisecond))
+
+		_, err := p.GoMod(t.Context(), mod)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("doesn't retry certificate errors", func(t *testing.T) {
+		for name, err := range map[string]error{
+			"verification": &tls.CertificateVerificationError{Err: errors.New("pin mismatch")},
+			"authority":    x509.UnknownAuthorityError{},
+			"hostname":     x509.HostnameError{Host: "proxy.example.com"},
+		} {
+			var requests atomic.Int32
+			client := clientFunc(func(*http.Request) (*http.Response, error) {
+				requests.Add(1)
+				return nil, &url.Error{Op: "Get", URL: "https://proxy.example.com", Err: err}
+			})
+			p := New(client, "https://proxy.example.com", WithRetry(3, time.Millisecond, time.Millisecond))
+
+			_, gotErr := p.GoMod(t.Context(), mod)
+			require.ErrorIs(t, gotErr, err, name)
+			require.Equal(t, int32(1), requests.Load(), name)
+		}
+	})
+
+	t.Run("honors Retry-After", func(t *testing.T) {
+		srv, requests := serve(t, status(http.StatusServiceUnavailable, "Retry-After", "0"))
+		p := New(srv.Client(), srv.URL, WithRetry(2, time.Hour, time.Hour))
+
+		_, err := p.GoMod(t.Context(), mod)
+		require.NoError(t, err)
+		require.Equal(t, int32(2), requests.Load())
+
+		// Upstreams asking to wait longer than the maximum backoff aren't retried.
+		srv, requests = serve(t, status(http.StatusTooManyRequests, "Retry-After", "3600"))
+		p = New(srv.Client(), srv.URL, WithRetry(2, time.Millisecond, time.Minute))
+
+		_, err = p.GoMod(t.Context(), mod)
+		require.ErrorContains(t, err, "received: 429")
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		srv, requests := serve(t, status(http.StatusBadGateway))
+		p := New(srv.Client(), srv.URL, WithRetry(2, time.Hour, time.Hour))
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+		_, err := p.GoMod(ctx, mod)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("retries zips", func(t *testing.T) {
+		data := bigZip(t, mod)
+		var (
+			requests atomic.Int32
+			failNext atomic.Bool
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			if failNext.Swap(false) {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			http.ServeContent(w, r, "v1.0.0.zip", time.Time{}, bytes.NewReader(data))
+		}))
+		t.Cleanup(srv.Close)
+
+		want, err := New(srv.Client(), srv.URL).Zip(t.Context(), mod)
+		require.NoError(t, err)
+		requests.Store(0)
+		failNext.Store(true)
+
+		h1, err := New(srv.Client(), srv.URL, WithRetry(2, time.Millisecond, time.Millisecond)).Zip(t.Context(), mod)
+		require.NoError(t, err)
+		require.Equal(t, want, h1)
+		require.Equal(t, int32(2), requests.Load())
+	})
+}
+
+// clientFunc is an HTTPClient calling the function.
+type clientFunc func(*http.Request) (*http.Response, error)
+
+func (f clientFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,74 @@
+//go:build !js && !wasip1
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// spoolFile is a temporary file holding a zip archive.
+type spoolFile interface {
+	spooler
+	io.Writer
+	Truncate(size int64) error
+	Close() error
+	Name() string
+}
+
+// spoolZip writes the zip archive in r to a temporary file so large modules aren't held in memory.
+// The returned function removes the file and must be called once the archive is no longer needed.
+func (p *Proxy) spoolZip(r io.Reader) (io.ReaderAt, int64, func(), error) {
+	f, release, err := p.createSpool()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	size, err := io.Copy(f, r)
+	if err != nil {
+		release()
+		return nil, 0, nil, fmt.Errorf("failed to write zip file: %w", err)
+	}
+
+	return f, size, release, nil
+}
+
+// newSpool creates a temporary file of the given size, so large modules downloaded in ranges aren't held in memory.
+// The returned function removes the file and must be called once the archive is no longer needed.
+func (p *Proxy) newSpool(size int64) (spooler, func(), error) {
+	f, release, err := p.createSpool()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := f.Truncate(size); err != nil {
+		release()
+		return nil, nil, fmt.Errorf("failed to size zip file: %w", err)
+	}
+
+	return f, release, nil
+}
+
+// createSpool creates an empty temporary file for a zip archive. Files are created by the spool manager configured
+// with WithSpool, if any, and are subject to its quota. Otherwise they're created in the system's temporary directory.
+func (p *Proxy) createSpool() (spoolFile, func(), error) {
+	var (
+		f   spoolFile
+		err error
+	)
+	if p.spool != nil {
+		f, err = p.spool.Create()
+	} else {
+		f, err = os.CreateTemp("", "sumdb-*")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temp file for zip: %w", err)
+	}
+
+	release := func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}
+	return f, release, nil
+}
@@ -0,0 +1,41 @@
+//go:build js || wasip1
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// memorySpool is an in-memory spooler.
+type memorySpool []byte
+
+// spoolZip buffers the zip archive in r in memory, for environments without a writable filesystem. The spool manager
+// configured with WithSpool isn't used.
+func (p *Proxy) spoolZip(r io.Reader) (io.ReaderAt, int64, func(), error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to read zip: %w", err)
+	}
+
+	return bytes.NewReader(data), int64(len(data)), func() {}, nil
+}
+
+// newSpool allocates a buffer of the given size for a zip archive downloaded in ranges.
+func (p *Proxy) newSpool(size int64) (spooler, func(), error) {
+	return make(memorySpool, size), func() {}, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (s memorySpool) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(s).ReadAt(p, off)
+}
+
+// WriteAt implements io.WriterAt.
+func (s memorySpool) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(s)) {
+		return 0, fmt.Errorf("write of %d bytes at offset %d exceeds zip size %d", len(p), off, len(s))
+	}
+	return copy(s[off:], p), nil
+}
@@ -1,18 +1,22 @@
 package proxy
 
 import (
+	"archive/zip"
 	"context"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 
+	"github.com/pseudomuto/sumdb/internal/tracing"
 	"golang.org/x/mod/module"
 	"golang.org/x/mod/sumdb/dirhash"
 )
 
 // Zip executes a request for the zip file for the specified module. It returns the h1 directory hash of the file.
-func (p *Proxy) Zip(ctx context.Context, mod module.Version) (string, error) {
+func (p *Proxy) Zip(ctx context.Context, mod module.Version) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "proxy.Zip", moduleAttrs(mod)...)
+	defer func() { tracing.End(span, err) }()
+
 	path, version, err := escapeModule(mod)
 	if err != nil {
 		return "", err
@@ -30,34 +34,67 @@ func (p *Proxy) Zip(ctx context.Context, mod module.Version) (string, error) {
 		return "", fmt.Errorf("failed creating zip request: %s, %w", url, err)
 	}
 
-	resp, err := p.client.Do(req)
+	// The first chunk is requested up front. Upstreams that support range requests answer with 206 Partial Content
+	// and the zip's size, and the rest is fetched concurrently. Others send the whole zip.
+	if p.rangeChunkSize > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", p.rangeChunkSize-1))
+	}
+
+	resp, err := p.do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed reading zip response: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to get zip, expected: %d, received: %d", http.StatusOK, resp.StatusCode)
+	var (
+		zr      io.ReaderAt
+		size    int64
+		release func()
+	)
+	if resp.StatusCode == http.StatusPartialContent {
+		zr, size, release, err = p.spoolRanges(ctx, url, resp)
+	} else {
+		if err := checkStatus(resp, "zip"); err != nil {
+			return "", err
+		}
+		zr, size, release, err = p.spoolZip(resp.Body)
 	}
-
-	f, err := os.CreateTemp("", "sumdb-*")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp file for zip: %w", err)
+		return "", err
 	}
-	defer func() {
-		_ = f.Close()
-		_ = os.Remove(f.Name())
-	}()
+	defer release()
+	span.SetAttributes(tracing.Int64("proxy.zip.size", size))
 
-	_, err = io.Copy(f, resp.Body)
+	_, hashSpan := tracing.Start(ctx, "proxy.hashZip")
+	h1, err := hashZip(zr, size)
+	tracing.End(hashSpan, err)
 	if err != nil {
-		return "", fmt.Errorf("failed to write zip file: %w", err)
+		return "", fmt.Errorf("failed to calculate dirhash for zip: %w", err)
 	}
 
-	h1, err := dirhash.HashZip(f.Name(), dirhash.Hash1)
+	return h1, nil
+}
+
+// hashZip computes the h1 directory hash of the zip archive in r.
+// It is equivalent to dirhash.HashZip, but doesn't require the archive to be stored in a file.
+func hashZip(r io.ReaderAt, size int64) (string, error) {
+	z, err := zip.NewReader(r, size)
 	if err != nil {
-		return "", fmt.Errorf("failed to calculate dirhash for zip: %w", err)
+		return "", err
 	}
 
-	return h1, nil
+	files := make([]string, 0, len(z.File))
+	zfiles := make(map[string]*zip.File, len(z.File))
+	for _, f := range z.File {
+		files = append(files, f.Name)
+		zfiles[f.Name] = f
+	}
+
+	return dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		f := zfiles[name]
+		if f == nil {
+			return nil, fmt.Errorf("file %q not found in zip", name)
+		}
+		return f.Open()
+	})
 }
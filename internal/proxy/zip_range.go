@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// spooler is a temporary store for a zip archive that's assembled from concurrently downloaded ranges.
+type spooler interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// spoolRanges spools the zip served at url, given the 206 Partial Content response for its first chunk. The remaining
+// chunks are fetched with up to rangeWorkers concurrent range requests. The returned function releases the spool and
+// must be called once the archive is no longer needed.
+func (p *Proxy) spoolRanges(ctx context.Context, url string, first *http.Response) (io.ReaderAt, int64, func(), error) {
+	var start, end, size int64
+	if _, err := fmt.Sscanf(first.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil ||
+		start != 0 || end < start || end >= size {
+		return nil, 0, nil, fmt.Errorf("invalid zip Content-Range: %q", first.Header.Get("Content-Range"))
+	}
+
+	spool, release, err := p.newSpool(size)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	if err := copyRange(spool, first.Body, start, end); err != nil {
+		release()
+		return nil, 0, nil, err
+	}
+
+	// Ranges are pinned to the version of the zip that served the first chunk, so a zip that changes mid-download
+	// fails rather than being stitched together from different archives.
+	validator := first.Header.Get("ETag")
+	if validator == "" {
+		validator = first.Header.Get("Last-Modified")
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(p.rangeWorkers)
+	for off := end + 1; off < size; off += p.rangeChunkSize {
+		g.Go(func() error {
+			return p.fetchRange(ctx, url, validator, spool, off, min(off+p.rangeChunkSize, size)-1)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		release()
+		return nil, 0, nil, err
+	}
+
+	return spool, size, release, nil
+}
+
+// fetchRange fetches bytes [start, end] of the zip at url into spool.
+func (p *Proxy) fetchRange(ctx context.Context, url, validator string, spool io.WriterAt, start, end int64) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed creating zip request: %s, %w", url, err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	if validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := p.do(req)
+	if err != nil {
+		return fmt.Errorf("failed reading zip response: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("get zip range %d-%d, expected: %d, received: %d",
+			start, end, http.StatusPartialContent, resp.StatusCode)
+	}
+
+	return copyRange(spool, resp.Body, start, end)
+}
+
+// copyRange copies bytes [start, end] of the zip from r into spool.
+func copyRange(spool io.WriterAt, r io.Reader, start, end int64) error {
+	n, err := io.CopyN(io.NewOffsetWriter(spool, start), r, end-start+1)
+	if err != nil {
+		return fmt.Errorf("failed to write zip range %d-%d: wrote %d bytes, %w", start, end, n, err)
+	}
+	return nil
+}
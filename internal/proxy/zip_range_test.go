@@ -0,0 +1,134 @@
+package proxy_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb/internal/proxy"
+	"github.com/pseudomuto/sumdb/internal/spool"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestProxy_ZipRanges(t *testing.T) {
+	mod := module.Version{Path: "example.com/big", Version: "v1.0.0"}
+	data := bigZip(t, mod)
+
+	// serve returns a proxy serving data as mod's zip with http.ServeContent, which supports range requests.
+	serve := func(t *testing.T, etag func() string) (*httptest.Server, *atomic.Int32) {
+		t.Helper()
+
+		var requests atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			if etag != nil {
+				w.Header().Set("ETag", etag())
+			}
+			http.ServeContent(w, r, "v1.0.0.zip", time.Time{}, bytes.NewReader(data))
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &requests
+	}
+
+	srv, _ := serve(t, nil)
+	want, err := New(srv.Client(), srv.URL).Zip(t.Context(), mod)
+	require.NoError(t, err)
+
+	t.Run("concurrent ranges", func(t *testing.T) {
+		srv, requests := serve(t, func() string { return `"v1"` })
+
+		h1, err := New(srv.Client(), srv.URL, WithRangeRequests(16<<10, 4)).Zip(t.Context(), mod)
+		require.NoError(t, err)
+		require.Equal(t, want, h1)
+		require.Equal(t, int32((len(data)+16<<10-1)/(16<<10)), requests.Load())
+	})
+
+	t.Run("small zips", func(t *testing.T) {
+		srv, requests := serve(t, nil)
+
+		h1, err := New(srv.Client(), srv.URL, WithRangeRequests(int64(len(data)), 4)).Zip(t.Context(), mod)
+		require.NoError(t, err)
+		require.Equal(t, want, h1)
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("upstreams without range support", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write(data)
+		}))
+		t.Cleanup(srv.Close)
+
+		h1, err := New(srv.Client(), srv.URL, WithRangeRequests(16<<10, 4)).Zip(t.Context(), mod)
+		require.NoError(t, err)
+		require.Equal(t, want, h1)
+	})
+
+	t.Run("zips that change mid-download", func(t *testing.T) {
+		var n atomic.Int32
+		srv, _ := serve(t, func() string {
+			if n.Add(1) == 1 {
+				return `"v1"`
+			}
+			return `"v2"`
+		})
+
+		_, err := New(srv.Client(), srv.URL, WithRangeRequests(16<<10, 4)).Zip(t.Context(), mod)
+		require.ErrorContains(t, err, "expected: 206, received: 200")
+	})
+}
+
+// bigZip returns a module zip for mod with incompressible content spanning several chunks.
+func bigZip(t *testing.T, mod module.Version) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"go.mod", "a.bin", "b.bin"} {
+		w, err := zw.Create(mod.String() + "/" + name)
+		require.NoError(t, err)
+
+		data := make([]byte, 40<<10)
+		_, _ = rand.Read(data)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestProxy_ZipSpool(t *testing.T) {
+	mod := module.Version{Path: "example.com/big", Version: "v1.0.0"}
+	data := bigZip(t, mod)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "v1.0.0.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+
+	for name, opts := range map[string][]Option{
+		"whole zips": nil,
+		"ranges":     {WithRangeRequests(16<<10, 4)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, err := spool.New(t.TempDir(), int64(len(data)))
+			require.NoError(t, err)
+
+			_, err = New(srv.Client(), srv.URL, append(opts, WithSpool(m))...).Zip(t.Context(), mod)
+			require.NoError(t, err)
+			require.Zero(t, m.Used())
+
+			small, err := spool.New(t.TempDir(), int64(len(data))-1)
+			require.NoError(t, err)
+
+			_, err = New(srv.Client(), srv.URL, append(opts, WithSpool(small))...).Zip(t.Context(), mod)
+			require.ErrorIs(t, err, spool.ErrFull)
+			require.Zero(t, small.Used())
+		})
+	}
+}
@@ -2,14 +2,21 @@
 package signer
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"strings"
 
 	"golang.org/x/mod/sumdb/note"
 	"golang.org/x/mod/sumdb/tlog"
 )
 
+// algEd25519 is the note package's algorithm byte for Ed25519 keys.
+const algEd25519 = 1
+
 var (
+	ErrInvalidKey   = errors.New("invalid signer key")
 	ErrInvalidNote  = errors.New("invalid note format")
 	ErrVerifyFailed = errors.New("signature verification failed")
 )
@@ -26,10 +33,29 @@ func NewVerifier(vkey string) (note.Verifier, error) {
 	return note.NewVerifier(vkey)
 }
 
-// SignTreeHead signs a tree and returns the signed note bytes.
-func SignTreeHead(signer note.Signer, tree tlog.Tree) ([]byte, error) {
+// VerifierKey returns the verifier key for the encoded signer key skey, so that servers configured with only their
+// signer key can tell clients which key to trust.
+func VerifierKey(skey string) (string, error) {
+	if _, err := note.NewSigner(skey); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+
+	// NewSigner has validated the key: "PRIVATE+KEY+<name>+<hash>+<keydata>", where keydata is the algorithm byte
+	// followed by the Ed25519 seed.
+	fields := strings.SplitN(skey, "+", 5)
+	key, err := base64.StdEncoding.DecodeString(fields[4])
+	if err != nil || len(key) != 1+ed25519.SeedSize || key[0] != algEd25519 {
+		return "", ErrInvalidKey
+	}
+
+	return note.NewEd25519VerifierKey(fields[2], ed25519.NewKeyFromSeed(key[1:]).Public().(ed25519.PublicKey))
+}
+
+// SignTreeHead signs a tree and returns the signed note bytes. Cosigners, such as the new key during a key rotation,
+// add their signatures after signer's.
+func SignTreeHead(signer note.Signer, tree tlog.Tree, cosigners ...note.Signer) ([]byte, error) {
 	text := tlog.FormatTree(tree)
-	return note.Sign(&note.Note{Text: string(text)}, signer)
+	return note.Sign(&note.Note{Text: string(text)}, append([]note.Signer{signer}, cosigners...)...)
 }
 
 // VerifyTreeHead verifies a signed tree head and returns the parsed tree.
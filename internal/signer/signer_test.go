@@ -39,6 +39,18 @@ func TestNewVerifier_InvalidKey(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestVerifierKey(t *testing.T) {
+	skey, vkey, err := sumdb.GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	got, err := VerifierKey(skey)
+	require.NoError(t, err)
+	require.Equal(t, vkey, got)
+
+	_, err = VerifierKey(vkey)
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
+
 func TestSignAndVerifyTreeHead(t *testing.T) {
 	skey, vkey, err := sumdb.GenerateKeys("test.example.com")
 	require.NoError(t, err)
@@ -63,6 +75,25 @@ func TestSignAndVerifyTreeHead(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, tree.N, verified.N)
 	require.Equal(t, tree.Hash, verified.Hash)
+
+	t.Run("cosigners", func(t *testing.T) {
+		cosigningKey, cosigningVKey, err := sumdb.GenerateKeys("test.example.com")
+		require.NoError(t, err)
+		cosigner, err := NewSigner(cosigningKey)
+		require.NoError(t, err)
+
+		signed, err := SignTreeHead(s, tree, cosigner)
+		require.NoError(t, err)
+
+		for _, vkey := range []string{vkey, cosigningVKey} {
+			v, err := NewVerifier(vkey)
+			require.NoError(t, err)
+
+			verified, err := VerifyTreeHead(v, signed)
+			require.NoError(t, err, vkey)
+			require.Equal(t, tree, verified)
+		}
+	})
 }
 
 func TestSignAndVerifyTreeHead_RoundTrip(t *testing.T) {
@@ -0,0 +1,176 @@
+// Package spool manages temporary files in a directory with a quota on their total size, so that spooling (e.g. module
+// zips during cold lookups) can't fill the disk of the host.
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// filePrefix is the prefix of spool file names. Files with it are evicted when a Manager is created.
+const filePrefix = "sumdb-spool-"
+
+// ErrFull is returned when writing to a File would exceed the Manager's quota.
+var ErrFull = errors.New("spool is full")
+
+type (
+	// Manager creates spool files in a directory, keeping their total size under a quota. It is safe for concurrent
+	// use.
+	Manager struct {
+		dir string
+		max int64
+
+		mu   sync.Mutex
+		used int64
+	}
+
+	// File is a spool file. Its size counts towards the Manager's quota until it's closed, which removes it.
+	File struct {
+		*os.File
+		m *Manager
+
+		mu       sync.Mutex
+		reserved int64
+		closed   bool
+	}
+)
+
+// New creates a Manager for the spool files in dir, which is created if necessary, holding at most maxSize bytes
+// (unlimited if maxSize <= 0). Files left behind by previous processes (e.g. after a crash) are evicted, so dir must
+// not be shared with other running servers. An empty dir uses the system's temporary directory, which may be shared,
+// so nothing is evicted from it.
+func New(dir string, maxSize int64) (*Manager, error) {
+	if dir == "" {
+		return &Manager{dir: os.TempDir(), max: maxSize}, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %s, %w", dir, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %s, %w", dir, err)
+	}
+
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasPrefix(e.Name(), filePrefix) {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return nil, fmt.Errorf("failed to evict stale spool file: %s, %w", e.Name(), err)
+			}
+		}
+	}
+
+	return &Manager{dir: dir, max: maxSize}, nil
+}
+
+// Used returns the total size of the open spool files.
+func (m *Manager) Used() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.used
+}
+
+// Create creates an empty spool file. It must be closed once it's no longer needed.
+func (m *Manager) Create() (*File, error) {
+	f, err := os.CreateTemp(m.dir, filePrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	return &File{File: f, m: m}, nil
+}
+
+// reserve adds n bytes to the space used, failing with ErrFull if it would exceed the quota.
+func (m *Manager) reserve(n int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.max > 0 && m.used+n > m.max {
+		return fmt.Errorf("%w: %d of %d bytes used, %d more requested", ErrFull, m.used, m.max, n)
+	}
+	m.used += n
+	return nil
+}
+
+func (m *Manager) release(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.used -= n
+}
+
+// Write implements io.Writer, failing with ErrFull if the file would exceed the quota.
+func (f *File) Write(p []byte) (int, error) {
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if err := f.grow(off + int64(len(p))); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+// WriteAt implements io.WriterAt, failing with ErrFull if the file would exceed the quota.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.grow(off + int64(len(p))); err != nil {
+		return 0, err
+	}
+	return f.File.WriteAt(p, off)
+}
+
+// Truncate changes the size of the file, failing with ErrFull if it would exceed the quota. Space isn't returned to
+// the quota until the file is closed.
+func (f *File) Truncate(size int64) error {
+	if err := f.grow(size); err != nil {
+		return err
+	}
+	return f.File.Truncate(size)
+}
+
+// WriteString implements io.StringWriter, failing with ErrFull if the file would exceed the quota.
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// ReadFrom implements io.ReaderFrom with Write, so copies into the file are subject to the quota.
+func (f *File) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{f}, r)
+}
+
+// Close closes and removes the file, returning its space to the quota.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.m.release(f.reserved)
+
+	err := f.File.Close()
+	if rerr := os.Remove(f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// grow reserves space for the file to be size bytes.
+func (f *File) grow(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if size <= f.reserved {
+		return nil
+	}
+	if err := f.m.reserve(size - f.reserved); err != nil {
+		return err
+	}
+	f.reserved = size
+	return nil
+}
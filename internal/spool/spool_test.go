@@ -0,0 +1,86 @@
+package spool_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb/internal/spool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager(t *testing.T) {
+	t.Run("enforces the quota", func(t *testing.T) {
+		m, err := New(t.TempDir(), 100)
+		require.NoError(t, err)
+
+		a, err := m.Create()
+		require.NoError(t, err)
+		_, err = a.Write(make([]byte, 60))
+		require.NoError(t, err)
+		require.Equal(t, int64(60), m.Used())
+
+		b, err := m.Create()
+		require.NoError(t, err)
+		_, err = io.Copy(b, bytes.NewReader(make([]byte, 50)))
+		require.ErrorIs(t, err, ErrFull)
+		require.ErrorIs(t, b.Truncate(50), ErrFull)
+		_, err = b.WriteAt(make([]byte, 10), 40)
+		require.ErrorIs(t, err, ErrFull)
+
+		// Rewriting a file doesn't use more space.
+		_, err = a.WriteAt(make([]byte, 10), 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(60), m.Used())
+
+		// Closing a file returns its space to the quota.
+		require.NoError(t, a.Close())
+		require.NoError(t, a.Close())
+		require.Equal(t, int64(0), m.Used())
+		require.NoError(t, b.Truncate(100))
+		require.Equal(t, int64(100), m.Used())
+		require.NoError(t, b.Close())
+	})
+
+	t.Run("removes closed files", func(t *testing.T) {
+		dir := t.TempDir()
+		m, err := New(dir, 0)
+		require.NoError(t, err)
+
+		f, err := m.Create()
+		require.NoError(t, err)
+		_, err = f.WriteString("data")
+		require.NoError(t, err)
+		require.Equal(t, dir, filepath.Dir(f.Name()))
+
+		data := make([]byte, 4)
+		_, err = f.ReadAt(data, 0)
+		require.NoError(t, err)
+		require.Equal(t, "data", string(data))
+
+		require.NoError(t, f.Close())
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("evicts stale files", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "spool")
+		m, err := New(dir, 0)
+		require.NoError(t, err)
+
+		// A file left behind by a crashed process.
+		f, err := m.Create()
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "unrelated"), nil, 0o600))
+
+		_, err = New(dir, 0)
+		require.NoError(t, err)
+		_, err = os.Stat(f.Name())
+		require.ErrorIs(t, err, os.ErrNotExist)
+		_, err = os.Stat(filepath.Join(dir, "unrelated"))
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,286 @@
+// Package sumdbclient is a client for an upstream checksum database (e.g. sum.golang.org). Every record it returns is
+// verified to be included in the database's signed tree, and every tree it sees is verified to be consistent with the
+// previous ones, so that a compromised or forked upstream is detected rather than trusted.
+package sumdbclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pseudomuto/sumdb/internal/lru"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+const (
+	// tileHeight is the height of the tiles served by checksum databases, as required by the protocol.
+	tileHeight = 8
+
+	// tileCacheSize is the number of full tiles kept in memory. Full tiles never change, and the tiles near the root
+	// are needed by every lookup.
+	tileCacheSize = 1024
+
+	// maxResponseSize bounds the size of lookup and tile responses.
+	maxResponseSize = 1 << 20
+)
+
+var (
+	// ErrNotFound is returned when the upstream doesn't have a record for the requested module version (i.e. it
+	// responds with 404 Not Found or 410 Gone).
+	ErrNotFound = errors.New("module version not found")
+
+	// ErrVerification is returned when a response from the upstream can't be verified: its signature is invalid, its
+	// tree is inconsistent with a previously seen one or the record isn't included in the tree.
+	ErrVerification = errors.New("upstream checksum database verification failed")
+
+	// ErrInconsistentTree is returned along with ErrVerification when a signed tree head is inconsistent with a
+	// previously seen one. Both heads are signed by the upstream, so together they prove it has forked its log.
+	ErrInconsistentTree = errors.New("inconsistent tree heads")
+)
+
+type (
+	// HTTPClient defines an HTTP client for executing requests.
+	HTTPClient interface {
+		Do(*http.Request) (*http.Response, error)
+	}
+
+	// Client looks up records in an upstream checksum database.
+	Client struct {
+		client   HTTPClient
+		upstream string
+		verifier note.Verifiers
+
+		// tiles caches full tiles by path.
+		tiles *lru.Cache[string, []byte]
+
+		// latest is the largest tree seen, which all other trees must be consistent with.
+		mu     sync.Mutex
+		latest tlog.Tree
+	}
+
+	// tileReader is a tlog.TileReader fetching tiles from the upstream.
+	tileReader struct {
+		ctx context.Context
+		c   *Client
+	}
+)
+
+// New creates a Client for the checksum database at upstream (e.g. https://sum.golang.org), whose tree heads are
+// signed by the key with the verifier key vkey.
+func New(client HTTPClient, upstream, vkey string) (*Client, error) {
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verifier key: %w", err)
+	}
+
+	return &Client{
+		client:   client,
+		upstream: strings.TrimSuffix(upstream, "/"),
+		verifier: note.VerifierList(v),
+		tiles:    lru.New[string, []byte](tileCacheSize),
+	}, nil
+}
+
+// Lookup returns the data of the upstream's record for mod (its go.sum lines) once it has verified that the record is
+// included in the upstream's signed tree.
+func (c *Client) Lookup(ctx context.Context, mod module.Version) ([]byte, error) {
+	path, err := module.EscapePath(mod.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to escape path: %s, %w", mod.Path, err)
+	}
+
+	version, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to escape version: %s, %w", mod.Version, err)
+	}
+
+	msg, err := c.get(ctx, "lookup/"+path+"@"+version)
+	if err != nil {
+		return nil, err
+	}
+
+	id, data, signed, err := tlog.ParseRecord(msg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed lookup response: %s, %w", ErrVerification, mod, err)
+	}
+
+	if err := checkRecordData(mod, data); err != nil {
+		return nil, err
+	}
+
+	tree, err := c.VerifyTree(ctx, signed)
+	if err != nil {
+		return nil, err
+	}
+
+	if id < 0 || id >= tree.N {
+		return nil, fmt.Errorf("%w: record %d is outside of tree of size %d", ErrVerification, id, tree.N)
+	}
+
+	hashes, err := tlog.TileHashReader(tree, &tileReader{ctx: ctx, c: c}).ReadHashes([]int64{tlog.StoredHashIndex(0, id)})
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read record hash: %d, %w", ErrVerification, id, err)
+	}
+
+	if hashes[0] != tlog.RecordHash(data) {
+		return nil, fmt.Errorf("%w: record %d isn't included in tree of size %d", ErrVerification, id, tree.N)
+	}
+
+	return data, nil
+}
+
+// Latest returns the upstream's latest signed tree head as served, without verifying it. See VerifyTree.
+func (c *Client) Latest(ctx context.Context) ([]byte, error) {
+	return c.get(ctx, "latest")
+}
+
+// VerifyTree verifies the signed tree head and its consistency with the largest tree seen so far, which it replaces
+// when the new tree is larger. Inconsistent trees return an error wrapping both ErrVerification and
+// ErrInconsistentTree.
+func (c *Client) VerifyTree(ctx context.Context, signed []byte) (tlog.Tree, error) {
+	n, err := note.Open(signed, c.verifier)
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("%w: invalid signed tree head: %w", ErrVerification, err)
+	}
+
+	tree, err := tlog.ParseTree([]byte(n.Text))
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("%w: invalid tree: %w", ErrVerification, err)
+	}
+
+	c.mu.Lock()
+	latest := c.latest
+	c.mu.Unlock()
+
+	if latest.N > 0 {
+		// The proof is read from the larger of the trees, whose tiles cover both.
+		larger, smaller := tree, latest
+		if smaller.N > larger.N {
+			larger, smaller = smaller, larger
+		}
+
+		proof, err := tlog.ProveTree(larger.N, smaller.N, tlog.TileHashReader(larger, &tileReader{ctx: ctx, c: c}))
+		if err != nil {
+			return tlog.Tree{}, fmt.Errorf("%w: failed to prove tree consistency: %w", ErrVerification, err)
+		}
+
+		if err := tlog.CheckTree(proof, larger.N, larger.Hash, smaller.N, smaller.Hash); err != nil {
+			return tlog.Tree{}, fmt.Errorf("%w: %w: tree of size %d is inconsistent with tree of size %d: %w",
+				ErrVerification, ErrInconsistentTree, tree.N, latest.N, err)
+		}
+	}
+
+	c.mu.Lock()
+	if tree.N > c.latest.N {
+		c.latest = tree
+	}
+	c.mu.Unlock()
+
+	return tree, nil
+}
+
+// TileReader returns a tlog.TileReader fetching tiles from the upstream, for reading hashes of verified trees with
+// tlog.TileHashReader. The full tiles that tlog verifies are cached.
+func (c *Client) TileReader(ctx context.Context) tlog.TileReader {
+	return &tileReader{ctx: ctx, c: c}
+}
+
+// ReadDataTile returns the data tile t as served by the upstream, falling back to the full tile when a partial tile
+// isn't served (anymore). Data tiles aren't verified: their records must be authenticated against the hashes of a
+// verified tree.
+func (c *Client) ReadDataTile(ctx context.Context, t tlog.Tile) ([]byte, error) {
+	data, err := c.get(ctx, t.Path())
+	if errors.Is(err, ErrNotFound) && t.W < 1<<t.H {
+		t.W = 1 << t.H
+		data, err = c.get(ctx, t.Path())
+	}
+	return data, err
+}
+
+// get fetches the file at path from the upstream.
+func (c *Client) get(ctx context.Context, path string) ([]byte, error) {
+	url := c.upstream + "/" + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating request: %s, %w", url, err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading response: %s, %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return nil, fmt.Errorf("get %s, %w, received: %d", path, ErrNotFound, resp.StatusCode)
+	default:
+		return nil, fmt.Errorf("get %s, expected: %d, received: %d", path, http.StatusOK, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %s, %w", url, err)
+	}
+	if len(data) > maxResponseSize {
+		return nil, fmt.Errorf("response too large: %s", url)
+	}
+	return data, nil
+}
+
+// checkRecordData checks that data holds the go.sum lines of mod: one for its zip and one for its go.mod.
+func checkRecordData(mod module.Version, data []byte) error {
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	if len(lines) != 2 {
+		return fmt.Errorf("%w: record for %s has %d lines", ErrVerification, mod, len(lines))
+	}
+
+	for i, suffix := range []string{"", "/go.mod"} {
+		fields := strings.Fields(string(lines[i]))
+		if len(fields) != 3 || fields[0] != mod.Path || fields[1] != mod.Version+suffix ||
+			!strings.HasPrefix(fields[2], "h1:") {
+			return fmt.Errorf("%w: record isn't for %s: %q", ErrVerification, mod, lines[i])
+		}
+	}
+	return nil
+}
+
+// Height implements tlog.TileReader.
+func (r *tileReader) Height() int { return tileHeight }
+
+// ReadTiles implements tlog.TileReader.
+func (r *tileReader) ReadTiles(tiles []tlog.Tile) ([][]byte, error) {
+	data := make([][]byte, len(tiles))
+	for i, t := range tiles {
+		path := t.Path()
+		if d, ok := r.c.tiles.Get(path); ok {
+			data[i] = d
+			continue
+		}
+
+		d, err := r.c.get(r.ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = d
+	}
+	return data, nil
+}
+
+// SaveTiles implements tlog.TileReader. It's called with tiles that have been verified against the tree, of which
+// the full ones are cached.
+func (r *tileReader) SaveTiles(tiles []tlog.Tile, data [][]byte) {
+	for i, t := range tiles {
+		if t.W == 1<<t.H {
+			r.c.tiles.Add(t.Path(), data[i])
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package sumdbclient_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb/internal/sumdbclient"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestClient(t *testing.T) {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	require.NoError(t, err)
+
+	log := newTestLog(t, skey)
+	for i := range 300 {
+		log.add(module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"})
+	}
+
+	srv := httptest.NewServer(sumdb.NewServer(log))
+	t.Cleanup(srv.Close)
+
+	client, err := New(http.DefaultClient, srv.URL, vkey)
+	require.NoError(t, err)
+
+	t.Run("verified lookups", func(t *testing.T) {
+		for _, i := range []int{0, 255, 299} {
+			mod := module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"}
+			data, err := client.Lookup(t.Context(), mod)
+			require.NoError(t, err)
+			require.Equal(t, string(recordData(mod)), string(data))
+		}
+
+		// The tree may grow between lookups.
+		mod := log.add(module.Version{Path: "example.com/new", Version: "v1.0.0"})
+		data, err := client.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+		require.Equal(t, string(recordData(mod)), string(data))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := client.Lookup(t.Context(), module.Version{Path: "example.com/missing", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("tampered records", func(t *testing.T) {
+		mod := module.Version{Path: "example.com/mod7", Version: "v1.0.0"}
+		log.tamper(7, []byte("example.com/mod7 v1.0.0 h1:tampered=\nexample.com/mod7 v1.0.0/go.mod h1:tampered=\n"))
+		t.Cleanup(func() { log.tamper(7, nil) })
+
+		_, err := client.Lookup(t.Context(), mod)
+		require.ErrorIs(t, err, ErrVerification)
+	})
+
+	t.Run("records for other modules", func(t *testing.T) {
+		log.redirect("example.com/mod8", 9)
+		t.Cleanup(func() { log.redirect("example.com/mod8", 8) })
+
+		_, err := client.Lookup(t.Context(), module.Version{Path: "example.com/mod8", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrVerification)
+	})
+
+	t.Run("data tiles", func(t *testing.T) {
+		data, err := client.ReadDataTile(t.Context(), tlog.Tile{H: 8, L: -1, N: 1, W: 2})
+		require.NoError(t, err)
+
+		want := append(recordData(module.Version{Path: "example.com/mod256", Version: "v1.0.0"}), '\n')
+		want = append(want, recordData(module.Version{Path: "example.com/mod257", Version: "v1.0.0"})...)
+		require.Equal(t, string(want)+"\n", string(data))
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, otherVKey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+		require.NoError(t, err)
+
+		other, err := New(http.DefaultClient, srv.URL, otherVKey)
+		require.NoError(t, err)
+
+		_, err = other.Lookup(t.Context(), module.Version{Path: "example.com/mod1", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrVerification)
+	})
+
+	t.Run("forked trees", func(t *testing.T) {
+		// A fork of the log, with different records and one more of them.
+		fork := newTestLog(t, skey)
+		for i := range log.size() {
+			fork.add(module.Version{Path: fmt.Sprintf("example.com/fork%d", i), Version: "v1.0.0"})
+		}
+		mod := fork.add(module.Version{Path: "example.com/mod1", Version: "v1.0.0"})
+
+		forkSrv := httptest.NewServer(sumdb.NewServer(fork))
+		t.Cleanup(forkSrv.Close)
+
+		forked, err := New(http.DefaultClient, forkSrv.URL, vkey)
+		require.NoError(t, err)
+		_, err = forked.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+
+		// The original log's tree is inconsistent with the fork's.
+		fork.serveFrom(log)
+		_, err = forked.Lookup(t.Context(), module.Version{Path: "example.com/mod1", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrVerification)
+
+		// A larger fork can prove its tree is inconsistent with the original's.
+		other, err := New(http.DefaultClient, srv.URL, vkey)
+		require.NoError(t, err)
+		_, err = other.Lookup(t.Context(), module.Version{Path: "example.com/mod1", Version: "v1.0.0"})
+		require.NoError(t, err)
+
+		log.serveFrom(fork)
+		t.Cleanup(func() { log.serveFrom(nil) })
+		_, err = other.Lookup(t.Context(), mod)
+		require.ErrorIs(t, err, ErrVerification)
+		require.ErrorIs(t, err, ErrInconsistentTree)
+	})
+
+	t.Run("invalid verifier key", func(t *testing.T) {
+		_, err := New(http.DefaultClient, srv.URL, "not a key")
+		require.Error(t, err)
+	})
+}
+
+// testLog is an in-memory checksum database implementing sumdb.ServerOps.
+type testLog struct {
+	t      *testing.T
+	signer note.Signer
+
+	mu      sync.Mutex
+	records [][]byte
+	ids     map[string]int64
+	hashes  map[int64]tlog.Hash
+	served  *testLog         // the log actually served, if not this one
+	tampers map[int64][]byte // record data served in place of the stored data
+}
+
+func newTestLog(t *testing.T, skey string) *testLog {
+	t.Helper()
+
+	s, err := note.NewSigner(skey)
+	require.NoError(t, err)
+
+	return &testLog{
+		t:       t,
+		signer:  s,
+		ids:     make(map[string]int64),
+		hashes:  make(map[int64]tlog.Hash),
+		tampers: make(map[int64][]byte),
+	}
+}
+
+// add appends the record for mod and returns mod.
+func (l *testLog) add(mod module.Version) module.Version {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := int64(len(l.records))
+	data := recordData(mod)
+	hashes, err := tlog.StoredHashes(id, data, l)
+	require.NoError(l.t, err)
+	for i, h := range hashes {
+		l.hashes[tlog.StoredHashIndex(0, id)+int64(i)] = h
+	}
+
+	l.records = append(l.records, data)
+	l.ids[mod.Path] = id
+	return mod
+}
+
+func (l *testLog) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.records)
+}
+
+// tamper serves data for the record with the given id, or the stored data if data is nil.
+func (l *testLog) tamper(id int64, data []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tampers[id] = data
+}
+
+// redirect serves the record with the given id for lookups of path.
+func (l *testLog) redirect(path string, id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ids[path] = id
+}
+
+// serveFrom serves other instead of l.
+func (l *testLog) serveFrom(other *testLog) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.served = other
+}
+
+func (l *testLog) current() *testLog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.served != nil {
+		return l.served
+	}
+	return l
+}
+
+// ReadHashes implements tlog.HashReader. It must be called with l.mu held.
+func (l *testLog) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	out := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		h, ok := l.hashes[idx]
+		if !ok {
+			return nil, fmt.Errorf("missing hash %d", idx)
+		}
+		out[i] = h
+	}
+	return out, nil
+}
+
+func (l *testLog) Signed(context.Context) ([]byte, error) {
+	l = l.current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := int64(len(l.records))
+	h, err := tlog.TreeHash(n, l)
+	if err != nil {
+		return nil, err
+	}
+	return note.Sign(&note.Note{Text: string(tlog.FormatTree(tlog.Tree{N: n, Hash: h}))}, l.signer)
+}
+
+func (l *testLog) ReadRecords(_ context.Context, id, n int64) ([][]byte, error) {
+	l = l.current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var recs [][]byte
+	for i := id; i < id+n && i < int64(len(l.records)); i++ {
+		if data := l.tampers[i]; data != nil {
+			recs = append(recs, data)
+			continue
+		}
+		recs = append(recs, l.records[i])
+	}
+	return recs, nil
+}
+
+func (l *testLog) Lookup(_ context.Context, mod module.Version) (int64, error) {
+	l = l.current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id, ok := l.ids[mod.Path]
+	if !ok {
+		return 0, os.ErrNotExist
+	}
+	return id, nil
+}
+
+func (l *testLog) ReadTileData(_ context.Context, t tlog.Tile) ([]byte, error) {
+	l = l.current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return tlog.ReadTileData(t, l)
+}
+
+// recordData returns the data of the record for mod.
+func recordData(mod module.Version) []byte {
+	h := sha256.Sum256([]byte(mod.String()))
+	return fmt.Appendf(nil, "%s %s h1:%x=\n%s %s/go.mod h1:%x=\n", mod.Path, mod.Version, h[:16], mod.Path,
+		mod.Version, h[16:])
+}
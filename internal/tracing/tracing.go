@@ -0,0 +1,89 @@
+// Package tracing defines the interfaces spans are reported through, which the sumdb package exports for
+// sumdb.WithTracerProvider, and starts spans with the Tracer carried by a context, so that packages doing work on
+// behalf of a traced operation report their spans as its children without being configured themselves.
+package tracing
+
+import "context"
+
+type (
+	// Provider creates Tracers, e.g. by adapting an OpenTelemetry TracerProvider.
+	Provider interface {
+		// Tracer returns the Tracer for the named instrumentation scope.
+		Tracer(name string) Tracer
+	}
+
+	// Tracer starts spans.
+	Tracer interface {
+		// Start starts the named span, as a child of the span carried by ctx if any, and returns a copy of ctx carrying
+		// it.
+		Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+	}
+
+	// Span is a traced operation.
+	Span interface {
+		// SetAttributes adds attrs to the span, replacing any with the same keys.
+		SetAttributes(attrs ...Attribute)
+
+		// RecordError records that the operation failed with err.
+		RecordError(err error)
+
+		// End ends the span.
+		End()
+	}
+
+	// Attribute is a key-value pair describing a span. Values are strings, int64s or bools.
+	Attribute struct {
+		Key   string
+		Value any
+	}
+
+	// tracerKey is the context key for the Tracer set with WithTracer.
+	tracerKey struct{}
+
+	// noopSpan is the span returned by Start without a Tracer.
+	noopSpan struct{}
+)
+
+// String returns a string Attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int64 returns an int64 Attribute.
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a bool Attribute.
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// WithTracer returns a copy of ctx carrying t, which Start starts spans with. It returns ctx if t is nil.
+func WithTracer(ctx context.Context, t Tracer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// Start starts the named span with the Tracer carried by ctx. Without one, it returns ctx and a span doing nothing.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t, ok := ctx.Value(tracerKey{}).(Tracer)
+	if !ok {
+		return ctx, noopSpan{}
+	}
+	return t.Start(ctx, name, attrs...)
+}
+
+// End records err on span, if it isn't nil, and ends it.
+func End(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
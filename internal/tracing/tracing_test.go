@@ -0,0 +1,71 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb/internal/tracing"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	recordingTracer struct {
+		spans []*recordedSpan
+	}
+
+	recordedSpan struct {
+		name   string
+		parent *recordedSpan
+		attrs  []Attribute
+		err    error
+		ended  bool
+	}
+
+	spanKey struct{}
+)
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	s := &recordedSpan{name: name, parent: parent, attrs: attrs}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) { s.attrs = append(s.attrs, attrs...) }
+func (s *recordedSpan) RecordError(err error)            { s.err = err }
+func (s *recordedSpan) End()                             { s.ended = true }
+
+func TestStart(t *testing.T) {
+	// Without a tracer, spans do nothing.
+	ctx, span := Start(t.Context(), "untraced")
+	require.Equal(t, t.Context(), ctx)
+	End(span, errors.New("ignored"))
+
+	tracer := &recordingTracer{}
+	ctx, parent := Start(WithTracer(t.Context(), tracer), "parent", String("module.path", "example.com/a"))
+	_, child := Start(ctx, "child", Int64("size", 2), Bool("cold", true))
+	child.SetAttributes(String("result", "ok"))
+	End(child, errors.New("boom"))
+	End(parent, nil)
+
+	require.Len(t, tracer.spans, 2)
+	require.Equal(t, "parent", tracer.spans[0].name)
+	require.Nil(t, tracer.spans[0].parent)
+	require.Equal(t, []Attribute{{Key: "module.path", Value: "example.com/a"}}, tracer.spans[0].attrs)
+	require.NoError(t, tracer.spans[0].err)
+	require.True(t, tracer.spans[0].ended)
+
+	require.Equal(t, "child", tracer.spans[1].name)
+	require.Same(t, tracer.spans[0], tracer.spans[1].parent)
+	require.Equal(t, []Attribute{
+		{Key: "size", Value: int64(2)},
+		{Key: "cold", Value: true},
+		{Key: "result", Value: "ok"},
+	}, tracer.spans[1].attrs)
+	require.EqualError(t, tracer.spans[1].err, "boom")
+	require.True(t, tracer.spans[1].ended)
+
+	// A nil tracer leaves the context as is.
+	require.Equal(t, t.Context(), WithTracer(t.Context(), nil))
+}
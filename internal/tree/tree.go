@@ -3,8 +3,13 @@ package tree
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/bits"
+	"slices"
+	"sync"
 
+	"github.com/pseudomuto/sumdb/internal/tracing"
 	"golang.org/x/mod/sumdb/tlog"
 )
 
@@ -12,6 +17,19 @@ import (
 // Each tile contains 2^TileHeight = 256 hashes.
 const TileHeight = 8
 
+// indexPool holds the buffers AppendTile computes hash indexes in, sized for a full tile.
+var indexPool = sync.Pool{
+	New: func() any {
+		buf := make([]int64, 0, 1<<TileHeight)
+		return &buf
+	},
+}
+
+// ErrMissingHash is returned when a hash needed to compute the tree doesn't exist in the store. Stores may return it
+// directly, and hashes that are read back as all zeros are treated as missing rather than being hashed into tree
+// heads and proofs.
+var ErrMissingHash = errors.New("missing hash")
+
 type (
 	// HashStore defines the interface for hash storage operations.
 	// This is a subset of the main Store interface focused on hash operations.
@@ -22,17 +40,38 @@ type (
 		SetTreeSize(ctx context.Context, size int64) error
 	}
 
+	// PathStep is one step of a record's path from its leaf up to the root of the tree: the node reached so far is
+	// combined with its sibling to produce their parent.
+	PathStep struct {
+		Level   int       // height of the parent, with leaves at level 0
+		Start   int64     // first record covered by the sibling
+		End     int64     // end of the records covered by the sibling (exclusive)
+		Left    bool      // whether the sibling is the parent's left child
+		Sibling tlog.Hash // hash of the sibling
+		Hash    tlog.Hash // hash of the parent
+	}
+
 	// hashReader adapts a HashStore to implement tlog.HashReader.
 	hashReader struct {
 		ctx   context.Context
 		store HashStore
 	}
+
+	// batchHashReader is a hashReader that also returns the hashes computed for a batch of records that haven't been
+	// written yet.
+	batchHashReader struct {
+		hashReader
+		pending map[int64]tlog.Hash
+	}
 )
 
 // AddRecord computes and stores the hashes for a new record at the given ID.
 // The caller must ensure that id equals the current tree size (i.e., this is
 // an append operation). After successful completion, the tree size is incremented.
-func AddRecord(ctx context.Context, store HashStore, id int64, data []byte) error {
+func AddRecord(ctx context.Context, store HashStore, id int64, data []byte) (err error) {
+	ctx, span := tracing.Start(ctx, "tree.AddRecord", tracing.Int64("record.id", id))
+	defer func() { tracing.End(span, err) }()
+
 	hr := &hashReader{ctx: ctx, store: store}
 
 	// Compute hashes that need to be stored for this record
@@ -64,20 +103,143 @@ func AddRecord(ctx context.Context, store HashStore, id int64, data []byte) erro
 	return nil
 }
 
+// AddRecords computes and stores the hashes for new records at IDs [id, id+len(data)), as calling AddRecord for each
+// of them would, but writes the hashes and the tree size once for the whole batch. Hashes computed for earlier records
+// of the batch are reused for the later ones rather than read back from the store.
+func AddRecords(ctx context.Context, store HashStore, id int64, data [][]byte) (err error) {
+	if len(data) == 0 {
+		return nil
+	}
+
+	ctx, span := tracing.Start(ctx, "tree.AddRecords",
+		tracing.Int64("record.id", id), tracing.Int64("record.count", int64(len(data))))
+	defer func() { tracing.End(span, err) }()
+
+	hr := &batchHashReader{hashReader: hashReader{ctx: ctx, store: store}, pending: make(map[int64]tlog.Hash)}
+
+	var (
+		indexes []int64
+		hashes  []tlog.Hash
+	)
+	for i, d := range data {
+		n := id + int64(i)
+		h, err := tlog.StoredHashes(n, d, hr)
+		if err != nil {
+			return fmt.Errorf("failed to compute hashes for record %d: %w", n, err)
+		}
+
+		for j, index := range storedHashIndexes(n, len(h)) {
+			hr.pending[index] = h[j]
+			indexes = append(indexes, index)
+		}
+		hashes = append(hashes, h...)
+	}
+
+	if err := store.WriteHashes(ctx, indexes, hashes); err != nil {
+		return fmt.Errorf("failed to write hashes for records [%d, %d): %w", id, id+int64(len(data)), err)
+	}
+
+	if err := store.SetTreeSize(ctx, id+int64(len(data))); err != nil {
+		return fmt.Errorf("failed to update tree size: %w", err)
+	}
+
+	return nil
+}
+
 // ReadTile reads tile data from the store.
 // This returns the raw bytes for the tile, suitable for serving to clients.
 func ReadTile(ctx context.Context, store HashStore, t tlog.Tile) ([]byte, error) {
-	hr := &hashReader{ctx: ctx, store: store}
-	data, err := tlog.ReadTileData(t, hr)
+	return AppendTile(ctx, store, t, nil)
+}
+
+// AppendTile appends the data of the hash tile t to dst and returns the extended buffer.
+//
+// It's the allocation-free path for serving tiles: the hash indexes are computed into a pooled buffer and the hashes
+// are copied directly into dst, so callers that reuse dst (e.g. from a sync.Pool) only allocate what the store does
+// to return the hashes.
+func AppendTile(ctx context.Context, store HashStore, t tlog.Tile, dst []byte) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "tree.ReadTile")
+	defer func() { tracing.End(span, err) }()
+
+	if t.L < 0 {
+		return nil, fmt.Errorf("failed to read tile %s: not a hash tile", t.Path())
+	}
+
+	w := t.W
+	if w == 0 {
+		w = 1 << t.H
+	}
+
+	buf := indexPool.Get().(*[]int64)
+	defer indexPool.Put(buf)
+
+	*buf = slices.Grow((*buf)[:0], w)
+	indexes := (*buf)[:w]
+	start := t.N << t.H
+	for i := range indexes {
+		indexes[i] = tlog.StoredHashIndex(t.H*t.L, start+int64(i))
+	}
+
+	hr := hashReader{ctx: ctx, store: store}
+	hashes, err := hr.ReadHashes(indexes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read tile %s: %w", t.Path(), err)
 	}
-	return data, nil
+
+	dst = slices.Grow(dst, w*tlog.HashSize)
+	for _, h := range hashes {
+		dst = append(dst, h[:]...)
+	}
+	return dst, nil
 }
 
-// ReadHashes implements tlog.HashReader.
+// ReadHashes implements tlog.HashReader, verifying that every requested hash is present.
 func (r *hashReader) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
-	return r.store.ReadHashes(r.ctx, indexes)
+	hashes, err := r.store.ReadHashes(r.ctx, indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(hashes) != len(indexes) {
+		return nil, fmt.Errorf("store returned %d hashes for %d indexes", len(hashes), len(indexes))
+	}
+
+	for i, h := range hashes {
+		if h == (tlog.Hash{}) {
+			return nil, fmt.Errorf("%w: %d", ErrMissingHash, indexes[i])
+		}
+	}
+
+	return hashes, nil
+}
+
+// ReadHashes implements tlog.HashReader, returning the hashes computed for the batch and reading the others from the
+// store.
+func (r *batchHashReader) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	hashes := make([]tlog.Hash, len(indexes))
+	var stored []int64
+	for i, index := range indexes {
+		if h, ok := r.pending[index]; ok {
+			hashes[i] = h
+		} else {
+			stored = append(stored, index)
+		}
+	}
+	if len(stored) == 0 {
+		return hashes, nil
+	}
+
+	read, err := r.hashReader.ReadHashes(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, index := range indexes {
+		if _, ok := r.pending[index]; !ok {
+			hashes[i], read = read[0], read[1:]
+		}
+	}
+	return hashes, nil
 }
 
 // storedHashIndexes computes the storage indexes for hashes produced by
@@ -103,11 +265,19 @@ func TreeHash(ctx context.Context, store HashStore) (tlog.Hash, error) {
 		return tlog.Hash{}, fmt.Errorf("failed to get tree size: %w", err)
 	}
 
+	return TreeHashAt(ctx, store, size)
+}
+
+// TreeHashAt returns the root hash of the tree when it had the given size.
+func TreeHashAt(ctx context.Context, store HashStore, size int64) (_ tlog.Hash, err error) {
 	if size == 0 {
 		// Empty tree has a well-defined hash
 		return tlog.Hash{}, nil
 	}
 
+	ctx, span := tracing.Start(ctx, "tree.TreeHash", tracing.Int64("tree.size", size))
+	defer func() { tracing.End(span, err) }()
+
 	hr := &hashReader{ctx: ctx, store: store}
 	hash, err := tlog.TreeHash(size, hr)
 	if err != nil {
@@ -116,3 +286,102 @@ func TreeHash(ctx context.Context, store HashStore) (tlog.Hash, error) {
 
 	return hash, nil
 }
+
+// ProveRecord returns the proof that the record with the given ID is contained in the tree of the given size.
+func ProveRecord(ctx context.Context, store HashStore, size, id int64) (_ tlog.RecordProof, err error) {
+	ctx, span := tracing.Start(ctx, "tree.ProveRecord", tracing.Int64("tree.size", size), tracing.Int64("record.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	hr := &hashReader{ctx: ctx, store: store}
+	proof, err := tlog.ProveRecord(size, id, hr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prove record %d in tree of size %d: %w", id, size, err)
+	}
+	return proof, nil
+}
+
+// ProveTree returns the proof that the tree of the given size contains the tree of size oldSize.
+func ProveTree(ctx context.Context, store HashStore, size, oldSize int64) (_ tlog.TreeProof, err error) {
+	ctx, span := tracing.Start(ctx, "tree.ProveTree",
+		tracing.Int64("tree.size", size), tracing.Int64("tree.old_size", oldSize))
+	defer func() { tracing.End(span, err) }()
+
+	hr := &hashReader{ctx: ctx, store: store}
+	proof, err := tlog.ProveTree(size, oldSize, hr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prove tree of size %d contains tree of size %d: %w", size, oldSize, err)
+	}
+	return proof, nil
+}
+
+// RecordPath returns the path from the record with the given ID up to the root of the tree of the given size. The
+// siblings along the path are the record's inclusion proof, and the last step's hash is the tree's root hash.
+func RecordPath(ctx context.Context, store HashStore, size, id int64) ([]PathStep, error) {
+	if id < 0 || id >= size {
+		return nil, fmt.Errorf("record %d isn't in tree of size %d", id, size)
+	}
+
+	// Walk down from the root, splitting each node's records at the largest power of two less than their number.
+	var steps []PathStep
+	for lo, hi := int64(0), size; hi-lo > 1; {
+		level := bits.Len64(uint64(hi - lo - 1))
+		mid := lo + 1<<(level-1)
+		if id < mid {
+			steps = append(steps, PathStep{Level: level, Start: mid, End: hi})
+			hi = mid
+		} else {
+			steps = append(steps, PathStep{Level: level, Start: lo, End: mid, Left: true})
+			lo = mid
+		}
+	}
+	slices.Reverse(steps)
+
+	// Siblings that aren't complete subtrees are made up of several, whose hashes are read along with the leaf's.
+	indexes := []int64{tlog.StoredHashIndex(0, id)}
+	for _, step := range steps {
+		indexes = appendSubtreeIndexes(indexes, step.Start, step.End)
+	}
+
+	hr := &hashReader{ctx: ctx, store: store}
+	hashes, err := hr.ReadHashes(indexes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read path of record %d in tree of size %d: %w", id, size, err)
+	}
+
+	node, hashes := hashes[0], hashes[1:]
+	for i := range steps {
+		n := len(appendSubtreeIndexes(nil, steps[i].Start, steps[i].End))
+		steps[i].Sibling = subtreeHash(hashes[:n])
+		hashes = hashes[n:]
+
+		if steps[i].Left {
+			node = tlog.NodeHash(steps[i].Sibling, node)
+		} else {
+			node = tlog.NodeHash(node, steps[i].Sibling)
+		}
+		steps[i].Hash = node
+	}
+
+	return steps, nil
+}
+
+// appendSubtreeIndexes appends the indexes of the stored hashes of the complete subtrees covering records [lo, hi),
+// from left to right.
+func appendSubtreeIndexes(indexes []int64, lo, hi int64) []int64 {
+	for lo < hi {
+		level := bits.Len64(uint64(hi-lo)) - 1
+		indexes = append(indexes, tlog.StoredHashIndex(level, lo>>level))
+		lo += 1 << level
+	}
+	return indexes
+}
+
+// subtreeHash combines the hashes of the complete subtrees covering a range of records, which decrease in size from
+// left to right, into the hash of the range.
+func subtreeHash(hashes []tlog.Hash) tlog.Hash {
+	h := hashes[len(hashes)-1]
+	for _, left := range slices.Backward(hashes[:len(hashes)-1]) {
+		h = tlog.NodeHash(left, h)
+	}
+	return h
+}
@@ -2,6 +2,7 @@ package tree_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	. "github.com/pseudomuto/sumdb/internal/tree"
@@ -58,6 +59,40 @@ func TestAddRecord_MultipleRecords(t *testing.T) {
 	require.Greater(t, len(store.hashes), 4)
 }
 
+func TestAddRecords(t *testing.T) {
+	ctx := context.Background()
+
+	records := make([][]byte, 300)
+	for i := range records {
+		records[i] = fmt.Appendf(nil, "github.com/example/m%d v1.0.0 h1:%d\n", i, i)
+	}
+
+	// Records added one at a time, for reference.
+	want := newMockStore()
+	for i, data := range records {
+		require.NoError(t, AddRecord(ctx, want, int64(i), data))
+	}
+
+	// Batches may start anywhere in the tree, and span tiles.
+	store := newMockStore()
+	for _, batch := range [][2]int{{0, 0}, {0, 5}, {5, 6}, {6, 255}, {255, 300}} {
+		require.NoError(t, AddRecords(ctx, store, int64(batch[0]), records[batch[0]:batch[1]]))
+
+		size, err := store.TreeSize(ctx)
+		require.NoError(t, err)
+		require.Equal(t, int64(batch[1]), size)
+	}
+
+	require.Equal(t, want.hashes, store.hashes)
+
+	t.Run("missing hashes", func(t *testing.T) {
+		store := newMockStore()
+		store.treeSize = 4
+		require.ErrorIs(t, AddRecords(ctx, store, 4, records[4:8]), ErrMissingHash)
+		require.Empty(t, store.hashes)
+	})
+}
+
 func TestTreeHash_EmptyTree(t *testing.T) {
 	ctx := context.Background()
 	store := newMockStore()
@@ -152,6 +187,71 @@ func TestReadTile(t *testing.T) {
 	require.Len(t, data, expectedSize)
 }
 
+func TestAppendTile(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+	for i := range 300 {
+		require.NoError(t, AddRecord(ctx, store, int64(i), []byte(fmt.Sprintf("record %d\n", i))))
+	}
+
+	tiles := []tlog.Tile{
+		{H: TileHeight, L: 0, N: 0, W: 1 << TileHeight},
+		{H: TileHeight, L: 0, N: 1, W: 44},
+		{H: TileHeight, L: 1, N: 0, W: 1},
+		{H: 2, L: 1, N: 3, W: 4},
+	}
+	for _, tile := range tiles {
+		want, err := tlog.ReadTileData(tile, hashReaderFunc(func(indexes []int64) ([]tlog.Hash, error) {
+			return store.ReadHashes(ctx, indexes)
+		}))
+		require.NoError(t, err)
+
+		got, err := AppendTile(ctx, store, tile, []byte("prefix"))
+		require.NoError(t, err)
+		require.Equal(t, append([]byte("prefix"), want...), got, tile.Path())
+	}
+
+	_, err := AppendTile(ctx, store, tlog.Tile{H: TileHeight, L: -1, N: 0, W: 4}, nil)
+	require.Error(t, err)
+
+	// Reusing the buffer, only the store allocates.
+	buf := make([]byte, 0, tlog.HashSize<<TileHeight)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = AppendTile(ctx, store, tiles[0], buf[:0])
+	})
+	require.LessOrEqual(t, allocs, 1.0)
+}
+
+func BenchmarkAppendTile(b *testing.B) {
+	ctx := context.Background()
+	store := newMockStore()
+	for i := range 1 << TileHeight {
+		require.NoError(b, AddRecord(ctx, store, int64(i), []byte(fmt.Sprintf("record %d\n", i))))
+	}
+	tile := tlog.Tile{H: TileHeight, L: 0, N: 0, W: 1 << TileHeight}
+
+	b.Run("reused buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, tlog.HashSize<<TileHeight)
+		for b.Loop() {
+			var err error
+			if buf, err = AppendTile(ctx, store, tile, buf[:0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("tlog.ReadTileData", func(b *testing.B) {
+		b.ReportAllocs()
+		hr := hashReaderFunc(func(indexes []int64) ([]tlog.Hash, error) { return store.ReadHashes(ctx, indexes) })
+		for b.Loop() {
+			if _, err := tlog.ReadTileData(tile, hr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
 func TestAddRecord_IncrementalTreeHash(t *testing.T) {
 	ctx := context.Background()
 	store := newMockStore()
@@ -174,6 +274,131 @@ func TestAddRecord_IncrementalTreeHash(t *testing.T) {
 	}
 }
 
+func TestProveRecord(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+
+	for i := range 11 {
+		require.NoError(t, AddRecord(ctx, store, int64(i), []byte("record "+string(rune('0'+i))+"\n")))
+	}
+
+	root, err := TreeHash(ctx, store)
+	require.NoError(t, err)
+
+	for id := range int64(11) {
+		proof, err := ProveRecord(ctx, store, 11, id)
+		require.NoError(t, err)
+
+		leaf := tlog.RecordHash([]byte("record " + string(rune('0'+id)) + "\n"))
+		require.NoError(t, tlog.CheckRecord(proof, 11, root, id, leaf))
+	}
+
+	_, err = ProveRecord(ctx, store, 11, 11)
+	require.Error(t, err)
+}
+
+func TestProveTree(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+
+	roots := make([]tlog.Hash, 11)
+	for i := range 11 {
+		require.NoError(t, AddRecord(ctx, store, int64(i), []byte("record "+string(rune('0'+i))+"\n")))
+
+		var err error
+		roots[i], err = TreeHash(ctx, store)
+		require.NoError(t, err)
+	}
+
+	for n := int64(1); n <= 11; n++ {
+		proof, err := ProveTree(ctx, store, 11, n)
+		require.NoError(t, err)
+		require.NoError(t, tlog.CheckTree(proof, 11, roots[10], n, roots[n-1]))
+	}
+
+	_, err := ProveTree(ctx, store, 11, 12)
+	require.Error(t, err)
+}
+
+func TestRecordPath(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+
+	for i := range 11 {
+		require.NoError(t, AddRecord(ctx, store, int64(i), []byte("record "+string(rune('0'+i))+"\n")))
+	}
+
+	root, err := TreeHash(ctx, store)
+	require.NoError(t, err)
+
+	for id := range int64(11) {
+		path, err := RecordPath(ctx, store, 11, id)
+		require.NoError(t, err)
+		require.Equal(t, root, path[len(path)-1].Hash)
+
+		// The siblings are the record's inclusion proof.
+		proof, err := ProveRecord(ctx, store, 11, id)
+		require.NoError(t, err)
+		require.Len(t, path, len(proof))
+		for i, step := range path {
+			require.Equal(t, proof[i], step.Sibling)
+			require.True(t, step.Start <= id == step.Left, "step %d of record %d", i, id)
+			if i > 0 {
+				require.Greater(t, step.Level, path[i-1].Level)
+			}
+		}
+	}
+
+	// Record 10 is the last leaf: it's joined by the subtree over records 8-9 on its left, and the node over records
+	// 8-10 then joins the subtree over records 0-7 at the root.
+	path, err := RecordPath(ctx, store, 11, 10)
+	require.NoError(t, err)
+	require.Len(t, path, 2)
+	require.Equal(t, []int64{8, 10, 2}, []int64{path[0].Start, path[0].End, int64(path[0].Level)})
+	require.Equal(t, []int64{0, 8, 4}, []int64{path[1].Start, path[1].End, int64(path[1].Level)})
+	require.True(t, path[0].Left && path[1].Left)
+
+	_, err = RecordPath(ctx, store, 11, 11)
+	require.Error(t, err)
+
+	// A single record is the root itself.
+	path, err = RecordPath(ctx, store, 1, 0)
+	require.NoError(t, err)
+	require.Empty(t, path)
+}
+
+func TestMissingHashes(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+	for i := range 4 {
+		data := []byte("record " + string(rune('0'+i)) + "\n")
+		require.NoError(t, AddRecord(ctx, store, int64(i), data))
+	}
+
+	// Simulate a store that lost a leaf hash and reads it back as zeros.
+	store.hashes[tlog.StoredHashIndex(0, 2)] = tlog.Hash{}
+	_, err := ReadTile(ctx, store, tlog.Tile{H: TileHeight, L: 0, N: 0, W: 4})
+	require.ErrorIs(t, err, ErrMissingHash)
+
+	// And one that lost the subtree hash over records 0-3.
+	delete(store.hashes, tlog.StoredHashIndex(2, 0))
+	_, err = TreeHash(ctx, store)
+	require.ErrorIs(t, err, ErrMissingHash)
+
+	// Appending only fails once the missing subtree hash is needed, when completing the subtree over records 0-7.
+	for i := 4; i < 7; i++ {
+		require.NoError(t, AddRecord(ctx, store, int64(i), []byte("record "+string(rune('0'+i))+"\n")))
+	}
+	require.ErrorIs(t, AddRecord(ctx, store, 7, []byte("record 7\n")), ErrMissingHash)
+}
+
+// hashReaderFunc adapts a function to tlog.HashReader.
+type hashReaderFunc func([]int64) ([]tlog.Hash, error)
+
+func (f hashReaderFunc) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	return f(indexes)
+}
+
 func newMockStore() *mockStore {
 	return &mockStore{
 		hashes: make(map[int64]tlog.Hash),
@@ -0,0 +1,181 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// awsSigningAlgorithm is AWS KMS's pure Ed25519 signing algorithm, for keys with the ECC_NIST_EDWARDS25519 key spec.
+	awsSigningAlgorithm = "ED25519_SHA_512"
+
+	awsTimeFormat = "20060102T150405Z"
+)
+
+type (
+	// AWSCredentials are the credentials requests to AWS KMS are signed with. The zero value uses the credentials in
+	// the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+	AWSCredentials struct {
+		AccessKeyID     string
+		SecretAccessKey string
+		SessionToken    string
+	}
+
+	// awsKey is an Ed25519 key in AWS KMS.
+	awsKey struct {
+		arn      string
+		region   string
+		endpoint string
+		creds    AWSCredentials
+		client   HTTPClient
+		public   ed25519.PublicKey
+	}
+)
+
+// AWSKey returns the Ed25519 key in AWS KMS with the given ARN (a key or alias ARN, which names the key's region) as a
+// crypto.Signer, for NewSigner. The key must have the ECC_NIST_EDWARDS25519 key spec and SIGN_VERIFY usage, and the
+// credentials must allow kms:GetPublicKey and kms:Sign on it. Requests are sent with client, or an HTTP client with a
+// timeout if it's nil.
+func AWSKey(ctx context.Context, arn string, creds AWSCredentials, client HTTPClient) (crypto.Signer, error) {
+	// arn:aws:kms:<region>:<account>:key/<id>
+	fields := strings.SplitN(arn, ":", 6)
+	if len(fields) != 6 || fields[0] != "arn" || fields[2] != "kms" || fields[3] == "" {
+		return nil, fmt.Errorf("kms: invalid AWS KMS key ARN: %s", arn)
+	}
+
+	if creds == (AWSCredentials{}) {
+		creds = AWSCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("kms: no AWS credentials for %s", arn)
+	}
+
+	k := &awsKey{
+		arn:      arn,
+		region:   fields[3],
+		endpoint: "https://kms." + fields[3] + ".amazonaws.com/",
+		creds:    creds,
+		client:   defaultClient(client),
+	}
+
+	var out struct {
+		PublicKey []byte
+		KeySpec   string
+	}
+	if err := k.call(ctx, "GetPublicKey", map[string]any{"KeyId": arn}, &out); err != nil {
+		return nil, err
+	}
+
+	public, err := parsePublicKey(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s (%s)", err, arn, out.KeySpec)
+	}
+	k.public = public
+	return k, nil
+}
+
+// Public implements crypto.Signer.
+func (k *awsKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign implements crypto.Signer, signing msg, which isn't hashed, with the key.
+func (k *awsKey) Sign(_ io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := checkSignerOpts(opts); err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Signature []byte
+	}
+	in := map[string]any{
+		"KeyId":            k.arn,
+		"Message":          msg,
+		"MessageType":      "RAW",
+		"SigningAlgorithm": awsSigningAlgorithm,
+	}
+	if err := k.call(context.Background(), "Sign", in, &out); err != nil {
+		return nil, err
+	}
+	return out.Signature, nil
+}
+
+// call calls the AWS KMS operation op. Byte slices in in and out are base64 encoded, as the API expects.
+func (k *awsKey) call(ctx context.Context, op string, in, out any) error {
+	header := http.Header{
+		"Content-Type": {"application/x-amz-json-1.1"},
+		"X-Amz-Target": {"TrentService." + op},
+	}
+	return doJSON(ctx, k.client, http.MethodPost, k.endpoint, header, in, out, k.sign)
+}
+
+// sign authenticates req, whose body is body, with AWS Signature Version 4.
+func (k *awsKey) sign(req *http.Request, body []byte) {
+	now := time.Now().UTC()
+	date := now.Format(awsTimeFormat)
+	req.Header.Set("X-Amz-Date", date)
+	if k.creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", k.creds.SessionToken)
+	}
+
+	// Every header set above is signed, along with the host, in sorted order.
+	names := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	if k.creds.SessionToken != "" {
+		names = slices.Insert(names, 3, "x-amz-security-token")
+	}
+
+	var headers strings.Builder
+	for _, name := range names {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		fmt.Fprintf(&headers, "%s:%s\n", name, strings.TrimSpace(value))
+	}
+	signed := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, headers.String(), signed, hexSHA256(body),
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + k.region + "/kms/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hexSHA256([]byte(canonical))
+
+	key := []byte("AWS4" + k.creds.SecretAccessKey)
+	for _, part := range []string{now.Format("20060102"), k.region, "kms", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		k.creds.AccessKeyID, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
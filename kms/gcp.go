@@ -0,0 +1,83 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// gcpEndpoint is the base URL of the Cloud KMS API.
+const gcpEndpoint = "https://cloudkms.googleapis.com/v1/"
+
+// gcpKey is an Ed25519 key version in Google Cloud KMS.
+type gcpKey struct {
+	name   string
+	client HTTPClient
+	public ed25519.PublicKey
+}
+
+// GCPKey returns the Ed25519 key version in Google Cloud KMS with the given resource name (e.g.
+// projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1) as a crypto.Signer, for NewSigner. The key
+// must have the EC_SIGN_ED25519 algorithm.
+//
+// Requests are sent with client, which must authenticate them, e.g. an HTTP client from golang.org/x/oauth2/google's
+// DefaultClient with the https://www.googleapis.com/auth/cloudkms scope. Its credentials must allow
+// cloudkms.cryptoKeyVersions.viewPublicKey and cloudkms.cryptoKeyVersions.useToSign on the key.
+func GCPKey(ctx context.Context, name string, client HTTPClient) (crypto.Signer, error) {
+	if !strings.HasPrefix(name, "projects/") || !strings.Contains(name, "/cryptoKeyVersions/") {
+		return nil, fmt.Errorf("kms: invalid Cloud KMS key version name: %s", name)
+	}
+	if client == nil {
+		return nil, fmt.Errorf("kms: no HTTP client for %s", name)
+	}
+
+	k := &gcpKey{name: name, client: client}
+
+	var out struct {
+		PEM       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := doJSON(ctx, client, http.MethodGet, gcpEndpoint+name+"/publicKey", nil, nil, &out, nil); err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(out.PEM))
+	if block == nil {
+		return nil, fmt.Errorf("kms: invalid public key: %s, no PEM data", name)
+	}
+
+	public, err := parsePublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s (%s)", err, name, out.Algorithm)
+	}
+	k.public = public
+	return k, nil
+}
+
+// Public implements crypto.Signer.
+func (k *gcpKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign implements crypto.Signer, signing msg, which isn't hashed, with the key.
+func (k *gcpKey) Sign(_ io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := checkSignerOpts(opts); err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Signature []byte `json:"signature"`
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	in := map[string]any{"data": msg}
+	if err := doJSON(context.Background(), k.client, http.MethodPost, gcpEndpoint+k.name+":asymmetricSign", header, in,
+		&out, nil); err != nil {
+		return nil, err
+	}
+	return out.Signature, nil
+}
@@ -0,0 +1,191 @@
+// Package kms adapts Ed25519 keys held in key management services and hardware security modules to note.Signer, for
+// sumdb.WithSigner, so that a server's private key never has to be in its memory or configuration files.
+//
+// AWSKey and GCPKey use keys in AWS KMS and Google Cloud KMS through their HTTP APIs. Keys in PKCS#11 tokens, or any
+// other store, can be used through any library exposing them as a crypto.Signer:
+//
+//	key, err := kms.AWSKey(ctx, "arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+//		kms.AWSCredentials{}, nil)
+//	if err != nil { ... }
+//
+//	s, err := kms.NewSigner("sum.example.com", key)
+//	if err != nil { ... }
+//
+//	db, err := sumdb.New("sum.example.com", "", sumdb.WithSigner(s), sumdb.WithStore(store))
+//
+// Every signature is checked against the key's public key before it's used, so a misbehaving service can't make the
+// server publish tree heads clients would reject.
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+// requestTimeout bounds each request to a key management service. crypto.Signer has no context, so signatures are
+// requested with a background context and this timeout.
+const requestTimeout = 10 * time.Second
+
+// ErrInvalidSignature is returned by Signer.Sign when the key returns a signature that doesn't verify.
+var ErrInvalidSignature = errors.New("kms: invalid signature")
+
+type (
+	// HTTPClient defines an HTTP client for executing requests.
+	HTTPClient interface {
+		Do(*http.Request) (*http.Response, error)
+	}
+
+	// Signer is a note.Signer for an Ed25519 key held elsewhere, such as in a KMS or HSM.
+	Signer struct {
+		name   string
+		hash   uint32
+		vkey   string
+		public ed25519.PublicKey
+		key    crypto.Signer
+	}
+)
+
+// NewSigner returns a Signer signing notes as name with key, which must be an Ed25519 key. Notes are signed with pure
+// Ed25519 (no prehashing), as the go command expects.
+func NewSigner(name string, key crypto.Signer) (*Signer, error) {
+	public, ok := key.Public().(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("kms: unsupported key type: %T, want ed25519.PublicKey", key.Public())
+	}
+
+	vkey, err := note.NewEd25519VerifierKey(name, public)
+	if err != nil {
+		return nil, fmt.Errorf("kms: invalid key: %w", err)
+	}
+
+	v, err := note.NewVerifier(vkey)
+	if err != nil {
+		return nil, fmt.Errorf("kms: invalid key: %w", err)
+	}
+
+	return &Signer{name: name, hash: v.KeyHash(), vkey: vkey, public: public, key: key}, nil
+}
+
+// Name implements note.Signer.
+func (s *Signer) Name() string {
+	return s.name
+}
+
+// KeyHash implements note.Signer.
+func (s *Signer) KeyHash() uint32 {
+	return s.hash
+}
+
+// Sign implements note.Signer, returning an error wrapping ErrInvalidSignature if the key's signature doesn't verify.
+func (s *Signer) Sign(msg []byte) ([]byte, error) {
+	sig, err := s.key.Sign(rand.Reader, msg, crypto.Hash(0))
+	if err != nil {
+		return nil, fmt.Errorf("kms: failed to sign: %w", err)
+	}
+
+	if !ed25519.Verify(s.public, msg, sig) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, s.vkey)
+	}
+	return sig, nil
+}
+
+// VerifierKey returns the verifier key clients use to check the signer's signatures.
+func (s *Signer) VerifierKey() string {
+	return s.vkey
+}
+
+// parsePublicKey parses a DER-encoded PKIX Ed25519 public key, as returned by key management services.
+func parsePublicKey(der []byte) (ed25519.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("kms: invalid public key: %w", err)
+	}
+
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("kms: unsupported key type: %T, want ed25519.PublicKey", key)
+	}
+	return public, nil
+}
+
+// checkSignerOpts reports an error unless opts asks for a pure Ed25519 signature.
+func checkSignerOpts(opts crypto.SignerOpts) error {
+	if opts.HashFunc() != crypto.Hash(0) {
+		return fmt.Errorf("kms: unsupported hash: %s, Ed25519 keys sign messages", opts.HashFunc())
+	}
+	return nil
+}
+
+// doJSON sends a request to url with the given headers and in, if not nil, as its JSON body, decoding the response
+// into out. sign, if not nil, is called to authenticate the request once it's complete.
+func doJSON(
+	ctx context.Context,
+	client HTTPClient,
+	method, url string,
+	header http.Header,
+	in, out any,
+	sign func(*http.Request, []byte),
+) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("kms: failed to encode request: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("kms: failed to create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if sign != nil {
+		sign(req, body)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kms: request failed: %s, %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("kms: failed to read response: %s, %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(data[:min(len(data), 512)]))
+		return fmt.Errorf("kms: request failed: %s, %s: %s", url, resp.Status, msg)
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("kms: failed to decode response: %s, %w", url, err)
+	}
+	return nil
+}
+
+// defaultClient returns client, or an HTTP client with a timeout if it's nil.
+func defaultClient(client HTTPClient) HTTPClient {
+	if client == nil {
+		return &http.Client{Timeout: requestTimeout}
+	}
+	return client
+}
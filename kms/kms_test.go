@@ -0,0 +1,206 @@
+package kms_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb/kms"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// doFunc is an HTTPClient sending every request to the test server at its URL.
+type doFunc func(*http.Request) (*http.Response, error)
+
+func (f doFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// badKey is a crypto.Signer returning signatures by another key.
+type badKey struct {
+	ed25519.PrivateKey
+	other ed25519.PrivateKey
+}
+
+func (k badKey) Sign(r io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.other.Sign(r, msg, opts)
+}
+
+func TestNewSigner(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	s, err := NewSigner("sum.example.com", key)
+	require.NoError(t, err)
+	require.Equal(t, "sum.example.com", s.Name())
+	verifySigner(t, s)
+
+	t.Run("unsupported keys", func(t *testing.T) {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+
+		_, err = NewSigner("sum.example.com", ecKey)
+		require.ErrorContains(t, err, "unsupported key type")
+	})
+
+	t.Run("invalid signatures", func(t *testing.T) {
+		_, other, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		s, err := NewSigner("sum.example.com", badKey{PrivateKey: key, other: other})
+		require.NoError(t, err)
+
+		_, err = s.Sign([]byte("msg"))
+		require.ErrorIs(t, err, ErrInvalidSignature)
+	})
+}
+
+func TestAWSKey(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	arn := "arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	client := newFakeKMS(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/x-amz-json-1.1", r.Header.Get("Content-Type"))
+		require.Equal(t, "token", r.Header.Get("X-Amz-Security-Token"))
+		require.NotEmpty(t, r.Header.Get("X-Amz-Date"))
+
+		auth := r.Header.Get("Authorization")
+		require.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/"), auth)
+		require.Contains(t, auth, "/us-east-1/kms/aws4_request, ")
+		require.Contains(t, auth, "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, ")
+
+		var in struct {
+			KeyID            string `json:"KeyId"`
+			Message          []byte
+			MessageType      string
+			SigningAlgorithm string
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		require.Equal(t, arn, in.KeyID)
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			der, err := x509.MarshalPKIXPublicKey(key.Public())
+			require.NoError(t, err)
+			writeJSON(w, map[string]any{"KeyId": arn, "KeySpec": "ECC_NIST_EDWARDS25519", "PublicKey": der})
+		case "TrentService.Sign":
+			require.Equal(t, "RAW", in.MessageType)
+			require.Equal(t, "ED25519_SHA_512", in.SigningAlgorithm)
+			writeJSON(w, map[string]any{"Signature": ed25519.Sign(key, in.Message)})
+		default:
+			http.Error(w, `{"__type":"UnknownOperationException"}`, http.StatusBadRequest)
+		}
+	})
+
+	creds := AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token"}
+	k, err := AWSKey(t.Context(), arn, creds, client)
+	require.NoError(t, err)
+	require.Equal(t, key.Public(), k.Public())
+
+	s, err := NewSigner("sum.example.com", k)
+	require.NoError(t, err)
+	verifySigner(t, s)
+
+	t.Run("invalid ARNs", func(t *testing.T) {
+		_, err := AWSKey(t.Context(), "1234abcd-12ab-34cd-56ef-1234567890ab", creds, client)
+		require.ErrorContains(t, err, "invalid AWS KMS key ARN")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		client := newFakeKMS(t, func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, `{"__type":"AccessDeniedException"}`, http.StatusBadRequest)
+		})
+
+		_, err := AWSKey(t.Context(), arn, creds, client)
+		require.ErrorContains(t, err, "AccessDeniedException")
+	})
+}
+
+func TestGCPKey(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	name := "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+	client := newFakeKMS(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/"+name+"/publicKey":
+			der, err := x509.MarshalPKIXPublicKey(key.Public())
+			require.NoError(t, err)
+			block := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+			writeJSON(w, map[string]any{"pem": string(block), "algorithm": "EC_SIGN_ED25519"})
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/"+name+":asymmetricSign":
+			var in struct {
+				Data []byte `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+			writeJSON(w, map[string]any{"signature": ed25519.Sign(key, in.Data)})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	k, err := GCPKey(t.Context(), name, client)
+	require.NoError(t, err)
+
+	s, err := NewSigner("sum.example.com", k)
+	require.NoError(t, err)
+	verifySigner(t, s)
+
+	t.Run("invalid names", func(t *testing.T) {
+		_, err := GCPKey(t.Context(), "projects/p/locations/global/keyRings/r/cryptoKeys/k", client)
+		require.ErrorContains(t, err, "invalid Cloud KMS key version name")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := GCPKey(t.Context(), "projects/p/locations/global/keyRings/r/cryptoKeys/x/cryptoKeyVersions/1", client)
+		require.ErrorContains(t, err, "404 Not Found")
+	})
+}
+
+// newFakeKMS returns an HTTPClient sending every request to a test server calling handler.
+func newFakeKMS(t *testing.T, handler http.HandlerFunc) HTTPClient {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	return doFunc(func(req *http.Request) (*http.Response, error) {
+		req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+		return srv.Client().Do(req)
+	})
+}
+
+// verifySigner checks that notes signed by s verify with its verifier key.
+func verifySigner(t *testing.T, s *Signer) {
+	t.Helper()
+
+	signed, err := note.Sign(&note.Note{Text: "hello\n"}, s)
+	require.NoError(t, err)
+
+	v, err := note.NewVerifier(s.VerifierKey())
+	require.NoError(t, err)
+	n, err := note.Open(signed, note.VerifierList(v))
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", n.Text)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,68 @@
+package sumdb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+const (
+	// maxTileWidth is the most entries a tile holds, as required by the protocol. It's also the most records ReadRecords
+	// returns, since the protocol never needs more than a data tile's worth of them.
+	maxTileWidth = 1 << tree.TileHeight
+
+	// defaultMaxDataTileSize is the default size limit of served data tiles. Records are a couple hundred bytes, so a
+	// full tile is usually well under 100KB.
+	defaultMaxDataTileSize = 1 << 20
+
+	// DefaultMaxRecordSize is the default size limit of appended records' data, which lets full data tiles of the
+	// largest records fit in the default data tile size limit.
+	DefaultMaxRecordSize = defaultMaxDataTileSize / maxTileWidth
+)
+
+// ErrReadLimitExceeded is returned when a read exceeds the limits of the protocol or those configured with
+// WithReadLimits: tiles of a height other than 8 or wider than 256 entries, more records than allowed per ReadRecords
+// call, or data tiles larger than allowed.
+var ErrReadLimitExceeded = errors.New("read limit exceeded")
+
+// ErrRecordTooLarge is returned when appending a record whose data is larger than allowed by WithMaxRecordSize.
+var ErrRecordTooLarge = errors.New("record data too large")
+
+// checkTile checks that t can be served: it must have the protocol's height and width, and data tiles must not hold
+// more records than a single ReadRecords call may return.
+//
+// tlog.ParseTilePath accepts heights of up to 30, which would otherwise have the server read up to 2^30 hashes or
+// records for a single request.
+func (s *SumDB) checkTile(t tlog.Tile) error {
+	if t.H != tree.TileHeight {
+		return fmt.Errorf("%w: unsupported tile height: %d", ErrReadLimitExceeded, t.H)
+	}
+
+	if t.W < 1 || t.W > maxTileWidth {
+		return fmt.Errorf("%w: tile width %d, max %d", ErrReadLimitExceeded, t.W, maxTileWidth)
+	}
+
+	if t.L == -1 && int64(t.W) > s.maxReadRecords {
+		return fmt.Errorf("%w: data tile width %d, max %d", ErrReadLimitExceeded, t.W, s.maxReadRecords)
+	}
+
+	return nil
+}
+
+// checkRecordData checks that the data of rec can be appended: it must fit in the record size limit, and be valid
+// UTF-8 without control characters or blank lines, ending in a newline, so that it can be served in data tiles and
+// lookups to text-protocol clients. It returns an error wrapping ErrRecordTooLarge or ErrMalformedRecord otherwise.
+func (s *SumDB) checkRecordData(rec *Record) error {
+	if len(rec.Data) > s.maxRecordSize {
+		return fmt.Errorf("%w: %s@%s, %d bytes, max %d", ErrRecordTooLarge, rec.Path, rec.Version, len(rec.Data),
+			s.maxRecordSize)
+	}
+
+	if !isValidRecordData(rec.Data) {
+		return fmt.Errorf("%w: %s@%s, data must be lines of UTF-8 text without control characters",
+			ErrMalformedRecord, rec.Path, rec.Version)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package sumdb_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestReadLimits(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := newMemStore()
+	upstream := newFakeProxy(t)
+	db, err := New("test.example.com", skey, WithStore(store), WithUpstream(upstream.upstream(t)))
+	require.NoError(t, err)
+
+	for i := range 300 {
+		_, err := db.Lookup(t.Context(), module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"})
+		require.NoError(t, err)
+	}
+
+	get := func(h http.Handler, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	t.Run("data tiles", func(t *testing.T) {
+		// Data tiles are served as sumdb.Server would.
+		for _, path := range []string{"/tile/8/data/000", "/tile/8/data/001.p/44"} {
+			want := get(sumdb.NewServer(db), path)
+			require.Equal(t, http.StatusOK, want.Code, path)
+
+			rec := get(db.Handler(), path)
+			require.Equal(t, http.StatusOK, rec.Code, path)
+			require.Equal(t, "text/plain; charset=UTF-8", rec.Header().Get("Content-Type"))
+			require.Equal(t, want.Body.String(), rec.Body.String(), path)
+		}
+	})
+
+	t.Run("protocol limits", func(t *testing.T) {
+		_, err := db.ReadRecords(t.Context(), 0, 257)
+		require.ErrorIs(t, err, ErrReadLimitExceeded)
+
+		_, err = db.ReadTileData(t.Context(), tlog.Tile{H: 9, L: 0, N: 0, W: 1})
+		require.ErrorIs(t, err, ErrReadLimitExceeded)
+
+		for _, path := range []string{"/tile/4/0/000", "/tile/9/0/000.p/300", "/tile/30/data/000.p/100000"} {
+			rec := get(db.Handler(), path)
+			require.Equal(t, http.StatusBadRequest, rec.Code, path)
+			require.Contains(t, rec.Body.String(), "unsupported tile height", path)
+		}
+	})
+
+	t.Run("lowered limits", func(t *testing.T) {
+		db, err := New("test.example.com", skey, WithStore(store), WithReadLimits(16, 0))
+		require.NoError(t, err)
+
+		_, err = db.ReadRecords(t.Context(), 0, 17)
+		require.ErrorIs(t, err, ErrReadLimitExceeded)
+		recs, err := db.ReadRecords(t.Context(), 0, 16)
+		require.NoError(t, err)
+		require.Len(t, recs, 16)
+
+		require.Equal(t, http.StatusBadRequest, get(db.Handler(), "/tile/8/data/000").Code)
+		require.Equal(t, http.StatusOK, get(db.Handler(), "/tile/8/data/000.p/16").Code)
+
+		// Hash tiles aren't affected.
+		require.Equal(t, http.StatusOK, get(db.Handler(), "/tile/8/0/000").Code)
+
+		// Lookups only read a single record.
+		rec := get(db.Handler(), "/lookup/example.com/mod100@v1.0.0")
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("data tile size", func(t *testing.T) {
+		db, err := New("test.example.com", skey, WithStore(store), WithReadLimits(0, 1024))
+		require.NoError(t, err)
+
+		rec := get(db.Handler(), "/tile/8/data/000")
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Contains(t, rec.Body.String(), "exceeds 1024 bytes")
+
+		require.Equal(t, http.StatusOK, get(db.Handler(), "/tile/8/data/000.p/2").Code)
+	})
+
+	t.Run("limits can't be raised", func(t *testing.T) {
+		db, err := New("test.example.com", skey, WithStore(store), WithReadLimits(1000, 0))
+		require.NoError(t, err)
+
+		_, err = db.ReadRecords(t.Context(), 0, 257)
+		require.ErrorIs(t, err, ErrReadLimitExceeded)
+	})
+}
+
+func TestRecordLimits(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := newMemStore()
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(newFakeProxy(t).upstream(t)),
+		WithMaxRecordSize(200),
+	)
+	require.NoError(t, err)
+
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+	require.NoError(t, err)
+
+	long := module.Version{Path: "example.com/" + strings.Repeat("a", 100), Version: "v1.0.0"}
+	_, err = db.Lookup(t.Context(), long)
+	require.ErrorIs(t, err, ErrRecordTooLarge)
+
+	_, err = db.AddRecords(t.Context(), []module.Version{long})
+	require.ErrorIs(t, err, ErrRecordTooLarge)
+
+	tests := map[string]struct {
+		gosum string
+		err   error
+	}{
+		"too large": {
+			gosum: "example.com/b v1.0.0 h1:" + strings.Repeat("a", 200) + "\nexample.com/b v1.0.0/go.mod h1:b\n",
+			err:   ErrRecordTooLarge,
+		},
+		"invalid UTF-8": {
+			gosum: "example.com/b v1.0.0 h1:\xff\nexample.com/b v1.0.0/go.mod h1:b\n",
+			err:   ErrMalformedRecord,
+		},
+		"control characters": {
+			gosum: "example.com/b v1.0.0 h1:a\x1b[0m\nexample.com/b v1.0.0/go.mod h1:b\n",
+			err:   ErrMalformedRecord,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := db.ImportGoSum(t.Context(), strings.NewReader(tt.gosum))
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	size, err := store.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), size)
+}
+
+// readRecords reads the n records starting at id in tile-sized batches, since ReadRecords returns at most 256 records
+// per call.
+func readRecords(ctx context.Context, db *SumDB, id, n int64) ([][]byte, error) {
+	var recs [][]byte
+	for n > 0 {
+		batch := min(n, 256)
+		data, err := db.ReadRecords(ctx, id, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		recs = append(recs, data...)
+		id += batch
+		n -= batch
+	}
+	return recs, nil
+}
@@ -0,0 +1,42 @@
+package sumdb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pseudomuto/sumdb/alert"
+)
+
+// alertSourceLocker is the source of alerts about the lock set with WithLocker.
+const alertSourceLocker = "locker"
+
+// Locker is a lock shared by the SumDB instances appending to the same Store, such as the replicas of a deployment
+// behind a load balancer. See WithLocker.
+type Locker interface {
+	// Lock waits until the lock is acquired or ctx is done, and returns a function releasing it.
+	Lock(ctx context.Context) (unlock func() error, err error)
+}
+
+// lockAppends takes the lock set with WithLocker, if any, and returns a function releasing it. Appends are committed
+// by the time the lock is released, so failing to release it is raised as an alert rather than failing the append.
+func (s *SumDB) lockAppends(ctx context.Context) (func(), error) {
+	if s.locker == nil {
+		return func() {}, nil
+	}
+
+	unlock, err := s.locker.Lock(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take append lock: %w", err)
+	}
+
+	return func() {
+		if err := unlock(); err != nil {
+			s.raise(ctx, &alert.Alert{
+				Source:   alertSourceLocker,
+				Severity: alert.Warning,
+				Summary:  "failed to release the append lock",
+				Details:  map[string]string{"error": err.Error()},
+			})
+		}
+	}, nil
+}
@@ -0,0 +1,119 @@
+package sumdb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/alert"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestWithLocker(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	t.Run("serializes appends across instances", func(t *testing.T) {
+		// Replicas share a store and a lock, but deduplicate lookups separately.
+		store := memstore.New()
+		locker := &testLocker{}
+		upstream := newFakeProxy(t).upstream(t)
+
+		replicas := make([]*SumDB, 2)
+		for i := range replicas {
+			replicas[i], err = New("test.example.com", skey,
+				WithStore(store),
+				WithUpstream(upstream),
+				WithLocker(locker),
+			)
+			require.NoError(t, err)
+		}
+
+		var wg sync.WaitGroup
+		ids := make([][]int64, len(replicas))
+		errs := make([]error, len(replicas))
+		for i, db := range replicas {
+			ids[i] = make([]int64, 20)
+			wg.Go(func() {
+				for j := range ids[i] {
+					mod := module.Version{Path: fmt.Sprintf("example.com/mod%d", j), Version: "v1.0.0"}
+					if ids[i][j], errs[i] = db.Lookup(t.Context(), mod); errs[i] != nil {
+						return
+					}
+				}
+			})
+		}
+		wg.Wait()
+
+		require.NoError(t, errors.Join(errs...))
+		require.Equal(t, ids[0], ids[1])
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(20), size)
+		require.Positive(t, locker.locks)
+	})
+
+	t.Run("lock failures", func(t *testing.T) {
+		locker := &testLocker{err: errors.New("unavailable")}
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithLocker(locker),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+		require.ErrorContains(t, err, "failed to take append lock: unavailable")
+	})
+
+	t.Run("release failures are alerted", func(t *testing.T) {
+		alerts := make(chan *alert.Alert, 1)
+		locker := &testLocker{unlockErr: errors.New("lock lost")}
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithLocker(locker),
+			WithAlerter(alert.Func(func(_ context.Context, a *alert.Alert) error {
+				alerts <- a
+				return nil
+			})),
+		)
+		require.NoError(t, err)
+
+		// The record was appended, so the lookup succeeds.
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+		require.NoError(t, err)
+
+		a := <-alerts
+		require.Equal(t, "locker", a.Source)
+		require.Equal(t, alert.Warning, a.Severity)
+		require.Equal(t, "lock lost", a.Details["error"])
+	})
+}
+
+// testLocker is an in-process Locker standing in for one shared by servers.
+type testLocker struct {
+	mu        sync.Mutex
+	locks     int
+	err       error
+	unlockErr error
+}
+
+func (l *testLocker) Lock(context.Context) (func() error, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	l.mu.Lock()
+	l.locks++
+	return func() error {
+		l.mu.Unlock()
+		return l.unlockErr
+	}, nil
+}
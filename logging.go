@@ -0,0 +1,69 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// logFetch logs the failure of the fetch of mod through the route r, if it failed. Module versions the upstream
+// doesn't have are expected, and only logged at debug level.
+func (s *SumDB) logFetch(ctx context.Context, r *ingestRoute, mod module.Version, err error) {
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, ErrNotFound):
+		s.logger.LogAttrs(ctx, slog.LevelDebug, "module not found upstream",
+			slog.String("module", mod.Path), slog.String("version", mod.Version), slog.String("upstream", r.upstream))
+	default:
+		s.logger.LogAttrs(ctx, slog.LevelWarn, "upstream fetch failed",
+			slog.String("module", mod.Path), slog.String("version", mod.Version), slog.String("upstream", r.upstream),
+			slog.Any("error", err))
+	}
+}
+
+// logRecordAdded logs the record with the given id appended for mod by this server.
+func (s *SumDB) logRecordAdded(ctx context.Context, mod module.Version, id int64) {
+	s.logger.LogAttrs(ctx, slog.LevelInfo, "record added",
+		slog.String("module", mod.Path), slog.String("version", mod.Version), slog.Int64("id", id))
+}
+
+// logRecordsImported logs n records imported by this server, growing the tree to size.
+func (s *SumDB) logRecordsImported(ctx context.Context, n, size int64) {
+	s.logger.LogAttrs(ctx, slog.LevelInfo, "records imported", slog.Int64("count", n), slog.Int64("tree_size", size))
+}
+
+// logSigned logs the signing of a tree head for t, or the failure to sign it.
+func (s *SumDB) logSigned(ctx context.Context, t tlog.Tree, err error) {
+	if err != nil {
+		s.logger.LogAttrs(ctx, slog.LevelError, "failed to sign tree head",
+			slog.Int64("tree_size", t.N), slog.Any("error", err))
+		return
+	}
+
+	s.logger.LogAttrs(ctx, slog.LevelDebug, "signed tree head",
+		slog.Int64("tree_size", t.N), slog.String("root", t.Hash.String()), slog.Int("cosigners", len(s.cosigners)))
+}
+
+// logTreeSize logs the growth of the tree to size, whether by appends made by this server or by others sharing its
+// store. The size first observed is logged without a previous size.
+func (s *SumDB) logTreeSize(ctx context.Context, size int64) {
+	for {
+		prev := s.loggedTreeSize.Load()
+		if size <= prev {
+			return
+		}
+		if s.loggedTreeSize.CompareAndSwap(prev, size) {
+			if prev < 0 {
+				s.logger.LogAttrs(ctx, slog.LevelInfo, "tree size", slog.Int64("tree_size", size))
+			} else {
+				s.logger.LogAttrs(ctx, slog.LevelInfo, "tree size changed",
+					slog.Int64("tree_size", size), slog.Int64("previous_tree_size", prev))
+			}
+			return
+		}
+	}
+}
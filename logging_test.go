@@ -0,0 +1,112 @@
+package sumdb_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestLogging(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	// events returns the events logged to buf since it was last called, without their times.
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	events := func(t *testing.T) []map[string]any {
+		t.Helper()
+
+		var out []map[string]any
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var e map[string]any
+			require.NoError(t, dec.Decode(&e))
+			delete(e, "time")
+			out = append(out, e)
+		}
+		buf.Reset()
+		return out
+	}
+
+	t.Run("lookups", func(t *testing.T) {
+		upstream := newFakeProxy(t)
+		upstream.setMissing(module.Version{Path: "example.com/missing", Version: "v1.0.0"}, true)
+
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(upstream.upstream(t)),
+			WithLogger(logger),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/mod", Version: "v1.0.0"})
+		require.NoError(t, err)
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/missing", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrNotFound)
+		_, err = db.Signed(t.Context())
+		require.NoError(t, err)
+		_, err = db.SignNote("go.sum export", "example.com/mod v1.0.0 h1:abc=\n")
+		require.NoError(t, err)
+
+		got := events(t)
+		require.Len(t, got, 5)
+		require.Equal(t, map[string]any{
+			"level": "INFO", "msg": "record added", "module": "example.com/mod", "version": "v1.0.0", "id": float64(0),
+		}, got[0])
+		require.Equal(t, map[string]any{"level": "INFO", "msg": "tree size", "tree_size": float64(1)}, got[1])
+		require.Equal(t, map[string]any{
+			"level":    "DEBUG",
+			"msg":      "module not found upstream",
+			"module":   "example.com/missing",
+			"version":  "v1.0.0",
+			"upstream": upstream.URL,
+		}, got[2])
+		require.Equal(t, "signed tree head", got[3]["msg"])
+		require.Equal(t, float64(1), got[3]["tree_size"])
+		require.NotEmpty(t, got[3]["root"])
+		require.Equal(t, map[string]any{
+			"level": "DEBUG", "msg": "signed note", "context": "go.sum export", "cosigners": float64(0),
+		}, got[4])
+
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/mod", Version: "v1.1.0"})
+		require.NoError(t, err)
+		got = events(t)
+		require.Len(t, got, 2)
+		require.Equal(t, "record added", got[0]["msg"])
+		require.Equal(t, map[string]any{
+			"level": "INFO", "msg": "tree size changed", "tree_size": float64(2), "previous_tree_size": float64(1),
+		}, got[1])
+	})
+
+	t.Run("upstream failures", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(srv.Close)
+
+		u, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		db, err := New("test.example.com", skey, WithStore(newMemStore()), WithUpstream(u), WithLogger(logger))
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/mod", Version: "v1.0.0"})
+		require.Error(t, err)
+
+		got := events(t)
+		require.Len(t, got, 1)
+		require.Equal(t, "WARN", got[0]["level"])
+		require.Equal(t, "upstream fetch failed", got[0]["msg"])
+		require.Equal(t, "example.com/mod", got[0]["module"])
+		require.Equal(t, srv.URL, got[0]["upstream"])
+		require.Contains(t, got[0]["error"], "503")
+	})
+}
@@ -0,0 +1,342 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maintenanceCheckInterval is how often RunMaintenance checks for jobs that are due.
+	maintenanceCheckInterval = time.Minute
+
+	// negativeCacheJob is the name of the built-in job pruning expired entries from the negative cache.
+	negativeCacheJob = "negative-cache"
+
+	// negativeCachePruneInterval is how often the negative cache is pruned.
+	negativeCachePruneInterval = time.Hour
+)
+
+var (
+	// ErrInvalidMaintenanceWindow is returned by New when a window given to WithMaintenanceWindow isn't of the form
+	// "HH:MM-HH:MM".
+	ErrInvalidMaintenanceWindow = errors.New("invalid maintenance window")
+
+	// ErrInvalidMaintenanceJob is returned by New when a maintenance job has no name, interval or Run function, or
+	// when two jobs have the same name.
+	ErrInvalidMaintenanceJob = errors.New("invalid maintenance job")
+
+	// ErrUnknownMaintenanceJob is returned by RunMaintenanceJob for jobs that don't exist.
+	ErrUnknownMaintenanceJob = errors.New("unknown maintenance job")
+
+	// ErrMaintenanceJobRunning is returned by RunMaintenanceJob when the job is already running.
+	ErrMaintenanceJobRunning = errors.New("maintenance job already running")
+)
+
+type (
+	// MaintenanceJob is a housekeeping task, such as compacting a database, run periodically by RunMaintenance during
+	// the windows configured with WithMaintenanceWindow.
+	MaintenanceJob struct {
+		// Name identifies the job in the admin API and metrics, e.g. "sqlite-vacuum".
+		Name string
+
+		// Interval is the minimum time between runs.
+		Interval time.Duration
+
+		// Run performs the job. Its context is canceled when the maintenance window it started in ends.
+		Run func(ctx context.Context) error
+	}
+
+	// MaintenanceStore is an optional extension of Store for stores that need periodic maintenance, such as
+	// VACUUM or REINDEX. Its jobs are run by RunMaintenance along with any configured with WithMaintenanceJob.
+	MaintenanceStore interface {
+		Store
+
+		// MaintenanceJobs returns the store's maintenance jobs.
+		MaintenanceJobs() []MaintenanceJob
+	}
+
+	// MaintenanceStatus describes a maintenance job and its most recent run.
+	MaintenanceStatus struct {
+		Name     string
+		Interval time.Duration
+		Running  bool
+
+		// LastRun is when the job last started, LastDuration how long it took and LastError the error it failed with,
+		// if any. LastRun is zero if the job hasn't run since the server started.
+		LastRun      time.Time
+		LastDuration time.Duration
+		LastError    string
+	}
+
+	// maintenance schedules maintenance jobs within maintenance windows.
+	maintenance struct {
+		windows []maintenanceWindow
+
+		mu   sync.Mutex
+		jobs []*maintenanceJob
+	}
+
+	// maintenanceJob is a job along with the state of its most recent run. Its fields are guarded by maintenance.mu.
+	maintenanceJob struct {
+		MaintenanceJob
+		running      bool
+		lastRun      time.Time
+		lastDuration time.Duration
+		lastErr      error
+	}
+
+	// maintenanceWindow is a daily window, given as offsets from midnight UTC. Windows with an end before their start
+	// span midnight.
+	maintenanceWindow struct {
+		start, end time.Duration
+	}
+)
+
+// newMaintenance creates the scheduler for the store's jobs, the built-in jobs and the jobs configured with
+// WithMaintenanceJob.
+func (s *SumDB) newMaintenance() (*maintenance, error) {
+	m := &maintenance{}
+	for _, w := range s.maintenanceWindows {
+		window, err := parseMaintenanceWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		m.windows = append(m.windows, window)
+	}
+
+	var jobs []MaintenanceJob
+	if ms, ok := s.store.(MaintenanceStore); ok {
+		jobs = append(jobs, ms.MaintenanceJobs()...)
+	}
+	if s.notFound.ttl > 0 || s.notFound.pendingTTL > 0 {
+		jobs = append(jobs, MaintenanceJob{
+			Name:     negativeCacheJob,
+			Interval: negativeCachePruneInterval,
+			Run: func(context.Context) error {
+				s.notFound.prune(s.clock.Now())
+				return nil
+			},
+		})
+	}
+	if s.recheckSampleSize > 0 && s.recheckInterval > 0 {
+		jobs = append(jobs, MaintenanceJob{
+			Name:     recheckJob,
+			Interval: s.recheckInterval,
+			Run:      func(ctx context.Context) error { return s.recheckSample(ctx, s.recheckSampleSize) },
+		})
+	}
+	jobs = append(jobs, s.maintenanceJobs...)
+
+	names := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		switch {
+		case job.Name == "" || job.Interval <= 0 || job.Run == nil:
+			return nil, fmt.Errorf("%w: %q", ErrInvalidMaintenanceJob, job.Name)
+		case names[job.Name]:
+			return nil, fmt.Errorf("%w: duplicate name %q", ErrInvalidMaintenanceJob, job.Name)
+		}
+		names[job.Name] = true
+		m.jobs = append(m.jobs, &maintenanceJob{MaintenanceJob: job})
+	}
+	return m, nil
+}
+
+// parseMaintenanceWindow parses a window of the form "HH:MM-HH:MM".
+func parseMaintenanceWindow(w string) (maintenanceWindow, error) {
+	from, to, ok := strings.Cut(w, "-")
+	start, err1 := time.Parse("15:04", strings.TrimSpace(from))
+	end, err2 := time.Parse("15:04", strings.TrimSpace(to))
+	if !ok || err1 != nil || err2 != nil || start.Equal(end) {
+		return maintenanceWindow{}, fmt.Errorf("%w: %q, want HH:MM-HH:MM", ErrInvalidMaintenanceWindow, w)
+	}
+
+	return maintenanceWindow{start: sinceMidnight(start), end: sinceMidnight(end)}, nil
+}
+
+// sinceMidnight returns the time of day of t.
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// contains reports whether the window contains now, and when it ends if so.
+func (w maintenanceWindow) contains(now time.Time) (time.Time, bool) {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	offset := now.Sub(midnight)
+
+	switch {
+	case w.start < w.end && offset >= w.start && offset < w.end:
+		return midnight.Add(w.end), true
+	case w.start > w.end && offset >= w.start:
+		return midnight.Add(24*time.Hour + w.end), true
+	case w.start > w.end && offset < w.end:
+		return midnight.Add(w.end), true
+	}
+	return time.Time{}, false
+}
+
+// windowEnd reports whether now is within a maintenance window, and when that window ends. Without windows,
+// maintenance may run at any time and the returned end is zero.
+func (m *maintenance) windowEnd(now time.Time) (time.Time, bool) {
+	if len(m.windows) == 0 {
+		return time.Time{}, true
+	}
+
+	for _, w := range m.windows {
+		if end, ok := w.contains(now); ok {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// RunMaintenance runs the maintenance jobs of the store (see MaintenanceStore), the built-in jobs (pruning the
+// negative cache) and the jobs configured with WithMaintenanceJob until ctx is done. Jobs run one at a time, each at
+// most once per its interval, and only within the windows configured with WithMaintenanceWindow (at any time if there
+// are none). A job still running when its window ends has its context canceled.
+//
+// Only one RunMaintenance should be running per store. It returns ctx.Err() once ctx is done.
+func (s *SumDB) RunMaintenance(ctx context.Context) error {
+	for {
+		s.runDueMaintenance(ctx)
+
+		if !sleep(ctx, s.clock, maintenanceCheckInterval) {
+			return ctx.Err()
+		}
+	}
+}
+
+// runDueMaintenance runs the jobs that are due, while the current maintenance window lasts.
+func (s *SumDB) runDueMaintenance(ctx context.Context) {
+	for _, job := range s.maintenance.jobs {
+		now := s.clock.Now()
+		end, ok := s.maintenance.windowEnd(now)
+		if !ok || ctx.Err() != nil {
+			return
+		}
+
+		s.maintenance.mu.Lock()
+		due := !job.running && (job.lastRun.IsZero() || now.Sub(job.lastRun) >= job.Interval)
+		s.maintenance.mu.Unlock()
+		if !due {
+			continue
+		}
+
+		jobCtx, cancel := ctx, context.CancelFunc(func() {})
+		if !end.IsZero() {
+			jobCtx, cancel = context.WithDeadline(ctx, end)
+		}
+		_ = s.runMaintenanceJob(jobCtx, job)
+		cancel()
+	}
+}
+
+// RunMaintenanceJob runs the named maintenance job now, regardless of maintenance windows and when it last ran. It
+// returns ErrUnknownMaintenanceJob if there's no such job and ErrMaintenanceJobRunning if it's already running.
+func (s *SumDB) RunMaintenanceJob(ctx context.Context, name string) error {
+	for _, job := range s.maintenance.jobs {
+		if job.Name == name {
+			return s.runMaintenanceJob(ctx, job)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownMaintenanceJob, name)
+}
+
+// runMaintenanceJob runs job, recording its outcome.
+func (s *SumDB) runMaintenanceJob(ctx context.Context, job *maintenanceJob) error {
+	m := s.maintenance
+	m.mu.Lock()
+	if job.running {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrMaintenanceJobRunning, job.Name)
+	}
+	job.running = true
+	m.mu.Unlock()
+
+	start := s.clock.Now()
+	err := job.Run(ctx)
+	if err != nil {
+		err = fmt.Errorf("maintenance job failed: %s, %w", job.Name, err)
+	}
+	duration := s.clock.Now().Sub(start)
+	s.observeMaintenance(job.Name, duration, err)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.running = false
+	job.lastRun, job.lastDuration, job.lastErr = start, duration, err
+	return err
+}
+
+// MaintenanceStatus returns the status of every maintenance job.
+func (s *SumDB) MaintenanceStatus() []MaintenanceStatus {
+	s.maintenance.mu.Lock()
+	defer s.maintenance.mu.Unlock()
+
+	status := make([]MaintenanceStatus, len(s.maintenance.jobs))
+	for i, job := range s.maintenance.jobs {
+		status[i] = MaintenanceStatus{
+			Name:         job.Name,
+			Interval:     job.Interval,
+			Running:      job.running,
+			LastRun:      job.lastRun,
+			LastDuration: job.lastDuration,
+		}
+		if job.lastErr != nil {
+			status[i].LastError = job.lastErr.Error()
+		}
+	}
+	return status
+}
+
+// serveMaintenance serves GET /maintenance requests, returning the configured windows and the status of every job.
+func (s *SumDB) serveMaintenance(w http.ResponseWriter, _ *http.Request) {
+	type job struct {
+		Name         string     `json:"name"`
+		Interval     string     `json:"interval"`
+		Running      bool       `json:"running"`
+		LastRun      *time.Time `json:"last_run,omitempty"`
+		LastDuration string     `json:"last_duration,omitempty"`
+		LastError    string     `json:"last_error,omitempty"`
+	}
+
+	out := struct {
+		Windows []string `json:"windows"`
+		Jobs    []job    `json:"jobs"`
+	}{Windows: append([]string{}, s.maintenanceWindows...), Jobs: []job{}}
+
+	for _, st := range s.MaintenanceStatus() {
+		j := job{Name: st.Name, Interval: st.Interval.String(), Running: st.Running, LastError: st.LastError}
+		if !st.LastRun.IsZero() {
+			j.LastRun = &st.LastRun
+			j.LastDuration = st.LastDuration.String()
+		}
+		out.Jobs = append(out.Jobs, j)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// serveRunMaintenanceJob serves POST /maintenance/{job} requests, running the job now. The response is sent once the
+// job is done, and the job is canceled if the client goes away.
+func (s *SumDB) serveRunMaintenanceJob(w http.ResponseWriter, r *http.Request) {
+	if !s.auditRequest(w, r, "") {
+		return
+	}
+
+	err := s.RunMaintenanceJob(r.Context(), r.PathValue("job"))
+	switch {
+	case errors.Is(err, ErrUnknownMaintenanceJob):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrMaintenanceJobRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,221 @@
+package sumdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenance(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	// A store whose maintenance job counts its runs.
+	var storeRuns atomic.Int32
+	store := &maintenanceStore{Store: newMemStore(), jobs: []MaintenanceJob{{
+		Name:     "store-compact",
+		Interval: time.Hour,
+		Run: func(context.Context) error {
+			storeRuns.Add(1)
+			return nil
+		},
+	}}}
+
+	failing := MaintenanceJob{
+		Name:     "failing",
+		Interval: time.Hour,
+		Run:      func(context.Context) error { return errors.New("boom") },
+	}
+
+	newDB := func(t *testing.T, now time.Time, opts ...Option) *SumDB {
+		t.Helper()
+
+		opts = append([]Option{
+			WithStore(store),
+			WithClock(ClockFunc(func() time.Time { return now })),
+			WithMaintenanceJob(failing),
+		}, opts...)
+		db, err := New("test.example.com", skey, opts...)
+		require.NoError(t, err)
+		return db
+	}
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		for _, window := range []string{"02:00", "2am-4am", "02:00-02:00", "25:00-01:00"} {
+			_, err := New("test.example.com", skey, WithMaintenanceWindow(window))
+			require.ErrorIs(t, err, ErrInvalidMaintenanceWindow, window)
+		}
+
+		_, err := New("test.example.com", skey, WithMaintenanceJob(MaintenanceJob{Name: "no-run", Interval: time.Hour}))
+		require.ErrorIs(t, err, ErrInvalidMaintenanceJob)
+
+		_, err = New("test.example.com", skey, WithStore(store),
+			WithMaintenanceJob(MaintenanceJob{Name: "store-compact", Interval: time.Hour, Run: failing.Run}))
+		require.ErrorIs(t, err, ErrInvalidMaintenanceJob)
+	})
+
+	t.Run("run job", func(t *testing.T) {
+		db := newDB(t, time.Now(), WithNegativeCache(10, time.Hour, time.Minute))
+		before := storeRuns.Load()
+
+		require.NoError(t, db.RunMaintenanceJob(t.Context(), "store-compact"))
+		require.Equal(t, before+1, storeRuns.Load())
+		require.NoError(t, db.RunMaintenanceJob(t.Context(), "negative-cache"))
+
+		require.ErrorContains(t, db.RunMaintenanceJob(t.Context(), "failing"), "boom")
+		require.ErrorIs(t, db.RunMaintenanceJob(t.Context(), "missing"), ErrUnknownMaintenanceJob)
+
+		status := db.MaintenanceStatus()
+		require.Len(t, status, 3)
+		require.Equal(t, "store-compact", status[0].Name)
+		require.False(t, status[0].LastRun.IsZero())
+		require.Empty(t, status[0].LastError)
+		require.Equal(t, "negative-cache", status[1].Name)
+		require.Equal(t, "failing", status[2].Name)
+		require.Contains(t, status[2].LastError, "boom")
+
+		rec := httptest.NewRecorder()
+		db.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Contains(t, rec.Body.String(), `sumdb_maintenance_runs_total{job="failing",result="failed"} 1`)
+		require.Contains(t, rec.Body.String(), `sumdb_maintenance_runs_total{job="store-compact",result="succeeded"} 1`)
+	})
+
+	t.Run("waits with the clock", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		// Jobs are checked every minute, so the job only runs twice in time if RunMaintenance waits with the clock.
+		clock := &sleepingClock{now: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+		clock.onSleep = func(n int) {
+			if n == 4 {
+				cancel()
+			}
+		}
+
+		var runs atomic.Int32
+		db, err := New("test.example.com", skey, WithStore(newMemStore()), WithClock(clock),
+			WithMaintenanceJob(MaintenanceJob{
+				Name:     "count",
+				Interval: 2 * time.Minute,
+				Run: func(context.Context) error {
+					runs.Add(1)
+					return nil
+				},
+			}))
+		require.NoError(t, err)
+
+		require.ErrorIs(t, db.RunMaintenance(ctx), context.Canceled)
+		require.Equal(t, int32(2), runs.Load())
+		require.Len(t, clock.slept, 4)
+	})
+
+	t.Run("windows", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			now    string
+			window string
+			runs   bool
+		}{
+			{name: "inside", now: "03:00", window: "02:00-04:00", runs: true},
+			{name: "before", now: "01:59", window: "02:00-04:00"},
+			{name: "at end", now: "04:00", window: "02:00-04:00"},
+			{name: "spanning midnight, before", now: "23:30", window: "23:00-01:00", runs: true},
+			{name: "spanning midnight, after", now: "00:30", window: "23:00-01:00", runs: true},
+			{name: "spanning midnight, outside", now: "12:00", window: "23:00-01:00"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				at, err := time.Parse(time.DateTime, "2026-03-10 "+tt.now+":00")
+				require.NoError(t, err)
+
+				ran := make(chan time.Time, 1)
+				db := newDB(t, at, WithMaintenanceWindow(tt.window), WithMaintenanceJob(MaintenanceJob{
+					Name:     "probe",
+					Interval: time.Hour,
+					Run: func(ctx context.Context) error {
+						deadline, _ := ctx.Deadline()
+						ran <- deadline
+						return nil
+					},
+				}))
+
+				ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+				defer cancel()
+				require.ErrorIs(t, db.RunMaintenance(ctx), context.DeadlineExceeded)
+
+				if !tt.runs {
+					require.Empty(t, ran)
+					return
+				}
+
+				// Jobs are canceled when their window ends.
+				deadline := <-ran
+				_, end, _ := strings.Cut(tt.window, "-")
+				require.Equal(t, end, deadline.UTC().Format("15:04"))
+				require.True(t, deadline.After(at))
+			})
+		}
+	})
+
+	t.Run("admin API", func(t *testing.T) {
+		db := newDB(t, time.Now(), WithMaintenanceWindow("02:00-04:00"),
+			WithAdminIdentity(IdentityFunc(func(r *http.Request) (Identity, error) {
+				if r.Header.Get("Authorization") == "Bearer operator" {
+					return Identity{Subject: "bob", Role: RoleOperator}, nil
+				}
+				return Identity{Subject: "alice", Role: RoleViewer}, nil
+			})),
+		)
+
+		do := func(method, path, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			db.AdminHandler().ServeHTTP(rec, req)
+			return rec
+		}
+
+		require.Equal(t, http.StatusForbidden, do(http.MethodPost, "/maintenance/store-compact", "viewer").Code)
+		require.Equal(t, http.StatusNoContent, do(http.MethodPost, "/maintenance/store-compact", "operator").Code)
+		require.Equal(t, http.StatusNotFound, do(http.MethodPost, "/maintenance/missing", "operator").Code)
+		require.Equal(t, http.StatusInternalServerError, do(http.MethodPost, "/maintenance/failing", "operator").Code)
+
+		rec := do(http.MethodGet, "/maintenance", "viewer")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var got struct {
+			Windows []string `json:"windows"`
+			Jobs    []struct {
+				Name      string `json:"name"`
+				Interval  string `json:"interval"`
+				LastRun   string `json:"last_run"`
+				LastError string `json:"last_error"`
+			} `json:"jobs"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+		require.Equal(t, []string{"02:00-04:00"}, got.Windows)
+		require.Len(t, got.Jobs, 2)
+		require.Equal(t, "store-compact", got.Jobs[0].Name)
+		require.Equal(t, "1h0m0s", got.Jobs[0].Interval)
+		require.NotEmpty(t, got.Jobs[0].LastRun)
+		require.Contains(t, got.Jobs[1].LastError, "boom")
+	})
+}
+
+// maintenanceStore is a Store with maintenance jobs.
+type maintenanceStore struct {
+	Store
+	jobs []MaintenanceJob
+}
+
+func (s *maintenanceStore) MaintenanceJobs() []MaintenanceJob { return s.jobs }
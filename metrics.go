@@ -0,0 +1,241 @@
+package sumdb
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/metrics"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// Lookup outcomes, used as the outcome label of sumdb_lookups_total.
+const (
+	outcomeFound    = "found"
+	outcomeNotFound = "not_found"
+	outcomeDenied   = "denied"
+	outcomeError    = "error"
+)
+
+// Cache results, used as the result label of sumdb_lookup_cache_requests_total and sumdb_tile_cache_requests_total.
+const (
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+// Upstream fetch results, used as the result label of sumdb_upstream_fetch_duration_seconds.
+const (
+	fetchSucceeded = "succeeded"
+	fetchNotFound  = "not_found"
+	fetchFailed    = "failed"
+)
+
+// serverMetrics are the metrics collected by a SumDB.
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	lookups             *metrics.CounterVec
+	warmLookups         *metrics.HistogramVec
+	coldLookups         *metrics.HistogramVec
+	lookupCacheRequests *metrics.CounterVec
+	upstreamFetches     *metrics.HistogramVec
+	alerts              *metrics.CounterVec
+
+	appended  *metrics.CounterVec
+	treeSize  *metrics.GaugeVec
+	tileReads *metrics.HistogramVec
+
+	maintenanceRuns     *metrics.CounterVec
+	maintenanceDuration *metrics.HistogramVec
+
+	rechecks        *metrics.CounterVec
+	rechecked       *metrics.GaugeVec
+	recheckCoverage *metrics.GaugeVec
+
+	recordFilterChecks *metrics.CounterVec
+	recordFilterRate   *metrics.GaugeVec
+
+	tileCacheRequests *metrics.CounterVec
+	tileCacheBytes    *metrics.GaugeVec
+
+	requests *metrics.HistogramVec
+}
+
+func newServerMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	return &serverMetrics{
+		registry: r,
+		lookups: r.Counter("sumdb_lookups_total",
+			"Lookups by temperature (warm if the record existed, cold if it was fetched upstream) and outcome.",
+			"temperature", "outcome"),
+		warmLookups: r.Histogram("sumdb_warm_lookup_duration_seconds",
+			"Latency of lookups for existing records.", metrics.DefBuckets, "outcome"),
+		coldLookups: r.Histogram("sumdb_cold_lookup_duration_seconds",
+			"Latency of lookups that fetched the module upstream.", metrics.DefBuckets, "outcome"),
+		lookupCacheRequests: r.Counter("sumdb_lookup_cache_requests_total",
+			"Lookups by lookup cache result (hit or miss).", "result"),
+		upstreamFetches: r.Histogram("sumdb_upstream_fetch_duration_seconds",
+			"Latency of upstream fetches by result (succeeded, not_found or failed).", metrics.DefBuckets, "result"),
+		appended: r.Counter("sumdb_records_appended_total",
+			"Records appended to the log by this server."),
+		treeSize: r.Gauge("sumdb_tree_size",
+			"Number of records in the log, as last seen by this server."),
+		tileReads: r.Histogram("sumdb_tile_read_duration_seconds",
+			"Latency of reading tiles from the store by type (hash or data).", metrics.DefBuckets, "type"),
+		alerts: r.Counter("sumdb_alerts_total",
+			"Alerts delivered to each alerter by source, and whether they were sent or failed.", "source", "result"),
+		maintenanceRuns: r.Counter("sumdb_maintenance_runs_total",
+			"Maintenance job runs by job, and whether they succeeded or failed.", "job", "result"),
+		maintenanceDuration: r.Histogram("sumdb_maintenance_duration_seconds",
+			"Duration of maintenance job runs.", metrics.DefBuckets, "job"),
+		rechecks: r.Counter("sumdb_rechecks_total",
+			"Records rechecked against their upstream by result (match, mismatch or unavailable).", "result"),
+		rechecked: r.Gauge("sumdb_rechecked_records",
+			"Distinct records rechecked since the server started."),
+		recheckCoverage: r.Gauge("sumdb_recheck_coverage_ratio",
+			"Share of the log rechecked since the server started."),
+		recordFilterChecks: r.Counter("sumdb_record_filter_checks_total",
+			"Lookups checked against the record filter by result (absent, present or false_positive).", "result"),
+		recordFilterRate: r.Gauge("sumdb_record_filter_false_positive_ratio",
+			"Estimated false positive rate of the record filter."),
+		tileCacheRequests: r.Counter("sumdb_tile_cache_requests_total",
+			"Tile requests by tile cache result (hit or miss).", "result"),
+		tileCacheBytes: r.Gauge("sumdb_tile_cache_bytes",
+			"Total size of the tiles in the tile cache."),
+		requests: r.Histogram("sumdb_request_duration_seconds",
+			"Latency of requests served by Handler by endpoint and status code.", metrics.DefBuckets, "endpoint", "code"),
+	}
+}
+
+// MetricsHandler returns an HTTP handler serving the server's metrics in the Prometheus text format, for mounting at
+// e.g. /metrics:
+//
+//	sumdb_lookups_total{temperature, outcome}         lookups by temperature ("warm" or "cold") and outcome
+//	sumdb_warm_lookup_duration_seconds{outcome}       latency of lookups for existing records
+//	sumdb_cold_lookup_duration_seconds{outcome}       latency of lookups that fetched the module upstream
+//	sumdb_lookup_cache_requests_total{result}         lookups by lookup cache result ("hit" or "miss")
+//	sumdb_upstream_fetch_duration_seconds{result}     latency of upstream fetches by result
+//	sumdb_records_appended_total                      records appended to the log by this server
+//	sumdb_tree_size                                   number of records in the log, as last seen by this server
+//	sumdb_tile_read_duration_seconds{type}            latency of reading tiles from the store ("hash" or "data")
+//	sumdb_alerts_total{source, result}                alert deliveries by source and result ("sent" or "failed")
+//	sumdb_maintenance_runs_total{job, result}         maintenance job runs by result ("succeeded" or "failed")
+//	sumdb_maintenance_duration_seconds{job}           duration of maintenance job runs
+//	sumdb_rechecks_total{result}                      rechecked records by result (see Recheck)
+//	sumdb_rechecked_records                           distinct records rechecked since the server started
+//	sumdb_recheck_coverage_ratio                      share of the log rechecked since the server started
+//	sumdb_record_filter_checks_total{result}          lookups checked against the record filter by result
+//	sumdb_record_filter_false_positive_ratio          estimated false positive rate of the record filter
+//	sumdb_tile_cache_requests_total{result}           tile requests by tile cache result ("hit" or "miss")
+//	sumdb_tile_cache_bytes                            total size of the tiles in the tile cache
+//	sumdb_request_duration_seconds{endpoint, code}    latency of requests served by Handler (see WithRequestMetrics)
+//
+// Outcomes are "found", "not_found", "denied" (by policy) and "error". Keeping warm and cold lookups in separate
+// histograms lets SLOs be defined on warm lookups without noise from upstream fetches, whose results are "succeeded",
+// "not_found" and "failed". Appends are best watched with rate(sumdb_records_appended_total), and tile reads exclude
+// tiles served from the tile cache. Record filter results (see
+// WithRecordFilter) are "absent" (the store wasn't queried), "present" (the record existed) and "false_positive".
+func (s *SumDB) MetricsHandler() http.Handler {
+	return s.metrics.registry
+}
+
+// observeLookup records a lookup that started at start.
+func (s *SumDB) observeLookup(cold bool, start time.Time, err error) {
+	outcome := outcomeFound
+	switch {
+	case errors.Is(err, ErrNotFound):
+		outcome = outcomeNotFound
+	case errors.Is(err, ErrPolicyDenied):
+		outcome = outcomeDenied
+	case err != nil:
+		outcome = outcomeError
+	}
+
+	temperature, latency := "warm", s.metrics.warmLookups
+	if cold {
+		temperature, latency = "cold", s.metrics.coldLookups
+	}
+
+	s.metrics.lookups.With(temperature, outcome).Inc()
+	latency.With(outcome).Observe(s.clock.Now().Sub(start).Seconds())
+}
+
+// observeMaintenance records a maintenance job run that took d.
+func (s *SumDB) observeMaintenance(job string, d time.Duration, err error) {
+	result := "succeeded"
+	if err != nil {
+		result = "failed"
+	}
+
+	s.metrics.maintenanceRuns.With(job, result).Inc()
+	s.metrics.maintenanceDuration.With(job).Observe(d.Seconds())
+}
+
+// observeRecheck records a recheck of the record with the given ID, in a tree of the given size.
+func (s *SumDB) observeRecheck(id, size int64, result RecheckResult) {
+	n := s.rechecked.add(id)
+
+	s.metrics.rechecks.With(string(result)).Inc()
+	s.metrics.rechecked.With().Set(float64(n))
+	s.metrics.recheckCoverage.With().Set(float64(n) / float64(size))
+}
+
+// observeRecordFilter records a lookup checked against the record filter, if it's loaded.
+func (s *SumDB) observeRecordFilter(result string) {
+	if s.recordFilter.isLoaded() {
+		s.metrics.recordFilterChecks.With(result).Inc()
+	}
+}
+
+// observeRecordFilterRate records the record filter's estimated false positive rate.
+func (s *SumDB) observeRecordFilterRate() {
+	s.metrics.recordFilterRate.With().Set(s.recordFilter.filter.FalsePositiveRate())
+}
+
+// observeTileCache records a tile request served from the tile cache, or not, if there is one.
+func (s *SumDB) observeTileCache(result string) {
+	if s.tileCache != nil {
+		s.metrics.tileCacheRequests.With(result).Inc()
+		s.metrics.tileCacheBytes.With().Set(float64(s.tileCache.size()))
+	}
+}
+
+// observeLookupCache records a lookup served from the lookup cache, or not, if there is one.
+func (s *SumDB) observeLookupCache(result string) {
+	if s.lookupCache.Size() > 0 {
+		s.metrics.lookupCacheRequests.With(result).Inc()
+	}
+}
+
+// observeFetch records an upstream fetch that started at start.
+func (s *SumDB) observeFetch(start time.Time, err error) {
+	result := fetchSucceeded
+	switch {
+	case errors.Is(err, ErrNotFound):
+		result = fetchNotFound
+	case err != nil:
+		result = fetchFailed
+	}
+
+	s.metrics.upstreamFetches.With(result).Observe(s.clock.Now().Sub(start).Seconds())
+}
+
+// observeAppend records n records appended by this server, growing the tree to size.
+func (s *SumDB) observeAppend(n, size int64) {
+	s.metrics.appended.With().Add(uint64(n)) // #nosec G115 -- never negative
+	s.observeTreeSize(size)
+}
+
+// observeTreeSize records the size of the tree.
+func (s *SumDB) observeTreeSize(size int64) {
+	s.metrics.treeSize.With().Set(float64(size))
+}
+
+// observeTileRead records reading the tile t from the store, which started at start.
+func (s *SumDB) observeTileRead(t tlog.Tile, start time.Time) {
+	kind := "hash"
+	if t.L == -1 {
+		kind = "data"
+	}
+	s.metrics.tileReads.With(kind).Observe(s.clock.Now().Sub(start).Seconds())
+}
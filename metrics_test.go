@@ -0,0 +1,66 @@
+package sumdb_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestLookupMetrics(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	upstream.setMissing(module.Version{Path: "example.com/missing", Version: "v1.0.0"}, true)
+
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(upstream.upstream(t)),
+		WithLookupCache(10),
+	)
+	require.NoError(t, err)
+
+	mod := module.Version{Path: "example.com/mod", Version: "v1.0.0"}
+	_, err = db.Lookup(t.Context(), mod)
+	require.NoError(t, err)
+	_, err = db.Lookup(t.Context(), mod)
+	require.NoError(t, err)
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/missing", Version: "v1.0.0"})
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Lookups served from the lookup cache are warm.
+	for range 2 {
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/mod@v1.0.0", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	for _, path := range []string{"/tile/8/0/000.p/1", "/tile/8/data/000.p/1"} {
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	db.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	require.Contains(t, body, `sumdb_lookups_total{temperature="cold",outcome="found"} 1`)
+	require.Contains(t, body, `sumdb_lookups_total{temperature="cold",outcome="not_found"} 1`)
+	require.Contains(t, body, `sumdb_lookups_total{temperature="warm",outcome="found"} 3`)
+	require.Contains(t, body, `sumdb_cold_lookup_duration_seconds_count{outcome="found"} 1`)
+	require.Contains(t, body, `sumdb_warm_lookup_duration_seconds_count{outcome="found"} 3`)
+	require.Contains(t, body, `sumdb_lookup_cache_requests_total{result="hit"} 1`)
+	require.Contains(t, body, `sumdb_lookup_cache_requests_total{result="miss"} 1`)
+	require.Contains(t, body, `sumdb_upstream_fetch_duration_seconds_count{result="succeeded"} 1`)
+	require.Contains(t, body, `sumdb_upstream_fetch_duration_seconds_count{result="not_found"} 1`)
+	require.Contains(t, body, "sumdb_records_appended_total 1\n")
+	require.Contains(t, body, "sumdb_tree_size 1\n")
+	require.Contains(t, body, `sumdb_tile_read_duration_seconds_count{type="hash"} 1`)
+	require.Contains(t, body, `sumdb_tile_read_duration_seconds_count{type="data"} 1`)
+}
@@ -0,0 +1,165 @@
+package sumdb
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Endpoints, used as the endpoint label of sumdb_request_duration_seconds.
+const (
+	endpointLookup = "lookup"
+	endpointLatest = "latest"
+	endpointTile   = "tile"
+	endpointOther  = "other"
+)
+
+type (
+	// HandlerOption configures the middleware Handler wraps the server in.
+	HandlerOption func(*handlerOptions)
+
+	// handlerOptions are the middleware enabled with HandlerOptions.
+	handlerOptions struct {
+		accessLog    bool
+		accessLogger *slog.Logger // the logger set with WithLogger if nil
+		recover      bool
+		metrics      bool
+	}
+
+	// responseRecorder is an http.ResponseWriter recording the status and size of the response written through it.
+	responseRecorder struct {
+		http.ResponseWriter
+		status int
+		size   int64
+	}
+)
+
+// WithAccessLog logs every request at info level to logger, or to the logger set with WithLogger if it's nil, with
+// its method, path, status, response size, duration and remote address.
+func WithAccessLog(logger *slog.Logger) HandlerOption {
+	return func(o *handlerOptions) {
+		o.accessLog = true
+		o.accessLogger = logger
+	}
+}
+
+// WithPanicRecovery recovers panics raised while serving requests, logging them with their stack trace to the logger
+// set with WithLogger and answering with 500 Internal Server Error (if nothing was written yet), rather than letting
+// net/http drop the connection. http.ErrAbortHandler is left to net/http.
+func WithPanicRecovery() HandlerOption {
+	return func(o *handlerOptions) {
+		o.recover = true
+	}
+}
+
+// WithRequestMetrics records the latency of every request in sumdb_request_duration_seconds, served by
+// MetricsHandler, by endpoint ("lookup", "latest", "tile" or "other") and status code.
+func WithRequestMetrics() HandlerOption {
+	return func(o *handlerOptions) {
+		o.metrics = true
+	}
+}
+
+// middleware wraps next in the middleware enabled by opts, returning next as is if there's none.
+func (s *SumDB) middleware(next http.Handler, opts []HandlerOption) http.Handler {
+	o := &handlerOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !o.accessLog && !o.recover && !o.metrics {
+		return next
+	}
+
+	logger := o.accessLogger
+	if logger == nil {
+		logger = s.logger
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := s.clock.Now()
+		rw := &responseRecorder{ResponseWriter: w}
+		if o.recover {
+			s.serveRecovering(rw, r, next)
+		} else {
+			next.ServeHTTP(rw, r)
+		}
+
+		d := s.clock.Now().Sub(start)
+		if o.metrics {
+			s.metrics.requests.With(endpoint(r), strconv.Itoa(rw.code())).Observe(d.Seconds())
+		}
+		if o.accessLog {
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+				slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.Int("status", rw.code()),
+				slog.Int64("bytes", rw.size), slog.Duration("duration", d), slog.String("remote_addr", r.RemoteAddr))
+		}
+	})
+}
+
+// serveRecovering serves r with next, recovering any panic other than http.ErrAbortHandler.
+func (s *SumDB) serveRecovering(w *responseRecorder, r *http.Request, next http.Handler) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+			panic(v)
+		}
+
+		s.logger.LogAttrs(r.Context(), slog.LevelError, "panic serving request",
+			slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.Any("panic", v),
+			slog.String("stack", string(debug.Stack())))
+		if w.status == 0 {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}()
+
+	next.ServeHTTP(w, r)
+}
+
+// endpoint returns the endpoint requested by r.
+func endpoint(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/lookup/"):
+		return endpointLookup
+	case r.URL.Path == "/latest":
+		return endpointLatest
+	case strings.HasPrefix(r.URL.Path, "/tile/"):
+		return endpointTile
+	default:
+		return endpointOther
+	}
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, for http.ResponseController.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// code returns the status of the response, which is 200 OK if the handler didn't write anything.
+func (w *responseRecorder) code() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
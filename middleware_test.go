@@ -0,0 +1,93 @@
+package sumdb_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+)
+
+// panickingStore is a Store panicking when its tree size is read.
+type panickingStore struct {
+	*memStore
+}
+
+func (panickingStore) TreeSize(context.Context) (int64, error) {
+	panic("boom")
+}
+
+func TestHandler_Middleware(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	t.Run("access log and metrics", func(t *testing.T) {
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+		)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		h := db.Handler(WithAccessLog(slog.New(slog.NewJSONHandler(&buf, nil))), WithRequestMetrics())
+
+		for _, path := range []string{"/lookup/example.com/mod@v1.0.0", "/latest", "/tile/8/0/000.p/1", "/nope"} {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		}
+
+		var events []map[string]any
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var e map[string]any
+			require.NoError(t, dec.Decode(&e))
+			events = append(events, e)
+		}
+		require.Len(t, events, 4)
+		require.Equal(t, "request", events[0]["msg"])
+		require.Equal(t, "GET", events[0]["method"])
+		require.Equal(t, "/lookup/example.com/mod@v1.0.0", events[0]["path"])
+		require.Equal(t, float64(http.StatusOK), events[0]["status"])
+		require.Positive(t, events[0]["bytes"])
+		require.Contains(t, events[0], "duration")
+		require.Contains(t, events[0], "remote_addr")
+		require.Equal(t, float64(http.StatusNotFound), events[3]["status"])
+
+		rec := httptest.NewRecorder()
+		db.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		body := rec.Body.String()
+		require.Contains(t, body, `sumdb_request_duration_seconds_count{endpoint="lookup",code="200"} 1`)
+		require.Contains(t, body, `sumdb_request_duration_seconds_count{endpoint="latest",code="200"} 1`)
+		require.Contains(t, body, `sumdb_request_duration_seconds_count{endpoint="tile",code="200"} 1`)
+		require.Contains(t, body, `sumdb_request_duration_seconds_count{endpoint="other",code="404"} 1`)
+	})
+
+	t.Run("panic recovery", func(t *testing.T) {
+		var buf bytes.Buffer
+		db, err := New("test.example.com", skey,
+			WithStore(panickingStore{newMemStore()}),
+			WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))),
+		)
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		db.Handler(WithPanicRecovery()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/latest", nil))
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		var e map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &e))
+		require.Equal(t, "panic serving request", e["msg"])
+		require.Equal(t, "boom", e["panic"])
+		require.Contains(t, e["stack"], "panickingStore")
+
+		// Without recovery, panics are left to net/http.
+		require.PanicsWithValue(t, "boom", func() {
+			db.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/latest", nil))
+		})
+	})
+}
@@ -0,0 +1,387 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/sumdbclient"
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+const (
+	// mirrorInterval is how often Mirror.Run checks the upstream for new records.
+	mirrorInterval = time.Minute
+
+	// mirrorTimeout is the timeout of the default client used by mirrors.
+	mirrorTimeout = time.Minute
+)
+
+// ErrMirrorDiverged is returned by Mirror.Sync and Mirror.Run when the upstream's log doesn't contain the records the
+// mirror already has, which happens when the store holds another log or the upstream has forked its log.
+var ErrMirrorDiverged = errors.New("mirror has diverged from the upstream")
+
+type (
+	// Mirror copies the log of an upstream checksum database (e.g. sum.golang.org) into a local store, record for
+	// record, and serves it with the upstream's signed tree heads. Unlike a SumDB, which signs the records it creates
+	// from module zips, a mirror never creates records: clients verify everything it serves with the upstream's key.
+	//
+	// Every signed tree head is verified with the upstream's key and must be consistent with the records already
+	// mirrored, and every record is authenticated against it before being stored, so the store always holds a prefix
+	// of the upstream's log.
+	Mirror struct {
+		upstream string
+		client   *sumdbclient.Client
+		store    Store
+		workers  int
+		clock    Clock
+
+		// syncMu serializes syncs. signed is the upstream's most recent signed tree head applied to the store, and
+		// tree the tree it signs.
+		syncMu sync.Mutex
+		mu     sync.Mutex
+		signed []byte
+		tree   tlog.Tree
+	}
+
+	// MirrorOption configures a Mirror.
+	MirrorOption func(*Mirror)
+
+	// upstreamTiles is a tileSource reading the tiles of an upstream checksum database.
+	upstreamTiles struct {
+		tlog.TileReader
+		ctx    context.Context
+		client *sumdbclient.Client
+	}
+)
+
+// NewMirror creates a Mirror that copies the log of the checksum database at upstream (e.g. https://sum.golang.org)
+// into store, verifying its signed tree heads with vkey. The store must be empty or only hold records previously
+// mirrored from the same upstream, since records keep their upstream IDs.
+//
+// A nil client uses one with the default transport and a one minute timeout.
+func NewMirror(upstream, vkey string, store Store, client *http.Client, opts ...MirrorOption) (*Mirror, error) {
+	if client == nil {
+		client = &http.Client{Timeout: mirrorTimeout}
+	}
+
+	c, err := sumdbclient.New(client, upstream, vkey)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Mirror{
+		upstream: strings.TrimSuffix(upstream, "/"),
+		client:   c,
+		store:    store,
+		workers:  runtime.GOMAXPROCS(0),
+		clock:    systemClock{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m, nil
+}
+
+// WithMirrorClock sets the Clock the mirror timestamps checkpoints with and waits between syncs with (see Sleeper).
+// Defaults to the system clock.
+func WithMirrorClock(c Clock) MirrorOption {
+	return func(m *Mirror) { m.clock = c }
+}
+
+// Run syncs the mirror every minute until ctx is done, retrying failed syncs with exponential backoff.
+//
+// Only one Run should be running per store. It returns an error wrapping ErrMirrorDiverged if the upstream's log
+// doesn't contain the mirror's records, and ctx.Err() once ctx is done.
+func (m *Mirror) Run(ctx context.Context) error {
+	retry := backoff{clock: m.clock}
+	for {
+		_, err := m.Sync(ctx)
+		if errors.Is(err, ErrMirrorDiverged) {
+			return err
+		}
+
+		if err != nil {
+			if !retry.wait(ctx) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		retry.reset()
+		if !sleep(ctx, m.clock, mirrorInterval) {
+			return ctx.Err()
+		}
+	}
+}
+
+// Sync copies the records the upstream has added since the last sync, and returns the number of records added.
+//
+// Records are authenticated by a pool of workers and appended a data tile at a time, so an interrupted sync resumes
+// where it stopped. The upstream's signed tree head is only served once all of its records have been copied. It
+// returns an error wrapping ErrUpstreamVerification if the upstream's tree heads, tiles or records can't be verified,
+// and ErrMirrorDiverged if its log doesn't contain the mirror's records.
+func (m *Mirror) Sync(ctx context.Context) (int64, error) {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+
+	signed, err := m.client.Latest(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch signed tree head: %s, %w", m.upstream, err)
+	}
+
+	t, err := m.client.VerifyTree(ctx, signed)
+	if errors.Is(err, sumdbclient.ErrInconsistentTree) {
+		return 0, fmt.Errorf("%w: %w", ErrMirrorDiverged, err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to verify signed tree head: %s, %w", m.upstream, err)
+	}
+
+	size, err := m.store.TreeSize(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get tree size: %w", err)
+	}
+
+	// Stale tree heads (e.g. served from a cache) have been checked against the largest tree seen, but can't be
+	// served since the store has records they don't include.
+	if t.N < size {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	src := &upstreamTiles{TileReader: m.client.TileReader(ctx), ctx: ctx, client: m.client}
+	if err := m.checkConsistency(ctx, t, size, tlog.TileHashReader(t, src)); err != nil {
+		return 0, err
+	}
+
+	var added int64
+	for res := range verifyTiles(ctx, src, t, size, m.workers, ErrUpstreamVerification) {
+		tile := <-res
+		if tile.err != nil {
+			return added, tile.err
+		}
+
+		if err := m.append(ctx, tile.start, tile.recs); err != nil {
+			return added, err
+		}
+		added += int64(len(tile.recs))
+	}
+	if err := ctx.Err(); err != nil {
+		return added, err
+	}
+
+	m.mu.Lock()
+	m.signed, m.tree = signed, t
+	m.mu.Unlock()
+	return added, nil
+}
+
+// Signed returns the upstream's most recent signed tree head whose records have all been copied to the store, or nil
+// if none has been since the mirror was created.
+func (m *Mirror) Signed() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.signed
+}
+
+// Handler returns an HTTP handler serving the mirrored log with the checksum database protocol (/latest, /lookup and
+// /tile), under the upstream's most recent signed tree head whose records have all been copied (see Signed). Clients
+// verify it with the upstream's key, e.g. with GOSUMDB="sum.golang.org https://mirror.example.com".
+//
+// Lookups only serve records that have already been mirrored, so modules the upstream has added since the last sync
+// are answered with 404 Not Found. All requests are answered with 503 Service Unavailable until the first sync.
+func (m *Mirror) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		m.mu.Lock()
+		signed, t := m.signed, m.tree
+		m.mu.Unlock()
+
+		if signed == nil {
+			http.Error(w, "mirror hasn't synced with the upstream", http.StatusServiceUnavailable)
+			return
+		}
+
+		switch path := r.URL.Path; {
+		case path == "/latest":
+			w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+			_, _ = w.Write(signed)
+		case strings.HasPrefix(path, "/lookup/"):
+			m.serveLookup(w, r, signed, t)
+		default:
+			tile, err := tlog.ParseTilePath(strings.TrimPrefix(path, "/"))
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			m.serveTile(w, r, tile, t)
+		}
+	})
+}
+
+// serveLookup serves /lookup/<module>@<version> requests for the records in the tree t signed by signed.
+func (m *Mirror) serveLookup(w http.ResponseWriter, r *http.Request, signed []byte, t tlog.Tree) {
+	mod, ok := parseLookupPath(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := m.store.RecordID(r.Context(), mod.Path, mod.Version)
+	if err == nil && id >= t.N {
+		err = fmt.Errorf("%w: %s isn't in the tree yet", ErrNotFound, mod)
+	}
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	recs, err := m.store.Records(r.Context(), id, 1)
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+	if len(recs) != 1 {
+		http.Error(w, "invalid record count returned by Records", http.StatusInternalServerError)
+		return
+	}
+
+	msg, err := appendLookupRecord(make([]byte, 0, len(recs[0].Data)+lookupRecordOverhead+len(signed)), id,
+		recs[0].Data)
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	_, _ = w.Write(append(msg, signed...))
+}
+
+// serveTile serves /tile/H/L/N[.p/W] requests for the tiles of the tree t.
+func (m *Mirror) serveTile(w http.ResponseWriter, r *http.Request, tile tlog.Tile, t tlog.Tree) {
+	if tile.H != tree.TileHeight {
+		reportError(w, fmt.Errorf("%w: unsupported tile height: %d", ErrReadLimitExceeded, tile.H))
+		return
+	}
+
+	// Tiles must be within the tree: at level L, there's a hash for every 2^(L*H) records.
+	width := t.N
+	if tile.L > 0 {
+		width = t.N >> (tile.L * tile.H)
+	}
+	if tile.N<<tile.H+int64(tile.W) > width {
+		http.NotFound(w, r)
+		return
+	}
+
+	if tile.L >= 0 {
+		data, err := tree.ReadTile(r.Context(), m.store, tile)
+		if err != nil {
+			reportError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(data)
+		return
+	}
+
+	recs, err := m.store.Records(r.Context(), tile.N<<tile.H, int64(tile.W))
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+	if len(recs) != tile.W {
+		http.Error(w, "invalid record count returned by Records", http.StatusInternalServerError)
+		return
+	}
+
+	var data []byte
+	for _, rec := range recs {
+		data = append(append(data, rec.Data...), '\n')
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	_, _ = w.Write(data)
+}
+
+// checkConsistency verifies that the upstream's tree t contains the mirror's tree of the given size, reading t's
+// hashes with hr.
+func (m *Mirror) checkConsistency(ctx context.Context, t tlog.Tree, size int64, hr tlog.HashReader) error {
+	if size == 0 {
+		return nil
+	}
+
+	root, err := tree.TreeHashAt(ctx, m.store, size)
+	if err != nil {
+		return fmt.Errorf("failed to compute tree hash: %w", err)
+	}
+
+	proof, err := tlog.ProveTree(t.N, size, hr)
+	if err != nil {
+		return fmt.Errorf("%w: failed to prove tree consistency: %w", ErrUpstreamVerification, err)
+	}
+
+	if err := tlog.CheckTree(proof, t.N, t.Hash, size, root); err != nil {
+		return fmt.Errorf("%w: tree of size %d isn't contained in the upstream's tree of size %d: %w",
+			ErrMirrorDiverged, size, t.N, err)
+	}
+	return nil
+}
+
+// append stores recs, the verified records starting at ID start, and their hashes in a single transaction.
+func (m *Mirror) append(ctx context.Context, start int64, recs []*Record) error {
+	return withTx(ctx, m.store, func(store Store) error {
+		size, err := store.TreeSize(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get tree size: %w", err)
+		}
+		if size != start {
+			return fmt.Errorf("tree has %d records, want %d", size, start)
+		}
+
+		data := make([][]byte, len(recs))
+		for i, rec := range recs {
+			id, err := store.AddRecord(ctx, rec)
+			if err != nil {
+				return fmt.Errorf("failed to add record: %s@%s, %w", rec.Path, rec.Version, err)
+			}
+			if want := start + int64(i); id != want {
+				return fmt.Errorf("store assigned ID %d to record %d", id, want)
+			}
+			data[i] = rec.Data
+		}
+
+		if err := tree.AddRecords(ctx, store, start, data); err != nil {
+			return fmt.Errorf("failed to update tree hashes: %w", err)
+		}
+
+		for i, rec := range recs {
+			if err := onAppend(ctx, store, start+int64(i), rec); err != nil {
+				return err
+			}
+		}
+		return addCheckpoint(ctx, store, start+int64(len(recs)), m.clock.Now())
+	})
+}
+
+// records implements tileSource.
+func (u *upstreamTiles) records(t tlog.Tile) ([]*Record, error) {
+	data, err := u.client.ReadDataTile(u.ctx, t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tile %s: %w", t.Path(), err)
+	}
+	return parseDataTile(t, data, ErrUpstreamVerification)
+}
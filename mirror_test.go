@@ -0,0 +1,166 @@
+package sumdb_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/monitor"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestMirror(t *testing.T) {
+	upstream := newTrustedSumDB(t)
+	addUpstreamRecords(t, upstream, 0, 260)
+
+	store := memstore.New()
+	mirror, err := NewMirror(upstream.url.String(), upstream.vkey, store, nil)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(mirror.Handler())
+	t.Cleanup(srv.Close)
+	require.Equal(t, http.StatusServiceUnavailable, get(t, srv.URL+"/latest").StatusCode)
+
+	added, err := mirror.Sync(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(260), added)
+
+	// The mirror serves the upstream's log as it is, under the upstream's signed tree head.
+	signed, err := upstream.Signed(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, string(signed), string(mirror.Signed()))
+
+	for _, path := range []string{
+		"/latest",
+		"/lookup/example.com/mirrored7@v1.0.0",
+		"/tile/8/0/000",
+		"/tile/8/0/001.p/4",
+		"/tile/8/data/001.p/4",
+	} {
+		require.Equal(t, serve(t, upstream.Handler(), path), readBody(t, get(t, srv.URL+path)), path)
+	}
+	require.Equal(t, http.StatusNotFound, get(t, srv.URL+"/lookup/example.com/missing@v1.0.0").StatusCode)
+
+	m, err := monitor.New(srv.URL, upstream.vkey)
+	require.NoError(t, err)
+	tree, err := m.Check(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(260), tree.N)
+
+	t.Run("new records", func(t *testing.T) {
+		addUpstreamRecords(t, upstream, 260, 5)
+
+		added, err := mirror.Sync(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(5), added)
+
+		added, err = mirror.Sync(t.Context())
+		require.NoError(t, err)
+		require.Zero(t, added)
+
+		tree, err := m.Check(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(265), tree.N)
+	})
+
+	t.Run("diverged logs", func(t *testing.T) {
+		// A store holding the log of another checksum database.
+		other := newTrustedSumDB(t)
+		addUpstreamRecords(t, other, 1000, 1)
+
+		otherStore := memstore.New()
+		otherMirror, err := NewMirror(other.url.String(), other.vkey, otherStore, nil)
+		require.NoError(t, err)
+		_, err = otherMirror.Sync(t.Context())
+		require.NoError(t, err)
+
+		diverged, err := NewMirror(upstream.url.String(), upstream.vkey, otherStore, nil)
+		require.NoError(t, err)
+		_, err = diverged.Sync(t.Context())
+		require.ErrorIs(t, err, ErrMirrorDiverged)
+		require.ErrorIs(t, diverged.Run(t.Context()), ErrMirrorDiverged)
+	})
+
+	t.Run("tampered tiles", func(t *testing.T) {
+		tampering := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := httptest.NewRecorder()
+			upstream.Handler().ServeHTTP(rec, r)
+
+			body := rec.Body.Bytes()
+			if strings.HasPrefix(r.URL.Path, "/tile/8/data/") {
+				body = bytes.Replace(body, []byte("h1:"), []byte("h1:X"), 1)
+			}
+			_, _ = w.Write(body)
+		}))
+		t.Cleanup(tampering.Close)
+
+		store := memstore.New()
+		tampered, err := NewMirror(tampering.URL, upstream.vkey, store, nil)
+		require.NoError(t, err)
+
+		_, err = tampered.Sync(t.Context())
+		require.ErrorIs(t, err, ErrUpstreamVerification)
+		require.Nil(t, tampered.Signed())
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Zero(t, size)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, vkey, err := GenerateKeys("sum.example.com")
+		require.NoError(t, err)
+
+		wrong, err := NewMirror(upstream.url.String(), vkey, memstore.New(), nil)
+		require.NoError(t, err)
+		_, err = wrong.Sync(t.Context())
+		require.ErrorIs(t, err, ErrUpstreamVerification)
+	})
+}
+
+// addUpstreamRecords adds n records to the trusted sumdb, for modules numbered from first.
+func addUpstreamRecords(t *testing.T, db *trustedSumDB, first, n int) {
+	t.Helper()
+
+	mods := make([]module.Version, n)
+	for i := range mods {
+		mods[i] = module.Version{Path: fmt.Sprintf("example.com/mirrored%d", first+i), Version: "v1.0.0"}
+	}
+
+	_, err := db.AddRecords(t.Context(), mods)
+	require.NoError(t, err)
+}
+
+// serve returns the body of h's response to a GET request for path.
+func serve(t *testing.T, h http.Handler, path string) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(t, http.StatusOK, rec.Code, path)
+	return rec.Body.String()
+}
+
+func get(t *testing.T, url string) *http.Response {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(data)
+}
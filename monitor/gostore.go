@@ -0,0 +1,124 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// GoStore is a HeadStore sharing the go command's record of a checksum database's latest signed tree head, which it
+// keeps in $GOPATH/pkg/sumdb/<name>/latest. Monitors using it check the heads the go command verified, and the go
+// command checks the heads they observed, so that both share the same local trust state: a fork seen by either is
+// caught by the other.
+//
+// The file is locked the way the go command locks it, so both can use it concurrently. It's only supported on unix.
+type GoStore struct {
+	path string
+}
+
+// NewGoStore returns a GoStore for the checksum database called name (the name of its key, e.g. sum.golang.org) in
+// the go command's sumdb directory dir. See GoSumDBDir.
+func NewGoStore(dir, name string) *GoStore {
+	return &GoStore{path: filepath.Join(dir, name, "latest")}
+}
+
+// GoSumDBDir returns the go command's sumdb directory, $GOPATH/pkg/sumdb, using the first entry of GOPATH ($HOME/go
+// by default). A GOPATH set with go env -w isn't seen, so it must be set in the environment.
+func GoSumDBDir() string {
+	gopath := filepath.SplitList(build.Default.GOPATH)
+	if len(gopath) == 0 {
+		return ""
+	}
+	return filepath.Join(gopath[0], "pkg", "sumdb")
+}
+
+// Load implements HeadStore.
+func (s *GoStore) Load(context.Context) ([]byte, error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open head file: %s, %w", s.path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := lock(f, false); err != nil {
+		return nil, fmt.Errorf("failed to lock head file: %s, %w", s.path, err)
+	}
+	defer func() { _ = unlock(f) }()
+
+	signed, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read head file: %s, %w", s.path, err)
+	}
+	if len(signed) == 0 {
+		return nil, nil
+	}
+	return signed, nil
+}
+
+// Save implements HeadStore. The head is only written if it's larger than the saved one, so that heads saved by the
+// go command in the meantime are never replaced by older ones.
+//
+// Like the go command, the file is rewritten in place while it's locked: replacing it would let a concurrent writer
+// holding the lock on the replaced file lose its update.
+func (s *GoStore) Save(_ context.Context, signed []byte) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o777); err != nil { // #nosec G301 -- permissions used by the go command
+		return fmt.Errorf("failed to create sumdb directory: %s, %w", filepath.Dir(s.path), err)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0o666) // #nosec G302 G304 -- as created by the go command
+	if err != nil {
+		return fmt.Errorf("failed to open head file: %s, %w", s.path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := lock(f, true); err != nil {
+		return fmt.Errorf("failed to lock head file: %s, %w", s.path, err)
+	}
+	defer func() { _ = unlock(f) }()
+
+	saved, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("failed to read head file: %s, %w", s.path, err)
+	}
+	if bytes.Equal(saved, signed) || treeSize(saved) >= treeSize(signed) {
+		return nil
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write head file: %s, %w", s.path, err)
+	}
+	if _, err := f.WriteAt(signed, 0); err != nil {
+		return fmt.Errorf("failed to write head file: %s, %w", s.path, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync head file: %s, %w", s.path, err)
+	}
+	return nil
+}
+
+// treeSize returns the size of the tree of a signed tree head without verifying its signature, or -1 if it can't be
+// parsed. Saved heads are verified when they're loaded.
+func treeSize(signed []byte) int64 {
+	// The note's text ends at the blank line before its signatures.
+	end := bytes.Index(signed, []byte("\n\n"))
+	if end < 0 {
+		return -1
+	}
+
+	tree, err := tlog.ParseTree(signed[:end+1])
+	if err != nil {
+		return -1
+	}
+	return tree.N
+}
@@ -0,0 +1,138 @@
+package monitor_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb/monitor"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestGoStore(t *testing.T) {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	require.NoError(t, err)
+
+	log := newTestLog(t, skey, "mod", 10)
+	srv := httptest.NewServer(sumdb.NewServer(log))
+	t.Cleanup(srv.Close)
+
+	// The go command's client, keeping its trust state in dir.
+	dir := t.TempDir()
+	ops := &goClientOps{t: t, url: srv.URL, dir: dir, vkey: vkey}
+	_, err = sumdb.NewClient(ops).Lookup("example.com/mod3", "v1.0.0")
+	require.NoError(t, err)
+
+	store := NewGoStore(dir, "sum.example.com")
+	signed, err := store.Load(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, ops.latest(), signed)
+
+	// Heads observed by the monitor are checked by the go command.
+	log.add("mod", 20)
+	m, err := New(srv.URL, vkey, WithHeadStore(store))
+	require.NoError(t, err)
+	tree, err := m.Check(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(30), tree.N)
+	require.Equal(t, m.Latest(), ops.latest())
+
+	_, err = sumdb.NewClient(ops).Lookup("example.com/mod25", "v1.0.0")
+	require.NoError(t, err)
+	require.Empty(t, ops.securityErrors)
+
+	// Smaller heads don't replace larger ones saved in the meantime.
+	require.NoError(t, store.Save(t.Context(), signed))
+	require.Equal(t, m.Latest(), ops.latest())
+
+	// Heads observed by the go command are checked by the monitor, e.g. when the go command was served a fork.
+	log.fork(newTestLog(t, skey, "fork", 40))
+	head, err := log.Signed(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sum.example.com", "latest"), head, 0o600))
+
+	_, err = m.Check(t.Context())
+	var fork *ForkError
+	require.ErrorAs(t, err, &fork)
+	require.Equal(t, head, fork.New)
+}
+
+func TestGoSumDBDir(t *testing.T) {
+	require.True(t, strings.HasSuffix(GoSumDBDir(), filepath.Join("pkg", "sumdb")), GoSumDBDir())
+}
+
+// goClientOps implements sumdb.ClientOps the way the go command does, keeping its configuration in dir.
+type goClientOps struct {
+	t    *testing.T
+	url  string
+	dir  string
+	vkey string
+
+	securityErrors []string
+}
+
+func (o *goClientOps) ReadRemote(path string) ([]byte, error) {
+	resp, err := http.Get(o.url + path) // #nosec G107 -- test server
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (o *goClientOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(o.vkey), nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(o.dir, file))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []byte{}, nil
+	}
+	return data, err
+}
+
+func (o *goClientOps) WriteConfig(file string, old, new []byte) error {
+	path := filepath.Join(o.dir, file)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(data) > 0 && !bytes.Equal(data, old) {
+		return sumdb.ErrWriteConflict
+	}
+	return os.WriteFile(path, new, 0o600)
+}
+
+func (o *goClientOps) ReadCache(string) ([]byte, error) { return nil, fs.ErrNotExist }
+
+func (o *goClientOps) WriteCache(string, []byte) {}
+
+func (o *goClientOps) Log(string) {}
+
+func (o *goClientOps) SecurityError(msg string) { o.securityErrors = append(o.securityErrors, msg) }
+
+// latest returns the signed tree head saved by the go command's client.
+func (o *goClientOps) latest() []byte {
+	data, err := o.ReadConfig("sum.example.com/latest")
+	require.NoError(o.t, err)
+	return data
+}
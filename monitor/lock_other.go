@@ -0,0 +1,17 @@
+//go:build !unix
+
+package monitor
+
+import (
+	"errors"
+	"os"
+)
+
+// lock fails on platforms without flock, so GoStore isn't supported there.
+func lock(*os.File, bool) error {
+	return errors.ErrUnsupported
+}
+
+func unlock(*os.File) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package monitor
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lock takes an flock on f, exclusive or shared, waiting for it to be free. This is how the go command locks the files
+// in its sumdb directory on unix.
+func lock(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	for {
+		err := syscall.Flock(int(f.Fd()), how) // #nosec G115 -- file descriptors fit in an int
+		if !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
+
+// unlock releases the flock on f.
+func unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN) // #nosec G115 -- file descriptors fit in an int
+}
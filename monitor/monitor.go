@@ -0,0 +1,291 @@
+// Package monitor implements a third-party monitor for checksum databases, such as sum.golang.org or one served by this
+// module.
+//
+// A Monitor periodically fetches the database's signed tree head, verifies its signature and checks that it's
+// consistent with every head seen before it, so that a database which rewrites or forks its log is caught. Observed
+// heads are persisted in a HeadStore, so that forks are also detected across restarts:
+//
+//	m, err := monitor.New("https://sum.golang.org", vkey,
+//		monitor.WithHeadStore(monitor.NewFileStore("/var/lib/sumdb-monitor/latest")),
+//	)
+//	if err != nil { ... }
+//
+//	var fork *monitor.ForkError
+//	if err := m.Run(ctx); errors.As(err, &fork) {
+//		// fork.Old and fork.New are signed tree heads proving the fork.
+//	}
+//
+// A GoStore shares the latest head with the go command instead, so that tools built with this package and the go
+// command check each other's view of the database.
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pseudomuto/sumdb/alert"
+	"github.com/pseudomuto/sumdb/internal/sumdbclient"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// ErrFork is wrapped by the ForkError returned when a checksum database serves a signed tree head that's inconsistent
+// with one it served before.
+var ErrFork = errors.New("monitor: checksum database log has forked")
+
+type (
+	// HTTPClient defines an HTTP client for executing requests.
+	HTTPClient interface {
+		Do(*http.Request) (*http.Response, error)
+	}
+
+	// HeadStore persists the latest signed tree head observed by a Monitor.
+	HeadStore interface {
+		// Load returns the most recently saved signed tree head, or nil if none has been saved.
+		Load(ctx context.Context) ([]byte, error)
+
+		// Save replaces the saved signed tree head with signed.
+		Save(ctx context.Context, signed []byte) error
+	}
+
+	// Option configures a Monitor.
+	Option func(*Monitor)
+
+	// Monitor watches a checksum database for forks.
+	Monitor struct {
+		url      string
+		client   HTTPClient
+		store    HeadStore
+		interval time.Duration
+		onHead   func(tlog.Tree)
+		onError  func(error)
+		alerter  alert.Alerter
+
+		// sumdb verifies heads against the largest tree it has seen. signed and tree are the largest head observed
+		// (or loaded from the store), and stored is the head last loaded from or saved to the store.
+		mu     sync.Mutex
+		sumdb  *sumdbclient.Client
+		signed []byte
+		tree   tlog.Tree
+		stored []byte
+	}
+
+	// ForkError is evidence that a checksum database has forked its log: two signed tree heads that can't both be
+	// part of the same append-only log. Either can be verified independently with the database's verifier key.
+	ForkError struct {
+		// Old is the largest signed tree head seen before the fork was detected, and New the inconsistent one.
+		Old []byte
+		New []byte
+
+		err error
+	}
+)
+
+// New creates a Monitor for the checksum database at url (e.g. https://sum.golang.org), whose tree heads are signed
+// by the key with the verifier key vkey.
+func New(url, vkey string, opts ...Option) (*Monitor, error) {
+	m := &Monitor{
+		url:      url,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		interval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	c, err := sumdbclient.New(m.client, url, vkey)
+	if err != nil {
+		return nil, fmt.Errorf("monitor: %w", err)
+	}
+	m.sumdb = c
+
+	return m, nil
+}
+
+// WithAlerter delivers alerts to a when the database forks (critical) and when its signed tree heads fail verification
+// for other reasons, such as invalid signatures (warning). Errors delivering alerts are passed to the handler set with
+// WithErrorHandler.
+func WithAlerter(a alert.Alerter) Option {
+	return func(m *Monitor) { m.alerter = a }
+}
+
+// WithErrorHandler calls fn with the errors of checks that failed for reasons other than a fork (e.g. the database
+// being unreachable, or serving a head with an invalid signature), which Run otherwise retries silently.
+func WithErrorHandler(fn func(error)) Option {
+	return func(m *Monitor) { m.onError = fn }
+}
+
+// WithHeadHandler calls fn with every tree larger than the previously observed one.
+func WithHeadHandler(fn func(tlog.Tree)) Option {
+	return func(m *Monitor) { m.onHead = fn }
+}
+
+// WithHeadStore persists the latest observed signed tree head in s. Without one, heads are only kept in memory, so
+// forks spanning a restart of the monitor go unnoticed.
+func WithHeadStore(s HeadStore) Option {
+	return func(m *Monitor) { m.store = s }
+}
+
+// WithHTTPClient sets the client used to fetch signed tree heads and tiles.
+func WithHTTPClient(c HTTPClient) Option {
+	return func(m *Monitor) { m.client = c }
+}
+
+// WithInterval sets how often Run checks the database. Defaults to one minute.
+func WithInterval(d time.Duration) Option {
+	return func(m *Monitor) { m.interval = d }
+}
+
+// Run checks the database every interval until ctx is done or a fork is detected. Other errors are passed to the
+// handler set with WithErrorHandler, and the check is retried at the next interval.
+//
+// It returns a *ForkError if the database forks, and ctx.Err() once ctx is done.
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := m.Check(ctx)
+		if errors.Is(err, ErrFork) {
+			return err
+		}
+		if err != nil && ctx.Err() == nil && m.onError != nil {
+			m.onError(err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Check fetches the database's signed tree head and verifies that it's consistent with the largest one seen so far,
+// persisting it if it's larger. It returns the verified tree, or a *ForkError if it's inconsistent.
+//
+// Smaller trees (e.g. heads served from a stale cache) are checked against the tiles of the larger tree, so the
+// database must still serve them.
+func (m *Monitor) Check(ctx context.Context) (tlog.Tree, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(ctx); err != nil {
+		return tlog.Tree{}, err
+	}
+
+	signed, err := m.sumdb.Latest(ctx)
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("failed to fetch signed tree head: %s, %w", m.url, err)
+	}
+
+	tree, err := m.sumdb.VerifyTree(ctx, signed)
+	if errors.Is(err, sumdbclient.ErrInconsistentTree) {
+		return tlog.Tree{}, m.fork(ctx, signed, err)
+	}
+	if errors.Is(err, sumdbclient.ErrVerification) {
+		m.alert(ctx, alert.Warning, "failed to verify signed tree head", map[string]string{
+			"signed": string(signed),
+			"error":  err.Error(),
+		})
+	}
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("failed to verify signed tree head: %s, %w", m.url, err)
+	}
+
+	if tree.N <= m.tree.N {
+		return tree, nil
+	}
+
+	if m.store != nil {
+		if err := m.store.Save(ctx, signed); err != nil {
+			return tlog.Tree{}, fmt.Errorf("failed to save signed tree head: %w", err)
+		}
+		m.stored = signed
+	}
+
+	m.signed, m.tree = signed, tree
+	if m.onHead != nil {
+		m.onHead(tree)
+	}
+
+	return tree, nil
+}
+
+// Latest returns the largest signed tree head observed, or nil if none has been.
+func (m *Monitor) Latest() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.signed
+}
+
+// alert delivers an alert about the database to the alerter set with WithAlerter, if any.
+func (m *Monitor) alert(ctx context.Context, severity alert.Severity, summary string, details map[string]string) {
+	if m.alerter == nil {
+		return
+	}
+
+	details["url"] = m.url
+	err := m.alerter.Alert(ctx, &alert.Alert{
+		Source:   "monitor",
+		Severity: severity,
+		Summary:  summary,
+		Details:  details,
+		Time:     time.Now(),
+	})
+	if err != nil && m.onError != nil {
+		m.onError(fmt.Errorf("failed to deliver alert: %w", err))
+	}
+}
+
+// fork alerts about and returns the ForkError for a signed tree head inconsistent with the largest one observed.
+func (m *Monitor) fork(ctx context.Context, signed []byte, err error) error {
+	m.alert(ctx, alert.Critical, "checksum database has forked its log", map[string]string{
+		"old": string(m.signed),
+		"new": string(signed),
+	})
+	return &ForkError{Old: m.signed, New: signed, err: err}
+}
+
+// load verifies the head saved in the store whenever it changes, seeding the monitor with it the first time. Heads
+// saved by other processes sharing the store (such as the go command, see GoStore) are checked like the ones the
+// monitor fetches, so that a fork between them is detected too.
+func (m *Monitor) load(ctx context.Context) error {
+	if m.store == nil {
+		return nil
+	}
+
+	signed, err := m.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load signed tree head: %w", err)
+	}
+	if signed == nil || bytes.Equal(signed, m.stored) {
+		return nil
+	}
+
+	tree, err := m.sumdb.VerifyTree(ctx, signed)
+	if errors.Is(err, sumdbclient.ErrInconsistentTree) {
+		return m.fork(ctx, signed, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to verify saved signed tree head: %w", err)
+	}
+
+	m.stored = signed
+	if tree.N > m.tree.N {
+		m.signed, m.tree = signed, tree
+	}
+	return nil
+}
+
+func (e *ForkError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrFork, e.err)
+}
+
+func (e *ForkError) Unwrap() []error {
+	return []error{ErrFork, e.err}
+}
@@ -0,0 +1,277 @@
+package monitor_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pseudomuto/sumdb/alert"
+	. "github.com/pseudomuto/sumdb/monitor"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestMonitor(t *testing.T) {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+	require.NoError(t, err)
+
+	t.Run("observes growing trees", func(t *testing.T) {
+		log := newTestLog(t, skey, "mod", 10)
+		srv := httptest.NewServer(sumdb.NewServer(log))
+		t.Cleanup(srv.Close)
+
+		var heads []int64
+		m, err := New(srv.URL, vkey, WithHeadHandler(func(tree tlog.Tree) { heads = append(heads, tree.N) }))
+		require.NoError(t, err)
+
+		tree, err := m.Check(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(10), tree.N)
+
+		log.add("mod", 300)
+		tree, err = m.Check(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(310), tree.N)
+
+		// Unchanged trees aren't reported again.
+		_, err = m.Check(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, []int64{10, 310}, heads)
+
+		signed, err := log.Signed(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, signed, m.Latest())
+	})
+
+	t.Run("detects forks", func(t *testing.T) {
+		log := newTestLog(t, skey, "mod", 10)
+		srv := httptest.NewServer(sumdb.NewServer(log))
+		t.Cleanup(srv.Close)
+
+		var alerts []*alert.Alert
+		m, err := New(srv.URL, vkey, WithAlerter(alert.Func(func(_ context.Context, a *alert.Alert) error {
+			alerts = append(alerts, a)
+			return nil
+		})))
+		require.NoError(t, err)
+		_, err = m.Check(t.Context())
+		require.NoError(t, err)
+		old := m.Latest()
+
+		// A log with different records, signed by the same key.
+		log.fork(newTestLog(t, skey, "fork", 20))
+		_, err = m.Check(t.Context())
+		require.ErrorIs(t, err, ErrFork)
+
+		var fork *ForkError
+		require.ErrorAs(t, err, &fork)
+		require.Equal(t, old, fork.Old)
+		forked, err := log.Signed(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, forked, fork.New)
+
+		// The fork isn't accepted as the latest head.
+		require.Equal(t, old, m.Latest())
+
+		require.Len(t, alerts, 1)
+		require.Equal(t, "monitor", alerts[0].Source)
+		require.Equal(t, alert.Critical, alerts[0].Severity)
+		require.Equal(t, map[string]string{"url": srv.URL, "old": string(old), "new": string(forked)}, alerts[0].Details)
+	})
+
+	t.Run("detects forks across restarts", func(t *testing.T) {
+		log := newTestLog(t, skey, "mod", 10)
+		srv := httptest.NewServer(sumdb.NewServer(log))
+		t.Cleanup(srv.Close)
+
+		store := NewFileStore(filepath.Join(t.TempDir(), "latest"))
+		m, err := New(srv.URL, vkey, WithHeadStore(store))
+		require.NoError(t, err)
+		_, err = m.Check(t.Context())
+		require.NoError(t, err)
+
+		log.fork(newTestLog(t, skey, "fork", 20))
+		m, err = New(srv.URL, vkey, WithHeadStore(store))
+		require.NoError(t, err)
+		_, err = m.Check(t.Context())
+		require.ErrorIs(t, err, ErrFork)
+	})
+
+	t.Run("run", func(t *testing.T) {
+		log := newTestLog(t, skey, "mod", 10)
+		srv := httptest.NewServer(sumdb.NewServer(log))
+		t.Cleanup(srv.Close)
+
+		// Heads signed by another key are errors, not forks.
+		_, otherKey, err := note.GenerateKey(rand.Reader, "sum.example.com")
+		require.NoError(t, err)
+
+		errs := make(chan error, 10)
+		m, err := New(srv.URL, otherKey, WithInterval(time.Millisecond), WithErrorHandler(func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		}))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan error)
+		go func() { done <- m.Run(ctx) }()
+
+		require.ErrorContains(t, <-errs, "failed to verify signed tree head")
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+
+		// Run stops at forks.
+		m, err = New(srv.URL, vkey, WithInterval(time.Millisecond))
+		require.NoError(t, err)
+		_, err = m.Check(t.Context())
+		require.NoError(t, err)
+
+		log.fork(newTestLog(t, skey, "fork", 20))
+		require.ErrorIs(t, m.Run(t.Context()), ErrFork)
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest")
+	store := NewFileStore(path)
+
+	signed, err := store.Load(t.Context())
+	require.NoError(t, err)
+	require.Nil(t, signed)
+
+	require.NoError(t, store.Save(t.Context(), []byte("first")))
+	require.NoError(t, store.Save(t.Context(), []byte("second")))
+
+	signed, err = store.Load(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, "second", string(signed))
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+// testLog is an in-memory checksum database implementing sumdb.ServerOps.
+type testLog struct {
+	t      *testing.T
+	signer note.Signer
+
+	mu      sync.Mutex
+	records [][]byte
+	hashes  map[int64]tlog.Hash
+	forked  *testLog // the log served in place of this one, if any
+}
+
+// newTestLog returns a log with n records for modules named after prefix.
+func newTestLog(t *testing.T, skey, prefix string, n int) *testLog {
+	t.Helper()
+
+	s, err := note.NewSigner(skey)
+	require.NoError(t, err)
+
+	l := &testLog{t: t, signer: s, hashes: make(map[int64]tlog.Hash)}
+	l.add(prefix, n)
+	return l
+}
+
+// add appends n records for modules named after prefix.
+func (l *testLog) add(prefix string, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for range n {
+		id := int64(len(l.records))
+		data := fmt.Appendf(nil, "example.com/%s%d v1.0.0 h1:zip=\nexample.com/%s%d v1.0.0/go.mod h1:mod=\n",
+			prefix, id, prefix, id)
+		hashes, err := tlog.StoredHashes(id, data, l)
+		require.NoError(l.t, err)
+		for i, h := range hashes {
+			l.hashes[tlog.StoredHashIndex(0, id)+int64(i)] = h
+		}
+		l.records = append(l.records, data)
+	}
+}
+
+// fork serves other in place of l.
+func (l *testLog) fork(other *testLog) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.forked = other
+}
+
+func (l *testLog) current() *testLog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.forked != nil {
+		return l.forked
+	}
+	return l
+}
+
+// ReadHashes implements tlog.HashReader. It must be called with l.mu held.
+func (l *testLog) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	out := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		h, ok := l.hashes[idx]
+		if !ok {
+			return nil, fmt.Errorf("missing hash %d", idx)
+		}
+		out[i] = h
+	}
+	return out, nil
+}
+
+func (l *testLog) Signed(context.Context) ([]byte, error) {
+	l = l.current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := int64(len(l.records))
+	h, err := tlog.TreeHash(n, l)
+	if err != nil {
+		return nil, err
+	}
+	return note.Sign(&note.Note{Text: string(tlog.FormatTree(tlog.Tree{N: n, Hash: h}))}, l.signer)
+}
+
+func (l *testLog) ReadRecords(_ context.Context, id, n int64) ([][]byte, error) {
+	l = l.current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.records[id:min(id+n, int64(len(l.records)))], nil
+}
+
+func (l *testLog) Lookup(_ context.Context, m module.Version) (int64, error) {
+	l = l.current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prefix := []byte(m.Path + " " + m.Version + " ")
+	for id, rec := range l.records {
+		if bytes.HasPrefix(rec, prefix) {
+			return int64(id), nil
+		}
+	}
+	return 0, os.ErrNotExist
+}
+
+func (l *testLog) ReadTileData(_ context.Context, t tlog.Tile) ([]byte, error) {
+	l = l.current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return tlog.ReadTileData(t, l)
+}
@@ -0,0 +1,62 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileStore is a HeadStore keeping the latest signed tree head in a file.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore returns a FileStore keeping the latest signed tree head in the file at path. The file is created when
+// the first head is saved, and its directory must exist.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load implements HeadStore.
+func (s *FileStore) Load(context.Context) ([]byte, error) {
+	signed, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read head file: %w", err)
+	}
+	return signed, nil
+}
+
+// Save implements HeadStore. The head is written to a temporary file which then replaces the previous one, so that a
+// crash never leaves a partially written head behind.
+func (s *FileStore) Save(_ context.Context, signed []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create head file: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if _, err := f.Write(signed); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write head file: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync head file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write head file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace head file: %w", err)
+	}
+	return nil
+}
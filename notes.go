@@ -0,0 +1,83 @@
+package sumdb
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+const noteHeader = "sumdb note"
+
+// ErrInvalidNote is returned by VerifyNote when a note isn't correctly signed for the expected context.
+var ErrInvalidNote = errors.New("invalid note")
+
+// SignNote signs text with the server's key, so that consumers of application artifacts (e.g. an exported go.sum or
+// an SBOM) can verify they came from the same authority as the log using its verifier key. Additional signers, such
+// as a release team's key, co-sign the note.
+//
+// The note is bound to context (e.g. "go.sum export"), which is included in the signed text: a note signed for one
+// context can't be passed off as another, nor as a tree head or audit entry. text must be valid UTF-8 and end with a
+// newline; binary artifacts should be signed by including their digest in text.
+func (s *SumDB) SignNote(context, text string, signers ...note.Signer) ([]byte, error) {
+	if context == "" || strings.ContainsAny(context, "\n") {
+		return nil, errors.New("note context must be a non-empty single line")
+	}
+
+	signed, err := note.Sign(&note.Note{Text: noteText(context, text)}, append([]note.Signer{s.signer}, signers...)...)
+	if err != nil {
+		s.logger.Error("failed to sign note", slog.String("context", context), slog.Any("error", err))
+		return nil, fmt.Errorf("failed to sign note: %w", err)
+	}
+	s.logger.Debug("signed note", slog.String("context", context), slog.Int("cosigners", len(signers)))
+
+	return signed, nil
+}
+
+// VerifyNote verifies that msg was signed by SignNote for context by every one of the verifier keys vkeys, returning
+// the signed text. It returns an error wrapping ErrInvalidNote if a signature is missing or invalid, or the note was
+// signed for a different context.
+func VerifyNote(msg []byte, context string, vkeys ...string) (string, error) {
+	if len(vkeys) == 0 {
+		return "", errors.New("at least one verifier key is required")
+	}
+
+	verifiers := make([]note.Verifier, len(vkeys))
+	for i, vkey := range vkeys {
+		v, err := note.NewVerifier(vkey)
+		if err != nil {
+			return "", fmt.Errorf("invalid verifier key: %w", err)
+		}
+		verifiers[i] = v
+	}
+
+	n, err := note.Open(msg, note.VerifierList(verifiers...))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidNote, err)
+	}
+
+	for _, v := range verifiers {
+		signed := slices.ContainsFunc(n.Sigs, func(sig note.Signature) bool {
+			return sig.Name == v.Name() && sig.Hash == v.KeyHash()
+		})
+		if !signed {
+			return "", fmt.Errorf("%w: not signed by %s", ErrInvalidNote, v.Name())
+		}
+	}
+
+	text, ok := strings.CutPrefix(n.Text, noteText(context, ""))
+	if !ok {
+		return "", fmt.Errorf("%w: not signed for context %q", ErrInvalidNote, context)
+	}
+
+	return text, nil
+}
+
+// noteText returns the text of a note signed for context.
+func noteText(context, text string) string {
+	return fmt.Sprintf("%s\ncontext %s\n\n%s", noteHeader, strconv.Quote(context), text)
+}
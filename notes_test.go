@@ -0,0 +1,86 @@
+package sumdb_test
+
+import (
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestNotes(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	db, err := New("test.example.com", skey, WithStore(newMemStore()))
+	require.NoError(t, err)
+
+	const text = "example.com/mod v1.0.0 h1:abc=\nexample.com/mod v1.0.0/go.mod h1:def=\n"
+
+	t.Run("round trip", func(t *testing.T) {
+		msg, err := db.SignNote("go.sum export", text)
+		require.NoError(t, err)
+
+		got, err := VerifyNote(msg, "go.sum export", vkey)
+		require.NoError(t, err)
+		require.Equal(t, text, got)
+	})
+
+	t.Run("co-signers", func(t *testing.T) {
+		coSkey, coVkey, err := note.GenerateKey(nil, "release.example.com")
+		require.NoError(t, err)
+		signer, err := note.NewSigner(coSkey)
+		require.NoError(t, err)
+
+		msg, err := db.SignNote("sbom", text, signer)
+		require.NoError(t, err)
+
+		got, err := VerifyNote(msg, "sbom", vkey, coVkey)
+		require.NoError(t, err)
+		require.Equal(t, text, got)
+
+		// Every key must have signed the note.
+		msg, err = db.SignNote("sbom", text)
+		require.NoError(t, err)
+		_, err = VerifyNote(msg, "sbom", vkey, coVkey)
+		require.ErrorIs(t, err, ErrInvalidNote)
+	})
+
+	t.Run("wrong context", func(t *testing.T) {
+		msg, err := db.SignNote("sbom", text)
+		require.NoError(t, err)
+
+		_, err = VerifyNote(msg, "go.sum export", vkey)
+		require.ErrorIs(t, err, ErrInvalidNote)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, otherVkey, err := GenerateKeys("test.example.com")
+		require.NoError(t, err)
+
+		msg, err := db.SignNote("sbom", text)
+		require.NoError(t, err)
+
+		_, err = VerifyNote(msg, "sbom", otherVkey)
+		require.ErrorIs(t, err, ErrInvalidNote)
+	})
+
+	t.Run("tree heads aren't application notes", func(t *testing.T) {
+		head, err := db.Signed(t.Context())
+		require.NoError(t, err)
+
+		_, err = VerifyNote(head, "", vkey)
+		require.ErrorIs(t, err, ErrInvalidNote)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, err := db.SignNote("", text)
+		require.Error(t, err)
+
+		_, err = db.SignNote("multi\nline", text)
+		require.Error(t, err)
+
+		_, err = db.SignNote("sbom", "no trailing newline")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,84 @@
+package sumdb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/lru"
+	"github.com/pseudomuto/sumdb/internal/proxy"
+	"github.com/pseudomuto/sumdb/internal/sumdbclient"
+	"golang.org/x/mod/module"
+)
+
+// recentPseudoVersion is how old a pseudo-version's commit can be for it to be considered not published yet.
+const recentPseudoVersion = 24 * time.Hour
+
+// negativeCache remembers module versions the upstream proxy doesn't have, so that repeated lookups for them (which
+// are often junk) don't reach the upstream. See WithNegativeCache.
+type negativeCache struct {
+	expiry     *lru.Cache[string, time.Time]
+	ttl        time.Duration
+	pendingTTL time.Duration
+}
+
+func newNegativeCache(size int, ttl, pendingTTL time.Duration) *negativeCache {
+	return &negativeCache{
+		expiry:     lru.New[string, time.Time](size),
+		ttl:        ttl,
+		pendingTTL: pendingTTL,
+	}
+}
+
+// has reports whether mod is known to be missing from the upstream.
+func (c *negativeCache) has(now time.Time, mod module.Version) bool {
+	key := mod.String()
+	exp, ok := c.expiry.Get(key)
+	if !ok {
+		return false
+	}
+
+	if !now.Before(exp) {
+		c.expiry.Remove(key)
+		return false
+	}
+	return true
+}
+
+// add records that mod is missing from the upstream.
+func (c *negativeCache) add(now time.Time, mod module.Version) {
+	if ttl := c.ttlFor(now, mod.Version); ttl > 0 {
+		c.expiry.Add(mod.String(), now.Add(ttl))
+	}
+}
+
+// prune removes expired entries, returning the number removed. Expired entries are otherwise only removed when
+// they're looked up again or evicted.
+func (c *negativeCache) prune(now time.Time) int {
+	return c.expiry.RemoveFunc(func(_ string, exp time.Time) bool { return !now.Before(exp) })
+}
+
+// ttlFor returns how long a 404 for version should be cached.
+//
+// A 404 for a pseudo-version of a recent commit likely means the version hasn't been published yet (e.g. the commit
+// hasn't been pushed or the proxy hasn't seen it), so it's cached for pendingTTL. Anything else (e.g. a semver tag or
+// an old pseudo-version) will most likely never exist.
+func (c *negativeCache) ttlFor(now time.Time, version string) time.Duration {
+	if module.IsPseudoVersion(version) {
+		if t, err := module.PseudoVersionTime(version); err == nil && now.Sub(t) < recentPseudoVersion {
+			return c.pendingTTL
+		}
+	}
+	return c.ttl
+}
+
+// upstreamError handles err, an error fetching mod from the upstream. If the upstream doesn't have mod, it's added to
+// the negative cache and the returned error wraps ErrNotFound.
+func (s *SumDB) upstreamError(mod module.Version, err error) error {
+	if !errors.Is(err, proxy.ErrNotFound) && !errors.Is(err, sumdbclient.ErrNotFound) {
+		return err
+	}
+
+	s.notFound.add(s.clock.Now(), mod)
+	return fmt.Errorf("%w: %w", ErrNotFound, err)
+}
@@ -0,0 +1,98 @@
+package sumdb_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestNegativeCache(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	upstream := newFakeProxy(t)
+
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(upstream.upstream(t)),
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithNegativeCache(10, time.Hour, time.Minute),
+	)
+	require.NoError(t, err)
+
+	// lookup looks up mod and returns the number of upstream requests it made.
+	lookup := func(t *testing.T, mod module.Version) (int, error) {
+		t.Helper()
+
+		before := len(upstream.requested())
+		_, err := db.Lookup(t.Context(), mod)
+		return len(upstream.requested()) - before, err
+	}
+
+	t.Run("caches 404s for tags", func(t *testing.T) {
+		mod := module.Version{Path: "example.com/junk", Version: "v9.9.9"}
+		upstream.setMissing(mod, true)
+
+		n, err := lookup(t, mod)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, 1, n)
+
+		now = now.Add(59 * time.Minute)
+		n, err = lookup(t, mod)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Zero(t, n)
+
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/junk@v9.9.9", nil))
+		require.Equal(t, http.StatusNotFound, rec.Code)
+
+		now = now.Add(time.Minute)
+		n, err = lookup(t, mod)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, 1, n)
+	})
+
+	t.Run("caches 404s for recent pseudo-versions briefly", func(t *testing.T) {
+		mod := module.Version{
+			Path:    "example.com/internal",
+			Version: module.PseudoVersion("v0", "", now.Add(-time.Hour), "0123456789ab"),
+		}
+		upstream.setMissing(mod, true)
+
+		n, err := lookup(t, mod)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, 1, n)
+
+		n, err = lookup(t, mod)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Zero(t, n)
+
+		// Once published, the version becomes resolvable as soon as the short TTL expires.
+		upstream.setMissing(mod, false)
+		now = now.Add(time.Minute)
+		_, err = lookup(t, mod)
+		require.NoError(t, err)
+	})
+
+	t.Run("caches 404s for old pseudo-versions like tags", func(t *testing.T) {
+		mod := module.Version{
+			Path:    "example.com/internal",
+			Version: module.PseudoVersion("v0", "", now.Add(-48*time.Hour), "ba9876543210"),
+		}
+		upstream.setMissing(mod, true)
+
+		_, err := lookup(t, mod)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		now = now.Add(30 * time.Minute)
+		n, err := lookup(t, mod)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Zero(t, n)
+	})
+}
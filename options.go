@@ -1,27 +1,515 @@
 package sumdb
 
 import (
+	"crypto/x509"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"time"
+
+	"github.com/pseudomuto/sumdb/alert"
+	"github.com/pseudomuto/sumdb/internal/lru"
+	"golang.org/x/mod/sumdb/note"
 )
 
 // Option configures a SumDB instance.
 type Option func(*SumDB)
 
+// WithAdditionalSigner signs tree heads with skey as well as the server's key, so that clients trusting either
+// verifier key can verify them. This allows keys to be rotated without breaking existing clients: the server runs with
+// the new key and the old one as an additional signer (or the other way around) until every client trusts the new
+// key. Additional keys normally have the server's name, since the go command only checks signatures by keys named
+// after the checksum database. The option can be repeated; New fails if a key is invalid or given twice.
+func WithAdditionalSigner(skey string) Option {
+	return func(sd *SumDB) { sd.additionalKeys = append(sd.additionalKeys, skey) }
+}
+
+// WithAdminIdentity sets the IdentityExtractor used to authenticate admin API requests. See AdminHandler.
+func WithAdminIdentity(e IdentityExtractor) Option {
+	return func(sd *SumDB) { sd.adminIdentity = e }
+}
+
+// WithAlerter delivers integrity alerts to a: upstreams disagreeing about a module's hashes (see
+// WithSecondaryUpstream and WithUpstreamSumDB), records from checksum databases failing verification (see
+// WithTrustedSumDB), go.sum entries that don't match the log (see VerifyBatch) and records whose upstream hashes have
+// changed (see Recheck). It can be used multiple times to deliver alerts to several sinks. Alerts are delivered in the
+// background, and their delivery is counted in the sumdb_alerts_total metric.
+func WithAlerter(a alert.Alerter) Option {
+	return func(sd *SumDB) { sd.alerters = append(sd.alerters, a) }
+}
+
+// WithAppendHook calls hook within the transaction appending each record, e.g. to maintain derived indexes in the
+// same database as the log. Hooks are called in the order they're given, after the Store's own OnAppend if it
+// implements AppendHookStore. See AppendHook.
+func WithAppendHook(hook AppendHook) Option {
+	return func(sd *SumDB) { sd.appendHooks = append(sd.appendHooks, hook) }
+}
+
+// WithAppendLimit caps the number of records appended to the tree in any window of length per, protecting downstream
+// mirrors and publishing pipelines from unbounded bursts (e.g. during mass imports). Appends over the limit are queued
+// until they fit in the window; queued lookups give up when their context is done. Disabled by default.
+func WithAppendLimit(n int, per time.Duration) Option {
+	return func(sd *SumDB) {
+		sd.appendLimitN = n
+		sd.appendLimitPer = per
+	}
+}
+
+// WithAuditKey sets a dedicated note signer key for signing audit log entries. By default, entries are signed with
+// the server's key. Setting it requires admin operations to be audited, so the Store must implement AuditStore; New
+// returns ErrAuditUnsupported otherwise.
+func WithAuditKey(skey string) Option {
+	return func(sd *SumDB) { sd.auditKey = skey }
+}
+
+// WithClock sets the Clock used for all time-dependent behaviour. Waits (e.g. retry backoffs and rate limits) use it
+// too when it implements Sleeper. Defaults to the system clock.
+func WithClock(c Clock) Option {
+	return func(sd *SumDB) { sd.clock = c }
+}
+
+// WithCORS allows browsers to call Handler and APIHandler from the given origins (e.g. "https://dash.example.com"),
+// so that browser-based dashboards and verifiers can use the sumdb directly. Use "*" to allow any origin. CORS is
+// disabled by default.
+func WithCORS(origins ...string) Option {
+	return func(sd *SumDB) { sd.corsOrigins = origins }
+}
+
+// WithDenyAfter refuses to create records for versions of modules matching pattern that were published (according to
+// the proxy's .info time) after cutoff. This supports "freeze windows" before releases, during which no new
+// third-party code may enter the organization. Existing records are still served.
+//
+// pattern is a comma-separated list of glob patterns matched against module path prefixes, using the same syntax as
+// GOPRIVATE (e.g. "github.com/*,golang.org/x"). It can be used multiple times; when several patterns match a module,
+// the earliest cutoff applies.
+func WithDenyAfter(pattern string, cutoff time.Time) Option {
+	return func(sd *SumDB) { sd.denyAfter = append(sd.denyAfter, denyAfterRule{pattern: pattern, cutoff: cutoff}) }
+}
+
+// WithDetachedLookups detaches the fetches made for cold lookups from the context of the lookup that started them,
+// bounding them with timeout instead. Concurrent lookups for the same module version share a single fetch, so by
+// default one impatient client disconnecting fails everyone else's lookup too. With this option, lookups whose
+// context is done stop waiting, but the fetch carries on for the others until it completes or timeout elapses.
+func WithDetachedLookups(timeout time.Duration) Option {
+	return func(sd *SumDB) { sd.detachedLookupTimeout = timeout }
+}
+
+// WithDialer sets the function used to dial the upstream proxies, e.g. to route connections through a specific egress
+// path. Addresses pinned with WithUpstreamAddrs are dialed with it too.
+//
+// The dialer replaces the one of the HTTP client's transport (see WithHTTPClient), which must be an *http.Transport.
+func WithDialer(fn DialFunc) Option {
+	return func(sd *SumDB) { sd.dialer = fn }
+}
+
+// WithFetchWorkers sets the number of modules fetched concurrently from upstream when adding records in bulk (see
+// AddRecords) or looking them up with PriorityBatch (see WithPriority). Defaults to 8.
+func WithFetchWorkers(n int) Option {
+	return func(sd *SumDB) { sd.fetchWorkers = n }
+}
+
 // WithHTTPClient sets the client used to communicate with the proxy.
 func WithHTTPClient(c *http.Client) Option {
 	return func(sd *SumDB) { sd.http = c }
 }
 
+// WithIngestRoutes routes the creation of records for the modules matching each route's pattern to its module proxy
+// or trusted checksum database, so that e.g. public modules are trusted from sum.golang.org while private ones are
+// hashed from an internal proxy. Routes are matched in order, and modules matching none of them use the default
+// route: WithTrustedSumDB when set, or WithUpstream otherwise. New returns ErrInvalidIngestRoute for invalid routes.
+//
+// It can be used multiple times; routes are matched in the order they were added.
+func WithIngestRoutes(routes ...IngestRoute) Option {
+	return func(sd *SumDB) { sd.ingestRoutes = append(sd.ingestRoutes, routes...) }
+}
+
+// WithLocker takes l before appending records, so that SumDB instances sharing a Store (e.g. replicas behind a load
+// balancer) append one at a time rather than racing on the tree size. Lookups that find their record was appended by
+// another instance while they waited for l return it instead of appending a duplicate. See postgres.Store.Locker and
+// the redislock package for implementations.
+func WithLocker(l Locker) Option {
+	return func(sd *SumDB) { sd.locker = l }
+}
+
+// WithLogger logs the server's events to l: records added (at info level), changes of the tree size, including those
+// made by other servers sharing the store (info), failed upstream fetches (warn, or debug for module versions the
+// upstream doesn't have) and signed tree heads and notes (debug, or error when signing fails). Nothing is logged by
+// default.
+func WithLogger(l *slog.Logger) Option {
+	return func(sd *SumDB) {
+		if l != nil {
+			sd.logger = l
+		}
+	}
+}
+
+// WithLookupBudget bounds how long /lookup requests wait for a record to be created. Cold lookups that take longer
+// (e.g. fetching a large module zip from a slow upstream) are answered with 202 Accepted and a Retry-After header,
+// while the record continues to be created in the background and is served when the client retries. This keeps
+// clients and intermediate proxies from timing out on slow upstreams. Disabled by default.
+//
+// Only custom clients that retry on 202 Accepted benefit from it. The go command doesn't: it fails the download of a
+// module whose lookup is answered with 202 Accepted, so don't set a budget on servers used by the go command.
+func WithLookupBudget(d time.Duration) Option {
+	return func(sd *SumDB) { sd.lookupBudget = d }
+}
+
+// WithLookupCache caches the formatted records served by /lookup for up to size module versions.
+//
+// Records never change once created, so cached lookups only need to produce the current signed tree head, avoiding
+// store round trips for popular modules. Disabled by default.
+func WithLookupCache(size int) Option {
+	return func(sd *SumDB) { sd.lookupCache = lru.New[string, lookupEntry](size) }
+}
+
+// WithMaintenanceJob adds a job for RunMaintenance to run at least interval apart, e.g. pruning an external cache.
+// New returns ErrInvalidMaintenanceJob if the job has no name, interval or Run function, or if another job (including
+// the store's) has the same name.
+func WithMaintenanceJob(job MaintenanceJob) Option {
+	return func(sd *SumDB) { sd.maintenanceJobs = append(sd.maintenanceJobs, job) }
+}
+
+// WithMaintenanceWindow restricts RunMaintenance to the given daily window, in UTC and of the form "HH:MM-HH:MM" (e.g.
+// "02:00-04:00"). Windows ending before they start span midnight. The option can be repeated to allow several windows.
+// Without any, maintenance jobs run whenever they're due. New returns ErrInvalidMaintenanceWindow for malformed
+// windows.
+func WithMaintenanceWindow(window string) Option {
+	return func(sd *SumDB) { sd.maintenanceWindows = append(sd.maintenanceWindows, window) }
+}
+
+// WithMaxRecordSize sets the size limit of the data of appended records, which defaults to DefaultMaxRecordSize.
+// Records over the limit are refused with ErrRecordTooLarge. Records of typical modules are a couple hundred bytes.
+func WithMaxRecordSize(n int) Option {
+	return func(sd *SumDB) {
+		if n > 0 {
+			sd.maxRecordSize = n
+		}
+	}
+}
+
+// WithNegativeCache caches upstream 404s for up to size module versions, so that repeated lookups for versions that
+// don't exist stay cheap without the cache growing unbounded.
+//
+// Versions that will most likely never exist (e.g. semver tags) are cached for ttl. Pseudo-versions of commits made in
+// the last day may simply not have been published yet, so they're cached for pendingTTL, allowing them to become
+// resolvable quickly. A TTL of 0 disables caching for that kind of version. Disabled by default.
+func WithNegativeCache(size int, ttl, pendingTTL time.Duration) Option {
+	return func(sd *SumDB) { sd.notFound = newNegativeCache(size, ttl, pendingTTL) }
+}
+
+// WithPathVerifier runs v before creating the first record for a module path, refusing records for paths whose
+// ownership isn't verified. This keeps typosquatted, internal-looking paths out of the trusted log. Stores that
+// implement PathStore only verify first-seen paths; otherwise every new version is verified. Records added by
+// ImportTiles are authenticated against another log, so they aren't verified.
+func WithPathVerifier(v PathVerifier) Option {
+	return func(sd *SumDB) { sd.pathVerifier = v }
+}
+
+// WithProxyRetry retries requests to the upstream proxies that fail with a network error, 429 Too Many Requests or a
+// 5xx response, making up to attempts attempts in all. Retries wait for an exponential backoff starting at base and
+// capped at max, with jitter, or for as long as the upstream's Retry-After header asks; responses asking to wait longer
+// than max aren't retried. Retries stop when the lookup's context is done, and a fetch that only succeeds after
+// retrying counts as a single fetch for WithUpstreamFailback and WithUpstreamRateLimit. Disabled by default.
+func WithProxyRetry(attempts int, base, max time.Duration) Option {
+	return func(sd *SumDB) {
+		sd.proxyRetryAttempts = attempts
+		sd.proxyRetryBase = base
+		sd.proxyRetryMax = max
+	}
+}
+
+// WithPublisher delivers an AppendEvent to p for every record appended to the tree, for event-driven pipelines
+// built on Kafka, NATS and the like. It can be used multiple times to fan events out to several sinks; each one
+// receives every event.
+//
+// Events are written to the store's outbox alongside their records and delivered by RunPublisher, which must be
+// started separately. The Store must implement OutboxStore; New returns ErrOutboxUnsupported otherwise. Stores should
+// also implement TxStore, so that events are only committed with their records.
+func WithPublisher(p Publisher) Option {
+	return func(sd *SumDB) { sd.publishers = append(sd.publishers, p) }
+}
+
+// WithPublishTimes fetches the .info of every version hashed from a module proxy, persisting its publish time as the
+// record's Published time, so that records can be reported on by publish date rather than by when they were added
+// (see PublishedStore). Publish times are otherwise only known for versions whose .info is fetched for a policy (see
+// WithDenyAfter). Records from checksum databases (see WithTrustedSumDB) have no publish times.
+func WithPublishTimes() Option {
+	return func(sd *SumDB) { sd.publishTimes = true }
+}
+
+// WithReadLimits lowers the most records returned by a single ReadRecords call (256 by default, the width of a full
+// tile) and the most bytes served per data tile (1MB by default), for deployments that must bound the memory and
+// store load of each request. Values of 0 keep the defaults, and the record limit can't be raised above 256.
+//
+// Reads over the limits return ErrReadLimitExceeded and are answered with 400 Bad Request. The go command only needs
+// hash tiles and lookups, but mirrors and auditors reading full data tiles are refused if the record limit is lowered.
+func WithReadLimits(maxRecords, maxDataTileSize int) Option {
+	return func(sd *SumDB) {
+		if maxRecords > 0 {
+			sd.maxReadRecords = int64(min(maxRecords, maxTileWidth))
+		}
+		if maxDataTileSize > 0 {
+			sd.maxDataTileSize = maxDataTileSize
+		}
+	}
+}
+
+// WithRecheckSampling adds a built-in maintenance job, "recheck", rechecking n records picked at random from the log
+// every interval (see Recheck), so the log's content is continuously validated against the upstream rather than only
+// when records are appended. Rechecked records are counted in the sumdb_rechecks_total metric, and the share of the log
+// rechecked since the server started in sumdb_recheck_coverage_ratio.
+func WithRecheckSampling(n int, interval time.Duration) Option {
+	return func(sd *SumDB) {
+		sd.recheckSampleSize = n
+		sd.recheckInterval = interval
+	}
+}
+
+// WithRecordFilter keeps a Bloom filter over the module versions with records, sized for n records with a false
+// positive rate of p, so that lookups for module versions without one (which are fetched upstream) skip the store's
+// "does a record exist?" query. The filter is consulted once LoadRecordFilter has loaded the existing records into it,
+// and the checks it answers are counted in the sumdb_record_filter_checks_total metric, and its estimated false
+// positive rate, which rises once it holds more than n records, in sumdb_record_filter_false_positive_ratio.
+//
+// Records appended by other servers sharing the store aren't in the filter, so lookups for them fall back to the
+// store only once they're fetched; they're added when the append finds them.
+func WithRecordFilter(n int64, p float64) Option {
+	return func(sd *SumDB) { sd.recordFilter = newRecordFilter(n, p) }
+}
+
+// WithRecordPipeline registers plugins taking part in adding records for module versions fetched from the upstreams.
+// Each stage calls the plugins in the order they're registered, across calls. See RecordPipeline.
+func WithRecordPipeline(plugins ...RecordPipeline) Option {
+	return func(sd *SumDB) { sd.pipeline = append(sd.pipeline, plugins...) }
+}
+
+// WithReplayRecorder enables replay recording. Every cold lookup (one that fetches from the upstream proxy) is captured
+// in a ReplayBundle which is passed to fn once the lookup completes, whether it succeeded or not.
+//
+// Bundles can be re-executed with Replay (or `sumdb replay`) to reproduce ingestion bugs deterministically. Recording
+// buffers the full proxy responses in memory, so this is intended for debugging rather than normal operation.
+func WithReplayRecorder(fn func(*ReplayBundle)) Option {
+	return func(sd *SumDB) { sd.onReplay = fn }
+}
+
+// WithResolver sets the resolver used to look up the upstream proxies' hosts, e.g. to query a specific DNS server
+// when the local resolver's answers for proxy.golang.org are intercepted. It's ignored when WithDialer is used.
+//
+// The resolver replaces the one of the HTTP client's transport (see WithHTTPClient), which must be an *http.Transport.
+func WithResolver(r *net.Resolver) Option {
+	return func(sd *SumDB) { sd.resolver = r }
+}
+
+// WithSecondaryUpstream fetches every new module version from a second, independent proxy (e.g. an internal Athens
+// alongside proxy.golang.org) and only creates its record when both upstreams compute the same hashes. Versions the
+// upstreams disagree on are quarantined (see Quarantined) and lookups for them fail with ErrUpstreamMismatch.
+func WithSecondaryUpstream(u *url.URL) Option {
+	return func(sd *SumDB) {
+		sd.secondaryUpstream = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	}
+}
+
+// WithSignedResponses signs the responses of APIHandler and AdminHandler that are JSON (records, verification
+// reports, status and so on) with the server's key, so that automated consumers can check they weren't altered, even
+// when fetched through caches or other intermediaries. The detached signature is sent in SignatureHeader, and each
+// event of the record stream carries its own in a signature field. See VerifyResponse.
+func WithSignedResponses() Option {
+	return func(sd *SumDB) { sd.signedResponses = true }
+}
+
+// WithSigner signs tree heads, notes and (unless WithAuditKey is set) audit entries with s instead of the key given to
+// New, so that the private key can be kept in a KMS or HSM rather than in memory or configuration (see the kms
+// package). s must also have a VerifierKey() string method returning its Ed25519 verifier key, which clients are told
+// to trust; New fails if it doesn't, or if the key doesn't match the signer.
+func WithSigner(s note.Signer) Option {
+	return func(sd *SumDB) { sd.keySigner = s }
+}
+
+// WithSpool spools module zips downloaded during cold lookups to dir (the system's temporary directory if empty),
+// holding at most maxSize bytes across concurrent downloads (unlimited if maxSize <= 0), so heavy cold traffic can't
+// fill the disk of the host. Lookups that would exceed the quota fail with ErrSpoolFull (503 Service Unavailable) and
+// can be retried. Spool files left behind in dir by a previous process are evicted when the SumDB is created, so dir
+// must not be shared with other servers.
+func WithSpool(dir string, maxSize int64) Option {
+	return func(sd *SumDB) {
+		sd.spoolDir = dir
+		sd.spoolMaxSize = maxSize
+	}
+}
+
+// WithSTHMaxStaleness allows signed tree heads to be served from cache for up to d after they were signed (or last
+// found to be current), trading freshness for throughput. By default (d = 0) every request reads the tree size, and
+// the cached tree head is only served if records haven't been appended since it was signed.
+//
+// Lookups that return a record never receive a tree head that doesn't include it, so a cached head is only served
+// for a lookup if it covers the requested record.
+func WithSTHMaxStaleness(d time.Duration) Option {
+	return func(sd *SumDB) { sd.sthMaxStaleness = d }
+}
+
+// WithSTHRefreshInterval sets how often RunSTHRefresher signs the tree head for the current tree, so that requests
+// find it cached instead of computing the tree hash after each append.
+func WithSTHRefreshInterval(d time.Duration) Option {
+	return func(sd *SumDB) { sd.sthRefreshInterval = d }
+}
+
 // WithStore sets the Store for handling persistence of the tree.
 func WithStore(s Store) Option {
 	return func(sd *SumDB) { sd.store = s }
 }
 
+// WithTileCache caches the tiles served by Handler and TileHandler in memory, up to size bytes, so that clients
+// fetching the same tiles don't each read them from the store. Tiles never change once they can be served, so cached
+// tiles are only evicted to make room, apart from partial tiles, which are evicted when a wider tile supersedes them.
+// Requests are counted in the sumdb_tile_cache_requests_total metric, and the size of the cache in
+// sumdb_tile_cache_bytes. Disabled by default.
+func WithTileCache(size int) Option {
+	return func(sd *SumDB) { sd.tileCache = newTileCache(size) }
+}
+
+// WithTracerProvider reports spans for lookups (sumdb.Lookup), and within them for the store queries, upstream
+// requests (proxy.GoMod and proxy.Zip, with the zip's hashing in proxy.hashZip), appends (sumdb.append) and tree
+// operations (tree.*) they're made of, as well as for signing tree heads (sumdb.SignTreeHead), so that slow lookups can
+// be attributed. Spans are started with tp.Tracer("github.com/pseudomuto/sumdb") as children of the span in the
+// caller's context, if any. Disabled by default.
+func WithTracerProvider(tp TracerProvider) Option {
+	return func(sd *SumDB) { sd.tracer = tp.Tracer(tracerName) }
+}
+
+// WithTrustedSumDB satisfies lookup misses from the checksum database at u (e.g. https://sum.golang.org) rather than by
+// hashing the module from the upstream proxy. Its records are only trusted once they're verified to be included in its
+// signed tree, using the verifier key vkey, and its trees are checked to be consistent with each other. The records
+// are then appended to the local log and signed with the local key as usual.
+//
+// This is cheaper than downloading and hashing module zips, and for public modules it means agreeing with the hashes
+// every Go client checks against. Lookups fail with ErrUpstreamVerification when verification fails. Use
+// WithIngestRoutes to hash private modules from a proxy instead.
+func WithTrustedSumDB(vkey string, u *url.URL) Option {
+	return func(sd *SumDB) {
+		sd.trustedVKey = vkey
+		sd.trustedSumDB = baseURL(u)
+	}
+}
+
+// WithTyposquatDetector compares the path of every module seen for the first time with the popular paths in the log
+// (those with at least minVersions versions), warning about paths within one typo (an insertion, deletion,
+// substitution or transposition) of a popular path or only differing by lookalike characters (e.g. "rn" and "m", or
+// "1" and "l"). Suspicious records are still appended, but they're annotated with the "typosquat" key when the Store
+// implements AnnotationStore, and fn, if not nil, is called with a TyposquatWarning once they're committed.
+//
+// The paths in the log are indexed on the first append, which reads every record. Records added by ImportTiles are
+// indexed but not checked.
+func WithTyposquatDetector(minVersions int, fn func(*TyposquatWarning)) Option {
+	return func(sd *SumDB) { sd.typosquat = newTyposquatDetector(minVersions, fn) }
+}
+
 // WithUpstream sets the upstream proxy to query when no records are found.
 func WithUpstream(u *url.URL) Option {
 	return func(sd *SumDB) {
 		sd.upstream = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
 	}
 }
+
+// WithUpstreamAddrs pins host (e.g. "proxy.golang.org") to the given IP addresses, so that connections to it skip DNS
+// altogether. Addresses are tried in order until a connection succeeds. TLS certificates are still verified against
+// host. New returns ErrInvalidPinnedAddr if any of addrs isn't an IP address.
+//
+// It can be used multiple times to pin several hosts, e.g. those of the primary and secondary upstreams.
+func WithUpstreamAddrs(host string, addrs ...string) Option {
+	return func(sd *SumDB) {
+		if sd.pinnedAddrs == nil {
+			sd.pinnedAddrs = make(map[string][]string)
+		}
+		sd.pinnedAddrs[host] = append(sd.pinnedAddrs[host], addrs...)
+	}
+}
+
+// WithUpstreamFailback marks upstreams down after the given number of consecutive failed fetches (errors other than
+// a module not being found, e.g. timeouts and 5xx responses), until a fetch from them succeeds again. Cold lookups of
+// modules fetched from an upstream that's down fail fast with ErrUpstreamUnavailable, answered by Handler with 503
+// Service Unavailable and a Retry-After header, rather than with whatever error reaching it would have produced. One
+// lookup is let through every retryAfter to probe whether the upstream is back.
+//
+// Rechecks (see Recheck) of records fetched while the upstream was up fall back to the hashes computed then, in
+// receipts marked with the time they were computed. Upstreams that are down are reported by Health and HealthHandler.
+// Disabled by default.
+func WithUpstreamFailback(failures int, retryAfter time.Duration) Option {
+	return func(sd *SumDB) { sd.failback = newUpstreamFailback(failures, retryAfter) }
+}
+
+// WithUpstreamIdentity sends upstream requests made to fetch modules on behalf of clients with the credentials
+// derived from the clients' requests by u (see ForwardHeaders, ForwardIdentity and TokenExchange), so that the
+// upstream's audit logs attribute downloads to the clients. Lookups served by Handler and LookupHandler are made on
+// behalf of their clients, and others on behalf of the client set with WithRequester, if any. Concurrent lookups of a
+// module version only share a fetch when u derives the same credentials for their clients.
+func WithUpstreamIdentity(u UpstreamIdentity) Option {
+	return func(sd *SumDB) { sd.upstreamIdentity = u }
+}
+
+// WithUpstreamRateLimit caps the rate at which modules are fetched from the upstreams at rps per second, allowing
+// bursts of up to burst fetches, so that a burst of lookups for unknown modules can't get the server throttled by a
+// public proxy such as proxy.golang.org. Each fetch is counted once, though it takes a few requests to the upstream.
+// Fetches over the limit are queued, in order, until they fit; queued lookups give up when their context is done, and
+// lookups of existing records are never limited. The limit is shared by every upstream. Disabled by default.
+func WithUpstreamRateLimit(rps float64, burst int) Option {
+	return func(sd *SumDB) {
+		sd.upstreamLimitRate = rps
+		sd.upstreamLimitBurst = burst
+	}
+}
+
+// WithUpstreamRootCAs sets the root certificates trusted for connections to the upstream proxies, replacing the
+// system roots. Trusting only the upstream's CAs keeps a compromised corporate MITM proxy, whose CA is typically
+// installed system wide, from impersonating the upstream.
+//
+// It replaces the root CAs of the HTTP client's transport (see WithHTTPClient), which must be an *http.Transport.
+func WithUpstreamRootCAs(pool *x509.CertPool) Option {
+	return func(sd *SumDB) { sd.upstreamRootCAs = pool }
+}
+
+// WithUpstreamSPKIPins requires the certificate chains presented by the upstream proxies to include a public key
+// matching one of pins, on top of the usual certificate verification. Pins are base64-encoded SHA-256 digests of
+// DER-encoded SubjectPublicKeyInfo (see SPKIPin), as produced by:
+//
+//	openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+//
+// Lookups fail with ErrSPKIPinMismatch when no key matches. Include backup pins (e.g. of the issuing CA) so the
+// upstream can rotate its keys. New returns ErrInvalidSPKIPin if any of pins is malformed.
+func WithUpstreamSPKIPins(pins ...string) Option {
+	return func(sd *SumDB) { sd.spkiPins = append(sd.spkiPins, pins...) }
+}
+
+// WithUpstreamSumDB checks every record hashed from the upstream proxy (see WithUpstream) against the checksum
+// database at u (e.g. https://sum.golang.org), verified with the verifier key vkey, before signing it, to detect a
+// compromised or misbehaving proxy. Versions whose hashes differ from the database's record are quarantined (see
+// Quarantined) and lookups for them fail with ErrUpstreamMismatch. Versions the database doesn't know about are signed
+// as usual, and lookups fail with ErrUpstreamVerification when its records can't be verified.
+//
+// Module paths are disclosed to the checksum database, so modules routed to other proxies with WithIngestRoutes
+// (typically private ones) aren't checked.
+func WithUpstreamSumDB(vkey string, u *url.URL) Option {
+	return func(sd *SumDB) {
+		sd.upstreamSumDBKey = vkey
+		sd.upstreamSumDBURL = baseURL(u)
+	}
+}
+
+// WithVerifyWorkers sets the number of workers used to authenticate records against the signed tree head when
+// ingesting records in bulk (see ImportTiles). Records are still appended in order. Defaults to GOMAXPROCS.
+func WithVerifyWorkers(n int) Option {
+	return func(sd *SumDB) { sd.verifyWorkers = n }
+}
+
+// WithZipRangeRequests downloads module zips in chunks of chunkSize bytes using up to workers concurrent range
+// requests, when the upstream supports them, cutting the time taken by cold lookups for large modules over
+// high-latency links. Chunks are assembled in a temporary file and hashed once the zip is complete. Upstreams that
+// don't support range requests are sent a single request for the whole zip. Lookups recorded for replays (see
+// WithReplayRecorder) also fetch zips whole, since recordings don't capture the requests' headers. Disabled by default.
+func WithZipRangeRequests(chunkSize int64, workers int) Option {
+	return func(sd *SumDB) {
+		sd.zipRangeChunkSize = chunkSize
+		sd.zipRangeWorkers = workers
+	}
+}
@@ -0,0 +1,63 @@
+package sumdb
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/mod/module"
+)
+
+type (
+	// PathVerifier verifies that a module path belongs to whoever is publishing it (e.g. by checking its go-import meta
+	// tags, asking a CODEOWNERS service or matching an allow-listed organization) before its first record is created.
+	// See WithPathVerifier.
+	PathVerifier interface {
+		// VerifyPath reports whether the ownership of path is verified. An error means verification couldn't be
+		// completed, and the record isn't created.
+		VerifyPath(ctx context.Context, path string) (bool, error)
+	}
+
+	// PathVerifierFunc adapts a function to the PathVerifier interface.
+	PathVerifierFunc func(ctx context.Context, path string) (bool, error)
+)
+
+// VerifyPath calls f(ctx, path).
+func (f PathVerifierFunc) VerifyPath(ctx context.Context, path string) (bool, error) {
+	return f(ctx, path)
+}
+
+// AllowPathPatterns returns a PathVerifier that only verifies paths matching patterns, a comma-separated list of glob
+// patterns matched against module path prefixes using the same syntax as GOPRIVATE (e.g. "github.com/acme/*").
+func AllowPathPatterns(patterns string) PathVerifier {
+	return PathVerifierFunc(func(_ context.Context, path string) (bool, error) {
+		return module.MatchPrefixPatterns(patterns, path), nil
+	})
+}
+
+// verifyPath returns an error wrapping ErrPolicyDenied if mod's path hasn't been seen before and its ownership can't be
+// verified. Without a PathStore, every new version is verified.
+func (s *SumDB) verifyPath(ctx context.Context, mod module.Version) error {
+	if s.pathVerifier == nil {
+		return nil
+	}
+
+	if ps, ok := s.store.(PathStore); ok {
+		seen, err := ps.HasPath(ctx, mod.Path)
+		if err != nil {
+			return fmt.Errorf("failed to look up path: %s, %w", mod.Path, err)
+		}
+		if seen {
+			return nil
+		}
+	}
+
+	ok, err := s.pathVerifier.VerifyPath(ctx, mod.Path)
+	if err != nil {
+		return fmt.Errorf("failed to verify ownership of %s: %w", mod.Path, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: ownership of %s could not be verified", ErrPolicyDenied, mod.Path)
+	}
+
+	return nil
+}
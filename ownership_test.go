@@ -0,0 +1,108 @@
+package sumdb_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+// pathStore is a memStore that implements PathStore.
+type pathStore struct {
+	*memStore
+}
+
+func (s pathStore) HasPath(_ context.Context, path string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.ContainsFunc(s.records, func(r *Record) bool { return r.Path == path }), nil
+}
+
+func TestPathVerifier(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	var (
+		mu       sync.Mutex
+		verified []string
+	)
+	verifier := PathVerifierFunc(func(ctx context.Context, path string) (bool, error) {
+		mu.Lock()
+		verified = append(verified, path)
+		mu.Unlock()
+		return AllowPathPatterns("example.com/acme/*").VerifyPath(ctx, path)
+	})
+
+	newDB := func(t *testing.T, store Store) *SumDB {
+		t.Helper()
+		mu.Lock()
+		verified = nil
+		mu.Unlock()
+
+		db, err := New("test.example.com", skey,
+			WithStore(store),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithPathVerifier(verifier),
+		)
+		require.NoError(t, err)
+		return db
+	}
+
+	t.Run("only verifies first-seen paths", func(t *testing.T) {
+		db := newDB(t, pathStore{newMemStore()})
+
+		for _, v := range []string{"v1.0.0", "v1.1.0"} {
+			_, err := db.Lookup(t.Context(), module.Version{Path: "example.com/acme/mod", Version: v})
+			require.NoError(t, err)
+		}
+		require.Equal(t, []string{"example.com/acme/mod"}, verified)
+	})
+
+	t.Run("verifies every new version without a PathStore", func(t *testing.T) {
+		db := newDB(t, newMemStore())
+
+		for _, v := range []string{"v1.0.0", "v1.1.0"} {
+			_, err := db.Lookup(t.Context(), module.Version{Path: "example.com/acme/mod", Version: v})
+			require.NoError(t, err)
+		}
+		require.Len(t, verified, 2)
+	})
+
+	t.Run("refuses unverified paths", func(t *testing.T) {
+		store := pathStore{newMemStore()}
+		db := newDB(t, store)
+
+		_, err := db.Lookup(t.Context(), module.Version{Path: "example.com/acrne/mod", Version: "v1.0.0"})
+		require.ErrorIs(t, err, ErrPolicyDenied)
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Zero(t, size)
+
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/acrne/mod@v1.0.0", nil))
+		require.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("verification failures", func(t *testing.T) {
+		boom := errors.New("boom")
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithPathVerifier(PathVerifierFunc(func(context.Context, string) (bool, error) { return false, boom })),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/acme/mod", Version: "v1.0.0"})
+		require.ErrorIs(t, err, boom)
+		require.NotErrorIs(t, err, ErrPolicyDenied)
+	})
+}
@@ -0,0 +1,130 @@
+package sumdb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/pseudomuto/sumdb/internal/tracing"
+	"golang.org/x/mod/module"
+)
+
+// Record pipeline stages, as reported in errors, logs and spans.
+const (
+	stagePreFetch   = "PreFetch"
+	stagePostFetch  = "PostFetch"
+	stagePreAppend  = "PreAppend"
+	stagePostAppend = "PostAppend"
+)
+
+type (
+	// RecordPipeline is a plugin taking part in adding records for module versions fetched from the upstreams, by
+	// Lookup and AddRecords, so that policies, enrichment, cross-checks and notifications are written against a single
+	// interface. Plugins are registered with WithRecordPipeline and each stage calls them in the order they were
+	// registered, after the server's built-in checks for that stage. Embed NopPipeline to implement only some stages.
+	//
+	// Records imported from other logs (see ImportTiles and ImportGoSum) aren't fetched, so they don't go through the
+	// pipeline.
+	RecordPipeline interface {
+		// Name identifies the plugin in errors, logs and spans.
+		Name() string
+
+		// PreFetch is called before mod is fetched from its upstream, once the built-in policies (see WithDenyAfter
+		// and WithPathVerifier) have allowed it. Returning an error rejects the lookup without fetching mod; wrap
+		// ErrPolicyDenied to have it answered as a policy denial.
+		PreFetch(ctx context.Context, mod module.Version) error
+
+		// PostFetch is called with the record fetched for a module version, once it has passed the built-in checks
+		// (see WithMaxRecordSize, WithSecondaryUpstream and WithUpstreamSumDB). Returning an error rejects it.
+		// Plugins may enrich the record by setting rec.Annotations (e.g. with its license or known vulnerabilities),
+		// but must not modify its data.
+		PostFetch(ctx context.Context, rec *Record) error
+
+		// PreAppend is called within the transaction appending rec, before it's added to tx. Returning an error aborts
+		// the append. Appends are serialized, so it should be quick, and must only use tx to access the store.
+		PreAppend(ctx context.Context, tx Store, rec *Record) error
+
+		// PostAppend is called once rec has been appended with the given ID, e.g. to send notifications. The record
+		// is in the log by then, so errors are only logged.
+		PostAppend(ctx context.Context, id int64, rec *Record) error
+	}
+
+	// NopPipeline implements every stage of RecordPipeline by doing nothing, for plugins to embed.
+	NopPipeline struct{}
+)
+
+func (NopPipeline) PreFetch(context.Context, module.Version) error   { return nil }
+func (NopPipeline) PostFetch(context.Context, *Record) error         { return nil }
+func (NopPipeline) PreAppend(context.Context, Store, *Record) error  { return nil }
+func (NopPipeline) PostAppend(context.Context, int64, *Record) error { return nil }
+
+// runPipeline calls fn with each plugin registered with WithRecordPipeline, in order, reporting each call as a span.
+// It stops at the first error, which it returns wrapped with the plugin and stage that failed.
+func (s *SumDB) runPipeline(
+	ctx context.Context, stage string, mod module.Version, fn func(context.Context, RecordPipeline) error,
+) error {
+	for _, p := range s.pipeline {
+		pctx, span := tracing.Start(ctx, "pipeline."+stage, tracing.String("pipeline.plugin", p.Name()))
+		err := fn(pctx, p)
+		tracing.End(span, err)
+		if err != nil {
+			return fmt.Errorf("record pipeline %s failed at %s: %s, %w", p.Name(), stage, mod, err)
+		}
+	}
+	return nil
+}
+
+// preFetch runs the PreFetch stage of the record pipeline for mod.
+func (s *SumDB) preFetch(ctx context.Context, mod module.Version) error {
+	return s.runPipeline(ctx, stagePreFetch, mod, func(ctx context.Context, p RecordPipeline) error {
+		return p.PreFetch(ctx, mod)
+	})
+}
+
+// postFetch runs the PostFetch stage of the record pipeline for rec, the record fetched for mod.
+func (s *SumDB) postFetch(ctx context.Context, mod module.Version, rec *Record) error {
+	return s.runPipeline(ctx, stagePostFetch, mod, func(ctx context.Context, p RecordPipeline) error {
+		return p.PostFetch(ctx, rec)
+	})
+}
+
+// preAppend runs the PreAppend stage of the record pipeline for rec, within the transaction tx appending it.
+func (s *SumDB) preAppend(ctx context.Context, tx Store, rec *Record) error {
+	mod := module.Version{Path: rec.Path, Version: rec.Version}
+	return s.runPipeline(ctx, stagePreAppend, mod, func(ctx context.Context, p RecordPipeline) error {
+		return p.PreAppend(ctx, tx, rec)
+	})
+}
+
+// postAppend runs the PostAppend stage of the record pipeline for rec, appended with the given ID. Every plugin is
+// called, and failures are logged.
+func (s *SumDB) postAppend(ctx context.Context, id int64, rec *Record) {
+	for _, p := range s.pipeline {
+		pctx, span := tracing.Start(ctx, "pipeline."+stagePostAppend, tracing.String("pipeline.plugin", p.Name()))
+		err := p.PostAppend(pctx, id, rec)
+		tracing.End(span, err)
+		if err != nil {
+			s.logger.LogAttrs(ctx, slog.LevelWarn, "record pipeline failed",
+				slog.String("plugin", p.Name()), slog.String("stage", stagePostAppend),
+				slog.String("module", rec.Path), slog.String("version", rec.Version), slog.Int64("id", id),
+				slog.Any("error", err))
+		}
+	}
+}
+
+// storeAnnotations stores the annotations set on rec by the record pipeline (see RecordPipeline.PostFetch) for the
+// record with the given ID, within the transaction tx appending it. They're dropped if tx doesn't implement
+// AnnotationStore.
+func storeAnnotations(ctx context.Context, tx Store, id int64, rec *Record) error {
+	as, ok := tx.(AnnotationStore)
+	if !ok {
+		return nil
+	}
+
+	for key, value := range rec.Annotations {
+		if err := as.SetAnnotation(ctx, id, key, value); err != nil {
+			return fmt.Errorf("failed to set annotation: %d, %s, %w", id, key, err)
+		}
+	}
+	return nil
+}
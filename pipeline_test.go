@@ -0,0 +1,177 @@
+package sumdb_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+// recordingPlugin is a RecordPipeline plugin recording the stages it's called at in a shared log, and failing the
+// stages set in fail.
+type recordingPlugin struct {
+	NopPipeline
+
+	name string
+	fail map[string]error
+
+	mu    *sync.Mutex
+	calls *[]string
+}
+
+func (p *recordingPlugin) Name() string { return p.name }
+
+func (p *recordingPlugin) record(stage, mod string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*p.calls = append(*p.calls, fmt.Sprintf("%s %s %s", p.name, stage, mod))
+	return p.fail[stage]
+}
+
+func (p *recordingPlugin) PreFetch(_ context.Context, mod module.Version) error {
+	return p.record("PreFetch", mod.String())
+}
+
+func (p *recordingPlugin) PostFetch(_ context.Context, rec *Record) error {
+	if rec.Annotations == nil {
+		rec.Annotations = make(map[string]string)
+	}
+	rec.Annotations[p.name] = "checked"
+	return p.record("PostFetch", rec.Path+"@"+rec.Version)
+}
+
+func (p *recordingPlugin) PreAppend(_ context.Context, _ Store, rec *Record) error {
+	return p.record("PreAppend", rec.Path+"@"+rec.Version)
+}
+
+func (p *recordingPlugin) PostAppend(_ context.Context, id int64, rec *Record) error {
+	return p.record("PostAppend", fmt.Sprintf("%s@%s %d", rec.Path, rec.Version, id))
+}
+
+// licensePlugin only implements PostFetch, annotating records with a license.
+type licensePlugin struct{ NopPipeline }
+
+func (licensePlugin) Name() string { return "license" }
+
+func (licensePlugin) PostFetch(_ context.Context, rec *Record) error {
+	rec.Annotations = map[string]string{"license": "MIT"}
+	return nil
+}
+
+func TestRecordPipeline(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	// newDB returns a server running a and b, in that order, and the log of their calls.
+	newDB := func(t *testing.T, store Store, fail map[string]error, opts ...Option) (*SumDB, func() []string) {
+		t.Helper()
+
+		var (
+			mu    sync.Mutex
+			calls []string
+		)
+		a := &recordingPlugin{name: "a", fail: fail, mu: &mu, calls: &calls}
+		b := &recordingPlugin{name: "b", mu: &mu, calls: &calls}
+		db, err := New("test.example.com", skey, append([]Option{
+			WithStore(store),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithRecordPipeline(a),
+			WithRecordPipeline(b),
+		}, opts...)...)
+		require.NoError(t, err)
+
+		return db, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			defer func() { calls = nil }()
+			return calls
+		}
+	}
+
+	t.Run("runs stages in order", func(t *testing.T) {
+		store := newAnnotatedStore(t, 0)
+		db, calls := newDB(t, store, nil)
+
+		id, err := db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"a PreFetch example.com/a@v1.0.0",
+			"b PreFetch example.com/a@v1.0.0",
+			"a PostFetch example.com/a@v1.0.0",
+			"b PostFetch example.com/a@v1.0.0",
+			"a PreAppend example.com/a@v1.0.0",
+			"b PreAppend example.com/a@v1.0.0",
+			"a PostAppend example.com/a@v1.0.0 0",
+			"b PostAppend example.com/a@v1.0.0 0",
+		}, calls())
+
+		annotations, err := db.Annotations(t.Context(), id)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"a": "checked", "b": "checked"}, annotations)
+
+		// Existing records aren't fetched, so they don't go through the pipeline.
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+		require.NoError(t, err)
+		require.Empty(t, calls())
+	})
+
+	for _, stage := range []string{"PreFetch", "PostFetch", "PreAppend"} {
+		t.Run("rejects records at "+stage, func(t *testing.T) {
+			denied := fmt.Errorf("%w: not allowed", ErrPolicyDenied)
+			store := newMemStore()
+			db, calls := newDB(t, store, map[string]error{stage: denied})
+
+			_, err := db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+			require.ErrorIs(t, err, ErrPolicyDenied)
+			require.ErrorContains(t, err, "record pipeline a failed at "+stage)
+
+			// Later plugins and stages aren't called.
+			log := calls()
+			require.Equal(t, "a "+stage+" example.com/a@v1.0.0", log[len(log)-1])
+
+			size, err := store.TreeSize(t.Context())
+			require.NoError(t, err)
+			require.Zero(t, size)
+		})
+	}
+
+	t.Run("logs post-append failures", func(t *testing.T) {
+		var logs bytes.Buffer
+		db, calls := newDB(t, newMemStore(), map[string]error{"PostAppend": errors.New("notification failed")},
+			WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+		_, err := db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+		require.NoError(t, err)
+		require.Contains(t, calls(), "b PostAppend example.com/a@v1.0.0 0")
+		require.Contains(t, logs.String(),
+			`level=WARN msg="record pipeline failed" plugin=a stage=PostAppend module=example.com/a version=v1.0.0 id=0`)
+	})
+
+	t.Run("runs for AddRecords", func(t *testing.T) {
+		store := newAnnotatedStore(t, 0)
+		db, err := New("test.example.com", skey,
+			WithStore(store),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithRecordPipeline(licensePlugin{}),
+		)
+		require.NoError(t, err)
+
+		ids, err := db.AddRecords(t.Context(), []module.Version{
+			{Path: "example.com/a", Version: "v1.0.0"},
+			{Path: "example.com/b", Version: "v1.0.0"},
+		})
+		require.NoError(t, err)
+		for _, id := range ids {
+			annotations, err := db.Annotations(t.Context(), id)
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"license": "MIT"}, annotations)
+		}
+	})
+}
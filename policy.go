@@ -0,0 +1,60 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/proxy"
+	"golang.org/x/mod/module"
+)
+
+// ErrPolicyDenied is returned by Lookup when a policy refuses to create a record for a module version.
+var ErrPolicyDenied = errors.New("denied by policy")
+
+// denyAfterRule refuses new records for versions of modules matching pattern that were published after cutoff.
+type denyAfterRule struct {
+	pattern string
+	cutoff  time.Time
+}
+
+// checkPolicy returns an error wrapping ErrPolicyDenied if a record must not be created for mod. It returns mod's
+// .info if it had to be fetched, so that it isn't fetched twice.
+//
+// Policies only apply to the creation of records. Existing records are always served.
+func (s *SumDB) checkPolicy(ctx context.Context, p *proxy.Proxy, mod module.Version) (*proxy.Info, error) {
+	var rule *denyAfterRule
+	for i, r := range s.denyAfter {
+		if !module.MatchPrefixPatterns(r.pattern, mod.Path) {
+			continue
+		}
+
+		// The earliest cutoff is the most restrictive, so it wins when several patterns match.
+		if rule == nil || r.cutoff.Before(rule.cutoff) {
+			rule = &s.denyAfter[i]
+		}
+	}
+
+	if rule == nil {
+		return nil, nil
+	}
+
+	info, err := p.Info(ctx, mod)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting info: %s, %w", mod, err)
+	}
+
+	if info.Time.After(rule.cutoff) {
+		return nil, fmt.Errorf(
+			"%w: %s was published at %s, after the %s cutoff for %s",
+			ErrPolicyDenied,
+			mod,
+			info.Time.Format(time.RFC3339),
+			rule.cutoff.Format(time.RFC3339),
+			rule.pattern,
+		)
+	}
+
+	return info, nil
+}
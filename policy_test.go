@@ -0,0 +1,76 @@
+package sumdb_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestDenyAfter(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	freeze := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	upstream := newFakeProxy(t)
+	old := module.Version{Path: "github.com/vendor/lib", Version: "v1.0.0"}
+	upstream.setTime(old, freeze.Add(-time.Hour))
+	fresh := module.Version{Path: "github.com/vendor/lib", Version: "v1.1.0"}
+	upstream.setTime(fresh, freeze.Add(time.Hour))
+	internal := module.Version{Path: "go.example.com/internal", Version: "v1.1.0"}
+	upstream.setTime(internal, freeze.Add(time.Hour))
+
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(upstream.upstream(t)),
+		WithDenyAfter("github.com", freeze),
+		WithDenyAfter("github.com/vendor", freeze.Add(24*time.Hour)),
+	)
+	require.NoError(t, err)
+
+	t.Run("allows versions published before the cutoff", func(t *testing.T) {
+		_, err := db.Lookup(t.Context(), old)
+		require.NoError(t, err)
+	})
+
+	t.Run("denies versions published after the earliest matching cutoff", func(t *testing.T) {
+		_, err := db.Lookup(t.Context(), fresh)
+		require.ErrorIs(t, err, ErrPolicyDenied)
+
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/github.com/vendor/lib@v1.1.0", nil))
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Contains(t, rec.Body.String(), "denied by policy")
+	})
+
+	t.Run("ignores modules that don't match", func(t *testing.T) {
+		_, err := db.Lookup(t.Context(), internal)
+		require.NoError(t, err)
+		require.NotContains(t, upstream.requested(), "/go.example.com/internal/@v/v1.1.0.info")
+	})
+
+	t.Run("serves existing records", func(t *testing.T) {
+		store := newMemStore()
+		open, err := New("test.example.com", skey, WithStore(store), WithUpstream(upstream.upstream(t)))
+		require.NoError(t, err)
+
+		id, err := open.Lookup(t.Context(), fresh)
+		require.NoError(t, err)
+
+		frozen, err := New("test.example.com", skey,
+			WithStore(store),
+			WithUpstream(upstream.upstream(t)),
+			WithDenyAfter("github.com", freeze),
+		)
+		require.NoError(t, err)
+
+		got, err := frozen.Lookup(t.Context(), fresh)
+		require.NoError(t, err)
+		require.Equal(t, id, got)
+	})
+}
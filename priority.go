@@ -0,0 +1,124 @@
+package sumdb
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Priorities of the work done on behalf of a context. See WithPriority.
+const (
+	// PriorityInteractive is for lookups someone is waiting for, such as those made by the go command during go get.
+	// It's the default for Lookup, and so for lookups served by Handler.
+	PriorityInteractive Priority = iota
+
+	// PriorityBatch is for bulk work, such as seeding a server or migrating modules to it. It's the default for
+	// AddRecords, ImportGoSum and ImportTiles.
+	PriorityBatch
+)
+
+type (
+	// Priority ranks cold lookups and imports competing for upstream fetches and appends, so that interactive lookups
+	// stay fast while bulk jobs run.
+	Priority int
+
+	// priorityKey is the context key for the Priority set with WithPriority.
+	priorityKey struct{}
+
+	// lanes is a semaphore granting its slots to waiting interactive work before batch work, each in the order it
+	// arrived. The zero value has a single slot.
+	lanes struct {
+		mu       sync.Mutex
+		capacity int
+		active   int
+		waiters  [PriorityBatch + 1][]chan struct{}
+	}
+)
+
+// WithPriority returns a copy of ctx carrying the priority p for the lookups and imports made with it.
+//
+// Modules fetched by AddRecords and batch lookups share the fetch worker pool (see WithFetchWorkers), while
+// interactive lookups fetch immediately, taking up the pool's workers until they're done: batch fetches only start
+// when no interactive fetch is keeping the pool busy. Appends are queued, and queued interactive appends go before
+// batch ones. Neither preempts work in progress, and both still wait for the limit set with WithAppendLimit.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// priorityFrom returns the priority set on ctx with WithPriority, or def if none (or an unknown one) was set.
+func priorityFrom(ctx context.Context, def Priority) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= PriorityInteractive && p <= PriorityBatch {
+		return p
+	}
+	return def
+}
+
+// acquire waits for a slot, behind the waiters of priority p or higher.
+func (l *lanes) acquire(ctx context.Context, p Priority) error {
+	l.mu.Lock()
+	if l.active < l.slots() && l.ahead(p) == 0 {
+		l.active++
+		l.mu.Unlock()
+		return nil
+	}
+
+	granted := make(chan struct{})
+	l.waiters[p] = append(l.waiters[p], granted)
+	l.mu.Unlock()
+
+	select {
+	case <-granted:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	i := slices.Index(l.waiters[p], granted)
+	if i >= 0 {
+		l.waiters[p] = slices.Delete(l.waiters[p], i, i+1)
+	}
+	l.mu.Unlock()
+
+	// The slot may have been granted while ctx was done.
+	if i < 0 {
+		l.release()
+	}
+	return ctx.Err()
+}
+
+// occupy takes a slot without waiting, even if none is free.
+func (l *lanes) occupy() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active++
+}
+
+// release frees a slot taken with acquire or occupy, handing it to the next waiter if there's room.
+func (l *lanes) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active <= l.slots() {
+		for p, waiters := range l.waiters {
+			if len(waiters) > 0 {
+				close(waiters[0])
+				l.waiters[p] = waiters[1:]
+				return
+			}
+		}
+	}
+	l.active--
+}
+
+// ahead returns the number of waiters going before new waiters of priority p.
+func (l *lanes) ahead(p Priority) int {
+	n := 0
+	for q := PriorityInteractive; q <= p; q++ {
+		n += len(l.waiters[q])
+	}
+	return n
+}
+
+func (l *lanes) slots() int {
+	return max(1, l.capacity)
+}
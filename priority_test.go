@@ -0,0 +1,66 @@
+package sumdb_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestPriority(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	upstream.setDelay(200 * time.Millisecond)
+	db, err := New("test.example.com", skey,
+		WithStore(memstore.New()),
+		WithUpstream(upstream.upstream(t)),
+		WithFetchWorkers(1),
+	)
+	require.NoError(t, err)
+
+	// fetched returns the modules whose go.mod files have been requested, in order.
+	fetched := func() []string {
+		var paths []string
+		for _, path := range upstream.requested() {
+			if p, ok := strings.CutSuffix(path, "/@v/v1.0.0.mod"); ok {
+				paths = append(paths, strings.TrimPrefix(p, "/"))
+			}
+		}
+		return paths
+	}
+
+	// Batch lookups share the single fetch worker.
+	batch := WithPriority(t.Context(), PriorityBatch)
+	errs := make(chan error, 3)
+	var wg sync.WaitGroup
+	for i := range 3 {
+		wg.Go(func() {
+			_, err := db.Lookup(batch, module.Version{Path: fmt.Sprintf("example.com/batch%d", i), Version: "v1.0.0"})
+			errs <- err
+		})
+	}
+	require.Eventually(t, func() bool { return len(fetched()) == 1 }, 5*time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Len(t, fetched(), 1)
+
+	// Interactive lookups don't wait for it, and batch fetches wait for them.
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/interactive", Version: "v1.0.0"})
+	require.NoError(t, err)
+	require.Equal(t, "example.com/interactive", fetched()[1])
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Len(t, fetched(), 4)
+
+}
@@ -0,0 +1,183 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+var (
+	// ErrInvalidTreeSize is returned when a tree size the log hasn't reached (or a negative one) is requested.
+	ErrInvalidTreeSize = errors.New("invalid tree size")
+
+	// ErrCheckpointMismatch is returned when the root hash of a tree, recomputed from the stored hashes, isn't the one
+	// checkpointed for its size, meaning the stored hashes have changed since it was signed.
+	ErrCheckpointMismatch = errors.New("tree hash doesn't match checkpoint")
+)
+
+// apiTreeProof is the JSON representation of the proof that a tree contains an older one.
+type apiTreeProof struct {
+	OldSize     int64    `json:"old_size"`
+	OldRootHash string   `json:"old_root_hash"`
+	TreeSize    int64    `json:"tree_size"`
+	RootHash    string   `json:"root_hash"`
+	Proof       []string `json:"proof"`
+	SignedHead  string   `json:"signed_head"`
+}
+
+// TreeOfSize returns the tree as it was when it had the given size, which may be any size up to the current one. A
+// signed tree head presented by a third party can be checked against the log by comparing its hash to the tree's.
+//
+// The root hash is recomputed from the stored hashes and, if the Store implements CheckpointStore and a checkpoint was
+// recorded for the size, checked against it. It returns ErrInvalidTreeSize if the tree never had the size, and
+// ErrCheckpointMismatch if the root hash isn't the checkpointed one.
+func (s *SumDB) TreeOfSize(ctx context.Context, size int64) (tlog.Tree, error) {
+	current, err := s.store.TreeSize(ctx)
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("failed to get tree size: %w", err)
+	}
+	if size < 0 || size > current {
+		return tlog.Tree{}, fmt.Errorf("%w: %d, tree size is %d", ErrInvalidTreeSize, size, current)
+	}
+
+	root, err := tree.TreeHashAt(ctx, s.store, size)
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("failed to compute tree hash: %d, %w", size, err)
+	}
+
+	if cs, ok := s.store.(CheckpointStore); ok {
+		c, err := cs.Checkpoint(ctx, size)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			// Trees from before the store supported checkpoints, and those in the middle of bulk appends, have none.
+		case err != nil:
+			return tlog.Tree{}, fmt.Errorf("failed to find checkpoint: %d, %w", size, err)
+		case c.Root != root:
+			return tlog.Tree{}, fmt.Errorf("%w: tree of size %d has root %s, but %s was recorded",
+				ErrCheckpointMismatch, size, root, c.Root)
+		}
+	}
+
+	return tlog.Tree{N: size, Hash: root}, nil
+}
+
+// ProveRecord returns the proof that the record with the given ID is contained in the tree of the given size, which
+// may be any size up to the current one (see TreeOfSize). The proof can be checked with tlog.CheckRecord against the
+// root hash of a signed tree head of that size. It returns ErrNotFound if the record isn't in the tree.
+func (s *SumDB) ProveRecord(ctx context.Context, id, size int64) (tlog.RecordProof, error) {
+	proof, _, err := s.proveRecord(ctx, id, size)
+	return proof, err
+}
+
+// proveRecord implements ProveRecord, also returning the tree the proof is for.
+func (s *SumDB) proveRecord(ctx context.Context, id, size int64) (tlog.RecordProof, tlog.Tree, error) {
+	t, err := s.TreeOfSize(ctx, size)
+	if err != nil {
+		return nil, tlog.Tree{}, err
+	}
+	if id < 0 || id >= size {
+		return nil, tlog.Tree{}, fmt.Errorf("%w: record %d in tree of size %d", ErrNotFound, id, size)
+	}
+
+	proof, err := tree.ProveRecord(ctx, s.store, size, id)
+	if err != nil {
+		return nil, tlog.Tree{}, fmt.Errorf("failed to prove record: %d, %w", id, err)
+	}
+	return proof, t, nil
+}
+
+// ProveConsistency returns the proof that the tree of the given size contains the tree of size oldSize, both of which
+// may be any size up to the current one (see TreeOfSize). The proof can be checked with tlog.CheckTree against the
+// signed tree heads of the two sizes, e.g. to show that an old head presented by a third party is one the log vouches
+// for. It returns ErrInvalidTreeSize if oldSize is larger than size.
+func (s *SumDB) ProveConsistency(ctx context.Context, oldSize, size int64) (tlog.TreeProof, error) {
+	proof, _, _, err := s.proveConsistency(ctx, oldSize, size)
+	return proof, err
+}
+
+// proveConsistency implements ProveConsistency, also returning the old and new trees the proof is for.
+func (s *SumDB) proveConsistency(
+	ctx context.Context,
+	oldSize, size int64,
+) (tlog.TreeProof, tlog.Tree, tlog.Tree, error) {
+	if oldSize > size {
+		return nil, tlog.Tree{}, tlog.Tree{}, fmt.Errorf("%w: %d is larger than %d", ErrInvalidTreeSize, oldSize, size)
+	}
+
+	oldTree, err := s.TreeOfSize(ctx, oldSize)
+	if err != nil {
+		return nil, tlog.Tree{}, tlog.Tree{}, err
+	}
+	t, err := s.TreeOfSize(ctx, size)
+	if err != nil {
+		return nil, tlog.Tree{}, tlog.Tree{}, err
+	}
+
+	proof, err := tree.ProveTree(ctx, s.store, size, oldSize)
+	if err != nil {
+		return nil, tlog.Tree{}, tlog.Tree{}, fmt.Errorf("failed to prove tree: %d, %d, %w", oldSize, size, err)
+	}
+	return proof, oldTree, t, nil
+}
+
+// serveTreeProof serves GET /tree/proof?old={size}&size={size} requests, returning the proof that the tree of the
+// given size (the current one by default) contains the tree of the old size, along with a signed tree head for it.
+func (s *SumDB) serveTreeProof(w http.ResponseWriter, r *http.Request) {
+	current, err := s.store.TreeSize(r.Context())
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	oldSize, err := queryInt(r, "old", 0)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	size, err := queryInt(r, "size", current)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	proof, oldTree, t, err := s.proveConsistency(r.Context(), oldSize, size)
+	if err != nil {
+		writeAPIError(w, proofStatus(err), err)
+		return
+	}
+
+	signed, err := s.signTree(r.Context(), t)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	out := apiTreeProof{
+		OldSize:     oldSize,
+		OldRootHash: oldTree.Hash.String(),
+		TreeSize:    size,
+		RootHash:    t.Hash.String(),
+		Proof:       make([]string, len(proof)),
+		SignedHead:  string(signed),
+	}
+	for i, h := range proof {
+		out.Proof[i] = h.String()
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// proofStatus returns the HTTP status for an error proving a record or tree.
+func proofStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidTreeSize):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
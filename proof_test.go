@@ -0,0 +1,149 @@
+package sumdb_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestHistoricalProofs(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := memstore.New()
+	db, err := New("test.example.com", skey, WithStore(store), WithUpstream(newFakeProxy(t).upstream(t)))
+	require.NoError(t, err)
+
+	verifier, err := note.NewVerifier(vkey)
+	require.NoError(t, err)
+
+	// signedTree returns the tree of the server's current signed tree head.
+	signedTree := func(t *testing.T) tlog.Tree {
+		t.Helper()
+
+		signed, err := db.Signed(t.Context())
+		require.NoError(t, err)
+		n, err := note.Open(signed, note.VerifierList(verifier))
+		require.NoError(t, err)
+		tree, err := tlog.ParseTree([]byte(n.Text))
+		require.NoError(t, err)
+		return tree
+	}
+
+	// A third party keeps the head signed after the first two records.
+	for i := range 2 {
+		_, err := db.Lookup(t.Context(), module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"})
+		require.NoError(t, err)
+	}
+	old := signedTree(t)
+	require.Equal(t, int64(2), old.N)
+
+	_, err = db.AddRecords(t.Context(), []module.Version{
+		{Path: "example.com/mod2", Version: "v1.0.0"},
+		{Path: "example.com/mod3", Version: "v1.0.0"},
+		{Path: "example.com/mod4", Version: "v1.0.0"},
+	})
+	require.NoError(t, err)
+	current := signedTree(t)
+	require.Equal(t, int64(5), current.N)
+
+	t.Run("trees", func(t *testing.T) {
+		tree, err := db.TreeOfSize(t.Context(), old.N)
+		require.NoError(t, err)
+		require.Equal(t, old, tree)
+
+		// Trees in the middle of bulk appends have no checkpoints, but are still known.
+		_, err = db.TreeOfSize(t.Context(), 3)
+		require.NoError(t, err)
+
+		_, err = db.TreeOfSize(t.Context(), 6)
+		require.ErrorIs(t, err, ErrInvalidTreeSize)
+		_, err = db.TreeOfSize(t.Context(), -1)
+		require.ErrorIs(t, err, ErrInvalidTreeSize)
+	})
+
+	t.Run("records", func(t *testing.T) {
+		data, err := db.ReadRecords(t.Context(), 1, 1)
+		require.NoError(t, err)
+
+		proof, err := db.ProveRecord(t.Context(), 1, old.N)
+		require.NoError(t, err)
+		require.NoError(t, tlog.CheckRecord(proof, old.N, old.Hash, 1, tlog.RecordHash(data[0])))
+
+		_, err = db.ProveRecord(t.Context(), 2, old.N)
+		require.ErrorIs(t, err, ErrNotFound)
+		_, err = db.ProveRecord(t.Context(), 1, 6)
+		require.ErrorIs(t, err, ErrInvalidTreeSize)
+	})
+
+	t.Run("consistency", func(t *testing.T) {
+		proof, err := db.ProveConsistency(t.Context(), old.N, current.N)
+		require.NoError(t, err)
+		require.NoError(t, tlog.CheckTree(proof, current.N, current.Hash, old.N, old.Hash))
+
+		_, err = db.ProveConsistency(t.Context(), current.N, old.N)
+		require.ErrorIs(t, err, ErrInvalidTreeSize)
+	})
+
+	t.Run("api", func(t *testing.T) {
+		get := func(path string, v any) int {
+			rec := httptest.NewRecorder()
+			db.APIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if v != nil && rec.Code == http.StatusOK {
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+			}
+			return rec.Code
+		}
+
+		var out struct {
+			OldSize     int64    `json:"old_size"`
+			OldRootHash string   `json:"old_root_hash"`
+			TreeSize    int64    `json:"tree_size"`
+			RootHash    string   `json:"root_hash"`
+			Proof       []string `json:"proof"`
+			SignedHead  string   `json:"signed_head"`
+		}
+		require.Equal(t, http.StatusOK, get("/tree/proof?old=2", &out))
+		require.Equal(t, old.N, out.OldSize)
+		require.Equal(t, old.Hash.String(), out.OldRootHash)
+		require.Equal(t, current.N, out.TreeSize)
+
+		proof := make(tlog.TreeProof, len(out.Proof))
+		for i, h := range out.Proof {
+			proof[i] = mustParseHash(t, h)
+		}
+		require.NoError(t, tlog.CheckTree(proof, current.N, current.Hash, old.N, old.Hash))
+
+		n, err := note.Open([]byte(out.SignedHead), note.VerifierList(verifier))
+		require.NoError(t, err)
+		signed, err := tlog.ParseTree([]byte(n.Text))
+		require.NoError(t, err)
+		require.Equal(t, current, signed)
+
+		require.Equal(t, http.StatusOK, get("/tree/proof?old=1&size=2", nil))
+		require.Equal(t, http.StatusBadRequest, get("/tree/proof?old=3&size=2", nil))
+		require.Equal(t, http.StatusBadRequest, get("/tree/proof?old=2&size=6", nil))
+		require.Equal(t, http.StatusBadRequest, get("/tree/proof?old=x", nil))
+	})
+
+	t.Run("checkpoint mismatch", func(t *testing.T) {
+		// The empty tree's root hash is all zeros, so a checkpoint for it with any other root doesn't match.
+		store := memstore.New()
+		require.NoError(t, store.AddCheckpoint(t.Context(), &Checkpoint{Size: 0, Root: tlog.Hash{1}}))
+
+		db, err := New("test.example.com", skey, WithStore(store))
+		require.NoError(t, err)
+
+		_, err = db.TreeOfSize(t.Context(), 0)
+		require.ErrorIs(t, err, ErrCheckpointMismatch)
+	})
+}
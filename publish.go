@@ -0,0 +1,224 @@
+package sumdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/tree"
+)
+
+const (
+	// outboxBatchSize is the maximum number of events delivered to publishers at a time.
+	outboxBatchSize = 100
+
+	// outboxPollInterval is how often the outbox is checked when no appends have been observed, picking up events
+	// written by other processes or left behind by a previous run.
+	outboxPollInterval = 30 * time.Second
+
+	// outboxMinBackoff and outboxMaxBackoff bound the delay between failed delivery attempts.
+	outboxMinBackoff = time.Second
+	outboxMaxBackoff = time.Minute
+)
+
+var (
+	// ErrOutboxUnsupported is returned when a Publisher is configured and the Store doesn't implement OutboxStore.
+	ErrOutboxUnsupported = errors.New("store does not support an outbox")
+
+	// ErrNoPublisher is returned by RunPublisher when no Publisher has been configured with WithPublisher.
+	ErrNoPublisher = errors.New("no publisher configured")
+)
+
+type (
+	// AppendEvent describes a record appended to the tree.
+	AppendEvent struct {
+		ID       int64  `json:"id"`
+		Path     string `json:"path"`
+		Version  string `json:"version"`
+		TreeSize int64  `json:"tree_size"`
+		RootHash string `json:"root_hash"`
+	}
+
+	// Publisher delivers append events to an external system, such as a Kafka topic or NATS subject.
+	//
+	// Publish must only return nil once all events have been accepted by the external system. Failed batches are
+	// retried, so events are delivered at least once and consumers should deduplicate them by ID.
+	Publisher interface {
+		Publish(ctx context.Context, events []*AppendEvent) error
+	}
+
+	// PublisherFunc adapts a function to the Publisher interface.
+	PublisherFunc func(ctx context.Context, events []*AppendEvent) error
+)
+
+// Publish calls f(ctx, events).
+func (f PublisherFunc) Publish(ctx context.Context, events []*AppendEvent) error {
+	return f(ctx, events)
+}
+
+// RunPublisher is the relay worker that delivers the events in the store's outbox to the publishers configured with
+// WithPublisher until ctx is done. Events are removed from the outbox once every publisher has accepted them. Delivery
+// failures are retried with exponential backoff, so no append event is lost.
+//
+// Only one RunPublisher should be running per store. It returns ErrNoPublisher if no Publisher is configured,
+// ErrOutboxUnsupported if the Store doesn't implement OutboxStore, and ctx.Err() once ctx is done.
+func (s *SumDB) RunPublisher(ctx context.Context) error {
+	if len(s.publishers) == 0 {
+		return ErrNoPublisher
+	}
+
+	store, ok := s.store.(OutboxStore)
+	if !ok {
+		return ErrOutboxUnsupported
+	}
+
+	retry := backoff{clock: s.clock}
+	for {
+		// Register for notifications before reading the outbox so that appends in between aren't missed.
+		appended := s.appended.wait()
+
+		n, err := s.relayOutbox(ctx, store)
+		if err != nil {
+			if !retry.wait(ctx) {
+				return ctx.Err()
+			}
+			continue
+		}
+		retry.reset()
+
+		if n == outboxBatchSize {
+			continue
+		}
+
+		// Appends end the wait early, so the clock's wait is canceled when one is observed.
+		pollCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-appended:
+				cancel()
+			case <-pollCtx.Done():
+			}
+		}()
+		sleep(pollCtx, s.clock, outboxPollInterval)
+		cancel()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// relayOutbox publishes the oldest batch of events in the outbox and removes them, returning the number of events
+// published.
+func (s *SumDB) relayOutbox(ctx context.Context, store OutboxStore) (int, error) {
+	entries, err := store.OutboxEvents(ctx, outboxBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	events := make([]*AppendEvent, len(entries))
+	ids := make([]int64, len(entries))
+	for i, e := range entries {
+		events[i] = new(AppendEvent)
+		if err := json.Unmarshal(e.Data, events[i]); err != nil {
+			return 0, fmt.Errorf("failed to decode outbox event %d: %w", e.ID, err)
+		}
+		ids[i] = e.ID
+	}
+
+	if err := s.publish(ctx, events); err != nil {
+		return 0, err
+	}
+
+	if err := store.DeleteOutboxEvents(ctx, ids); err != nil {
+		return 0, fmt.Errorf("failed to delete outbox events: %w", err)
+	}
+
+	return len(entries), nil
+}
+
+// publish delivers events to every Publisher, retrying the ones that fail until they succeed or ctx is done.
+// Publishers that succeed aren't retried, so a failing sink doesn't cause duplicates elsewhere.
+func (s *SumDB) publish(ctx context.Context, events []*AppendEvent) error {
+	retry := backoff{clock: s.clock}
+	pending := s.publishers
+	for {
+		var failed []Publisher
+		for _, p := range pending {
+			if err := p.Publish(ctx, events); err != nil {
+				failed = append(failed, p)
+			}
+		}
+
+		if len(failed) == 0 {
+			return nil
+		}
+		if !retry.wait(ctx) {
+			return fmt.Errorf("failed to publish events: %w", ctx.Err())
+		}
+		pending = failed
+	}
+}
+
+// addOutboxEvent writes the append event for the record with the given ID to the outbox when a Publisher is
+// configured. It must be called within the transaction that added the record, after the tree has been updated.
+func (s *SumDB) addOutboxEvent(ctx context.Context, store Store, id int64, rec *Record) error {
+	if len(s.publishers) == 0 {
+		return nil
+	}
+
+	outbox, ok := store.(OutboxStore)
+	if !ok {
+		return ErrOutboxUnsupported
+	}
+
+	hash, err := tree.TreeHashAt(ctx, store, id+1)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(AppendEvent{
+		ID:       id,
+		Path:     rec.Path,
+		Version:  rec.Version,
+		TreeSize: id + 1,
+		RootHash: hash.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode append event: %w", err)
+	}
+
+	if err := outbox.AddOutboxEvent(ctx, data); err != nil {
+		return fmt.Errorf("failed to add outbox event: %s@%s, %w", rec.Path, rec.Version, err)
+	}
+
+	return nil
+}
+
+// backoff is an exponential delay between retries, waited for with clock. The zero value starts at outboxMinBackoff
+// and waits with a system timer.
+type backoff struct {
+	clock Clock
+	d     time.Duration
+}
+
+// wait sleeps for the current delay and doubles it, returning false if ctx is done first.
+func (b *backoff) wait(ctx context.Context) bool {
+	if b.d == 0 {
+		b.d = outboxMinBackoff
+	}
+
+	d := b.d
+	b.d = min(b.d*2, outboxMaxBackoff)
+	return sleep(ctx, b.clock, d)
+}
+
+// reset restores the initial delay.
+func (b *backoff) reset() {
+	b.d = 0
+}
@@ -0,0 +1,232 @@
+package sumdb_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestRunPublisher(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	var (
+		mu        sync.Mutex
+		attempts  int
+		published []*AppendEvent
+	)
+	publisher := PublisherFunc(func(_ context.Context, events []*AppendEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts == 1 {
+			return errors.New("broker unavailable")
+		}
+		published = append(published, events...)
+		return nil
+	})
+
+	store := newOutboxStore()
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(newFakeProxy(t).upstream(t)),
+		WithPublisher(publisher),
+	)
+	require.NoError(t, err)
+
+	mods := []module.Version{
+		{Path: "example.com/a", Version: "v1.0.0"},
+		{Path: "example.com/b", Version: "v1.2.3"},
+	}
+	for _, mod := range mods {
+		_, err := db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+	}
+	require.Len(t, store.pending(), 2)
+
+	signed, err := db.Signed(t.Context())
+	require.NoError(t, err)
+	head, err := tlog.ParseTree(signed)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- db.RunPublisher(ctx) }()
+
+	// The first attempt fails and is retried after a backoff.
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(published) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	require.Equal(t, &AppendEvent{ID: 0, Path: "example.com/a", Version: "v1.0.0", TreeSize: 1}, withoutHash(published[0]))
+	require.Equal(t, &AppendEvent{ID: 1, Path: "example.com/b", Version: "v1.2.3", TreeSize: 2}, withoutHash(published[1]))
+	require.Equal(t, head.Hash.String(), published[1].RootHash)
+	require.NotEqual(t, published[0].RootHash, published[1].RootHash)
+	mu.Unlock()
+
+	require.Eventually(t, func() bool { return len(store.pending()) == 0 }, time.Second, 10*time.Millisecond)
+
+	// New appends are published as they happen.
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/c", Version: "v0.1.0"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(published) == 3 && published[2].Path == "example.com/c"
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestRunPublisher_MultipleSinks(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	// sink records the events it receives, failing the first fail calls.
+	type sink struct {
+		mu     sync.Mutex
+		fail   int
+		events []*AppendEvent
+	}
+	sinks := []*sink{{}, {fail: 1}}
+	opts := []Option{WithStore(newOutboxStore()), WithUpstream(newFakeProxy(t).upstream(t))}
+	for _, s := range sinks {
+		opts = append(opts, WithPublisher(PublisherFunc(func(_ context.Context, events []*AppendEvent) error {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			if s.fail > 0 {
+				s.fail--
+				return errors.New("sink unavailable")
+			}
+			s.events = append(s.events, events...)
+			return nil
+		})))
+	}
+
+	db, err := New("test.example.com", skey, opts...)
+	require.NoError(t, err)
+
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+	go func() { _ = db.RunPublisher(ctx) }()
+
+	received := func(s *sink) int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.events)
+	}
+
+	// Each sink receives every event exactly once, even though one of them failed and was retried.
+	require.Eventually(t, func() bool { return received(sinks[1]) == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, received(sinks[0]))
+	require.Equal(t, sinks[0].events, sinks[1].events)
+}
+
+func TestRunPublisher_Poll(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	// The outbox is polled every 30 seconds, so it's only polled twice in time if the publisher waits with the clock.
+	clock := &sleepingClock{now: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+	clock.onSleep = func(n int) {
+		if n == 2 {
+			cancel()
+		}
+	}
+
+	publisher := PublisherFunc(func(context.Context, []*AppendEvent) error { return nil })
+	db, err := New("test.example.com", skey, WithStore(newOutboxStore()), WithClock(clock), WithPublisher(publisher))
+	require.NoError(t, err)
+
+	require.ErrorIs(t, db.RunPublisher(ctx), context.Canceled)
+	require.Equal(t, []time.Duration{30 * time.Second, 30 * time.Second}, clock.slept)
+}
+
+func TestRunPublisher_Unsupported(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	publisher := PublisherFunc(func(context.Context, []*AppendEvent) error { return nil })
+	_, err = New("test.example.com", skey, WithStore(newMemStore()), WithPublisher(publisher))
+	require.ErrorIs(t, err, ErrOutboxUnsupported)
+
+	db, err := New("test.example.com", skey, WithStore(newOutboxStore()))
+	require.NoError(t, err)
+	require.ErrorIs(t, db.RunPublisher(t.Context()), ErrNoPublisher)
+}
+
+func withoutHash(e *AppendEvent) *AppendEvent {
+	c := *e
+	c.RootHash = ""
+	return &c
+}
+
+// outboxStore is a memStore that implements OutboxStore.
+type outboxStore struct {
+	*memStore
+
+	outboxMu sync.Mutex
+	outbox   []*OutboxEvent
+	nextID   int64
+}
+
+func newOutboxStore() *outboxStore {
+	return &outboxStore{memStore: newMemStore()}
+}
+
+func (s *outboxStore) AddOutboxEvent(_ context.Context, data []byte) error {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	s.outbox = append(s.outbox, &OutboxEvent{ID: s.nextID, Data: data})
+	s.nextID++
+	return nil
+}
+
+func (s *outboxStore) OutboxEvents(_ context.Context, n int64) ([]*OutboxEvent, error) {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	return append([]*OutboxEvent(nil), s.outbox[:min(n, int64(len(s.outbox)))]...), nil
+}
+
+func (s *outboxStore) DeleteOutboxEvents(_ context.Context, ids []int64) error {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	remaining := s.outbox[:0]
+	for _, e := range s.outbox {
+		if !slices.Contains(ids, e.ID) {
+			remaining = append(remaining, e)
+		}
+	}
+	s.outbox = remaining
+	return nil
+}
+
+// pending returns the events remaining in the outbox.
+func (s *outboxStore) pending() []*OutboxEvent {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+	return append([]*OutboxEvent(nil), s.outbox...)
+}
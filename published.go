@@ -0,0 +1,87 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultPublishedWindow is how far back GET /records/published looks without a since parameter.
+const defaultPublishedWindow = 7 * 24 * time.Hour
+
+// ErrPublishedUnsupported is returned when querying records by publish time and the Store doesn't implement
+// PublishedStore.
+var ErrPublishedUnsupported = errors.New("store does not support querying records by publish time")
+
+// PublishedRecords returns up to n of the records for versions published in the interval [since, until), ordered by
+// publish time, e.g. for reports of the modules that entered the database in a given week. Publish times are only
+// known for some records (see WithPublishTimes); the others are never returned.
+//
+// It returns ErrPublishedUnsupported if the Store doesn't implement PublishedStore.
+func (s *SumDB) PublishedRecords(ctx context.Context, since, until time.Time, n int64) ([]*Record, error) {
+	ps, ok := s.store.(PublishedStore)
+	if !ok {
+		return nil, ErrPublishedUnsupported
+	}
+
+	recs, err := ps.PublishedRecords(ctx, since, until, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query published records: %w", err)
+	}
+	return recs, nil
+}
+
+// servePublishedRecords serves GET /records/published requests, returning up to n of the records published between
+// since and until (RFC 3339 times), ordered by publish time. By default, it returns the records published in the last
+// week.
+func (s *SumDB) servePublishedRecords(w http.ResponseWriter, r *http.Request) {
+	until, err := queryTime(r, "until", s.clock.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	since, err := queryTime(r, "since", until.Add(-defaultPublishedWindow))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n, err := queryInt(r, "n", maxRecentRecords)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recs, err := s.PublishedRecords(r.Context(), since, until, min(n, maxRecentRecords))
+	switch {
+	case errors.Is(err, ErrPublishedUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]apiRecord, len(recs))
+	for i, rec := range recs {
+		out[i] = newAPIRecord(rec.ID, rec)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// queryTime returns the RFC 3339 time in the query parameter name, or def if it's not set.
+func queryTime(r *http.Request, name string, def time.Time) (time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return t, nil
+}
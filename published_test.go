@@ -0,0 +1,137 @@
+package sumdb_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/sqlite"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestPublishTimes(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	upstream := newFakeProxy(t)
+	mods := []module.Version{
+		{Path: "example.com/old", Version: "v1.0.0"},
+		{Path: "example.com/new", Version: "v1.0.0"},
+		{Path: "example.com/newer", Version: "v1.0.0"},
+	}
+	upstream.setTime(mods[0], now.Add(-30*24*time.Hour))
+	upstream.setTime(mods[1], now.Add(-2*time.Hour))
+	upstream.setTime(mods[2], now.Add(-time.Hour))
+
+	store, err := sqlite.Open(t.Context(), filepath.Join(t.TempDir(), "sumdb.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(upstream.upstream(t)),
+		WithPublishTimes(),
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithAdminIdentity(IdentityFunc(func(*http.Request) (Identity, error) {
+			return Identity{Subject: "alice", Role: RoleViewer}, nil
+		})),
+	)
+	require.NoError(t, err)
+
+	// Added newest first, so that publish order differs from ID order.
+	for _, mod := range []module.Version{mods[2], mods[0], mods[1]} {
+		_, err := db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+	}
+
+	t.Run("records", func(t *testing.T) {
+		recs, err := store.Records(t.Context(), 0, 3)
+		require.NoError(t, err)
+		require.Equal(t, now.Add(-time.Hour), recs[0].Published)
+		require.Equal(t, now.Add(-30*24*time.Hour), recs[1].Published)
+	})
+
+	t.Run("published records", func(t *testing.T) {
+		recs, err := db.PublishedRecords(t.Context(), now.Add(-24*time.Hour), now, 10)
+		require.NoError(t, err)
+		require.Len(t, recs, 2)
+		require.Equal(t, "example.com/new", recs[0].Path)
+		require.Equal(t, "example.com/newer", recs[1].Path)
+	})
+
+	t.Run("admin API", func(t *testing.T) {
+		var recs []struct {
+			Path      string    `json:"path"`
+			Published time.Time `json:"published"`
+		}
+
+		get := func(path string) int {
+			rec := httptest.NewRecorder()
+			db.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code == http.StatusOK {
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(&recs))
+			}
+			return rec.Code
+		}
+
+		// The last week by default.
+		require.Equal(t, http.StatusOK, get("/records/published"))
+		require.Len(t, recs, 2)
+		require.Equal(t, "example.com/new", recs[0].Path)
+		require.Equal(t, now.Add(-2*time.Hour), recs[0].Published)
+
+		require.Equal(t, http.StatusOK, get("/records/published?since=2026-01-01T00:00:00Z&n=1"))
+		require.Len(t, recs, 1)
+		require.Equal(t, "example.com/old", recs[0].Path)
+
+		require.Equal(t, http.StatusBadRequest, get("/records/published?since=yesterday"))
+	})
+
+	t.Run("JSON API", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		db.APIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records/0", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), `"published":"2026-03-10T11:00:00Z"`)
+	})
+
+	t.Run("without publish times", func(t *testing.T) {
+		upstream := newFakeProxy(t)
+		db, err := New("test.example.com", skey, WithStore(newMemStore()), WithUpstream(upstream.upstream(t)))
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), mods[0])
+		require.NoError(t, err)
+		require.NotContains(t, upstream.requested(), "/example.com/old/@v/v1.0.0.info")
+
+		// Records aren't served with publish times they don't have.
+		rec := httptest.NewRecorder()
+		db.APIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records/0", nil))
+		require.NotContains(t, rec.Body.String(), "published")
+
+		_, err = db.PublishedRecords(t.Context(), time.Time{}, now, 10)
+		require.ErrorIs(t, err, ErrPublishedUnsupported)
+	})
+
+	t.Run("policies", func(t *testing.T) {
+		// .info fetched for policies is kept, even without WithPublishTimes.
+		store := newMemStore()
+		db, err := New("test.example.com", skey,
+			WithStore(store),
+			WithUpstream(upstream.upstream(t)),
+			WithDenyAfter("example.com", now),
+		)
+		require.NoError(t, err)
+
+		id, err := db.Lookup(t.Context(), mods[0])
+		require.NoError(t, err)
+		recs, err := store.Records(t.Context(), id, 1)
+		require.NoError(t, err)
+		require.Equal(t, now.Add(-30*24*time.Hour), recs[0].Published)
+	})
+}
@@ -0,0 +1,209 @@
+package sumdb
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pseudomuto/sumdb/alert"
+	"github.com/pseudomuto/sumdb/internal/proxy"
+	"github.com/pseudomuto/sumdb/internal/sumdbclient"
+	"golang.org/x/mod/module"
+)
+
+// ErrUpstreamMismatch is returned by Lookup when the primary and secondary upstreams disagree about a module
+// version's hashes, or the primary upstream disagrees with the checksum database. See WithSecondaryUpstream and
+// WithUpstreamSumDB.
+var ErrUpstreamMismatch = errors.New("upstreams disagree")
+
+type (
+	// QuarantinedVersion is a module version whose hashes differed between the primary and secondary upstreams, or
+	// between the primary upstream and the checksum database set with WithUpstreamSumDB. Primary holds the go.sum
+	// lines computed from the primary upstream, and Secondary those of the secondary upstream or checksum database.
+	QuarantinedVersion struct {
+		Path      string    `json:"path"`
+		Version   string    `json:"version"`
+		Primary   string    `json:"primary"`
+		Secondary string    `json:"secondary"`
+		Time      time.Time `json:"time"`
+	}
+
+	// quarantine holds the module versions the upstreams disagreed on. The zero value is ready to use.
+	quarantine struct {
+		mu       sync.Mutex
+		versions map[string]QuarantinedVersion
+	}
+)
+
+func (q *quarantine) has(mod module.Version) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, ok := q.versions[mod.String()]
+	return ok
+}
+
+func (q *quarantine) add(v QuarantinedVersion) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.versions == nil {
+		q.versions = make(map[string]QuarantinedVersion)
+	}
+	q.versions[module.Version{Path: v.Path, Version: v.Version}.String()] = v
+}
+
+func (q *quarantine) remove(mod module.Version) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, ok := q.versions[mod.String()]
+	delete(q.versions, mod.String())
+	return ok
+}
+
+func (q *quarantine) list() []QuarantinedVersion {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	versions := make([]QuarantinedVersion, 0, len(q.versions))
+	for _, v := range q.versions {
+		versions = append(versions, v)
+	}
+
+	slices.SortFunc(versions, func(a, b QuarantinedVersion) int {
+		return cmp.Or(strings.Compare(a.Path, b.Path), strings.Compare(a.Version, b.Version))
+	})
+	return versions
+}
+
+// Quarantined returns the module versions whose hashes differed between the primary and secondary upstreams, ordered
+// by module path and version. Lookups for these versions fail with ErrUpstreamMismatch until they're released with
+// ReleaseQuarantine.
+func (s *SumDB) Quarantined() []QuarantinedVersion {
+	return s.quarantine.list()
+}
+
+// ReleaseQuarantine removes mod from the quarantine, so that the next lookup fetches it from both upstreams again.
+// It reports whether mod was quarantined.
+func (s *SumDB) ReleaseQuarantine(mod module.Version) bool {
+	return s.quarantine.remove(mod)
+}
+
+// crossCheck fetches mod from the secondary upstream, if one is configured, with the client secondary and returns an
+// error wrapping ErrUpstreamMismatch if its hashes differ from rec, quarantining mod.
+func (s *SumDB) crossCheck(ctx context.Context, secondary *proxy.Proxy, mod module.Version, rec *Record) error {
+	if secondary == nil {
+		return nil
+	}
+
+	other, err := hashRecord(ctx, secondary, mod)
+	if err != nil {
+		return s.upstreamError(mod, fmt.Errorf("secondary upstream: %w", err))
+	}
+
+	if bytes.Equal(rec.Data, other.Data) {
+		return nil
+	}
+
+	return s.quarantineMismatch(ctx, mod, rec, other.Data, alertSourceCrossCheck,
+		fmt.Sprintf("upstreams disagree about %s", mod))
+}
+
+// checkUpstreamSumDB looks up mod with the client c of the checksum database set with WithUpstreamSumDB, if rec was
+// hashed from the upstream proxy by the default route r, and returns an error wrapping ErrUpstreamMismatch if the
+// database's record differs from rec, quarantining mod. Versions the database doesn't have are accepted.
+func (s *SumDB) checkUpstreamSumDB(
+	ctx context.Context, r *ingestRoute, c *sumdbclient.Client, mod module.Version, rec *Record,
+) error {
+	if c == nil || r != s.defaultRoute || r.sumdb != nil {
+		return nil
+	}
+
+	data, err := c.Lookup(ctx, mod)
+	if errors.Is(err, sumdbclient.ErrNotFound) {
+		return nil
+	}
+	if errors.Is(err, ErrUpstreamVerification) {
+		s.raise(ctx, &alert.Alert{
+			Source:   alertSourceUpstreamVerification,
+			Severity: alert.Critical,
+			Summary:  fmt.Sprintf("failed to verify the upstream checksum database's record for %s", mod),
+			Details:  map[string]string{"module": mod.String(), "error": err.Error()},
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("upstream sumdb: %w", err)
+	}
+
+	if data, err = NormalizeRecordData(mod, data); err != nil {
+		return fmt.Errorf("upstream sumdb: %w", err)
+	}
+	if bytes.Equal(rec.Data, data) {
+		return nil
+	}
+
+	return s.quarantineMismatch(ctx, mod, rec, data, alertSourceUpstreamSumDB,
+		fmt.Sprintf("the upstream checksum database disagrees about %s", mod))
+}
+
+// quarantineMismatch quarantines mod, whose record rec differs from the go.sum lines other served by another source,
+// raising a critical alert with the given source and summary. It returns an error wrapping ErrUpstreamMismatch.
+func (s *SumDB) quarantineMismatch(
+	ctx context.Context,
+	mod module.Version,
+	rec *Record,
+	other []byte,
+	source, summary string,
+) error {
+	s.quarantine.add(QuarantinedVersion{
+		Path:      mod.Path,
+		Version:   mod.Version,
+		Primary:   string(rec.Data),
+		Secondary: string(other),
+		Time:      s.clock.Now(),
+	})
+	s.raise(ctx, &alert.Alert{
+		Source:   source,
+		Severity: alert.Critical,
+		Summary:  summary,
+		Details: map[string]string{
+			"module":    mod.String(),
+			"primary":   string(rec.Data),
+			"secondary": string(other),
+		},
+	})
+	return fmt.Errorf("%w: %s", ErrUpstreamMismatch, mod)
+}
+
+// serveQuarantine serves GET /quarantine requests.
+func (s *SumDB) serveQuarantine(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.Quarantined())
+}
+
+// serveReleaseQuarantine serves DELETE /quarantine?module={path}@{version} requests.
+func (s *SumDB) serveReleaseQuarantine(w http.ResponseWriter, r *http.Request) {
+	path, version, ok := strings.Cut(r.URL.Query().Get("module"), "@")
+	if !ok || path == "" || version == "" {
+		http.Error(w, "module must be given as path@version", http.StatusBadRequest)
+		return
+	}
+
+	if !s.auditRequest(w, r, "") {
+		return
+	}
+
+	if !s.ReleaseQuarantine(module.Version{Path: path, Version: version}) {
+		http.Error(w, "module version is not quarantined", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,87 @@
+package sumdb_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestSecondaryUpstream(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	primary, secondary := newFakeProxy(t), newFakeProxy(t)
+	store := newMemStore()
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(primary.upstream(t)),
+		WithSecondaryUpstream(secondary.upstream(t)),
+		WithAdminIdentity(IdentityFunc(func(*http.Request) (Identity, error) {
+			return Identity{Subject: "ops", Role: RoleOperator}, nil
+		})),
+	)
+	require.NoError(t, err)
+
+	t.Run("appends when both upstreams agree", func(t *testing.T) {
+		mod := module.Version{Path: "example.com/good", Version: "v1.0.0"}
+		_, err := db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+		require.Contains(t, secondary.requested(), "/example.com/good/@v/v1.0.0.zip")
+	})
+
+	t.Run("quarantines disagreements", func(t *testing.T) {
+		mod := module.Version{Path: "example.com/bad", Version: "v1.0.0"}
+		secondary.setTampered(mod, true)
+
+		_, err := db.Lookup(t.Context(), mod)
+		require.ErrorIs(t, err, ErrUpstreamMismatch)
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(1), size)
+
+		quarantined := db.Quarantined()
+		require.Len(t, quarantined, 1)
+		require.Equal(t, "example.com/bad", quarantined[0].Path)
+		require.NotEqual(t, quarantined[0].Primary, quarantined[0].Secondary)
+
+		// Quarantined versions aren't fetched again.
+		requests := len(primary.requested())
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/bad@v1.0.0", nil))
+		require.Equal(t, http.StatusBadGateway, rec.Code)
+		require.Len(t, primary.requested(), requests)
+	})
+
+	t.Run("admin API", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		db.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/quarantine", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var quarantined []QuarantinedVersion
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&quarantined))
+		require.Len(t, quarantined, 1)
+
+		// Once the upstreams agree again, the released version can be appended.
+		mod := module.Version{Path: "example.com/bad", Version: "v1.0.0"}
+		secondary.setTampered(mod, false)
+
+		rec = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/quarantine?module=example.com/bad@v1.0.0", nil)
+		db.AdminHandler().ServeHTTP(rec, req)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		require.Empty(t, db.Quarantined())
+
+		_, err := db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+
+		rec = httptest.NewRecorder()
+		db.AdminHandler().ServeHTTP(rec, req)
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
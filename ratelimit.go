@@ -0,0 +1,191 @@
+package sumdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+// appendLimiter caps the number of records appended in any window of length per. Callers that would exceed the cap
+// queue up, in order, until the oldest appends leave the window.
+type appendLimiter struct {
+	n     int
+	per   time.Duration
+	clock Clock
+
+	// turn is held by the caller at the head of the queue.
+	turn chan struct{}
+
+	mu    sync.Mutex
+	times []time.Time // times of the appends in the current window, oldest first
+}
+
+func newAppendLimiter(n int, per time.Duration, clock Clock) *appendLimiter {
+	return &appendLimiter{n: n, per: per, clock: clock, turn: make(chan struct{}, 1)}
+}
+
+// wait blocks until k appends can be made without exceeding the limit and reserves them. k must not be greater than
+// the limit. A nil limiter never blocks.
+func (l *appendLimiter) wait(ctx context.Context, k int) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l.turn <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-l.turn }()
+
+	for {
+		d := l.reserve(k)
+		if d <= 0 {
+			return nil
+		}
+		if !sleep(ctx, l.clock, d) {
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve reserves k appends if they fit in the current window. Otherwise it returns how long to wait before trying
+// again.
+func (l *appendLimiter) reserve(k int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	expired := 0
+	for expired < len(l.times) && now.Sub(l.times[expired]) >= l.per {
+		expired++
+	}
+	l.times = l.times[expired:]
+
+	if excess := len(l.times) + k - l.n; excess > 0 {
+		return l.times[excess-1].Add(l.per).Sub(now)
+	}
+
+	for range k {
+		l.times = append(l.times, now)
+	}
+	return 0
+}
+
+// release returns k reserved appends that weren't made.
+func (l *appendLimiter) release(k int) {
+	if l == nil || k <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.times = l.times[:max(len(l.times)-k, 0)]
+}
+
+// upstreamLimiter is a token bucket capping the rate of fetches from the upstreams at rate per second, with bursts of
+// up to burst fetches. Callers that would exceed the rate queue up, in order, until a token is available.
+type upstreamLimiter struct {
+	rate  float64
+	burst float64
+	clock Clock
+
+	// turn is held by the caller at the head of the queue.
+	turn chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time // when tokens was last updated
+}
+
+func newUpstreamLimiter(rate float64, burst int, clock Clock) *upstreamLimiter {
+	b := float64(max(burst, 1))
+	return &upstreamLimiter{
+		rate:   rate,
+		burst:  b,
+		clock:  clock,
+		turn:   make(chan struct{}, 1),
+		tokens: b,
+		last:   clock.Now(),
+	}
+}
+
+// wait blocks until a fetch can be made without exceeding the rate and takes a token for it. A nil limiter never
+// blocks.
+func (l *upstreamLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l.turn <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-l.turn }()
+
+	for {
+		d := l.take()
+		if d <= 0 {
+			return nil
+		}
+		if !sleep(ctx, l.clock, d) {
+			return ctx.Err()
+		}
+	}
+}
+
+// take takes a token if one is available. Otherwise it returns how long until one is.
+func (l *upstreamLimiter) take() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = min(l.tokens+elapsed.Seconds()*l.rate, l.burst)
+		l.last = now
+	}
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return max(time.Duration((1-l.tokens)/l.rate*float64(time.Second)), time.Millisecond)
+}
+
+// waitUpstream waits for the upstream rate limit (if any) before fetching mod.
+func (s *SumDB) waitUpstream(ctx context.Context, mod module.Version) error {
+	if err := s.upstreamLimit.wait(ctx); err != nil {
+		return fmt.Errorf("failed waiting for the upstream rate limit: %s, %w", mod, err)
+	}
+	return nil
+}
+
+// limitedImport imports recs (see importRecords), waiting for the append limit (if any) before each batch.
+func (s *SumDB) limitedImport(ctx context.Context, recs []*Record, fetched bool) (int64, error) {
+	if s.appendLimit == nil {
+		return s.importRecords(ctx, recs, fetched)
+	}
+
+	var added int64
+	for len(recs) > 0 {
+		batch := recs[:min(len(recs), s.appendLimit.n)]
+		recs = recs[len(batch):]
+
+		if err := s.appendLimit.wait(ctx, len(batch)); err != nil {
+			return added, err
+		}
+
+		n, err := s.importRecords(ctx, batch, fetched)
+		s.appendLimit.release(len(batch) - int(n))
+		added += n
+		if err != nil {
+			return added, err
+		}
+	}
+
+	return added, nil
+}
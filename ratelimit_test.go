@@ -0,0 +1,133 @@
+package sumdb_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestAppendLimit(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	const window = 200 * time.Millisecond
+
+	t.Run("queues lookups over the limit", func(t *testing.T) {
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithAppendLimit(2, window),
+		)
+		require.NoError(t, err)
+
+		start := time.Now()
+		for i := range 3 {
+			_, err := db.Lookup(t.Context(), module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"})
+			require.NoError(t, err)
+		}
+		require.GreaterOrEqual(t, time.Since(start), window)
+
+		// Existing records aren't appended, so they're never limited.
+		start = time.Now()
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/mod0", Version: "v1.0.0"})
+		require.NoError(t, err)
+		require.Less(t, time.Since(start), window)
+	})
+
+	t.Run("queued lookups honor their context", func(t *testing.T) {
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(newFakeProxy(t).upstream(t)),
+			WithAppendLimit(1, time.Hour),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+		_, err = db.Lookup(ctx, module.Version{Path: "example.com/b", Version: "v1.0.0"})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("throttles imports", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTileSnapshot(t, dir, skey, 300)
+
+		db, err := New("test.example.com", skey, WithStore(newMemStore()), WithAppendLimit(100, window))
+		require.NoError(t, err)
+
+		start := time.Now()
+		added, err := db.ImportTiles(t.Context(), dir, vkey)
+		require.NoError(t, err)
+		require.Equal(t, int64(300), added)
+		require.GreaterOrEqual(t, time.Since(start), 2*window)
+
+		// Re-importing doesn't append anything, so it's only limited by the records imported above.
+		time.Sleep(window)
+		start = time.Now()
+		added, err = db.ImportTiles(t.Context(), dir, vkey)
+		require.NoError(t, err)
+		require.Zero(t, added)
+		require.Less(t, time.Since(start), 2*window)
+	})
+}
+
+func TestUpstreamRateLimit(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	t.Run("queues fetches over the limit", func(t *testing.T) {
+		upstream := newFakeProxy(t)
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(upstream.upstream(t)),
+			WithUpstreamRateLimit(10, 2),
+		)
+		require.NoError(t, err)
+
+		// The first two fetches use up the burst, and the others wait 100ms each.
+		start := time.Now()
+		for i := range 4 {
+			_, err := db.Lookup(t.Context(), module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"})
+			require.NoError(t, err)
+		}
+		require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+		// Existing records aren't fetched, so they're never limited.
+		requests := len(upstream.requested())
+		start = time.Now()
+		for range 10 {
+			_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/mod0", Version: "v1.0.0"})
+			require.NoError(t, err)
+		}
+		require.Less(t, time.Since(start), 100*time.Millisecond)
+		require.Len(t, upstream.requested(), requests)
+	})
+
+	t.Run("queued lookups honor their context", func(t *testing.T) {
+		upstream := newFakeProxy(t)
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(upstream.upstream(t)),
+			WithUpstreamRateLimit(0.001, 1),
+		)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+		require.NoError(t, err)
+
+		requests := len(upstream.requested())
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+		_, err = db.Lookup(ctx, module.Version{Path: "example.com/b", Version: "v1.0.0"})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Len(t, upstream.requested(), requests)
+	})
+}
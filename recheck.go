@@ -0,0 +1,338 @@
+package sumdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pseudomuto/sumdb/alert"
+	"github.com/pseudomuto/sumdb/internal/proxy"
+	"github.com/pseudomuto/sumdb/internal/sumdbclient"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+const (
+	// recheckJob is the name of the built-in maintenance job rechecking sampled records. See WithRecheckSampling.
+	recheckJob = "recheck"
+
+	// recheckAnnotation is the annotation holding a record's most recent recheck receipt.
+	recheckAnnotation = "recheck"
+
+	recheckHeader = "sumdb recheck receipt"
+)
+
+// Results of rechecking a record, used as the result label of sumdb_rechecks_total.
+const (
+	// RecheckMatch means the upstream still serves the hashes in the record.
+	RecheckMatch RecheckResult = "match"
+
+	// RecheckMismatch means the upstream now serves different hashes than the ones in the record.
+	RecheckMismatch RecheckResult = "mismatch"
+
+	// RecheckUnavailable means the upstream no longer has the module version.
+	RecheckUnavailable RecheckResult = "unavailable"
+)
+
+// ErrInvalidRecheckReceipt is returned by VerifyRecheckReceipt when a receipt's signature or contents are invalid.
+var ErrInvalidRecheckReceipt = errors.New("invalid recheck receipt")
+
+type (
+	// RecheckResult is the outcome of rechecking a record against its upstream.
+	RecheckResult string
+
+	// RecheckReceipt is evidence that a record was fetched again from its upstream after it was appended, and of what
+	// the upstream served. Receipts are signed notes, kept as the record's "recheck" annotation when the Store
+	// implements AnnotationStore.
+	RecheckReceipt struct {
+		ID      int64
+		Path    string
+		Version string
+
+		// Hash is the record hash of the data in the log.
+		Hash tlog.Hash
+
+		Time   time.Time
+		Result RecheckResult
+
+		// Computed is when the hashes the record was compared with were computed, if the upstream was down and they
+		// were the ones computed when it was last fetched (see WithUpstreamFailback). It's zero when they were fetched
+		// for the recheck.
+		Computed time.Time
+	}
+
+	// recheckCoverage tracks the records rechecked since the server started.
+	recheckCoverage struct {
+		mu      sync.Mutex
+		checked []uint64 // bitset of record IDs
+		count   int64
+	}
+)
+
+// Recheck fetches the record with the given ID from its upstream again, recomputing its hashes, and compares them with
+// the log. It returns a signed receipt of the result, which is also stored as the record's "recheck" annotation when
+// the Store implements AnnotationStore.
+//
+// Records whose hashes no longer match raise a critical alert, but the log is left as it is: recorded hashes are never
+// changed. It returns ErrNotFound if the record doesn't exist, and an error if the upstream couldn't be reached, in
+// which case no receipt is issued, unless WithUpstreamFailback is used and the hashes computed when the record was last
+// fetched are still kept, in which case the receipt is marked with when they were computed.
+func (s *SumDB) Recheck(ctx context.Context, id int64) (*RecheckReceipt, error) {
+	size, err := s.store.TreeSize(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree size: %w", err)
+	}
+	if id < 0 || id >= size {
+		return nil, ErrNotFound
+	}
+
+	recs, err := s.store.Records(ctx, id, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record: %d, %w", id, err)
+	}
+	if len(recs) != 1 {
+		return nil, fmt.Errorf("failed to read record: %d, %w", id, ErrNotFound)
+	}
+
+	rec := recs[0]
+	mod := module.Version{Path: rec.Path, Version: rec.Version}
+	result, fetched, computed, err := s.refetch(ctx, mod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recheck record: %d, %w", id, err)
+	}
+	if result == RecheckMatch && !bytes.Equal(rec.Data, fetched) {
+		result = RecheckMismatch
+		summary := fmt.Sprintf("the upstream no longer serves the recorded hashes for %s", mod)
+		if !computed.IsZero() {
+			summary = fmt.Sprintf("the recorded hashes for %s don't match those last computed from the upstream", mod)
+		}
+		s.raise(ctx, &alert.Alert{
+			Source:   alertSourceRecheck,
+			Severity: alert.Critical,
+			Summary:  summary,
+			Details: map[string]string{
+				"module":   mod.String(),
+				"id":       strconv.FormatInt(id, 10),
+				"recorded": string(rec.Data),
+				"upstream": string(fetched),
+			},
+		})
+	}
+
+	receipt := &RecheckReceipt{
+		ID:      id,
+		Path:    rec.Path,
+		Version: rec.Version,
+		Hash:    tlog.RecordHash(rec.Data),
+		Time:    s.clock.Now().UTC(),
+		Result:  result,
+	}
+	if !computed.IsZero() {
+		receipt.Computed = computed.UTC()
+	}
+
+	signed, err := note.Sign(&note.Note{Text: receipt.text()}, s.auditSigner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign recheck receipt: %w", err)
+	}
+
+	if as, ok := s.store.(AnnotationStore); ok {
+		if err := as.SetAnnotation(ctx, id, recheckAnnotation, string(signed)); err != nil {
+			return nil, fmt.Errorf("failed to annotate record: %d, %w", id, err)
+		}
+	}
+
+	s.observeRecheck(id, size, result)
+	return receipt, nil
+}
+
+// refetch fetches mod through its ingest route, bypassing the negative cache and quarantine, and returns its
+// normalized record data. The result is RecheckUnavailable if the upstream doesn't have mod, and RecheckMatch
+// otherwise, for the caller to compare the data with the log.
+//
+// If the upstream is down, the data last computed from it is returned instead, if it's still kept, along with when it
+// was computed.
+func (s *SumDB) refetch(ctx context.Context, mod module.Version) (RecheckResult, []byte, time.Time, error) {
+	route := s.routeFor(mod)
+	err := s.checkUpstream(route.source)
+	if err == nil {
+		err = s.waitUpstream(ctx, mod)
+	}
+	if err == nil {
+		var rec *Record
+		rec, err = route.record(ctx, route.proxy, mod)
+		err = s.observeUpstream(ctx, route.source, err)
+		if errors.Is(err, proxy.ErrNotFound) || errors.Is(err, sumdbclient.ErrNotFound) {
+			return RecheckUnavailable, nil, time.Time{}, nil
+		}
+		if err == nil {
+			data, err := NormalizeRecordData(mod, rec.Data)
+			if err != nil {
+				return "", nil, time.Time{}, err
+			}
+			s.failback.remember(s.clock.Now(), mod, data)
+			return RecheckMatch, data, time.Time{}, nil
+		}
+	}
+
+	if errors.Is(err, ErrUpstreamUnavailable) {
+		if c, ok := s.failback.recall(mod); ok {
+			return RecheckMatch, c.data, c.at, nil
+		}
+	}
+	return "", nil, time.Time{}, err
+}
+
+// recheckSample rechecks up to n records picked at random from the tree.
+func (s *SumDB) recheckSample(ctx context.Context, n int) error {
+	size, err := s.store.TreeSize(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get tree size: %w", err)
+	}
+
+	var errs []error
+	for _, id := range sampleIDs(size, n) {
+		if _, err := s.Recheck(ctx, id); err != nil {
+			errs = append(errs, err)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sampleIDs returns up to n distinct IDs picked at random from [0, size).
+func sampleIDs(size int64, n int) []int64 {
+	if int64(n) >= size {
+		ids := make([]int64, size)
+		for i := range ids {
+			ids[i] = int64(i)
+		}
+		return ids
+	}
+
+	picked := make(map[int64]bool, n)
+	ids := make([]int64, 0, n)
+	for len(ids) < n {
+		id := rand.Int64N(size)
+		if !picked[id] {
+			picked[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// VerifyRecheckReceipt verifies a signed recheck receipt, as stored in a record's "recheck" annotation, against the
+// verifier key vkey (the audit key, if one was set with WithAuditKey) and returns the parsed receipt.
+//
+// It returns an error wrapping ErrInvalidRecheckReceipt if the signature or contents are invalid. Callers should also
+// check that the receipt's hash matches the record in the log.
+func VerifyRecheckReceipt(vkey string, msg []byte) (*RecheckReceipt, error) {
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verifier key: %w", err)
+	}
+
+	n, err := note.Open(msg, note.VerifierList(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRecheckReceipt, err)
+	}
+
+	receipt, err := parseRecheckReceipt(n.Text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRecheckReceipt, err)
+	}
+	return receipt, nil
+}
+
+// text returns the note text for the receipt.
+func (r *RecheckReceipt) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", recheckHeader)
+	fmt.Fprintf(&b, "id %d\n", r.ID)
+	fmt.Fprintf(&b, "module %s %s\n", r.Path, r.Version)
+	fmt.Fprintf(&b, "hash %s\n", r.Hash)
+	fmt.Fprintf(&b, "time %s\n", r.Time.Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "result %s\n", r.Result)
+	if !r.Computed.IsZero() {
+		fmt.Fprintf(&b, "computed %s\n", r.Computed.Format(time.RFC3339Nano))
+	}
+	return b.String()
+}
+
+func parseRecheckReceipt(text string) (*RecheckReceipt, error) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if (len(lines) != 6 && len(lines) != 7) || lines[0] != recheckHeader {
+		return nil, errors.New("malformed recheck receipt")
+	}
+
+	fields := make(map[string]string, len(lines)-1)
+	for _, line := range lines[1:] {
+		k, v, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("malformed recheck receipt line: %q", line)
+		}
+		fields[k] = v
+	}
+
+	var (
+		r   RecheckReceipt
+		err error
+	)
+
+	if r.ID, err = strconv.ParseInt(fields["id"], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid id: %w", err)
+	}
+
+	var ok bool
+	if r.Path, r.Version, ok = strings.Cut(fields["module"], " "); !ok {
+		return nil, fmt.Errorf("invalid module: %q", fields["module"])
+	}
+	if r.Hash, err = tlog.ParseHash(fields["hash"]); err != nil {
+		return nil, fmt.Errorf("invalid hash: %w", err)
+	}
+	if r.Time, err = time.Parse(time.RFC3339Nano, fields["time"]); err != nil {
+		return nil, fmt.Errorf("invalid time: %w", err)
+	}
+
+	switch r.Result = RecheckResult(fields["result"]); r.Result {
+	case RecheckMatch, RecheckMismatch, RecheckUnavailable:
+	default:
+		return nil, fmt.Errorf("invalid result: %q", r.Result)
+	}
+
+	if computed, ok := fields["computed"]; ok {
+		if r.Computed, err = time.Parse(time.RFC3339Nano, computed); err != nil {
+			return nil, fmt.Errorf("invalid computed time: %w", err)
+		}
+	} else if len(lines) == 7 {
+		return nil, errors.New("malformed recheck receipt")
+	}
+
+	return &r, nil
+}
+
+// add marks id as rechecked, returning the number of distinct records rechecked.
+func (c *recheckCoverage) add(id int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	word, bit := id/64, uint64(1)<<(id%64)
+	if n := word + 1; n > int64(len(c.checked)) {
+		c.checked = append(c.checked, make([]uint64, n-int64(len(c.checked)))...)
+	}
+	if c.checked[word]&bit == 0 {
+		c.checked[word] |= bit
+		c.count++
+	}
+	return c.count
+}
@@ -0,0 +1,145 @@
+package sumdb_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/alert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestRecheck(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	upstream := newFakeProxy(t)
+	store := newAnnotatedStore(t, 0)
+	alerts := make(chan *alert.Alert, 10)
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(upstream.upstream(t)),
+		WithClock(ClockFunc(func() time.Time { return now })),
+		WithRecheckSampling(10, time.Hour),
+		WithAlerter(alert.Func(func(_ context.Context, a *alert.Alert) error {
+			alerts <- a
+			return nil
+		})),
+	)
+	require.NoError(t, err)
+
+	mods := []module.Version{
+		{Path: "example.com/a", Version: "v1.0.0"},
+		{Path: "example.com/b", Version: "v1.0.0"},
+		{Path: "example.com/c", Version: "v1.0.0"},
+	}
+	_, err = db.AddRecords(t.Context(), mods)
+	require.NoError(t, err)
+
+	// verify returns the receipt stored in the record's annotations.
+	verify := func(t *testing.T, id int64) *RecheckReceipt {
+		t.Helper()
+
+		annotations, err := db.Annotations(t.Context(), id)
+		require.NoError(t, err)
+		receipt, err := VerifyRecheckReceipt(vkey, []byte(annotations["recheck"]))
+		require.NoError(t, err)
+		return receipt
+	}
+
+	t.Run("match", func(t *testing.T) {
+		receipt, err := db.Recheck(t.Context(), 0)
+		require.NoError(t, err)
+
+		recs, err := store.Records(t.Context(), 0, 1)
+		require.NoError(t, err)
+		require.Equal(t, &RecheckReceipt{
+			ID:      0,
+			Path:    "example.com/a",
+			Version: "v1.0.0",
+			Hash:    tlog.RecordHash(recs[0].Data),
+			Time:    now,
+			Result:  RecheckMatch,
+		}, receipt)
+		require.Equal(t, receipt, verify(t, 0))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		upstream.setTampered(mods[1], true)
+		t.Cleanup(func() { upstream.setTampered(mods[1], false) })
+
+		receipt, err := db.Recheck(t.Context(), 1)
+		require.NoError(t, err)
+		require.Equal(t, RecheckMismatch, receipt.Result)
+		require.Equal(t, receipt, verify(t, 1))
+
+		select {
+		case a := <-alerts:
+			require.Equal(t, "recheck", a.Source)
+			require.Equal(t, alert.Critical, a.Severity)
+			require.Equal(t, "example.com/b@v1.0.0", a.Details["module"])
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no alert raised")
+		}
+
+		// The log is left as it is.
+		_, err = db.Lookup(t.Context(), mods[1])
+		require.NoError(t, err)
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		upstream.setMissing(mods[2], true)
+		t.Cleanup(func() { upstream.setMissing(mods[2], false) })
+
+		receipt, err := db.Recheck(t.Context(), 2)
+		require.NoError(t, err)
+		require.Equal(t, RecheckUnavailable, receipt.Result)
+		require.Equal(t, receipt, verify(t, 2))
+	})
+
+	t.Run("missing records", func(t *testing.T) {
+		_, err := db.Recheck(t.Context(), 3)
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("sampling", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		require.NoError(t, db.RunMaintenanceJob(t.Context(), "recheck"))
+
+		for id := range int64(len(mods)) {
+			receipt := verify(t, id)
+			require.Equal(t, now, receipt.Time)
+			require.Equal(t, RecheckMatch, receipt.Result)
+		}
+
+		rec := httptest.NewRecorder()
+		db.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Contains(t, rec.Body.String(), `sumdb_rechecks_total{result="match"} 4`)
+		require.Contains(t, rec.Body.String(), `sumdb_rechecks_total{result="mismatch"} 1`)
+		require.Contains(t, rec.Body.String(), `sumdb_rechecks_total{result="unavailable"} 1`)
+		require.Contains(t, rec.Body.String(), "sumdb_rechecked_records 3\n")
+		require.Contains(t, rec.Body.String(), "sumdb_recheck_coverage_ratio 1\n")
+	})
+
+	t.Run("invalid receipts", func(t *testing.T) {
+		annotations, err := db.Annotations(t.Context(), 0)
+		require.NoError(t, err)
+		signed := annotations["recheck"]
+
+		_, otherVKey, err := GenerateKeys("test.example.com")
+		require.NoError(t, err)
+		_, err = VerifyRecheckReceipt(otherVKey, []byte(signed))
+		require.ErrorIs(t, err, ErrInvalidRecheckReceipt)
+
+		tampered := strings.Replace(signed, "result match", "result mismatch", 1)
+		_, err = VerifyRecheckReceipt(vkey, []byte(tampered))
+		require.ErrorIs(t, err, ErrInvalidRecheckReceipt)
+	})
+}
@@ -0,0 +1,93 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/pseudomuto/sumdb/internal/bloom"
+)
+
+// recordFilterBatchSize is the number of records read from the store at a time while loading the record filter.
+const recordFilterBatchSize = 1000
+
+// Record filter results, used as the result label of sumdb_record_filter_checks_total.
+const (
+	filterAbsent        = "absent"
+	filterPresent       = "present"
+	filterFalsePositive = "false_positive"
+)
+
+// ErrNoRecordFilter is returned by LoadRecordFilter when no filter was configured with WithRecordFilter.
+var ErrNoRecordFilter = errors.New("no record filter configured")
+
+// recordFilter is a Bloom filter over the module versions with records, so that lookups for the others can skip the
+// store. It's only consulted once loaded, but records appended in the meantime are added to it. See WithRecordFilter.
+type recordFilter struct {
+	filter *bloom.Filter
+	loaded atomic.Bool
+}
+
+func newRecordFilter(n int64, p float64) *recordFilter {
+	return &recordFilter{filter: bloom.New(n, p)}
+}
+
+// add adds the module version path@version. It's a no-op on a nil filter.
+func (f *recordFilter) add(path, version string) {
+	if f != nil {
+		f.filter.Add(path + "@" + version)
+	}
+}
+
+// isLoaded reports whether the filter is loaded, and so consulted. It's false on a nil filter.
+func (f *recordFilter) isLoaded() bool {
+	return f != nil && f.loaded.Load()
+}
+
+// absent reports whether path@version definitely has no record. It's always false on a nil or unloaded filter.
+func (f *recordFilter) absent(path, version string) bool {
+	return f.isLoaded() && !f.filter.MayContain(path+"@"+version)
+}
+
+// LoadRecordFilter adds every record in the store to the filter configured with WithRecordFilter, after which lookups
+// consult it. It should be called once the server starts, and returns ErrNoRecordFilter if no filter was configured.
+func (s *SumDB) LoadRecordFilter(ctx context.Context) error {
+	f := s.recordFilter
+	if f == nil {
+		return ErrNoRecordFilter
+	}
+
+	// Records appended from now on are added by the appends themselves.
+	size, err := s.store.TreeSize(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get tree size: %w", err)
+	}
+
+	for id := int64(0); id < size; {
+		recs, err := s.store.Records(ctx, id, min(recordFilterBatchSize, size-id))
+		if err != nil {
+			return fmt.Errorf("failed to get records: [%d, %d), %w", id, size, err)
+		}
+		if len(recs) == 0 {
+			return fmt.Errorf("failed to get records: [%d, %d), %w", id, size, ErrNotFound)
+		}
+
+		for _, r := range recs {
+			f.add(r.Path, r.Version)
+		}
+		id += int64(len(recs))
+	}
+
+	f.loaded.Store(true)
+	s.observeRecordFilterRate()
+	return nil
+}
+
+// recordAdded adds path@version, which has a record, to the record filter if there is one.
+func (s *SumDB) recordAdded(path, version string) {
+	if s.recordFilter != nil {
+		s.recordFilter.add(path, version)
+		s.observeRecordFilterRate()
+	}
+}
@@ -0,0 +1,87 @@
+package sumdb_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+// recordIDStore is a Store counting its RecordID queries.
+type recordIDStore struct {
+	Store
+	queries atomic.Int64
+}
+
+func (s *recordIDStore) RecordID(ctx context.Context, path, version string) (int64, error) {
+	s.queries.Add(1)
+	return s.Store.RecordID(ctx, path, version)
+}
+
+func TestRecordFilter(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t).upstream(t)
+	store := &recordIDStore{Store: newMemStore()}
+
+	// Another server sharing the store appends records before, and after, the filter is loaded.
+	other, err := New("test.example.com", skey, WithStore(store), WithUpstream(upstream))
+	require.NoError(t, err)
+	existing, err := other.Lookup(t.Context(), module.Version{Path: "example.com/existing", Version: "v1.0.0"})
+	require.NoError(t, err)
+
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(upstream),
+		WithRecordFilter(100, 0.01),
+	)
+	require.NoError(t, err)
+	require.NoError(t, db.LoadRecordFilter(t.Context()))
+
+	// lookup looks path@v1.0.0 up, returning its ID and the number of RecordID queries it made.
+	lookup := func(t *testing.T, path string) (int64, int64) {
+		t.Helper()
+
+		before := store.queries.Load()
+		id, err := db.Lookup(t.Context(), module.Version{Path: path, Version: "v1.0.0"})
+		require.NoError(t, err)
+		return id, store.queries.Load() - before
+	}
+
+	// Existing records are found in the store, and new ones skip straight to the double-check before appending.
+	id, queries := lookup(t, "example.com/existing")
+	require.Equal(t, existing, id)
+	require.Equal(t, int64(1), queries)
+
+	_, queries = lookup(t, "example.com/new")
+	require.Equal(t, int64(1), queries)
+	_, queries = lookup(t, "example.com/new")
+	require.Equal(t, int64(1), queries)
+
+	// Records the other server appended later aren't in the filter, but the double-check finds them.
+	later, err := other.Lookup(t.Context(), module.Version{Path: "example.com/later", Version: "v1.0.0"})
+	require.NoError(t, err)
+	id, _ = lookup(t, "example.com/later")
+	require.Equal(t, later, id)
+
+	size, err := store.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(3), size)
+
+	rec := httptest.NewRecorder()
+	db.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	require.Contains(t, body, `sumdb_record_filter_checks_total{result="absent"} 2`)
+	require.Contains(t, body, `sumdb_record_filter_checks_total{result="present"} 2`)
+	require.Contains(t, body, `sumdb_record_filter_false_positive_ratio `)
+
+	t.Run("not configured", func(t *testing.T) {
+		require.ErrorIs(t, other.LoadRecordFilter(t.Context()), ErrNoRecordFilter)
+	})
+}
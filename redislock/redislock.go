@@ -0,0 +1,154 @@
+// Package redislock implements a sumdb.Locker backed by Redis, for SumDB instances sharing a Store that doesn't
+// serialize appends across servers itself.
+//
+//	client := redis.NewClient(&redis.Options{Addr: "redis.example.com:6379"})
+//	db, err := sumdb.New("sum.example.com", skey,
+//		sumdb.WithStore(store),
+//		sumdb.WithLocker(redislock.New(client, "sumdb:append")),
+//	)
+//
+// The lock is a key holding a random token, set only if it doesn't exist and deleted only by its holder. It expires
+// after a TTL, so that a server crashing while holding it doesn't stop the others from appending, and is refreshed
+// while it's held. This is Redis' single instance locking algorithm: it isn't safe across a failover of the Redis
+// server, which could briefly let two servers append at once. Stores should still reject duplicate records and
+// conflicting tree sizes.
+package redislock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultTTL is how long the lock is held without being refreshed, unless set with WithTTL.
+	DefaultTTL = 30 * time.Second
+
+	// minPoll and maxPoll bound how often a server waiting for the lock checks whether it's free.
+	minPoll = 5 * time.Millisecond
+	maxPoll = 200 * time.Millisecond
+)
+
+var (
+	// ErrLockLost is returned when releasing a lock that expired or was taken over while it was held, e.g. because
+	// refreshing it failed for longer than its TTL.
+	ErrLockLost = errors.New("redislock: lock was lost")
+
+	// release deletes the key if it still holds the token.
+	release = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+	// refresh extends the key's TTL (in milliseconds) if it still holds the token.
+	refresh = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+type (
+	// Locker is a sumdb.Locker backed by a Redis key. It's safe for concurrent use.
+	Locker struct {
+		client redis.UniversalClient
+		key    string
+		ttl    time.Duration
+	}
+
+	// Option customizes a Locker.
+	Option func(*Locker)
+)
+
+// New returns a Locker using key on the Redis server client connects to. Every server appending to the same log must
+// use the same key.
+func New(client redis.UniversalClient, key string, opts ...Option) *Locker {
+	l := &Locker{client: client, key: key, ttl: DefaultTTL}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// WithTTL sets how long the lock is held without being refreshed. Held locks are refreshed every third of d, so it only
+// bounds how long the others wait for a server that crashed while holding it. Defaults to DefaultTTL.
+func WithTTL(d time.Duration) Option {
+	return func(l *Locker) { l.ttl = d }
+}
+
+// Lock implements sumdb.Locker. It polls the key until it's free or ctx is done, and refreshes it until the returned
+// function is called. The function returns ErrLockLost if the lock expired in the meantime.
+func (l *Locker) Lock(ctx context.Context) (func() error, error) {
+	var buf [16]byte
+	_, _ = rand.Read(buf[:])
+	token := hex.EncodeToString(buf[:])
+
+	for poll := minPoll; ; poll = min(2*poll, maxPoll) {
+		ok, err := l.client.SetNX(ctx, l.key, token, l.ttl).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to take lock: %s, %w", l.key, err)
+		}
+		if ok {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed waiting for lock: %s, %w", l.key, ctx.Err())
+		case <-time.After(poll):
+		}
+	}
+
+	done := make(chan struct{})
+	refreshed := make(chan struct{})
+	go func() {
+		defer close(refreshed)
+		l.refresh(token, done)
+	}()
+
+	var (
+		once sync.Once
+		err  error
+	)
+	return func() error {
+		once.Do(func() {
+			close(done)
+			<-refreshed
+
+			// The lock is released even if the caller's context is done.
+			var n int64
+			n, err = release.Run(context.Background(), l.client, []string{l.key}, token).Int64()
+			if err != nil {
+				err = fmt.Errorf("failed to release lock: %s, %w", l.key, err)
+			} else if n == 0 {
+				err = fmt.Errorf("%w: %s", ErrLockLost, l.key)
+			}
+		})
+		return err
+	}, nil
+}
+
+// refresh extends the lock's TTL every third of it until done is closed. Failures are retried at the next refresh;
+// a lock that's lost is reported when it's released.
+func (l *Locker) refresh(token string, done <-chan struct{}) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			_ = refresh.Run(ctx, l.client, []string{l.key}, token, l.ttl.Milliseconds()).Err()
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package redislock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/pseudomuto/sumdb/redislock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocker(t *testing.T) {
+	t.Run("excludes other holders", func(t *testing.T) {
+		_, client := newTestRedis(t)
+		a, b := New(client, "sumdb:append"), New(client, "sumdb:append")
+
+		unlock, err := a.Lock(t.Context())
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+		_, err = b.Lock(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// Waiters take the lock once it's released.
+		locked := make(chan func() error)
+		go func() {
+			unlock, err := b.Lock(t.Context())
+			if err != nil {
+				t.Error(err)
+			}
+			locked <- unlock
+		}()
+
+		require.NoError(t, unlock())
+		require.NoError(t, unlock(), "releasing twice is a no-op")
+		require.NoError(t, (<-locked)())
+	})
+
+	t.Run("expires", func(t *testing.T) {
+		srv, client := newTestRedis(t)
+		l := New(client, "sumdb:append")
+
+		unlock, err := l.Lock(t.Context())
+		require.NoError(t, err)
+
+		// A holder that stopped refreshing the lock (e.g. because it crashed) loses it after its TTL.
+		srv.FastForward(DefaultTTL)
+		other, err := l.Lock(t.Context())
+		require.NoError(t, err)
+
+		require.ErrorIs(t, unlock(), ErrLockLost)
+		require.NoError(t, other())
+	})
+
+	t.Run("refreshes held locks", func(t *testing.T) {
+		srv, client := newTestRedis(t)
+		l := New(client, "sumdb:append", WithTTL(30*time.Millisecond))
+
+		unlock, err := l.Lock(t.Context())
+		require.NoError(t, err)
+
+		srv.FastForward(25 * time.Millisecond)
+		require.Eventually(t, func() bool {
+			return srv.TTL("sumdb:append") > 5*time.Millisecond
+		}, time.Second, 5*time.Millisecond)
+		require.NoError(t, unlock())
+		require.False(t, srv.Exists("sumdb:append"))
+	})
+}
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return srv, client
+}
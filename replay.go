@@ -0,0 +1,412 @@
+package sumdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/proxy"
+	"github.com/pseudomuto/sumdb/internal/sumdbclient"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// ErrReplayDiverged is returned by Replay when re-executing a bundle produces different results than were recorded.
+var ErrReplayDiverged = errors.New("replay diverged from recording")
+
+type (
+	// ReplayBundle captures everything needed to deterministically re-execute a single cold Lookup: the upstream proxy
+	// responses, the hashes read from the store and every store mutation (in order).
+	//
+	// Bundles are produced by SumDB instances configured with WithReplayRecorder and can be re-executed with Replay.
+	ReplayBundle struct {
+		Module     module.Version `json:"module"`
+		Upstream   string         `json:"upstream"`
+		RecordedAt time.Time      `json:"recorded_at"`
+
+		// SecondaryUpstream is the upstream the record was cross-checked with (see WithSecondaryUpstream), and
+		// UpstreamSumDB and UpstreamSumDBKey the checksum database it was checked against (see WithUpstreamSumDB),
+		// if any. Their responses are recorded along with the upstream proxy's.
+		SecondaryUpstream string `json:"secondary_upstream,omitempty"`
+		UpstreamSumDB     string `json:"upstream_sumdb,omitempty"`
+		UpstreamSumDBKey  string `json:"upstream_sumdb_key,omitempty"`
+
+		// ProxyAttempts is the number of attempts proxy requests were given (see WithProxyRetry), if more than one.
+		// Failed attempts are recorded too, and replays retry them without waiting.
+		ProxyAttempts int `json:"proxy_attempts,omitempty"`
+
+		Responses []ReplayResponse `json:"responses"`
+		Ops       []ReplayOp       `json:"ops"`
+		Err       string           `json:"error,omitempty"`
+	}
+
+	// ReplayResponse is a recorded response from the upstream proxy, the secondary upstream or the upstream checksum
+	// database.
+	ReplayResponse struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+		Status int    `json:"status"`
+		Body   []byte `json:"body,omitempty"`
+	}
+
+	// ReplayOp is a recorded Store interaction. Only the fields relevant to Method are set.
+	//
+	//   - ReadHashes: Indexes and the Hashes that were returned
+	//   - AddRecord: Data and the assigned ID
+	//   - WriteHashes: Indexes and Hashes
+	//   - SetTreeSize: Size
+	ReplayOp struct {
+		Method  string   `json:"method"`
+		ID      int64    `json:"id,omitempty"`
+		Size    int64    `json:"size,omitempty"`
+		Data    []byte   `json:"data,omitempty"`
+		Indexes []int64  `json:"indexes,omitempty"`
+		Hashes  [][]byte `json:"hashes,omitempty"`
+	}
+
+	// replayRecorder accumulates a ReplayBundle during a lookup.
+	replayRecorder struct {
+		mu     sync.Mutex
+		bundle ReplayBundle
+	}
+
+	// recordingClient records every response received from the upstreams.
+	recordingClient struct {
+		client proxy.HTTPClient
+		rec    *replayRecorder
+	}
+
+	// recordingStore records reads and mutations made against the wrapped Store.
+	recordingStore struct {
+		Store
+		rec *replayRecorder
+	}
+
+	// replayTransport serves recorded responses in place of the upstream proxy.
+	replayTransport struct {
+		mu        sync.Mutex
+		responses []ReplayResponse
+		used      []bool
+	}
+
+	// replayStore is an in-memory Store seeded with the state observed during recording.
+	replayStore struct {
+		mu      sync.Mutex
+		nextID  int64
+		size    int64
+		records map[string]int64
+		hashes  map[int64]tlog.Hash
+	}
+)
+
+// Replay re-executes the lookup captured in b against an in-memory store seeded with the recorded store state,
+// serving the recorded responses instead of contacting the upstreams.
+//
+// It returns the bundle captured during re-execution. If the store interactions or the final error differ from the
+// recording, the returned error wraps ErrReplayDiverged and describes the first difference.
+func Replay(ctx context.Context, b *ReplayBundle) (*ReplayBundle, error) {
+	var got *ReplayBundle
+	db := newSumDB()
+	db.http = &http.Client{Transport: newReplayTransport(b.Responses)}
+	db.store = newReplayStore(b)
+	db.upstream = b.Upstream
+	db.secondaryUpstream = b.SecondaryUpstream
+	db.upstreamSumDBURL = b.UpstreamSumDB
+	db.upstreamSumDBKey = b.UpstreamSumDBKey
+	db.onReplay = func(rb *ReplayBundle) { got = rb }
+	db.fetchLanes.capacity = db.fetchWorkers
+	if b.ProxyAttempts > 1 {
+		db.proxyRetryAttempts = b.ProxyAttempts
+		db.recordingProxyOpts = []proxy.Option{proxy.WithRetry(b.ProxyAttempts, 0, 0)}
+	}
+
+	db.proxy = proxy.New(db.http, b.Upstream, db.recordingProxyOpts...)
+	if db.secondaryUpstream != "" {
+		db.secondary = proxy.New(db.http, db.secondaryUpstream, db.recordingProxyOpts...)
+	}
+	if err := db.configureRoutes(nil); err != nil {
+		return nil, fmt.Errorf("failed to replay lookup: %s, %w", b.Module, err)
+	}
+
+	if _, err := db.Lookup(ctx, b.Module); err != nil && got == nil {
+		return nil, fmt.Errorf("failed to replay lookup: %s, %w", b.Module, err)
+	}
+
+	if err := compareReplay(b, got); err != nil {
+		return got, err
+	}
+
+	return got, nil
+}
+
+func compareReplay(want, got *ReplayBundle) error {
+	for i := range max(len(want.Ops), len(got.Ops)) {
+		switch {
+		case i >= len(got.Ops):
+			return fmt.Errorf("%w: op %d: missing %s", ErrReplayDiverged, i, want.Ops[i].Method)
+		case i >= len(want.Ops):
+			return fmt.Errorf("%w: op %d: unexpected %s", ErrReplayDiverged, i, got.Ops[i].Method)
+		case !reflect.DeepEqual(want.Ops[i], got.Ops[i]):
+			return fmt.Errorf("%w: op %d: %s differs", ErrReplayDiverged, i, want.Ops[i].Method)
+		}
+	}
+
+	if want.Err != got.Err {
+		return fmt.Errorf("%w: error: want %q, got %q", ErrReplayDiverged, want.Err, got.Err)
+	}
+
+	return nil
+}
+
+func newReplayRecorder(now time.Time, mod module.Version, upstream string) *replayRecorder {
+	return &replayRecorder{
+		bundle: ReplayBundle{
+			Module:     mod,
+			Upstream:   upstream,
+			RecordedAt: now,
+		},
+	}
+}
+
+func (r *replayRecorder) client(c proxy.HTTPClient) proxy.HTTPClient {
+	return &recordingClient{client: c, rec: r}
+}
+
+// recordingUpstreams returns the clients for fetching a record through the route r that record their responses with
+// rec. Their proxies retry like the others (see WithProxyRetry), but recordings don't capture request headers, so zips
+// are fetched whole rather than with range requests (see WithZipRangeRequests), to be replayable.
+func (s *SumDB) recordingUpstreams(rec *replayRecorder, r *ingestRoute) (fetchUpstreams, error) {
+	client := rec.client(s.http)
+	u := fetchUpstreams{proxy: proxy.New(client, r.upstream, s.recordingProxyOpts...)}
+	if s.proxyRetryAttempts > 1 {
+		rec.bundle.ProxyAttempts = s.proxyRetryAttempts
+	}
+
+	if s.secondary != nil {
+		rec.bundle.SecondaryUpstream = s.secondaryUpstream
+		u.secondary = proxy.New(client, s.secondaryUpstream, s.recordingProxyOpts...)
+	}
+
+	if s.upstreamSumDB != nil {
+		c, err := sumdbclient.New(client, s.upstreamSumDBURL, s.upstreamSumDBKey)
+		if err != nil {
+			return fetchUpstreams{}, fmt.Errorf("invalid upstream sumdb: %w", err)
+		}
+		rec.bundle.UpstreamSumDB, rec.bundle.UpstreamSumDBKey = s.upstreamSumDBURL, s.upstreamSumDBKey
+		u.sumdb = c
+	}
+	return u, nil
+}
+
+func (r *replayRecorder) store(s Store) Store {
+	return &recordingStore{Store: s, rec: r}
+}
+
+func (r *replayRecorder) addResponse(resp ReplayResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bundle.Responses = append(r.bundle.Responses, resp)
+}
+
+func (r *replayRecorder) addOp(op ReplayOp) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bundle.Ops = append(r.bundle.Ops, op)
+}
+
+// finish returns the recorded bundle, noting err as the outcome of the lookup.
+func (r *replayRecorder) finish(err error) *ReplayBundle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := r.bundle
+	if err != nil {
+		b.Err = err.Error()
+	}
+	return &b
+}
+
+// Do implements proxy.HTTPClient.
+func (c *recordingClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body for recording: %w", err)
+	}
+
+	c.rec.addResponse(ReplayResponse{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Body:   body,
+	})
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func (s *recordingStore) AddRecord(ctx context.Context, r *Record) (int64, error) {
+	id, err := s.Store.AddRecord(ctx, r)
+	if err == nil {
+		s.rec.addOp(ReplayOp{Method: "AddRecord", ID: id, Data: r.Data})
+	}
+	return id, err
+}
+
+func (s *recordingStore) ReadHashes(ctx context.Context, indexes []int64) ([]tlog.Hash, error) {
+	hashes, err := s.Store.ReadHashes(ctx, indexes)
+	if err == nil {
+		s.rec.addOp(ReplayOp{Method: "ReadHashes", Indexes: slices.Clone(indexes), Hashes: hashBytes(hashes)})
+	}
+	return hashes, err
+}
+
+func (s *recordingStore) WriteHashes(ctx context.Context, indexes []int64, hashes []tlog.Hash) error {
+	err := s.Store.WriteHashes(ctx, indexes, hashes)
+	if err == nil {
+		s.rec.addOp(ReplayOp{Method: "WriteHashes", Indexes: slices.Clone(indexes), Hashes: hashBytes(hashes)})
+	}
+	return err
+}
+
+func (s *recordingStore) SetTreeSize(ctx context.Context, size int64) error {
+	err := s.Store.SetTreeSize(ctx, size)
+	if err == nil {
+		s.rec.addOp(ReplayOp{Method: "SetTreeSize", Size: size})
+	}
+	return err
+}
+
+func newReplayTransport(responses []ReplayResponse) *replayTransport {
+	return &replayTransport{
+		responses: responses,
+		used:      make([]bool, len(responses)),
+	}
+}
+
+// RoundTrip implements http.RoundTripper by returning the first unused recorded response matching the request.
+func (c *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	url := req.URL.String()
+	for i, r := range c.responses {
+		if c.used[i] || r.Method != req.Method || r.URL != url {
+			continue
+		}
+
+		c.used[i] = true
+		return &http.Response{
+			StatusCode: r.Status,
+			Status:     http.StatusText(r.Status),
+			Header:     make(http.Header),
+			Body:       io.NopCloser(bytes.NewReader(r.Body)),
+			Request:    req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no recorded response for %s %s", req.Method, url)
+}
+
+func newReplayStore(b *ReplayBundle) *replayStore {
+	s := &replayStore{
+		records: make(map[string]int64),
+		hashes:  make(map[int64]tlog.Hash),
+	}
+
+	for _, op := range b.Ops {
+		switch op.Method {
+		case "ReadHashes":
+			for i, idx := range op.Indexes {
+				if i < len(op.Hashes) {
+					var h tlog.Hash
+					copy(h[:], op.Hashes[i])
+					s.hashes[idx] = h
+				}
+			}
+		case "AddRecord":
+			s.nextID = op.ID
+			s.size = op.ID
+		}
+	}
+
+	return s
+}
+
+func (s *replayStore) RecordID(_ context.Context, path, version string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.records[path+"@"+version]; ok {
+		return id, nil
+	}
+	return 0, ErrNotFound
+}
+
+func (s *replayStore) Records(context.Context, int64, int64) ([]*Record, error) {
+	return nil, nil
+}
+
+func (s *replayStore) AddRecord(_ context.Context, r *Record) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	s.records[r.Path+"@"+r.Version] = id
+	return id, nil
+}
+
+func (s *replayStore) ReadHashes(_ context.Context, indexes []int64) ([]tlog.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hashes := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		hashes[i] = s.hashes[idx]
+	}
+	return hashes, nil
+}
+
+func (s *replayStore) WriteHashes(_ context.Context, indexes []int64, hashes []tlog.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, idx := range indexes {
+		s.hashes[idx] = hashes[i]
+	}
+	return nil
+}
+
+func (s *replayStore) TreeSize(context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size, nil
+}
+
+func (s *replayStore) SetTreeSize(_ context.Context, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.size = size
+	return nil
+}
+
+func hashBytes(hashes []tlog.Hash) [][]byte {
+	out := make([][]byte, len(hashes))
+	for i := range hashes {
+		out[i] = bytes.Clone(hashes[i][:])
+	}
+	return out
+}
@@ -0,0 +1,196 @@
+package sumdb_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestReplay(t *testing.T) {
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	w, err := zw.Create("example.com/replay@v1.0.0/go.mod")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("module example.com/replay\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".mod") {
+			_, _ = w.Write([]byte("module example.com/replay\n"))
+		} else if strings.HasSuffix(r.URL.Path, ".zip") {
+			_, _ = w.Write(zipBuf.Bytes())
+		}
+	}))
+	defer srv.Close()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	var bundle *ReplayBundle
+	store := NewMockStore(ctrl)
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(upstream),
+		WithReplayRecorder(func(b *ReplayBundle) { bundle = b }),
+	)
+	require.NoError(t, err)
+
+	mod := module.Version{Path: "example.com/replay", Version: "v1.0.0"}
+	store.EXPECT().RecordID(gomock.Any(), mod.Path, mod.Version).Return(int64(0), ErrNotFound).Times(2)
+	store.EXPECT().AddRecord(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+	store.EXPECT().ReadHashes(gomock.Any(), gomock.Any()).Return([]tlog.Hash{{1}}, nil).AnyTimes()
+	store.EXPECT().WriteHashes(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	store.EXPECT().SetTreeSize(gomock.Any(), int64(2)).Return(nil)
+
+	_, err = db.Lookup(t.Context(), mod)
+	require.NoError(t, err)
+	require.NotNil(t, bundle)
+	require.Equal(t, mod, bundle.Module)
+	require.Len(t, bundle.Responses, 2)
+	require.NotEmpty(t, bundle.Ops)
+	require.Empty(t, bundle.Err)
+
+	t.Run("reproduces recording", func(t *testing.T) {
+		got, err := Replay(t.Context(), bundle)
+		require.NoError(t, err)
+		require.Equal(t, bundle.Ops, got.Ops)
+	})
+
+	t.Run("detects divergence", func(t *testing.T) {
+		altered := *bundle
+		altered.Responses = append([]ReplayResponse(nil), bundle.Responses...)
+		for i, r := range altered.Responses {
+			if strings.HasSuffix(r.URL, ".mod") {
+				altered.Responses[i].Body = []byte("module example.com/other\n")
+			}
+		}
+
+		_, err := Replay(t.Context(), &altered)
+		require.ErrorIs(t, err, ErrReplayDiverged)
+	})
+
+	t.Run("missing response", func(t *testing.T) {
+		altered := *bundle
+		altered.Responses = nil
+
+		got, err := Replay(t.Context(), &altered)
+		require.ErrorIs(t, err, ErrReplayDiverged)
+		require.Contains(t, got.Err, "no recorded response")
+	})
+}
+
+func TestReplayUpstreams(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	primary, secondary, sumdb := newFakeProxy(t), newFakeProxy(t), newTrustedSumDB(t)
+
+	var bundle *ReplayBundle
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(primary.upstream(t)),
+		WithSecondaryUpstream(secondary.upstream(t)),
+		WithUpstreamSumDB(sumdb.vkey, sumdb.url),
+		WithReplayRecorder(func(b *ReplayBundle) { bundle = b }),
+	)
+	require.NoError(t, err)
+
+	mod := module.Version{Path: "example.com/replay", Version: "v1.0.0"}
+	_, err = db.Lookup(t.Context(), mod)
+	require.NoError(t, err)
+	require.NotNil(t, bundle)
+	require.Equal(t, secondary.URL, bundle.SecondaryUpstream)
+	require.Equal(t, sumdb.url.String(), bundle.UpstreamSumDB)
+	require.Equal(t, sumdb.vkey, bundle.UpstreamSumDBKey)
+
+	// responses returns the recorded responses from the server at base.
+	responses := func(b *ReplayBundle, base string) []ReplayResponse {
+		var out []ReplayResponse
+		for _, r := range b.Responses {
+			if strings.HasPrefix(r.URL, base+"/") {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+	require.NotEmpty(t, responses(bundle, primary.URL))
+	require.NotEmpty(t, responses(bundle, secondary.URL))
+	require.NotEmpty(t, responses(bundle, sumdb.url.String()))
+
+	t.Run("reproduces recording", func(t *testing.T) {
+		got, err := Replay(t.Context(), bundle)
+		require.NoError(t, err)
+		require.Equal(t, bundle.Ops, got.Ops)
+		require.Equal(t, bundle.Responses, got.Responses)
+	})
+
+	t.Run("replays the secondary upstream", func(t *testing.T) {
+		altered := *bundle
+		altered.Responses = append([]ReplayResponse(nil), bundle.Responses...)
+		for i, r := range altered.Responses {
+			if strings.HasPrefix(r.URL, secondary.URL+"/") && strings.HasSuffix(r.URL, ".mod") {
+				altered.Responses[i].Body = []byte("module example.com/other\n")
+			}
+		}
+
+		got, err := Replay(t.Context(), &altered)
+		require.ErrorIs(t, err, ErrReplayDiverged)
+		require.Contains(t, got.Err, "upstreams disagree")
+	})
+
+	t.Run("replays the upstream sumdb", func(t *testing.T) {
+		altered := *bundle
+		altered.Responses = append(responses(bundle, primary.URL), responses(bundle, secondary.URL)...)
+
+		got, err := Replay(t.Context(), &altered)
+		require.ErrorIs(t, err, ErrReplayDiverged)
+		require.Contains(t, got.Err, "no recorded response for GET "+sumdb.url.String())
+	})
+}
+
+func TestReplayRetries(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	var bundle *ReplayBundle
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(upstream.upstream(t)),
+		WithProxyRetry(3, time.Millisecond, time.Millisecond),
+		WithReplayRecorder(func(b *ReplayBundle) { bundle = b }),
+	)
+	require.NoError(t, err)
+
+	// Recording proxies retry too, and record the failed attempts.
+	upstream.setFailures(2)
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/replay", Version: "v1.0.0"})
+	require.NoError(t, err)
+	require.NotNil(t, bundle)
+	require.Equal(t, 3, bundle.ProxyAttempts)
+	require.Equal(t, http.StatusServiceUnavailable, bundle.Responses[0].Status)
+	require.Equal(t, http.StatusServiceUnavailable, bundle.Responses[1].Status)
+
+	got, err := Replay(t.Context(), bundle)
+	require.NoError(t, err)
+	require.Equal(t, bundle.Ops, got.Ops)
+	require.Equal(t, bundle.Responses, got.Responses)
+}
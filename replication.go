@@ -0,0 +1,547 @@
+package sumdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/connect"
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+const (
+	// replicationSyncPath is the path of the Sync RPC of the sumdb.v1.ReplicationService (see
+	// proto/sumdb/v1/replication.proto).
+	replicationSyncPath = "/sumdb.v1.ReplicationService/Sync"
+
+	// replicationBatchSize is the maximum number of records sent in each message of a replication stream.
+	replicationBatchSize = 1 << tree.TileHeight
+)
+
+// ErrReplicaDiverged is returned by Replica.Run when the leader's log doesn't contain the records the replica already
+// has, which happens when the replica follows the wrong leader or either log was rewritten.
+var ErrReplicaDiverged = errors.New("replica has diverged from the leader")
+
+type (
+	// Replica follows a leader's replication stream (see ReplicationHandler), copying its records and hashes into a
+	// local store. Everything the leader sends is authenticated against its signed tree heads before being stored, so
+	// the store always holds a prefix of the leader's log.
+	Replica struct {
+		client   *http.Client
+		leader   string
+		store    Store
+		verifier note.Verifier
+		clock    Clock
+
+		mu     sync.Mutex
+		signed []byte
+	}
+
+	// ReplicaOption configures a Replica.
+	ReplicaOption func(*Replica)
+
+	// replicationRequest is the SyncRequest message, asking for the records after the replica's tree size.
+	replicationRequest struct {
+		TreeSize int64 `json:"treeSize,string"`
+	}
+
+	// replicationBatch is the SyncResponse message. It carries consecutive records along with their stored hashes, a
+	// signed tree head covering them and a proof that the tree contains the one the replica had before the batch.
+	// Messages without a signed tree head keep idle streams alive.
+	replicationBatch struct {
+		Records          []replicationRecord `json:"records,omitempty"`
+		HashIndex        int64               `json:"hashIndex,string,omitempty"`
+		Hashes           [][]byte            `json:"hashes,omitempty"`
+		SignedHead       []byte              `json:"signedHead,omitempty"`
+		ConsistencyProof [][]byte            `json:"consistencyProof,omitempty"`
+	}
+
+	// replicationRecord is the Record message.
+	replicationRecord struct {
+		ID      int64  `json:"id,string"`
+		Path    string `json:"path"`
+		Version string `json:"version"`
+		Data    []byte `json:"data"`
+	}
+
+	// batchHashes is a tlog.HashReader over a replica's stored hashes and those of the batch being applied.
+	batchHashes struct {
+		ctx    context.Context
+		store  Store
+		hashes map[int64]tlog.Hash
+	}
+)
+
+// ReplicationHandler returns an HTTP handler for the replication stream followed by Replicas.
+//
+// It serves the server-streaming Sync RPC of sumdb.v1.ReplicationService (see proto/sumdb/v1/replication.proto) using
+// the Connect protocol with the JSON codec, so followers can also be written with any Connect client. A replica sends
+// its tree size and receives the records after it in batches, followed by new records as they're appended. Each batch
+// includes the records' hashes, a signed tree head and a consistency proof from the previous batch's tree, so
+// followers don't need to poll tiles or fetch proofs separately.
+//
+// The stream serves the same data as the tiles served by Handler, so it should be protected in the same way.
+func (s *SumDB) ReplicationHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+replicationSyncPath, s.serveReplicationSync)
+	return mux
+}
+
+func (s *SumDB) serveReplicationSync(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != connect.ContentType {
+		http.Error(w, "unsupported content type: "+ct, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var req replicationRequest
+	reqErr := connect.NewReader(http.MaxBytesReader(w, r.Body, 1<<10)).Next(&req)
+
+	// Streams are long-lived, so they must not be cut off by the server's write timeout.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	// Connect streams always respond with 200 OK, reporting errors in the end of stream message.
+	w.Header().Set("Content-Type", connect.ContentType)
+	w.WriteHeader(http.StatusOK)
+
+	var err error
+	switch {
+	case reqErr != nil:
+		err = connect.Errorf(connect.CodeInvalidArgument, "invalid request: %v", reqErr)
+	case req.TreeSize < 0:
+		err = connect.Errorf(connect.CodeInvalidArgument, "invalid tree size: %d", req.TreeSize)
+	default:
+		err = s.streamReplication(r.Context(), w, rc, req.TreeSize)
+	}
+
+	if r.Context().Err() == nil {
+		_ = connect.WriteEnd(w, err)
+	}
+}
+
+// streamReplication writes batches of the records after from to w until ctx is done. The first batch is sent even
+// when there are no new records, so that the replica receives a signed tree head for its tree.
+func (s *SumDB) streamReplication(ctx context.Context, w io.Writer, rc *http.ResponseController, from int64) error {
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	sent := false
+	for {
+		// Register for notifications before reading the tree size so that appends in between aren't missed.
+		appended := s.appended.wait()
+
+		size, err := s.store.TreeSize(ctx)
+		if err != nil {
+			return err
+		}
+		if from > size {
+			return connect.Errorf(connect.CodeFailedPrecondition, "tree size %d exceeds the leader's %d", from, size)
+		}
+
+		for !sent || from < size {
+			to := min(size, from+replicationBatchSize)
+			batch, err := s.replicationBatch(ctx, from, to)
+			if err != nil {
+				return err
+			}
+
+			if err := connect.WriteMessage(w, batch); err != nil {
+				return err
+			}
+			if err := rc.Flush(); err != nil {
+				return err
+			}
+			from, sent = to, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-appended:
+		case <-keepAlive.C:
+			// Connect has no keep-alive frames, so idle streams receive an empty message instead.
+			if err := connect.WriteMessage(w, replicationBatch{}); err != nil {
+				return err
+			}
+			if err := rc.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// replicationBatch returns the records in [from, to) along with their stored hashes, a signed tree head for the tree
+// of size to, and a proof that it contains the tree of size from.
+func (s *SumDB) replicationBatch(ctx context.Context, from, to int64) (*replicationBatch, error) {
+	batch := &replicationBatch{}
+	if to > from {
+		recs, err := s.store.Records(ctx, from, to-from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read records: %d, %w", from, err)
+		}
+		if int64(len(recs)) != to-from {
+			return nil, fmt.Errorf("store returned %d records for %d", len(recs), to-from)
+		}
+
+		batch.Records = make([]replicationRecord, len(recs))
+		for i, rec := range recs {
+			batch.Records[i] = replicationRecord{ID: from + int64(i), Path: rec.Path, Version: rec.Version, Data: rec.Data}
+		}
+
+		// The hashes stored for a record immediately follow those of the previous record.
+		batch.HashIndex = tlog.StoredHashIndex(0, from)
+		indexes := make([]int64, tlog.StoredHashIndex(0, to)-batch.HashIndex)
+		for i := range indexes {
+			indexes[i] = batch.HashIndex + int64(i)
+		}
+
+		hashes, err := s.store.ReadHashes(ctx, indexes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read hashes: %d, %w", from, err)
+		}
+
+		batch.Hashes = make([][]byte, len(hashes))
+		for i, h := range hashes {
+			batch.Hashes[i] = h[:]
+		}
+	}
+
+	if from > 0 {
+		proof, err := tree.ProveTree(ctx, s.store, to, from)
+		if err != nil {
+			return nil, err
+		}
+
+		batch.ConsistencyProof = make([][]byte, len(proof))
+		for i, h := range proof {
+			batch.ConsistencyProof[i] = h[:]
+		}
+	}
+
+	_, signed, err := s.signedAt(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	batch.SignedHead = signed
+
+	return batch, nil
+}
+
+// NewReplica creates a Replica that copies the log served by the ReplicationHandler at leader into store, verifying
+// the leader's signed tree heads with vkey.
+//
+// Streams are long-lived, so client must not have a timeout. A nil client uses one with the default transport.
+func NewReplica(leader, vkey string, store Store, client *http.Client, opts ...ReplicaOption) (*Replica, error) {
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verifier key: %w", err)
+	}
+
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	r := &Replica{
+		client:   client,
+		leader:   strings.TrimSuffix(leader, "/"),
+		store:    store,
+		verifier: verifier,
+		clock:    systemClock{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// WithReplicaClock sets the Clock the replica timestamps checkpoints with and waits between reconnections with (see
+// Sleeper). Defaults to the system clock.
+func WithReplicaClock(c Clock) ReplicaOption {
+	return func(r *Replica) { r.clock = c }
+}
+
+// Run follows the leader until ctx is done, reconnecting with exponential backoff when the stream fails.
+//
+// Only one Run should be running per store. It returns an error wrapping ErrReplicaDiverged if the leader's log
+// doesn't contain the replica's records, and ctx.Err() once ctx is done.
+func (r *Replica) Run(ctx context.Context) error {
+	retry := backoff{clock: r.clock}
+	for {
+		synced, err := r.sync(ctx)
+		if errors.Is(err, ErrReplicaDiverged) {
+			return err
+		}
+		if synced {
+			retry.reset()
+		}
+
+		if !retry.wait(ctx) {
+			return ctx.Err()
+		}
+	}
+}
+
+// Signed returns the leader's most recent signed tree head applied to the store, or nil if none has been received.
+func (r *Replica) Signed() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.signed
+}
+
+// sync follows a single replication stream until it ends, reporting whether any batches were applied.
+func (r *Replica) sync(ctx context.Context) (bool, error) {
+	size, err := r.store.TreeSize(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get tree size: %w", err)
+	}
+
+	var body bytes.Buffer
+	if err := connect.WriteMessage(&body, replicationRequest{TreeSize: size}); err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.leader+replicationSyncPath, &body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", connect.ContentType)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to sync with leader: %s, %w", r.leader, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to sync with leader: %s, %s", r.leader, resp.Status)
+	}
+
+	stream := connect.NewReader(resp.Body)
+	synced := false
+	for {
+		var batch replicationBatch
+		err := stream.Next(&batch)
+		if errors.Is(err, io.EOF) {
+			return synced, nil
+		}
+
+		var rpcErr *connect.Error
+		if errors.As(err, &rpcErr) && rpcErr.Code == connect.CodeFailedPrecondition {
+			return synced, fmt.Errorf("%w: %w", ErrReplicaDiverged, err)
+		}
+		if err != nil {
+			return synced, fmt.Errorf("failed to read replication stream: %s, %w", r.leader, err)
+		}
+
+		if err := r.apply(ctx, &batch); err != nil {
+			return synced, err
+		}
+		synced = true
+	}
+}
+
+// apply authenticates a batch against its signed tree head and appends its records to the store. Hashes are
+// recomputed from the records rather than trusted, and must match the ones sent by the leader.
+func (r *Replica) apply(ctx context.Context, batch *replicationBatch) error {
+	if batch.SignedHead == nil {
+		return nil
+	}
+
+	n, err := note.Open(batch.SignedHead, note.VerifierList(r.verifier))
+	if err != nil {
+		return fmt.Errorf("failed to verify signed tree head: %s, %w", r.leader, err)
+	}
+
+	t, err := tlog.ParseTree([]byte(n.Text))
+	if err != nil {
+		return fmt.Errorf("failed to parse signed tree head: %s, %w", r.leader, err)
+	}
+
+	size, err := r.store.TreeSize(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get tree size: %w", err)
+	}
+	if t.N != size+int64(len(batch.Records)) {
+		return fmt.Errorf("leader sent %d records after %d for a tree of size %d", len(batch.Records), size, t.N)
+	}
+
+	hr := &batchHashes{ctx: ctx, store: r.store, hashes: make(map[int64]tlog.Hash)}
+	if size > 0 {
+		if err := checkConsistency(batch, t, size, hr); err != nil {
+			return err
+		}
+	}
+
+	if len(batch.Records) > 0 {
+		if err := checkRecords(batch, t, size, hr); err != nil {
+			return err
+		}
+
+		if err := withTx(ctx, r.store, func(store Store) error {
+			return r.appendBatch(ctx, store, batch, hr, size)
+		}); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	r.signed = batch.SignedHead
+	r.mu.Unlock()
+	return nil
+}
+
+// checkConsistency verifies the batch's proof that the leader's tree t contains the replica's tree of the given size.
+func checkConsistency(batch *replicationBatch, t tlog.Tree, size int64, hr *batchHashes) error {
+	root, err := tlog.TreeHash(size, hr)
+	if err != nil {
+		return fmt.Errorf("failed to compute tree hash: %w", err)
+	}
+
+	proof, err := toHashes(batch.ConsistencyProof)
+	if err != nil {
+		return fmt.Errorf("invalid consistency proof: %w", err)
+	}
+
+	if err := tlog.CheckTree(proof, t.N, t.Hash, size, root); err != nil {
+		return fmt.Errorf("%w: tree of size %d isn't contained in the leader's tree of size %d: %w",
+			ErrReplicaDiverged, size, t.N, err)
+	}
+	return nil
+}
+
+// checkRecords recomputes the hashes of the batch's records, making them available through hr, and verifies that they
+// match the hashes sent by the leader and its signed tree head t.
+func checkRecords(batch *replicationBatch, t tlog.Tree, size int64, hr *batchHashes) error {
+	first, end := tlog.StoredHashIndex(0, size), tlog.StoredHashIndex(0, t.N)
+	if batch.HashIndex != first || int64(len(batch.Hashes)) != end-first {
+		return fmt.Errorf("leader sent %d hashes from %d, want %d from %d", len(batch.Hashes), batch.HashIndex,
+			end-first, first)
+	}
+
+	for i, rec := range batch.Records {
+		id := size + int64(i)
+		if rec.ID != id {
+			return fmt.Errorf("leader sent record %d, want %d", rec.ID, id)
+		}
+		if !bytes.HasPrefix(rec.Data, []byte(rec.Path+" "+rec.Version+" ")) {
+			return fmt.Errorf("record %d isn't for %s@%s", id, rec.Path, rec.Version)
+		}
+
+		hashes, err := tlog.StoredHashes(id, rec.Data, hr)
+		if err != nil {
+			return fmt.Errorf("failed to compute hashes for record %d: %w", id, err)
+		}
+
+		base := tlog.StoredHashIndex(0, id)
+		for j, h := range hashes {
+			idx := base + int64(j)
+			if !bytes.Equal(h[:], batch.Hashes[idx-first]) {
+				return fmt.Errorf("leader's hash %d doesn't match record %d", idx, id)
+			}
+			hr.hashes[idx] = h
+		}
+	}
+
+	root, err := tlog.TreeHash(t.N, hr)
+	if err != nil {
+		return fmt.Errorf("failed to compute tree hash: %w", err)
+	}
+	if root != t.Hash {
+		return fmt.Errorf("records don't match the leader's tree head: got %s, want %s", root, t.Hash)
+	}
+	return nil
+}
+
+// appendBatch stores the batch's records and their verified hashes in the tree of the given size, within the
+// transaction store.
+func (r *Replica) appendBatch(
+	ctx context.Context, store Store, batch *replicationBatch, hr *batchHashes, size int64,
+) error {
+	newSize := size + int64(len(batch.Records))
+	for i, rec := range batch.Records {
+		id, err := store.AddRecord(ctx, &Record{Path: rec.Path, Version: rec.Version, Data: rec.Data})
+		if err != nil {
+			return fmt.Errorf("failed to add record: %s@%s, %w", rec.Path, rec.Version, err)
+		}
+		if want := size + int64(i); id != want {
+			return fmt.Errorf("store assigned ID %d to record %d", id, want)
+		}
+	}
+
+	first := tlog.StoredHashIndex(0, size)
+	indexes := make([]int64, tlog.StoredHashIndex(0, newSize)-first)
+	hashes := make([]tlog.Hash, len(indexes))
+	for i := range indexes {
+		indexes[i] = first + int64(i)
+		hashes[i] = hr.hashes[indexes[i]]
+	}
+
+	if err := store.WriteHashes(ctx, indexes, hashes); err != nil {
+		return fmt.Errorf("failed to write hashes: %w", err)
+	}
+
+	if err := store.SetTreeSize(ctx, newSize); err != nil {
+		return fmt.Errorf("failed to update tree size: %w", err)
+	}
+
+	// Derived indexes maintained by the store are kept up to date on replicas too.
+	for i, rec := range batch.Records {
+		appended := &Record{Path: rec.Path, Version: rec.Version, Data: rec.Data}
+		if err := onAppend(ctx, store, size+int64(i), appended); err != nil {
+			return err
+		}
+	}
+	return addCheckpoint(ctx, store, newSize, r.clock.Now())
+}
+
+// ReadHashes implements tlog.HashReader, reading the hashes that aren't part of the batch from the store.
+func (h *batchHashes) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	out := make([]tlog.Hash, len(indexes))
+
+	var stored []int64
+	for i, idx := range indexes {
+		if hash, ok := h.hashes[idx]; ok {
+			out[i] = hash
+		} else {
+			stored = append(stored, idx)
+		}
+	}
+	if len(stored) == 0 {
+		return out, nil
+	}
+
+	hashes, err := h.store.ReadHashes(h.ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	if len(hashes) != len(stored) {
+		return nil, fmt.Errorf("store returned %d hashes for %d indexes", len(hashes), len(stored))
+	}
+
+	for i, idx := range indexes {
+		if _, ok := h.hashes[idx]; !ok {
+			out[i], hashes = hashes[0], hashes[1:]
+		}
+	}
+	return out, nil
+}
+
+// toHashes converts encoded hashes to tlog.Hashes.
+func toHashes(data [][]byte) ([]tlog.Hash, error) {
+	hashes := make([]tlog.Hash, len(data))
+	for i, d := range data {
+		if len(d) != tlog.HashSize {
+			return nil, fmt.Errorf("hash %d has %d bytes, want %d", i, len(d), tlog.HashSize)
+		}
+		hashes[i] = tlog.Hash(d)
+	}
+	return hashes, nil
+}
@@ -0,0 +1,153 @@
+package sumdb_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestReplication(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	leader, err := New("test.example.com", skey, WithStore(newMemStore()), WithUpstream(upstream.upstream(t)))
+	require.NoError(t, err)
+
+	// Enough records for the stream to send several batches.
+	for i := range 300 {
+		_, err := leader.Lookup(t.Context(), module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"})
+		require.NoError(t, err)
+	}
+
+	srv := httptest.NewServer(leader.ReplicationHandler())
+	t.Cleanup(srv.Close)
+
+	// run follows the leader in the background, returning a function that stops the replica and returns Run's error.
+	run := func(t *testing.T, replica *Replica) func() error {
+		t.Helper()
+
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan error, 1)
+		go func() { done <- replica.Run(ctx) }()
+		return func() error {
+			cancel()
+			return <-done
+		}
+	}
+
+	t.Run("follows the leader", func(t *testing.T) {
+		store := newMemStore()
+		replica, err := NewReplica(srv.URL, vkey, store, nil)
+		require.NoError(t, err)
+		stop := run(t, replica)
+
+		caughtUp := func(signed []byte) func() bool {
+			return func() bool { return string(replica.Signed()) == string(signed) }
+		}
+
+		signed, err := leader.Signed(t.Context())
+		require.NoError(t, err)
+		require.Eventually(t, caughtUp(signed), 5*time.Second, 10*time.Millisecond)
+
+		_, err = leader.Lookup(t.Context(), module.Version{Path: "example.com/new", Version: "v1.0.0"})
+		require.NoError(t, err)
+
+		signed, err = leader.Signed(t.Context())
+		require.NoError(t, err)
+		require.Eventually(t, caughtUp(signed), 5*time.Second, 10*time.Millisecond)
+		require.ErrorIs(t, stop(), context.Canceled)
+
+		// The replica's store holds the leader's log, so it can take over from the leader.
+		promoted, err := New("test.example.com", skey, WithStore(store))
+		require.NoError(t, err)
+		got, err := promoted.Signed(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, string(signed), string(got))
+
+		want, err := readRecords(t.Context(), leader, 0, 301)
+		require.NoError(t, err)
+		recs, err := readRecords(t.Context(), promoted, 0, 301)
+		require.NoError(t, err)
+		require.Equal(t, want, recs)
+
+		id, err := store.RecordID(t.Context(), "example.com/new", "v1.0.0")
+		require.NoError(t, err)
+		require.Equal(t, int64(300), id)
+	})
+
+	t.Run("diverged", func(t *testing.T) {
+		// A replica with a record the leader doesn't have.
+		store := newMemStore()
+		other, err := New("test.example.com", skey, WithStore(store), WithUpstream(upstream.upstream(t)))
+		require.NoError(t, err)
+		_, err = other.Lookup(t.Context(), module.Version{Path: "example.com/other", Version: "v1.0.0"})
+		require.NoError(t, err)
+
+		replica, err := NewReplica(srv.URL, vkey, store, nil)
+		require.NoError(t, err)
+		require.ErrorIs(t, replica.Run(t.Context()), ErrReplicaDiverged)
+
+		// And one with more records than the leader.
+		for i := range 400 {
+			_, err = store.AddRecord(t.Context(), &Record{Path: fmt.Sprintf("example.com/x%d", i), Version: "v1.0.0"})
+			require.NoError(t, err)
+		}
+		require.NoError(t, store.SetTreeSize(t.Context(), 401))
+		require.ErrorIs(t, replica.Run(t.Context()), ErrReplicaDiverged)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, otherVkey, err := GenerateKeys("test.example.com")
+		require.NoError(t, err)
+
+		store := newMemStore()
+		replica, err := NewReplica(srv.URL, otherVkey, store, nil)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, replica.Run(ctx), context.DeadlineExceeded)
+		require.Nil(t, replica.Signed())
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Zero(t, size)
+	})
+
+	t.Run("timestamps checkpoints with its clock", func(t *testing.T) {
+		now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		store := memstore.New()
+		replica, err := NewReplica(srv.URL, vkey, store, nil, WithReplicaClock(ClockFunc(func() time.Time { return now })))
+		require.NoError(t, err)
+		stop := run(t, replica)
+
+		signed, err := leader.Signed(t.Context())
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return string(replica.Signed()) == string(signed) },
+			5*time.Second, 10*time.Millisecond)
+		require.ErrorIs(t, stop(), context.Canceled)
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		c, err := store.Checkpoint(t.Context(), size)
+		require.NoError(t, err)
+		require.Equal(t, now, c.Time)
+	})
+
+	t.Run("requires the Connect content type", func(t *testing.T) {
+		resp, err := http.Post(srv.URL+"/sumdb.v1.ReplicationService/Sync", "application/json", strings.NewReader("{}"))
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	})
+}
@@ -0,0 +1,132 @@
+package sumdb
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// SignatureHeader carries the detached signature of JSON responses when WithSignedResponses is set. See
+	// VerifyResponse.
+	SignatureHeader = "Sumdb-Signature"
+
+	// ResponseNoteContext is the context (see SignNote) JSON responses are signed for.
+	ResponseNoteContext = "json response"
+)
+
+// signResponse signs body, which must end with a newline, for ResponseNoteContext and returns the detached signature:
+// the signature lines of the note, without their leading "— ", separated by commas.
+func (s *SumDB) signResponse(body []byte) (string, error) {
+	msg, err := s.SignNote(ResponseNoteContext, string(body))
+	if err != nil {
+		return "", err
+	}
+
+	sigs := strings.TrimSuffix(string(msg[len(noteText(ResponseNoteContext, string(body)))+1:]), "\n")
+	var out []string
+	for sig := range strings.SplitSeq(sigs, "\n") {
+		out = append(out, strings.TrimPrefix(sig, "— "))
+	}
+	return strings.Join(out, ", "), nil
+}
+
+// VerifyResponse verifies the detached signature of a JSON response body from a server configured with
+// WithSignedResponses, given the value of its SignatureHeader (or the signature field of a stream event, whose body is
+// the event's data followed by a newline). Signatures are checked against the server's verifier key, so responses can
+// be trusted even when they're relayed by caches or other intermediaries. It returns an error wrapping ErrInvalidNote
+// if the signature is missing or invalid.
+//
+// Signatures authenticate a response's body, not when it was sent: a replayed response verifies too, so consumers
+// relying on freshness should check the tree size or timestamps in the body.
+func VerifyResponse(body []byte, signature, vkey string) error {
+	if signature == "" {
+		return fmt.Errorf("%w: response isn't signed", ErrInvalidNote)
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString(noteText(ResponseNoteContext, string(body)))
+	msg.WriteString("\n")
+	for sig := range strings.SplitSeq(signature, ",") {
+		fmt.Fprintf(&msg, "— %s\n", strings.TrimSpace(sig))
+	}
+
+	_, err := VerifyNote(msg.Bytes(), ResponseNoteContext, vkey)
+	return err
+}
+
+// signResponses signs the JSON responses of next when WithSignedResponses is set, adding their signature in
+// SignatureHeader. JSON responses are buffered to be signed; other responses (e.g. event streams, which sign each
+// event, and HTML) are passed through.
+func (s *SumDB) signResponses(next http.Handler) http.Handler {
+	if !s.signedResponses {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &signingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if sw.buf == nil {
+			return
+		}
+
+		sig, err := s.signResponse(sw.buf.Bytes())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(SignatureHeader, sig)
+		w.WriteHeader(sw.status)
+		_, _ = w.Write(sw.buf.Bytes())
+	})
+}
+
+// signingWriter buffers JSON responses so that they can be signed once they're complete.
+type signingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	status      int
+	buf         *bytes.Buffer // the JSON response, or nil if the response isn't JSON
+}
+
+func (w *signingWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.status = status
+		w.buf = &bytes.Buffer{}
+		w.Header().Del("Content-Length")
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *signingWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buf != nil {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *signingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush implements http.Flusher for responses that aren't buffered.
+func (w *signingWriter) Flush() {
+	if w.buf != nil {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
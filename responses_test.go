@@ -0,0 +1,136 @@
+package sumdb_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestSignedResponses(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(newFakeProxy(t).upstream(t)),
+		WithSignedResponses(),
+		WithCORS("*"),
+		WithAdminIdentity(BearerIdentity(func(context.Context, string) (Identity, error) {
+			return Identity{Subject: "alice", Role: RoleViewer}, nil
+		})),
+	)
+	require.NoError(t, err)
+
+	for _, path := range []string{"example.com/a", "example.com/b"} {
+		_, err := db.Lookup(t.Context(), module.Version{Path: path, Version: "v1.0.0"})
+		require.NoError(t, err)
+	}
+
+	tests := map[string]struct {
+		handler http.Handler
+		req     *http.Request
+		status  int
+		cors    bool // whether the handler adds CORS headers
+	}{
+		"record": {
+			handler: db.APIHandler(),
+			req:     httptest.NewRequest(http.MethodGet, "/records/1", nil),
+			status:  http.StatusOK,
+			cors:    true,
+		},
+		"errors": {
+			handler: db.APIHandler(),
+			req:     httptest.NewRequest(http.MethodGet, "/records/10", nil),
+			status:  http.StatusNotFound,
+			cors:    true,
+		},
+		"verify": {
+			handler: db.APIHandler(),
+			req:     httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader("")),
+			status:  http.StatusOK,
+			cors:    true,
+		},
+		"admin status": {
+			handler: db.AdminHandler(),
+			req:     httptest.NewRequest(http.MethodGet, "/status", nil),
+			status:  http.StatusOK,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.req.Header.Set("Origin", "https://dash.example.com")
+			tt.req.Header.Set("Authorization", "Bearer token")
+
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, tt.req)
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			if tt.cors {
+				require.Equal(t, SignatureHeader, rec.Header().Get("Access-Control-Expose-Headers"))
+			}
+
+			sig := rec.Header().Get(SignatureHeader)
+			require.NoError(t, VerifyResponse(rec.Body.Bytes(), sig, vkey))
+
+			// Any change to the body invalidates the signature.
+			tampered := strings.Replace(rec.Body.String(), "}", `,"x":1}`, 1)
+			require.ErrorIs(t, VerifyResponse([]byte(tampered), sig, vkey), ErrInvalidNote)
+		})
+	}
+
+	t.Run("stream events", func(t *testing.T) {
+		srv := httptest.NewServer(db.APIHandler())
+		t.Cleanup(srv.Close)
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+"/records/stream", nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		require.Empty(t, resp.Header.Get(SignatureHeader))
+
+		// The first event's fields, up to the blank line ending it.
+		fields := make(map[string]string)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() && scanner.Text() != "" {
+			k, v, _ := strings.Cut(scanner.Text(), ": ")
+			fields[k] = v
+		}
+		require.NoError(t, scanner.Err())
+		require.Equal(t, "0", fields["id"])
+		require.NoError(t, VerifyResponse([]byte(fields["data"]+"\n"), fields["signature"], vkey))
+	})
+
+	t.Run("invalid signatures", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		db.APIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records/0", nil))
+		body, err := io.ReadAll(rec.Body)
+		require.NoError(t, err)
+
+		_, otherKey, err := GenerateKeys("other.example.com")
+		require.NoError(t, err)
+
+		require.ErrorIs(t, VerifyResponse(body, "", vkey), ErrInvalidNote)
+		require.ErrorIs(t, VerifyResponse(body, "test.example.com bogus", vkey), ErrInvalidNote)
+		require.ErrorIs(t, VerifyResponse(body, rec.Header().Get(SignatureHeader), otherKey), ErrInvalidNote)
+	})
+
+	t.Run("unsigned by default", func(t *testing.T) {
+		db, err := New("test.example.com", skey, WithStore(newAnnotatedStore(t, 2)))
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		db.APIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records/0", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Empty(t, rec.Header().Get(SignatureHeader))
+	})
+}
@@ -0,0 +1,98 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoSTHRefreshInterval is returned by RunSTHRefresher when no interval was configured with WithSTHRefreshInterval.
+var ErrNoSTHRefreshInterval = errors.New("no STH refresh interval configured")
+
+// signedHead is a signed tree head along with the size of the tree and the time it was signed, or last found to be
+// for the current tree.
+type signedHead struct {
+	signed []byte
+	size   int64
+	at     time.Time
+}
+
+// signed returns a signed tree head covering at least minSize records.
+//
+// When WithSTHMaxStaleness is configured, the cached tree head is returned if it's within the staleness window and
+// covers minSize records. Otherwise the tree head for the current tree is returned (see latestHead).
+func (s *SumDB) signed(ctx context.Context, minSize int64) ([]byte, error) {
+	if s.sthMaxStaleness > 0 {
+		cached := s.cachedHead()
+		if cached != nil && cached.size >= minSize && s.clock.Now().Sub(cached.at) <= s.sthMaxStaleness {
+			return cached.signed, nil
+		}
+	}
+
+	return s.latestHead(ctx)
+}
+
+// latestHead returns the signed tree head for the current tree. The cached head is returned if it's for the current
+// tree size, which only costs a read of the size: appends, by this server or any other sharing the store, change the
+// size and so invalidate it. Otherwise a fresh tree head is signed and cached.
+func (s *SumDB) latestHead(ctx context.Context) ([]byte, error) {
+	now := s.clock.Now()
+	size, err := s.store.TreeSize(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree size: %w", err)
+	}
+	s.observeTreeSize(size)
+	s.logTreeSize(ctx, size)
+
+	if cached := s.cachedHead(); cached != nil && cached.size == size {
+		// The head is still current, which restarts its staleness window.
+		s.cacheHead(&signedHead{signed: cached.signed, size: size, at: now})
+		return cached.signed, nil
+	}
+
+	// The hash is computed at the size read above, since records may be appended in the meantime.
+	signed, err := s.signTreeHead(ctx, size)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cacheHead(&signedHead{signed: signed, size: size, at: now})
+	return signed, nil
+}
+
+// cachedHead returns the cached signed tree head, or nil if there is none.
+func (s *SumDB) cachedHead() *signedHead {
+	s.sthMu.Lock()
+	defer s.sthMu.Unlock()
+	return s.sth
+}
+
+// cacheHead caches h, unless a head for a larger tree was cached in the meantime.
+func (s *SumDB) cacheHead(h *signedHead) {
+	s.sthMu.Lock()
+	defer s.sthMu.Unlock()
+
+	if s.sth == nil || s.sth.size < h.size || (s.sth.size == h.size && s.sth.at.Before(h.at)) {
+		s.sth = h
+	}
+}
+
+// RunSTHRefresher signs the tree head for the current tree every interval configured with WithSTHRefreshInterval
+// until ctx is canceled, so that requests after an append find it cached rather than computing the tree hash
+// themselves. Failures are retried at the next interval, and requests sign tree heads as usual in the meantime.
+//
+// It returns ErrNoSTHRefreshInterval if no interval was configured.
+func (s *SumDB) RunSTHRefresher(ctx context.Context) error {
+	if s.sthRefreshInterval <= 0 {
+		return ErrNoSTHRefreshInterval
+	}
+
+	for {
+		_, _ = s.latestHead(ctx)
+
+		if !sleep(ctx, s.clock, s.sthRefreshInterval) {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package sumdb_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/signer"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestSTHMaxStaleness(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ClockFunc(func() time.Time { return now })
+
+	store := NewMockStore(ctrl)
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithClock(clock),
+		WithSTHMaxStaleness(time.Minute),
+	)
+	require.NoError(t, err)
+
+	t.Run("serves cached head within window", func(t *testing.T) {
+		store.EXPECT().TreeSize(gomock.Any()).Return(int64(0), nil)
+
+		first, err := db.Signed(t.Context())
+		require.NoError(t, err)
+
+		now = now.Add(30 * time.Second)
+		second, err := db.Signed(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, first, second)
+	})
+
+	t.Run("re-signs after window", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		store.EXPECT().TreeSize(gomock.Any()).Return(int64(1), nil)
+		store.EXPECT().ReadHashes(gomock.Any(), gomock.Any()).Return([]tlog.Hash{{1}}, nil)
+
+		signed, err := db.Signed(t.Context())
+		require.NoError(t, err)
+
+		verifier, err := signer.NewVerifier(vkey)
+		require.NoError(t, err)
+
+		tree, err := signer.VerifyTreeHead(verifier, signed)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), tree.N)
+	})
+
+	t.Run("lookups require a head covering the record", func(t *testing.T) {
+		store.EXPECT().RecordID(gomock.Any(), "example.com/foo", "v1.0.0").Return(int64(1), nil)
+		store.EXPECT().
+			Records(gomock.Any(), int64(1), int64(1)).
+			Return([]*Record{{ID: 1, Data: []byte("example.com/foo v1.0.0 h1:abc=\n")}}, nil)
+		store.EXPECT().TreeSize(gomock.Any()).Return(int64(2), nil)
+		store.EXPECT().ReadHashes(gomock.Any(), gomock.Any()).Return([]tlog.Hash{{1}}, nil)
+
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/foo@v1.0.0", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestSignedCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := NewMockStore(ctrl)
+	db, err := New("test.example.com", skey, WithStore(store))
+	require.NoError(t, err)
+
+	// The tree hash is only computed again once the tree size changes.
+	gomock.InOrder(
+		store.EXPECT().TreeSize(gomock.Any()).Return(int64(1), nil).Times(3),
+		store.EXPECT().TreeSize(gomock.Any()).Return(int64(2), nil),
+	)
+	store.EXPECT().ReadHashes(gomock.Any(), gomock.Any()).Return([]tlog.Hash{{1}}, nil).Times(2)
+
+	first, err := db.Signed(t.Context())
+	require.NoError(t, err)
+	for range 2 {
+		signed, err := db.Signed(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, first, signed)
+	}
+
+	signed, err := db.Signed(t.Context())
+	require.NoError(t, err)
+	require.NotEqual(t, first, signed)
+}
+
+func TestRunSTHRefresher(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := NewMockStore(ctrl)
+	db, err := New("test.example.com", skey, WithStore(store), WithSTHRefreshInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	// The refresher signs the tree head once, and requests find it cached.
+	store.EXPECT().TreeSize(gomock.Any()).Return(int64(1), nil).MinTimes(2)
+	store.EXPECT().ReadHashes(gomock.Any(), gomock.Any()).Return([]tlog.Hash{{1}}, nil).Times(1)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, db.RunSTHRefresher(ctx), context.DeadlineExceeded)
+
+	_, err = db.Signed(t.Context())
+	require.NoError(t, err)
+
+	t.Run("waits with the clock", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		// The refresher runs hourly, so it only refreshes three times in time if it waits with the clock.
+		clock := &sleepingClock{now: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+		clock.onSleep = func(n int) {
+			if n == 3 {
+				cancel()
+			}
+		}
+
+		store := NewMockStore(ctrl)
+		db, err := New("test.example.com", skey,
+			WithStore(store),
+			WithClock(clock),
+			WithSTHRefreshInterval(time.Hour),
+		)
+		require.NoError(t, err)
+
+		store.EXPECT().TreeSize(gomock.Any()).Return(int64(1), nil).Times(3)
+		store.EXPECT().ReadHashes(gomock.Any(), gomock.Any()).Return([]tlog.Hash{{1}}, nil).Times(1)
+
+		require.ErrorIs(t, db.RunSTHRefresher(ctx), context.Canceled)
+		require.Equal(t, []time.Duration{time.Hour, time.Hour, time.Hour}, clock.slept)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		db, err := New("test.example.com", skey, WithStore(store))
+		require.NoError(t, err)
+		require.ErrorIs(t, db.RunSTHRefresher(t.Context()), ErrNoSTHRefreshInterval)
+	})
+}
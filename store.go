@@ -3,12 +3,21 @@ package sumdb
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/pseudomuto/sumdb/internal/tree"
 	"golang.org/x/mod/sumdb/tlog"
 )
 
-// ErrNotFound is returned when a requested record does not exist in the store.
-var ErrNotFound = errors.New("record not found")
+var (
+	// ErrNotFound is returned when a requested record does not exist in the store.
+	ErrNotFound = errors.New("record not found")
+
+	// ErrMissingHash is returned by ReadHashes when a requested hash does not exist in the store. Hashes are never
+	// deleted, so this indicates a corrupt tree. Tree heads, tiles and proofs fail with it rather than being computed
+	// from missing (or all zero) hashes.
+	ErrMissingHash = tree.ErrMissingHash
+)
 
 type (
 	// Record represents a module checksum entry in the sumdb.
@@ -17,14 +26,39 @@ type (
 		Path    string
 		Version string
 		Data    []byte
+
+		// Published is when the version was published, according to its upstream proxy's .info, or zero if it's
+		// unknown. It's metadata outside of the cryptographic log, only set when the .info was fetched (see
+		// WithPublishTimes), and stores that can't persist it may drop it.
+		Published time.Time
+
+		// Annotations are set on records being added by RecordPipeline plugins, and stored alongside them when the
+		// Store implements AnnotationStore. Stores don't read them back with records; see (*SumDB).Annotations.
+		Annotations map[string]string
+	}
+
+	// Checkpoint is the state of the tree after an append: its size and root hash, and when the append happened.
+	Checkpoint struct {
+		Size int64
+		Root tlog.Hash
+		Time time.Time
+	}
+
+	// OutboxEvent is an encoded event waiting in an OutboxStore to be published.
+	OutboxEvent struct {
+		ID   int64
+		Data []byte
 	}
 
 	// Store defines the persistence interface for sumdb data.
 	// Implementations must be safe for concurrent use.
 	//
-	// A Store instance should only be used by a single SumDB. Sharing a Store
-	// across multiple SumDB instances is not supported and may corrupt the
-	// Merkle tree, as write serialization is handled at the SumDB level.
+	// Appends are serialized by the SumDB using the Store, so a Store may only be
+	// shared by several SumDB instances (e.g. replicas behind a load balancer) if
+	// each is configured with a Locker coordinating them (see WithLocker and
+	// postgres.Store.Locker). Without one, instances race on the tree size: they
+	// append records with the same IDs and overwrite each other's hashes,
+	// corrupting the Merkle tree.
 	Store interface {
 		// RecordID returns the ID of the record for the given module path and version.
 		// Returns ErrNotFound if no record exists.
@@ -43,6 +77,7 @@ type (
 		// ReadHashes returns the hashes at the given storage indexes.
 		// Indexes are computed using tlog.StoredHashIndex(level, n).
 		// The returned slice must have the same length as indexes.
+		// Returns an error wrapping ErrMissingHash if any of the hashes don't exist.
 		ReadHashes(ctx context.Context, indexes []int64) ([]tlog.Hash, error)
 
 		// WriteHashes stores hashes at the given storage indexes.
@@ -73,4 +108,125 @@ type (
 		// for all operations within the callback.
 		WithTx(ctx context.Context, fn func(Store) error) error
 	}
+
+	// AuditStore is an optional extension of Store that persists the signed admin audit log.
+	// When a Store implements AuditStore, admin operations are recorded in the audit log.
+	AuditStore interface {
+		Store
+
+		// AuditSize returns the number of entries in the audit log.
+		AuditSize(ctx context.Context) (int64, error)
+
+		// AddAuditEntry stores the signed entry with the given ID.
+		// IDs are sequential, starting at 0, and id always equals the current AuditSize.
+		AddAuditEntry(ctx context.Context, id int64, entry []byte) error
+
+		// AuditEntries returns the signed entries with IDs in the interval [id, id+n).
+		// The returned slice may have fewer than n entries if the range extends beyond the end of the log.
+		AuditEntries(ctx context.Context, id, n int64) ([][]byte, error)
+	}
+
+	// AnnotationStore is an optional extension of Store that persists record annotations. Annotations are arbitrary
+	// key/value metadata (e.g. "approved" or "deprecated") attached to records outside of the cryptographic log.
+	AnnotationStore interface {
+		Store
+
+		// SetAnnotation sets the annotation key on the record with the given ID. An empty value removes the
+		// annotation.
+		SetAnnotation(ctx context.Context, id int64, key, value string) error
+
+		// Annotations returns the annotations for the record with the given ID. Records without annotations return
+		// an empty map.
+		Annotations(ctx context.Context, id int64) (map[string]string, error)
+	}
+
+	// PathStore is an optional extension of Store that reports which module paths have records. It lets a
+	// PathVerifier run only for the first version of each path, rather than for every new version.
+	PathStore interface {
+		Store
+
+		// HasPath reports whether any record exists for the given module path.
+		HasPath(ctx context.Context, path string) (bool, error)
+	}
+
+	// PublishedStore is an optional extension of Store that queries records by their publish times (see
+	// Record.Published), e.g. for reports of the modules that entered the database in a given week.
+	PublishedStore interface {
+		Store
+
+		// PublishedRecords returns up to n of the records published in the interval [since, until), ordered by publish
+		// time. Records whose publish time is unknown are never returned.
+		PublishedRecords(ctx context.Context, since, until time.Time, n int64) ([]*Record, error)
+	}
+
+	// CheckpointStore is an optional extension of Store that persists a Checkpoint after each append, so that the tree
+	// can be looked up as it was at a given time (see SumDB.TreeAt). Checkpoints are added in the same transaction as
+	// the records they cover when the Store also implements TxStore.
+	CheckpointStore interface {
+		Store
+
+		// AddCheckpoint stores c. Checkpoints are added in order of size, and so of time.
+		AddCheckpoint(ctx context.Context, c *Checkpoint) error
+
+		// CheckpointAt returns the last checkpoint added at or before t (the one with the largest size among them).
+		// Returns ErrNotFound if there is none.
+		CheckpointAt(ctx context.Context, t time.Time) (*Checkpoint, error)
+
+		// Checkpoint returns the checkpoint added for the tree of the given size. Returns ErrNotFound if there is none.
+		Checkpoint(ctx context.Context, size int64) (*Checkpoint, error)
+	}
+
+	// OutboxStore is an optional extension of Store that persists an outbox of append events waiting to be delivered
+	// to a Publisher. Events are added in the same transaction as the records they describe when the Store also
+	// implements TxStore, so no append is lost if the process stops before publishing.
+	OutboxStore interface {
+		Store
+
+		// AddOutboxEvent adds an encoded event to the outbox, assigning it the next sequential ID.
+		AddOutboxEvent(ctx context.Context, data []byte) error
+
+		// OutboxEvents returns up to n of the events in the outbox, ordered by ID.
+		OutboxEvents(ctx context.Context, n int64) ([]*OutboxEvent, error)
+
+		// DeleteOutboxEvents removes the events with the given IDs from the outbox.
+		DeleteOutboxEvents(ctx context.Context, ids []int64) error
+	}
+
+	// AppendHookStore is an optional extension of Store that maintains derived indexes (e.g. per-path version lists,
+	// hash or search indexes) alongside the log. OnAppend is called on the transactional view of the Store, in the same
+	// transaction as each append when the Store also implements TxStore, so indexes never disagree with the log.
+	AppendHookStore interface {
+		Store
+
+		// OnAppend is called once the record with the given ID has been added and the tree updated. Returning an error
+		// aborts the append.
+		OnAppend(ctx context.Context, id int64, rec *Record) error
+	}
+
+	// TileStore is an optional extension of Store that persists the data of full tiles, which never changes once
+	// served, so that they're served verbatim like sum.golang.org serves them rather than rebuilt from stored hashes
+	// or records for every request. Partial tiles are always rebuilt.
+	TileStore interface {
+		Store
+
+		// ReadSavedTile returns the data saved for the full tile t. Returns ErrNotFound if there is none.
+		ReadSavedTile(ctx context.Context, t tlog.Tile) ([]byte, error)
+
+		// WriteSavedTile saves data as the data of the full tile t. Tiles may be saved more than once (e.g. by servers
+		// sharing the store), always with the same data.
+		WriteSavedTile(ctx context.Context, t tlog.Tile, data []byte) error
+	}
+
+	// FormatStore is an optional extension of Store that records the FormatVersion of the data it holds, so that New
+	// refuses to use a store written in another format (e.g. by a newer release, or an older one that was never
+	// migrated) rather than silently corrupting it.
+	FormatStore interface {
+		Store
+
+		// FormatVersion returns the recorded format version, or 0 if none has been recorded yet.
+		FormatVersion(ctx context.Context) (int, error)
+
+		// SetFormatVersion records the format version.
+		SetFormatVersion(ctx context.Context, version int) error
+	}
 )
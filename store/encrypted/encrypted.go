@@ -0,0 +1,203 @@
+// Package encrypted provides a sumdb.Store decorator that encrypts module metadata at rest.
+//
+// Record data is sealed with AES-256-GCM before it reaches the underlying store, and record paths and versions are
+// replaced by keyed HMACs so that the database provider can't see which modules are in the log. Lookups and record
+// reads are transparently mapped back, so the SumDB always serves the canonical plaintext bytes. Paths and versions
+// are sealed along with the data, so any record can be stored, including non-module records such as those of a
+// contentlog.
+//
+// Hash encryption is optional (see WithHashEncryption). Hashes don't reveal module metadata on their own, but
+// encrypting them prevents the store contents from being correlated with other copies of the tree.
+//
+// The key is typically a data key unwrapped by a KMS at startup:
+//
+//	key, err := kms.Decrypt(ctx, wrappedKey)
+//	store, err := encrypted.New(sqlStore, key)
+package encrypted
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/pseudomuto/sumdb"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// KeySize is the required size of the encryption key.
+const KeySize = 32
+
+var (
+	// ErrInvalidKey is returned by New when the key is not KeySize bytes.
+	ErrInvalidKey = errors.New("encrypted: key must be 32 bytes")
+
+	// ErrDecrypt is returned when stored data can't be decrypted (wrong key or tampered data).
+	ErrDecrypt = errors.New("encrypted: failed to decrypt record")
+)
+
+type (
+	// Option configures an encrypted store.
+	Option func(*cipherSuite)
+
+	// cipherSuite holds the keys derived from the store key.
+	cipherSuite struct {
+		data         cipher.AEAD
+		index        []byte
+		hashes       cipher.Block
+		encodeHashes bool
+	}
+)
+
+// WithHashEncryption encrypts tree hashes in addition to record data.
+//
+// Hashes are encrypted with AES-CTR, since they must remain exactly tlog.HashSize bytes. Their storage index is the
+// high half of the counter block, and the low half counts their two blocks, so counter blocks never overlap between
+// indexes. Hashes at a given index never change in a well-formed tree, so each counter block is only used once.
+// Tampering with encrypted hashes is detected by clients verifying the signed tree head.
+func WithHashEncryption() Option {
+	return func(c *cipherSuite) { c.encodeHashes = true }
+}
+
+func newCipherSuite(key []byte, opts ...Option) (*cipherSuite, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	derive := func(info string) ([]byte, error) {
+		return hkdf.Key(sha256.New, key, nil, "sumdb/encrypted "+info, KeySize)
+	}
+
+	dataKey, err := derive("data")
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive data key: %w", err)
+	}
+
+	indexKey, err := derive("index")
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive index key: %w", err)
+	}
+
+	hashKey, err := derive("hashes")
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive hash key: %w", err)
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data cipher: %w", err)
+	}
+
+	hashBlock, err := aes.NewCipher(hashKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hash cipher: %w", err)
+	}
+
+	c := &cipherSuite{data: aead, index: indexKey, hashes: hashBlock}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// blind returns the keyed identifiers stored in place of path and version.
+func (c *cipherSuite) blind(path, version string) (string, string) {
+	mac := hmac.New(sha256.New, c.index)
+	mac.Write([]byte(path))
+	blindPath := hex.EncodeToString(mac.Sum(nil))
+
+	mac.Reset()
+	mac.Write([]byte(path + "@" + version))
+	return blindPath, hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal encrypts a record's data along with its path and version, binding it to the (blinded) record identity.
+func (c *cipherSuite) seal(r *sumdb.Record) (*sumdb.Record, error) {
+	path, version := c.blind(r.Path, r.Version)
+
+	plaintext := make([]byte, 0, 2*binary.MaxVarintLen64+len(r.Path)+len(r.Version)+len(r.Data))
+	plaintext = binary.AppendUvarint(plaintext, uint64(len(r.Path)))
+	plaintext = append(plaintext, r.Path...)
+	plaintext = binary.AppendUvarint(plaintext, uint64(len(r.Version)))
+	plaintext = append(plaintext, r.Version...)
+	plaintext = append(plaintext, r.Data...)
+
+	nonce := make([]byte, c.data.NonceSize(), c.data.NonceSize()+len(plaintext)+c.data.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return &sumdb.Record{
+		ID:      r.ID,
+		Path:    path,
+		Version: version,
+		Data:    c.data.Seal(nonce, nonce, plaintext, []byte(version)),
+
+		// Publish times are metadata about the version, like the record's ID, and aren't encrypted.
+		Published: r.Published,
+	}, nil
+}
+
+// open decrypts a stored record, restoring its path and version from the sealed identity.
+func (c *cipherSuite) open(r *sumdb.Record) (*sumdb.Record, error) {
+	ns := c.data.NonceSize()
+	if len(r.Data) < ns {
+		return nil, ErrDecrypt
+	}
+
+	nonce, sealed := r.Data[:ns], r.Data[ns:]
+	plaintext, err := c.data.Open(nil, nonce, sealed, []byte(r.Version))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	path, rest, ok := cutIdentityField(plaintext)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed record identity", ErrDecrypt)
+	}
+	version, data, ok := cutIdentityField(rest)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed record identity", ErrDecrypt)
+	}
+
+	if _, v := c.blind(path, version); v != r.Version {
+		return nil, fmt.Errorf("%w: record identity mismatch", ErrDecrypt)
+	}
+
+	return &sumdb.Record{ID: r.ID, Path: path, Version: version, Data: data, Published: r.Published}, nil
+}
+
+// cutIdentityField splits a length-prefixed field off the front of b.
+func cutIdentityField(b []byte) (string, []byte, bool) {
+	n, k := binary.Uvarint(b)
+	if k <= 0 || n > uint64(len(b)-k) {
+		return "", nil, false
+	}
+	return string(b[k : k+int(n)]), b[k+int(n):], true
+}
+
+// xorHashes encrypts (or decrypts) hashes in place when hash encryption is enabled.
+func (c *cipherSuite) xorHashes(indexes []int64, hashes []tlog.Hash) {
+	if !c.encodeHashes {
+		return
+	}
+
+	// The storage index fills the high half of the counter block and CTR increments the low half, so the blocks of
+	// different hashes never share a counter.
+	var iv [aes.BlockSize]byte
+	for i, idx := range indexes {
+		binary.BigEndian.PutUint64(iv[:8], uint64(idx)) // #nosec G115 -- storage indexes are never negative
+		cipher.NewCTR(c.hashes, iv[:]).XORKeyStream(hashes[i][:], hashes[i][:])
+	}
+}
@@ -0,0 +1,114 @@
+package encrypted
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/pseudomuto/sumdb"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+type (
+	// store wraps a sumdb.Store, encrypting data before it is persisted.
+	store struct {
+		next   sumdb.Store
+		cipher *cipherSuite
+	}
+
+	// txStore is a store whose underlying Store supports transactions.
+	txStore struct {
+		*store
+		tx sumdb.TxStore
+	}
+)
+
+// New wraps s with a Store that encrypts record data (and optionally hashes) with key, which must be KeySize bytes.
+// If s implements sumdb.TxStore, so does the returned Store.
+//
+// The returned Store hides every other optional extension of s (sumdb.CheckpointStore, sumdb.TileStore,
+// sumdb.OutboxStore, sumdb.AnnotationStore, sumdb.FormatStore and so on), since most of them would persist module
+// paths, tiles or events in plaintext beside the encrypted records. The features depending on them are unavailable, as
+// they are with stores that don't implement them.
+//
+// The same key must be used for the lifetime of the store. Records written with a different key can't be read.
+func New(s sumdb.Store, key []byte, opts ...Option) (sumdb.Store, error) {
+	c, err := newCipherSuite(key, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &store{next: s, cipher: c}
+	if tx, ok := s.(sumdb.TxStore); ok {
+		return &txStore{store: base, tx: tx}, nil
+	}
+	return base, nil
+}
+
+func (s *store) RecordID(ctx context.Context, path, version string) (int64, error) {
+	path, version = s.cipher.blind(path, version)
+	return s.next.RecordID(ctx, path, version)
+}
+
+func (s *store) Records(ctx context.Context, id, n int64) ([]*sumdb.Record, error) {
+	recs, err := s.next.Records(ctx, id, n)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*sumdb.Record, len(recs))
+	for i, r := range recs {
+		if out[i], err = s.cipher.open(r); err != nil {
+			return nil, fmt.Errorf("record %d: %w", r.ID, err)
+		}
+	}
+
+	return out, nil
+}
+
+func (s *store) AddRecord(ctx context.Context, r *sumdb.Record) (int64, error) {
+	sealed, err := s.cipher.seal(r)
+	if err != nil {
+		return 0, err
+	}
+	return s.next.AddRecord(ctx, sealed)
+}
+
+func (s *store) ReadHashes(ctx context.Context, indexes []int64) ([]tlog.Hash, error) {
+	hashes, err := s.next.ReadHashes(ctx, indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Some stores report missing hashes as zero hashes, which would decrypt into random-looking ones.
+	for i, h := range hashes {
+		if h == (tlog.Hash{}) {
+			return nil, fmt.Errorf("%w: %d", sumdb.ErrMissingHash, indexes[i])
+		}
+	}
+
+	hashes = slices.Clone(hashes)
+	s.cipher.xorHashes(indexes, hashes)
+	return hashes, nil
+}
+
+func (s *store) WriteHashes(ctx context.Context, indexes []int64, hashes []tlog.Hash) error {
+	hashes = slices.Clone(hashes)
+	s.cipher.xorHashes(indexes, hashes)
+	return s.next.WriteHashes(ctx, indexes, hashes)
+}
+
+func (s *store) TreeSize(ctx context.Context) (int64, error) {
+	return s.next.TreeSize(ctx)
+}
+
+func (s *store) SetTreeSize(ctx context.Context, size int64) error {
+	return s.next.SetTreeSize(ctx, size)
+}
+
+// WithTx implements sumdb.TxStore.
+func (s *txStore) WithTx(ctx context.Context, fn func(sumdb.Store) error) error {
+	return s.tx.WithTx(ctx, func(tx sumdb.Store) error {
+		return fn(&store{next: tx, cipher: s.cipher})
+	})
+}
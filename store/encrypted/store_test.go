@@ -0,0 +1,169 @@
+package encrypted_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/tree"
+	. "github.com/pseudomuto/sumdb/store/encrypted"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestStore(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+	data := []byte("example.com/foo v1.0.0 h1:abc=\nexample.com/foo v1.0.0/go.mod h1:def=\n")
+
+	t.Run("invalid key", func(t *testing.T) {
+		_, err := New(memstore.New(), []byte("short"))
+		require.ErrorIs(t, err, ErrInvalidKey)
+	})
+
+	t.Run("encrypts records at rest", func(t *testing.T) {
+		fake := memstore.New()
+		store, err := New(fake, key)
+		require.NoError(t, err)
+
+		id, err := store.AddRecord(t.Context(), &sumdb.Record{Path: "example.com/foo", Version: "v1.0.0", Data: data})
+		require.NoError(t, err)
+
+		stored, err := fake.Records(t.Context(), 0, 1)
+		require.NoError(t, err)
+		raw := stored[0]
+		require.NotContains(t, raw.Path, "example.com")
+		require.NotContains(t, raw.Version, "v1.0.0")
+		require.NotContains(t, string(raw.Data), "example.com")
+
+		got, err := store.RecordID(t.Context(), "example.com/foo", "v1.0.0")
+		require.NoError(t, err)
+		require.Equal(t, id, got)
+
+		recs, err := store.Records(t.Context(), 0, 1)
+		require.NoError(t, err)
+		require.Equal(t, []*sumdb.Record{{ID: id, Path: "example.com/foo", Version: "v1.0.0", Data: data}}, recs)
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		fake := memstore.New()
+		store, err := New(fake, key)
+		require.NoError(t, err)
+
+		_, err = store.AddRecord(t.Context(), &sumdb.Record{Path: "example.com/foo", Version: "v1.0.0", Data: data})
+		require.NoError(t, err)
+
+		other, err := New(fake, bytes.Repeat([]byte{8}, KeySize))
+		require.NoError(t, err)
+
+		_, err = other.Records(t.Context(), 0, 1)
+		require.ErrorIs(t, err, ErrDecrypt)
+	})
+
+	t.Run("hash encryption", func(t *testing.T) {
+		plain, enc := memstore.New(), memstore.New()
+		store, err := New(enc, key, WithHashEncryption())
+		require.NoError(t, err)
+
+		for i, d := range []string{"a\n", "b\n", "c\n"} {
+			require.NoError(t, tree.AddRecord(t.Context(), plain, int64(i), []byte(d)))
+			require.NoError(t, tree.AddRecord(t.Context(), store, int64(i), []byte(d)))
+		}
+
+		indexes := []int64{0, 1, 2, 3}
+		plainHashes, err := plain.ReadHashes(t.Context(), indexes)
+		require.NoError(t, err)
+		encHashes, err := enc.ReadHashes(t.Context(), indexes)
+		require.NoError(t, err)
+		require.NotEqual(t, plainHashes, encHashes)
+
+		want, err := tree.TreeHash(t.Context(), plain)
+		require.NoError(t, err)
+
+		got, err := tree.TreeHash(t.Context(), store)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("hash counter blocks don't overlap", func(t *testing.T) {
+		fake := memstore.New()
+		store, err := New(fake, key, WithHashEncryption())
+		require.NoError(t, err)
+
+		// Equal plaintexts expose the keystream, so no 16-byte block may repeat across indexes.
+		indexes := []int64{0, 1, 2, 5, 6, 1 << 32, 1<<32 + 1}
+		require.NoError(t, store.WriteHashes(t.Context(), indexes, make([]tlog.Hash, len(indexes))))
+
+		stored, err := fake.ReadHashes(t.Context(), indexes)
+		require.NoError(t, err)
+
+		seen := make(map[string]int64)
+		for i, idx := range indexes {
+			ct := stored[i]
+			for _, block := range [][]byte{ct[:16], ct[16:]} {
+				other, dup := seen[string(block)]
+				require.False(t, dup, "index %d shares a keystream block with index %d", idx, other)
+				seen[string(block)] = idx
+			}
+		}
+
+		hashes, err := store.ReadHashes(t.Context(), indexes)
+		require.NoError(t, err)
+		require.Equal(t, make([]tlog.Hash, len(indexes)), hashes)
+	})
+
+	t.Run("stores non-module records", func(t *testing.T) {
+		store, err := New(memstore.New(), key)
+		require.NoError(t, err)
+
+		rec := &sumdb.Record{Path: "releases/app.tar.gz", Version: "blob", Data: []byte("\x00binary\xffcontent")}
+		id, err := store.AddRecord(t.Context(), rec)
+		require.NoError(t, err)
+
+		recs, err := store.Records(t.Context(), id, 1)
+		require.NoError(t, err)
+		require.Equal(t, []*sumdb.Record{{ID: id, Path: rec.Path, Version: rec.Version, Data: rec.Data}}, recs)
+	})
+
+	t.Run("hides optional extensions", func(t *testing.T) {
+		var next sumdb.Store = memstore.New()
+		store, err := New(next, key)
+		require.NoError(t, err)
+
+		_, ok := next.(sumdb.CheckpointStore)
+		require.True(t, ok)
+		_, ok = store.(sumdb.CheckpointStore)
+		require.False(t, ok)
+
+		_, ok = next.(sumdb.FormatStore)
+		require.True(t, ok)
+		_, ok = store.(sumdb.FormatStore)
+		require.False(t, ok)
+	})
+
+	t.Run("preserves transactions", func(t *testing.T) {
+		store, err := New(memstore.New(), key)
+		require.NoError(t, err)
+
+		_, ok := store.(sumdb.TxStore)
+		require.True(t, ok)
+	})
+
+	t.Run("missing hashes", func(t *testing.T) {
+		// Stores may report missing hashes as zero hashes, which mustn't be decrypted into random-looking ones.
+		inner := zeroHashes{memstore.New()}
+		store, err := New(inner, key, WithHashEncryption())
+		require.NoError(t, err)
+
+		_, err = store.ReadHashes(t.Context(), []int64{0, 1})
+		require.ErrorIs(t, err, sumdb.ErrMissingHash)
+	})
+}
+
+// zeroHashes is a Store reporting every hash as a zero hash, as some stores do for missing hashes.
+type zeroHashes struct{ sumdb.Store }
+
+func (zeroHashes) ReadHashes(_ context.Context, indexes []int64) ([]tlog.Hash, error) {
+	return make([]tlog.Hash, len(indexes)), nil
+}
@@ -0,0 +1,603 @@
+// Package fsstore provides a sumdb.Store that keeps the log in files, publishing its tiles in the layout of the sumdb
+// HTTP API (tile/8/L/N, tile/8/L/N.p/W and tile/8/data/N), so that they can be served as static files (e.g. by a CDN)
+// while the server answers lookups and serves the signed tree head.
+//
+// A store's directory contains:
+//
+//	records  the records, one JSON object per line, in ID order
+//	hashes   the tree's stored hashes, 32 bytes each, at their storage index
+//	size     the tree size
+//	format   the format version of the data (see sumdb.FormatVersion)
+//	tile/    the tiles of the tree at its current size
+//
+// Tiles are published when the tree size is set. Partial tiles are kept until the tile is complete, so clients holding
+// an older tree head can still read them, and then removed, since clients fall back to the full tile.
+//
+// The store implements sumdb.TxStore, sumdb.PathStore, sumdb.TileStore and sumdb.FormatStore, so the server also reads
+// full tiles from their files rather than rebuilding them. Writes are committed by replacing the size file, and records
+// beyond the tree size (from an append interrupted by a crash) are discarded when the store is opened.
+//
+//	store, err := fsstore.Open("/var/lib/sumdb")
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//
+//	db, err := sumdb.New("sum.example.com", skey, sumdb.WithStore(store))
+package fsstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+var (
+	_ sumdb.TxStore     = (*Store)(nil)
+	_ sumdb.PathStore   = (*Store)(nil)
+	_ sumdb.TileStore   = (*Store)(nil)
+	_ sumdb.FormatStore = (*Store)(nil)
+)
+
+type (
+	// Store is a sumdb.Store backed by files in a directory. It's safe for concurrent use, but only one process may
+	// open a directory at a time. Transactions hold an exclusive lock on the store, so reads wait for them to finish
+	// and never see uncommitted changes.
+	Store struct {
+		dir string
+
+		mu      sync.RWMutex
+		records *os.File
+		hashes  *os.File
+		offsets []int64          // the offset of each record in the records file, followed by the file's size
+		ids     map[string]int64 // record IDs by module@version
+		paths   map[string]int   // number of records by module path
+		size    int64
+	}
+
+	// entry is a record as encoded in the records file. Its ID is its position in the file.
+	entry struct {
+		Path      string    `json:"path"`
+		Version   string    `json:"version"`
+		Data      []byte    `json:"data"`
+		Published time.Time `json:"published,omitzero"`
+	}
+
+	// tx is the view of a store passed to WithTx, and used by the store's own writes. Its changes are kept in memory
+	// until it's committed.
+	tx struct {
+		s       *Store
+		records []*sumdb.Record
+		ids     map[string]int64
+		hashes  map[int64]tlog.Hash
+		size    int64
+	}
+)
+
+// Open opens (creating it if needed) the store in dir.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %s, %w", dir, err)
+	}
+
+	s := &Store{dir: dir, ids: make(map[string]int64), paths: make(map[string]int)}
+	if err := s.open(); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the store's files and loads its index.
+func (s *Store) open() error {
+	var err error
+	if s.size, err = readSize(filepath.Join(s.dir, "size")); err != nil {
+		return err
+	}
+
+	if s.hashes, err = openFile(filepath.Join(s.dir, "hashes")); err != nil {
+		return err
+	}
+	if s.records, err = openFile(filepath.Join(s.dir, "records")); err != nil {
+		return err
+	}
+
+	// Records beyond the tree size, including a partially written one, are from an interrupted append.
+	r := bufio.NewReader(s.records)
+	var off int64
+	for int64(len(s.offsets)) < s.size {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read records: %s, %w", s.dir, err)
+		}
+
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("failed to decode record: %d, %w", len(s.offsets), err)
+		}
+		s.index(off, e.Path, e.Version)
+		off += int64(len(line))
+	}
+	s.offsets = append(s.offsets, off)
+
+	if err := s.records.Truncate(off); err != nil {
+		return fmt.Errorf("failed to discard uncommitted records: %s, %w", s.dir, err)
+	}
+	return nil
+}
+
+// index adds the record for path@version, at off in the records file, to the in-memory index.
+func (s *Store) index(off int64, path, version string) {
+	s.ids[path+"@"+version] = int64(len(s.offsets))
+	s.paths[path]++
+	s.offsets = append(s.offsets, off)
+}
+
+// count returns the number of committed records. Callers must hold the store's lock, once the store is open.
+func (s *Store) count() int64 {
+	return int64(len(s.offsets) - 1)
+}
+
+// record returns the record with the given ID for e.
+func (e *entry) record(id int64) *sumdb.Record {
+	return &sumdb.Record{ID: id, Path: e.Path, Version: e.Version, Data: e.Data, Published: e.Published}
+}
+
+// Close closes the store's files. The Store must not be used afterwards.
+func (s *Store) Close() error {
+	var errs []error
+	for _, f := range []*os.File{s.records, s.hashes} {
+		if f != nil {
+			errs = append(errs, f.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RecordID returns the ID of the record for the given module path and version.
+func (s *Store) RecordID(_ context.Context, path, version string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.ids[path+"@"+version]
+	if !ok {
+		return 0, sumdb.ErrNotFound
+	}
+	return id, nil
+}
+
+// HasPath implements sumdb.PathStore.
+func (s *Store) HasPath(_ context.Context, path string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.paths[path] > 0, nil
+}
+
+// Records returns records with IDs in the interval [id, id+n).
+func (s *Store) Records(_ context.Context, id, n int64) ([]*sumdb.Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readRecords(id, n)
+}
+
+// readRecords reads the committed records with IDs in the interval [id, id+n). Callers must hold the store's lock.
+func (s *Store) readRecords(id, n int64) ([]*sumdb.Record, error) {
+	id = max(id, 0)
+	end := min(id+n, s.count())
+	if id >= end {
+		return nil, nil
+	}
+
+	buf := make([]byte, s.offsets[end]-s.offsets[id])
+	if _, err := s.records.ReadAt(buf, s.offsets[id]); err != nil {
+		return nil, fmt.Errorf("failed to read records: [%d, %d), %w", id, end, err)
+	}
+
+	records := make([]*sumdb.Record, 0, end-id)
+	for line := range bytes.Lines(buf) {
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("failed to decode record: %d, %w", id, err)
+		}
+		records = append(records, e.record(id))
+		id++
+	}
+	return records, nil
+}
+
+// AddRecord adds a new entry for the specified module.
+func (s *Store) AddRecord(ctx context.Context, r *sumdb.Record) (id int64, err error) {
+	err = s.WithTx(ctx, func(tx sumdb.Store) error {
+		id, err = tx.AddRecord(ctx, r)
+		return err
+	})
+	return id, err
+}
+
+// ReadHashes returns the hashes at the given storage indexes.
+func (s *Store) ReadHashes(_ context.Context, indexes []int64) ([]tlog.Hash, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hashes := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		h, err := s.readHash(idx)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = h
+	}
+	return hashes, nil
+}
+
+// readHash reads the committed hash at storage index idx. Callers must hold the store's lock.
+func (s *Store) readHash(idx int64) (tlog.Hash, error) {
+	var h tlog.Hash
+	_, err := s.hashes.ReadAt(h[:], idx*tlog.HashSize)
+	switch {
+	case errors.Is(err, io.EOF) || (err == nil && h == tlog.Hash{}):
+		return h, fmt.Errorf("%w: %d", sumdb.ErrMissingHash, idx)
+	case err != nil:
+		return h, fmt.Errorf("failed to read hash: %d, %w", idx, err)
+	}
+	return h, nil
+}
+
+// WriteHashes stores hashes at the given storage indexes.
+func (s *Store) WriteHashes(ctx context.Context, indexes []int64, hashes []tlog.Hash) error {
+	return s.WithTx(ctx, func(tx sumdb.Store) error { return tx.WriteHashes(ctx, indexes, hashes) })
+}
+
+// TreeSize returns the current number of records in the tree.
+func (s *Store) TreeSize(context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.size, nil
+}
+
+// ReadSavedTile implements sumdb.TileStore, reading the full tile t published when the tree grew past it. Tiles beyond
+// the tree size (published by an append interrupted by a crash) aren't returned.
+func (s *Store) ReadSavedTile(_ context.Context, t tlog.Tile) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if t.H != tree.TileHeight || t.W != 1<<t.H || (t.N+1)<<(t.H*(max(t.L, 0)+1)) > s.size {
+		return nil, sumdb.ErrNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(t.Path())))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, sumdb.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tile: %s, %w", t.Path(), err)
+	}
+	return data, nil
+}
+
+// WriteSavedTile implements sumdb.TileStore. It does nothing, since tiles are published when the tree size is set.
+func (s *Store) WriteSavedTile(context.Context, tlog.Tile, []byte) error {
+	return nil
+}
+
+// SetTreeSize updates the tree size, publishing the tiles that changed.
+func (s *Store) SetTreeSize(ctx context.Context, size int64) error {
+	return s.WithTx(ctx, func(tx sumdb.Store) error { return tx.SetTreeSize(ctx, size) })
+}
+
+// FormatVersion implements sumdb.FormatStore, reading the format file.
+func (s *Store) FormatVersion(context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	path := filepath.Join(s.dir, "format")
+	data, err := os.ReadFile(path) // #nosec G304 -- path is provided by the operator
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read format version: %s, %w", path, err)
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid format version: %s, %w", path, err)
+	}
+	return version, nil
+}
+
+// SetFormatVersion implements sumdb.FormatStore, replacing the format file.
+func (s *Store) SetFormatVersion(_ context.Context, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFile(filepath.Join(s.dir, "format"), []byte(strconv.Itoa(version)))
+}
+
+// WithTx implements sumdb.TxStore. The store is locked until fn returns, and its changes are only written if fn
+// succeeds.
+func (s *Store) WithTx(ctx context.Context, fn func(sumdb.Store) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := &tx{s: s, ids: make(map[string]int64), hashes: make(map[int64]tlog.Hash), size: s.size}
+	if err := fn(t); err != nil {
+		return err
+	}
+	return t.commit(ctx)
+}
+
+func (t *tx) RecordID(ctx context.Context, path, version string) (int64, error) {
+	if id, ok := t.ids[path+"@"+version]; ok {
+		return id, nil
+	}
+	if id, ok := t.s.ids[path+"@"+version]; ok {
+		return id, nil
+	}
+	return 0, sumdb.ErrNotFound
+}
+
+func (t *tx) HasPath(_ context.Context, path string) (bool, error) {
+	if t.s.paths[path] > 0 {
+		return true, nil
+	}
+	for _, r := range t.records {
+		if r.Path == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *tx) Records(_ context.Context, id, n int64) ([]*sumdb.Record, error) {
+	records, err := t.s.readRecords(id, n)
+	if err != nil {
+		return nil, err
+	}
+
+	committed := t.s.count()
+	for i := max(id, committed); i < min(id+n, committed+int64(len(t.records))); i++ {
+		r := *t.records[i-committed]
+		records = append(records, &r)
+	}
+	return records, nil
+}
+
+func (t *tx) AddRecord(ctx context.Context, r *sumdb.Record) (int64, error) {
+	if _, err := t.RecordID(ctx, r.Path, r.Version); err == nil {
+		return 0, fmt.Errorf("record already exists: %s@%s", r.Path, r.Version)
+	}
+
+	rec := *r
+	rec.ID = t.s.count() + int64(len(t.records))
+	rec.Data = bytes.Clone(r.Data)
+	t.records = append(t.records, &rec)
+	t.ids[r.Path+"@"+r.Version] = rec.ID
+	return rec.ID, nil
+}
+
+func (t *tx) ReadHashes(_ context.Context, indexes []int64) ([]tlog.Hash, error) {
+	hashes := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		if h, ok := t.hashes[idx]; ok {
+			hashes[i] = h
+			continue
+		}
+
+		h, err := t.s.readHash(idx)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = h
+	}
+	return hashes, nil
+}
+
+func (t *tx) WriteHashes(_ context.Context, indexes []int64, hashes []tlog.Hash) error {
+	for i, idx := range indexes {
+		t.hashes[idx] = hashes[i]
+	}
+	return nil
+}
+
+func (t *tx) TreeSize(context.Context) (int64, error) {
+	return t.size, nil
+}
+
+func (t *tx) SetTreeSize(_ context.Context, size int64) error {
+	t.size = size
+	return nil
+}
+
+// commit writes the transaction's hashes and records, then publishes the tiles that changed and the new tree size.
+// The size file is replaced last, so that records appended by a transaction interrupted before then are discarded by
+// Open. Hashes beyond the tree size are overwritten by the next append.
+func (t *tx) commit(ctx context.Context) error {
+	s := t.s
+	for idx, h := range t.hashes {
+		if _, err := s.hashes.WriteAt(h[:], idx*tlog.HashSize); err != nil {
+			return fmt.Errorf("failed to write hash: %d, %w", idx, err)
+		}
+	}
+
+	end := s.offsets[len(s.offsets)-1]
+	var buf bytes.Buffer
+	offsets := make([]int64, len(t.records))
+	for i, r := range t.records {
+		offsets[i] = end + int64(buf.Len())
+		line, err := json.Marshal(entry{Path: r.Path, Version: r.Version, Data: r.Data, Published: r.Published})
+		if err != nil {
+			return fmt.Errorf("failed to encode record: %d, %w", r.ID, err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	if err := t.write(ctx, end, buf.Bytes()); err != nil {
+		// Undo the append, so that the records file matches the index.
+		_ = s.records.Truncate(end)
+		return err
+	}
+
+	s.offsets = s.offsets[:len(s.offsets)-1]
+	for i, r := range t.records {
+		s.index(offsets[i], r.Path, r.Version)
+	}
+	s.offsets = append(s.offsets, end+int64(buf.Len()))
+	s.size = t.size
+	return nil
+}
+
+// write appends data to the records file at end and, if the tree size changed, syncs the store's files, publishes
+// the tiles that changed and writes the new size.
+func (t *tx) write(ctx context.Context, end int64, data []byte) error {
+	s := t.s
+	if _, err := s.records.WriteAt(data, end); err != nil {
+		return fmt.Errorf("failed to write records: %s, %w", s.dir, err)
+	}
+
+	if t.size == s.size {
+		return nil
+	}
+
+	for _, f := range []*os.File{s.records, s.hashes} {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync file: %s, %w", f.Name(), err)
+		}
+	}
+
+	if err := t.publishTiles(ctx, s.size, t.size); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(s.dir, "size"), strconv.AppendInt(nil, t.size, 10))
+}
+
+// publishTiles writes the hash and data tiles that changed when the tree grew from oldSize to newSize. Tiles whose
+// hashes or records aren't stored, which is only the case when the size is set ahead of them, aren't published.
+func (t *tx) publishTiles(ctx context.Context, oldSize, newSize int64) error {
+	for _, tile := range tlog.NewTiles(tree.TileHeight, oldSize, newSize) {
+		data, err := tree.ReadTile(ctx, t, tile)
+		if errors.Is(err, sumdb.ErrMissingHash) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := t.s.publish(tile, data); err != nil {
+			return err
+		}
+
+		if tile.L != 0 {
+			continue
+		}
+
+		records, err := t.Records(ctx, tile.N<<tree.TileHeight, int64(tile.W))
+		if err != nil {
+			return err
+		}
+		if len(records) != tile.W {
+			continue
+		}
+
+		var buf bytes.Buffer
+		for _, r := range records {
+			buf.Write(r.Data)
+			buf.WriteByte('\n')
+		}
+		tile.L = -1
+		if err := t.s.publish(tile, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish writes the tile's data to its path. Once a tile is complete, its partial tiles are removed.
+func (s *Store) publish(tile tlog.Tile, data []byte) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(tile.Path()))
+	if err := writeFile(path, data); err != nil {
+		return err
+	}
+
+	if tile.W == 1<<tile.H {
+		if err := os.RemoveAll(path + ".p"); err != nil {
+			return fmt.Errorf("failed to remove partial tiles: %s, %w", tile.Path(), err)
+		}
+	}
+	return nil
+}
+
+// openFile opens (creating it if needed) the file at path for reading and writing.
+func openFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600) // #nosec G304 -- path is provided by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %s, %w", path, err)
+	}
+	return f, nil
+}
+
+// readSize reads the tree size from the file at path, or 0 if it doesn't exist.
+func readSize(path string) (int64, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is provided by the operator
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read tree size: %s, %w", path, err)
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid tree size: %s, %w", path, err)
+	}
+	return size, nil
+}
+
+// writeFile writes data to path, creating its directory if needed and replacing it atomically, so that readers (e.g.
+// a web server) never see a partially written file.
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create directory: %s, %w", dir, err)
+	}
+
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %s, %w", path, err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write file: %s, %w", path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %s, %w", path, err)
+	}
+
+	if err := os.Chmod(f.Name(), 0o644); err != nil { // #nosec G302 -- tiles are public
+		return fmt.Errorf("failed to set file mode: %s, %w", path, err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace file: %s, %w", path, err)
+	}
+	return nil
+}
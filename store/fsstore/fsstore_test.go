@@ -0,0 +1,177 @@
+package fsstore_test
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pseudomuto/sumdb"
+	. "github.com/pseudomuto/sumdb/store/fsstore"
+	"github.com/pseudomuto/sumdb/store/storetest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(tb testing.TB) sumdb.Store { return newTestStore(tb, tb.TempDir()) })
+}
+
+func TestStore_Tiles(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir)
+
+	skey, _, err := sumdb.GenerateKeys("test.example.com")
+	require.NoError(t, err)
+	db, err := sumdb.New("test.example.com", skey, sumdb.WithStore(store))
+	require.NoError(t, err)
+
+	// published returns the paths of the published tiles, checking that each matches the tile served by db.
+	published := func(t *testing.T) []string {
+		t.Helper()
+
+		var paths []string
+		err := filepath.WalkDir(filepath.Join(dir, "tile"), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			require.NoError(t, err)
+			rel = filepath.ToSlash(rel)
+			paths = append(paths, rel)
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+			db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+rel, nil))
+			require.Equal(t, http.StatusOK, rec.Code, rel)
+			require.Equal(t, rec.Body.Bytes(), data, rel)
+			return nil
+		})
+		require.NoError(t, err)
+		return paths
+	}
+
+	require.NoError(t, storetest.Populate(t.Context(), store, 200))
+	require.Equal(t, []string{"tile/8/0/000.p/200", "tile/8/data/000.p/200"}, published(t))
+
+	// Partial tiles are kept until the tile is complete.
+	require.NoError(t, storetest.Populate(t.Context(), store, 220))
+	require.Equal(t, []string{
+		"tile/8/0/000.p/200",
+		"tile/8/0/000.p/220",
+		"tile/8/data/000.p/200",
+		"tile/8/data/000.p/220",
+	}, published(t))
+
+	require.NoError(t, storetest.Populate(t.Context(), store, 300))
+	require.Equal(t, []string{
+		"tile/8/0/000",
+		"tile/8/0/001.p/44",
+		"tile/8/1/000.p/1",
+		"tile/8/data/000",
+		"tile/8/data/001.p/44",
+	}, published(t))
+
+	// Full tiles are read from their files, unless they're beyond the tree size.
+	tile := tlog.Tile{H: 8, L: 0, N: 0, W: 256}
+	data, err := store.ReadSavedTile(t.Context(), tile)
+	require.NoError(t, err)
+	require.Len(t, data, 256*tlog.HashSize)
+	require.NoError(t, store.WriteSavedTile(t.Context(), tile, nil))
+
+	for _, tile := range []tlog.Tile{{H: 8, L: 0, N: 1, W: 44}, {H: 8, L: -1, N: 1, W: 256}, {H: 8, L: 1, N: 0, W: 256}} {
+		_, err := store.ReadSavedTile(t.Context(), tile)
+		require.ErrorIs(t, err, sumdb.ErrNotFound, tile.Path())
+	}
+}
+
+func TestStore_WithTx(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir)
+	require.NoError(t, storetest.Populate(t.Context(), store, 10))
+
+	err := store.WithTx(t.Context(), func(tx sumdb.Store) error {
+		id, err := tx.AddRecord(t.Context(), &sumdb.Record{Path: "example.com/mod", Version: "v1.0.0", Data: []byte("a\n")})
+		require.NoError(t, err)
+		require.Equal(t, int64(10), id)
+
+		// The transaction sees its own changes.
+		recs, err := tx.Records(t.Context(), 9, 2)
+		require.NoError(t, err)
+		require.Len(t, recs, 2)
+		require.Equal(t, "example.com/mod", recs[1].Path)
+
+		require.NoError(t, tx.WriteHashes(t.Context(), []int64{0}, []tlog.Hash{{1}}))
+		require.NoError(t, tx.SetTreeSize(t.Context(), 11))
+		return errors.New("rollback")
+	})
+	require.EqualError(t, err, "rollback")
+
+	_, err = store.RecordID(t.Context(), "example.com/mod", "v1.0.0")
+	require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+	size, err := store.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(10), size)
+
+	hashes, err := store.ReadHashes(t.Context(), []int64{0})
+	require.NoError(t, err)
+	require.NotEqual(t, tlog.Hash{1}, hashes[0])
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, storetest.Populate(t.Context(), store, 10))
+
+	want, err := store.Records(t.Context(), 0, 10)
+	require.NoError(t, err)
+
+	// A record appended without growing the tree, as by an append interrupted by a crash.
+	_, err = store.AddRecord(t.Context(), &sumdb.Record{Path: "example.com/mod", Version: "v1.0.0", Data: []byte("a\n")})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store = newTestStore(t, dir)
+	size, err := store.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(10), size)
+
+	got, err := store.Records(t.Context(), 0, 20)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	// The interrupted append is discarded, so the tree continues from its size.
+	_, err = store.RecordID(t.Context(), "example.com/mod", "v1.0.0")
+	require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+	id, err := store.AddRecord(t.Context(), &sumdb.Record{Path: "example.com/mod", Version: "v1.0.0", Data: []byte("a\n")})
+	require.NoError(t, err)
+	require.Equal(t, int64(10), id)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "size"), []byte("garbage"), 0o600))
+	_, err = Open(dir)
+	require.Error(t, err)
+}
+
+// BenchmarkStore runs the standardized store benchmarks, for comparison with other backends.
+func BenchmarkStore(b *testing.B) {
+	storetest.Benchmark(b, func(tb testing.TB) sumdb.Store { return newTestStore(tb, tb.TempDir()) })
+}
+
+func newTestStore(tb testing.TB, dir string) *Store {
+	tb.Helper()
+
+	store, err := Open(dir)
+	require.NoError(tb, err)
+	tb.Cleanup(func() { _ = store.Close() })
+
+	return store
+}
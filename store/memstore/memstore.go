@@ -0,0 +1,456 @@
+// Package memstore provides an in-memory sumdb.Store, for tests and short-lived environments (e.g. CI jobs or preview
+// deployments) that don't need a database.
+//
+// The store implements sumdb.TxStore, sumdb.PathStore and sumdb.CheckpointStore. Its contents can be copied with
+// Snapshot and put back with Restore, e.g. to reset a store between tests, and a store opened with Open is saved to a
+// gob file when it's closed, and loaded from it when it's opened again:
+//
+//	store, err := memstore.Open("/tmp/sumdb.gob")
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//
+//	db, err := sumdb.New("sum.example.com", skey, sumdb.WithStore(store))
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+var (
+	_ sumdb.TxStore         = (*Store)(nil)
+	_ sumdb.PathStore       = (*Store)(nil)
+	_ sumdb.CheckpointStore = (*Store)(nil)
+	_ sumdb.FormatStore     = (*Store)(nil)
+)
+
+type (
+	// Store is an in-memory sumdb.Store. It's safe for concurrent use. Transactions hold an exclusive lock on the
+	// store, so reads wait for them to finish and never see uncommitted changes.
+	Store struct {
+		mu    sync.RWMutex
+		state *state
+		path  string
+	}
+
+	// Snapshot is a copy of the contents of a Store. Snapshots are encoded with encoding/gob when saved to a file.
+	Snapshot struct {
+		Records     []*sumdb.Record
+		Hashes      map[int64]tlog.Hash
+		Size        int64
+		Checkpoints []sumdb.Checkpoint
+		Format      int
+	}
+
+	// state is the contents of a Store. Its methods implement sumdb.Store without locking, so callers must hold the
+	// store's lock.
+	state struct {
+		records []*sumdb.Record
+		ids     map[string]int64 // record IDs by module@version
+		paths   map[string]int   // number of records by module path
+		hashes  map[int64]tlog.Hash
+		size    int64
+		format  int
+
+		// checkpoints are ordered by size, and so by time.
+		checkpoints []sumdb.Checkpoint
+	}
+
+	// tx is the view of a store passed to WithTx. It journals the hashes it overwrites, so that they can be restored
+	// if the transaction is rolled back. Records and checkpoints added and tree size changes are undone without a
+	// journal.
+	tx struct {
+		*state
+		records     int
+		checkpoints int
+		size        int64
+		hashes      map[int64]*tlog.Hash // the hashes overwritten, or nil for those that didn't exist
+	}
+)
+
+// New returns an empty Store.
+func New() *Store {
+	return &Store{state: newState()}
+}
+
+// Open returns a Store with the contents saved at path by Save (or Close), or an empty one if path doesn't exist. The
+// store is saved back to path when it's closed.
+func Open(path string) (*Store, error) {
+	s := New()
+	s.path = path
+
+	f, err := os.Open(path) // #nosec G304 -- path is provided by the operator
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %s, %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var snap Snapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("failed to decode store: %s, %w", path, err)
+	}
+
+	s.Restore(&snap)
+	return s, nil
+}
+
+// Close saves the store to the path it was opened from, if it was opened with Open. The store can still be used
+// afterwards, but further changes are only saved by closing it again.
+func (s *Store) Close() error {
+	if s.path == "" {
+		return nil
+	}
+	return s.Save(s.path)
+}
+
+// Save writes the store's contents to path, replacing it atomically.
+func (s *Store) Save(path string) error {
+	snap := s.Snapshot()
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %s, %w", path, err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if err := gob.NewEncoder(f).Encode(snap); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to encode store: %s, %w", path, err)
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync file: %s, %w", path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %s, %w", path, err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace file: %s, %w", path, err)
+	}
+	return nil
+}
+
+// Snapshot returns a copy of the store's contents.
+func (s *Store) Snapshot() *Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := &Snapshot{
+		Records:     make([]*sumdb.Record, len(s.state.records)),
+		Hashes:      maps.Clone(s.state.hashes),
+		Size:        s.state.size,
+		Checkpoints: append([]sumdb.Checkpoint(nil), s.state.checkpoints...),
+		Format:      s.state.format,
+	}
+	for i, r := range s.state.records {
+		snap.Records[i] = cloneRecord(r)
+	}
+	return snap
+}
+
+// Restore replaces the store's contents with a copy of snap. Record IDs are the positions of the records in
+// snap.Records.
+func (s *Store) Restore(snap *Snapshot) {
+	st := newState()
+	for _, r := range snap.Records {
+		st.add(r)
+	}
+	maps.Copy(st.hashes, snap.Hashes)
+	st.size = snap.Size
+	st.checkpoints = slices.Clone(snap.Checkpoints)
+	st.format = snap.Format
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = st
+}
+
+// RecordID returns the ID of the record for the given module path and version.
+func (s *Store) RecordID(ctx context.Context, path, version string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.RecordID(ctx, path, version)
+}
+
+// HasPath implements sumdb.PathStore.
+func (s *Store) HasPath(ctx context.Context, path string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.HasPath(ctx, path)
+}
+
+// Records returns records with IDs in the interval [id, id+n).
+func (s *Store) Records(ctx context.Context, id, n int64) ([]*sumdb.Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.Records(ctx, id, n)
+}
+
+// AddRecord adds a new entry for the specified module.
+func (s *Store) AddRecord(ctx context.Context, r *sumdb.Record) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.AddRecord(ctx, r)
+}
+
+// ReadHashes returns the hashes at the given storage indexes.
+func (s *Store) ReadHashes(ctx context.Context, indexes []int64) ([]tlog.Hash, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.ReadHashes(ctx, indexes)
+}
+
+// WriteHashes stores hashes at the given storage indexes.
+func (s *Store) WriteHashes(ctx context.Context, indexes []int64, hashes []tlog.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.WriteHashes(ctx, indexes, hashes)
+}
+
+// TreeSize returns the current number of records in the tree.
+func (s *Store) TreeSize(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.TreeSize(ctx)
+}
+
+// SetTreeSize updates the tree size.
+func (s *Store) SetTreeSize(ctx context.Context, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.SetTreeSize(ctx, size)
+}
+
+// FormatVersion implements sumdb.FormatStore.
+func (s *Store) FormatVersion(context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.format, nil
+}
+
+// SetFormatVersion implements sumdb.FormatStore.
+func (s *Store) SetFormatVersion(_ context.Context, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.format = version
+	return nil
+}
+
+// AddCheckpoint implements sumdb.CheckpointStore.
+func (s *Store) AddCheckpoint(ctx context.Context, c *sumdb.Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.AddCheckpoint(ctx, c)
+}
+
+// CheckpointAt implements sumdb.CheckpointStore.
+func (s *Store) CheckpointAt(ctx context.Context, t time.Time) (*sumdb.Checkpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.CheckpointAt(ctx, t)
+}
+
+// Checkpoint implements sumdb.CheckpointStore.
+func (s *Store) Checkpoint(ctx context.Context, size int64) (*sumdb.Checkpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.Checkpoint(ctx, size)
+}
+
+// WithTx implements sumdb.TxStore. The store is locked until fn returns, and its changes are undone if fn returns an
+// error or panics.
+func (s *Store) WithTx(_ context.Context, fn func(sumdb.Store) error) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := &tx{
+		state:       s.state,
+		records:     len(s.state.records),
+		checkpoints: len(s.state.checkpoints),
+		size:        s.state.size,
+		hashes:      make(map[int64]*tlog.Hash),
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			t.rollback()
+		}
+	}()
+
+	if err := fn(t); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// WriteHashes stores hashes at the given storage indexes, journaling the hashes they replace.
+func (t *tx) WriteHashes(ctx context.Context, indexes []int64, hashes []tlog.Hash) error {
+	for _, idx := range indexes {
+		if _, ok := t.hashes[idx]; ok {
+			continue
+		}
+		if h, ok := t.state.hashes[idx]; ok {
+			t.hashes[idx] = &h
+		} else {
+			t.hashes[idx] = nil
+		}
+	}
+	return t.state.WriteHashes(ctx, indexes, hashes)
+}
+
+// rollback undoes the transaction's changes.
+func (t *tx) rollback() {
+	for _, r := range t.state.records[t.records:] {
+		delete(t.state.ids, r.Path+"@"+r.Version)
+		if t.state.paths[r.Path]--; t.state.paths[r.Path] == 0 {
+			delete(t.state.paths, r.Path)
+		}
+	}
+	clear(t.state.records[t.records:])
+	t.state.records = t.state.records[:t.records]
+
+	for idx, h := range t.hashes {
+		if h == nil {
+			delete(t.state.hashes, idx)
+		} else {
+			t.state.hashes[idx] = *h
+		}
+	}
+	t.state.checkpoints = t.state.checkpoints[:t.checkpoints]
+	t.state.size = t.size
+}
+
+func newState() *state {
+	return &state{ids: make(map[string]int64), paths: make(map[string]int), hashes: make(map[int64]tlog.Hash)}
+}
+
+// add appends a copy of r, returning its ID.
+func (s *state) add(r *sumdb.Record) int64 {
+	id := int64(len(s.records))
+	rec := cloneRecord(r)
+	rec.ID = id
+
+	s.records = append(s.records, rec)
+	s.ids[r.Path+"@"+r.Version] = id
+	s.paths[r.Path]++
+	return id
+}
+
+func (s *state) RecordID(_ context.Context, path, version string) (int64, error) {
+	id, ok := s.ids[path+"@"+version]
+	if !ok {
+		return 0, sumdb.ErrNotFound
+	}
+	return id, nil
+}
+
+func (s *state) HasPath(_ context.Context, path string) (bool, error) {
+	return s.paths[path] > 0, nil
+}
+
+func (s *state) Records(_ context.Context, id, n int64) ([]*sumdb.Record, error) {
+	id = max(id, 0)
+	end := min(id+n, int64(len(s.records)))
+
+	var records []*sumdb.Record
+	for ; id < end; id++ {
+		records = append(records, cloneRecord(s.records[id]))
+	}
+	return records, nil
+}
+
+func (s *state) AddRecord(_ context.Context, r *sumdb.Record) (int64, error) {
+	if _, ok := s.ids[r.Path+"@"+r.Version]; ok {
+		return 0, fmt.Errorf("record already exists: %s@%s", r.Path, r.Version)
+	}
+	return s.add(r), nil
+}
+
+func (s *state) ReadHashes(_ context.Context, indexes []int64) ([]tlog.Hash, error) {
+	hashes := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		h, ok := s.hashes[idx]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", sumdb.ErrMissingHash, idx)
+		}
+		hashes[i] = h
+	}
+	return hashes, nil
+}
+
+func (s *state) WriteHashes(_ context.Context, indexes []int64, hashes []tlog.Hash) error {
+	for i, idx := range indexes {
+		s.hashes[idx] = hashes[i]
+	}
+	return nil
+}
+
+func (s *state) TreeSize(context.Context) (int64, error) {
+	return s.size, nil
+}
+
+func (s *state) SetTreeSize(_ context.Context, size int64) error {
+	s.size = size
+	return nil
+}
+
+func (s *state) AddCheckpoint(_ context.Context, c *sumdb.Checkpoint) error {
+	s.checkpoints = append(s.checkpoints, *c)
+	return nil
+}
+
+func (s *state) CheckpointAt(_ context.Context, t time.Time) (*sumdb.Checkpoint, error) {
+	i, _ := slices.BinarySearchFunc(s.checkpoints, t, func(c sumdb.Checkpoint, t time.Time) int {
+		if c.Time.After(t) {
+			return 1
+		}
+		return -1
+	})
+	if i == 0 {
+		return nil, sumdb.ErrNotFound
+	}
+
+	c := s.checkpoints[i-1]
+	return &c, nil
+}
+
+func (s *state) Checkpoint(_ context.Context, size int64) (*sumdb.Checkpoint, error) {
+	i, ok := slices.BinarySearchFunc(s.checkpoints, size, func(c sumdb.Checkpoint, size int64) int {
+		return cmp.Compare(c.Size, size)
+	})
+	if !ok {
+		return nil, sumdb.ErrNotFound
+	}
+
+	c := s.checkpoints[i]
+	return &c, nil
+}
+
+// cloneRecord returns a copy of r, so that callers can't modify the store's records.
+func cloneRecord(r *sumdb.Record) *sumdb.Record {
+	c := *r
+	c.Data = append([]byte(nil), r.Data...)
+	return &c
+}
@@ -0,0 +1,221 @@
+package memstore_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+	. "github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/pseudomuto/sumdb/store/storetest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(testing.TB) sumdb.Store { return New() })
+}
+
+func TestStore_ConcurrentWrites(t *testing.T) {
+	store := New()
+
+	var wg sync.WaitGroup
+	for i := range int64(20) {
+		wg.Go(func() { require.NoError(t, addRecord(t, store, i)) })
+	}
+	wg.Wait()
+
+	size, err := store.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(20), size)
+}
+
+func TestStore_WithTx(t *testing.T) {
+	store := New()
+	require.NoError(t, addRecord(t, store, 0))
+	before := store.Snapshot()
+
+	t.Run("rollback", func(t *testing.T) {
+		err := store.WithTx(t.Context(), func(tx sumdb.Store) error {
+			require.NoError(t, addRecord(t, tx, 1))
+			require.NoError(t, tx.WriteHashes(t.Context(), []int64{0}, []tlog.Hash{{1}}))
+			require.NoError(t, tx.(sumdb.CheckpointStore).AddCheckpoint(t.Context(), &sumdb.Checkpoint{Size: 2}))
+			return errors.New("rollback")
+		})
+		require.EqualError(t, err, "rollback")
+		require.Equal(t, before, store.Snapshot())
+
+		ok, err := store.HasPath(t.Context(), "example.com/mod1")
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		require.Panics(t, func() {
+			_ = store.WithTx(t.Context(), func(tx sumdb.Store) error {
+				require.NoError(t, addRecord(t, tx, 1))
+				panic("boom")
+			})
+		})
+		require.Equal(t, before, store.Snapshot())
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		require.NoError(t, store.WithTx(t.Context(), func(tx sumdb.Store) error { return addRecord(t, tx, 1) }))
+
+		id, err := store.RecordID(t.Context(), "example.com/mod1", "v1.0.0")
+		require.NoError(t, err)
+		require.Equal(t, int64(1), id)
+	})
+}
+
+func TestStore_Checkpoints(t *testing.T) {
+	store := New()
+	at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	_, err := store.CheckpointAt(t.Context(), at)
+	require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+	checkpoints := []sumdb.Checkpoint{
+		{Size: 1, Root: tlog.Hash{1}, Time: at},
+		{Size: 2, Root: tlog.Hash{2}, Time: at.Add(time.Hour)},
+		{Size: 3, Root: tlog.Hash{3}, Time: at.Add(time.Hour)},
+		{Size: 5, Root: tlog.Hash{5}, Time: at.Add(2 * time.Hour)},
+	}
+	for _, c := range checkpoints {
+		require.NoError(t, store.AddCheckpoint(t.Context(), &c))
+	}
+
+	tests := []struct {
+		at   time.Time
+		want *sumdb.Checkpoint
+	}{
+		{at.Add(-time.Second), nil},
+		{at, &checkpoints[0]},
+		{at.Add(time.Minute), &checkpoints[0]},
+		{at.Add(time.Hour), &checkpoints[2]},
+		{at.Add(24 * time.Hour), &checkpoints[3]},
+	}
+	for _, tt := range tests {
+		c, err := store.CheckpointAt(t.Context(), tt.at)
+		if tt.want == nil {
+			require.ErrorIs(t, err, sumdb.ErrNotFound)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, tt.want, c)
+	}
+
+	c, err := store.Checkpoint(t.Context(), 3)
+	require.NoError(t, err)
+	require.Equal(t, &checkpoints[2], c)
+
+	_, err = store.Checkpoint(t.Context(), 4)
+	require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+	// Checkpoints are kept in snapshots.
+	restored := New()
+	restored.Restore(store.Snapshot())
+	c, err = restored.CheckpointAt(t.Context(), at)
+	require.NoError(t, err)
+	require.Equal(t, &checkpoints[0], c)
+}
+
+func TestStore_Snapshot(t *testing.T) {
+	store := New()
+	require.NoError(t, addRecord(t, store, 0))
+	snap := store.Snapshot()
+
+	// Snapshots are copies.
+	snap.Records[0].Data[0] = 'X'
+	recs, err := store.Records(t.Context(), 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, byte('e'), recs[0].Data[0])
+
+	snap = store.Snapshot()
+	require.NoError(t, addRecord(t, store, 1))
+	store.Restore(snap)
+
+	size, err := store.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), size)
+
+	_, err = store.RecordID(t.Context(), "example.com/mod1", "v1.0.0")
+	require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+	// Records added after a restore follow the restored ones.
+	require.NoError(t, addRecord(t, store, 1))
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sumdb.gob")
+
+	// Missing files are created when the store is closed.
+	store, err := Open(path)
+	require.NoError(t, err)
+	require.NoError(t, addRecord(t, store, 0))
+
+	published := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	_, err = store.AddRecord(t.Context(), &sumdb.Record{
+		Path:      "example.com/published",
+		Version:   "v1.0.0",
+		Data:      []byte("data\n"),
+		Published: published,
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	reopened, err := Open(path)
+	require.NoError(t, err)
+	require.Equal(t, store.Snapshot(), reopened.Snapshot())
+
+	recs, err := reopened.Records(t.Context(), 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, published, recs[0].Published)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "temporary files are cleaned up")
+
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o600))
+	_, err = Open(path)
+	require.Error(t, err)
+}
+
+// BenchmarkStore runs the standardized store benchmarks, for comparison with other backends.
+func BenchmarkStore(b *testing.B) {
+	storetest.Benchmark(b, func(testing.TB) sumdb.Store { return New() })
+}
+
+// addRecord appends a record for example.com/mod<n>, its hash and the new tree size in a single transaction.
+func addRecord(tb testing.TB, store sumdb.Store, n int64) error {
+	tb.Helper()
+
+	add := func(tx sumdb.Store) error {
+		path := fmt.Sprintf("example.com/mod%d", n)
+		data := fmt.Appendf(nil, "%s v1.0.0 h1:data\n%s v1.0.0/go.mod h1:mod\n", path, path)
+		id, err := tx.AddRecord(tb.Context(), &sumdb.Record{Path: path, Version: "v1.0.0", Data: data})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.WriteHashes(tb.Context(), []int64{id}, []tlog.Hash{tlog.RecordHash(data)}); err != nil {
+			return err
+		}
+
+		size, err := tx.TreeSize(tb.Context())
+		if err != nil {
+			return err
+		}
+		return tx.SetTreeSize(tb.Context(), size+1)
+	}
+
+	if txStore, ok := store.(sumdb.TxStore); ok {
+		return txStore.WithTx(tb.Context(), add)
+	}
+	return add(store)
+}
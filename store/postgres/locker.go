@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultLockerID is the advisory lock a Locker takes unless another ID is given. It spells "sumdbl", and differs from
+// DefaultLockID so that a Locker held while appending doesn't wait for the store's own transactions.
+const DefaultLockerID int64 = 0x73756d64626c
+
+// Locker is a sumdb.Locker backed by a session-level PostgreSQL advisory lock, for SumDB instances sharing a store
+// that doesn't serialize appends across servers itself (or to check for duplicate records under the lock, see
+// sumdb.WithLocker). It's safe for concurrent use.
+//
+// The lock is held by a connection of the pool until it's released, so it's released by the database if the server
+// holding it crashes.
+type Locker struct {
+	pool *pgxpool.Pool
+	id   int64
+}
+
+// NewLocker returns a Locker taking the advisory lock id (e.g. DefaultLockerID) with a connection from pool. Every
+// server appending to the same log must use the same ID, and it must differ from the lock ID of a Store sharing the
+// database (see WithLockID).
+func NewLocker(pool *pgxpool.Pool, id int64) *Locker {
+	return &Locker{pool: pool, id: id}
+}
+
+// Locker returns a Locker taking the advisory lock id with a connection from the store's pool. See NewLocker.
+func (s *Store) Locker(id int64) *Locker {
+	return NewLocker(s.pool, id)
+}
+
+// Lock implements sumdb.Locker. It waits for the lock until ctx is done, holding a connection of the pool until the
+// returned function is called.
+func (l *Locker) Lock(ctx context.Context) (func() error, error) {
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", l.id); err != nil {
+		// The lock may have been taken as the wait was canceled, so the session is closed rather than reused.
+		_ = conn.Conn().Close(context.Background())
+		conn.Release()
+		return nil, fmt.Errorf("failed to take advisory lock: %d, %w", l.id, err)
+	}
+
+	var once sync.Once
+	return func() error {
+		once.Do(func() {
+			// The lock is released even if the caller's context is done. If releasing it fails, closing the session
+			// releases it.
+			if _, err = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", l.id); err != nil {
+				_ = conn.Conn().Close(context.Background())
+				err = fmt.Errorf("failed to release advisory lock: %d, %w", l.id, err)
+			}
+			conn.Release()
+		})
+		return err
+	}, nil
+}
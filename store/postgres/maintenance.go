@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+)
+
+var _ sumdb.MaintenanceStore = (*Store)(nil)
+
+// MaintenanceJobs implements sumdb.MaintenanceStore:
+//
+//	postgres-analyze  daily, refreshes the query planner's statistics (ANALYZE)
+//	postgres-reindex  weekly, rebuilds the tables' indexes without blocking writes (REINDEX CONCURRENTLY)
+//
+// Vacuuming is left to autovacuum. REINDEX CONCURRENTLY requires PostgreSQL 12 or later.
+func (s *Store) MaintenanceJobs() []sumdb.MaintenanceJob {
+	return []sumdb.MaintenanceJob{
+		{Name: "postgres-analyze", Interval: 24 * time.Hour, Run: s.maintain("ANALYZE records, hashes")},
+		{
+			Name:     "postgres-reindex",
+			Interval: 7 * 24 * time.Hour,
+			Run:      s.maintain("REINDEX TABLE CONCURRENTLY records", "REINDEX TABLE CONCURRENTLY hashes"),
+		},
+	}
+}
+
+// maintain returns a job running statements in order. They run outside of a transaction, since REINDEX CONCURRENTLY
+// can't run in one.
+func (s *Store) maintain(statements ...string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		for _, stmt := range statements {
+			if _, err := s.pool.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("failed to run maintenance: %s, %w", stmt, err)
+			}
+		}
+		return nil
+	}
+}
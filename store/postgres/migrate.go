@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrSchemaTooNew is returned by Open and New when the database was migrated by a newer version of this package, whose
+// schema this version doesn't know how to use.
+var ErrSchemaTooNew = errors.New("database schema is newer than supported")
+
+// migrations are the schema changes applied by Open and New, in order. The schema's version (stored in the
+// schema_version table) is the number of migrations applied, so migrations must never be changed or removed once
+// released, only appended.
+//
+// Records are keyed on their escaped paths and versions (see sumdb.EscapeModule), so lookups don't depend on the
+// database's collation. The UNIQUE constraint's index covers RecordID lookups, and its leading column covers HasPath.
+var migrations = []string{
+	`
+	CREATE TABLE records (
+		id BIGINT PRIMARY KEY,
+		path TEXT NOT NULL,
+		version TEXT NOT NULL,
+		escaped_path TEXT NOT NULL,
+		escaped_version TEXT NOT NULL,
+		data BYTEA NOT NULL,
+		published TIMESTAMPTZ,
+		UNIQUE (escaped_path, escaped_version)
+	);
+	CREATE INDEX records_published ON records (published) WHERE published IS NOT NULL;
+
+	CREATE TABLE hashes (
+		idx BIGINT PRIMARY KEY,
+		hash BYTEA NOT NULL
+	);
+
+	CREATE TABLE tree (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		size BIGINT NOT NULL
+	);
+	INSERT INTO tree (id, size) VALUES (1, 0);
+	`,
+	`
+	CREATE TABLE checkpoints (
+		size BIGINT PRIMARY KEY,
+		root BYTEA NOT NULL,
+		time TIMESTAMPTZ NOT NULL
+	);
+	CREATE INDEX checkpoints_time ON checkpoints (time, size);
+	`,
+	// Only full tiles are saved, so their width is implied by their height.
+	`
+	CREATE TABLE tiles (
+		height INTEGER NOT NULL,
+		level INTEGER NOT NULL,
+		n BIGINT NOT NULL,
+		data BYTEA NOT NULL,
+		PRIMARY KEY (height, level, n)
+	);
+	`,
+	// The format version of the data (see sumdb.FormatVersion), 0 until the store is first used.
+	`ALTER TABLE tree ADD COLUMN format INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// SchemaVersion returns the version of the schema this package migrates databases to.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// migrate applies the migrations the database hasn't seen yet in a single transaction, holding the store's advisory
+// lock so that servers starting at the same time don't apply them twice.
+func (c *conn) migrate(ctx context.Context) error {
+	return pgx.BeginFunc(ctx, c.pool, func(tx pgx.Tx) error {
+		if err := lock(ctx, tx, c.lockID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			version INTEGER NOT NULL
+		)`)
+		if err != nil {
+			return fmt.Errorf("failed to create schema version table: %w", err)
+		}
+
+		var version int
+		err = tx.QueryRow(ctx, "SELECT version FROM schema_version WHERE id = 1").Scan(&version)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to read schema version: %w", err)
+		}
+
+		switch {
+		case version > len(migrations):
+			return fmt.Errorf("%w: version %d, want at most %d", ErrSchemaTooNew, version, len(migrations))
+		case version == len(migrations):
+			return nil
+		}
+
+		for i := version; i < len(migrations); i++ {
+			if _, err := tx.Exec(ctx, migrations[i]); err != nil {
+				return fmt.Errorf("failed to apply migration: %d, %w", i+1, err)
+			}
+		}
+
+		_, err = tx.Exec(ctx, `INSERT INTO schema_version (id, version) VALUES (1, $1)
+			ON CONFLICT (id) DO UPDATE SET version = EXCLUDED.version`, len(migrations))
+		if err != nil {
+			return fmt.Errorf("failed to set schema version: %d, %w", len(migrations), err)
+		}
+		return nil
+	})
+}
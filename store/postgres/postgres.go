@@ -0,0 +1,146 @@
+// Package postgres provides a sumdb.Store backed by PostgreSQL, using pgx.
+//
+// The schema is created and migrated by Open (or New), and the store implements sumdb.TxStore, sumdb.PathStore,
+// sumdb.PublishedStore, sumdb.CheckpointStore, sumdb.TileStore and sumdb.MaintenanceStore. Several servers can share a
+// database: every write transaction takes an advisory lock, so record appends are serialized across replicas rather
+// than racing for the next record ID.
+//
+//	store, err := postgres.Open(ctx, "postgres://sumdb@db.example.com/sumdb")
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//
+//	db, err := sumdb.New("sum.example.com", skey, sumdb.WithStore(store))
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pseudomuto/sumdb"
+)
+
+// DefaultLockID is the advisory lock taken by write transactions unless set with WithLockID. It spells "sumdb".
+const DefaultLockID int64 = 0x73756d6462
+
+type (
+	// Store is a sumdb.Store backed by a PostgreSQL database. It's safe for concurrent use.
+	//
+	// pgx prepares and caches the statements of each connection, so queries aren't prepared by the Store itself.
+	Store struct {
+		*conn
+		tx pgx.Tx // the transaction queries run in, or nil outside of WithTx
+	}
+
+	// conn is the state shared by a Store and the Stores passed to its transactions.
+	conn struct {
+		pool     *pgxpool.Pool
+		ownsPool bool
+		lockID   int64
+	}
+
+	// Option customizes a Store.
+	Option func(*options)
+
+	options struct {
+		lockID int64
+	}
+
+	// querier is implemented by both pgxpool.Pool and pgx.Tx.
+	querier interface {
+		Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+		Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+		QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	}
+)
+
+// WithLockID sets the advisory lock taken by write transactions. Advisory locks are shared by the whole database, so
+// logs stored in separate schemas of the same database should use different IDs to avoid waiting for each other.
+// Every server writing to the same log must use the same ID.
+func WithLockID(id int64) Option {
+	return func(o *options) { o.lockID = id }
+}
+
+// Open connects to the database at dsn (a PostgreSQL connection URL or keyword/value string), migrates its schema and
+// returns a Store for it. The connection pool is closed with the Store.
+func Open(ctx context.Context, dsn string, opts ...Option) (*Store, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	s, err := newStore(ctx, pool, true, opts)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// New migrates the schema of the database pool connects to and returns a Store for it. pool isn't closed with the
+// Store.
+func New(ctx context.Context, pool *pgxpool.Pool, opts ...Option) (*Store, error) {
+	return newStore(ctx, pool, false, opts)
+}
+
+func newStore(ctx context.Context, pool *pgxpool.Pool, ownsPool bool, opts []Option) (*Store, error) {
+	o := options{lockID: DefaultLockID}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &conn{pool: pool, ownsPool: ownsPool, lockID: o.lockID}
+	if err := c.migrate(ctx); err != nil {
+		return nil, err
+	}
+	return &Store{conn: c}, nil
+}
+
+// Close closes the connection pool if the Store was created by Open. The Store must not be used afterwards.
+func (s *Store) Close() error {
+	if s.ownsPool {
+		s.pool.Close()
+	}
+	return nil
+}
+
+// WithTx implements sumdb.TxStore. The transaction holds the store's advisory lock until it ends, so transactions
+// appending records are serialized, even across servers. Calls within a transaction run inline.
+func (s *Store) WithTx(ctx context.Context, fn func(sumdb.Store) error) error {
+	return s.write(ctx, func(tx *Store) error { return fn(tx) })
+}
+
+// write runs fn in its own locked transaction, or in the current one when called within WithTx. Transactions are
+// rolled back if fn returns an error or panics.
+func (s *Store) write(ctx context.Context, fn func(*Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if err := lock(ctx, tx, s.lockID); err != nil {
+			return err
+		}
+		return fn(&Store{conn: s.conn, tx: tx})
+	})
+}
+
+// lock takes the advisory lock id, which is released when tx ends.
+func lock(ctx context.Context, tx pgx.Tx, id int64) error {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", id); err != nil {
+		return fmt.Errorf("failed to take advisory lock: %d, %w", id, err)
+	}
+	return nil
+}
+
+// db returns the transaction queries run in, or the pool outside of one.
+func (s *Store) db() querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.pool
+}
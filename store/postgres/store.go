@@ -0,0 +1,307 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pseudomuto/sumdb"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+var (
+	_ sumdb.TxStore         = (*Store)(nil)
+	_ sumdb.PathStore       = (*Store)(nil)
+	_ sumdb.PublishedStore  = (*Store)(nil)
+	_ sumdb.CheckpointStore = (*Store)(nil)
+	_ sumdb.TileStore       = (*Store)(nil)
+	_ sumdb.FormatStore     = (*Store)(nil)
+)
+
+// recordColumns are the columns scanned by scanRecords.
+const recordColumns = "id, path, version, data, published"
+
+// RecordID returns the ID of the record for the given module path and version.
+func (s *Store) RecordID(ctx context.Context, path, version string) (int64, error) {
+	escPath, escVersion, err := sumdb.EscapeModule(path, version)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = s.db().QueryRow(ctx, "SELECT id FROM records WHERE escaped_path = $1 AND escaped_version = $2",
+		escPath, escVersion).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, sumdb.ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query record: %s@%s, %w", path, version, err)
+	}
+
+	return id, nil
+}
+
+// HasPath implements sumdb.PathStore.
+func (s *Store) HasPath(ctx context.Context, path string) (bool, error) {
+	escPath, err := module.EscapePath(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to escape path: %s, %w", path, err)
+	}
+
+	var exists bool
+	err = s.db().QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM records WHERE escaped_path = $1)", escPath).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to query path: %s, %w", path, err)
+	}
+
+	return exists, nil
+}
+
+// Records returns records with IDs in the interval [id, id+n).
+func (s *Store) Records(ctx context.Context, id, n int64) ([]*sumdb.Record, error) {
+	rows, err := s.db().Query(ctx, "SELECT "+recordColumns+" FROM records WHERE id >= $1 AND id < $2 ORDER BY id",
+		id, id+n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query records: %w", err)
+	}
+	return scanRecords(rows)
+}
+
+// PublishedRecords implements sumdb.PublishedStore. The records_published index covers the query.
+func (s *Store) PublishedRecords(ctx context.Context, since, until time.Time, n int64) ([]*sumdb.Record, error) {
+	rows, err := s.db().Query(ctx, "SELECT "+recordColumns+
+		" FROM records WHERE published >= $1 AND published < $2 ORDER BY published, id LIMIT $3",
+		since, until, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query published records: %w", err)
+	}
+	return scanRecords(rows)
+}
+
+// scanRecords scans and closes rows of recordColumns.
+func scanRecords(rows pgx.Rows) ([]*sumdb.Record, error) {
+	defer rows.Close()
+
+	var records []*sumdb.Record
+	for rows.Next() {
+		r := &sumdb.Record{}
+		var published *time.Time
+		if err := rows.Scan(&r.ID, &r.Path, &r.Version, &r.Data, &published); err != nil {
+			return nil, fmt.Errorf("failed to scan record: %w", err)
+		}
+		if published != nil {
+			r.Published = published.UTC()
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// AddRecord adds a new entry for the specified module. Outside of WithTx, it runs in its own locked transaction.
+func (s *Store) AddRecord(ctx context.Context, r *sumdb.Record) (int64, error) {
+	escPath, escVersion, err := sumdb.EscapeModule(r.Path, r.Version)
+	if err != nil {
+		return 0, err
+	}
+
+	var published *time.Time
+	if !r.Published.IsZero() {
+		published = &r.Published
+	}
+
+	var id int64
+	err = s.write(ctx, func(s *Store) error {
+		// Record IDs are their positions in the tree. The advisory lock keeps concurrent appends from computing the
+		// same one.
+		err := s.db().QueryRow(ctx, `
+			INSERT INTO records (id, path, version, escaped_path, escaped_version, data, published)
+			VALUES ((SELECT COALESCE(MAX(id) + 1, 0) FROM records), $1, $2, $3, $4, $5, $6)
+			RETURNING id`,
+			r.Path, r.Version, escPath, escVersion, r.Data, published,
+		).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to insert record: %s@%s, %w", r.Path, r.Version, err)
+		}
+		return nil
+	})
+
+	return id, err
+}
+
+// ReadHashes returns the hashes at the given storage indexes, in a single query.
+func (s *Store) ReadHashes(ctx context.Context, indexes []int64) ([]tlog.Hash, error) {
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+
+	// Indexes may be repeated.
+	positions := make(map[int64][]int, len(indexes))
+	for i, idx := range indexes {
+		positions[idx] = append(positions[idx], i)
+	}
+
+	rows, err := s.db().Query(ctx, "SELECT idx, hash FROM hashes WHERE idx = ANY($1)",
+		slices.Collect(maps.Keys(positions)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hashes: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]tlog.Hash, len(indexes))
+	for rows.Next() {
+		var idx int64
+		var hash []byte
+		if err := rows.Scan(&idx, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan hash: %w", err)
+		}
+		if len(hash) != tlog.HashSize {
+			return nil, fmt.Errorf("invalid hash at %d: %d bytes", idx, len(hash))
+		}
+		for _, i := range positions[idx] {
+			copy(result[i][:], hash)
+		}
+		delete(positions, idx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query hashes: %w", err)
+	}
+
+	// Any indexes left weren't found.
+	if len(positions) > 0 {
+		return nil, fmt.Errorf("%w: %v", sumdb.ErrMissingHash, slices.Sorted(maps.Keys(positions)))
+	}
+
+	return result, nil
+}
+
+// WriteHashes stores hashes at the given storage indexes, in a single statement.
+func (s *Store) WriteHashes(ctx context.Context, indexes []int64, hashes []tlog.Hash) error {
+	data := make([][]byte, len(hashes))
+	for i := range hashes {
+		data[i] = hashes[i][:]
+	}
+
+	return s.write(ctx, func(s *Store) error {
+		_, err := s.db().Exec(ctx, `
+			INSERT INTO hashes (idx, hash) SELECT * FROM unnest($1::BIGINT[], $2::BYTEA[])
+			ON CONFLICT (idx) DO UPDATE SET hash = EXCLUDED.hash`,
+			indexes, data,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert hashes: %w", err)
+		}
+		return nil
+	})
+}
+
+// TreeSize returns the current number of records in the tree.
+func (s *Store) TreeSize(ctx context.Context) (int64, error) {
+	var size int64
+	if err := s.db().QueryRow(ctx, "SELECT size FROM tree WHERE id = 1").Scan(&size); err != nil {
+		return 0, fmt.Errorf("failed to query tree size: %w", err)
+	}
+	return size, nil
+}
+
+// SetTreeSize updates the tree size.
+func (s *Store) SetTreeSize(ctx context.Context, size int64) error {
+	return s.write(ctx, func(s *Store) error {
+		if _, err := s.db().Exec(ctx, "UPDATE tree SET size = $1 WHERE id = 1", size); err != nil {
+			return fmt.Errorf("failed to update tree size: %d, %w", size, err)
+		}
+		return nil
+	})
+}
+
+// FormatVersion implements sumdb.FormatStore.
+func (s *Store) FormatVersion(ctx context.Context) (int, error) {
+	var version int
+	if err := s.db().QueryRow(ctx, "SELECT format FROM tree WHERE id = 1").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to query format version: %w", err)
+	}
+	return version, nil
+}
+
+// SetFormatVersion implements sumdb.FormatStore.
+func (s *Store) SetFormatVersion(ctx context.Context, version int) error {
+	return s.write(ctx, func(s *Store) error {
+		if _, err := s.db().Exec(ctx, "UPDATE tree SET format = $1 WHERE id = 1", version); err != nil {
+			return fmt.Errorf("failed to update format version: %d, %w", version, err)
+		}
+		return nil
+	})
+}
+
+// AddCheckpoint implements sumdb.CheckpointStore.
+func (s *Store) AddCheckpoint(ctx context.Context, c *sumdb.Checkpoint) error {
+	return s.write(ctx, func(s *Store) error {
+		if _, err := s.db().Exec(ctx, "INSERT INTO checkpoints (size, root, time) VALUES ($1, $2, $3)",
+			c.Size, c.Root[:], c.Time); err != nil {
+			return fmt.Errorf("failed to insert checkpoint: %d, %w", c.Size, err)
+		}
+		return nil
+	})
+}
+
+// CheckpointAt implements sumdb.CheckpointStore. The checkpoints_time index covers the query.
+func (s *Store) CheckpointAt(ctx context.Context, t time.Time) (*sumdb.Checkpoint, error) {
+	return s.checkpoint(ctx,
+		"SELECT size, root, time FROM checkpoints WHERE time <= $1 ORDER BY time DESC, size DESC LIMIT 1", t)
+}
+
+// Checkpoint implements sumdb.CheckpointStore.
+func (s *Store) Checkpoint(ctx context.Context, size int64) (*sumdb.Checkpoint, error) {
+	return s.checkpoint(ctx, "SELECT size, root, time FROM checkpoints WHERE size = $1", size)
+}
+
+// checkpoint returns the checkpoint selected by query, which must select its size, root and time.
+func (s *Store) checkpoint(ctx context.Context, query string, args ...any) (*sumdb.Checkpoint, error) {
+	var (
+		c    sumdb.Checkpoint
+		root []byte
+	)
+	err := s.db().QueryRow(ctx, query, args...).Scan(&c.Size, &root, &c.Time)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, sumdb.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checkpoint: %w", err)
+	}
+	if len(root) != tlog.HashSize {
+		return nil, fmt.Errorf("invalid checkpoint root at %d: %d bytes", c.Size, len(root))
+	}
+
+	copy(c.Root[:], root)
+	c.Time = c.Time.UTC()
+	return &c, nil
+}
+
+// ReadSavedTile implements sumdb.TileStore.
+func (s *Store) ReadSavedTile(ctx context.Context, t tlog.Tile) ([]byte, error) {
+	var data []byte
+	err := s.db().QueryRow(ctx, "SELECT data FROM tiles WHERE height = $1 AND level = $2 AND n = $3",
+		t.H, t.L, t.N).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, sumdb.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tile: %s, %w", t.Path(), err)
+	}
+	return data, nil
+}
+
+// WriteSavedTile implements sumdb.TileStore. Tiles that are already saved are left as they are, so saving a tile
+// doesn't need to take the advisory lock serializing appends.
+func (s *Store) WriteSavedTile(ctx context.Context, t tlog.Tile, data []byte) error {
+	if _, err := s.db().Exec(ctx,
+		"INSERT INTO tiles (height, level, n, data) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+		t.H, t.L, t.N, data); err != nil {
+		return fmt.Errorf("failed to insert tile: %s, %w", t.Path(), err)
+	}
+	return nil
+}
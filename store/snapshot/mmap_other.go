@@ -0,0 +1,18 @@
+//go:build !unix
+
+package snapshot
+
+import (
+	"fmt"
+	"os"
+)
+
+// mapFile reads the file at path into memory on platforms without mmap support.
+func mapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is provided by the caller
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapFile memory-maps the file at path read-only, returning the mapping and a function to release it.
+func mapFile(path string) ([]byte, func() error, error) {
+	f, err := os.Open(path) // #nosec G304 -- path is provided by the caller
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat snapshot: %w", err)
+	}
+
+	if fi.Size() < headerSize {
+		return nil, nil, ErrInvalidSnapshot
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED) // #nosec G115
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to map snapshot: %w", err)
+	}
+
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,190 @@
+package snapshot
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/pseudomuto/sumdb"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// Store is a read-only sumdb.Store backed by a memory-mapped snapshot file.
+//
+// Record data returned by Records references the mapped file directly and must not be modified or used after Close.
+type Store struct {
+	data    []byte
+	unmap   func() error
+	size    int64
+	hashes  []byte
+	offsets []byte
+	index   []byte
+	records []byte
+}
+
+var _ sumdb.Store = (*Store)(nil)
+
+// Open memory-maps the snapshot at path. The returned Store must be closed to release the mapping.
+func Open(path string) (*Store, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newStore(data)
+	if err != nil {
+		_ = unmap()
+		return nil, fmt.Errorf("failed to open snapshot: %s, %w", path, err)
+	}
+
+	s.unmap = unmap
+	return s, nil
+}
+
+func newStore(data []byte) (*Store, error) {
+	h, err := decodeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	n := int64(len(data))
+	valid := h.size >= 0 &&
+		h.hashes == headerSize &&
+		h.offsets == h.hashes+tlog.StoredHashCount(h.size)*tlog.HashSize &&
+		h.index == h.offsets+(h.size+1)*8 &&
+		h.records == h.index+h.size*8 &&
+		h.records <= n
+	if !valid {
+		return nil, ErrInvalidSnapshot
+	}
+
+	s := &Store{
+		data:    data,
+		size:    h.size,
+		hashes:  data[h.hashes:h.offsets],
+		offsets: data[h.offsets:h.index],
+		index:   data[h.index:h.records],
+		records: data[h.records:],
+	}
+
+	if s.offset(h.size) != int64(len(s.records)) {
+		return nil, ErrInvalidSnapshot
+	}
+
+	return s, nil
+}
+
+// Close releases the memory mapping. The Store must not be used after calling Close.
+func (s *Store) Close() error {
+	if s.unmap == nil {
+		return nil
+	}
+
+	err := s.unmap()
+	s.unmap = nil
+	return err
+}
+
+// RecordID returns the ID of the record for the given module path and version.
+func (s *Store) RecordID(_ context.Context, path, version string) (int64, error) {
+	wantPath, wantVersion := []byte(path), []byte(version)
+	compare := func(id int64) int {
+		p, v, _, err := decodeRecord(s.record(id))
+		if err != nil {
+			return 1
+		}
+		return cmp.Or(bytes.Compare(p, wantPath), bytes.Compare(v, wantVersion))
+	}
+
+	i := sort.Search(int(s.size), func(i int) bool { return compare(s.indexID(i)) >= 0 })
+	if i < int(s.size) && compare(s.indexID(i)) == 0 {
+		return s.indexID(i), nil
+	}
+
+	return 0, sumdb.ErrNotFound
+}
+
+// Records returns records with IDs in the interval [id, id+n).
+func (s *Store) Records(_ context.Context, id, n int64) ([]*sumdb.Record, error) {
+	if id < 0 || n <= 0 || id >= s.size {
+		return nil, nil
+	}
+
+	end := min(id+n, s.size)
+	recs := make([]*sumdb.Record, 0, end-id)
+	for i := id; i < end; i++ {
+		path, version, data, err := decodeRecord(s.record(i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode record %d: %w", i, err)
+		}
+
+		recs = append(recs, &sumdb.Record{
+			ID:      i,
+			Path:    string(path),
+			Version: string(version),
+			Data:    data,
+		})
+	}
+
+	return recs, nil
+}
+
+// ReadHashes returns the hashes at the given storage indexes.
+func (s *Store) ReadHashes(_ context.Context, indexes []int64) ([]tlog.Hash, error) {
+	count := int64(len(s.hashes) / tlog.HashSize)
+	hashes := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		if idx < 0 || idx >= count {
+			return nil, fmt.Errorf("%w: index %d out of range", sumdb.ErrMissingHash, idx)
+		}
+		copy(hashes[i][:], s.hashes[idx*tlog.HashSize:])
+	}
+
+	return hashes, nil
+}
+
+// TreeSize returns the number of records in the snapshot.
+func (s *Store) TreeSize(context.Context) (int64, error) {
+	return s.size, nil
+}
+
+// AddRecord always returns ErrReadOnly.
+func (s *Store) AddRecord(context.Context, *sumdb.Record) (int64, error) {
+	return 0, ErrReadOnly
+}
+
+// WriteHashes always returns ErrReadOnly.
+func (s *Store) WriteHashes(context.Context, []int64, []tlog.Hash) error {
+	return ErrReadOnly
+}
+
+// SetTreeSize always returns ErrReadOnly.
+func (s *Store) SetTreeSize(context.Context, int64) error {
+	return ErrReadOnly
+}
+
+// offset returns the offset of record id within the records section.
+func (s *Store) offset(id int64) int64 {
+	return int64(binary.LittleEndian.Uint64(s.offsets[id*8:])) // #nosec G115 -- validated on open
+}
+
+// indexID returns the record ID at position i of the sorted index.
+func (s *Store) indexID(i int) int64 {
+	return int64(binary.LittleEndian.Uint64(s.index[i*8:])) // #nosec G115 -- validated on open
+}
+
+// record returns the encoded record with the given ID.
+func (s *Store) record(id int64) []byte {
+	if id < 0 || id >= s.size {
+		return nil
+	}
+
+	start, end := s.offset(id), s.offset(id+1)
+	if start > end || end > int64(len(s.records)) {
+		return nil
+	}
+	return s.records[start:end]
+}
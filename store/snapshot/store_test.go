@@ -0,0 +1,170 @@
+package snapshot_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	. "github.com/pseudomuto/sumdb/store/snapshot"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestSnapshot(t *testing.T) {
+	src := memstore.New()
+	for i := range 300 {
+		path := fmt.Sprintf("example.com/mod%03d", 299-i)
+		if i%2 == 0 {
+			path += "-x"
+		}
+		addRecord(t, src, path, "v1.0.0")
+	}
+	addRecord(t, src, "example.com/mod000", "v1.1.0")
+
+	path := filepath.Join(t.TempDir(), "sumdb.snap")
+	require.NoError(t, Write(t.Context(), path, src))
+
+	records, err := src.Records(t.Context(), 0, 1000)
+	require.NoError(t, err)
+
+	snap, err := Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, snap.Close()) })
+
+	t.Run("tree size", func(t *testing.T) {
+		size, err := snap.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(len(records)), size)
+	})
+
+	t.Run("record ids", func(t *testing.T) {
+		for _, r := range records {
+			id, err := snap.RecordID(t.Context(), r.Path, r.Version)
+			require.NoError(t, err)
+			require.Equal(t, r.ID, id)
+		}
+
+		_, err := snap.RecordID(t.Context(), "example.com/mod000", "v2.0.0")
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+		_, err = snap.RecordID(t.Context(), "example.com/zzz", "v1.0.0")
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+	})
+
+	t.Run("records", func(t *testing.T) {
+		recs, err := snap.Records(t.Context(), 250, 100)
+		require.NoError(t, err)
+		require.Equal(t, records[250:], recs)
+	})
+
+	t.Run("missing hashes", func(t *testing.T) {
+		_, err := snap.ReadHashes(t.Context(), []int64{0, 1 << 20})
+		require.ErrorIs(t, err, sumdb.ErrMissingHash)
+	})
+
+	t.Run("tree hash", func(t *testing.T) {
+		want, err := tree.TreeHash(t.Context(), src)
+		require.NoError(t, err)
+
+		got, err := tree.TreeHash(t.Context(), snap)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("tiles", func(t *testing.T) {
+		tile := tlog.TileForIndex(tree.TileHeight, tlog.StoredHashIndex(0, 260))
+		want, err := tree.ReadTile(t.Context(), src, tile)
+		require.NoError(t, err)
+
+		got, err := tree.ReadTile(t.Context(), snap, tile)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		_, err := snap.AddRecord(t.Context(), &sumdb.Record{})
+		require.ErrorIs(t, err, ErrReadOnly)
+		require.ErrorIs(t, snap.WriteHashes(t.Context(), nil, nil), ErrReadOnly)
+		require.ErrorIs(t, snap.SetTreeSize(t.Context(), 0), ErrReadOnly)
+	})
+}
+
+func TestSnapshot_Empty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sumdb.snap")
+	require.NoError(t, Write(t.Context(), path, memstore.New()))
+
+	snap, err := Open(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, snap.Close()) }()
+
+	size, err := snap.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Zero(t, size)
+}
+
+func TestWrite_Replace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sumdb.snap")
+
+	src := memstore.New()
+	addRecord(t, src, "example.com/a", "v1.0.0")
+	require.NoError(t, Write(t.Context(), path, src))
+
+	// A failed write leaves the existing snapshot in place, and no temporary files behind.
+	addRecord(t, src, "example.com/b", "v1.0.0")
+	err := Write(t.Context(), path, failingHashes{src})
+	require.ErrorContains(t, err, "failed to read hashes")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	snap, err := Open(path)
+	require.NoError(t, err)
+	size, err := snap.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), size)
+	require.NoError(t, snap.Close())
+
+	// A successful write replaces it.
+	require.NoError(t, Write(t.Context(), path, src))
+
+	snap, err = Open(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, snap.Close()) }()
+
+	size, err = snap.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(2), size)
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.snap")
+	require.NoError(t, os.WriteFile(path, []byte("SUMDBSNP but not really a snapshot file at all..........."), 0o600))
+
+	_, err := Open(path)
+	require.ErrorIs(t, err, ErrInvalidSnapshot)
+}
+
+func addRecord(t *testing.T, s *memstore.Store, path, version string) {
+	t.Helper()
+
+	data := fmt.Appendf(nil, "%s %s h1:abc=\n%s %s/go.mod h1:def=\n", path, version, path, version)
+	id, err := s.AddRecord(t.Context(), &sumdb.Record{Path: path, Version: version, Data: data})
+	require.NoError(t, err)
+	require.NoError(t, tree.AddRecord(t.Context(), s, id, data))
+	require.NoError(t, s.SetTreeSize(t.Context(), id+1))
+}
+
+// failingHashes is a Store failing to read hashes.
+type failingHashes struct{ sumdb.Store }
+
+func (failingHashes) ReadHashes(context.Context, []int64) ([]tlog.Hash, error) {
+	return nil, errors.New("disk failure")
+}
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// minLockPoll and maxLockPoll bound how often a writer waiting for the writer lock checks whether it's free.
+	minLockPoll = 5 * time.Millisecond
+	maxLockPoll = 200 * time.Millisecond
+)
+
+// ErrNoWriterLock is returned by Lease for stores opened without WithWriterLock.
+var ErrNoWriterLock = errors.New("store has no writer lock")
+
+// writerLock is a cooperative lock on a file next to the database (its path with a .lock suffix), held while writing
+// so that processes sharing the database take turns. It's only used by the writer goroutine.
+type writerLock struct {
+	f      *os.File
+	leases int // the number of leases holding the lock, which is otherwise only held for single writes
+}
+
+// openWriterLock opens (creating it if needed) the lock file for the database at path.
+func openWriterLock(path string) (*writerLock, error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o600) // #nosec G304 -- path is provided by the caller
+	if err != nil {
+		return nil, fmt.Errorf("failed to open writer lock: %s, %w", path, err)
+	}
+	return &writerLock{f: f}, nil
+}
+
+// run runs fn holding the lock, unless it's already held by a lease. A nil lock runs fn as is.
+func (l *writerLock) run(ctx context.Context, fn func() error) error {
+	if l == nil || l.leases > 0 {
+		return fn()
+	}
+
+	if err := l.acquire(ctx); err != nil {
+		return err
+	}
+	defer func() { _ = l.release() }()
+	return fn()
+}
+
+// acquire waits for the lock until ctx is done.
+func (l *writerLock) acquire(ctx context.Context) error {
+	for poll := minLockPoll; ; poll = min(2*poll, maxLockPoll) {
+		ok, err := tryLock(l.f)
+		if err != nil {
+			return fmt.Errorf("failed to take writer lock: %s, %w", l.f.Name(), err)
+		}
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed waiting for writer lock: %s, %w", l.f.Name(), ctx.Err())
+		case <-time.After(poll):
+		}
+	}
+}
+
+// release releases the lock.
+func (l *writerLock) release() error {
+	if err := unlock(l.f); err != nil {
+		return fmt.Errorf("failed to release writer lock: %s, %w", l.f.Name(), err)
+	}
+	return nil
+}
+
+// close closes the lock file, releasing the lock if it's held.
+func (l *writerLock) close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// Lease takes the writer lock (see WithWriterLock) until the returned function is called, so that work spanning several
+// transactions, such as sumdb.SumDB.ImportTiles or a batch of appends computed from the current tree size, isn't
+// interleaved with writes from other processes. Those wait for the lease to be released, and then take their turn.
+//
+// The lease is held by the Store rather than the caller: writes made through the Store by other goroutines of this
+// process still go through while it's held, and leases taken while it's held share it. Lease must not be called within
+// WithTx. It returns ErrNoWriterLock if the store has no writer lock.
+func (s *Store) Lease(ctx context.Context) (func() error, error) {
+	if s.lock == nil {
+		return nil, ErrNoWriterLock
+	}
+
+	err := s.control(ctx, func(ctx context.Context) error {
+		if s.lock.leases == 0 {
+			if err := s.lock.acquire(ctx); err != nil {
+				return err
+			}
+		}
+		s.lock.leases++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() error {
+		once.Do(func() {
+			// The lease is released even if the caller's context is done. Closing the store releases it too.
+			err = s.control(context.Background(), func(context.Context) error {
+				if s.lock.leases--; s.lock.leases > 0 {
+					return nil
+				}
+				return s.lock.release()
+			})
+			if errors.Is(err, ErrClosed) {
+				err = nil
+			}
+		})
+		return err
+	}, nil
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package sqlite
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLock fails on platforms without flock, so WithWriterLock isn't supported there.
+func tryLock(*os.File) (bool, error) {
+	return false, errors.ErrUnsupported
+}
+
+func unlock(*os.File) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,43 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+)
+
+var _ sumdb.MaintenanceStore = (*Store)(nil)
+
+// MaintenanceJobs implements sumdb.MaintenanceStore:
+//
+//	sqlite-optimize  daily, refreshes the query planner's statistics (PRAGMA optimize)
+//	sqlite-vacuum    weekly, rebuilds the database file (VACUUM) and truncates the WAL
+//
+// Both run on the writer goroutine, so writes wait for them rather than failing with SQLITE_BUSY.
+func (s *Store) MaintenanceJobs() []sumdb.MaintenanceJob {
+	return []sumdb.MaintenanceJob{
+		{Name: "sqlite-optimize", Interval: 24 * time.Hour, Run: s.maintain("PRAGMA optimize")},
+		{Name: "sqlite-vacuum", Interval: 7 * 24 * time.Hour, Run: s.maintain("VACUUM", "PRAGMA wal_checkpoint(TRUNCATE)")},
+	}
+}
+
+// maintain returns a job running statements outside of a transaction, in order, on the writer goroutine.
+func (s *Store) maintain(statements ...string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		for _, stmt := range statements {
+			req := writeReq{ctx: ctx, raw: func(ctx context.Context) error {
+				_, err := s.db.ExecContext(ctx, stmt)
+				return err
+			}, done: make(chan error, 1)}
+			if err := s.enqueue(ctx, req); err != nil {
+				return err
+			}
+			if err := <-req.done; err != nil {
+				return fmt.Errorf("failed to run maintenance: %s, %w", stmt, err)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrSchemaTooNew is returned by Open and New when the database was migrated by a newer version of this package, whose
+// schema this version doesn't know how to use.
+var ErrSchemaTooNew = errors.New("database schema is newer than supported")
+
+// migrations are the schema changes applied by Open and New, in order. The schema's version (PRAGMA user_version) is
+// the number of migrations applied, so migrations must never be changed or removed once released, only appended.
+//
+// Records are keyed on their escaped paths and versions (see sumdb.EscapeModule), which stay unique even if the schema
+// is ported to a database that compares text case-insensitively. The UNIQUE constraint's index covers RecordID and
+// HasPath lookups, since SQLite includes the rowid (id) in every index, and hashes are keyed by rowid, so no further
+// indexes are needed.
+var migrations = []string{
+	`
+	CREATE TABLE records (
+		id INTEGER PRIMARY KEY,
+		path TEXT NOT NULL,
+		version TEXT NOT NULL,
+		escaped_path TEXT NOT NULL,
+		escaped_version TEXT NOT NULL,
+		data BLOB NOT NULL,
+		UNIQUE(escaped_path, escaped_version)
+	);
+
+	CREATE TABLE hashes (
+		idx INTEGER PRIMARY KEY,
+		hash BLOB NOT NULL
+	);
+
+	CREATE TABLE tree (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		size INTEGER NOT NULL
+	);
+	INSERT INTO tree (id, size) VALUES (1, 0);
+
+	CREATE TABLE outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		data BLOB NOT NULL
+	);
+
+	CREATE TABLE annotations (
+		record_id INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (record_id, key)
+	);
+
+	CREATE TABLE audit_log (
+		id INTEGER PRIMARY KEY,
+		entry BLOB NOT NULL
+	);
+	`,
+	// Publish times are stored as Unix nanoseconds, and are NULL when unknown.
+	`
+	ALTER TABLE records ADD COLUMN published INTEGER;
+	CREATE INDEX records_published ON records (published) WHERE published IS NOT NULL;
+	`,
+	// Checkpoint times are stored as Unix nanoseconds. The index includes the size (the rowid), so it covers
+	// CheckpointAt.
+	`
+	CREATE TABLE checkpoints (
+		size INTEGER PRIMARY KEY,
+		root BLOB NOT NULL,
+		time INTEGER NOT NULL
+	);
+	CREATE INDEX checkpoints_time ON checkpoints (time);
+	`,
+	// Only full tiles are saved, so their width is implied by their height.
+	`
+	CREATE TABLE tiles (
+		height INTEGER NOT NULL,
+		level INTEGER NOT NULL,
+		n INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		PRIMARY KEY (height, level, n)
+	) WITHOUT ROWID;
+	`,
+	// The format version of the data (see sumdb.FormatVersion), 0 until the store is first used.
+	`ALTER TABLE tree ADD COLUMN format INTEGER NOT NULL DEFAULT 0;`,
+}
+
+// SchemaVersion returns the version of the schema this package migrates databases to.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// migrate applies the migrations db hasn't seen yet, each in its own transaction.
+func migrate(ctx context.Context, db *sql.DB) error {
+	for {
+		done, err := migrateNext(ctx, db)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// migrateNext applies the next migration db hasn't seen, reporting whether it was already up to date. The version is
+// read in the migration's transaction, so concurrent migrations of the same database don't apply it twice.
+func migrateNext(ctx context.Context, db *sql.DB) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin migration: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var version int
+	if err := tx.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	switch {
+	case version > len(migrations):
+		return false, fmt.Errorf("%w: version %d, want at most %d", ErrSchemaTooNew, version, len(migrations))
+	case version == len(migrations):
+		return true, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, migrations[version]); err != nil {
+		return false, fmt.Errorf("failed to apply migration: %d, %w", version+1, err)
+	}
+
+	// PRAGMA statements don't accept bound parameters.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+		return false, fmt.Errorf("failed to set schema version: %d, %w", version+1, err)
+	}
+
+	return false, tx.Commit()
+}
@@ -0,0 +1,341 @@
+// Package sqlite provides a sumdb.Store backed by SQLite, using the pure Go modernc.org/sqlite driver.
+//
+// The schema is created and migrated by Open (or New), and the store implements every optional extension of
+// sumdb.Store: sumdb.TxStore, sumdb.PathStore, sumdb.PublishedStore, sumdb.OutboxStore, sumdb.AnnotationStore,
+// sumdb.AuditStore, sumdb.CheckpointStore, sumdb.TileStore and sumdb.MaintenanceStore.
+//
+//	store, err := sqlite.Open(ctx, "/var/lib/sumdb/sumdb.db")
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//
+//	db, err := sumdb.New("sum.example.com", skey, sumdb.WithStore(store))
+//
+// Stores opened with WithWriterLock take a file lock for every write, so that tools can write to the database of a
+// live server (see Store.Lease).
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// defaultBusyTimeout is how long SQLite waits for a lock held by another connection (or process) before failing with
+// SQLITE_BUSY. See WithBusyTimeout.
+const defaultBusyTimeout = 5 * time.Second
+
+type (
+	// Store is a sumdb.Store backed by a SQLite database. It's safe for concurrent use.
+	//
+	// SQLite only allows a single writer at a time, so all write transactions are queued to a dedicated writer
+	// goroutine rather than contending for the database lock and failing with SQLITE_BUSY. Reads use the connection
+	// pool directly, and don't block (or get blocked by) the writer in WAL mode.
+	Store struct {
+		*conn
+		tx *sql.Tx // the transaction queries run in, or nil outside of WithTx
+	}
+
+	// conn is the state shared by a Store and the Stores passed to its transactions.
+	conn struct {
+		db      *sql.DB
+		ownsDB  bool
+		writes  chan writeReq
+		stopped chan struct{} // closed once the writer goroutine has drained writes and exited
+		lock    *writerLock   // nil unless opened with WithWriterLock
+		closeMu sync.RWMutex
+		closed  bool
+
+		stmtMu sync.Mutex
+		stmts  map[string]*sql.Stmt
+	}
+
+	// Option customizes a Store opened with Open.
+	Option func(*options)
+
+	options struct {
+		busyTimeout time.Duration
+		writerLock  bool
+	}
+
+	// writeReq is a write transaction, or work that can't run in one (e.g. VACUUM), queued for the writer goroutine.
+	writeReq struct {
+		ctx  context.Context
+		fn   func(*Store) error          // run in a transaction
+		raw  func(context.Context) error // run outside of a transaction, if set
+		done chan error
+
+		// unlocked is set for requests that manage the writer lock themselves, rather than holding it while they run.
+		unlocked bool
+	}
+
+	// txPanic carries a panic from a write transaction back to the goroutine that queued it.
+	txPanic struct {
+		v any
+	}
+)
+
+// ErrClosed is returned by operations on a closed Store.
+var ErrClosed = errors.New("store closed")
+
+func (p txPanic) Error() string { return fmt.Sprintf("panic in transaction: %v", p.v) }
+
+// WithBusyTimeout sets how long SQLite waits for locks held by other processes before failing. Defaults to 5 seconds.
+func WithBusyTimeout(d time.Duration) Option {
+	return func(o *options) { o.busyTimeout = d }
+}
+
+// WithWriterLock makes the store take a cooperative file lock (on the database's path with a .lock suffix) for every
+// write, so that several processes can write to the same database file, e.g. a CLI importing records while a server
+// is running. Writers wait for each other for as long as their context allows, rather than for the busy timeout, and
+// work spanning several transactions can hold the lock with Lease. Every process writing to the database must use this
+// option. It's only supported on Unix platforms.
+func WithWriterLock() Option {
+	return func(o *options) { o.writerLock = true }
+}
+
+// Open opens (creating it if needed) the SQLite database at path in WAL mode, migrates its schema and returns a Store
+// for it. The database is closed with the Store.
+func Open(ctx context.Context, path string, opts ...Option) (*Store, error) {
+	o := options{busyTimeout: defaultBusyTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Transactions take the write lock immediately (_txlock), rather than upgrading to it on their first write, so
+	// that concurrent migrations wait for each other instead of failing with SQLITE_BUSY.
+	q := url.Values{}
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "synchronous(NORMAL)")
+	q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", o.busyTimeout.Milliseconds()))
+	q.Add("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %s, %w", path, err)
+	}
+
+	var lock *writerLock
+	if o.writerLock {
+		if lock, err = openWriterLock(path); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	s, err := newStore(ctx, db, true, lock)
+	if err != nil {
+		_ = db.Close()
+		_ = lock.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// New migrates the schema of db, which must have been opened with the "sqlite" driver, and returns a Store for it.
+// Open is preferred: it configures the connection for concurrent reads. db isn't closed with the Store.
+func New(ctx context.Context, db *sql.DB) (*Store, error) {
+	return newStore(ctx, db, false, nil)
+}
+
+func newStore(ctx context.Context, db *sql.DB, ownsDB bool, lock *writerLock) (*Store, error) {
+	if err := lock.run(ctx, func() error { return migrate(ctx, db) }); err != nil {
+		return nil, err
+	}
+
+	c := &conn{
+		db:      db,
+		ownsDB:  ownsDB,
+		writes:  make(chan writeReq),
+		stopped: make(chan struct{}),
+		lock:    lock,
+		stmts:   make(map[string]*sql.Stmt),
+	}
+	go c.runWriter()
+	return &Store{conn: c}, nil
+}
+
+// Close stops the store's writer goroutine and closes its prepared statements, and the database if the Store was
+// created by Open. It waits for queued and running write transactions to finish first. The Store must not be used
+// afterwards.
+func (s *Store) Close() error {
+	s.closeMu.Lock()
+	if s.closed {
+		s.closeMu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.writes)
+	s.closeMu.Unlock()
+
+	// The writer may be running a transaction, which needs the statements and database until it finishes.
+	<-s.stopped
+
+	s.stmtMu.Lock()
+	defer s.stmtMu.Unlock()
+
+	var errs []error
+	for _, stmt := range s.stmts {
+		errs = append(errs, stmt.Close())
+	}
+	clear(s.stmts)
+
+	if s.ownsDB {
+		errs = append(errs, s.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// WithTx implements sumdb.TxStore. The transaction is run by the writer goroutine; calls within a transaction run
+// inline.
+func (s *Store) WithTx(ctx context.Context, fn func(sumdb.Store) error) error {
+	return s.write(ctx, func(tx *Store) error { return fn(tx) })
+}
+
+// write runs fn in its own write transaction, or in the current one when called within WithTx.
+func (s *Store) write(ctx context.Context, fn func(*Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	req := writeReq{ctx: ctx, fn: fn, done: make(chan error, 1)}
+	if err := s.enqueue(ctx, req); err != nil {
+		return err
+	}
+
+	err := <-req.done
+	var p txPanic
+	if errors.As(err, &p) {
+		panic(p.v)
+	}
+	return err
+}
+
+// enqueue queues req for the writer goroutine, unless the store is closed.
+func (c *conn) enqueue(ctx context.Context, req writeReq) error {
+	c.closeMu.RLock()
+	defer c.closeMu.RUnlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	select {
+	case c.writes <- req:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// control runs fn on the writer goroutine without taking the writer lock, between write transactions.
+func (c *conn) control(ctx context.Context, fn func(context.Context) error) error {
+	req := writeReq{ctx: ctx, raw: fn, unlocked: true, done: make(chan error, 1)}
+	if err := c.enqueue(ctx, req); err != nil {
+		return err
+	}
+	return <-req.done
+}
+
+// runWriter runs queued write transactions one at a time, holding the writer lock (if any) while they run, until the
+// store is closed. The lock file is closed once the queue is drained, and stopped is closed on exit.
+func (c *conn) runWriter() {
+	defer close(c.stopped)
+	defer func() { _ = c.lock.close() }()
+
+	for req := range c.writes {
+		run := func() error {
+			if req.raw != nil {
+				return req.raw(req.ctx)
+			}
+			return c.runTx(req.ctx, req.fn)
+		}
+
+		if req.unlocked {
+			req.done <- run()
+			continue
+		}
+		req.done <- c.lock.run(req.ctx, run)
+	}
+}
+
+// runTx runs fn in a new transaction, committing it if fn returns nil.
+func (c *conn) runTx(ctx context.Context, fn func(*Store) error) (err error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			err = txPanic{v: p}
+		}
+	}()
+
+	if err := fn(&Store{conn: c, tx: tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// stmt returns the prepared statement for query, preparing it on first use. Statements are prepared once per store
+// and bound to the current transaction, if any.
+func (s *Store) stmt(ctx context.Context, query string) (*sql.Stmt, error) {
+	s.stmtMu.Lock()
+	stmt, ok := s.stmts[query]
+	if !ok {
+		var err error
+		if stmt, err = s.db.PrepareContext(ctx, query); err != nil {
+			s.stmtMu.Unlock()
+			return nil, fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		s.stmts[query] = stmt
+	}
+	s.stmtMu.Unlock()
+
+	if s.tx != nil {
+		return s.tx.StmtContext(ctx, stmt), nil
+	}
+	return stmt, nil
+}
+
+// exec executes query with args using its prepared statement.
+func (s *Store) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := s.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+// query runs query with args using its prepared statement.
+func (s *Store) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmt, err := s.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+// queryRow runs query with args using its prepared statement, scanning the first row into dest. It returns
+// sql.ErrNoRows if there are no rows.
+func (s *Store) queryRow(ctx context.Context, query string, args []any, dest ...any) error {
+	stmt, err := s.stmt(ctx, query)
+	if err != nil {
+		return err
+	}
+	return stmt.QueryRowContext(ctx, args...).Scan(dest...)
+}
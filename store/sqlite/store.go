@@ -0,0 +1,423 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+var (
+	_ sumdb.TxStore         = (*Store)(nil)
+	_ sumdb.PathStore       = (*Store)(nil)
+	_ sumdb.PublishedStore  = (*Store)(nil)
+	_ sumdb.OutboxStore     = (*Store)(nil)
+	_ sumdb.AnnotationStore = (*Store)(nil)
+	_ sumdb.AuditStore      = (*Store)(nil)
+	_ sumdb.CheckpointStore = (*Store)(nil)
+	_ sumdb.TileStore       = (*Store)(nil)
+	_ sumdb.FormatStore     = (*Store)(nil)
+)
+
+// RecordID returns the ID of the record for the given module path and version.
+func (s *Store) RecordID(ctx context.Context, path, version string) (int64, error) {
+	escPath, escVersion, err := sumdb.EscapeModule(path, version)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = s.queryRow(ctx, "SELECT id FROM records WHERE escaped_path = ? AND escaped_version = ?",
+		[]any{escPath, escVersion}, &id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, sumdb.ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query record: %s@%s, %w", path, version, err)
+	}
+
+	return id, nil
+}
+
+// HasPath implements sumdb.PathStore.
+func (s *Store) HasPath(ctx context.Context, path string) (bool, error) {
+	escPath, err := module.EscapePath(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to escape path: %s, %w", path, err)
+	}
+
+	var exists bool
+	err = s.queryRow(ctx, "SELECT EXISTS(SELECT 1 FROM records WHERE escaped_path = ?)", []any{escPath}, &exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to query path: %s, %w", path, err)
+	}
+
+	return exists, nil
+}
+
+// Records returns records with IDs in the interval [id, id+n).
+func (s *Store) Records(ctx context.Context, id, n int64) ([]*sumdb.Record, error) {
+	rows, err := s.query(ctx, "SELECT "+recordColumns+" FROM records WHERE id >= ? AND id < ? ORDER BY id", id, id+n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query records: %w", err)
+	}
+	return scanRecords(rows)
+}
+
+// PublishedRecords implements sumdb.PublishedStore. The records_published index covers the query.
+func (s *Store) PublishedRecords(ctx context.Context, since, until time.Time, n int64) ([]*sumdb.Record, error) {
+	rows, err := s.query(ctx, "SELECT "+recordColumns+
+		" FROM records WHERE published >= ? AND published < ? ORDER BY published, id LIMIT ?",
+		since.UnixNano(), until.UnixNano(), n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query published records: %w", err)
+	}
+	return scanRecords(rows)
+}
+
+// recordColumns are the columns scanned by scanRecords.
+const recordColumns = "id, path, version, data, published"
+
+// scanRecords scans and closes rows of recordColumns.
+func scanRecords(rows *sql.Rows) ([]*sumdb.Record, error) {
+	defer func() { _ = rows.Close() }()
+
+	var records []*sumdb.Record
+	for rows.Next() {
+		r := &sumdb.Record{}
+		var published sql.NullInt64
+		if err := rows.Scan(&r.ID, &r.Path, &r.Version, &r.Data, &published); err != nil {
+			return nil, fmt.Errorf("failed to scan record: %w", err)
+		}
+		if published.Valid {
+			r.Published = time.Unix(0, published.Int64).UTC()
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// AddRecord adds a new entry for the specified module.
+func (s *Store) AddRecord(ctx context.Context, r *sumdb.Record) (int64, error) {
+	escPath, escVersion, err := sumdb.EscapeModule(r.Path, r.Version)
+	if err != nil {
+		return 0, err
+	}
+
+	var published sql.NullInt64
+	if !r.Published.IsZero() {
+		published = sql.NullInt64{Int64: r.Published.UnixNano(), Valid: true}
+	}
+
+	var id int64
+	err = s.write(ctx, func(s *Store) error {
+		// Record IDs are their positions in the tree, so they start at 0 rather than SQLite's default of 1.
+		res, err := s.exec(ctx, `
+			INSERT INTO records (id, path, version, escaped_path, escaped_version, data, published)
+			VALUES ((SELECT COALESCE(MAX(id) + 1, 0) FROM records), ?, ?, ?, ?, ?, ?)`,
+			r.Path, r.Version, escPath, escVersion, r.Data, published,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert record: %s@%s, %w", r.Path, r.Version, err)
+		}
+
+		id, err = res.LastInsertId()
+		return err
+	})
+
+	return id, err
+}
+
+// ReadHashes returns the hashes at the given storage indexes. The indexes are bound as a single JSON array parameter,
+// so every read uses the same prepared statement and isn't subject to SQLite's limit on bound parameters.
+func (s *Store) ReadHashes(ctx context.Context, indexes []int64) ([]tlog.Hash, error) {
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+
+	// Indexes may be repeated.
+	positions := make(map[int64][]int, len(indexes))
+	for i, idx := range indexes {
+		positions[idx] = append(positions[idx], i)
+	}
+
+	arg, err := json.Marshal(slices.Collect(maps.Keys(positions)))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.query(ctx, "SELECT idx, hash FROM hashes WHERE idx IN (SELECT value FROM json_each(?))", string(arg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hashes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	result := make([]tlog.Hash, len(indexes))
+	for rows.Next() {
+		var idx int64
+		var hash []byte
+		if err := rows.Scan(&idx, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan hash: %w", err)
+		}
+		if len(hash) != tlog.HashSize {
+			return nil, fmt.Errorf("invalid hash at %d: %d bytes", idx, len(hash))
+		}
+		for _, i := range positions[idx] {
+			copy(result[i][:], hash)
+		}
+		delete(positions, idx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query hashes: %w", err)
+	}
+
+	// Any indexes left weren't found.
+	if len(positions) > 0 {
+		return nil, fmt.Errorf("%w: %v", sumdb.ErrMissingHash, slices.Sorted(maps.Keys(positions)))
+	}
+
+	return result, nil
+}
+
+// WriteHashes stores hashes at the given storage indexes.
+func (s *Store) WriteHashes(ctx context.Context, indexes []int64, hashes []tlog.Hash) error {
+	return s.write(ctx, func(s *Store) error {
+		for i, idx := range indexes {
+			if _, err := s.exec(ctx, "INSERT OR REPLACE INTO hashes (idx, hash) VALUES (?, ?)", idx, hashes[i][:]); err != nil {
+				return fmt.Errorf("failed to insert hash: %d, %w", idx, err)
+			}
+		}
+		return nil
+	})
+}
+
+// TreeSize returns the current number of records in the tree.
+func (s *Store) TreeSize(ctx context.Context) (int64, error) {
+	var size int64
+	if err := s.queryRow(ctx, "SELECT size FROM tree WHERE id = 1", nil, &size); err != nil {
+		return 0, fmt.Errorf("failed to query tree size: %w", err)
+	}
+	return size, nil
+}
+
+// SetTreeSize updates the tree size.
+func (s *Store) SetTreeSize(ctx context.Context, size int64) error {
+	return s.write(ctx, func(s *Store) error {
+		if _, err := s.exec(ctx, "UPDATE tree SET size = ? WHERE id = 1", size); err != nil {
+			return fmt.Errorf("failed to update tree size: %d, %w", size, err)
+		}
+		return nil
+	})
+}
+
+// FormatVersion implements sumdb.FormatStore.
+func (s *Store) FormatVersion(ctx context.Context) (int, error) {
+	var version int
+	if err := s.queryRow(ctx, "SELECT format FROM tree WHERE id = 1", nil, &version); err != nil {
+		return 0, fmt.Errorf("failed to query format version: %w", err)
+	}
+	return version, nil
+}
+
+// SetFormatVersion implements sumdb.FormatStore.
+func (s *Store) SetFormatVersion(ctx context.Context, version int) error {
+	return s.write(ctx, func(s *Store) error {
+		if _, err := s.exec(ctx, "UPDATE tree SET format = ? WHERE id = 1", version); err != nil {
+			return fmt.Errorf("failed to update format version: %d, %w", version, err)
+		}
+		return nil
+	})
+}
+
+// AddOutboxEvent implements sumdb.OutboxStore.
+func (s *Store) AddOutboxEvent(ctx context.Context, data []byte) error {
+	return s.write(ctx, func(s *Store) error {
+		if _, err := s.exec(ctx, "INSERT INTO outbox (data) VALUES (?)", data); err != nil {
+			return fmt.Errorf("failed to insert outbox event: %w", err)
+		}
+		return nil
+	})
+}
+
+// OutboxEvents implements sumdb.OutboxStore.
+func (s *Store) OutboxEvents(ctx context.Context, n int64) ([]*sumdb.OutboxEvent, error) {
+	rows, err := s.query(ctx, "SELECT id, data FROM outbox ORDER BY id LIMIT ?", n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var events []*sumdb.OutboxEvent
+	for rows.Next() {
+		e := &sumdb.OutboxEvent{}
+		if err := rows.Scan(&e.ID, &e.Data); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// DeleteOutboxEvents implements sumdb.OutboxStore.
+func (s *Store) DeleteOutboxEvents(ctx context.Context, ids []int64) error {
+	return s.write(ctx, func(s *Store) error {
+		for _, id := range ids {
+			if _, err := s.exec(ctx, "DELETE FROM outbox WHERE id = ?", id); err != nil {
+				return fmt.Errorf("failed to delete outbox event: %d, %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// SetAnnotation implements sumdb.AnnotationStore.
+func (s *Store) SetAnnotation(ctx context.Context, id int64, key, value string) error {
+	return s.write(ctx, func(s *Store) error {
+		var err error
+		if value == "" {
+			_, err = s.exec(ctx, "DELETE FROM annotations WHERE record_id = ? AND key = ?", id, key)
+		} else {
+			_, err = s.exec(ctx, "INSERT OR REPLACE INTO annotations (record_id, key, value) VALUES (?, ?, ?)",
+				id, key, value)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set annotation: %d %s, %w", id, key, err)
+		}
+		return nil
+	})
+}
+
+// Annotations implements sumdb.AnnotationStore.
+func (s *Store) Annotations(ctx context.Context, id int64) (map[string]string, error) {
+	rows, err := s.query(ctx, "SELECT key, value FROM annotations WHERE record_id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query annotations: %d, %w", id, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	annotations := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan annotation: %w", err)
+		}
+		annotations[key] = value
+	}
+	return annotations, rows.Err()
+}
+
+// AuditSize implements sumdb.AuditStore.
+func (s *Store) AuditSize(ctx context.Context) (int64, error) {
+	var size int64
+	if err := s.queryRow(ctx, "SELECT COUNT(*) FROM audit_log", nil, &size); err != nil {
+		return 0, fmt.Errorf("failed to query audit log size: %w", err)
+	}
+	return size, nil
+}
+
+// AddAuditEntry implements sumdb.AuditStore.
+func (s *Store) AddAuditEntry(ctx context.Context, id int64, entry []byte) error {
+	return s.write(ctx, func(s *Store) error {
+		if _, err := s.exec(ctx, "INSERT INTO audit_log (id, entry) VALUES (?, ?)", id, entry); err != nil {
+			return fmt.Errorf("failed to insert audit entry: %d, %w", id, err)
+		}
+		return nil
+	})
+}
+
+// AuditEntries implements sumdb.AuditStore.
+func (s *Store) AuditEntries(ctx context.Context, id, n int64) ([][]byte, error) {
+	rows, err := s.query(ctx, "SELECT entry FROM audit_log WHERE id >= ? AND id < ? ORDER BY id", id, id+n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries [][]byte
+	for rows.Next() {
+		var entry []byte
+		if err := rows.Scan(&entry); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// AddCheckpoint implements sumdb.CheckpointStore.
+func (s *Store) AddCheckpoint(ctx context.Context, c *sumdb.Checkpoint) error {
+	return s.write(ctx, func(s *Store) error {
+		if _, err := s.exec(ctx, "INSERT INTO checkpoints (size, root, time) VALUES (?, ?, ?)",
+			c.Size, c.Root[:], c.Time.UnixNano()); err != nil {
+			return fmt.Errorf("failed to insert checkpoint: %d, %w", c.Size, err)
+		}
+		return nil
+	})
+}
+
+// CheckpointAt implements sumdb.CheckpointStore. The checkpoints_time index covers the query.
+func (s *Store) CheckpointAt(ctx context.Context, t time.Time) (*sumdb.Checkpoint, error) {
+	return s.checkpoint(ctx,
+		"SELECT size, root, time FROM checkpoints WHERE time <= ? ORDER BY time DESC, size DESC LIMIT 1", t.UnixNano())
+}
+
+// Checkpoint implements sumdb.CheckpointStore.
+func (s *Store) Checkpoint(ctx context.Context, size int64) (*sumdb.Checkpoint, error) {
+	return s.checkpoint(ctx, "SELECT size, root, time FROM checkpoints WHERE size = ?", size)
+}
+
+// checkpoint returns the checkpoint selected by query, which must select its size, root and time.
+func (s *Store) checkpoint(ctx context.Context, query string, args ...any) (*sumdb.Checkpoint, error) {
+	var (
+		c    sumdb.Checkpoint
+		root []byte
+		at   int64
+	)
+	err := s.queryRow(ctx, query, args, &c.Size, &root, &at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sumdb.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query checkpoint: %w", err)
+	}
+	if len(root) != tlog.HashSize {
+		return nil, fmt.Errorf("invalid checkpoint root at %d: %d bytes", c.Size, len(root))
+	}
+
+	copy(c.Root[:], root)
+	c.Time = time.Unix(0, at).UTC()
+	return &c, nil
+}
+
+// ReadSavedTile implements sumdb.TileStore.
+func (s *Store) ReadSavedTile(ctx context.Context, t tlog.Tile) ([]byte, error) {
+	var data []byte
+	err := s.queryRow(ctx, "SELECT data FROM tiles WHERE height = ? AND level = ? AND n = ?",
+		[]any{t.H, t.L, t.N}, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sumdb.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tile: %s, %w", t.Path(), err)
+	}
+	return data, nil
+}
+
+// WriteSavedTile implements sumdb.TileStore. Tiles that are already saved are left as they are.
+func (s *Store) WriteSavedTile(ctx context.Context, t tlog.Tile, data []byte) error {
+	return s.write(ctx, func(s *Store) error {
+		if _, err := s.exec(ctx, "INSERT OR IGNORE INTO tiles (height, level, n, data) VALUES (?, ?, ?, ?)",
+			t.H, t.L, t.N, data); err != nil {
+			return fmt.Errorf("failed to insert tile: %s, %w", t.Path(), err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,421 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pseudomuto/sumdb"
+	. "github.com/pseudomuto/sumdb/store/sqlite"
+	"github.com/pseudomuto/sumdb/store/storetest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(tb testing.TB) sumdb.Store { return newTestStore(tb) })
+}
+
+func TestStore_ConcurrentWrites(t *testing.T) {
+	store := newTestStore(t)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 50)
+	for i := range errs {
+		wg.Go(func() { errs[i] = addRecord(t, store, int64(i)) })
+	}
+	wg.Wait()
+	require.NoError(t, errors.Join(errs...))
+
+	size, err := store.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(50), size)
+}
+
+func TestStore_WithTx(t *testing.T) {
+	store := newTestStore(t)
+
+	rec := &sumdb.Record{Path: "example.com/mod", Version: "v1.0.0", Data: []byte("data\n")}
+	err := store.WithTx(t.Context(), func(tx sumdb.Store) error {
+		if _, err := tx.AddRecord(t.Context(), rec); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	require.EqualError(t, err, "rollback")
+
+	_, err = store.RecordID(t.Context(), "example.com/mod", "v1.0.0")
+	require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+	require.PanicsWithValue(t, "boom", func() {
+		_ = store.WithTx(t.Context(), func(sumdb.Store) error { panic("boom") })
+	})
+
+	// The writer survives panics.
+	require.NoError(t, addRecord(t, store, 0))
+}
+
+func TestStore_Close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sumdb.db")
+	store, err := Open(t.Context(), path)
+	require.NoError(t, err)
+
+	// Close waits for the transaction in flight, which still has the database to commit to.
+	started, release := make(chan struct{}), make(chan struct{})
+	txDone := make(chan error, 1)
+	go func() {
+		txDone <- store.WithTx(t.Context(), func(tx sumdb.Store) error {
+			close(started)
+			<-release
+			rec := &sumdb.Record{Path: "example.com/mod", Version: "v1.0.0", Data: []byte("data\n")}
+			_, err := tx.AddRecord(t.Context(), rec)
+			return err
+		})
+	}()
+	<-started
+
+	closed := make(chan error, 1)
+	go func() { closed <- store.Close() }()
+
+	select {
+	case <-closed:
+		require.Fail(t, "Close returned with a transaction in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-txDone)
+	require.NoError(t, <-closed)
+	require.ErrorIs(t, store.WithTx(t.Context(), func(sumdb.Store) error { return nil }), ErrClosed)
+
+	store, err = Open(t.Context(), path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, store.Close()) }()
+
+	id, err := store.RecordID(t.Context(), "example.com/mod", "v1.0.0")
+	require.NoError(t, err)
+	require.Zero(t, id)
+}
+
+func TestStore_ReadHashes(t *testing.T) {
+	store := newTestStore(t)
+
+	// More hashes than SQLite allows bound parameters in a query.
+	indexes := make([]int64, 2001)
+	hashes := make([]tlog.Hash, len(indexes))
+	for i := range indexes {
+		indexes[i] = int64(i)
+		hashes[i] = tlog.RecordHash(fmt.Appendf(nil, "record %d\n", i))
+	}
+	require.NoError(t, store.WriteHashes(t.Context(), indexes, hashes))
+
+	got, err := store.ReadHashes(t.Context(), indexes)
+	require.NoError(t, err)
+	require.Equal(t, hashes, got)
+
+	got, err = store.ReadHashes(t.Context(), []int64{3, 1, 3})
+	require.NoError(t, err)
+	require.Equal(t, []tlog.Hash{hashes[3], hashes[1], hashes[3]}, got)
+
+	_, err = store.ReadHashes(t.Context(), []int64{1, 5000, 2, 4000})
+	require.ErrorIs(t, err, sumdb.ErrMissingHash)
+	require.ErrorContains(t, err, "[4000 5000]")
+}
+
+func TestStore_Extensions(t *testing.T) {
+	store := newTestStore(t)
+	ctx := t.Context()
+
+	t.Run("paths", func(t *testing.T) {
+		require.NoError(t, addRecord(t, store, 0))
+
+		ok, err := store.HasPath(ctx, "example.com/mod")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = store.HasPath(ctx, "example.com/Mod")
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("annotations", func(t *testing.T) {
+		require.NoError(t, store.SetAnnotation(ctx, 0, "approved", "alice"))
+		require.NoError(t, store.SetAnnotation(ctx, 0, "deprecated", "yes"))
+		require.NoError(t, store.SetAnnotation(ctx, 0, "deprecated", ""))
+
+		got, err := store.Annotations(ctx, 0)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"approved": "alice"}, got)
+
+		got, err = store.Annotations(ctx, 1)
+		require.NoError(t, err)
+		require.Empty(t, got)
+	})
+
+	t.Run("audit log", func(t *testing.T) {
+		for i := range int64(3) {
+			require.NoError(t, store.AddAuditEntry(ctx, i, fmt.Appendf(nil, "entry %d", i)))
+		}
+		require.Error(t, store.AddAuditEntry(ctx, 1, []byte("duplicate")))
+
+		size, err := store.AuditSize(ctx)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), size)
+
+		entries, err := store.AuditEntries(ctx, 1, 5)
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("entry 1"), []byte("entry 2")}, entries)
+	})
+
+	t.Run("outbox", func(t *testing.T) {
+		for _, e := range []string{"a", "b", "c"} {
+			require.NoError(t, store.AddOutboxEvent(ctx, []byte(e)))
+		}
+
+		events, err := store.OutboxEvents(ctx, 2)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		require.Equal(t, "a", string(events[0].Data))
+
+		require.NoError(t, store.DeleteOutboxEvents(ctx, []int64{events[0].ID, events[1].ID}))
+		events, err = store.OutboxEvents(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, "c", string(events[0].Data))
+	})
+
+	t.Run("publish times", func(t *testing.T) {
+		at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+		for i, published := range []time.Time{at, at.Add(-time.Hour), {}, at.Add(time.Hour)} {
+			_, err := store.AddRecord(ctx, &sumdb.Record{
+				Path:      "example.com/published",
+				Version:   fmt.Sprintf("v1.0.%d", i),
+				Data:      []byte("data\n"),
+				Published: published,
+			})
+			require.NoError(t, err)
+		}
+
+		recs, err := store.Records(ctx, 1, 4)
+		require.NoError(t, err)
+		require.Equal(t, at, recs[0].Published)
+		require.True(t, recs[2].Published.IsZero())
+
+		recs, err = store.PublishedRecords(ctx, at.Add(-time.Hour), at.Add(time.Hour), 10)
+		require.NoError(t, err)
+		require.Len(t, recs, 2)
+		require.Equal(t, "v1.0.1", recs[0].Version)
+		require.Equal(t, "v1.0.0", recs[1].Version)
+
+		recs, err = store.PublishedRecords(ctx, time.Time{}, at.Add(2*time.Hour), 1)
+		require.NoError(t, err)
+		require.Len(t, recs, 1)
+		require.Equal(t, "v1.0.1", recs[0].Version)
+	})
+
+	t.Run("checkpoints", func(t *testing.T) {
+		at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+		_, err := store.CheckpointAt(ctx, at)
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+		checkpoints := []sumdb.Checkpoint{
+			{Size: 1, Root: tlog.Hash{1}, Time: at},
+			{Size: 2, Root: tlog.Hash{2}, Time: at.Add(time.Hour)},
+			{Size: 3, Root: tlog.Hash{3}, Time: at.Add(time.Hour)},
+		}
+		for _, c := range checkpoints {
+			require.NoError(t, store.AddCheckpoint(ctx, &c))
+		}
+		require.Error(t, store.AddCheckpoint(ctx, &checkpoints[0]))
+
+		c, err := store.CheckpointAt(ctx, at.Add(time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, &checkpoints[0], c)
+
+		c, err = store.CheckpointAt(ctx, at.Add(24*time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, &checkpoints[2], c)
+
+		c, err = store.Checkpoint(ctx, 2)
+		require.NoError(t, err)
+		require.Equal(t, &checkpoints[1], c)
+
+		_, err = store.Checkpoint(ctx, 4)
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+	})
+
+	t.Run("tiles", func(t *testing.T) {
+		tile := tlog.Tile{H: 8, L: 0, N: 1, W: 256}
+		_, err := store.ReadSavedTile(ctx, tile)
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+		require.NoError(t, store.WriteSavedTile(ctx, tile, []byte("tile")))
+		require.NoError(t, store.WriteSavedTile(ctx, tile, []byte("other")))
+
+		data, err := store.ReadSavedTile(ctx, tile)
+		require.NoError(t, err)
+		require.Equal(t, []byte("tile"), data)
+
+		_, err = store.ReadSavedTile(ctx, tlog.Tile{H: 8, L: -1, N: 1, W: 256})
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+	})
+}
+
+func TestStore_Maintenance(t *testing.T) {
+	store := newTestStore(t)
+	for i := range int64(10) {
+		require.NoError(t, addRecord(t, store, i))
+	}
+
+	jobs := store.MaintenanceJobs()
+	require.Len(t, jobs, 2)
+
+	// Writes queued while jobs run wait for them.
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Go(func() { require.NoError(t, addRecord(t, store, int64(10+i))) })
+		require.NoError(t, job.Run(t.Context()), job.Name)
+	}
+	wg.Wait()
+
+	size, err := store.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(12), size)
+}
+
+func TestStore_WriterLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sumdb.db")
+
+	// Two stores on the same file stand in for a server and a CLI running in separate processes.
+	open := func() *Store {
+		store, err := Open(t.Context(), path, WithWriterLock())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	}
+	server, cli := open(), open()
+	require.NoError(t, addRecord(t, server, 0))
+
+	release, err := cli.Lease(t.Context())
+	require.NoError(t, err)
+
+	// Leases are shared within a store, and writes through it go through while it's held.
+	nested, err := cli.Lease(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, nested())
+	require.NoError(t, addRecord(t, cli, 1))
+
+	// Other stores wait for the lease, for as long as their context allows.
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, server.WithTx(ctx, func(sumdb.Store) error { return nil }), context.DeadlineExceeded)
+
+	done := make(chan error, 1)
+	go func() { done <- addRecord(t, server, 2) }()
+
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, addRecord(t, cli, 3))
+	require.Empty(t, done)
+
+	// Releasing the lease hands the lock over.
+	require.NoError(t, release())
+	require.NoError(t, release())
+	require.NoError(t, <-done)
+
+	size, err := server.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(4), size)
+
+	// Closing a store releases its lease.
+	_, err = server.Lease(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, server.Close())
+	require.NoError(t, addRecord(t, cli, 4))
+
+	_, err = newTestStore(t).Lease(t.Context())
+	require.ErrorIs(t, err, ErrNoWriterLock)
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sumdb.db")
+
+	store, err := Open(t.Context(), path)
+	require.NoError(t, err)
+	require.NoError(t, addRecord(t, store, 0))
+	require.NoError(t, store.Close())
+	require.NoError(t, store.Close())
+
+	// Closed stores refuse writes.
+	require.ErrorIs(t, addRecord(t, store, 1), ErrClosed)
+
+	// Reopening keeps the data, without migrating again.
+	store, err = Open(t.Context(), path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	size, err := store.TreeSize(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), size)
+
+	t.Run("schema versions", func(t *testing.T) {
+		db, err := sql.Open("sqlite", "file:"+path)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+
+		var version int
+		require.NoError(t, db.QueryRowContext(t.Context(), "PRAGMA user_version").Scan(&version))
+		require.Equal(t, SchemaVersion(), version)
+
+		// Databases migrated by newer versions aren't used.
+		_, err = db.ExecContext(t.Context(), fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion()+1))
+		require.NoError(t, err)
+		_, err = New(t.Context(), db)
+		require.ErrorIs(t, err, ErrSchemaTooNew)
+	})
+}
+
+// BenchmarkStore runs the standardized store benchmarks, for comparison with other backends.
+func BenchmarkStore(b *testing.B) {
+	storetest.Benchmark(b, func(tb testing.TB) sumdb.Store { return newTestStore(tb) })
+}
+
+func newTestStore(tb testing.TB) *Store {
+	tb.Helper()
+
+	store, err := Open(tb.Context(), filepath.Join(tb.TempDir(), "sumdb.db"))
+	require.NoError(tb, err)
+	tb.Cleanup(func() { _ = store.Close() })
+
+	return store
+}
+
+// addRecord appends a record, its hash and the new tree size in a single transaction.
+func addRecord(tb testing.TB, store *Store, n int64) error {
+	tb.Helper()
+
+	return store.WithTx(tb.Context(), func(tx sumdb.Store) error {
+		id, err := tx.AddRecord(tb.Context(), &sumdb.Record{
+			Path:    "example.com/mod",
+			Version: fmt.Sprintf("v0.0.%d", n),
+			Data:    []byte("data\n"),
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.WriteHashes(tb.Context(), []int64{id}, []tlog.Hash{tlog.RecordHash([]byte("data\n"))}); err != nil {
+			return err
+		}
+
+		size, err := tx.TreeSize(tb.Context())
+		if err != nil {
+			return err
+		}
+		return tx.SetTreeSize(tb.Context(), size+1)
+	})
+}
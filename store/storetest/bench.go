@@ -0,0 +1,179 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// DefaultSizes are the tree sizes at which the benchmarks run when none are given.
+var DefaultSizes = []int64{1_000, 10_000}
+
+type (
+	// BenchOptions configures RunBenchmarks.
+	BenchOptions struct {
+		// Sizes are the tree sizes at which the benchmarks run, in increasing order. The store is populated with
+		// generated records to reach each size. Defaults to DefaultSizes.
+		Sizes []int64
+
+		// ReadOnly only runs the read benchmarks, at the store's current size. This is required for stores that can't
+		// be written to, such as snapshots.
+		ReadOnly bool
+	}
+
+	// Result is the outcome of one of the benchmarks.
+	Result struct {
+		Name string
+		testing.BenchmarkResult
+	}
+
+	// benchmark is one of the standardized benchmarks, run against a store of the given size.
+	benchmark struct {
+		name     string
+		readOnly bool
+		run      func(b *testing.B, ctx context.Context, store sumdb.Store, size int64) error
+	}
+)
+
+// benchmarks are the standardized benchmarks, run in order at each tree size.
+var benchmarks = []benchmark{
+	{name: "ReadHashes/proof", readOnly: true, run: benchProof},
+	{name: "ReadHashes/tile", readOnly: true, run: benchTile},
+	{name: "Append", run: benchAppend},
+}
+
+// Benchmark runs the benchmarks as sub-benchmarks of b against a store returned by newStore, growing it to each of
+// sizes (or DefaultSizes) in turn:
+//
+//   - Append measures appending a record and its hashes in its own transaction, as lookups do, and reports the
+//     throughput in records/s.
+//   - ReadHashes/proof measures reading the hashes of a random record's inclusion proof.
+//   - ReadHashes/tile measures reading and serializing the 256 hashes of a random tile, reporting allocations.
+func Benchmark(b *testing.B, newStore NewStoreFunc, sizes ...int64) {
+	store := newStore(b)
+	for _, size := range orDefault(sizes, DefaultSizes) {
+		if err := Populate(b.Context(), store, size); err != nil {
+			b.Fatal(err)
+		}
+
+		for _, bm := range benchmarks {
+			b.Run(fmt.Sprintf("size=%d/%s", size, bm.name), func(b *testing.B) {
+				if err := bm.run(b, b.Context(), store, size); err != nil {
+					b.Fatal(err)
+				}
+			})
+		}
+	}
+}
+
+// RunBenchmarks runs the benchmarks outside of go test (e.g. from a CLI) against store. Unless opts.ReadOnly is set,
+// the store is populated with generated records and grows as records are appended, so it should be empty or
+// dedicated to benchmarking.
+func RunBenchmarks(ctx context.Context, store sumdb.Store, opts BenchOptions) ([]Result, error) {
+	sizes := orDefault(opts.Sizes, DefaultSizes)
+	if opts.ReadOnly {
+		size, err := store.TreeSize(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tree size: %w", err)
+		}
+		if size == 0 {
+			return nil, errors.New("read-only store is empty")
+		}
+		sizes = []int64{size}
+	}
+
+	for _, size := range sizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid tree size: %d", size)
+		}
+	}
+
+	var results []Result
+	for _, size := range sizes {
+		if !opts.ReadOnly {
+			if err := Populate(ctx, store, size); err != nil {
+				return results, err
+			}
+		}
+
+		for _, bm := range benchmarks {
+			if opts.ReadOnly && !bm.readOnly {
+				continue
+			}
+
+			var err error
+			res := testing.Benchmark(func(b *testing.B) {
+				if err = bm.run(b, ctx, store, size); err != nil {
+					b.SkipNow()
+				}
+			})
+			if err != nil {
+				return results, fmt.Errorf("%s at size %d: %w", bm.name, size, err)
+			}
+
+			results = append(results, Result{Name: fmt.Sprintf("size=%d/%s", size, bm.name), BenchmarkResult: res})
+		}
+	}
+	return results, nil
+}
+
+func benchAppend(b *testing.B, ctx context.Context, store sumdb.Store, _ int64) error {
+	// Appends grow the store, so they continue from its current size rather than the benchmark's.
+	size, err := store.TreeSize(ctx)
+	if err != nil {
+		return err
+	}
+
+	b.ResetTimer()
+	for i := range int64(b.N) {
+		if err := withTx(ctx, store, func(tx sumdb.Store) error { return appendRecord(ctx, tx, size+i) }); err != nil {
+			return err
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "records/s")
+	return nil
+}
+
+func benchProof(b *testing.B, ctx context.Context, store sumdb.Store, size int64) error {
+	for b.Loop() {
+		if _, err := tree.ProveRecord(ctx, store, size, rand.Int64N(size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func benchTile(b *testing.B, ctx context.Context, store sumdb.Store, size int64) error {
+	// Only full tiles are read, unless the tree is smaller than a tile.
+	width := int64(1 << tree.TileHeight)
+	tiles := size / width
+	if tiles == 0 {
+		tiles, width = 1, size
+	}
+
+	// The tile buffer is reused, as the server does, so allocations are the store's.
+	b.ReportAllocs()
+	buf := make([]byte, 0, tlog.HashSize<<tree.TileHeight)
+	for b.Loop() {
+		t := tlog.Tile{H: tree.TileHeight, L: 0, N: rand.Int64N(tiles), W: int(width)}
+		var err error
+		if buf, err = tree.AppendTile(ctx, store, t, buf[:0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orDefault returns sizes, or defaults if sizes is empty.
+func orDefault(sizes, defaults []int64) []int64 {
+	if len(sizes) == 0 {
+		return defaults
+	}
+	return sizes
+}
@@ -0,0 +1,277 @@
+// Package storetest provides a conformance suite and standardized benchmarks for sumdb.Store implementations, so that
+// backends can be checked for correctness and compared on the same workloads.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// NewStoreFunc returns a new, empty store. Stores that need cleaning up should register it with tb.Cleanup.
+type NewStoreFunc func(tb testing.TB) sumdb.Store
+
+// Run runs the conformance suite against the stores returned by newStore. Each subtest uses a new store.
+//
+// Stores implementing sumdb.TxStore are also checked for commits and rollbacks, and those implementing
+// sumdb.FormatStore for recording their format version.
+func Run(t *testing.T, newStore NewStoreFunc) {
+	t.Run("empty", func(t *testing.T) {
+		store := newStore(t)
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Zero(t, size)
+
+		_, err = store.RecordID(t.Context(), "example.com/mod", "v1.0.0")
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+		recs, err := store.Records(t.Context(), 0, 10)
+		require.NoError(t, err)
+		require.Empty(t, recs)
+	})
+
+	t.Run("records", func(t *testing.T) {
+		store := newStore(t)
+		want := make([]*sumdb.Record, 3)
+		for i := range want {
+			want[i] = benchRecord(int64(i))
+			id, err := store.AddRecord(t.Context(), want[i])
+			require.NoError(t, err)
+			require.Equal(t, int64(i), id)
+			want[i].ID = id
+		}
+
+		for _, rec := range want {
+			id, err := store.RecordID(t.Context(), rec.Path, rec.Version)
+			require.NoError(t, err)
+			require.Equal(t, rec.ID, id)
+		}
+
+		_, err := store.RecordID(t.Context(), want[0].Path, "v9.9.9")
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+		recs, err := store.Records(t.Context(), 1, 2)
+		require.NoError(t, err)
+		require.Equal(t, want[1:], recs)
+
+		// Ranges may extend beyond the last record.
+		recs, err = store.Records(t.Context(), 2, 10)
+		require.NoError(t, err)
+		require.Equal(t, want[2:], recs)
+
+		recs, err = store.Records(t.Context(), 3, 10)
+		require.NoError(t, err)
+		require.Empty(t, recs)
+	})
+
+	t.Run("case-sensitive paths", func(t *testing.T) {
+		// Paths differing only in case are different modules, so stores must not compare them case-insensitively.
+		// See sumdb.EscapeModule.
+		store := newStore(t)
+		paths := []string{"example.com/Azure/sdk", "example.com/azure/sdk", "example.com/azure/SDK"}
+		for i, path := range paths {
+			id, err := store.AddRecord(t.Context(), &sumdb.Record{Path: path, Version: "v1.0.0-RC1", Data: []byte(path)})
+			require.NoError(t, err, path)
+			require.Equal(t, int64(i), id, path)
+		}
+
+		for i, path := range paths {
+			id, err := store.RecordID(t.Context(), path, "v1.0.0-RC1")
+			require.NoError(t, err, path)
+			require.Equal(t, int64(i), id, path)
+		}
+
+		_, err := store.RecordID(t.Context(), "example.com/AZURE/sdk", "v1.0.0-RC1")
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+		_, err = store.RecordID(t.Context(), paths[0], "v1.0.0-rc1")
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+	})
+
+	t.Run("record data", func(t *testing.T) {
+		// Record data must be returned byte for byte, since the tree's hashes are computed over it. In particular,
+		// stores must not trim its trailing newline.
+		store := newStore(t)
+		data := []byte("example.com/data v1.0.0 h1:zip=\nexample.com/data v1.0.0/go.mod h1:mod=\n")
+		_, err := store.AddRecord(t.Context(), &sumdb.Record{Path: "example.com/data", Version: "v1.0.0", Data: data})
+		require.NoError(t, err)
+
+		recs, err := store.Records(t.Context(), 0, 1)
+		require.NoError(t, err)
+		require.Len(t, recs, 1)
+		require.Equal(t, data, recs[0].Data)
+	})
+
+	t.Run("hashes", func(t *testing.T) {
+		store := newStore(t)
+
+		indexes := []int64{0, 1, 2, 1000}
+		hashes := make([]tlog.Hash, len(indexes))
+		for i := range hashes {
+			hashes[i] = tlog.RecordHash(fmt.Appendf(nil, "hash %d\n", i))
+		}
+		require.NoError(t, store.WriteHashes(t.Context(), indexes, hashes))
+
+		got, err := store.ReadHashes(t.Context(), []int64{1000, 0, 2})
+		require.NoError(t, err)
+		require.Equal(t, []tlog.Hash{hashes[3], hashes[0], hashes[2]}, got)
+
+		_, err = store.ReadHashes(t.Context(), []int64{0, 3})
+		require.ErrorIs(t, err, sumdb.ErrMissingHash)
+	})
+
+	t.Run("tree size", func(t *testing.T) {
+		store := newStore(t)
+		require.NoError(t, store.SetTreeSize(t.Context(), 42))
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(42), size)
+	})
+
+	t.Run("tree", func(t *testing.T) {
+		store := newStore(t)
+		require.NoError(t, Populate(t.Context(), store, 300))
+
+		// The stored hashes must produce the same tree as the records.
+		hashes := make(hashMap)
+		for i := range int64(300) {
+			stored, err := tlog.StoredHashes(i, benchRecord(i).Data, hashes)
+			require.NoError(t, err)
+			for j, h := range stored {
+				hashes[tlog.StoredHashIndex(0, i)+int64(j)] = h
+			}
+		}
+		want, err := tlog.TreeHash(300, hashes)
+		require.NoError(t, err)
+
+		got, err := tree.TreeHash(t.Context(), store)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("transactions", func(t *testing.T) {
+		store, ok := newStore(t).(sumdb.TxStore)
+		if !ok {
+			t.Skip("store doesn't implement sumdb.TxStore")
+		}
+
+		rec := benchRecord(0)
+		err := store.WithTx(t.Context(), func(tx sumdb.Store) error {
+			if _, err := tx.AddRecord(t.Context(), rec); err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		})
+		require.EqualError(t, err, "rollback")
+
+		_, err = store.RecordID(t.Context(), rec.Path, rec.Version)
+		require.ErrorIs(t, err, sumdb.ErrNotFound)
+
+		require.NoError(t, store.WithTx(t.Context(), func(tx sumdb.Store) error {
+			return appendRecord(t.Context(), tx, 0)
+		}))
+
+		id, err := store.RecordID(t.Context(), rec.Path, rec.Version)
+		require.NoError(t, err)
+		require.Zero(t, id)
+
+		size, err := store.TreeSize(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int64(1), size)
+	})
+	t.Run("format version", func(t *testing.T) {
+		store, ok := newStore(t).(sumdb.FormatStore)
+		if !ok {
+			t.Skip("store doesn't implement sumdb.FormatStore")
+		}
+
+		version, err := store.FormatVersion(t.Context())
+		require.NoError(t, err)
+		require.Zero(t, version)
+
+		require.NoError(t, store.SetFormatVersion(t.Context(), sumdb.FormatVersion))
+		version, err = store.FormatVersion(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, sumdb.FormatVersion, version)
+	})
+}
+
+// Populate appends generated records to store until its tree has size records. Records are appended in batches, in a
+// transaction when the store implements sumdb.TxStore.
+func Populate(ctx context.Context, store sumdb.Store, size int64) error {
+	from, err := store.TreeSize(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get tree size: %w", err)
+	}
+
+	const batchSize = 1000
+	for from < size {
+		to := min(from+batchSize, size)
+		err := withTx(ctx, store, func(tx sumdb.Store) error {
+			for id := from; id < to; id++ {
+				if err := appendRecord(ctx, tx, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		from = to
+	}
+	return nil
+}
+
+// appendRecord appends the generated record with the given ID, along with its hashes.
+func appendRecord(ctx context.Context, store sumdb.Store, id int64) error {
+	rec := benchRecord(id)
+	got, err := store.AddRecord(ctx, rec)
+	if err != nil {
+		return fmt.Errorf("failed to add record: %s@%s, %w", rec.Path, rec.Version, err)
+	}
+	if got != id {
+		return fmt.Errorf("store assigned ID %d to record %d", got, id)
+	}
+	return tree.AddRecord(ctx, store, id, rec.Data)
+}
+
+// benchRecord returns the generated record with the given ID.
+func benchRecord(id int64) *sumdb.Record {
+	path := fmt.Sprintf("example.com/storetest/mod%d", id)
+	h := tlog.RecordHash(fmt.Appendf(nil, "%d", id))
+	return &sumdb.Record{
+		Path:    path,
+		Version: "v1.0.0",
+		Data:    fmt.Appendf(nil, "%s v1.0.0 h1:%x=\n%s v1.0.0/go.mod h1:%x=\n", path, h[:16], path, h[16:]),
+	}
+}
+
+func withTx(ctx context.Context, store sumdb.Store, fn func(sumdb.Store) error) error {
+	if tx, ok := store.(sumdb.TxStore); ok {
+		return tx.WithTx(ctx, fn)
+	}
+	return fn(store)
+}
+
+// hashMap is a tlog.HashReader backed by a map.
+type hashMap map[int64]tlog.Hash
+
+func (m hashMap) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	out := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		h, ok := m[idx]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", sumdb.ErrMissingHash, idx)
+		}
+		out[i] = h
+	}
+	return out, nil
+}
@@ -0,0 +1,136 @@
+package storetest_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pseudomuto/sumdb"
+	. "github.com/pseudomuto/sumdb/store/storetest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// mapStore is a minimal in-memory sumdb.Store.
+type mapStore struct {
+	mu      sync.Mutex
+	records []*sumdb.Record
+	hashes  map[int64]tlog.Hash
+	size    int64
+}
+
+func TestRun(t *testing.T) {
+	Run(t, newMapStore)
+}
+
+func TestRunBenchmarks(t *testing.T) {
+	benchTime := flag.Lookup("test.benchtime")
+	prev := benchTime.Value.String()
+	require.NoError(t, benchTime.Value.Set("20x"))
+	t.Cleanup(func() { _ = benchTime.Value.Set(prev) })
+
+	store := newMapStore(t).(*mapStore)
+	results, err := RunBenchmarks(t.Context(), store, BenchOptions{Sizes: []int64{100, 300}})
+	require.NoError(t, err)
+
+	names := make([]string, len(results))
+	for i, r := range results {
+		names[i] = r.Name
+		require.Positive(t, r.N, r.Name)
+	}
+	require.Equal(t, []string{
+		"size=100/ReadHashes/proof", "size=100/ReadHashes/tile", "size=100/Append",
+		"size=300/ReadHashes/proof", "size=300/ReadHashes/tile", "size=300/Append",
+	}, names)
+	require.Positive(t, results[2].Extra["records/s"])
+
+	// Read-only stores are only read at their current size.
+	results, err = RunBenchmarks(t.Context(), store, BenchOptions{ReadOnly: true})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.True(t, strings.HasPrefix(results[0].Name, fmt.Sprintf("size=%d/", len(store.records))))
+
+	_, err = RunBenchmarks(t.Context(), newMapStore(t), BenchOptions{ReadOnly: true})
+	require.Error(t, err)
+}
+
+func BenchmarkMapStore(b *testing.B) {
+	Benchmark(b, newMapStore)
+}
+
+func newMapStore(testing.TB) sumdb.Store {
+	return &mapStore{hashes: make(map[int64]tlog.Hash)}
+}
+
+func (s *mapStore) RecordID(_ context.Context, path, version string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.records {
+		if r.Path == path && r.Version == version {
+			return r.ID, nil
+		}
+	}
+	return 0, sumdb.ErrNotFound
+}
+
+func (s *mapStore) Records(_ context.Context, id, n int64) ([]*sumdb.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := min(id+n, int64(len(s.records)))
+	if id >= end {
+		return nil, nil
+	}
+	return s.records[id:end], nil
+}
+
+func (s *mapStore) AddRecord(_ context.Context, r *sumdb.Record) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := int64(len(s.records))
+	s.records = append(s.records, &sumdb.Record{ID: id, Path: r.Path, Version: r.Version, Data: r.Data})
+	return id, nil
+}
+
+func (s *mapStore) ReadHashes(_ context.Context, indexes []int64) ([]tlog.Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]tlog.Hash, len(indexes))
+	for i, idx := range indexes {
+		h, ok := s.hashes[idx]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", sumdb.ErrMissingHash, idx)
+		}
+		out[i] = h
+	}
+	return out, nil
+}
+
+func (s *mapStore) WriteHashes(_ context.Context, indexes []int64, hashes []tlog.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, idx := range indexes {
+		s.hashes[idx] = hashes[i]
+	}
+	return nil
+}
+
+func (s *mapStore) TreeSize(context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size, nil
+}
+
+func (s *mapStore) SetTreeSize(_ context.Context, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.size = size
+	return nil
+}
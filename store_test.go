@@ -1,9 +1,9 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/pseudomuto/sumdb (interfaces: Store,TxStore)
+// Source: github.com/pseudomuto/sumdb (interfaces: Store,TxStore,AuditStore)
 //
 // Generated by this command:
 //
-//	mockgen -destination=store_test.go -package=sumdb_test . Store,TxStore
+//	mockgen -destination=store_test.go -package=sumdb_test . Store,TxStore,AuditStore
 //
 
 // Package sumdb_test is a generated GoMock package.
@@ -285,3 +285,174 @@ func (mr *MockTxStoreMockRecorder) WriteHashes(ctx, indexes, hashes any) *gomock
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteHashes", reflect.TypeOf((*MockTxStore)(nil).WriteHashes), ctx, indexes, hashes)
 }
+
+// MockAuditStore is a mock of AuditStore interface.
+type MockAuditStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockAuditStoreMockRecorder is the mock recorder for MockAuditStore.
+type MockAuditStoreMockRecorder struct {
+	mock *MockAuditStore
+}
+
+// NewMockAuditStore creates a new mock instance.
+func NewMockAuditStore(ctrl *gomock.Controller) *MockAuditStore {
+	mock := &MockAuditStore{ctrl: ctrl}
+	mock.recorder = &MockAuditStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditStore) EXPECT() *MockAuditStoreMockRecorder {
+	return m.recorder
+}
+
+// AddAuditEntry mocks base method.
+func (m *MockAuditStore) AddAuditEntry(ctx context.Context, id int64, entry []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddAuditEntry", ctx, id, entry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddAuditEntry indicates an expected call of AddAuditEntry.
+func (mr *MockAuditStoreMockRecorder) AddAuditEntry(ctx, id, entry any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAuditEntry", reflect.TypeOf((*MockAuditStore)(nil).AddAuditEntry), ctx, id, entry)
+}
+
+// AddRecord mocks base method.
+func (m *MockAuditStore) AddRecord(ctx context.Context, r *sumdb.Record) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddRecord", ctx, r)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddRecord indicates an expected call of AddRecord.
+func (mr *MockAuditStoreMockRecorder) AddRecord(ctx, r any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRecord", reflect.TypeOf((*MockAuditStore)(nil).AddRecord), ctx, r)
+}
+
+// AuditEntries mocks base method.
+func (m *MockAuditStore) AuditEntries(ctx context.Context, id, n int64) ([][]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuditEntries", ctx, id, n)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AuditEntries indicates an expected call of AuditEntries.
+func (mr *MockAuditStoreMockRecorder) AuditEntries(ctx, id, n any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuditEntries", reflect.TypeOf((*MockAuditStore)(nil).AuditEntries), ctx, id, n)
+}
+
+// AuditSize mocks base method.
+func (m *MockAuditStore) AuditSize(ctx context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuditSize", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AuditSize indicates an expected call of AuditSize.
+func (mr *MockAuditStoreMockRecorder) AuditSize(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuditSize", reflect.TypeOf((*MockAuditStore)(nil).AuditSize), ctx)
+}
+
+// ReadHashes mocks base method.
+func (m *MockAuditStore) ReadHashes(ctx context.Context, indexes []int64) ([]tlog.Hash, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadHashes", ctx, indexes)
+	ret0, _ := ret[0].([]tlog.Hash)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadHashes indicates an expected call of ReadHashes.
+func (mr *MockAuditStoreMockRecorder) ReadHashes(ctx, indexes any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadHashes", reflect.TypeOf((*MockAuditStore)(nil).ReadHashes), ctx, indexes)
+}
+
+// RecordID mocks base method.
+func (m *MockAuditStore) RecordID(ctx context.Context, path, version string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordID", ctx, path, version)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecordID indicates an expected call of RecordID.
+func (mr *MockAuditStoreMockRecorder) RecordID(ctx, path, version any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordID", reflect.TypeOf((*MockAuditStore)(nil).RecordID), ctx, path, version)
+}
+
+// Records mocks base method.
+func (m *MockAuditStore) Records(ctx context.Context, id, n int64) ([]*sumdb.Record, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Records", ctx, id, n)
+	ret0, _ := ret[0].([]*sumdb.Record)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Records indicates an expected call of Records.
+func (mr *MockAuditStoreMockRecorder) Records(ctx, id, n any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Records", reflect.TypeOf((*MockAuditStore)(nil).Records), ctx, id, n)
+}
+
+// SetTreeSize mocks base method.
+func (m *MockAuditStore) SetTreeSize(ctx context.Context, size int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTreeSize", ctx, size)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTreeSize indicates an expected call of SetTreeSize.
+func (mr *MockAuditStoreMockRecorder) SetTreeSize(ctx, size any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTreeSize", reflect.TypeOf((*MockAuditStore)(nil).SetTreeSize), ctx, size)
+}
+
+// TreeSize mocks base method.
+func (m *MockAuditStore) TreeSize(ctx context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TreeSize", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TreeSize indicates an expected call of TreeSize.
+func (mr *MockAuditStoreMockRecorder) TreeSize(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TreeSize", reflect.TypeOf((*MockAuditStore)(nil).TreeSize), ctx)
+}
+
+// WriteHashes mocks base method.
+func (m *MockAuditStore) WriteHashes(ctx context.Context, indexes []int64, hashes []tlog.Hash) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteHashes", ctx, indexes, hashes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteHashes indicates an expected call of WriteHashes.
+func (mr *MockAuditStoreMockRecorder) WriteHashes(ctx, indexes, hashes any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteHashes", reflect.TypeOf((*MockAuditStore)(nil).WriteHashes), ctx, indexes, hashes)
+}
@@ -0,0 +1,49 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FormatVersion is the version of the format records, hashes and tree metadata are stored in. It's incremented
+// whenever a release changes what it stores in a way older releases can't read (or reads data older releases wrote
+// differently), and recorded in stores implementing FormatStore when New first uses them.
+const FormatVersion = 1
+
+// formatCheckTimeout bounds how long New waits for the store to report (or record) its format version.
+const formatCheckTimeout = 30 * time.Second
+
+// ErrIncompatibleStore is returned by New when the store was written in another FormatVersion: by a newer release, or
+// by an older one whose data hasn't been migrated.
+var ErrIncompatibleStore = errors.New("incompatible store format")
+
+// checkFormat verifies that the store, if it implements FormatStore, holds data in the current FormatVersion. Stores
+// without a recorded version (new ones, and those written before versions were recorded, which are in the first
+// format) are stamped with it.
+func (s *SumDB) checkFormat() error {
+	fs, ok := s.store.(FormatStore)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), formatCheckTimeout)
+	defer cancel()
+
+	version, err := fs.FormatVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read store format version: %w", err)
+	}
+
+	if version == 0 {
+		if err := fs.SetFormatVersion(ctx, FormatVersion); err != nil {
+			return fmt.Errorf("failed to record store format version: %d, %w", FormatVersion, err)
+		}
+		return nil
+	}
+	if version != FormatVersion {
+		return fmt.Errorf("%w: version %d, want %d", ErrIncompatibleStore, version, FormatVersion)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package sumdb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/stretchr/testify/require"
+)
+
+// failingFormatStore is a FormatStore failing to read its format version.
+type failingFormatStore struct {
+	*memstore.Store
+}
+
+func (failingFormatStore) FormatVersion(context.Context) (int, error) {
+	return 0, errors.New("boom")
+}
+
+func TestNew_FormatVersion(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	t.Run("records the version", func(t *testing.T) {
+		store := memstore.New()
+		_, err := New("test.example.com", skey, WithStore(store))
+		require.NoError(t, err)
+
+		version, err := store.FormatVersion(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, FormatVersion, version)
+
+		// Reopening a store in the current format works.
+		_, err = New("test.example.com", skey, WithStore(store))
+		require.NoError(t, err)
+	})
+
+	t.Run("newer versions", func(t *testing.T) {
+		store := memstore.New()
+		require.NoError(t, store.SetFormatVersion(t.Context(), FormatVersion+1))
+		_, err := New("test.example.com", skey, WithStore(store))
+		require.ErrorIs(t, err, ErrIncompatibleStore)
+	})
+
+	t.Run("read errors", func(t *testing.T) {
+		_, err := New("test.example.com", skey, WithStore(failingFormatStore{memstore.New()}))
+		require.ErrorContains(t, err, "boom")
+	})
+
+	t.Run("stores without versions", func(t *testing.T) {
+		_, err := New("test.example.com", skey, WithStore(newMemStore()))
+		require.NoError(t, err)
+	})
+}
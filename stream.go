@@ -0,0 +1,144 @@
+package sumdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// streamBatchSize is the maximum number of records read from the store at a time while streaming.
+	streamBatchSize = 100
+
+	// streamKeepAlive is how often idle streams receive a comment, keeping intermediaries from closing the connection.
+	// Streams also re-check the tree size at this interval in case records were added by another process.
+	streamKeepAlive = 15 * time.Second
+)
+
+// broadcaster notifies any number of waiters that an event has happened. The zero value is ready to use.
+type broadcaster struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// wait returns a channel that is closed on the next call to notify.
+func (b *broadcaster) wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ch == nil {
+		b.ch = make(chan struct{})
+	}
+	return b.ch
+}
+
+// notify wakes up all current waiters.
+func (b *broadcaster) notify() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ch != nil {
+		close(b.ch)
+		b.ch = nil
+	}
+}
+
+// serveAPIStream serves GET /records/stream as a stream of server-sent events, one "record" event per record starting
+// at the record ID given by the from query parameter (or the Last-Event-ID header when reconnecting), followed by new
+// records as they're appended.
+func (s *SumDB) serveAPIStream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	next, err := queryInt(r, "from", 0)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		id, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || id < 0 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid Last-Event-ID: %q", last))
+			return
+		}
+		next = id + 1
+	}
+
+	// Streams are long-lived, so they must not be cut off by the server's write timeout.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		// Register for notifications before reading the tree size so that appends in between aren't missed.
+		appended := s.appended.wait()
+
+		size, err := s.store.TreeSize(ctx)
+		if err != nil {
+			return
+		}
+
+		for next < size {
+			recs, err := s.store.Records(ctx, next, min(size-next, streamBatchSize))
+			if err != nil || len(recs) == 0 {
+				return
+			}
+
+			for _, rec := range recs {
+				if err := s.writeRecordEvent(w, next, rec); err != nil {
+					return
+				}
+				next++
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-appended:
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeRecordEvent writes the event for the record. With WithSignedResponses, the event's data followed by a newline
+// is signed, and the signature is sent in a signature field, which EventSource ignores.
+func (s *SumDB) writeRecordEvent(w http.ResponseWriter, id int64, rec *Record) error {
+	data, err := json.Marshal(newAPIRecord(id, rec))
+	if err != nil {
+		return err
+	}
+
+	var sig string
+	if s.signedResponses {
+		if sig, err = s.signResponse(append(data, '\n')); err != nil {
+			return err
+		}
+		sig = "signature: " + sig + "\n"
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: record\n%sdata: %s\n\n", id, sig, data)
+	return err
+}
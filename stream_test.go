@@ -0,0 +1,100 @@
+package sumdb_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestRecordStream(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	db, err := New("test.example.com", skey,
+		WithStore(newAnnotatedStore(t, 2)),
+		WithUpstream(upstream.upstream(t)),
+	)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(db.APIHandler())
+	t.Cleanup(srv.Close)
+
+	// stream connects to the record stream and returns a function that reads the next record event.
+	stream := func(t *testing.T, query string, header http.Header) func() (string, map[string]any) {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+"/records/stream"+query, nil)
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		scanner := bufio.NewScanner(resp.Body)
+		return func() (string, map[string]any) {
+			var id string
+			var data map[string]any
+			for scanner.Scan() {
+				line := scanner.Text()
+				switch {
+				case line == "":
+					return id, data
+				case strings.HasPrefix(line, "id: "):
+					id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "data: "):
+					require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data))
+				}
+			}
+			require.NoError(t, scanner.Err())
+			return "", nil
+		}
+	}
+
+	t.Run("streams existing and new records", func(t *testing.T) {
+		next := stream(t, "", nil)
+
+		id, rec := next()
+		require.Equal(t, "0", id)
+		require.Equal(t, "example.com/mod0", rec["path"])
+
+		id, rec = next()
+		require.Equal(t, "1", id)
+		require.Equal(t, "example.com/mod1", rec["path"])
+
+		_, err := db.Lookup(t.Context(), module.Version{Path: "example.com/new", Version: "v1.0.0"})
+		require.NoError(t, err)
+
+		id, rec = next()
+		require.Equal(t, "2", id)
+		require.Equal(t, "example.com/new", rec["path"])
+		require.Equal(t, "v1.0.0", rec["version"])
+		require.Contains(t, rec["data"], "example.com/new v1.0.0/go.mod h1:")
+	})
+
+	t.Run("resumes from", func(t *testing.T) {
+		id, _ := stream(t, "?from=1", nil)()
+		require.Equal(t, "1", id)
+
+		id, _ = stream(t, "", http.Header{"Last-Event-Id": {"1"}})()
+		require.Equal(t, "2", id)
+	})
+
+	t.Run("invalid from", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		db.APIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records/stream?from=x", nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,295 @@
+package sumdb_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/store/memstore"
+	"github.com/pseudomuto/sumdb/store/sqlite"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// TestStress hammers a SumDB with concurrent lookups, tree head and tile reads, and imports, checking that the tree is
+// verifiable after every phase. It's meant to be run with -race (see the test:stress task) whenever the concurrency
+// of appends or reads changes, and is skipped in short mode.
+func TestStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress tests are skipped in short mode")
+	}
+
+	stores := map[string]func(t *testing.T) Store{
+		"memstore": func(*testing.T) Store { return memstore.New() },
+		"sqlite": func(t *testing.T) Store {
+			store, err := sqlite.Open(t.Context(), filepath.Join(t.TempDir(), "sumdb.db"))
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = store.Close() })
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			runStress(t, newStore(t))
+		})
+	}
+}
+
+const (
+	// stressWorkers is the number of goroutines looking up modules during a stress phase.
+	stressWorkers = 8
+
+	// stressReaders is the number of goroutines verifying records during a stress phase. Verification is CPU bound, so
+	// more readers mostly slow the phase down.
+	stressReaders = 2
+
+	// stressModules is the number of distinct modules looked up per phase. Workers look up overlapping sets of them,
+	// so that concurrent lookups of the same module are deduplicated.
+	stressModules = 64
+)
+
+func runStress(t *testing.T, store Store) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	db, err := New("test.example.com", skey, WithStore(store), WithUpstream(newFakeProxy(t).upstream(t)))
+	require.NoError(t, err)
+
+	v := &stressVerifier{db: db}
+	v.verifier, err = note.NewVerifier(vkey)
+	require.NoError(t, err)
+
+	snapshot := t.TempDir()
+	writeTileSnapshot(t, snapshot, skey, 600)
+
+	phases := []struct {
+		name string
+		run  func(ctx context.Context, phase int) error
+	}{
+		{name: "lookups", run: func(ctx context.Context, phase int) error { return stressLookups(ctx, db, phase) }},
+		{name: "import", run: func(ctx context.Context, _ int) error {
+			_, err := db.ImportTiles(ctx, snapshot, vkey)
+			return err
+		}},
+		{name: "lookups and import", run: func(ctx context.Context, phase int) error {
+			errs := make(chan error, 2)
+			go func() { errs <- stressLookups(ctx, db, phase) }()
+			go func() {
+				_, err := db.ImportTiles(ctx, snapshot, vkey)
+				errs <- err
+			}()
+			return firstError(<-errs, <-errs)
+		}},
+	}
+
+	for i, phase := range phases {
+		// Readers verify tree heads, proofs and tiles while the phase runs.
+		ctx, cancel := context.WithCancel(t.Context())
+		var wg sync.WaitGroup
+		readErrs := make([]error, stressReaders)
+		for w := range readErrs {
+			wg.Go(func() {
+				for ctx.Err() == nil {
+					if err := v.verifyRandomRecord(ctx); err != nil && ctx.Err() == nil {
+						readErrs[w] = err
+						return
+					}
+				}
+			})
+		}
+
+		err := phase.run(t.Context(), i)
+		cancel()
+		wg.Wait()
+		require.NoError(t, err, phase.name)
+		require.NoError(t, firstError(readErrs...), phase.name)
+
+		v.verifyTree(t)
+	}
+}
+
+// stressLookups looks up the phase's modules from stressWorkers goroutines, each starting at a different module.
+func stressLookups(ctx context.Context, db *SumDB, phase int) error {
+	var wg sync.WaitGroup
+	errs := make([]error, stressWorkers)
+	for w := range errs {
+		wg.Go(func() {
+			for i := range stressModules {
+				mod := module.Version{
+					Path:    fmt.Sprintf("example.com/stress%d/mod%d", phase, (w*stressModules/stressWorkers+i)%stressModules),
+					Version: "v1.0.0",
+				}
+
+				id, err := db.Lookup(ctx, mod)
+				if err != nil {
+					errs[w] = err
+					return
+				}
+
+				// The record looked up must be the module's.
+				data, err := db.ReadRecords(ctx, id, 1)
+				if err != nil {
+					errs[w] = err
+					return
+				}
+				if want := mod.Path + " " + mod.Version + " "; len(data) != 1 || string(data[0][:len(want)]) != want {
+					errs[w] = fmt.Errorf("record %d isn't %s: %q", id, mod, data)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+	return firstError(errs...)
+}
+
+// stressVerifier checks the tree served by a SumDB the way go clients would: through its handler, authenticating
+// tiles against signed tree heads.
+type stressVerifier struct {
+	db       *SumDB
+	verifier note.Verifier
+
+	mu   sync.Mutex
+	last tlog.Tree // the last tree verified by verifyTree
+}
+
+// latest fetches and verifies the signed tree head.
+func (v *stressVerifier) latest(ctx context.Context) (tlog.Tree, error) {
+	msg, err := v.get(ctx, "/latest")
+	if err != nil {
+		return tlog.Tree{}, err
+	}
+
+	n, err := note.Open(msg, note.VerifierList(v.verifier))
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("failed to verify tree head: %w", err)
+	}
+	return tlog.ParseTree([]byte(n.Text))
+}
+
+// verifyRandomRecord proves that a random record is in the latest tree, reading hashes from the tiles it serves.
+func (v *stressVerifier) verifyRandomRecord(ctx context.Context) error {
+	tree, err := v.latest(ctx)
+	if err != nil || tree.N == 0 {
+		return err
+	}
+
+	id := rand.Int64N(tree.N)
+	data, err := v.db.ReadRecords(ctx, id, 1)
+	if err != nil {
+		return err
+	}
+
+	hr := tlog.TileHashReader(tree, &stressTileReader{ctx: ctx, v: v})
+	proof, err := tlog.ProveRecord(tree.N, id, hr)
+	if err != nil {
+		return fmt.Errorf("failed to prove record %d in tree %d: %w", id, tree.N, err)
+	}
+	if err := tlog.CheckRecord(proof, tree.N, tree.Hash, id, tlog.RecordHash(data[0])); err != nil {
+		return fmt.Errorf("failed to check record %d in tree %d: %w", id, tree.N, err)
+	}
+	return nil
+}
+
+// verifyTree checks that the latest tree head matches the records, that every tile it serves is authentic and that
+// the tree is consistent with the one verified before.
+func (v *stressVerifier) verifyTree(t *testing.T) {
+	t.Helper()
+	ctx := t.Context()
+
+	tree, err := v.latest(ctx)
+	require.NoError(t, err)
+
+	recs, err := readRecords(ctx, v.db, 0, tree.N)
+	require.NoError(t, err)
+	require.Len(t, recs, int(tree.N))
+
+	seen := make(map[string]bool, len(recs))
+	hashes := make(hashMap)
+	for i, rec := range recs {
+		key, _, _ := strings.Cut(string(rec), " h1:")
+		require.False(t, seen[key], "duplicate record %d", i)
+		seen[key] = true
+
+		stored, err := tlog.StoredHashes(int64(i), rec, hashes)
+		require.NoError(t, err)
+		for j, h := range stored {
+			hashes[tlog.StoredHashIndex(0, int64(i))+int64(j)] = h
+		}
+	}
+
+	want, err := tlog.TreeHash(tree.N, hashes)
+	require.NoError(t, err)
+	require.Equal(t, want, tree.Hash, "tree hash of %d records", tree.N)
+
+	tr := &stressTileReader{ctx: ctx, v: v}
+	for _, tile := range tlog.NewTiles(8, 0, tree.N) {
+		data, err := tlog.ReadTileData(tile, hashes)
+		require.NoError(t, err)
+
+		got, err := tr.ReadTiles([]tlog.Tile{tile})
+		require.NoError(t, err)
+		require.Equal(t, data, got[0], tile.Path())
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.last.N > 0 {
+		proof, err := tlog.ProveTree(tree.N, v.last.N, hashes)
+		require.NoError(t, err)
+		require.NoError(t, tlog.CheckTree(proof, tree.N, tree.Hash, v.last.N, v.last.Hash))
+	}
+	v.last = tree
+}
+
+func (v *stressVerifier) get(ctx context.Context, path string) ([]byte, error) {
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	v.db.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %d %s", path, rec.Code, rec.Body)
+	}
+	return rec.Body.Bytes(), nil
+}
+
+// stressTileReader is a tlog.TileReader reading tiles from a SumDB's handler.
+type stressTileReader struct {
+	ctx context.Context
+	v   *stressVerifier
+}
+
+func (r *stressTileReader) Height() int { return 8 }
+
+func (r *stressTileReader) ReadTiles(tiles []tlog.Tile) ([][]byte, error) {
+	data := make([][]byte, len(tiles))
+	for i, tile := range tiles {
+		var err error
+		if data[i], err = r.v.get(r.ctx, "/"+tile.Path()); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (r *stressTileReader) SaveTiles([]tlog.Tile, [][]byte) {}
+
+// firstError returns the first non-nil error.
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
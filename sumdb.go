@@ -3,49 +3,342 @@ package sumdb
 import (
 	"context"
 	"crypto/rand"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
+	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/pseudomuto/sumdb/alert"
+	"github.com/pseudomuto/sumdb/internal/lru"
 	"github.com/pseudomuto/sumdb/internal/proxy"
 	"github.com/pseudomuto/sumdb/internal/signer"
+	"github.com/pseudomuto/sumdb/internal/spool"
+	"github.com/pseudomuto/sumdb/internal/sumdbclient"
+	"github.com/pseudomuto/sumdb/internal/tracing"
 	"github.com/pseudomuto/sumdb/internal/tree"
 	"golang.org/x/mod/module"
-	"golang.org/x/mod/sumdb"
 	"golang.org/x/mod/sumdb/note"
 	"golang.org/x/mod/sumdb/tlog"
 	"golang.org/x/sync/singleflight"
 )
 
+// ErrSpoolFull is returned by lookups when spooling the module's zip would exceed the quota configured with
+// WithSpool.
+var ErrSpoolFull = spool.ErrFull
+
 // SumDB is a checksum database server that implements the Go sumdb protocol.
 //
 // It implements the ServerOpts interface defined in https://pkg.go.dev/golang.org/x/mod@v0.31.0/sumdb#ServerOps.
 type SumDB struct {
-	http     *http.Client
-	proxy    *proxy.Proxy
-	store    Store
-	signer   note.Signer
-	upstream string
+	adminIdentity IdentityExtractor
+	clock         Clock
+	http          *http.Client
+	proxy         *proxy.Proxy
+	store         Store
+	signer        note.Signer
+	upstream      string
+	vkey          string
+
+	// keySigner signs tree heads instead of the key given to New, e.g. with a key held in a KMS. See WithSigner.
+	keySigner note.Signer
+
+	// cosigners also sign tree heads, e.g. the old or new key during a key rotation. See WithAdditionalSigner.
+	additionalKeys []string
+	cosigners      []note.Signer
+
+	// secondary is a second, independent upstream that must agree with the primary. See WithSecondaryUpstream.
+	secondary         *proxy.Proxy
+	secondaryUpstream string
+	quarantine        quarantine
+
+	// trustedSumDB and trustedVKey identify the checksum database lookup misses are satisfied from by default. See
+	// WithTrustedSumDB.
+	trustedSumDB string
+	trustedVKey  string
+
+	// upstreamSumDB is the checksum database that records hashed from the upstream proxy are checked against, and
+	// upstreamSumDBURL and upstreamSumDBKey identify it. See WithUpstreamSumDB.
+	upstreamSumDB    *sumdbclient.Client
+	upstreamSumDBURL string
+	upstreamSumDBKey string
+
+	// routes choose where the records of matching modules come from, with defaultRoute for the others. See
+	// WithIngestRoutes.
+	ingestRoutes []IngestRoute
+	routes       []*ingestRoute
+	defaultRoute *ingestRoute
+
+	// dialer, resolver and pinnedAddrs control how upstream hosts are resolved and dialed. See WithDialer,
+	// WithResolver and WithUpstreamAddrs.
+	dialer      DialFunc
+	resolver    *net.Resolver
+	pinnedAddrs map[string][]string
+
+	// upstreamRootCAs and spkiPins control which certificates the upstream proxies may present. See
+	// WithUpstreamRootCAs and WithUpstreamSPKIPins.
+	upstreamRootCAs *x509.CertPool
+	spkiPins        []string
+
+	// upstreamIdentity derives the credentials upstream requests made on behalf of clients are sent with. See
+	// WithUpstreamIdentity.
+	upstreamIdentity UpstreamIdentity
+
+	// alerters receive integrity alerts. See WithAlerter.
+	alerters []alert.Alerter
+
+	// corsOrigins are the origins allowed to make cross-origin requests. See WithCORS.
+	corsOrigins []string
+
+	// signedResponses signs JSON API responses. See WithSignedResponses.
+	signedResponses bool
+
+	// denyAfter refuses new records for versions published after a cutoff. See WithDenyAfter.
+	denyAfter []denyAfterRule
+
+	// typosquat warns about first-seen paths similar to popular ones. See WithTyposquatDetector.
+	typosquat *typosquatDetector
+
+	// pathVerifier verifies the ownership of first-seen module paths. See WithPathVerifier.
+	pathVerifier PathVerifier
+
+	// onReplay, when set, receives a ReplayBundle for every cold lookup.
+	onReplay func(*ReplayBundle)
+
+	// recordingProxyOpts configure the proxies recording lookups for replays. See recordingUpstreams.
+	recordingProxyOpts []proxy.Option
+
+	// metrics are served by MetricsHandler.
+	metrics *serverMetrics
+
+	// publishTimes fetches the .info of every version hashed from a proxy. See WithPublishTimes.
+	publishTimes bool
+
+	// lookupBudget is how long /lookup waits for a record to be created. See WithLookupBudget.
+	lookupBudget time.Duration
+
+	// lookupCache holds formatted lookup records keyed by module@version.
+	lookupCache *lru.Cache[string, lookupEntry]
+
+	// publishers receive append events from the store's outbox. See WithPublisher.
+	publishers []Publisher
+
+	// spool manages the temporary files zips are spooled to. See WithSpool.
+	spool        *spool.Manager
+	spoolDir     string
+	spoolMaxSize int64
+
+	// zipRangeChunkSize and zipRangeWorkers configure range requests for zips. See WithZipRangeRequests.
+	zipRangeChunkSize int64
+	zipRangeWorkers   int
+
+	// proxyRetryAttempts, proxyRetryBase and proxyRetryMax configure the retries of failed proxy requests. See
+	// WithProxyRetry.
+	proxyRetryAttempts int
+	proxyRetryBase     time.Duration
+	proxyRetryMax      time.Duration
+
+	// maintenance runs the maintenance jobs configured with WithMaintenanceJob, along with the store's and built-in
+	// ones, within the windows configured with WithMaintenanceWindow. See RunMaintenance.
+	maintenance        *maintenance
+	maintenanceJobs    []MaintenanceJob
+	maintenanceWindows []string
+
+	// notFound caches module versions the upstream doesn't have. See WithNegativeCache.
+	notFound *negativeCache
+
+	// failback tracks the health of the upstreams. See WithUpstreamFailback.
+	failback *upstreamFailback
+
+	// tileCache caches served tiles. See WithTileCache.
+	tileCache *tileCache
+
+	// logger logs the server's events, and loggedTreeSize is the largest tree size it logged (-1 before the first).
+	// See WithLogger.
+	logger         *slog.Logger
+	loggedTreeSize atomic.Int64
+
+	// tracer starts the spans of traced operations. See WithTracerProvider.
+	tracer Tracer
+
+	// recordFilter rules out module versions without records before the store is queried. See WithRecordFilter.
+	recordFilter *recordFilter
+
+	// sth caches the most recently signed tree head. See WithSTHMaxStaleness and WithSTHRefreshInterval.
+	sthMu              sync.Mutex
+	sth                *signedHead
+	sthMaxStaleness    time.Duration
+	sthRefreshInterval time.Duration
 
 	// lookupGroup deduplicates concurrent proxy fetches for the same module.
 	lookupGroup singleflight.Group
 
-	// writeMu serializes record creation to ensure tree consistency.
+	// detachedLookupTimeout bounds fetches detached from the lookups waiting for them. See WithDetachedLookups.
+	detachedLookupTimeout time.Duration
+
+	// maxReadRecords and maxDataTileSize limit the records returned by ReadRecords and the size of served data tiles.
+	// See WithReadLimits.
+	maxReadRecords  int64
+	maxDataTileSize int
+
+	// maxRecordSize limits the size of appended records' data. See WithMaxRecordSize.
+	maxRecordSize int
+
+	// verifyWorkers is the number of workers authenticating records during bulk ingestion.
+	verifyWorkers int
+
+	// fetchWorkers is the number of modules fetched concurrently by AddRecords, and fetchLanes the pool they share
+	// with batch lookups. See WithPriority.
+	fetchWorkers int
+	fetchLanes   lanes
+
+	// auditMu serializes audit log appends, since each entry is chained to the previous one.
+	auditMu     sync.Mutex
+	auditKey    string
+	auditSigner note.Signer
+
+	// appended is notified whenever records are added to the tree.
+	appended broadcaster
+
+	// appendLimit caps the rate at which records are appended. See WithAppendLimit.
+	appendLimit    *appendLimiter
+	appendLimitN   int
+	appendLimitPer time.Duration
+
+	// upstreamLimit caps the rate at which modules are fetched from the upstreams. See WithUpstreamRateLimit.
+	upstreamLimit      *upstreamLimiter
+	upstreamLimitRate  float64
+	upstreamLimitBurst int
+
+	// appendQueue serializes record creation to ensure tree consistency, letting interactive appends go first.
 	// Each record's position in the Merkle tree depends on the current TreeSize,
 	// so concurrent inserts of different modules must be serialized.
-	writeMu sync.Mutex
+	appendQueue lanes
+
+	// locker serializes appends across instances sharing the store. See WithLocker.
+	locker Locker
+
+	// pipeline is the record pipeline's plugins, in order. See WithRecordPipeline.
+	pipeline []RecordPipeline
+
+	// appendHooks are called within the transaction appending each record. See WithAppendHook.
+	appendHooks []AppendHook
+
+	// recheckSampleSize records are rechecked every recheckInterval. See WithRecheckSampling.
+	recheckSampleSize int
+	recheckInterval   time.Duration
+	rechecked         recheckCoverage
 }
 
 // New creates a new SumDB instance with the given server name and signing key.
 // The name identifies this sumdb (e.g., "sum.example.com").
-// The skey must be in note signer format: "PRIVATE+KEY+<name>+<hash>+<keydata>".
+// The skey must be in note signer format: "PRIVATE+KEY+<name>+<hash>+<keydata>", unless a signer is set with
+// WithSigner, in which case skey is ignored and may be empty.
 //
 // NB: You can use GenerateKeys to create a valid signing key.
 func New(name string, skey string, opts ...Option) (*SumDB, error) {
+	db := newSumDB()
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	s, vkey, err := db.serverSigner(skey)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := db.store.(OutboxStore); len(db.publishers) > 0 && !ok {
+		return nil, ErrOutboxUnsupported
+	}
+
+	if _, ok := db.store.(AuditStore); !ok {
+		if db.auditKey != "" {
+			return nil, ErrAuditUnsupported
+		}
+		if db.adminIdentity != nil {
+			db.logger.Warn("admin operations won't be audited: the store doesn't implement AuditStore")
+		}
+	}
+
+	if err := db.checkFormat(); err != nil {
+		return nil, err
+	}
+
+	db.fetchLanes.capacity = db.fetchWorkers
+
+	if db.appendLimitN > 0 {
+		db.appendLimit = newAppendLimiter(db.appendLimitN, db.appendLimitPer, db.clock)
+	}
+
+	if db.upstreamLimitRate > 0 {
+		db.upstreamLimit = newUpstreamLimiter(db.upstreamLimitRate, db.upstreamLimitBurst, db.clock)
+	}
+
+	if db.spoolDir != "" || db.spoolMaxSize > 0 {
+		if db.spool, err = spool.New(db.spoolDir, db.spoolMaxSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.configureTransport(); err != nil {
+		return nil, err
+	}
+	db.configureIdentity()
+
+	// Proxies recording lookups for replays are configured like the others, except that they don't make range requests.
+	db.recordingProxyOpts = []proxy.Option{
+		proxy.WithSpool(db.spool),
+		proxy.WithClock(db.clock.Now, func(ctx context.Context, d time.Duration) bool { return sleep(ctx, db.clock, d) }),
+	}
+	if db.proxyRetryAttempts > 1 {
+		db.recordingProxyOpts = append(db.recordingProxyOpts,
+			proxy.WithRetry(db.proxyRetryAttempts, db.proxyRetryBase, db.proxyRetryMax))
+	}
+
+	proxyOpts := slices.Clone(db.recordingProxyOpts)
+	if db.zipRangeChunkSize > 0 {
+		proxyOpts = append(proxyOpts, proxy.WithRangeRequests(db.zipRangeChunkSize, db.zipRangeWorkers))
+	}
+
+	db.proxy = proxy.New(db.http, db.upstream, proxyOpts...)
+	if db.secondaryUpstream != "" {
+		db.secondary = proxy.New(db.http, db.secondaryUpstream, proxyOpts...)
+	}
+
+	if err := db.configureRoutes(proxyOpts); err != nil {
+		return nil, err
+	}
+
+	if db.maintenance, err = db.newMaintenance(); err != nil {
+		return nil, err
+	}
+	db.signer = s
+	db.auditSigner = s
+	db.vkey = vkey
+
+	if err := db.configureCosigners(); err != nil {
+		return nil, err
+	}
+
+	if db.auditKey != "" {
+		if db.auditSigner, err = signer.NewSigner(db.auditKey); err != nil {
+			return nil, fmt.Errorf("invalid audit signer key: %w", err)
+		}
+	}
+
+	return db, nil
+}
+
+// newSumDB returns a SumDB with the defaults that options override. See New.
+func newSumDB() *SumDB {
 	db := &SumDB{
+		clock: systemClock{},
 		http: &http.Client{
 			Timeout: 10 * time.Second,
 			Transport: &http.Transport{
@@ -55,20 +348,77 @@ func New(name string, skey string, opts ...Option) (*SumDB, error) {
 				TLSHandshakeTimeout: 2 * time.Second,
 			},
 		},
-		upstream: "https://proxy.golang.org",
+		upstream:      "https://proxy.golang.org",
+		logger:        slog.New(slog.DiscardHandler),
+		metrics:       newServerMetrics(),
+		lookupCache:   lru.New[string, lookupEntry](0),
+		notFound:      newNegativeCache(0, 0, 0),
+		failback:      newUpstreamFailback(0, 0),
+		verifyWorkers: runtime.GOMAXPROCS(0),
+		fetchWorkers:  defaultFetchWorkers,
+
+		maxReadRecords:  maxTileWidth,
+		maxDataTileSize: defaultMaxDataTileSize,
+		maxRecordSize:   DefaultMaxRecordSize,
 	}
-	for _, opt := range opts {
-		opt(db)
+	db.loggedTreeSize.Store(-1)
+	return db
+}
+
+// serverSigner returns the signer of the server's tree heads, and its verifier key: the one set with WithSigner, or
+// the one for skey.
+func (s *SumDB) serverSigner(skey string) (note.Signer, string, error) {
+	if s.keySigner == nil {
+		ns, err := signer.NewSigner(skey)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid signer key: %w", err)
+		}
+
+		vkey, err := signer.VerifierKey(skey)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid signer key: %w", err)
+		}
+		return ns, vkey, nil
 	}
 
-	s, err := signer.NewSigner(skey)
+	keyer, ok := s.keySigner.(interface{ VerifierKey() string })
+	if !ok {
+		return nil, "", errors.New("invalid signer: no VerifierKey method")
+	}
+
+	vkey := keyer.VerifierKey()
+	v, err := signer.NewVerifier(vkey)
 	if err != nil {
-		return nil, fmt.Errorf("invalid signer key: %w", err)
+		return nil, "", fmt.Errorf("invalid signer: %w", err)
+	}
+	if v.Name() != s.keySigner.Name() || v.KeyHash() != s.keySigner.KeyHash() {
+		return nil, "", fmt.Errorf("invalid signer: verifier key doesn't match: %s", vkey)
 	}
+	return s.keySigner, vkey, nil
+}
 
-	db.proxy = proxy.New(db.http, db.upstream)
-	db.signer = s
-	return db, nil
+// configureCosigners creates the signers of the keys given to WithAdditionalSigner. Every key, including the server's
+// own, must be distinct, since notes can't carry two signatures by the same key.
+func (s *SumDB) configureCosigners() error {
+	seen := map[string]bool{s.vkey: true}
+	for _, skey := range s.additionalKeys {
+		cosigner, err := signer.NewSigner(skey)
+		if err != nil {
+			return fmt.Errorf("invalid additional signer key: %w", err)
+		}
+
+		vkey, err := signer.VerifierKey(skey)
+		if err != nil {
+			return fmt.Errorf("invalid additional signer key: %w", err)
+		}
+		if seen[vkey] {
+			return fmt.Errorf("duplicate signer key: %s", vkey)
+		}
+		seen[vkey] = true
+
+		s.cosigners = append(s.cosigners, cosigner)
+	}
+	return nil
 }
 
 // GenerateKeys creates a new keypair and returns the encoded signer key,
@@ -87,25 +437,34 @@ func GenerateKeys(name string) (string, string, error) {
 	return skey, vkey, nil
 }
 
-// Handler returns an HTTP handler for serving the sumdb over HTTP.
-func (s *SumDB) Handler() http.Handler {
-	return sumdb.NewServer(s)
+// VerifierKey returns the verifier key for the signer key the SumDB was created with, which clients use to verify
+// its signed tree heads.
+func (s *SumDB) VerifierKey() string {
+	return s.vkey
 }
 
 // Signed returns the signed tree head for the current tree state.
+//
+// The last signed tree head is cached until records are appended (by this server or any other sharing its store), so
+// only the first call after an append computes the tree hash. RunSTHRefresher computes it ahead of time.
+//
+// If WithSTHMaxStaleness is configured, a cached tree head may be returned as long as it is within the allowed
+// staleness window.
 func (s *SumDB) Signed(ctx context.Context) ([]byte, error) {
-	size, err := s.store.TreeSize(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get tree size: %w", err)
-	}
+	return s.signed(ctx, 0)
+}
+
+// signTreeHead computes and signs the tree head for the tree of the given size.
+func (s *SumDB) signTreeHead(ctx context.Context, size int64) (_ []byte, err error) {
+	ctx, span := s.startSpan(ctx, "sumdb.SignTreeHead", tracing.Int64("tree.size", size))
+	defer func() { tracing.End(span, err) }()
 
-	hash, err := tree.TreeHash(ctx, s.store)
+	hash, err := tree.TreeHashAt(ctx, s.store, size)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compute tree hash: %w", err)
 	}
 
-	t := tlog.Tree{N: size, Hash: hash}
-	signed, err := signer.SignTreeHead(s.signer, t)
+	signed, err := s.signTree(ctx, tlog.Tree{N: size, Hash: hash})
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign tree head: %w", err)
 	}
@@ -113,8 +472,20 @@ func (s *SumDB) Signed(ctx context.Context) ([]byte, error) {
 	return signed, nil
 }
 
+// signTree signs the tree head for t with the server's key and any cosigners.
+func (s *SumDB) signTree(ctx context.Context, t tlog.Tree) ([]byte, error) {
+	signed, err := signer.SignTreeHead(s.signer, t, s.cosigners...)
+	s.logSigned(ctx, t, err)
+	return signed, err
+}
+
 // ReadRecords returns the raw data for records with IDs in [id, id+n).
+// Reading more than 256 records (or the limit set with WithReadLimits) returns ErrReadLimitExceeded.
 func (s *SumDB) ReadRecords(ctx context.Context, id, n int64) ([][]byte, error) {
+	if n > s.maxReadRecords {
+		return nil, fmt.Errorf("%w: %d records, max %d", ErrReadLimitExceeded, n, s.maxReadRecords)
+	}
+
 	recs, err := s.store.Records(ctx, id, n)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get records: [%d, %d), %w", id, n, err)
@@ -132,75 +503,172 @@ func (s *SumDB) ReadRecords(ctx context.Context, id, n int64) ([][]byte, error)
 // If the record doesn't exist, it fetches the module from the upstream proxy,
 // computes the checksums, and stores the new record with its tree hashes.
 // Concurrent lookups for the same module are deduplicated via singleflight.
-func (s *SumDB) Lookup(ctx context.Context, mod module.Version) (int64, error) {
-	// Fast path - record already exists
-	id, err := s.store.RecordID(ctx, mod.Path, mod.Version)
-	if err == nil {
-		return id, nil
+func (s *SumDB) Lookup(ctx context.Context, mod module.Version) (_ int64, err error) {
+	ctx, span := s.startSpan(ctx, "sumdb.Lookup", moduleAttrs(mod)...)
+	start := s.clock.Now()
+	cold := false
+	defer func() {
+		span.SetAttributes(tracing.Bool("sumdb.lookup.cold", cold))
+		tracing.End(span, err)
+		s.observeLookup(cold, start, err)
+	}()
+
+	if err := checkModule(mod); err != nil {
+		return 0, err
 	}
 
-	if !errors.Is(err, ErrNotFound) {
-		return 0, fmt.Errorf("failed to find record id: %w", err)
+	// Fast path - record already exists. Module versions the record filter rules out go straight to the upstream.
+	if s.recordFilter.absent(mod.Path, mod.Version) {
+		s.observeRecordFilter(filterAbsent)
+	} else {
+		id, err := recordID(ctx, s.store, mod)
+		if err == nil {
+			s.observeRecordFilter(filterPresent)
+			return id, nil
+		}
+
+		if !errors.Is(err, ErrNotFound) {
+			return 0, fmt.Errorf("failed to find record id: %w", err)
+		}
+		s.observeRecordFilter(filterFalsePositive)
 	}
 
 	// Use singleflight to deduplicate concurrent lookups for the same module
+	cold = true
+	return s.sharedFetch(ctx, mod)
+}
+
+// sharedFetch fetches and stores the record for mod once for all concurrent lookups of it made with the same upstream
+// credentials (see identityKey).
+//
+// By default the fetch runs with the context of the lookup that started it, so the others share its fate if it's
+// canceled. With WithDetachedLookups, it runs on a context detached from it, bounded by its own timeout, and each
+// lookup only stops waiting for it when its own context is done.
+func (s *SumDB) sharedFetch(ctx context.Context, mod module.Version) (int64, error) {
 	key := mod.Path + "@" + mod.Version
-	result, err, _ := s.lookupGroup.Do(key, func() (any, error) {
+	if id := s.identityKey(ctx); id != "" {
+		key += "\x00" + id
+	}
+	if s.detachedLookupTimeout <= 0 {
+		result, err, _ := s.lookupGroup.Do(key, func() (any, error) {
+			return s.fetchAndStoreRecord(ctx, mod)
+		})
+		if err != nil {
+			return 0, err
+		}
+		return result.(int64), nil
+	}
+
+	results := s.lookupGroup.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.detachedLookupTimeout)
+		defer cancel()
 		return s.fetchAndStoreRecord(ctx, mod)
 	})
-	if err != nil {
-		return 0, err
-	}
 
-	return result.(int64), nil
+	select {
+	case r := <-results:
+		if r.Err != nil {
+			return 0, r.Err
+		}
+		return r.Val.(int64), nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
 }
 
 // fetchAndStoreRecord fetches a module from upstream, computes checksums,
 // and stores the record. Called via singleflight to deduplicate concurrent requests.
-func (s *SumDB) fetchAndStoreRecord(ctx context.Context, mod module.Version) (int64, error) {
-	// Double-check: another request may have added it while we waited
-	id, err := s.store.RecordID(ctx, mod.Path, mod.Version)
+func (s *SumDB) fetchAndStoreRecord(ctx context.Context, mod module.Version) (_ int64, err error) {
+	// Double-check: another request (or, when the record filter ruled it out, another server) may have added it
+	id, err := recordID(ctx, s.store, mod)
 	if err == nil {
+		s.recordAdded(mod.Path, mod.Version)
 		return id, nil
 	}
 	if !errors.Is(err, ErrNotFound) {
 		return 0, fmt.Errorf("failed to find record id: %w", err)
 	}
 
-	h1mod, err := s.proxy.GoMod(ctx, mod)
-	if err != nil {
-		return 0, fmt.Errorf("failed getting h1 hash for go.mod: %s, %w", mod.String(), err)
+	route := s.routeFor(mod)
+	upstreams := s.upstreamsFor(route)
+	var recorder *replayRecorder
+	if s.onReplay != nil {
+		recorder = newReplayRecorder(s.clock.Now(), mod, route.upstream)
+		if upstreams, err = s.recordingUpstreams(recorder, route); err != nil {
+			return 0, err
+		}
+		defer func() { s.onReplay(recorder.finish(err)) }()
 	}
 
-	h1, err := s.proxy.Zip(ctx, mod)
+	priority := priorityFrom(ctx, PriorityInteractive)
+	if priority == PriorityBatch {
+		if err := s.fetchLanes.acquire(ctx, priority); err != nil {
+			return 0, err
+		}
+	} else {
+		s.fetchLanes.occupy()
+	}
+	rec, err := s.fetchRecord(ctx, route, upstreams, mod)
+	s.fetchLanes.release()
 	if err != nil {
-		return 0, fmt.Errorf("failed getting h1 hash for module zip: %s, %w", mod.String(), err)
+		return 0, err
 	}
 
-	rec := &Record{
-		Path:    mod.Path,
-		Version: mod.Version,
-		Data: fmt.Appendf(nil,
-			"%s %s %s\n%s %s/go.mod %s\n",
-			mod.Path,
-			mod.Version,
-			h1,
-			mod.Path,
-			mod.Version,
-			h1mod,
-		),
+	// The append's span covers the waits for its turn as well as the append itself.
+	ctx, span := tracing.Start(ctx, "sumdb.append")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.appendLimit.wait(ctx, 1); err != nil {
+		return 0, fmt.Errorf("failed waiting for append limit: %w", err)
 	}
 
 	// Serialize tree mutations to ensure consistency.
 	// Each record's position depends on TreeSize, so concurrent inserts must be serialized.
-	s.writeMu.Lock()
-	defer s.writeMu.Unlock()
+	if err := s.appendQueue.acquire(ctx, priority); err != nil {
+		s.appendLimit.release(1)
+		return 0, err
+	}
+	defer s.appendQueue.release()
+
+	unlock, err := s.lockAppends(ctx)
+	if err != nil {
+		s.appendLimit.release(1)
+		return 0, err
+	}
+	defer unlock()
 
 	// Atomic operation: add record and update tree hashes
-	var recordID int64
-	if err := s.withTx(ctx, func(store Store) error {
+	var (
+		recordID int64
+		existing bool
+		warning  *TyposquatWarning
+	)
+	if err := s.withTx(ctx, func(tx Store) error {
+		store := tx
+		if recorder != nil {
+			store = recorder.store(tx)
+		}
+
+		// Other instances sharing the store may have appended the record while this one waited for the lock.
+		if s.locker != nil {
+			id, err := tx.RecordID(ctx, mod.Path, mod.Version)
+			if err == nil {
+				recordID, existing = id, true
+				return nil
+			}
+			if !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("failed to find record id: %w", err)
+			}
+		}
+
+		if err := s.preAppend(ctx, tx, rec); err != nil {
+			return err
+		}
+
+		addCtx, addSpan := tracing.Start(ctx, "store.AddRecord")
 		var err error
-		recordID, err = store.AddRecord(ctx, rec)
+		recordID, err = store.AddRecord(addCtx, rec)
+		tracing.End(addSpan, err)
 		if err != nil {
 			return fmt.Errorf("failed to add new record: %s, %w", mod, err)
 		}
@@ -210,17 +678,174 @@ func (s *SumDB) fetchAndStoreRecord(ctx context.Context, mod module.Version) (in
 			return fmt.Errorf("failed to update tree hashes: %s, %w", mod, err)
 		}
 
-		return nil
+		if err := storeAnnotations(ctx, tx, recordID, rec); err != nil {
+			return err
+		}
+
+		if warning, err = s.typosquat.check(ctx, tx, recordID, rec); err != nil {
+			return fmt.Errorf("failed to check for typosquatting: %s, %w", mod, err)
+		}
+
+		if err := s.runAppendHooks(ctx, tx, recordID, rec); err != nil {
+			return err
+		}
+
+		if err := addCheckpoint(ctx, tx, recordID+1, s.clock.Now()); err != nil {
+			return err
+		}
+
+		return s.addOutboxEvent(ctx, tx, recordID, rec)
 	}); err != nil {
+		s.appendLimit.release(1)
 		return 0, err
 	}
+	s.recordAdded(mod.Path, mod.Version)
+	span.SetAttributes(tracing.Int64("record.id", recordID))
+	if existing {
+		s.appendLimit.release(1)
+		return recordID, nil
+	}
 
+	s.appended.notify()
+	s.observeAppend(1, recordID+1)
+	s.logRecordAdded(ctx, mod, recordID)
+	s.logTreeSize(ctx, recordID+1)
+	s.typosquat.warn(warning)
+	s.postAppend(ctx, recordID, rec)
 	return recordID, nil
 }
 
+// fetchRecord fetches mod through the route r with the clients u and returns the record for it.
+func (s *SumDB) fetchRecord(
+	ctx context.Context, r *ingestRoute, u fetchUpstreams, mod module.Version,
+) (_ *Record, err error) {
+	ctx, span := tracing.Start(ctx, "sumdb.fetch", tracing.String("sumdb.upstream", r.upstream))
+	defer func() { tracing.End(span, err) }()
+
+	if s.notFound.has(s.clock.Now(), mod) {
+		return nil, fmt.Errorf("%w: %s (cached upstream 404)", ErrNotFound, mod)
+	}
+
+	if s.quarantine.has(mod) {
+		return nil, fmt.Errorf("%w: %s (quarantined)", ErrUpstreamMismatch, mod)
+	}
+
+	if err := s.checkUpstream(r.source); err != nil {
+		return nil, err
+	}
+
+	if err := s.waitUpstream(ctx, mod); err != nil {
+		return nil, err
+	}
+
+	defer func(start time.Time) {
+		s.observeFetch(start, err)
+		s.logFetch(ctx, r, mod, err)
+	}(s.clock.Now())
+
+	info, err := s.checkPolicy(ctx, u.proxy, mod)
+	if err != nil {
+		return nil, s.upstreamError(mod, err)
+	}
+
+	if err := s.verifyPath(ctx, mod); err != nil {
+		return nil, err
+	}
+
+	if err := s.preFetch(ctx, mod); err != nil {
+		return nil, err
+	}
+
+	rec, err := r.record(ctx, u.proxy, mod)
+	err = s.observeUpstream(ctx, r.source, err)
+	if errors.Is(err, ErrUpstreamVerification) {
+		s.raise(ctx, &alert.Alert{
+			Source:   alertSourceUpstreamVerification,
+			Severity: alert.Critical,
+			Summary:  fmt.Sprintf("failed to verify the upstream checksum database's record for %s", mod),
+			Details:  map[string]string{"module": mod.String(), "error": err.Error()},
+		})
+	}
+	if err != nil {
+		return nil, s.upstreamError(mod, err)
+	}
+
+	if info == nil && s.publishTimes && r.sumdb == nil {
+		if info, err = u.proxy.Info(ctx, mod); err != nil {
+			return nil, s.upstreamError(mod, fmt.Errorf("failed getting info: %s, %w", mod, err))
+		}
+	}
+	if info != nil {
+		rec.Published = info.Time
+	}
+
+	// Records from checksum databases are verified as served, but only normalized data is stored, so that every record
+	// hashes the way go clients expect.
+	if rec.Data, err = NormalizeRecordData(mod, rec.Data); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkRecordData(rec); err != nil {
+		return nil, err
+	}
+
+	if err := s.crossCheck(ctx, u.secondary, mod, rec); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUpstreamSumDB(ctx, r, u.sumdb, mod, rec); err != nil {
+		return nil, err
+	}
+
+	if err := s.postFetch(ctx, mod, rec); err != nil {
+		return nil, err
+	}
+
+	s.failback.remember(s.clock.Now(), mod, rec.Data)
+	return rec, nil
+}
+
+// recordID returns the ID of the record for mod in store, reporting the query as a span. Records that don't exist yet
+// aren't reported as errors.
+func recordID(ctx context.Context, store Store, mod module.Version) (int64, error) {
+	ctx, span := tracing.Start(ctx, "store.RecordID")
+	id, err := store.RecordID(ctx, mod.Path, mod.Version)
+	if errors.Is(err, ErrNotFound) {
+		span.SetAttributes(tracing.Bool("store.found", false))
+		span.End()
+		return id, err
+	}
+
+	tracing.End(span, err)
+	return id, err
+}
+
+// hashRecord builds the record for mod from the hashes of its go.mod and zip served by p.
+func hashRecord(ctx context.Context, p *proxy.Proxy, mod module.Version) (*Record, error) {
+	h1mod, err := p.GoMod(ctx, mod)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting h1 hash for go.mod: %s, %w", mod.String(), err)
+	}
+
+	h1, err := p.Zip(ctx, mod)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting h1 hash for module zip: %s, %w", mod.String(), err)
+	}
+
+	return &Record{
+		Path:    mod.Path,
+		Version: mod.Version,
+		Data:    appendRecordData(make([]byte, 0, recordDataLen(mod, h1, h1mod)), mod, h1, h1mod),
+	}, nil
+}
+
 // ReadTileData returns the raw record data for a data tile.
 // Data tiles (L=-1) contain concatenated record data rather than hashes.
 func (s *SumDB) ReadTileData(ctx context.Context, t tlog.Tile) ([]byte, error) {
+	if err := s.checkTile(t); err != nil {
+		return nil, err
+	}
+
 	data, err := tree.ReadTile(ctx, s.store, t)
 	if err != nil {
 		return nil, fmt.Errorf("failed reading tile data: %w", err)
@@ -232,8 +857,13 @@ func (s *SumDB) ReadTileData(ctx context.Context, t tlog.Tile) ([]byte, error) {
 // withTx executes fn within a transaction if the store supports transactions.
 // If the store does not implement TxStore, fn is executed directly.
 func (s *SumDB) withTx(ctx context.Context, fn func(Store) error) error {
-	if txs, ok := s.store.(TxStore); ok {
+	return withTx(ctx, s.store, fn)
+}
+
+// withTx executes fn within a transaction if store supports transactions.
+func withTx(ctx context.Context, store Store, fn func(Store) error) error {
+	if txs, ok := store.(TxStore); ok {
 		return txs.WithTx(ctx, fn)
 	}
-	return fn(s.store)
+	return fn(store)
 }
@@ -1,22 +1,31 @@
 package sumdb_test
 
-//go:generate go tool mockgen -destination=store_test.go -package=sumdb_test . Store,TxStore
+//go:generate go tool mockgen -destination=store_test.go -package=sumdb_test . Store,TxStore,AuditStore
 
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/pseudomuto/sumdb"
+	"github.com/pseudomuto/sumdb/chaos"
 	"github.com/pseudomuto/sumdb/internal/signer"
+	"github.com/pseudomuto/sumdb/kms"
+	"github.com/pseudomuto/sumdb/monitor"
+	"github.com/pseudomuto/sumdb/store/memstore"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/note"
 	"golang.org/x/mod/sumdb/tlog"
 )
 
@@ -39,7 +48,7 @@ func TestSigned(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("empty tree", func(t *testing.T) {
-		store.EXPECT().TreeSize(gomock.Any()).Return(int64(0), nil).Times(2)
+		store.EXPECT().TreeSize(gomock.Any()).Return(int64(0), nil)
 
 		signed, err := db.Signed(t.Context())
 		require.NoError(t, err)
@@ -61,7 +70,7 @@ func TestSigned(t *testing.T) {
 	})
 
 	t.Run("tree hash error", func(t *testing.T) {
-		store.EXPECT().TreeSize(gomock.Any()).Return(int64(1), nil).Times(2)
+		store.EXPECT().TreeSize(gomock.Any()).Return(int64(1), nil)
 		store.EXPECT().ReadHashes(gomock.Any(), gomock.Any()).Return(nil, errors.New("hash error"))
 
 		_, err = db.Signed(t.Context())
@@ -69,6 +78,97 @@ func TestSigned(t *testing.T) {
 	})
 }
 
+func TestAdditionalSigners(t *testing.T) {
+	oldKey, oldVKey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+	newKey, newVKey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	db, err := New("test.example.com", newKey,
+		WithStore(newMemStore()),
+		WithUpstream(newFakeProxy(t).upstream(t)),
+		WithAdditionalSigner(oldKey),
+	)
+	require.NoError(t, err)
+	require.Equal(t, newVKey, db.VerifierKey())
+
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(db.Handler())
+	t.Cleanup(srv.Close)
+
+	// Clients trusting either key verify the log.
+	for _, vkey := range []string{oldVKey, newVKey} {
+		m, err := monitor.New(srv.URL, vkey)
+		require.NoError(t, err)
+		tree, err := m.Check(t.Context())
+		require.NoError(t, err, vkey)
+		require.Equal(t, int64(1), tree.N)
+	}
+
+	t.Run("invalid keys", func(t *testing.T) {
+		_, err := New("test.example.com", newKey, WithAdditionalSigner("not a key"))
+		require.ErrorContains(t, err, "invalid additional signer key")
+
+		_, err = New("test.example.com", newKey, WithAdditionalSigner(newKey))
+		require.ErrorContains(t, err, "duplicate signer key")
+
+		_, err = New("test.example.com", newKey, WithAdditionalSigner(oldKey), WithAdditionalSigner(oldKey))
+		require.ErrorContains(t, err, "duplicate signer key")
+	})
+}
+
+func TestWithSigner(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	s, err := kms.NewSigner("test.example.com", key)
+	require.NoError(t, err)
+
+	db, err := New("test.example.com", "",
+		WithStore(newMemStore()),
+		WithUpstream(newFakeProxy(t).upstream(t)),
+		WithSigner(s),
+	)
+	require.NoError(t, err)
+	require.Equal(t, s.VerifierKey(), db.VerifierKey())
+
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(db.Handler())
+	t.Cleanup(srv.Close)
+
+	m, err := monitor.New(srv.URL, s.VerifierKey())
+	require.NoError(t, err)
+	tree, err := m.Check(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), tree.N)
+
+	t.Run("invalid signers", func(t *testing.T) {
+		skey, _, err := GenerateKeys("test.example.com")
+		require.NoError(t, err)
+		plain, err := note.NewSigner(skey)
+		require.NoError(t, err)
+
+		_, err = New("test.example.com", "", WithSigner(plain))
+		require.ErrorContains(t, err, "no VerifierKey method")
+
+		_, err = New("test.example.com", "", WithSigner(mismatchedSigner{Signer: plain, vkey: s.VerifierKey()}))
+		require.ErrorContains(t, err, "verifier key doesn't match")
+	})
+}
+
+// mismatchedSigner is a note.Signer reporting another key's verifier key.
+type mismatchedSigner struct {
+	note.Signer
+	vkey string
+}
+
+func (s mismatchedSigner) VerifierKey() string {
+	return s.vkey
+}
+
 func TestReadRecords(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -306,4 +406,155 @@ func TestLookup_WithTxStore(t *testing.T) {
 		_, err = db.Lookup(t.Context(), mod)
 		require.ErrorContains(t, err, "add record failed")
 	})
+
+	t.Run("interrupted appends leave no trace", func(t *testing.T) {
+		skey, _, err := GenerateKeys("test.example.com")
+		require.NoError(t, err)
+
+		store := memstore.New()
+		upstream := newFakeProxy(t).upstream(t)
+
+		// The append fails after its record and hashes were written, as if the process stopped before the tree grew.
+		faulty := chaos.NewStore(store, chaos.WithFault("SetTreeSize", chaos.Fault{ErrorRate: 1}))
+		db, err := New("test.example.com", skey, WithStore(faulty), WithUpstream(upstream))
+		require.NoError(t, err)
+
+		mod := module.Version{Path: "example.com/a", Version: "v1.0.0"}
+		_, err = db.Lookup(t.Context(), mod)
+		require.ErrorIs(t, err, chaos.ErrInjected)
+
+		_, err = store.RecordID(t.Context(), mod.Path, mod.Version)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		// The record is appended at the position the failed append would have used.
+		db, err = New("test.example.com", skey, WithStore(store), WithUpstream(upstream))
+		require.NoError(t, err)
+
+		id, err := db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+		require.Equal(t, int64(0), id)
+
+		recs, err := store.Records(t.Context(), 0, 1)
+		require.NoError(t, err)
+		stored, err := store.ReadHashes(t.Context(), []int64{0})
+		require.NoError(t, err)
+		require.Equal(t, tlog.RecordHash(recs[0].Data), stored[0])
+	})
+}
+
+func TestLookup_ZipRangeRequests(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	mod := module.Version{Path: "example.com/mod", Version: "v1.0.0"}
+	lookup := func(t *testing.T, opts ...Option) ([]byte, []string) {
+		t.Helper()
+
+		upstream := newFakeProxy(t)
+		db, err := New("test.example.com", skey, append(opts, WithStore(newMemStore()), WithUpstream(upstream.upstream(t)))...)
+		require.NoError(t, err)
+
+		id, err := db.Lookup(t.Context(), mod)
+		require.NoError(t, err)
+		data, err := db.ReadRecords(t.Context(), id, 1)
+		require.NoError(t, err)
+		return data[0], upstream.requested()
+	}
+
+	want, _ := lookup(t)
+	got, requests := lookup(t, WithZipRangeRequests(32, 2))
+	require.Equal(t, want, got)
+
+	zips := 0
+	for _, r := range requests {
+		if strings.HasSuffix(r, ".zip") {
+			zips++
+		}
+	}
+	require.Greater(t, zips, 1)
+}
+
+func TestLookup_Spool(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	newDB := func(t *testing.T, maxSize int64) *SumDB {
+		t.Helper()
+		db, err := New("test.example.com", skey,
+			WithStore(newMemStore()),
+			WithUpstream(upstream.upstream(t)),
+			WithSpool(t.TempDir(), maxSize),
+		)
+		require.NoError(t, err)
+		return db
+	}
+
+	_, err = newDB(t, 1<<20).Lookup(t.Context(), module.Version{Path: "example.com/mod", Version: "v1.0.0"})
+	require.NoError(t, err)
+
+	db := newDB(t, 16)
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/mod", Version: "v1.0.0"})
+	require.ErrorIs(t, err, ErrSpoolFull)
+
+	rec := httptest.NewRecorder()
+	db.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/lookup/example.com/mod@v1.0.0", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestLookup_DetachedLookups(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	mod := module.Version{Path: "example.com/slow", Version: "v1.0.0"}
+
+	// lookups starts a lookup for mod that's canceled once the fetch is under way, and another that joins it. It
+	// returns their errors.
+	lookups := func(t *testing.T, opts ...Option) (error, error) {
+		t.Helper()
+
+		upstream := newFakeProxy(t)
+		upstream.setDelay(100 * time.Millisecond)
+		db, err := New("test.example.com", skey, append(opts, WithStore(newMemStore()),
+			WithUpstream(upstream.upstream(t)))...)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		first := make(chan error, 1)
+		go func() {
+			_, err := db.Lookup(ctx, mod)
+			first <- err
+		}()
+		require.Eventually(t, func() bool { return len(upstream.requested()) > 0 }, time.Second, time.Millisecond)
+
+		second := make(chan error, 1)
+		go func() {
+			_, err := db.Lookup(t.Context(), mod)
+			second <- err
+		}()
+
+		// Give the second lookup time to join the first.
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		return <-first, <-second
+	}
+
+	t.Run("attached", func(t *testing.T) {
+		first, second := lookups(t)
+		require.ErrorIs(t, first, context.Canceled)
+		require.ErrorIs(t, second, context.Canceled)
+	})
+
+	t.Run("detached", func(t *testing.T) {
+		first, second := lookups(t, WithDetachedLookups(time.Second))
+		require.ErrorIs(t, first, context.Canceled)
+		require.NoError(t, second)
+	})
+
+	t.Run("detached fetches time out", func(t *testing.T) {
+		first, second := lookups(t, WithDetachedLookups(50*time.Millisecond))
+		require.ErrorIs(t, first, context.Canceled)
+		require.ErrorIs(t, second, context.DeadlineExceeded)
+	})
 }
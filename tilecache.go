@@ -0,0 +1,70 @@
+package sumdb
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/pseudomuto/sumdb/internal/lru"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// tileCache caches the data of tiles served, up to a total size in bytes, so that clients fetching the same tiles
+// don't each read them from the store. See WithTileCache.
+//
+// A tile's data never changes once it can be served, but every append makes a new partial tile at each level (the
+// tile of the tree's rightmost records), superseding the previous one. Only the rightmost partial tile seen at each
+// level is cached, and it's evicted when a wider one (or the full tile) is cached, so they don't crowd out full tiles.
+type tileCache struct {
+	tiles *lru.Cache[string, []byte]
+
+	mu      sync.Mutex
+	partial map[int]tlog.Tile // by level
+}
+
+func newTileCache(size int) *tileCache {
+	return &tileCache{
+		tiles:   lru.NewWeighted[string](size, func(data []byte) int { return len(data) }),
+		partial: make(map[int]tlog.Tile),
+	}
+}
+
+// get returns the cached data of t. It always misses on a nil cache.
+func (c *tileCache) get(t tlog.Tile) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	return c.tiles.Get(t.Path())
+}
+
+// add caches a copy of data as the data of t, unless t is a partial tile superseded by one already cached. It's a
+// no-op on a nil cache.
+func (c *tileCache) add(t tlog.Tile, data []byte) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	full := t.W == 1<<t.H
+	if prev, ok := c.partial[t.L]; ok {
+		switch {
+		case prev.N > t.N && !full, prev.N == t.N && !full && prev.W >= t.W:
+			// An old partial tile, requested by a client that hasn't seen the latest tree head yet.
+			return
+		case prev.N <= t.N:
+			c.tiles.Remove(prev.Path())
+			delete(c.partial, t.L)
+		}
+	}
+	if !full {
+		c.partial[t.L] = t
+	}
+
+	c.tiles.Add(t.Path(), bytes.Clone(data))
+}
+
+// size returns the total size of the cached tiles, in bytes.
+func (c *tileCache) size() int {
+	return c.tiles.Weight()
+}
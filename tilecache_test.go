@@ -0,0 +1,101 @@
+package sumdb_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// readCountingStore is a Store counting its hash and record reads.
+type readCountingStore struct {
+	Store
+	reads atomic.Int64
+}
+
+func (s *readCountingStore) ReadHashes(ctx context.Context, indexes []int64) ([]tlog.Hash, error) {
+	s.reads.Add(1)
+	return s.Store.ReadHashes(ctx, indexes)
+}
+
+func (s *readCountingStore) Records(ctx context.Context, id, n int64) ([]*Record, error) {
+	s.reads.Add(1)
+	return s.Store.Records(ctx, id, n)
+}
+
+func TestTileCache(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := &readCountingStore{Store: newMemStore()}
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(newFakeProxy(t).upstream(t)),
+		WithTileCache(1<<20),
+	)
+	require.NoError(t, err)
+
+	mods := make([]module.Version, 300)
+	for i := range mods {
+		mods[i] = module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"}
+	}
+	_, err = db.AddRecords(t.Context(), mods)
+	require.NoError(t, err)
+
+	// get serves path twice, returning the response body and the number of store reads both requests made.
+	get := func(t *testing.T, path string) ([]byte, int64) {
+		t.Helper()
+
+		before := store.reads.Load()
+		var body []byte
+		for range 2 {
+			rec := httptest.NewRecorder()
+			db.TileHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			require.Equal(t, http.StatusOK, rec.Code, path)
+			if body != nil {
+				require.Equal(t, body, rec.Body.Bytes(), path)
+			}
+			body = rec.Body.Bytes()
+		}
+		return body, store.reads.Load() - before
+	}
+
+	// Full and rightmost partial tiles are only read from the store once.
+	for _, path := range []string{"/tile/8/0/000", "/tile/8/0/001.p/44", "/tile/8/data/000", "/tile/8/data/001.p/44"} {
+		_, reads := get(t, path)
+		require.Equal(t, int64(1), reads, path)
+	}
+
+	// Partial tiles narrower than the rightmost one aren't cached.
+	_, reads := get(t, "/tile/8/0/001.p/40")
+	require.Equal(t, int64(2), reads)
+	_, reads = get(t, "/tile/8/0/001.p/44")
+	require.Equal(t, int64(0), reads)
+
+	// Once the tree grows, wider partial tiles supersede it.
+	_, err = db.AddRecords(t.Context(), []module.Version{{Path: "example.com/mod300", Version: "v1.0.0"}})
+	require.NoError(t, err)
+
+	_, reads = get(t, "/tile/8/0/001.p/45")
+	require.Equal(t, int64(1), reads)
+	_, reads = get(t, "/tile/8/0/001.p/44")
+	require.Equal(t, int64(2), reads)
+
+	data, reads := get(t, "/tile/8/data/001.p/44")
+	require.Equal(t, int64(0), reads)
+	require.Contains(t, string(data), "example.com/mod256 v1.0.0")
+
+	rec := httptest.NewRecorder()
+	db.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	require.Contains(t, body, `sumdb_tile_cache_requests_total{result="hit"} 9`)
+	require.Contains(t, body, `sumdb_tile_cache_requests_total{result="miss"} 9`)
+	require.Contains(t, body, `sumdb_tile_cache_bytes `)
+}
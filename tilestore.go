@@ -0,0 +1,35 @@
+package sumdb
+
+import (
+	"context"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// isFullTile reports whether t is a full tile, whose data never changes.
+func isFullTile(t tlog.Tile) bool {
+	return t.W == 1<<t.H
+}
+
+// readSavedTile returns the data saved for t if it's a full tile and the Store implements TileStore. Tiles that can't
+// be read, or whose saved data is malformed, are rebuilt (and saved again) instead.
+func (s *SumDB) readSavedTile(ctx context.Context, t tlog.Tile) ([]byte, bool) {
+	ts, ok := s.store.(TileStore)
+	if !ok || !isFullTile(t) {
+		return nil, false
+	}
+
+	data, err := ts.ReadSavedTile(ctx, t)
+	if err != nil || (t.L >= 0 && len(data) != t.W*tlog.HashSize) {
+		return nil, false
+	}
+	return data, true
+}
+
+// saveTile saves data as the data of t if it's a full tile and the Store implements TileStore. Failures are ignored,
+// since the next request for the tile rebuilds it and tries again.
+func (s *SumDB) saveTile(ctx context.Context, t tlog.Tile, data []byte) {
+	if ts, ok := s.store.(TileStore); ok && isFullTile(t) {
+		_ = ts.WriteSavedTile(ctx, t, data)
+	}
+}
@@ -0,0 +1,96 @@
+package sumdb_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// savedTileStore is a TileStore saving tiles in memory, counting its hash and record reads.
+type savedTileStore struct {
+	readCountingStore
+
+	mu    sync.Mutex
+	tiles map[string][]byte
+}
+
+func (s *savedTileStore) ReadSavedTile(_ context.Context, t tlog.Tile) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.tiles[t.Path()]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (s *savedTileStore) WriteSavedTile(_ context.Context, t tlog.Tile, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tiles[t.Path()] = append([]byte(nil), data...)
+	return nil
+}
+
+func TestTileStore(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	store := &savedTileStore{readCountingStore: readCountingStore{Store: newMemStore()}, tiles: map[string][]byte{}}
+	db, err := New("test.example.com", skey, WithStore(store), WithUpstream(newFakeProxy(t).upstream(t)))
+	require.NoError(t, err)
+
+	mods := make([]module.Version, 300)
+	for i := range mods {
+		mods[i] = module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"}
+	}
+	_, err = db.AddRecords(t.Context(), mods)
+	require.NoError(t, err)
+
+	// get serves path, returning the response body and the number of store reads the request made.
+	get := func(t *testing.T, path string) ([]byte, int64) {
+		t.Helper()
+
+		before := store.reads.Load()
+		rec := httptest.NewRecorder()
+		db.TileHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		return rec.Body.Bytes(), store.reads.Load() - before
+	}
+
+	// Full tiles are saved once rebuilt, and served verbatim afterwards.
+	for _, path := range []string{"/tile/8/0/000", "/tile/8/data/000"} {
+		want, reads := get(t, path)
+		require.Positive(t, reads, path)
+		require.Equal(t, want, store.tiles[path[1:]], path)
+
+		got, reads := get(t, path)
+		require.Zero(t, reads, path)
+		require.Equal(t, want, got, path)
+	}
+
+	// Partial tiles are always rebuilt.
+	for range 2 {
+		_, reads := get(t, "/tile/8/0/001.p/44")
+		require.Positive(t, reads)
+	}
+	require.Len(t, store.tiles, 2)
+
+	// Malformed hash tiles are rebuilt, and saved again.
+	want := store.tiles["tile/8/0/000"]
+	store.tiles["tile/8/0/000"] = []byte("malformed")
+
+	got, reads := get(t, "/tile/8/0/000")
+	require.Positive(t, reads)
+	require.Equal(t, want, got)
+	require.Equal(t, want, store.tiles["tile/8/0/000"])
+}
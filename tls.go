@@ -0,0 +1,76 @@
+package sumdb
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidSPKIPin is returned by New when a pin given to WithUpstreamSPKIPins isn't a base64-encoded SHA-256
+	// digest.
+	ErrInvalidSPKIPin = errors.New("invalid SPKI pin")
+
+	// ErrSPKIPinMismatch is returned by lookups when none of the certificates presented by the upstream match the pins
+	// configured with WithUpstreamSPKIPins.
+	ErrSPKIPinMismatch = errors.New("upstream certificate doesn't match any SPKI pin")
+)
+
+// parseSPKIPins decodes the pins given to WithUpstreamSPKIPins.
+func parseSPKIPins(pins []string) (map[[sha256.Size]byte]bool, error) {
+	digests := make(map[[sha256.Size]byte]bool, len(pins))
+	for _, pin := range pins {
+		digest, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSPKIPin, pin)
+		}
+		digests[[sha256.Size]byte(digest)] = true
+	}
+	return digests, nil
+}
+
+// upstreamTLSConfig returns a copy of base (which may be nil) that trusts the roots configured with
+// WithUpstreamRootCAs and requires one of pins.
+func (s *SumDB) upstreamTLSConfig(base *tls.Config, pins map[[sha256.Size]byte]bool) *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	if s.upstreamRootCAs != nil {
+		cfg.RootCAs = s.upstreamRootCAs
+	}
+	if len(pins) > 0 {
+		cfg.VerifyConnection = verifySPKIPins(pins)
+	}
+	return cfg
+}
+
+// verifySPKIPins returns a tls.Config.VerifyConnection function which requires one of the certificates in the
+// verified chains to have a public key whose SHA-256 digest is in pins. Pinning an intermediate or root key allows
+// the upstream's own certificate to be rotated without updating the pins. Mismatches are reported as certificate
+// verification errors, so that they aren't retried (see WithProxyRetry).
+func verifySPKIPins(pins map[[sha256.Size]byte]bool) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				if pins[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+					return nil
+				}
+			}
+		}
+		return &tls.CertificateVerificationError{
+			UnverifiedCertificates: cs.PeerCertificates,
+			Err:                    fmt.Errorf("%w: %s", ErrSPKIPinMismatch, cs.ServerName),
+		}
+	}
+}
+
+// SPKIPin returns the pin of cert's public key for use with WithUpstreamSPKIPins: the base64-encoded SHA-256 digest
+// of its DER-encoded SubjectPublicKeyInfo.
+func SPKIPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
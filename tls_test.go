@@ -0,0 +1,99 @@
+package sumdb_test
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestUpstreamTLS(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	p := newFakeProxy(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(p.serve))
+	t.Cleanup(srv.Close)
+
+	upstream, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	mod := module.Version{Path: "example.com/foo", Version: "v1.0.0"}
+	lookup := func(t *testing.T, opts ...Option) error {
+		t.Helper()
+
+		opts = append(opts, WithStore(newMemStore()), WithUpstream(upstream))
+		db, err := New("test.example.com", skey, opts...)
+		require.NoError(t, err)
+
+		_, err = db.Lookup(t.Context(), mod)
+		return err
+	}
+
+	t.Run("root CAs", func(t *testing.T) {
+		// The test server's certificate isn't trusted by the system roots.
+		require.Error(t, lookup(t))
+
+		roots := x509.NewCertPool()
+		roots.AddCert(srv.Certificate())
+		require.NoError(t, lookup(t, WithUpstreamRootCAs(roots)))
+	})
+
+	t.Run("SPKI pins", func(t *testing.T) {
+		other := sha256.Sum256([]byte("some other key"))
+		otherPin := base64.StdEncoding.EncodeToString(other[:])
+
+		require.NoError(t, lookup(t, WithHTTPClient(srv.Client()), WithUpstreamSPKIPins(otherPin, SPKIPin(srv.Certificate()))))
+		require.ErrorIs(t, lookup(t, WithHTTPClient(srv.Client()), WithUpstreamSPKIPins(otherPin)), ErrSPKIPinMismatch)
+	})
+
+	t.Run("certificate failures aren't retried", func(t *testing.T) {
+		var conns atomic.Int32
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(p.serve))
+		srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				conns.Add(1)
+			}
+		}
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+
+		upstream, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		other := sha256.Sum256([]byte("some other key"))
+		for name, opts := range map[string][]Option{
+			"untrusted":    nil,
+			"pin mismatch": {WithHTTPClient(srv.Client()), WithUpstreamSPKIPins(base64.StdEncoding.EncodeToString(other[:]))},
+		} {
+			conns.Store(0)
+			db, err := New("test.example.com", skey, append(opts,
+				WithStore(newMemStore()),
+				WithUpstream(upstream),
+				WithProxyRetry(3, time.Millisecond, time.Millisecond),
+			)...)
+			require.NoError(t, err)
+
+			_, err = db.Lookup(t.Context(), mod)
+			require.Error(t, err, name)
+			require.Equal(t, int32(1), conns.Load(), name)
+		}
+	})
+
+	t.Run("invalid SPKI pins", func(t *testing.T) {
+		for _, pin := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("too short"))} {
+			_, err := New("test.example.com", skey, WithUpstreamSPKIPins(pin))
+			require.ErrorIs(t, err, ErrInvalidSPKIPin)
+		}
+	})
+}
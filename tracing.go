@@ -0,0 +1,39 @@
+package sumdb
+
+import (
+	"context"
+
+	"github.com/pseudomuto/sumdb/internal/tracing"
+	"golang.org/x/mod/module"
+)
+
+// tracerName is the instrumentation scope of the Tracer spans are started with.
+const tracerName = "github.com/pseudomuto/sumdb"
+
+type (
+	// TracerProvider creates the Tracer spans are reported with. See WithTracerProvider.
+	//
+	// The package doesn't depend on a tracing library, so OpenTelemetry's TracerProvider is used through an adapter
+	// (see the README).
+	TracerProvider = tracing.Provider
+
+	// Tracer starts spans, as children of the span carried by their context.
+	Tracer = tracing.Tracer
+
+	// Span is a traced operation.
+	Span = tracing.Span
+
+	// Attribute is a key-value pair describing a span. Values are strings, int64s or bools.
+	Attribute = tracing.Attribute
+)
+
+// startSpan starts the named span with the tracer configured with WithTracerProvider, if any. The returned context
+// carries the tracer, so that the packages doing the work report their spans as the span's children.
+func (s *SumDB) startSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return tracing.Start(tracing.WithTracer(ctx, s.tracer), name, attrs...)
+}
+
+// moduleAttrs returns the attributes of spans for work on mod.
+func moduleAttrs(mod module.Version) []Attribute {
+	return []Attribute{tracing.String("module.path", mod.Path), tracing.String("module.version", mod.Version)}
+}
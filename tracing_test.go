@@ -0,0 +1,149 @@
+package sumdb_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+type (
+	// recordingTracer is a TracerProvider and Tracer recording the spans started with it.
+	recordingTracer struct {
+		mu    sync.Mutex
+		scope string
+		spans []*recordedSpan
+	}
+
+	recordedSpan struct {
+		name   string
+		parent *recordedSpan
+		attrs  map[string]any
+		err    error
+		ended  bool
+	}
+
+	recordedSpanKey struct{}
+)
+
+func (t *recordingTracer) Tracer(name string) Tracer {
+	t.scope = name
+	return t
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parent, _ := ctx.Value(recordedSpanKey{}).(*recordedSpan)
+	s := &recordedSpan{name: name, parent: parent, attrs: make(map[string]any)}
+	s.SetAttributes(attrs...)
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, recordedSpanKey{}, s), s
+}
+
+// paths returns the path of every span started, from the root span (e.g. "sumdb.Lookup > sumdb.fetch"), and resets
+// the recorded spans.
+func (t *recordingTracer) paths() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	paths := make([]string, len(t.spans))
+	for i, s := range t.spans {
+		paths[i] = s.name
+		for p := s.parent; p != nil; p = p.parent {
+			paths[i] = p.name + " > " + paths[i]
+		}
+	}
+	t.spans = nil
+	return paths
+}
+
+// find returns the first span with the given name.
+func (t *recordingTracer) find(name string) *recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+func TestTracing(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	upstream.setMissing(module.Version{Path: "example.com/missing", Version: "v1.0.0"}, true)
+
+	tracer := &recordingTracer{}
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(upstream.upstream(t)),
+		WithTracerProvider(tracer),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "github.com/pseudomuto/sumdb", tracer.scope)
+
+	mod := module.Version{Path: "example.com/mod", Version: "v1.0.0"}
+	_, err = db.Lookup(t.Context(), mod)
+	require.NoError(t, err)
+
+	lookup := tracer.find("sumdb.Lookup")
+	require.NotNil(t, lookup)
+	require.True(t, lookup.ended)
+	require.NoError(t, lookup.err)
+	require.Equal(t, map[string]any{
+		"module.path":       "example.com/mod",
+		"module.version":    "v1.0.0",
+		"sumdb.lookup.cold": true,
+	}, lookup.attrs)
+	require.Equal(t, int64(0), tracer.find("sumdb.append").attrs["record.id"])
+	require.Equal(t, false, tracer.find("store.RecordID").attrs["store.found"])
+	require.NoError(t, tracer.find("store.RecordID").err)
+
+	require.Equal(t, []string{
+		"sumdb.Lookup",
+		"sumdb.Lookup > store.RecordID",
+		"sumdb.Lookup > store.RecordID",
+		"sumdb.Lookup > sumdb.fetch",
+		"sumdb.Lookup > sumdb.fetch > proxy.GoMod",
+		"sumdb.Lookup > sumdb.fetch > proxy.Zip",
+		"sumdb.Lookup > sumdb.fetch > proxy.Zip > proxy.hashZip",
+		"sumdb.Lookup > sumdb.append",
+		"sumdb.Lookup > sumdb.append > store.AddRecord",
+		"sumdb.Lookup > sumdb.append > tree.AddRecord",
+	}, tracer.paths())
+
+	// Warm lookups only query the store.
+	_, err = db.Lookup(t.Context(), mod)
+	require.NoError(t, err)
+	require.Equal(t, false, tracer.find("sumdb.Lookup").attrs["sumdb.lookup.cold"])
+	require.Equal(t, []string{"sumdb.Lookup", "sumdb.Lookup > store.RecordID"}, tracer.paths())
+
+	_, err = db.Lookup(t.Context(), module.Version{Path: "example.com/missing", Version: "v1.0.0"})
+	require.ErrorIs(t, err, ErrNotFound)
+	require.ErrorIs(t, tracer.find("sumdb.Lookup").err, ErrNotFound)
+	require.ErrorIs(t, tracer.find("sumdb.fetch").err, ErrNotFound)
+	require.Error(t, tracer.find("proxy.GoMod").err)
+	tracer.paths()
+
+	_, err = db.Signed(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, []string{"sumdb.SignTreeHead", "sumdb.SignTreeHead > tree.TreeHash"}, tracer.paths())
+}
@@ -0,0 +1,49 @@
+package sumdb
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// configureTransport applies the dialing (see WithDialer) and TLS (see WithUpstreamRootCAs and WithUpstreamSPKIPins)
+// options to the HTTP client used for the upstream proxies. The client and its transport are copied rather than
+// modified, since they may be shared with the caller.
+func (s *SumDB) configureTransport() error {
+	dial, err := s.dialContext()
+	if err != nil {
+		return err
+	}
+
+	pins, err := parseSPKIPins(s.spkiPins)
+	if err != nil {
+		return err
+	}
+
+	pinTLS := s.upstreamRootCAs != nil || len(pins) > 0
+	if dial == nil && !pinTLS {
+		return nil
+	}
+
+	var transport *http.Transport
+	switch t := s.http.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return fmt.Errorf("custom dialers and TLS settings require an *http.Transport, got %T", t)
+	}
+
+	if dial != nil {
+		transport.DialContext = dial
+		transport.DialTLSContext = nil
+	}
+	if pinTLS {
+		transport.TLSClientConfig = s.upstreamTLSConfig(transport.TLSClientConfig, pins)
+	}
+
+	client := *s.http
+	client.Transport = transport
+	s.http = &client
+	return nil
+}
@@ -0,0 +1,183 @@
+package sumdb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// typosquatAnnotation is the annotation set on records whose paths look like typosquats.
+	typosquatAnnotation = "typosquat"
+
+	// typosquatBatchSize is the number of records read at a time while indexing paths.
+	typosquatBatchSize = 1000
+)
+
+// homoglyphs replaces ASCII sequences that are easily mistaken for one another with a canonical form.
+var homoglyphs = strings.NewReplacer(
+	"rn", "m",
+	"vv", "w",
+	"cl", "d",
+	"0", "o",
+	"1", "l",
+	"I", "l",
+	"_", "-",
+)
+
+type (
+	// TyposquatWarning describes a newly recorded module path that is suspiciously similar to a popular path in the
+	// log.
+	TyposquatWarning struct {
+		ID      int64  `json:"id"`
+		Path    string `json:"path"`
+		Version string `json:"version"`
+		Similar string `json:"similar"`
+		Reason  string `json:"reason"`
+	}
+
+	// typosquatDetector compares first-seen module paths with the popular paths in the log. It's guarded by the
+	// SumDB's appendQueue.
+	typosquatDetector struct {
+		minVersions int
+		onWarning   func(*TyposquatWarning)
+
+		// indexed is the number of records counted in versions.
+		indexed  int64
+		versions map[string]int
+	}
+)
+
+func newTyposquatDetector(minVersions int, onWarning func(*TyposquatWarning)) *typosquatDetector {
+	return &typosquatDetector{minVersions: max(minVersions, 1), onWarning: onWarning, versions: make(map[string]int)}
+}
+
+// check compares the path of rec, which was just added to store with the given ID, with the popular paths in the
+// log, annotating the record if the Store implements AnnotationStore. It returns a warning if the path is suspicious.
+// A nil detector never warns.
+func (d *typosquatDetector) check(ctx context.Context, store Store, id int64, rec *Record) (*TyposquatWarning, error) {
+	if d == nil {
+		return nil, nil
+	}
+
+	if err := d.index(ctx, store, id); err != nil {
+		return nil, err
+	}
+
+	// Only first-seen paths are checked.
+	if d.versions[rec.Path] > 0 {
+		return nil, nil
+	}
+
+	var warning *TyposquatWarning
+	for path, n := range d.versions {
+		if n < d.minVersions {
+			continue
+		}
+
+		if reason := similarity(rec.Path, path); reason != "" {
+			// Map iteration is random, so the most popular similar path is reported.
+			if warning == nil || n > d.versions[warning.Similar] {
+				warning = &TyposquatWarning{ID: id, Path: rec.Path, Version: rec.Version, Similar: path, Reason: reason}
+			}
+		}
+	}
+
+	if warning == nil {
+		return nil, nil
+	}
+
+	if as, ok := store.(AnnotationStore); ok {
+		value := fmt.Sprintf("similar to %s (%s)", warning.Similar, warning.Reason)
+		if err := as.SetAnnotation(ctx, id, typosquatAnnotation, value); err != nil {
+			return nil, fmt.Errorf("failed to annotate record: %d, %w", id, err)
+		}
+	}
+
+	return warning, nil
+}
+
+// index counts the versions of each path in the records before size that haven't been indexed yet. The first call
+// reads the whole log.
+func (d *typosquatDetector) index(ctx context.Context, store Store, size int64) error {
+	for d.indexed < size {
+		recs, err := store.Records(ctx, d.indexed, min(size-d.indexed, typosquatBatchSize))
+		if err != nil {
+			return fmt.Errorf("failed to read records: %d, %w", d.indexed, err)
+		}
+		if len(recs) == 0 {
+			return fmt.Errorf("failed to read records: %d, %w", d.indexed, ErrNotFound)
+		}
+
+		for _, r := range recs {
+			d.versions[r.Path]++
+		}
+		d.indexed += int64(len(recs))
+	}
+
+	return nil
+}
+
+// warn reports w to the detector's callback, if any.
+func (d *typosquatDetector) warn(w *TyposquatWarning) {
+	if d != nil && w != nil && d.onWarning != nil {
+		d.onWarning(w)
+	}
+}
+
+// similarity returns why path a looks like a typosquat of b, or an empty string if it doesn't.
+func similarity(a, b string) string {
+	if homoglyphs.Replace(a) == homoglyphs.Replace(b) {
+		return "homoglyph"
+	}
+
+	if editDistance(a, b) == 1 {
+		return "edit distance 1"
+	}
+
+	return ""
+}
+
+// editDistance returns the Damerau-Levenshtein (optimal string alignment) distance between a and b, which counts
+// insertions, deletions, substitutions and transpositions of adjacent characters. Distances over 1 are reported as
+// 2, since larger differences aren't considered typos.
+func editDistance(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if len(a)-len(b) > 1 || len(b)-len(a) > 1 {
+		return 2
+	}
+
+	// prev2, prev and cur are the last three rows of the distance matrix.
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+
+		if rowMin > 1 {
+			return 2
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return min(prev[len(b)], 2)
+}
@@ -0,0 +1,97 @@
+package sumdb_test
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestTyposquatDetector(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	var (
+		mu       sync.Mutex
+		warnings []*TyposquatWarning
+	)
+	store := &annotatedStore{memStore: newMemStore(), annotations: make(map[int64]map[string]string)}
+	db, err := New("test.example.com", skey,
+		WithStore(store),
+		WithUpstream(newFakeProxy(t).upstream(t)),
+		WithTyposquatDetector(2, func(w *TyposquatWarning) {
+			mu.Lock()
+			defer mu.Unlock()
+			warnings = append(warnings, w)
+		}),
+	)
+	require.NoError(t, err)
+
+	lookup := func(t *testing.T, path, version string) int64 {
+		t.Helper()
+		id, err := db.Lookup(t.Context(), module.Version{Path: path, Version: version})
+		require.NoError(t, err)
+		return id
+	}
+
+	// Popular paths have at least 2 versions.
+	lookup(t, "github.com/acme/logger", "v1.0.0")
+	lookup(t, "github.com/acme/logger", "v1.1.0")
+	lookup(t, "github.com/acme/modern", "v1.0.0")
+	lookup(t, "github.com/acme/modern", "v1.1.0")
+	lookup(t, "github.com/acme/unpopular", "v1.0.0")
+	require.Empty(t, warnings)
+
+	tests := []struct {
+		path    string
+		similar string
+		reason  string
+	}{
+		{path: "github.com/acme/loger", similar: "github.com/acme/logger", reason: "edit distance 1"},
+		{path: "github.com/acme/lgoger", similar: "github.com/acme/logger", reason: "edit distance 1"},
+		{path: "github.com/Acme/logger", similar: "github.com/acme/logger", reason: "edit distance 1"},
+		{path: "github.com/acme/1ogger", similar: "github.com/acme/logger", reason: "homoglyph"},
+		{path: "github.com/acme/modem", similar: "github.com/acme/modern", reason: "homoglyph"},
+		{path: "github.com/acme/unpopu1ar"},
+		{path: "github.com/acme/metrics"},
+		{path: "github.com/other/logger"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			mu.Lock()
+			warnings = nil
+			mu.Unlock()
+
+			id := lookup(t, tt.path, "v1.0.0")
+			annotations, err := db.Annotations(t.Context(), id)
+			require.NoError(t, err)
+
+			if tt.similar == "" {
+				require.Empty(t, warnings)
+				require.Empty(t, annotations)
+				return
+			}
+
+			require.Equal(t, []*TyposquatWarning{{
+				ID:      id,
+				Path:    tt.path,
+				Version: "v1.0.0",
+				Similar: tt.similar,
+				Reason:  tt.reason,
+			}}, warnings)
+			require.Equal(t, "similar to "+tt.similar+" ("+tt.reason+")", annotations["typosquat"])
+		})
+	}
+
+	t.Run("only first-seen paths are checked", func(t *testing.T) {
+		mu.Lock()
+		warnings = nil
+		mu.Unlock()
+
+		lookup(t, "github.com/acme/loger", "v1.0.1")
+		require.Empty(t, warnings)
+	})
+}
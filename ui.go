@@ -0,0 +1,177 @@
+package sumdb
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pseudomuto/sumdb/internal/tree"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// maxRecentRecords is the most records returned by the admin API's GET /records.
+const maxRecentRecords = 100
+
+//go:embed ui
+var uiFiles embed.FS
+
+// adminProof is the JSON representation of a record's inclusion proof.
+type adminProof struct {
+	ID         int64    `json:"id"`
+	TreeSize   int64    `json:"tree_size"`
+	RootHash   string   `json:"root_hash"`
+	RecordHash string   `json:"record_hash"`
+	Proof      []string `json:"proof"`
+	SignedHead string   `json:"signed_head"`
+}
+
+// uiHandler serves the admin UI's static assets, embedded in the binary so that the UI needs no extra files.
+func uiHandler() http.Handler {
+	files, _ := fs.Sub(uiFiles, "ui")
+	return http.StripPrefix("/ui/", http.FileServerFS(files))
+}
+
+// serveRecentRecords serves GET /records requests, returning the latest n records, newest first. Older records can be
+// paged through with before, the ID of the oldest record already seen.
+func (s *SumDB) serveRecentRecords(w http.ResponseWriter, r *http.Request) {
+	size, err := s.store.TreeSize(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	n, err := queryInt(r, "n", 20)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before, err := queryInt(r, "before", size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before = min(before, size)
+	from := max(before-min(n, maxRecentRecords), 0)
+	recs, err := s.store.Records(r.Context(), from, before-from)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]apiRecord, len(recs))
+	for i, rec := range slices.Backward(recs) {
+		out[len(recs)-1-i] = newAPIRecord(rec.ID, rec)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// serveSearchRecords serves GET /records/search?module=path@version requests, returning the record for the module
+// version. Unlike lookups, searching never creates records.
+func (s *SumDB) serveSearchRecords(w http.ResponseWriter, r *http.Request) {
+	path, version, ok := strings.Cut(r.URL.Query().Get("module"), "@")
+	if !ok || path == "" || version == "" {
+		http.Error(w, "module must be given as path@version", http.StatusBadRequest)
+		return
+	}
+
+	id, err := s.store.RecordID(r.Context(), path, version)
+	if err != nil {
+		reportError(w, err)
+		return
+	}
+
+	recs, err := s.store.Records(r.Context(), id, 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(recs) == 0 {
+		reportError(w, ErrNotFound)
+		return
+	}
+
+	annotations, err := s.Annotations(r.Context(), id)
+	if err != nil && !errors.Is(err, ErrAnnotationsUnsupported) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rec := newAPIRecord(id, recs[0])
+	rec.Annotations = annotations
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// serveRecordProof serves GET /records/{id}/proof requests, returning the proof that the record is included in the
+// current tree, or the tree with the given size with ?size={size}, along with the signed tree head it can be checked
+// against.
+func (s *SumDB) serveRecordProof(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 0 {
+		http.Error(w, "invalid record id", http.StatusBadRequest)
+		return
+	}
+
+	size, err := s.store.TreeSize(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if size, err = queryInt(r, "size", size); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The proof, root hash and signed tree head must all be for the same tree, which may grow in the meantime.
+	proof, t, err := s.proveRecord(r.Context(), id, size)
+	if err != nil {
+		http.Error(w, err.Error(), proofStatus(err))
+		return
+	}
+
+	recs, err := s.store.Records(r.Context(), id, 1)
+	if err != nil || len(recs) == 0 {
+		http.Error(w, "failed to read record", http.StatusInternalServerError)
+		return
+	}
+
+	signed, err := s.signTree(r.Context(), t)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	out := adminProof{
+		ID:         id,
+		TreeSize:   size,
+		RootHash:   t.Hash.String(),
+		RecordHash: tlog.RecordHash(recs[0].Data).String(),
+		Proof:      make([]string, len(proof)),
+		SignedHead: string(signed),
+	}
+	for i, h := range proof {
+		out.Proof[i] = h.String()
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// signedAt returns the root hash of the tree when it had the given size, along with a signed tree head for it.
+func (s *SumDB) signedAt(ctx context.Context, size int64) (tlog.Hash, []byte, error) {
+	root, err := tree.TreeHashAt(ctx, s.store, size)
+	if err != nil {
+		return tlog.Hash{}, nil, err
+	}
+
+	signed, err := s.signTree(ctx, tlog.Tree{N: size, Hash: root})
+	if err != nil {
+		return tlog.Hash{}, nil, err
+	}
+
+	return root, signed, nil
+}
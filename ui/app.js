@@ -0,0 +1,106 @@
+// The admin UI is served from <admin>/ui/, so the admin API is one level up.
+const api = (path) => fetch(`../${path}`, { headers: { Accept: "application/json" } }).then(async (resp) => {
+  if (!resp.ok) {
+    throw new Error(`${path}: ${(await resp.text()).trim() || resp.statusText}`);
+  }
+  return resp.json();
+});
+
+const $ = (id) => document.getElementById(id);
+
+// el creates an element with the given text content and children.
+function el(tag, text, ...children) {
+  const e = document.createElement(tag);
+  if (text !== undefined) {
+    e.textContent = text;
+  }
+  e.append(...children);
+  return e;
+}
+
+function showError(err) {
+  $("error").textContent = err.message;
+  $("error").hidden = false;
+}
+
+async function loadStatus() {
+  const status = await api("status");
+  $("tree-size").textContent = status.tree_size;
+  $("root-hash").textContent = status.root_hash;
+
+  const quarantined = await api("quarantine");
+  $("quarantined").textContent = quarantined.length;
+}
+
+let oldest;
+
+async function loadRecords() {
+  const query = oldest === undefined ? "" : `&before=${oldest}`;
+  const records = await api(`records?n=20${query}`);
+  for (const rec of records) {
+    const prove = el("button", "Proof");
+    prove.onclick = () => showProof(rec.id);
+    $("records").append(el("tr", undefined, el("td", rec.id), el("td", rec.path), el("td", rec.version),
+      el("td", undefined, prove)));
+  }
+
+  if (records.length > 0) {
+    oldest = records[records.length - 1].id;
+  }
+  $("older").hidden = records.length === 0 || oldest === 0;
+}
+
+function showRecord(rec) {
+  const annotations = Object.entries(rec.annotations || {}).map(([k, v]) => `${k}: ${v}`).join("\n");
+  $("search-result").replaceChildren(
+    el("p", `Record ${rec.id}`),
+    el("pre", rec.data),
+    ...(annotations ? [el("h3", "Annotations"), el("pre", annotations)] : []),
+  );
+}
+
+// showProof shows the record's path from its leaf up to the root. Each step combines the node reached so far with a
+// sibling on its left or right, whose hashes make up the inclusion proof.
+async function showProof(id) {
+  $("proof").elements.id.value = id;
+  const path = await api(`records/${id}/path`);
+  const records = (step) => step.sibling_end - step.sibling_start === 1
+    ? `record ${step.sibling_start}`
+    : `records ${step.sibling_start}-${step.sibling_end - 1}`;
+  $("proof-result").replaceChildren(
+    el("p", `Record ${path.id} in tree of size ${path.tree_size}`),
+    el("dl", undefined,
+      el("dt", "Record hash"), el("dd", path.record_hash),
+      el("dt", "Root hash"), el("dd", path.root_hash)),
+    el("h3", "Path"),
+    el("table", undefined,
+      el("thead", undefined, el("tr", undefined, el("th", "Level"), el("th", "Sibling"), el("th", "Hash"))),
+      el("tbody", undefined, ...path.path.map((step) => el("tr", undefined,
+        el("td", step.level),
+        el("td", undefined,
+          el("div", `${step.direction === "left" ? "\u2190" : "\u2192"} ${records(step)}`),
+          el("div", step.sibling)),
+        el("td", step.hash))))),
+    el("h3", "Signed tree head"),
+    el("pre", path.signed_head),
+  );
+  for (const e of $("proof-result").querySelectorAll("dd, td:not(:first-child)")) {
+    e.classList.add("hash");
+  }
+}
+
+$("search").onsubmit = (e) => {
+  e.preventDefault();
+  const module = e.target.elements.module.value.trim();
+  api(`records/search?module=${encodeURIComponent(module)}`).then(showRecord).catch(showError);
+};
+
+$("proof").onsubmit = (e) => {
+  e.preventDefault();
+  showProof(e.target.elements.id.value).catch(showError);
+};
+
+$("older").onclick = () => loadRecords().catch(showError);
+
+loadStatus().catch(showError);
+loadRecords().catch(showError);
@@ -0,0 +1,182 @@
+package sumdb_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestAdminUI(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	db, err := New("test.example.com", skey,
+		WithStore(newMemStore()),
+		WithUpstream(newFakeProxy(t).upstream(t)),
+		WithAdminIdentity(IdentityFunc(func(r *http.Request) (Identity, error) {
+			if r.Header.Get("Authorization") == "" {
+				return Identity{}, ErrUnauthenticated
+			}
+			return Identity{Subject: "alice", Role: RoleViewer}, nil
+		})),
+	)
+	require.NoError(t, err)
+
+	for i := range 5 {
+		_, err := db.Lookup(t.Context(), module.Version{Path: fmt.Sprintf("example.com/mod%d", i), Version: "v1.0.0"})
+		require.NoError(t, err)
+	}
+
+	get := func(t *testing.T, path string, v any) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer viewer")
+		rec := httptest.NewRecorder()
+		db.AdminHandler().ServeHTTP(rec, req)
+		if v != nil && rec.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(v))
+		}
+		return rec
+	}
+
+	t.Run("static assets", func(t *testing.T) {
+		rec := get(t, "/ui/", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), "<title>sumdb admin</title>")
+
+		for _, path := range []string{"/ui/app.js", "/ui/style.css"} {
+			require.Equal(t, http.StatusOK, get(t, path, nil).Code, path)
+		}
+
+		// The UI is behind the admin API's authentication.
+		rec = httptest.NewRecorder()
+		db.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("recent records", func(t *testing.T) {
+		var recs []struct {
+			ID   int64  `json:"id"`
+			Path string `json:"path"`
+		}
+		require.Equal(t, http.StatusOK, get(t, "/records?n=3", &recs).Code)
+		require.Len(t, recs, 3)
+		require.Equal(t, int64(4), recs[0].ID)
+		require.Equal(t, "example.com/mod4", recs[0].Path)
+		require.Equal(t, int64(2), recs[2].ID)
+
+		require.Equal(t, http.StatusOK, get(t, "/records?n=3&before=2", &recs).Code)
+		require.Len(t, recs, 2)
+		require.Equal(t, int64(1), recs[0].ID)
+		require.Equal(t, int64(0), recs[1].ID)
+
+		require.Equal(t, http.StatusBadRequest, get(t, "/records?n=x", nil).Code)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		var rec struct {
+			ID   int64  `json:"id"`
+			Data string `json:"data"`
+		}
+		require.Equal(t, http.StatusOK, get(t, "/records/search?module=example.com/mod3@v1.0.0", &rec).Code)
+		require.Equal(t, int64(3), rec.ID)
+		require.Contains(t, rec.Data, "example.com/mod3 v1.0.0 h1:")
+
+		// Searching never creates records.
+		require.Equal(t, http.StatusNotFound, get(t, "/records/search?module=example.com/new@v1.0.0", nil).Code)
+		require.Equal(t, http.StatusBadRequest, get(t, "/records/search?module=example.com/mod3", nil).Code)
+	})
+
+	t.Run("proofs", func(t *testing.T) {
+		var proof struct {
+			ID         int64    `json:"id"`
+			TreeSize   int64    `json:"tree_size"`
+			RootHash   string   `json:"root_hash"`
+			RecordHash string   `json:"record_hash"`
+			Proof      []string `json:"proof"`
+			SignedHead string   `json:"signed_head"`
+		}
+		require.Equal(t, http.StatusOK, get(t, "/records/2/proof", &proof).Code)
+		require.Equal(t, int64(5), proof.TreeSize)
+
+		verifier, err := note.NewVerifier(vkey)
+		require.NoError(t, err)
+		n, err := note.Open([]byte(proof.SignedHead), note.VerifierList(verifier))
+		require.NoError(t, err)
+		tree, err := tlog.ParseTree([]byte(n.Text))
+		require.NoError(t, err)
+		require.Equal(t, proof.RootHash, tree.Hash.String())
+
+		recordProof := make(tlog.RecordProof, len(proof.Proof))
+		for i, h := range proof.Proof {
+			recordProof[i], err = tlog.ParseHash(h)
+			require.NoError(t, err)
+		}
+		leaf, err := tlog.ParseHash(proof.RecordHash)
+		require.NoError(t, err)
+		require.NoError(t, tlog.CheckRecord(recordProof, tree.N, tree.Hash, 2, leaf))
+
+		require.Equal(t, http.StatusNotFound, get(t, "/records/5/proof", nil).Code)
+		require.Equal(t, http.StatusBadRequest, get(t, "/records/x/proof", nil).Code)
+	})
+
+	t.Run("paths", func(t *testing.T) {
+		type step struct {
+			Level        int    `json:"level"`
+			Direction    string `json:"direction"`
+			Sibling      string `json:"sibling"`
+			SiblingStart int64  `json:"sibling_start"`
+			SiblingEnd   int64  `json:"sibling_end"`
+			Hash         string `json:"hash"`
+		}
+		var path struct {
+			TreeSize   int64  `json:"tree_size"`
+			RecordHash string `json:"record_hash"`
+			RootHash   string `json:"root_hash"`
+			Path       []step `json:"path"`
+		}
+		require.Equal(t, http.StatusOK, get(t, "/records/2/path", &path).Code)
+		require.Equal(t, int64(5), path.TreeSize)
+
+		// Record 2 is joined by record 3 on its right, then records 0-1 on the left, then record 4 on the right.
+		require.Len(t, path.Path, 3)
+		require.Equal(t, []string{"right", "left", "right"}, []string{
+			path.Path[0].Direction, path.Path[1].Direction, path.Path[2].Direction,
+		})
+		require.Equal(t, []int{1, 2, 3}, []int{path.Path[0].Level, path.Path[1].Level, path.Path[2].Level})
+		require.Equal(t, int64(0), path.Path[1].SiblingStart)
+		require.Equal(t, int64(2), path.Path[1].SiblingEnd)
+
+		node, err := tlog.ParseHash(path.RecordHash)
+		require.NoError(t, err)
+		for _, s := range path.Path {
+			sibling, err := tlog.ParseHash(s.Sibling)
+			require.NoError(t, err)
+			if s.Direction == "left" {
+				node = tlog.NodeHash(sibling, node)
+			} else {
+				node = tlog.NodeHash(node, sibling)
+			}
+			require.Equal(t, s.Hash, node.String())
+		}
+		require.Equal(t, path.RootHash, node.String())
+
+		// The path is also served by the JSON API.
+		rec := httptest.NewRecorder()
+		db.APIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records/2/path", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), path.RootHash)
+
+		require.Equal(t, http.StatusNotFound, get(t, "/records/5/path", nil).Code)
+		require.Equal(t, http.StatusBadRequest, get(t, "/records/x/path", nil).Code)
+	})
+}
@@ -0,0 +1,171 @@
+package sumdb_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+// fakeProxy is a Go module proxy that serves a minimal go.mod and zip for any module version.
+type fakeProxy struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	times    map[string]time.Time // .info times by module@version, defaults to the zero time
+	missing  map[string]bool      // module@versions that return 404
+	tampered map[string]bool      // module@versions served with different content
+	delay    time.Duration        // delay before serving zips
+	down     bool                 // whether every request fails with 502
+	failures int                  // number of upcoming requests that fail with 503
+	requests []string
+}
+
+func newFakeProxy(t testing.TB) *fakeProxy {
+	t.Helper()
+
+	p := &fakeProxy{
+		times:    make(map[string]time.Time),
+		missing:  make(map[string]bool),
+		tampered: make(map[string]bool),
+	}
+	p.Server = httptest.NewServer(http.HandlerFunc(p.serve))
+	t.Cleanup(p.Close)
+	return p
+}
+
+// upstream returns the proxy's URL for use with WithUpstream.
+func (p *fakeProxy) upstream(t testing.TB) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(p.URL)
+	require.NoError(t, err)
+	return u
+}
+
+// setTime sets the .info time for mod.
+func (p *fakeProxy) setTime(mod module.Version, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.times[mod.String()] = at
+}
+
+// setMissing sets whether requests for mod return 404 Not Found.
+func (p *fakeProxy) setMissing(mod module.Version, missing bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.missing[mod.String()] = missing
+}
+
+// setDelay sets how long to wait before serving module zips.
+func (p *fakeProxy) setDelay(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.delay = d
+}
+
+// setDown sets whether every request fails with 502 Bad Gateway, as if the proxy was down.
+func (p *fakeProxy) setDown(down bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down = down
+}
+
+// setFailures makes the next n requests fail with 503 Service Unavailable, as if the proxy was briefly overloaded.
+func (p *fakeProxy) setFailures(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures = n
+}
+
+// setTampered sets whether mod is served with different content than other proxies serve.
+func (p *fakeProxy) setTampered(mod module.Version, tampered bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tampered[mod.String()] = tampered
+}
+
+// requested returns the paths requested so far.
+func (p *fakeProxy) requested() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.requests...)
+}
+
+func (p *fakeProxy) serve(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.requests = append(p.requests, r.URL.Path)
+	down, failing := p.down, p.failures > 0
+	if failing {
+		p.failures--
+	}
+	p.mu.Unlock()
+	if down {
+		http.Error(w, "upstream down", http.StatusBadGateway)
+		return
+	}
+	if failing {
+		http.Error(w, "upstream overloaded", http.StatusServiceUnavailable)
+		return
+	}
+
+	escPath, file, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/@v/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	dot := strings.LastIndex(file, ".")
+	path, err1 := module.UnescapePath(escPath)
+	version, err2 := module.UnescapeVersion(file[:max(dot, 0)])
+	if dot < 0 || err1 != nil || err2 != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	mod := module.Version{Path: path, Version: version}
+	p.mu.Lock()
+	missing, tampered, delay := p.missing[mod.String()], p.tampered[mod.String()], p.delay
+	p.mu.Unlock()
+	if missing {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch file[dot+1:] {
+	case "info":
+		p.mu.Lock()
+		at := p.times[mod.String()]
+		p.mu.Unlock()
+		_, _ = fmt.Fprintf(w, `{"Version":%q,"Time":%q}`, version, at.Format(time.RFC3339))
+	case "mod":
+		_, _ = fmt.Fprintf(w, "module %s\n", path)
+		if tampered {
+			_, _ = fmt.Fprintf(w, "\nrequire example.com/evil v1.0.0\n")
+		}
+	case "zip":
+		time.Sleep(delay)
+		http.ServeContent(w, r, file, time.Time{}, bytes.NewReader(moduleZip(mod)))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// moduleZip returns a module zip containing only a go.mod file.
+func moduleZip(mod module.Version) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create(mod.String() + "/go.mod")
+	_, _ = fmt.Fprintf(w, "module %s\n", mod.Path)
+	_ = zw.Close()
+	return buf.Bytes()
+}
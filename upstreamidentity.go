@@ -0,0 +1,327 @@
+package sumdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pseudomuto/sumdb/internal/lru"
+)
+
+const (
+	// defaultTokenCacheSize is the number of exchanged tokens cached by TokenExchange when no size is configured.
+	defaultTokenCacheSize = 1000
+
+	// tokenExpiryMargin is how long before they expire exchanged tokens stop being used, so they don't expire in flight.
+	tokenExpiryMargin = 30 * time.Second
+
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// ErrTokenExchange is returned (wrapped) when a TokenExchange can't exchange a client's token.
+var ErrTokenExchange = errors.New("token exchange failed")
+
+type (
+	// UpstreamIdentity derives the credentials sent to upstream proxies (and checksum databases) when fetching modules
+	// on behalf of a client, so that the upstream's own audit logs attribute downloads to the client rather than to the
+	// sumdb. See WithUpstreamIdentity.
+	UpstreamIdentity interface {
+		// UpstreamHeaders returns the headers to set on upstream requests made on behalf of the client that sent r.
+		// Returning no headers sends the requests with the sumdb's own credentials, and returning an error fails them.
+		UpstreamHeaders(ctx context.Context, r *http.Request) (http.Header, error)
+	}
+
+	// UpstreamIdentityFunc is an adapter to allow the use of ordinary functions as an UpstreamIdentity.
+	UpstreamIdentityFunc func(ctx context.Context, r *http.Request) (http.Header, error)
+
+	// TokenExchangeConfig configures TokenExchange.
+	TokenExchangeConfig struct {
+		// TokenURL is the token endpoint of the authorization server.
+		TokenURL string
+
+		// ClientID and ClientSecret authenticate the sumdb to the authorization server (with HTTP Basic
+		// authentication), when set.
+		ClientID     string
+		ClientSecret string
+
+		// Audience and Scope, when set, are the audience and scope requested for the exchanged tokens (e.g. the
+		// upstream proxy's URL).
+		Audience string
+		Scope    string
+
+		// HTTPClient is the client used to call the token endpoint. Defaults to a client with a 10s timeout.
+		HTTPClient *http.Client
+
+		// CacheSize is the number of exchanged tokens cached until they expire. Defaults to 1000.
+		CacheSize int
+
+		// Clock is the clock exchanged tokens expire by. Defaults to the Clock of the SumDB it's used with (see
+		// WithClock).
+		Clock Clock
+	}
+
+	// tokenExchange is the UpstreamIdentity returned by TokenExchange.
+	tokenExchange struct {
+		cfg    TokenExchangeConfig
+		client *http.Client
+		clock  Clock
+		tokens *lru.Cache[[sha256.Size]byte, exchangedToken]
+	}
+
+	// exchangedToken is a token issued by a token exchange, cached by the hash of the token it was exchanged for.
+	exchangedToken struct {
+		token   string
+		expires time.Time
+	}
+
+	// identityTransport is an http.RoundTripper setting the headers of the UpstreamIdentity on requests made on behalf
+	// of a client (see WithRequester).
+	identityTransport struct {
+		next     http.RoundTripper
+		identity UpstreamIdentity
+	}
+
+	// requesterKey is the context key for the client request set with WithRequester.
+	requesterKey struct{}
+)
+
+// UpstreamHeaders calls f(ctx, r).
+func (f UpstreamIdentityFunc) UpstreamHeaders(ctx context.Context, r *http.Request) (http.Header, error) {
+	return f(ctx, r)
+}
+
+// WithRequester returns a copy of ctx recording that work done with it is on behalf of the client that sent r, so that
+// modules fetched by lookups made with it are requested with the client's identity (see WithUpstreamIdentity). Lookups
+// served by Handler and LookupHandler set it themselves. r must not be modified afterwards.
+func WithRequester(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, requesterKey{}, r)
+}
+
+// requesterFrom returns the client request set with WithRequester, if any.
+func requesterFrom(ctx context.Context) (*http.Request, bool) {
+	r, ok := ctx.Value(requesterKey{}).(*http.Request)
+	return r, ok
+}
+
+// identityKey returns the key distinguishing lookups made with ctx by the upstream credentials they fetch modules with
+// (see requesterIdentityKey), so that concurrent lookups only share a fetch when it's made on behalf of the same
+// identity. It's empty for lookups using the sumdb's own credentials.
+func (s *SumDB) identityKey(ctx context.Context) string {
+	if s.upstreamIdentity == nil {
+		return ""
+	}
+
+	r, ok := requesterFrom(ctx)
+	if !ok {
+		return ""
+	}
+	return s.requesterIdentityKey(ctx, r)
+}
+
+// requesterIdentityKey returns a hash of the upstream headers derived from the client's request r, or an empty string
+// if the client's modules are fetched with the sumdb's own credentials. Requests the headers can't be derived for get a
+// key of their own, so that each fails with its own error rather than sharing someone else's fetch.
+func (s *SumDB) requesterIdentityKey(ctx context.Context, r *http.Request) string {
+	h, err := s.upstreamIdentity.UpstreamHeaders(ctx, r)
+	if err != nil {
+		return fmt.Sprintf("request:%p", r)
+	}
+	if len(h) == 0 {
+		return ""
+	}
+
+	// Header.Write sorts the headers by name, so equal headers hash the same.
+	sum := sha256.New()
+	_ = h.Write(sum)
+	return "identity:" + hex.EncodeToString(sum.Sum(nil))
+}
+
+// ForwardHeaders forwards the named headers of the client's request (e.g. "Authorization" when the upstream accepts
+// the same credentials, or a header set by an authenticating reverse proxy) to the upstream.
+func ForwardHeaders(names ...string) UpstreamIdentity {
+	return UpstreamIdentityFunc(func(_ context.Context, r *http.Request) (http.Header, error) {
+		h := make(http.Header)
+		for _, name := range names {
+			if v := r.Header.Values(name); len(v) > 0 {
+				h[http.CanonicalHeaderKey(name)] = v
+			}
+		}
+		return h, nil
+	})
+}
+
+// ForwardIdentity authenticates the client's request with ids (e.g. BearerIdentity or MTLSIdentity) and sends the
+// subject of its Identity to the upstream in the named header (e.g. "X-Forwarded-User"). Unauthenticated clients'
+// modules are fetched with the sumdb's own credentials.
+func ForwardIdentity(header string, ids IdentityExtractor) UpstreamIdentity {
+	return UpstreamIdentityFunc(func(_ context.Context, r *http.Request) (http.Header, error) {
+		id, err := ids.Identify(r)
+		switch {
+		case errors.Is(err, ErrUnauthenticated):
+			return nil, nil
+		case err != nil:
+			return nil, err
+		}
+
+		h := make(http.Header)
+		h.Set(header, id.Subject)
+		return h, nil
+	})
+}
+
+// TokenExchange exchanges the bearer token of the client's request for a token issued for the upstream by an OAuth 2.0
+// token exchange (RFC 8693), and sends it to the upstream as its bearer token. Exchanged tokens are cached until
+// shortly before they expire. Clients without a bearer token have their modules fetched with the sumdb's own
+// credentials, and failed exchanges fail the fetch with an error wrapping ErrTokenExchange.
+func TokenExchange(cfg TokenExchangeConfig) UpstreamIdentity {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	size := cfg.CacheSize
+	if size <= 0 {
+		size = defaultTokenCacheSize
+	}
+
+	clock := cfg.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	return &tokenExchange{
+		cfg:    cfg,
+		client: client,
+		clock:  clock,
+		tokens: lru.New[[sha256.Size]byte, exchangedToken](size),
+	}
+}
+
+// UpstreamHeaders implements UpstreamIdentity.
+func (e *tokenExchange) UpstreamHeaders(ctx context.Context, r *http.Request) (http.Header, error) {
+	subject, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subject == "" {
+		return nil, nil
+	}
+
+	key := sha256.Sum256([]byte(subject))
+	tok, ok := e.tokens.Get(key)
+	if !ok || e.clock.Now().After(tok.expires.Add(-tokenExpiryMargin)) {
+		var err error
+		if tok, err = e.exchange(ctx, subject); err != nil {
+			return nil, err
+		}
+		if !tok.expires.IsZero() {
+			e.tokens.Add(key, tok)
+		}
+	}
+
+	h := make(http.Header)
+	h.Set("Authorization", "Bearer "+tok.token)
+	return h, nil
+}
+
+// exchange exchanges subject for a token at the token endpoint. Tokens issued without an expiry have a zero expires.
+func (e *tokenExchange) exchange(ctx context.Context, subject string) (exchangedToken, error) {
+	form := url.Values{
+		"grant_type":         {grantTypeTokenExchange},
+		"subject_token":      {subject},
+		"subject_token_type": {tokenTypeAccessToken},
+	}
+	if e.cfg.Audience != "" {
+		form.Set("audience", e.cfg.Audience)
+	}
+	if e.cfg.Scope != "" {
+		form.Set("scope", e.cfg.Scope)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return exchangedToken{}, fmt.Errorf("%w: %w", ErrTokenExchange, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if e.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(e.cfg.ClientID), url.QueryEscape(e.cfg.ClientSecret))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return exchangedToken{}, fmt.Errorf("%w: %w", ErrTokenExchange, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return exchangedToken{}, fmt.Errorf("%w: %s", ErrTokenExchange, resp.Status)
+	}
+
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return exchangedToken{}, fmt.Errorf("%w: failed to decode response: %w", ErrTokenExchange, err)
+	}
+	if out.AccessToken == "" {
+		return exchangedToken{}, fmt.Errorf("%w: no access token issued", ErrTokenExchange)
+	}
+
+	tok := exchangedToken{token: out.AccessToken}
+	if out.ExpiresIn > 0 {
+		tok.expires = e.clock.Now().Add(time.Duration(out.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
+
+// RoundTrip implements http.RoundTripper. Redirects aren't sent the client's credentials, since they may lead to
+// other hosts (e.g. the storage backing a proxy).
+func (t *identityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	client, ok := requesterFrom(req.Context())
+	if !ok || req.Response != nil {
+		return t.next.RoundTrip(req)
+	}
+
+	h, err := t.identity.UpstreamHeaders(req.Context(), client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upstream identity: %w", err)
+	}
+	if len(h) == 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the request.
+	req = req.Clone(req.Context())
+	for name, v := range h {
+		req.Header[name] = v
+	}
+	return t.next.RoundTrip(req)
+}
+
+// configureIdentity wraps the transport of the HTTP client used for upstreams to send the credentials of the
+// UpstreamIdentity set with WithUpstreamIdentity. The client is copied rather than modified, since it may be shared
+// with the caller. Token exchanges without a Clock of their own expire tokens by the SumDB's.
+func (s *SumDB) configureIdentity() {
+	if s.upstreamIdentity == nil {
+		return
+	}
+
+	if e, ok := s.upstreamIdentity.(*tokenExchange); ok && e.cfg.Clock == nil {
+		e.clock = s.clock
+	}
+
+	next := s.http.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	client := *s.http
+	client.Transport = &identityTransport{next: next, identity: s.upstreamIdentity}
+	s.http = &client
+}
@@ -0,0 +1,171 @@
+package sumdb_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestUpstreamIdentity(t *testing.T) {
+	skey, _, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	// newDB returns a SumDB using identity, and a function returning the values of the named header sent with the
+	// upstream requests made since it was last called (two per module: its go.mod and zip), and the proxy behind it.
+	newDB := func(t *testing.T, identity UpstreamIdentity) (*SumDB, func(name string) []string, *fakeProxy) {
+		t.Helper()
+
+		var (
+			mu      sync.Mutex
+			headers []http.Header
+		)
+		p := newFakeProxy(t)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			headers = append(headers, r.Header.Clone())
+			mu.Unlock()
+			p.Config.Handler.ServeHTTP(w, r)
+		}))
+		t.Cleanup(srv.Close)
+
+		u, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		db, err := New("test.example.com", skey, WithStore(newMemStore()), WithUpstream(u), WithUpstreamIdentity(identity))
+		require.NoError(t, err)
+
+		sent := func(name string) []string {
+			mu.Lock()
+			defer mu.Unlock()
+
+			values := make([]string, len(headers))
+			for i, h := range headers {
+				values[i] = h.Get(name)
+			}
+			headers = nil
+			return values
+		}
+		return db, sent, p
+	}
+
+	lookup := func(t *testing.T, db *SumDB, path string, header http.Header) int {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/lookup/"+path, nil)
+		for name, v := range header {
+			req.Header[name] = v
+		}
+		rec := httptest.NewRecorder()
+		db.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	t.Run("headers", func(t *testing.T) {
+		db, sent, _ := newDB(t, ForwardHeaders("X-Forwarded-User"))
+
+		require.Equal(t, http.StatusOK, lookup(t, db, "example.com/a@v1.0.0", http.Header{"X-Forwarded-User": {"alice"}}))
+		require.Equal(t, []string{"alice", "alice"}, sent("X-Forwarded-User"))
+
+		// Clients without the header have modules fetched with the sumdb's own credentials.
+		require.Equal(t, http.StatusOK, lookup(t, db, "example.com/b@v1.0.0", nil))
+		require.Equal(t, []string{"", ""}, sent("X-Forwarded-User"))
+
+		// Lookups made outside of the handler use the requester set on their context.
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-User", "bob")
+		_, err := db.Lookup(WithRequester(t.Context(), req), module.Version{Path: "example.com/c", Version: "v1.0.0"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"bob", "bob"}, sent("X-Forwarded-User"))
+	})
+
+	t.Run("concurrent clients", func(t *testing.T) {
+		db, sent, p := newDB(t, ForwardHeaders("X-Forwarded-User"))
+		p.setDelay(100 * time.Millisecond)
+
+		// Concurrent lookups of a module only share a fetch when they're made with the same credentials.
+		var wg sync.WaitGroup
+		for _, user := range []string{"alice", "bob", "alice"} {
+			wg.Go(func() {
+				header := http.Header{"X-Forwarded-User": {user}}
+				require.Equal(t, http.StatusOK, lookup(t, db, "example.com/a@v1.0.0", header))
+			})
+		}
+		wg.Wait()
+
+		require.ElementsMatch(t, []string{"alice", "alice", "bob", "bob"}, sent("X-Forwarded-User"))
+	})
+
+	t.Run("identity", func(t *testing.T) {
+		ids := BearerIdentity(func(_ context.Context, token string) (Identity, error) {
+			if token != "secret" {
+				return Identity{}, ErrUnauthenticated
+			}
+			return Identity{Subject: "alice@example.com", Role: RoleNone}, nil
+		})
+		db, sent, _ := newDB(t, ForwardIdentity("X-Requester", ids))
+
+		header := http.Header{"Authorization": {"Bearer secret"}}
+		require.Equal(t, http.StatusOK, lookup(t, db, "example.com/a@v1.0.0", header))
+		require.Equal(t, []string{"alice@example.com", "alice@example.com"}, sent("X-Requester"))
+
+		header = http.Header{"Authorization": {"Bearer wrong"}}
+		require.Equal(t, http.StatusOK, lookup(t, db, "example.com/b@v1.0.0", header))
+		require.Equal(t, []string{"", ""}, sent("X-Requester"))
+	})
+
+	t.Run("token exchange", func(t *testing.T) {
+		var exchanges atomic.Int64
+		issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			exchanges.Add(1)
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "urn:ietf:params:oauth:grant-type:token-exchange", r.Form.Get("grant_type"))
+			require.Equal(t, "https://proxy.example.com", r.Form.Get("audience"))
+
+			id, secret, ok := r.BasicAuth()
+			require.True(t, ok)
+			require.Equal(t, "sumdb", id)
+			require.Equal(t, "client-secret", secret)
+
+			if r.Form.Get("subject_token") == "revoked" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"access_token":"upstream-%s","token_type":"Bearer","expires_in":3600}`,
+				r.Form.Get("subject_token"))
+		}))
+		t.Cleanup(issuer.Close)
+
+		db, sent, _ := newDB(t, TokenExchange(TokenExchangeConfig{
+			TokenURL:     issuer.URL,
+			ClientID:     "sumdb",
+			ClientSecret: "client-secret",
+			Audience:     "https://proxy.example.com",
+		}))
+
+		header := http.Header{"Authorization": {"Bearer client"}}
+		require.Equal(t, http.StatusOK, lookup(t, db, "example.com/a@v1.0.0", header))
+		require.Equal(t, http.StatusOK, lookup(t, db, "example.com/b@v1.0.0", header))
+		want := "Bearer upstream-client"
+		require.Equal(t, []string{want, want, want, want}, sent("Authorization"))
+		require.Equal(t, int64(1), exchanges.Load())
+
+		// Failed exchanges fail the fetch rather than falling back to the sumdb's credentials.
+		header = http.Header{"Authorization": {"Bearer revoked"}}
+		require.Equal(t, http.StatusInternalServerError, lookup(t, db, "example.com/c@v1.0.0", header))
+		require.Empty(t, sent("Authorization"))
+
+		_, err := db.Lookup(t.Context(), module.Version{Path: "example.com/c", Version: "v1.0.0"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"", ""}, sent("Authorization"))
+	})
+}
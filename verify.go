@@ -0,0 +1,242 @@
+package sumdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pseudomuto/sumdb/alert"
+	"golang.org/x/mod/module"
+)
+
+const (
+	// verifyBatchWorkers is the number of concurrent lookups made by VerifyBatch.
+	verifyBatchWorkers = 16
+
+	// maxVerifyBody is the largest go.sum accepted by POST /verify.
+	maxVerifyBody = 8 << 20
+)
+
+// Verification statuses.
+const (
+	// VerifyOK means the entry's hash matches the log.
+	VerifyOK VerifyStatus = "ok"
+
+	// VerifyMismatch means the log has a different hash for the entry.
+	VerifyMismatch VerifyStatus = "mismatch"
+
+	// VerifyNotFound means the module version doesn't exist upstream, so there's no record for it.
+	VerifyNotFound VerifyStatus = "not_found"
+
+	// VerifyError means the entry couldn't be verified (e.g. it was denied by policy or the upstream failed).
+	VerifyError VerifyStatus = "error"
+)
+
+type (
+	// GoSumEntry is a line of a go.sum file. Version ends with "/go.mod" for go.mod hashes.
+	GoSumEntry struct {
+		Path    string `json:"path"`
+		Version string `json:"version"`
+		Hash    string `json:"hash"`
+	}
+
+	// VerifyStatus is the result of verifying a GoSumEntry.
+	VerifyStatus string
+
+	// EntryResult is the result of verifying a single GoSumEntry.
+	EntryResult struct {
+		GoSumEntry
+
+		Status VerifyStatus `json:"status"`
+
+		// RecordID is the ID of the record for the module version, which is included in the report's signed tree
+		// head. It's -1 if there's no record.
+		RecordID int64 `json:"record_id"`
+
+		// Actual is the hash in the log, set when it doesn't match.
+		Actual string `json:"actual,omitempty"`
+
+		// Error describes why the entry couldn't be verified.
+		Error string `json:"error,omitempty"`
+	}
+
+	// Report is the result of VerifyBatch.
+	Report struct {
+		// OK is true if every entry was verified.
+		OK bool `json:"ok"`
+
+		// SignedHead is a signed tree head that includes every record referenced by the report.
+		SignedHead string `json:"signed_head"`
+
+		// Entries are the results for each entry, in the order they were given.
+		Entries []EntryResult `json:"entries"`
+	}
+)
+
+// VerifyBatch verifies a batch of go.sum entries (e.g. a CI job's whole dependency graph) against the log, looking up
+// each module version like Lookup does. Per-entry failures are reported in the Report rather than as errors.
+//
+// The report includes a signed tree head covering every record it references, so clients holding the verifier key
+// can check that the records are in the log with inclusion proofs from the tiles served by Handler.
+func (s *SumDB) VerifyBatch(ctx context.Context, entries []GoSumEntry) (*Report, error) {
+	// go.sum has separate entries for the module and its go.mod, which share a record.
+	type lookup struct {
+		id   int64
+		data []byte
+		err  error
+	}
+	lookups := make(map[module.Version]*lookup)
+	for _, e := range entries {
+		lookups[module.Version{Path: e.Path, Version: strings.TrimSuffix(e.Version, "/go.mod")}] = &lookup{id: -1}
+	}
+
+	sem := make(chan struct{}, verifyBatchWorkers)
+	var wg sync.WaitGroup
+	for mod, l := range lookups {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			l.id, l.data, l.err = s.lookupData(ctx, mod)
+		})
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{OK: true, Entries: make([]EntryResult, len(entries))}
+	var size int64
+	for i, e := range entries {
+		l := lookups[module.Version{Path: e.Path, Version: strings.TrimSuffix(e.Version, "/go.mod")}]
+		res := EntryResult{GoSumEntry: e, RecordID: l.id}
+
+		switch {
+		case errors.Is(l.err, ErrNotFound):
+			res.Status, res.Error = VerifyNotFound, l.err.Error()
+		case l.err != nil:
+			res.Status, res.Error = VerifyError, l.err.Error()
+		default:
+			size = max(size, l.id+1)
+			res.Status, res.Actual = VerifyMismatch, recordHash(l.data, e.Path, e.Version)
+			if res.Actual == e.Hash {
+				res.Status, res.Actual = VerifyOK, ""
+			}
+		}
+
+		report.OK = report.OK && res.Status == VerifyOK
+		report.Entries[i] = res
+	}
+
+	signed, err := s.signed(ctx, size)
+	if err != nil {
+		return nil, err
+	}
+	report.SignedHead = string(signed)
+
+	if mismatches := mismatchDetails(report); len(mismatches) > 0 {
+		s.raise(ctx, &alert.Alert{
+			Source:   alertSourceVerify,
+			Severity: alert.Critical,
+			Summary:  fmt.Sprintf("%d go.sum entries don't match the log", len(mismatches)),
+			Details:  mismatches,
+		})
+	}
+
+	return report, nil
+}
+
+// lookupData returns the ID and data of the record for mod, creating it if necessary.
+func (s *SumDB) lookupData(ctx context.Context, mod module.Version) (int64, []byte, error) {
+	if err := module.Check(mod.Path, mod.Version); err != nil {
+		return -1, nil, err
+	}
+
+	id, err := s.Lookup(ctx, mod)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	recs, err := s.store.Records(ctx, id, 1)
+	if err != nil {
+		return -1, nil, fmt.Errorf("failed to get record: %d, %w", id, err)
+	}
+	if len(recs) == 0 {
+		return -1, nil, fmt.Errorf("failed to get record: %d, %w", id, ErrNotFound)
+	}
+
+	return id, recs[0].Data, nil
+}
+
+// mismatchDetails returns the hashes of the entries of report that don't match the log, keyed by module version.
+func mismatchDetails(report *Report) map[string]string {
+	details := make(map[string]string)
+	for _, e := range report.Entries {
+		if e.Status == VerifyMismatch {
+			details[e.Path+" "+e.Version] = fmt.Sprintf("go.sum %s, log %s", e.Hash, e.Actual)
+		}
+	}
+	return details
+}
+
+// recordHash returns the hash for path and version in a record's data, or an empty string if there isn't one.
+func recordHash(data []byte, path, version string) string {
+	for line := range strings.Lines(string(data)) {
+		if f := strings.Fields(line); len(f) == 3 && f[0] == path && f[1] == version {
+			return f[2]
+		}
+	}
+	return ""
+}
+
+// ParseGoSum parses the entries in a go.sum file.
+func ParseGoSum(data []byte) ([]GoSumEntry, error) {
+	var entries []GoSumEntry
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		f := strings.Fields(sc.Text())
+		switch len(f) {
+		case 0:
+			continue
+		case 3:
+			entries = append(entries, GoSumEntry{Path: f[0], Version: f[1], Hash: f[2]})
+		default:
+			return nil, fmt.Errorf("malformed go.sum line %d: %q", n, sc.Text())
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read go.sum: %w", err)
+	}
+
+	return entries, nil
+}
+
+// serveVerify serves POST /verify requests. The body is a go.sum file and the response is the JSON Report.
+func (s *SumDB) serveVerify(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxVerifyBody))
+	if err != nil {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	entries, err := ParseGoSum(body)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	report, err := s.VerifyBatch(r.Context(), entries)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
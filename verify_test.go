@@ -0,0 +1,104 @@
+package sumdb_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/pseudomuto/sumdb"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+func TestVerifyBatch(t *testing.T) {
+	skey, vkey, err := GenerateKeys("test.example.com")
+	require.NoError(t, err)
+
+	upstream := newFakeProxy(t)
+	upstream.setMissing(module.Version{Path: "example.com/missing", Version: "v1.0.0"}, true)
+
+	db, err := New("test.example.com", skey, WithStore(newMemStore()), WithUpstream(upstream.upstream(t)))
+	require.NoError(t, err)
+
+	id, err := db.Lookup(t.Context(), module.Version{Path: "example.com/a", Version: "v1.0.0"})
+	require.NoError(t, err)
+	data, err := db.ReadRecords(t.Context(), id, 1)
+	require.NoError(t, err)
+
+	// Records are formatted like go.sum.
+	gosum, err := ParseGoSum(data[0])
+	require.NoError(t, err)
+	require.Len(t, gosum, 2)
+
+	t.Run("verifies entries", func(t *testing.T) {
+		entries := append(gosum,
+			GoSumEntry{Path: "example.com/a", Version: "v1.0.0", Hash: "h1:tampered="},
+			GoSumEntry{Path: "example.com/b", Version: "v1.0.0/go.mod", Hash: "h1:unknown="},
+			GoSumEntry{Path: "example.com/missing", Version: "v1.0.0", Hash: "h1:missing="},
+			GoSumEntry{Path: "example.com/a", Version: "not-a-version", Hash: "h1:invalid="},
+		)
+
+		report, err := db.VerifyBatch(t.Context(), entries)
+		require.NoError(t, err)
+		require.False(t, report.OK)
+		require.Len(t, report.Entries, len(entries))
+
+		for i, res := range report.Entries {
+			require.Equal(t, entries[i], res.GoSumEntry)
+		}
+
+		require.Equal(t, VerifyOK, report.Entries[0].Status)
+		require.Equal(t, VerifyOK, report.Entries[1].Status)
+		require.Equal(t, id, report.Entries[0].RecordID)
+
+		require.Equal(t, VerifyMismatch, report.Entries[2].Status)
+		require.Equal(t, gosum[0].Hash, report.Entries[2].Actual)
+
+		// Versions without records are looked up upstream.
+		require.Equal(t, VerifyMismatch, report.Entries[3].Status)
+		require.Equal(t, id+1, report.Entries[3].RecordID)
+		require.NotEmpty(t, report.Entries[3].Actual)
+
+		require.Equal(t, VerifyNotFound, report.Entries[4].Status)
+		require.Equal(t, int64(-1), report.Entries[4].RecordID)
+
+		require.Equal(t, VerifyError, report.Entries[5].Status)
+		require.NotEmpty(t, report.Entries[5].Error)
+
+		// The signed head includes every record in the report.
+		verifier, err := note.NewVerifier(vkey)
+		require.NoError(t, err)
+		n, err := note.Open([]byte(report.SignedHead), note.VerifierList(verifier))
+		require.NoError(t, err)
+		tree, err := tlog.ParseTree([]byte(n.Text))
+		require.NoError(t, err)
+		require.Equal(t, int64(2), tree.N)
+	})
+
+	t.Run("all verified", func(t *testing.T) {
+		report, err := db.VerifyBatch(t.Context(), gosum)
+		require.NoError(t, err)
+		require.True(t, report.OK)
+	})
+
+	t.Run("HTTP API", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		db.APIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader(string(data[0]))))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var report Report
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+		require.True(t, report.OK)
+		require.Len(t, report.Entries, 2)
+		require.Equal(t, VerifyOK, report.Entries[0].Status)
+
+		rec = httptest.NewRecorder()
+		db.APIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader("bad line\n")))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Contains(t, rec.Body.String(), "malformed go.sum line 1")
+	})
+}